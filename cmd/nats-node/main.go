@@ -4,10 +4,16 @@
 // Run it as:
 //   - Hub (standalone): NATS_PORT=4222 NATS_NAME=hub ./nats-node
 //   - Leaf node: NATS_HUB=nats://hub:4222 NATS_PORT=4223 ./nats-node
+//   - Hub cluster (one per hub, routes to the other two):
+//     NATS_NAME=hub-1 NATS_CLUSTER_NAME=hub \
+//     NATS_CLUSTER_ROUTES=nats://hub-2:6222,nats://hub-3:6222 ./nats-node
+//   - Leaf with failover: NATS_HUB=nats://hub-1:4222,nats://hub-2:4222 ./nats-node
+//   - Hub with an enrollment queue: ENROLL_TOKEN=s3cret ENROLL_REQUIRED=true ./nats-node
+//   - New leaf: ENROLL_TOKEN=s3cret NATS_NAME=edge-7 NATS_HUB=nats://hub:4222 ./nats-node
 //
 // The SDK (pkg/env) handles:
 //   - Embedded NATS JetStream server
-//   - Auth lifecycle (none/token/nkey/jwt)
+//   - Auth lifecycle (none/token/nkey/jwt/callout)
 //   - Service registration + heartbeat
 //   - KV bucket management
 //
@@ -15,13 +21,54 @@
 //   - Process-compose polling and publishing
 //   - Service listing on startup
 //   - Logging for hub operations
+//   - Per-subject usage accounting (usage_daily stream)
+//   - Leafnode liveness monitor (prunes services_static entries)
+//   - Registry janitor (tombstones of vanished registrations, services_history stream)
+//   - Time-limited access grants (ACCESS_GRANTS=true, hub only)
+//   - Role NKeys from the access_roles bucket (ROLES=true, hub only)
+//   - Admin API over NATS micro, wellknown.admin.* (ADMIN_API=true, hub only)
+//   - Mesh dashboard, access by role (DASHBOARD_ADDR)
+//
+// Auth setup (writes .auth/, replaces nsc/nk shell scripts):
+//   nats-node auth token|nkey|jwt|callout
+//
+// Hub plan (JSON accounts/buckets/streams for Terraform, Pulumi, ...):
+//   nats-node plan > hub.json
+//   HUB_PLAN=hub.json nats-node
+//
+// Version (upgrade with wellknown-check upgrade, brew or apt):
+//   nats-node --version
 //
 // Environment:
 //   NATS_NAME  - Node name (default: random)
 //   NATS_PORT  - Client port (default: random)
-//   NATS_HUB   - Hub URL for leaf mode (empty = standalone)
+//   NATS_HUB   - Hub URL for leaf mode (empty = standalone, comma-separated = failover)
+//   NATS_CLUSTER_NAME   - Hub cluster name (empty = not clustered)
+//   NATS_CLUSTER_ADDR   - Cluster route listener (default: :6222)
+//   NATS_CLUSTER_ROUTES - Comma-separated routes to the other hubs
+//   NATS_CLUSTER_REPLICAS - Registry replicas (default: cluster size, max 3)
 //   NATS_DATA  - Data directory (empty = in-memory)
-//   NATS_AUTH  - Auth mode: none, token, nkey, jwt
+//   NATS_AUTH  - Auth mode: none, token, nkey, jwt, callout
+//   HUB_PLAN   - JSON hub plan applied at startup (see pkg/env/hubplan.go)
+//   ENROLL_TOKEN    - Enrollment token; the hub queues new leaf nodes for
+//                     approval, leaves wait for it (see pkg/env/enroll.go)
+//   ENROLL_REQUIRED - Remove registrations of unapproved nodes (hub)
+//   ENROLL_TRUSTED  - Comma-separated nodes that need no enrollment (hub)
+//   ENROLL_FINGERPRINTS - JSON file of node -> machine fingerprint; the hub
+//                     then requires ENROLL_ATTESTATION=fingerprint (see
+//                     pkg/env/attest.go, wellknown-check enroll fingerprint)
+//   ACCESS_GRANTS - Serve wellknown-check access grant on the hub; needs
+//                   NATS_AUTH=nkey, jwt or callout (see pkg/env/access.go)
+//   ROLES      - Let NKeys bound with wellknown-check role set connect with
+//                their role's permissions; needs NATS_AUTH=nkey (see pkg/env/roles.go)
+//   ADMIN_API  - Serve the wellknown.admin.* micro service on the hub; purge
+//                and expire need NATS_AUTH (see pkg/env/admin.go)
+//   DASHBOARD_ADDR - Serve the mesh dashboard (e.g. :8090) behind an
+//                authenticating proxy; roles decide who sees and does
+//                what (see pkg/env/dashboard.go)
+//   DASHBOARD_USER_HEADER - Header the proxy sets to the user (default: X-Forwarded-User)
+//   EXPORT_SPEC - YAML routes forwarding registry/alert/audit events to
+//                 webhook, Kafka REST or OTLP sinks (see pkg/env/exporter.go)
 //   PC_URL     - Process-compose API URL (default: http://localhost:8181)
 package main
 
@@ -31,12 +78,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
 	"sort"
-	"syscall"
 	"time"
 
 	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
 	"github.com/joeblew999/wellnown-env/pkg/env/registry"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
@@ -65,16 +111,115 @@ type ProcessStates struct {
 const processUpdatesSubject = "pc.processes.updates"
 
 func main() {
-	if err := run(); err != nil {
+	var err error
+	switch {
+	case len(os.Args) > 1 && env.IsVersionArg(os.Args[1]):
+		fmt.Println("nats-node", env.ReadBuildVersion())
+	case len(os.Args) > 1 && os.Args[1] == "auth":
+		err = runAuth(os.Args[2:])
+	case len(os.Args) > 1 && os.Args[1] == "plan":
+		err = runPlan()
+	default:
+		err = run()
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// runAuth sets up .auth/ for an auth mode, keeping existing credentials
+func runAuth(args []string) error {
+	const dir = ".auth"
+	if len(args) != 1 {
+		return fmt.Errorf("usage: nats-node auth token|nkey|jwt|callout")
+	}
+
+	switch args[0] {
+	case "token":
+		token, err := auth.SetupToken(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token auth configured. Token: %s\n", token)
+
+	case "nkey":
+		kp, err := auth.SetupNKey(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Println("NKey auth configured.")
+		fmt.Println("  Seed: .auth/user.nk")
+		fmt.Printf("  Pub:  %s\n", kp.Public)
+
+	case "jwt":
+		store, err := auth.DefaultStore()
+		if err != nil {
+			return err
+		}
+		if err := auth.SetupJWT(dir, store); err != nil {
+			return err
+		}
+		fmt.Println("JWT auth configured. Creds: .auth/creds/user.creds")
+
+	case "callout":
+		kp, err := auth.SetupCallout(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Auth callout configured.")
+		fmt.Printf("  Issuer: %s\n", kp.Public)
+		fmt.Println("  Clients connect with the registry key of a live instance as token.")
+
+	default:
+		return fmt.Errorf("unknown auth mode %q (use: token, nkey, jwt, callout)", args[0])
+	}
+	return nil
+}
+
+// loadFingerprints reads the node -> machine fingerprint file
+func loadFingerprints(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading fingerprints: %w", err)
+	}
+	var known map[string]string
+	if err := json.Unmarshal(data, &known); err != nil {
+		return nil, fmt.Errorf("parsing fingerprints %s: %w", path, err)
+	}
+	return known, nil
+}
+
+// nodeOptions are the manager options of the node; plan uses them too so
+// it describes what run provisions
+func nodeOptions() []env.Option {
+	return []env.Option{
+		env.WithoutGUI(),
+		env.WithUsageTracking(),
+		env.WithLeafLivenessMonitor(env.DefaultLivenessGrace),
+		env.WithRegistryJanitor(),
+	}
+}
+
+// runPlan prints the hub plan as JSON without starting NATS
+func runPlan() error {
+	mgr, err := env.New("NATS_NODE", append(nodeOptions(), env.WithoutNATS())...)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+
+	plan, err := mgr.HubPlan()
+	if err != nil {
+		return err
+	}
+	return plan.WriteJSON(os.Stdout)
+}
+
 func run() error {
 	// Create manager - this starts embedded NATS automatically
 	// We disable the GUI since this is infrastructure, not a service
-	mgr, err := env.New("NATS_NODE", env.WithoutGUI())
+	mgr, err := env.New("NATS_NODE", nodeOptions()...)
 	if err != nil {
 		return fmt.Errorf("creating manager: %w", err)
 	}
@@ -101,7 +246,7 @@ func run() error {
 	fmt.Println()
 
 	// Watch for all service registrations
-	watcher, err := env.WatchAll(kv, func(key string, reg *registry.ServiceRegistration, deleted bool) {
+	logWatch := func(key string, reg *registry.ServiceRegistration, deleted bool) {
 		op := "PUT"
 		if deleted {
 			op = "DEL"
@@ -111,25 +256,98 @@ func run() error {
 		} else {
 			fmt.Printf("[WATCH] %s %s\n", op, key)
 		}
-	})
+	}
+	watcher, err := env.WatchAll(context.Background(), kv, logWatch)
 	if err != nil {
 		return fmt.Errorf("watching services: %w", err)
 	}
 	defer watcher.Stop()
 
+	// Leaf-liveness registrations live in a separate bucket
+	staticWatcher, err := env.WatchAll(context.Background(), mgr.StaticKV(), logWatch)
+	if err != nil {
+		return fmt.Errorf("watching static services: %w", err)
+	}
+	defer staticWatcher.Stop()
+
+	// Enrollment queue for new leaf nodes (hub only)
+	if token := os.Getenv("ENROLL_TOKEN"); token != "" && os.Getenv("NATS_HUB") == "" {
+		enrollCfg := env.EnrollmentConfig{
+			Token:    token,
+			Required: env.GetEnvBool("ENROLL_REQUIRED", false),
+			Trusted:  env.GetEnvList("ENROLL_TRUSTED"),
+		}
+		if path := os.Getenv("ENROLL_FINGERPRINTS"); path != "" {
+			known, err := loadFingerprints(path)
+			if err != nil {
+				return err
+			}
+			enrollCfg.Verifiers = map[string]env.AttestationVerifier{
+				env.AttestFingerprint: env.FingerprintVerifier(known),
+			}
+		}
+		stop, err := mgr.ServeEnrollment(enrollCfg)
+		if err != nil {
+			return fmt.Errorf("serving enrollment: %w", err)
+		}
+		defer stop()
+		fmt.Println("Enrollment: approve new nodes with wellknown-check enroll approve <node>")
+	}
+
+	// Time-limited operator access (hub only)
+	if env.GetEnvBool("ACCESS_GRANTS", false) && os.Getenv("NATS_HUB") == "" {
+		stop, err := mgr.ServeAccessGrants()
+		if err != nil {
+			return fmt.Errorf("serving access grants: %w", err)
+		}
+		defer stop()
+		fmt.Println("Access grants: wellknown-check access grant --user <name> --ttl 4h --scope control")
+	}
+
+	// Role-based NKey users (hub only)
+	if env.GetEnvBool("ROLES", false) && os.Getenv("NATS_HUB") == "" {
+		stop, err := mgr.ServeRoles()
+		if err != nil {
+			return fmt.Errorf("serving roles: %w", err)
+		}
+		defer stop()
+		fmt.Println("Roles: wellknown-check role set <user> viewer|operator|admin --key <nkey>")
+	}
+
+	// Admin API for dashboards and CLIs (hub only)
+	if env.GetEnvBool("ADMIN_API", false) && os.Getenv("NATS_HUB") == "" {
+		stop, err := mgr.ServeAdmin()
+		if err != nil {
+			return fmt.Errorf("serving admin API: %w", err)
+		}
+		defer stop()
+		fmt.Println("Admin API: nats req wellknown.admin.services ''")
+	}
+
+	// Mesh dashboard, pages and actions by role
+	if addr := os.Getenv("DASHBOARD_ADDR"); addr != "" {
+		header := env.GetEnv("DASHBOARD_USER_HEADER", env.DefaultDashboardUserHeader)
+		stop, err := mgr.ServeDashboard(addr, env.HeaderIdentity(header))
+		if err != nil {
+			return fmt.Errorf("serving dashboard: %w", err)
+		}
+		defer stop()
+		fmt.Printf("Dashboard: %s (user from %s, roles: wellknown-check role list)\n", addr, header)
+	}
+
 	// Start process-compose poller
 	go startProcessComposePoller(nc, time.Duration(cfg.PCInterval)*time.Second)
 
 	// Periodically list all registered services
 	go listServicesLoop(kv)
+	go listServicesLoop(mgr.StaticKV())
 
-	// Wait for shutdown signal
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
-
-	fmt.Println("\nShutting down...")
-	return nil
+	// Wait for SIGINT/SIGTERM, then drain and deregister
+	return mgr.Run(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		fmt.Println("\nShutting down...")
+		return nil
+	})
 }
 
 // listServicesLoop periodically lists all registered services
@@ -154,6 +372,13 @@ func listServicesLoop(kv jetstream.KeyValue) {
 				continue
 			}
 			fmt.Printf("  %s: %s\n", k, string(entry.Value()))
+			if reg, err := registry.Decode(entry.Value()); err == nil && reg.Runtime != nil {
+				fmt.Printf("    runtime: %s", reg.Runtime)
+				if reg.Runtime.LastError != "" {
+					fmt.Printf(", last error %s: %s", reg.Runtime.LastErrorAt.Format(time.RFC3339), reg.Runtime.LastError)
+				}
+				fmt.Println()
+			}
 		}
 		fmt.Println("---------------------------\n")
 	}
@@ -0,0 +1,198 @@
+// deployments.go: Artifacts deployed to this node from the object store
+//
+// With NATS_URL set, pc-node also runs the builds listed under its node
+// name in the deployments bucket (deploy.DeploymentsBucket). Each spec
+// names an artifact in the releases object store; pc-node downloads it
+// into PC_ARTIFACTS, checks its SHA-256 (and signature, with PC_SIGNERS
+// set) and runs it as a process, layered over pc.yaml and the pushed
+// processes. A new build that does not turn healthy is rolled back to the
+// previous one.
+//
+//	wellknown-check build --publish camera
+//	deploy.SetDeployments(ctx, kv, "edge-7", []deploy.Spec{{Name: "camera", Version: "v1.2.0"}})
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/f1bonacc1/process-compose/src/app"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/joeblew999/wellnown-env/pkg/env/deploy"
+	"github.com/joeblew999/wellnown-env/pkg/env/selfupdate"
+)
+
+// healthySettle is how long a build without a readiness probe has to keep
+// running to count as healthy
+const healthySettle = 10 * time.Second
+
+// kvDeployments follows the builds deployed to this node
+type kvDeployments struct {
+	kv       jetstream.KeyValue
+	deployer *deploy.Deployer
+}
+
+// connectDeployments opens the deployments bucket and the releases object
+// store on the connection of p. Builds go to PC_ARTIFACTS (default:
+// .artifacts); PC_SIGNERS lists the public NKeys trusted to sign them.
+func connectDeployments(ctx context.Context, p *kvProjects) (*kvDeployments, error) {
+	kv, err := deploy.OpenDeploymentsBucket(ctx, p.js)
+	if err != nil {
+		return nil, err
+	}
+	store, err := p.js.ObjectStore(ctx, selfupdate.DefaultBucket)
+	if err != nil {
+		return nil, fmt.Errorf("opening object store %s: %w", selfupdate.DefaultBucket, err)
+	}
+
+	var signers []string
+	for _, s := range strings.Split(env.GetEnv("PC_SIGNERS", ""), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			signers = append(signers, s)
+		}
+	}
+	return &kvDeployments{
+		kv: kv,
+		deployer: &deploy.Deployer{
+			Store:   store,
+			Dir:     env.GetEnv("PC_ARTIFACTS", ".artifacts"),
+			Signers: signers,
+		},
+	}, nil
+}
+
+// watch deploys the builds listed for p's node, now and on every change
+func (d *kvDeployments) watch(p *kvProjects, runner *app.ProjectRunner) (env.Watcher, error) {
+	d.deployer.Runner = &buildRunner{p: p, runner: runner}
+	return deploy.WatchDeployments(context.Background(), d.kv, p.node, func(specs []deploy.Spec) {
+		d.apply(p, runner, specs)
+	})
+}
+
+// apply deploys specs one by one and stops the builds no longer listed. A
+// build that cannot be deployed leaves the last healthy one running.
+func (d *kvDeployments) apply(p *kvProjects, runner *app.ProjectRunner, specs []deploy.Spec) {
+	ctx := context.Background()
+	listed := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		listed[spec.Name] = true
+		b, err := d.deployer.Deploy(ctx, spec)
+		if err == nil {
+			fmt.Printf("Deployed %s %s\n", b.Name, b.Version)
+			continue
+		}
+		fmt.Printf("Deploying %s: %v\n", spec.Name, err)
+		if errors.Is(err, deploy.ErrRolledBack) {
+			continue
+		}
+
+		// Fetch failed or the first build is unhealthy
+		if cur, ok, _ := d.deployer.Current(spec.Name); ok {
+			if err := d.deployer.Runner.Run(cur); err != nil {
+				fmt.Printf("Running %s %s: %v\n", cur.Name, cur.Version, err)
+			}
+		} else {
+			listed[spec.Name] = false
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	builds := maps.Clone(p.builds)
+	maps.DeleteFunc(builds, func(name string, _ deploy.Build) bool { return !listed[name] })
+	if len(builds) == len(p.builds) {
+		return
+	}
+	if err := p.update(runner, p.last, builds); err != nil {
+		fmt.Printf("Stopping undeployed builds: %v\n", err)
+	}
+}
+
+// buildRunner runs builds as processes of the embedded runner
+type buildRunner struct {
+	p      *kvProjects
+	runner *app.ProjectRunner
+}
+
+// Run adds (or replaces) the process of b; the runner restarts it if its
+// command changed
+func (r *buildRunner) Run(b deploy.Build) error {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	builds := maps.Clone(r.p.builds)
+	builds[b.Name] = b
+	return r.p.update(r.runner, r.p.last, builds)
+}
+
+// Healthy waits until process name is Ready, or has kept running for
+// healthySettle without a readiness probe. Exiting or restarting fails it.
+func (r *buildRunner) Healthy(ctx context.Context, name string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	restarts := -1
+	var since time.Time // Running since
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not healthy in time: %w", ctx.Err())
+		case <-ticker.C:
+		}
+
+		s, err := r.runner.GetProcessState(name)
+		if err != nil {
+			continue // Not started yet
+		}
+		if restarts < 0 {
+			restarts = s.Restarts
+		}
+		switch {
+		case s.Restarts > restarts:
+			return fmt.Errorf("restarted (exit code %d)", s.ExitCode)
+		case !s.IsRunning && !since.IsZero():
+			return fmt.Errorf("exited with code %d", s.ExitCode)
+		case !s.IsRunning:
+			continue
+		case string(s.Health) == "Ready":
+			return nil
+		case since.IsZero():
+			since = time.Now()
+		case string(s.Health) != "Not Ready" && time.Since(since) >= healthySettle:
+			return nil
+		}
+	}
+}
+
+// buildsProject renders builds as process-compose processes (JSON is
+// YAML); nil without builds
+func buildsProject(builds map[string]deploy.Build) []byte {
+	if len(builds) == 0 {
+		return nil
+	}
+	processes := make(map[string]any, len(builds))
+	for name, b := range builds {
+		processes[name] = map[string]any{
+			"command":      shellJoin(append([]string{b.Path}, b.Args...)),
+			"availability": map[string]any{"restart": "on_failure"},
+			"environment":  []string{"DEPLOY_VERSION=" + b.Version},
+		}
+	}
+	data, _ := json.Marshal(map[string]any{"processes": processes})
+	return data
+}
+
+// shellJoin quotes args for the shell process-compose runs commands with
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
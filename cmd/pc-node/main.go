@@ -12,21 +12,30 @@
 //   APP_NAME    - Application name for dashboard (default: pc-node)
 //   LOG_LEVEL   - Logging level (default: info)
 //   DEBUG       - Enable debug mode (default: false)
+//   NATS_URL    - NATS server; enables processes pushed over KV (projects.go)
+//                 and deployed artifacts (deployments.go)
+//   PC_NODE     - Node name in the pc_projects bucket (default: hostname)
+//   PC_ARTIFACTS - Directory of deployed builds (default: .artifacts)
+//   PC_SIGNERS  - Public NKeys trusted to sign deployed artifacts (comma separated)
 //
 // Run:
 //
 //	go run .
+//	go run . --version
 //
 // Then open http://localhost:3000 in your browser (or VIA_URL from env)
 //
 // The example:
-// 1. Loads a pc.yaml config
+// 1. Loads a pc.yaml config (plus processes pushed over NATS KV and
+//    artifacts deployed from the object store)
 // 2. Starts all processes
 // 3. Provides a Via web UI for monitoring/control
 // 4. Shuts down gracefully
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
@@ -34,7 +43,7 @@ import (
 	"time"
 
 	"github.com/f1bonacc1/process-compose/src/app"
-	"github.com/f1bonacc1/process-compose/src/loader"
+	"github.com/f1bonacc1/process-compose/src/types"
 	"github.com/go-via/via"
 	. "github.com/go-via/via/h"
 
@@ -43,6 +52,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && env.IsVersionArg(os.Args[1]) {
+		fmt.Println("pc-node", env.ReadBuildVersion())
+		return
+	}
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
@@ -73,17 +86,26 @@ func run() error {
 	}
 	fmt.Println()
 
-	// Step 1: Load configuration from YAML file
+	// Step 1: Load configuration from YAML file, plus any processes
+	// pushed to this node over NATS KV (see projects.go)
 	fmt.Println("Loading pc.yaml...")
 
-	loaderOpts := &loader.LoaderOptions{
-		FileNames: []string{"pc.yaml"},
+	projects, err := connectProjects(context.Background())
+	if err != nil {
+		fmt.Printf("Pushed processes disabled: %v\n", err)
+	}
+	var project *types.Project
+	if projects != nil {
+		defer projects.close()
+		fmt.Printf("Following %s/%s\n", pcview.ProjectsBucket, projects.node)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		project, err = projects.load(ctx)
+		cancel()
+	} else {
+		project, err = loadProject(nil)
 	}
-	loaderOpts.WithTuiDisabled(true)
-
-	project, err := loader.Load(loaderOpts)
 	if err != nil {
-		return fmt.Errorf("loading project: %w", err)
+		return err
 	}
 
 	fmt.Printf("Loaded project with %d processes\n", len(project.Processes))
@@ -117,6 +139,27 @@ func run() error {
 		errCh <- runner.Run()
 	}()
 
+	// Apply processes pushed later, live
+	if projects != nil {
+		if w, err := projects.watch(runner); err != nil {
+			fmt.Printf("Pushed processes not followed: %v\n", err)
+		} else {
+			defer w.Stop()
+		}
+
+		// Run the builds deployed to this node (see deployments.go)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		deployments, err := connectDeployments(ctx, projects)
+		cancel()
+		if err != nil {
+			fmt.Printf("Deployments disabled: %v\n", err)
+		} else if w, err := deployments.watch(projects, runner); err != nil {
+			fmt.Printf("Deployments not followed: %v\n", err)
+		} else {
+			defer w.Stop()
+		}
+	}
+
 	// Step 4: Set up pcview with embedded runner
 	pcState := pcview.NewState()
 
@@ -164,9 +207,18 @@ func run() error {
 
 	// Register home page
 	v.Page("/", func(c *via.Context) {
+		table := env.NewTable(c,
+			env.Column{Key: "name", Title: "Process"},
+			env.Column{Key: "status", Title: "Status"},
+			env.Column{Key: "pid", Title: "PID", Numeric: true},
+			env.Column{Key: "health", Title: "Health"},
+			env.Column{Key: "restarts", Title: "Restarts", Numeric: true},
+		)
+		pcview.Follow(c, pcState, pcview.DefaultSyncInterval)
+
 		c.View(func() H {
 			procs, lastErr := pcState.GetProcesses()
-			var statusRows []H
+			var statusRows []env.TableRow
 			for _, p := range procs {
 				status := "Stopped"
 				if p.IsRunning {
@@ -176,13 +228,13 @@ func run() error {
 				if health == "" {
 					health = "N/A"
 				}
-				statusRows = append(statusRows, Tr(
-					Td(Strong(Text(p.Name))),
-					Td(Text(status)),
-					Td(Code(Textf("%d", p.Pid))),
-					Td(Text(health)),
-					Td(Textf("%d", p.Restarts)),
-				))
+				statusRows = append(statusRows, env.TableRow{
+					env.NodeCell(p.Name, Strong(Text(p.Name))),
+					env.TextCell(status),
+					env.NumCell(float64(p.Pid), Code(Textf("%d", p.Pid))),
+					env.TextCell(health),
+					env.NumCell(float64(p.Restarts), nil),
+				})
 			}
 
 			var errEl H
@@ -197,19 +249,11 @@ func run() error {
 				Nav(Style("margin:20px 0"),
 					A(Href("/"), Text("Home")), Text(" | "),
 					A(Href("/processes"), Text("Processes")), Text(" | "),
-					A(Href("/examples"), Text("Examples")),
+					A(Href("/examples"), Text("Examples")), Text(" | "),
+					A(Href("/logs"), Text("Logs")),
 				),
 				H2(Text("Process Status")),
-				Table(Style("width:100%;border-collapse:collapse"),
-					THead(Tr(
-						Th(Text("Process")),
-						Th(Text("Status")),
-						Th(Text("PID")),
-						Th(Text("Health")),
-						Th(Text("Restarts")),
-					)),
-					TBody(statusRows...),
-				),
+				table.Render(statusRows),
 				Hr(),
 				P(Small(Text("Refreshes automatically via SSE"))),
 			)
@@ -233,6 +277,13 @@ func run() error {
 				}
 				return A(Href("/examples"), Text("Examples"))
 			}(),
+			Text(" | "),
+			func() H {
+				if title == "Logs" {
+					return Strong(Text("Logs"))
+				}
+				return A(Href("/logs"), Text("Logs"))
+			}(),
 		)
 	}
 
@@ -248,6 +299,26 @@ func run() error {
 		NavBar: navBar,
 	})
 
+	// Register live log page, read straight from the runner
+	pcview.RegisterLogsPage(v, embeddedClient, pcState, pcview.LogsPageOptions{
+		NavBar: navBar,
+	})
+	env.RegisterLogPanes(v)
+
+	// Register process detail pages, definitions from the loaded project
+	pcview.RegisterProcessPage(v, embeddedClient, pcState, pcview.ProcessPageOptions{
+		NavBar: navBar,
+	})
+
+	// Keep keyboard focus when SSE updates re-render a page
+	env.RegisterFocusRetention(v)
+
+	// Press "/" on any page to jump to a page or process
+	env.RegisterCommandPalette(v, env.PaletteOptions{
+		Pages:   append([]env.PaletteItem{{Kind: "page", Title: "Home", Href: "/"}}, pcview.PalettePages()...),
+		Sources: []env.PaletteSource{pcview.PaletteSource(pcState)},
+	})
+
 	// Start Via in background
 	go v.Start()
 
@@ -313,6 +384,34 @@ func (c *embeddedPCClient) Control(action, name string) error {
 	}
 }
 
+// ProcessLogs returns the last limit lines the runner captured for a process
+func (c *embeddedPCClient) ProcessLogs(name string, limit int) ([]string, error) {
+	return c.runner.GetProcessLog(name, 0, limit)
+}
+
+// ProcessDefinition returns a process's config from the loaded project,
+// converted through the same JSON the process-compose API serves
+func (c *embeddedPCClient) ProcessDefinition(name string) (pcview.ProcessDefinition, error) {
+	var def pcview.ProcessDefinition
+	cfg, err := c.runner.GetProcessInfo(name)
+	if err != nil {
+		return def, err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return def, fmt.Errorf("encoding definition of %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, &def); err != nil {
+		return def, fmt.Errorf("decoding definition of %s: %w", name, err)
+	}
+	return def, nil
+}
+
 func (c *embeddedPCClient) Start(name string) error   { return c.Control("start", name) }
 func (c *embeddedPCClient) Stop(name string) error    { return c.Control("stop", name) }
 func (c *embeddedPCClient) Restart(name string) error { return c.Control("restart", name) }
+
+// Scale sets how many replicas of a process the runner keeps
+func (c *embeddedPCClient) Scale(name string, replicas int) error {
+	return c.runner.ScaleProcess(name, replicas)
+}
@@ -0,0 +1,188 @@
+// projects.go: Processes pushed to this node over NATS KV
+//
+// With NATS_URL set, pc-node also runs the processes stored under its node
+// name in the pc_projects bucket (pcview.ProjectsBucket), layered over
+// pc.yaml. Changes apply live: new processes start, removed ones stop and
+// changed ones restart.
+//
+//	nats kv put pc_projects edge-7 "$(cat camera.yaml)"
+//	nats kv del pc_projects edge-7 # Back to pc.yaml only
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/f1bonacc1/process-compose/src/app"
+	"github.com/f1bonacc1/process-compose/src/loader"
+	"github.com/f1bonacc1/process-compose/src/types"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/joeblew999/wellnown-env/pkg/env/deploy"
+	"github.com/joeblew999/wellnown-env/pkg/env/pcview"
+)
+
+// projectFile is the node's own process-compose config
+const projectFile = "pc.yaml"
+
+// loadProject loads pc.yaml with overlays (pushed definitions, deployed
+// builds) layered over it, the way process-compose merges several -f
+// files. Nil overlays are skipped.
+func loadProject(overlays ...[]byte) (*types.Project, error) {
+	files := []string{projectFile}
+	for _, overlay := range overlays {
+		if overlay == nil {
+			continue
+		}
+		// Next to pc.yaml, so relative paths resolve the same way
+		f, err := os.CreateTemp(".", ".pc-node-*.yaml")
+		if err != nil {
+			return nil, fmt.Errorf("writing overlay: %w", err)
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(overlay)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("writing overlay: %w", err)
+		}
+		files = append(files, f.Name())
+	}
+
+	opts := &loader.LoaderOptions{FileNames: files}
+	opts.WithTuiDisabled(true)
+	project, err := loader.Load(opts)
+	if err != nil {
+		return nil, fmt.Errorf("loading project: %w", err)
+	}
+	return project, nil
+}
+
+// kvProjects follows the definitions pushed to this node
+type kvProjects struct {
+	nc   *nats.Conn
+	js   jetstream.JetStream
+	kv   jetstream.KeyValue
+	node string
+
+	mu     sync.Mutex
+	last   []byte                  // Definitions running now (nil = pc.yaml only)
+	builds map[string]deploy.Build // Builds running now, by process (deployments.go)
+}
+
+// connectProjects connects to NATS_URL and opens the projects bucket; nil
+// without NATS_URL. The node name is PC_NODE (default: hostname).
+func connectProjects(ctx context.Context) (*kvProjects, error) {
+	url := env.GetEnv("NATS_URL", "")
+	if url == "" {
+		return nil, nil
+	}
+	node := env.GetEnv("PC_NODE", "")
+	if node == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("naming node: %w", err)
+		}
+		node = host
+	}
+
+	nc, err := nats.Connect(url, nats.Name("pc-node/"+node))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", url, err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("creating JetStream context: %w", err)
+	}
+	kv, err := pcview.OpenProjectsBucket(ctx, js)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &kvProjects{nc: nc, js: js, kv: kv, node: node, builds: map[string]deploy.Build{}}, nil
+}
+
+// load loads pc.yaml with the definitions pushed to this node. Broken
+// definitions are reported and left out, so the node still starts.
+func (p *kvProjects) load(ctx context.Context) (*types.Project, error) {
+	pushed, err := pcview.GetProject(ctx, p.kv, p.node)
+	if err != nil {
+		return nil, err
+	}
+	if pushed != nil {
+		if _, err := pcview.ProjectProcesses(pushed); err != nil {
+			fmt.Printf("Ignoring processes pushed to %s: %v\n", p.node, err)
+			pushed = nil
+		}
+	}
+
+	project, err := loadProject(pushed)
+	if err != nil && pushed != nil {
+		fmt.Printf("Ignoring processes pushed to %s: %v\n", p.node, err)
+		pushed = nil
+		project, err = loadProject(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.last = pushed
+	p.mu.Unlock()
+	return project, nil
+}
+
+// watch applies every change of the pushed definitions to runner
+func (p *kvProjects) watch(runner *app.ProjectRunner) (env.Watcher, error) {
+	return pcview.WatchProject(context.Background(), p.kv, p.node, func(data []byte) {
+		p.apply(runner, data)
+	})
+}
+
+// apply reloads the project with pushed and lets the runner add, remove
+// and restart processes to match
+func (p *kvProjects) apply(runner *app.ProjectRunner, pushed []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bytes.Equal(pushed, p.last) {
+		return // Already running (the watch starts with the current value)
+	}
+	if err := p.update(runner, pushed, p.builds); err != nil {
+		fmt.Printf("Ignoring processes pushed to %s: %v\n", p.node, err)
+		return
+	}
+	fmt.Printf("Processes pushed to %s applied\n", p.node)
+}
+
+// update loads the project with pushed and builds and applies it to
+// runner; they run from then on. p.mu must be held.
+func (p *kvProjects) update(runner *app.ProjectRunner, pushed []byte, builds map[string]deploy.Build) error {
+	project, err := loadProject(pushed, buildsProject(builds))
+	if err != nil {
+		return err
+	}
+	status, err := runner.UpdateProject(project)
+	if err != nil {
+		return fmt.Errorf("updating processes: %w", err)
+	}
+	p.last, p.builds = pushed, builds
+
+	for _, name := range slices.Sorted(maps.Keys(status)) {
+		fmt.Printf("  - %s: %s\n", name, status[name])
+	}
+	return nil
+}
+
+// close drops the NATS connection
+func (p *kvProjects) close() {
+	p.nc.Close()
+}
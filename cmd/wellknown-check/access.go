@@ -0,0 +1,131 @@
+// access.go: Time-limited access for dashboards and operators
+//
+//	wellknown-check access grant --user alice --ttl 4h --scope control --key bob.nk
+//	wellknown-check access grant --user grafana --scope read --out grafana.creds
+//	wellknown-check access list
+//	wellknown-check access revoke 3f2a9c1e
+//
+// Grants and revocations are signed with the caller's NKey seed (--key or
+// WELLKNOWN_KEY); the hub takes the granter from the role binding of that
+// key (see pkg/env/caller.go). The hub (mgr.ServeAccessGrants) mints the
+// credentials - an NKey seed, a creds file or a token, depending on its
+// auth mode - records the grant in the audit stream and revokes it at
+// expiry (see pkg/env/access.go).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/nats-io/nkeys"
+)
+
+// accessUsage lists the access commands
+const accessUsage = "usage: wellknown-check access grant --user <name> [--ttl 1h] [--scope read|control|admin|<role>] [--out file] [--key seed] | list | revoke <id> [--key seed]"
+
+// runAccess runs the access subcommand
+func runAccess(args []string) error {
+	if len(args) == 0 {
+		return errors.New(accessUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("access "+cmd, flag.ContinueOnError)
+	user := fs.String("user", "", "Who gets access (grant)")
+	ttl := fs.Duration("ttl", env.DefaultAccessTTL, "How long the grant lasts (grant)")
+	scope := fs.String("scope", env.ScopeRead, "read, control, admin or a role (grant)")
+	reason := fs.String("reason", "", "Why access is needed, for the audit trail (grant)")
+	out := fs.String("out", "", "Write the credentials to this file instead of stdout (grant)")
+	key := fs.String("key", os.Getenv("WELLKNOWN_KEY"), "NKey seed file of who grants or revokes (bound with role set --key)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for NATS operations")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cmd == "grant" && len(pos) == 0 && *user != "":
+	case cmd == "list" && len(pos) == 0:
+	case cmd == "revoke" && len(pos) == 1:
+	default:
+		return errors.New(accessUsage)
+	}
+
+	var caller nkeys.KeyPair
+	if cmd != "list" {
+		if *key == "" {
+			return errors.New("access " + cmd + " needs --key (or WELLKNOWN_KEY): the NKey seed the request is signed with")
+		}
+		if caller, err = env.LoadCallerKey(*key); err != nil {
+			return err
+		}
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+	if mgr.JetStream() == nil {
+		return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch cmd {
+	case "grant":
+		g, creds, err := env.RequestAccess(ctx, mgr.NC(), env.AccessRequest{
+			User:   *user,
+			Scope:  *scope,
+			TTL:    *ttl,
+			Reason: *reason,
+		}, caller)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Granted %s access to %s until %s (grant %s, %s)\n", g.Scope, g.User, g.Expires.Local().Format(time.RFC3339), g.ID, g.Kind)
+		fmt.Fprintf(os.Stderr, "Replies reach %s under the inbox prefix %s (nats --inbox-prefix)\n", g.User, env.UserInboxPrefix(g.User))
+		if *out == "" {
+			fmt.Println(creds)
+			return nil
+		}
+		if err := os.WriteFile(*out, []byte(creds+"\n"), 0o600); err != nil {
+			return fmt.Errorf("writing credentials: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Credentials written to %s\n", *out)
+
+	case "list":
+		kv, err := env.OpenAccessBucket(ctx, mgr.JetStream())
+		if err != nil {
+			return err
+		}
+		list, err := env.ListAccessGrants(ctx, kv)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No access grants")
+		}
+		for _, g := range list {
+			fmt.Printf("%s\t%s\t%s\t%s\tby %s\tuntil %s\n", g.ID, g.User, g.Scope, g.Kind, g.GrantedBy, g.Expires.Local().Format(time.RFC3339))
+		}
+
+	case "revoke":
+		if err := env.RevokeAccess(ctx, mgr.NC(), pos[0], caller); err != nil {
+			return err
+		}
+		fmt.Printf("%s revoked\n", pos[0])
+	}
+	return nil
+}
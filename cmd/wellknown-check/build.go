@@ -0,0 +1,135 @@
+// build.go: Cross-compile a service with its identity ldflags stamped in
+//
+//	wellknown-check build ./cmd/api --platforms linux/amd64,linux/arm64
+//	wellknown-check build ./cmd/api --publish   # Also upload to the hub's object store
+//
+// Org, repo, commit, tag and branch come from git and land in the registry
+// variables, so the service registers with its real identity. Binaries and
+// checksums.txt go to --out under the names `upgrade` looks for.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/joeblew999/wellnown-env/pkg/env/build"
+	"github.com/joeblew999/wellnown-env/pkg/env/selfupdate"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runBuild runs the build subcommand
+func runBuild(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	platforms := fs.String("platforms", build.HostPlatform().String(), "Comma-separated os/arch targets")
+	out := fs.String("out", build.DefaultOutDir, "Output directory for binaries and checksums.txt")
+	name := fs.String("name", "", "Binary name (default: last element of the package path)")
+	version := fs.String("version", "", "Version to stamp (default: git describe)")
+	publish := fs.Bool("publish", false, "Upload the binaries to the hub's object store")
+	bucket := fs.String("bucket", selfupdate.DefaultBucket, "Object store bucket for --publish")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Timeout for the build and upload")
+
+	// The package may come before the flags: build ./cmd/api --platforms ...
+	var pkg string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		pkg, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if pkg == "" {
+		pkg = fs.Arg(0)
+	}
+	if pkg == "" {
+		return fmt.Errorf("usage: wellknown-check build <package> [--platforms os/arch,...]")
+	}
+
+	targets, err := build.ParsePlatforms(*platforms)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	info, err := build.GitInfo(ctx, ".")
+	if err != nil {
+		return fmt.Errorf("reading git identity: %w", err)
+	}
+	if *version != "" {
+		info.Tag = *version
+	}
+	if info.Org == "" || info.Repo == "" {
+		fmt.Fprintln(os.Stderr, "warning: no GitHub origin remote, GitOrg/GitRepo left unset")
+	}
+
+	fmt.Printf("Building %s %s for %d platform(s)...\n", pkg, info.Tag, len(targets))
+	artifacts, err := build.Build(ctx, build.Config{
+		Package:   pkg,
+		OutDir:    *out,
+		Name:      *name,
+		Platforms: targets,
+		Info:      info,
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		fmt.Printf("  %-14s %s  %s\n", a.Platform, a.SHA256[:12], a.Path)
+	}
+
+	if !*publish {
+		return nil
+	}
+	binary := *name
+	if binary == "" {
+		binary = build.BinaryName(pkg)
+	}
+	return publishArtifacts(ctx, *bucket, binary, info.Tag, artifacts)
+}
+
+// publishArtifacts uploads artifacts to the release object store
+func publishArtifacts(ctx context.Context, bucket, binary, version string, artifacts []build.Artifact) error {
+	if version == "" {
+		return fmt.Errorf("cannot publish without a version (tag the commit or pass --version)")
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+	if mgr.JetStream() == nil {
+		return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+	}
+	store, err := mgr.JetStream().CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:      bucket,
+		Description: "Release binaries for wellknown-check upgrade --from nats",
+	})
+	if err != nil {
+		return fmt.Errorf("opening object store %s: %w", bucket, err)
+	}
+
+	for _, a := range artifacts {
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return err
+		}
+		err = selfupdate.Publish(ctx, store, binary, version, a.Platform.OS, a.Platform.Arch, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Published %s %s\n", selfupdate.ObjectName(binary, a.Platform.OS, a.Platform.Arch), version)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// dashboard.go: Serve the mesh dashboard from anywhere on the mesh
+//
+//	wellknown-check dashboard --addr :8090
+//	wellknown-check dashboard --addr 127.0.0.1:8090 --user-header X-Auth-Request-User
+//
+// Serves the pages of pkg/env/dashboard.go behind the role middleware
+// until interrupted. Put it behind an authenticating proxy that sets the
+// user header, and bind users with wellknown-check role set: viewers see
+// the pages, operators also run actions, admins also get enrollment and
+// auth.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// dashboardUsage shows how to call dashboard
+const dashboardUsage = "usage: wellknown-check dashboard [--addr :8090] [--user-header X-Forwarded-User]"
+
+// runDashboard runs the dashboard subcommand
+func runDashboard(args []string) error {
+	fs := flag.NewFlagSet("dashboard", flag.ContinueOnError)
+	addr := fs.String("addr", ":8090", "Address to serve the dashboard on")
+	header := fs.String("user-header", env.DefaultDashboardUserHeader, "Header the authenticating proxy sets to the user")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return errors.New(dashboardUsage)
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+
+	stop, err := mgr.ServeDashboard(*addr, env.HeaderIdentity(*header))
+	if err != nil {
+		return err
+	}
+	defer stop()
+	fmt.Printf("Dashboard on %s (user from %s). Press Ctrl+C to stop.\n", *addr, *header)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-ctx.Done()
+	return nil
+}
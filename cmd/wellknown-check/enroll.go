@@ -0,0 +1,111 @@
+// enroll.go: Approve or reject nodes waiting to join
+//
+//	wellknown-check enroll list
+//	wellknown-check enroll approve edge-7
+//	wellknown-check enroll reject edge-7 --by alice
+//	wellknown-check enroll fingerprint   # This machine's fingerprint
+//
+// New leaf nodes started with ENROLL_TOKEN wait in the node_enrollment
+// bucket until they are approved; the hub then issues their credentials
+// and they register (see pkg/env/enroll.go). Hubs verifying fingerprint
+// attestation list each device's fingerprint in ENROLL_FINGERPRINTS.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// enrollUsage lists the enroll commands
+const enrollUsage = "usage: wellknown-check enroll list | approve <node> | reject <node> | fingerprint"
+
+// runEnroll runs the enroll subcommand
+func runEnroll(args []string) error {
+	if len(args) == 0 {
+		return errors.New(enrollUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("enroll "+cmd, flag.ContinueOnError)
+	by := fs.String("by", currentUser(), "Who decides (approve, reject)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for NATS operations")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cmd == "fingerprint" && len(pos) == 0:
+		fp, err := env.MachineFingerprint()
+		if err != nil {
+			return err
+		}
+		fmt.Println(fp)
+		return nil
+	case cmd == "list" && len(pos) == 0:
+	case (cmd == "approve" || cmd == "reject") && len(pos) == 1:
+	default:
+		return errors.New(enrollUsage)
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+	if mgr.JetStream() == nil {
+		return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	kv, err := env.OpenEnrollmentBucket(ctx, mgr.JetStream())
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "list":
+		list, err := env.ListEnrollments(ctx, kv)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No enrollment requests")
+		}
+		for _, e := range list {
+			state := e.State
+			if e.DecidedBy != "" {
+				state += " by " + e.DecidedBy
+			}
+			attestation := "none"
+			if e.Attestation != "" {
+				attestation = e.Attestation + " " + env.TagSelector(e.Claims).String()
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", e.Node, e.PublicKey, e.Host, attestation, e.Requested.Format(time.RFC3339), state)
+		}
+
+	case "approve":
+		if err := env.ApproveEnrollment(ctx, kv, pos[0], *by); err != nil {
+			return err
+		}
+		fmt.Printf("%s approved\n", pos[0])
+
+	case "reject":
+		if err := env.RejectEnrollment(ctx, kv, pos[0], *by); err != nil {
+			return err
+		}
+		fmt.Printf("%s rejected\n", pos[0])
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// gen.go: Generate local development files from the service schema
+//
+//	wellknown-check gen devenv                          # devenv.nix fragment
+//	wellknown-check gen devenv --format process-compose # process-compose.yaml fragment
+//	wellknown-check gen devenv --schema schema.json --command "go run ./cmd/api"
+//
+// The fragment sets the service's env vars (defaults, ref+file:// secret
+// placeholders, empty required fields) and starts its service: dependencies
+// first. Without --schema the schema comes from this process, as with
+// --schema-dump.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// runGen runs the gen subcommand
+func runGen(args []string) error {
+	if len(args) == 0 || args[0] != "devenv" {
+		return fmt.Errorf("usage: wellknown-check gen devenv [flags]")
+	}
+
+	fs := flag.NewFlagSet("gen devenv", flag.ContinueOnError)
+	format := fs.String("format", "nix", "Output format: nix (devenv.nix) or process-compose")
+	schema := fs.String("schema", "", "Schema file from --schema-dump (default: this process's schema)")
+	command := fs.String("command", "go run .", "Command starting the service")
+	repo := fs.String("repo", "", "Repository name (org/repo) for this service")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	reg, err := loadSchema(*schema)
+	if err != nil {
+		return err
+	}
+	if *repo != "" {
+		org, name, ok := strings.Cut(*repo, "/")
+		if !ok {
+			return fmt.Errorf("--repo must be org/repo, got %q", *repo)
+		}
+		reg.GitHub.Org, reg.GitHub.Repo = org, name
+	}
+
+	d := env.BuildDevEnv(reg, *command)
+	switch *format {
+	case "nix":
+		return d.WriteNix(os.Stdout)
+	case "process-compose":
+		return d.WriteProcessCompose(os.Stdout)
+	default:
+		return fmt.Errorf("unknown format %q (use: nix, process-compose)", *format)
+	}
+}
+
+// loadSchema reads a --schema-dump file, or this process's registration
+// when path is empty
+func loadSchema(path string) (registry.ServiceRegistration, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return registry.ServiceRegistration{}, fmt.Errorf("reading schema: %w", err)
+		}
+		var reg registry.ServiceRegistration
+		if err := json.Unmarshal(data, &reg); err != nil {
+			return registry.ServiceRegistration{}, fmt.Errorf("parsing schema: %w", err)
+		}
+		return reg, nil
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithoutNATS(),
+	)
+	if err != nil {
+		return registry.ServiceRegistration{}, fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+
+	reg := mgr.Registration()
+	if reg == nil {
+		return registry.ServiceRegistration{}, fmt.Errorf("no registration available (service not configured)")
+	}
+	return *reg, nil
+}
@@ -2,7 +2,11 @@ module github.com/joeblew999/wellnown-env/cmd/wellknown-check
 
 go 1.25.4
 
-require github.com/joeblew999/wellnown-env/pkg/env v0.0.0
+require (
+	github.com/joeblew999/wellnown-env/pkg/env v0.0.0
+	github.com/nats-io/nats.go v1.47.0
+	github.com/nats-io/nkeys v0.4.12
+)
 
 require (
 	cel.dev/expr v0.16.1 // indirect
@@ -35,6 +39,7 @@ require (
 	github.com/Azure/go-autorest/logger v0.2.1 // indirect
 	github.com/Azure/go-autorest/tracing v0.6.0 // indirect
 	github.com/AzureAD/microsoft-authentication-library-for-go v1.2.2 // indirect
+	github.com/BurntSushi/toml v1.3.2 // indirect
 	github.com/CAFxX/httpcompression v0.0.9 // indirect
 	github.com/DopplerHQ/cli v0.5.11-0.20230908185655-7aef4713e1a4 // indirect
 	github.com/GoogleCloudPlatform/opentelemetry-operations-go/detectors/gcp v1.24.1 // indirect
@@ -167,8 +172,6 @@ require (
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/nats-io/jwt/v2 v2.8.0 // indirect
 	github.com/nats-io/nats-server/v2 v2.12.2 // indirect
-	github.com/nats-io/nats.go v1.47.0 // indirect
-	github.com/nats-io/nkeys v0.4.12 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
 	github.com/oklog/ulid v1.3.1 // indirect
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
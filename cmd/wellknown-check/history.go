@@ -0,0 +1,69 @@
+// history.go: Show registrations that left the registry
+//
+//	wellknown-check history                        # Last 24h
+//	wellknown-check history --unexpected --since 1h
+//	wellknown-check history --service acme/api
+//
+// The hub's registry janitor (env.WithRegistryJanitor) records a tombstone
+// for every registration that disappears; --unexpected keeps those that
+// expired or were pruned instead of deregistering (see pkg/env/janitor.go).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// runHistory runs the history subcommand
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	since := fs.Duration("since", 24*time.Hour, "How far back to look")
+	service := fs.String("service", "", "Only this service (org/repo)")
+	unexpected := fs.Bool("unexpected", false, "Only instances that expired or were pruned")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for NATS operations")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 0 {
+		return errors.New("usage: wellknown-check history [--since 24h] [--service org/repo] [--unexpected]")
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+	if mgr.JetStream() == nil {
+		return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+	}
+
+	q := env.HistoryQuery{Service: *service, Since: time.Now().Add(-*since)}
+	if *unexpected {
+		q.Reasons = []string{env.TombstoneExpired, env.TombstonePruned}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	tombstones, err := env.GetHistory(ctx, mgr.JetStream(), q)
+	if err != nil {
+		return err
+	}
+
+	if len(tombstones) == 0 {
+		fmt.Println("No registrations left the registry")
+	}
+	for _, t := range tombstones {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", t.Time.Format(time.RFC3339), t.Reason, t.Service, t.Instance, t.Node)
+	}
+	return nil
+}
@@ -11,6 +11,26 @@
 //	wellknown-check --check-deps            # Check dependency availability
 //	wellknown-check --check-consumers       # Check impact on consumers
 //	wellknown-check --self                  # Show changes in this service
+//	wellknown-check --diff-registry         # Diff against the registered schema
+//	wellknown-check --graph mermaid         # Dependency graph (dot, mermaid, json)
+//	wellknown-check --lint-subjects --monitor http://edge-7:8222 # Declared vs used subjects (see subjects.go)
+//	wellknown-check --export dotenv         # .env.example (or jsonschema, markdown)
+//	wellknown-check --support-bundle out.zip --from http://host:9090/debug/support-bundle
+//	wellknown-check gen devenv              # devenv.nix fragment (see gen.go)
+//	wellknown-check new ./orders --repo acme/orders # Leaf service skeleton (see new.go)
+//	wellknown-check upgrade                 # Self-update (see upgrade.go)
+//	wellknown-check build ./cmd/api         # Cross-compile with ldflags (see build.go)
+//	wellknown-check node drain edge-7       # Maintenance mode (see node.go)
+//	wellknown-check node exec site=warehouse-3 restart camera # Fleet commands by tag
+//	wellknown-check enroll approve edge-7   # Let a new node join (see enroll.go)
+//	wellknown-check history --unexpected    # Instances that died (see history.go)
+//	wellknown-check access grant --user alice --ttl 4h --scope control # (see access.go)
+//	wellknown-check role set alice operator # Roles for dashboard, CLI and NATS (see role.go)
+//	wellknown-check dashboard --addr :8090  # Mesh dashboard, access by role (see dashboard.go)
+//	wellknown-check --version
+//
+// Add --format json|sarif|markdown to the checks for CI pipelines and
+// GitHub code scanning (see report.go). --schema-dump is always JSON.
 package main
 
 import (
@@ -18,7 +38,10 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joeblew999/wellnown-env/pkg/env"
@@ -33,19 +56,76 @@ func main() {
 }
 
 func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "gen":
+			return runGen(os.Args[2:])
+		case "new":
+			return runNew(os.Args[2:])
+		case "upgrade":
+			return runUpgrade(os.Args[2:])
+		case "build":
+			return runBuild(os.Args[2:])
+		case "node":
+			return runNode(os.Args[2:])
+		case "history":
+			return runHistory(os.Args[2:])
+		case "enroll":
+			return runEnroll(os.Args[2:])
+		case "access":
+			return runAccess(os.Args[2:])
+		case "role":
+			return runRole(os.Args[2:])
+		case "dashboard":
+			return runDashboard(os.Args[2:])
+		}
+	}
+
 	// Define flags
 	schemaDump := flag.Bool("schema-dump", false, "Output service schema as JSON")
 	checkDeps := flag.Bool("check-deps", false, "Check if dependencies are available in NATS registry")
 	checkConsumers := flag.Bool("check-consumers", false, "Check impact on services that depend on this service")
 	selfCheck := flag.Bool("self", false, "Show local changes in this service's config requirements")
+	diffRegistry := flag.Bool("diff-registry", false, "Diff the local schema against the one registered in NATS KV; fails on breaking changes")
+	graph := flag.String("graph", "", "Output the service dependency graph as dot, mermaid or json; fails on cycles")
+	lintSubs := flag.Bool("lint-subjects", false, "Compare the subjects a service declares with the ones it uses at runtime; fails on undeclared ones")
+	monitor := flag.String("monitor", "http://localhost:8222", "NATS monitor of the node the service runs on (--lint-subjects)")
+	sample := flag.Duration("sample", 30*time.Second, "How long to sample requests for --lint-subjects")
+	export := flag.String("export", "", "Output the config as dotenv (.env.example), jsonschema or markdown")
+	schema := flag.String("schema", "", "Schema file from --schema-dump for --export (default: this process's schema)")
 	prSchema := flag.String("pr-schema", "", "Path to PR schema file for comparison")
 	repo := flag.String("repo", "", "Repository name (org/repo) for this service")
 	timeout := flag.Duration("timeout", 10*time.Second, "Timeout for NATS operations")
+	supportBundle := flag.String("support-bundle", "", "Write a support bundle zip to this path")
+	from := flag.String("from", "", "Fetch the support bundle from a service's SupportBundleHandler URL")
+	format := flag.String("format", formatText, "Check output format: text, json, sarif, markdown")
+	version := flag.Bool("version", false, "Print the version and exit")
 
 	flag.Parse()
 
+	if *version {
+		fmt.Println(binaryName, env.ReadBuildVersion())
+		return nil
+	}
+
+	switch *format {
+	case formatText, formatJSON, formatSARIF, formatMarkdown:
+	default:
+		return fmt.Errorf("unknown format %q (use: text, json, sarif, markdown)", *format)
+	}
+
+	// Exports work from a schema file, like gen
+	if *export != "" {
+		return exportSchema(*export, *schema, *repo)
+	}
+
+	// A remote bundle needs no local manager
+	if *supportBundle != "" && *from != "" {
+		return fetchSupportBundle(*from, *supportBundle, *timeout)
+	}
+
 	// At least one action required
-	if !*schemaDump && !*checkDeps && !*checkConsumers && !*selfCheck {
+	if !*schemaDump && !*checkDeps && !*checkConsumers && !*selfCheck && !*diffRegistry && !*lintSubs && *graph == "" && *supportBundle == "" {
 		flag.Usage()
 		return fmt.Errorf("at least one action flag required")
 	}
@@ -55,6 +135,7 @@ func run() error {
 		env.WithoutGUI(),
 		env.WithoutHeartbeat(),
 		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
 	)
 	if err != nil {
 		return fmt.Errorf("creating manager: %w", err)
@@ -64,26 +145,91 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
 	defer cancel()
 
+	// Handle support bundle
+	if *supportBundle != "" {
+		return writeSupportBundle(mgr, *supportBundle)
+	}
+
 	// Handle schema dump
 	if *schemaDump {
 		return dumpSchema(mgr, *repo)
 	}
 
-	// Handle self check
-	if *selfCheck {
-		return selfCheckChanges(mgr, *prSchema)
+	// Handle dependency graph
+	if *graph != "" {
+		return writeGraph(ctx, mgr, *graph)
+	}
+
+	var report *Report
+	switch {
+	case *selfCheck:
+		report, err = selfCheckChanges(mgr, *prSchema)
+	case *diffRegistry:
+		report, err = diffAgainstRegistry(ctx, mgr, *repo, *prSchema)
+	case *checkDeps:
+		report, err = checkDependencies(ctx, mgr)
+	case *checkConsumers:
+		report, err = checkConsumerImpact(ctx, mgr, *repo)
+	case *lintSubs:
+		report, err = lintSubjects(ctx, mgr, *repo, *monitor, *sample)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeReport(os.Stdout, report, *format); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if n := report.Errors(); n > 0 {
+		return fmt.Errorf("%s: %d error(s)", report.Command, n)
+	}
+	return nil
+}
+
+// writeSupportBundle writes the local manager's support bundle to path
+func writeSupportBundle(mgr *env.Manager, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := mgr.SupportBundle(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", path, err)
+	}
+	fmt.Printf("Support bundle written to %s\n", path)
+	return nil
+}
+
+// fetchSupportBundle downloads a running service's support bundle to path
+func fetchSupportBundle(url, path string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("fetching support bundle: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// Handle dependency check
-	if *checkDeps {
-		return checkDependencies(ctx, mgr)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching support bundle: %s", resp.Status)
 	}
 
-	// Handle consumer check
-	if *checkConsumers {
-		return checkConsumerImpact(ctx, mgr, *repo)
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
 	}
+	defer f.Close()
 
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", path, err)
+	}
+	fmt.Printf("Support bundle written to %s\n", path)
 	return nil
 }
 
@@ -113,158 +259,124 @@ func dumpSchema(mgr *env.Manager, repo string) error {
 	return enc.Encode(reg)
 }
 
-// selfCheckChanges shows local changes in this service's config
-func selfCheckChanges(mgr *env.Manager, prSchemaPath string) error {
+// exportSchema writes the config documentation of a schema in format
+func exportSchema(format, schemaPath, repo string) error {
+	reg, err := loadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	title := reg.GitHub.Name()
+	if repo != "" {
+		title = repo
+	}
+	if title == "" {
+		title = "Service"
+	}
+	return env.WriteSchema(os.Stdout, title, reg.Fields, env.SchemaFormat(format))
+}
+
+// selfCheckChanges reports this service's config fields, or the changes
+// against a PR schema file
+func selfCheckChanges(mgr *env.Manager, prSchemaPath string) (*Report, error) {
 	reg := mgr.Registration()
 	if reg == nil {
-		return fmt.Errorf("no registration available")
+		return nil, fmt.Errorf("no registration available")
 	}
 
-	fmt.Printf("Service: %s/%s\n", reg.GitHub.Org, reg.GitHub.Repo)
-	fmt.Printf("Instance: %s\n", reg.Instance.ID)
-	fmt.Println()
+	r := &Report{
+		Command:  "self",
+		Service:  reg.GitHub.Org + "/" + reg.GitHub.Repo,
+		Title:    fmt.Sprintf("Service: %s/%s\nInstance: %s\n\n", reg.GitHub.Org, reg.GitHub.Repo, reg.Instance.ID),
+		artifact: prSchemaPath,
+	}
 
 	if prSchemaPath != "" {
 		// Compare with PR schema file
 		prData, err := os.ReadFile(prSchemaPath)
 		if err != nil {
-			return fmt.Errorf("reading PR schema: %w", err)
+			return nil, fmt.Errorf("reading PR schema: %w", err)
 		}
 
 		var prReg registry.ServiceRegistration
 		if err := json.Unmarshal(prData, &prReg); err != nil {
-			return fmt.Errorf("parsing PR schema: %w", err)
+			return nil, fmt.Errorf("parsing PR schema: %w", err)
 		}
 
-		// Compare fields
-		fmt.Println("Changes from PR:")
-		compareFields(reg.Fields, prReg.Fields)
-	} else {
-		// Just show current fields
-		fmt.Println("Current configuration fields:")
-		for _, f := range reg.Fields {
-			required := ""
-			if f.Required {
-				required = " (required)"
-			}
-			secret := ""
-			if f.IsSecret {
-				secret = " [secret]"
-			}
-			dep := ""
-			if f.Dependency != "" {
-				dep = fmt.Sprintf(" -> %s", f.Dependency)
-			}
-			fmt.Printf("  %s: %s%s%s%s\n", f.EnvKey, f.Type, required, secret, dep)
-		}
+		r.Title += "Changes from PR:"
+		r.empty = "No changes."
+		addFieldChanges(r, env.DiffFields(prReg.Fields, reg.Fields))
+		return r, nil
 	}
 
-	return nil
-}
-
-// compareFields compares two sets of fields and prints differences
-func compareFields(current, pr []registry.FieldInfo) {
-	currentMap := make(map[string]registry.FieldInfo)
-	for _, f := range current {
-		currentMap[f.EnvKey] = f
-	}
-
-	prMap := make(map[string]registry.FieldInfo)
-	for _, f := range pr {
-		prMap[f.EnvKey] = f
-	}
-
-	// Check for added fields
-	for key, f := range currentMap {
-		if _, exists := prMap[key]; !exists {
-			fmt.Printf("  + %s (new", key)
-			if f.Required {
-				fmt.Print(", required")
-			}
-			fmt.Println(")")
+	// Just show current fields
+	r.Title += "Current configuration fields:"
+	for _, f := range reg.Fields {
+		required := ""
+		if f.Required {
+			required = " (required)"
 		}
-	}
-
-	// Check for removed fields
-	for key := range prMap {
-		if _, exists := currentMap[key]; !exists {
-			fmt.Printf("  - %s (removed)\n", key)
+		secret := ""
+		if f.IsSecret {
+			secret = " [secret]"
+		}
+		dep := ""
+		if f.Dependency != "" {
+			dep = fmt.Sprintf(" -> %s", f.Dependency)
 		}
+		r.add("field", levelNote, f.EnvKey, "", fmt.Sprintf("%s: %s%s%s%s", f.EnvKey, f.Type, required, secret, dep))
 	}
+	return r, nil
+}
 
-	// Check for modified fields
-	for key, curr := range currentMap {
-		if pr, exists := prMap[key]; exists {
-			changes := []string{}
-			if curr.Default != pr.Default {
-				changes = append(changes, fmt.Sprintf("default: %s -> %s", pr.Default, curr.Default))
-			}
-			if curr.Required != pr.Required {
-				if curr.Required {
-					changes = append(changes, "now required")
-				} else {
-					changes = append(changes, "no longer required")
-				}
-			}
-			if curr.IsSecret != pr.IsSecret {
-				if curr.IsSecret {
-					changes = append(changes, "now secret")
-				} else {
-					changes = append(changes, "no longer secret")
-				}
-			}
-			if len(changes) > 0 {
-				fmt.Printf("  ~ %s: %v\n", key, changes)
-			}
-		}
+// addFieldChanges adds one note per field change
+func addFieldChanges(r *Report, changes []env.FieldChange) {
+	for _, c := range changes {
+		r.add("field-"+c.Kind, levelNote, c.EnvKey, "", c.String())
 	}
 }
 
 // checkDependencies checks if dependencies are available in NATS registry
-func checkDependencies(ctx context.Context, mgr *env.Manager) error {
+func checkDependencies(ctx context.Context, mgr *env.Manager) (*Report, error) {
 	reg := mgr.Registration()
 	if reg == nil {
-		return fmt.Errorf("no registration available")
+		return nil, fmt.Errorf("no registration available")
 	}
 
 	kv := mgr.KV()
 	if kv == nil {
-		return fmt.Errorf("NATS KV not available (not connected to hub?)")
+		return nil, fmt.Errorf("NATS KV not available (not connected to hub?)")
 	}
 
 	deps := env.GetDependencies(reg.Fields)
-	if len(deps) == 0 {
-		fmt.Println("No dependencies declared.")
-		return nil
+	r := &Report{
+		Command: "check-deps",
+		Service: reg.GitHub.Org + "/" + reg.GitHub.Repo,
+		Title:   fmt.Sprintf("Checking %d dependencies:", len(deps)),
+		empty:   "No dependencies declared.",
 	}
 
-	fmt.Printf("Checking %d dependencies:\n", len(deps))
-	allFound := true
-
 	for _, dep := range deps {
 		exists, err := env.ServiceExists(ctx, kv, dep)
 		if err != nil {
-			fmt.Printf("  ! %s: error checking (%v)\n", dep, err)
-			allFound = false
+			r.add("dependency-error", levelError, dep, "!", fmt.Sprintf("%s: error checking (%v)", dep, err))
 		} else if exists {
-			fmt.Printf("  ✓ %s: available\n", dep)
+			r.add("dependency-available", levelNote, dep, "✓", dep+": available")
 		} else {
-			fmt.Printf("  ✗ %s: not found\n", dep)
-			allFound = false
+			r.add("dependency-missing", levelError, dep, "✗", dep+": not found")
 		}
 	}
 
-	if !allFound {
-		return fmt.Errorf("some dependencies not available")
+	if r.Errors() > 0 {
+		r.Summary = "Some dependencies are not available."
 	}
-	return nil
+	return r, nil
 }
 
 // checkConsumerImpact checks impact on services that depend on this service
-func checkConsumerImpact(ctx context.Context, mgr *env.Manager, repo string) error {
+func checkConsumerImpact(ctx context.Context, mgr *env.Manager, repo string) (*Report, error) {
 	kv := mgr.KV()
 	if kv == nil {
-		return fmt.Errorf("NATS KV not available (not connected to hub?)")
+		return nil, fmt.Errorf("NATS KV not available (not connected to hub?)")
 	}
 
 	// Determine this service's identity
@@ -276,34 +388,161 @@ func checkConsumerImpact(ctx context.Context, mgr *env.Manager, repo string) err
 		}
 	}
 	if thisService == "" {
-		return fmt.Errorf("service identity required (use --repo flag or set GitOrg/GitRepo)")
+		return nil, fmt.Errorf("service identity required (use --repo flag or set GitOrg/GitRepo)")
 	}
 
-	fmt.Printf("Checking consumers of %s:\n", thisService)
-
 	// Get all services
 	services, err := env.GetAllServices(ctx, kv)
 	if err != nil {
-		return fmt.Errorf("fetching services: %w", err)
+		return nil, fmt.Errorf("fetching services: %w", err)
 	}
 
-	consumers := 0
+	r := &Report{
+		Command: "check-consumers",
+		Service: thisService,
+		Title:   fmt.Sprintf("Checking consumers of %s:", thisService),
+		empty:   "No consumers found.",
+	}
+	consumers := consumersOf(services, thisService)
+	for _, c := range consumers {
+		r.add("consumer", levelNote, c, "•", c+" depends on this service")
+	}
+	if len(consumers) > 0 {
+		r.Summary = fmt.Sprintf("%d service(s) depend on %s", len(consumers), thisService)
+	}
+	return r, nil
+}
+
+// consumersOf returns the services (org/repo, once each) that declare a
+// dependency on service
+func consumersOf(services []registry.ServiceRegistration, service string) []string {
+	seen := make(map[string]bool)
+	var consumers []string
 	for _, svc := range services {
-		deps := env.GetDependencies(svc.Fields)
-		for _, dep := range deps {
-			if dep == thisService {
-				consumers++
-				fmt.Printf("  • %s/%s depends on this service\n", svc.GitHub.Org, svc.GitHub.Repo)
+		name := svc.GitHub.Org + "/" + svc.GitHub.Repo
+		if seen[name] {
+			continue
+		}
+		for _, dep := range env.GetDependencies(svc.Fields) {
+			if dep == service {
+				seen[name] = true
+				consumers = append(consumers, name)
 				break
 			}
 		}
 	}
+	return consumers
+}
 
-	if consumers == 0 {
-		fmt.Println("  No consumers found.")
+// diffAgainstRegistry diffs the local schema (--pr-schema file or this
+// process's registration) against the newest registered instance of the
+// service; breaking changes are errors
+func diffAgainstRegistry(ctx context.Context, mgr *env.Manager, repo, localSchemaPath string) (*Report, error) {
+	if mgr.KV() == nil {
+		return nil, fmt.Errorf("NATS KV not available (not connected to hub?)")
+	}
+
+	var local registry.ServiceRegistration
+	if localSchemaPath != "" {
+		data, err := os.ReadFile(localSchemaPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading local schema: %w", err)
+		}
+		if local, err = registry.Decode(data); err != nil {
+			return nil, fmt.Errorf("parsing local schema: %w", err)
+		}
+	} else if reg := mgr.Registration(); reg != nil {
+		local = *reg
 	} else {
-		fmt.Printf("\n%d service(s) depend on %s\n", consumers, thisService)
+		return nil, fmt.Errorf("no local schema (use --pr-schema with the output of --schema-dump)")
+	}
+
+	service := repo
+	if service == "" && local.GitHub.Org != "" {
+		service = local.GitHub.Org + "/" + local.GitHub.Repo
+	}
+	if service == "" {
+		return nil, fmt.Errorf("service identity required (use --repo flag or set GitOrg/GitRepo)")
 	}
 
+	r := &Report{
+		Command:  "diff-registry",
+		Service:  service,
+		artifact: localSchemaPath,
+	}
+
+	instances, err := mgr.GetService(ctx, service)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", service, err)
+	}
+	if len(instances) == 0 {
+		r.Title = fmt.Sprintf("%s is not registered; nothing to diff against.", service)
+		return r, nil
+	}
+
+	// The newest instance carries the schema currently deployed
+	baseline := instances[0]
+	for _, inst := range instances[1:] {
+		if inst.Instance.Started.After(baseline.Instance.Started) {
+			baseline = inst
+		}
+	}
+
+	all, err := mgr.GetAllServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching services: %w", err)
+	}
+	consumers := consumersOf(all, service)
+
+	r.Title = fmt.Sprintf("Registered schema: %s (instance %s", service, baseline.Instance.ID)
+	if baseline.GitHub.Tag != "" {
+		r.Title += ", " + baseline.GitHub.Tag
+	}
+	r.Title += ")"
+	r.empty = "No changes."
+
+	addFieldChanges(r, env.DiffFields(baseline.Fields, local.Fields))
+	for _, c := range env.BreakingChanges(baseline.Fields, local.Fields, len(consumers) > 0) {
+		r.add("breaking-change", levelError, c.EnvKey, "!", c.String())
+	}
+	if n := r.Errors(); n > 0 {
+		r.Summary = fmt.Sprintf("%d breaking change(s) against the registered schema (%d consumer(s)).", n, len(consumers))
+	}
+	return r, nil
+}
+
+// writeGraph outputs the dependency graph of all registered services and
+// fails if services depend on each other in a cycle
+func writeGraph(ctx context.Context, mgr *env.Manager, format string) error {
+	if mgr.KV() == nil {
+		return fmt.Errorf("NATS KV not available (not connected to hub?)")
+	}
+
+	regs, err := mgr.GetAllServices(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching services: %w", err)
+	}
+	g := env.BuildDependencyGraph(regs)
+
+	switch format {
+	case "dot":
+		err = g.WriteDOT(os.Stdout)
+	case "mermaid":
+		err = g.WriteMermaid(os.Stdout)
+	case "json":
+		err = writeJSON(os.Stdout, g)
+	default:
+		return fmt.Errorf("unknown graph format %q (use: dot, mermaid, json)", format)
+	}
+	if err != nil {
+		return fmt.Errorf("writing graph: %w", err)
+	}
+
+	for _, cycle := range g.Cycles {
+		fmt.Fprintf(os.Stderr, "cycle between: %s\n", strings.Join(cycle, ", "))
+	}
+	if len(g.Cycles) > 0 {
+		return fmt.Errorf("%d dependency cycle(s)", len(g.Cycles))
+	}
 	return nil
 }
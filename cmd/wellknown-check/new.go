@@ -0,0 +1,70 @@
+// new.go: Start a leaf service from the SDK's skeleton
+//
+//	wellknown-check new ./orders --repo acme/orders
+//	wellknown-check new ./orders --repo acme/orders --sdk ../wellnown-env/pkg/env
+//
+// Writes main.go, config.go (the config struct), page.go (Via pages),
+// pc.yaml and go.mod into the directory (see pkg/env/skeleton) and never
+// overwrites existing files. go mod tidy there fetches the SDK, or uses
+// the local checkout given with --sdk.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/skeleton"
+)
+
+// newUsage shows how to call new
+const newUsage = "usage: wellknown-check new <dir> --repo org/repo [--module path] [--prefix APP] [--sdk dir]"
+
+// runNew runs the new subcommand
+func runNew(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	repo := fs.String("repo", "", "Repository name (org/repo) the service registers as")
+	module := fs.String("module", "", "Go module path (default: github.com/<repo>)")
+	prefix := fs.String("prefix", "", "Env var prefix (default: repo name in upper case)")
+	sdk := fs.String("sdk", "", "Local pkg/env directory to build against (default: the published SDK)")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 || *repo == "" {
+		return errors.New(newUsage)
+	}
+	dir := pos[0]
+
+	p := skeleton.Params{Repo: *repo, Module: *module, Prefix: *prefix}
+	if *sdk != "" {
+		// go.mod replaces are relative to the service
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		absSDK, err := filepath.Abs(*sdk)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(absDir, absSDK)
+		if err != nil {
+			return fmt.Errorf("--sdk: %w", err)
+		}
+		if p.SDKPath = filepath.ToSlash(rel); !strings.HasPrefix(p.SDKPath, "../") {
+			p.SDKPath = "./" + p.SDKPath // A path, not a module
+		}
+	}
+
+	paths, err := skeleton.Write(dir, p)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println("created", path)
+	}
+	fmt.Printf("\nNext: cd %s && go mod tidy && go run .\n", dir)
+	return nil
+}
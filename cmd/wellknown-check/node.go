@@ -0,0 +1,264 @@
+// node.go: Node maintenance, tags, power profiles and bulk commands
+//
+//	wellknown-check node drain edge-7 --reason "disk swap"
+//	wellknown-check node clear edge-7
+//	wellknown-check node tag edge-7 site=warehouse-3 hw=rpi4
+//	wellknown-check node tag edge-7 hw-          # Remove a tag
+//	wellknown-check node power edge-7 low        # Or normal; default clears it
+//	wellknown-check node list --tags site=warehouse-3
+//	wellknown-check node exec site=warehouse-3 restart camera
+//
+// drain sets the node's flag in the node_maintenance bucket; its services
+// mark their registrations, stop taking work and pause schedules until
+// the flag is cleared (see pkg/env/maintenance.go). Tags live in the
+// node_tags bucket and power overrides in node_power (see
+// pkg/env/power.go), and exec sends a command to every matching node that
+// handles fleet commands (see pkg/env/fleet.go).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// nodeUsage lists the node commands
+const nodeUsage = "usage: wellknown-check node drain|clear <name> | tag <name> key=value... | power <name> low|normal|default | list [--tags sel] | exec <sel> <action> [target]"
+
+// runNode runs the node subcommand
+func runNode(args []string) error {
+	if len(args) == 0 {
+		return errors.New(nodeUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("node "+cmd, flag.ContinueOnError)
+	reason := fs.String("reason", "", "Why the node is in maintenance (drain)")
+	by := fs.String("by", currentUser(), "Who is changing the node (drain, power)")
+	tags := fs.String("tags", "", "Only list nodes with these tags, e.g. site=warehouse-3,hw=rpi4 (list)")
+	wait := fs.Duration("wait", 5*time.Second, "How long to collect replies (exec)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for NATS operations")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case (cmd == "drain" || cmd == "clear") && len(pos) == 1:
+	case cmd == "tag" && len(pos) >= 2:
+	case cmd == "power" && len(pos) == 2:
+	case cmd == "list" && len(pos) == 0:
+	case cmd == "exec" && (len(pos) == 2 || len(pos) == 3):
+	default:
+		return errors.New(nodeUsage)
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+	if mgr.JetStream() == nil {
+		return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch cmd {
+	case "drain", "clear":
+		kv, err := env.OpenMaintenanceBucket(ctx, mgr.JetStream())
+		if err != nil {
+			return err
+		}
+		if cmd == "clear" {
+			if err := env.ClearMaintenance(ctx, kv, pos[0]); err != nil {
+				return err
+			}
+			fmt.Printf("%s is back in service\n", pos[0])
+			return nil
+		}
+		if err := env.SetMaintenance(ctx, kv, env.Maintenance{Node: pos[0], Reason: *reason, By: *by}); err != nil {
+			return err
+		}
+		fmt.Printf("%s is in maintenance\n", pos[0])
+
+	case "tag":
+		kv, err := env.OpenNodeTagsBucket(ctx, mgr.JetStream())
+		if err != nil {
+			return err
+		}
+		current, err := env.GetNodeTags(ctx, kv, pos[0])
+		if err != nil {
+			return err
+		}
+		updated := maps.Clone(current)
+		if updated == nil {
+			updated = make(map[string]string)
+		}
+		for _, arg := range pos[1:] {
+			if key, ok := strings.CutSuffix(arg, "-"); ok && !strings.Contains(arg, "=") {
+				delete(updated, key)
+				continue
+			}
+			sel, err := env.ParseTagSelector(arg)
+			if err != nil {
+				return err
+			}
+			maps.Copy(updated, sel)
+		}
+		if err := env.SetNodeTags(ctx, kv, pos[0], updated); err != nil {
+			return err
+		}
+		fmt.Printf("%s tags: %s\n", pos[0], env.TagSelector(updated))
+
+	case "power":
+		kv, err := env.OpenNodePowerBucket(ctx, mgr.JetStream())
+		if err != nil {
+			return err
+		}
+		if pos[1] == "default" {
+			if err := env.ClearNodePower(ctx, kv, pos[0]); err != nil {
+				return err
+			}
+			fmt.Printf("%s uses its configured power profile\n", pos[0])
+			return nil
+		}
+		if err := env.SetNodePower(ctx, kv, env.NodePower{Node: pos[0], Profile: pos[1], By: *by}); err != nil {
+			return err
+		}
+		fmt.Printf("%s power profile: %s\n", pos[0], pos[1])
+
+	case "list":
+		sel, err := env.ParseTagSelector(*tags)
+		if err != nil {
+			return err
+		}
+		return listNodes(ctx, mgr, sel)
+
+	case "exec":
+		sel, err := env.ParseTagSelector(pos[0])
+		if err != nil {
+			return err
+		}
+		fleetCmd := env.FleetCommand{Selector: sel, Action: pos[1]}
+		if len(pos) == 3 {
+			fleetCmd.Target = pos[2]
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, *wait)
+		defer cancel()
+		replies, err := env.SendFleetCommand(waitCtx, mgr.NC(), fleetCmd)
+		if err != nil {
+			return err
+		}
+		return printFleetReplies(replies)
+	}
+	return nil
+}
+
+// listNodes prints the nodes matching sel with their tags and maintenance
+func listNodes(ctx context.Context, mgr *env.Manager, sel env.TagSelector) error {
+	tagsKV, err := env.OpenNodeTagsBucket(ctx, mgr.JetStream())
+	if err != nil {
+		return err
+	}
+	maintKV, err := env.OpenMaintenanceBucket(ctx, mgr.JetStream())
+	if err != nil {
+		return err
+	}
+	tagged, err := env.ListNodeTags(ctx, tagsKV, sel)
+	if err != nil {
+		return err
+	}
+	flags, err := env.ListMaintenance(ctx, maintKV)
+	if err != nil {
+		return err
+	}
+
+	maint := make(map[string]env.Maintenance)
+	for _, f := range flags {
+		maint[f.Node] = f
+	}
+	nodes := tagged
+	if len(sel) == 0 { // Nodes in maintenance without tags too
+		known := make(map[string]bool)
+		for _, n := range tagged {
+			known[n.Node] = true
+		}
+		for _, f := range flags {
+			if !known[f.Node] {
+				nodes = append(nodes, env.NodeTags{Node: f.Node})
+			}
+		}
+	}
+
+	if len(nodes) == 0 {
+		fmt.Println("No nodes tagged or in maintenance")
+	}
+	for _, n := range nodes {
+		status := "in service"
+		if f, ok := maint[n.Node]; ok {
+			status = fmt.Sprintf("maintenance since %s by %s: %s", f.Since.Format(time.RFC3339), f.By, f.Reason)
+		}
+		fmt.Printf("%s\t%s\t%s\n", n.Node, env.TagSelector(n.Tags), status)
+	}
+	return nil
+}
+
+// printFleetReplies prints one line per replying node and fails if any
+// node failed or none replied
+func printFleetReplies(replies []env.FleetReply) error {
+	if len(replies) == 0 {
+		return fmt.Errorf("no node replied")
+	}
+	failed := 0
+	for _, r := range replies {
+		result := "ok"
+		if r.Error != "" {
+			result = "error: " + r.Error
+			failed++
+		}
+		fmt.Printf("%s\t%s\t%s\n", r.Node, r.Service, result)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d nodes failed", failed, len(replies))
+	}
+	return nil
+}
+
+// parseInterspersed parses flags before, between and after the positional
+// arguments and returns the positional ones
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return pos, nil
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// currentUser names the operator for --by
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,262 @@
+// report.go: Structured check results and their output formats
+//
+// Every check builds a Report of findings; --format picks how it is
+// written:
+//
+//	text      Human-readable (default)
+//	json      The Report as JSON
+//	sarif     SARIF 2.1.0 for GitHub code scanning (upload-sarif action)
+//	markdown  A table for PR comments and $GITHUB_STEP_SUMMARY
+//
+// Error-level findings make the command exit non-zero in every format.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Output formats
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatSARIF    = "sarif"
+	formatMarkdown = "markdown"
+)
+
+// Finding levels (SARIF result levels)
+const (
+	levelNote    = "note"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// Finding is one result of a check
+type Finding struct {
+	Rule    string `json:"rule"`    // e.g. dependency-missing, breaking-change
+	Level   string `json:"level"`   // note, warning, error
+	Subject string `json:"subject"` // Env key or org/repo the finding is about
+	Message string `json:"message"`
+	mark    string // Text format prefix (✓, ✗, +, ...)
+}
+
+// Report is the result of one check command
+type Report struct {
+	Command  string    `json:"command"`
+	Service  string    `json:"service,omitempty"`
+	Title    string    `json:"title"`
+	Findings []Finding `json:"findings"`
+	Summary  string    `json:"summary,omitempty"`
+	empty    string    // Text shown when there are no findings
+	artifact string    // File SARIF results point at
+}
+
+// add appends a finding
+func (r *Report) add(rule, level, subject, mark, message string) {
+	r.Findings = append(r.Findings, Finding{Rule: rule, Level: level, Subject: subject, Message: message, mark: mark})
+}
+
+// Errors returns the number of error-level findings
+func (r *Report) Errors() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Level == levelError {
+			n++
+		}
+	}
+	return n
+}
+
+// writeReport writes r in the given format
+func writeReport(w io.Writer, r *Report, format string) error {
+	switch format {
+	case formatText:
+		return writeText(w, r)
+	case formatJSON:
+		return writeJSON(w, r)
+	case formatSARIF:
+		return writeJSON(w, toSARIF(r))
+	case formatMarkdown:
+		return writeMarkdown(w, r)
+	default:
+		return fmt.Errorf("unknown format %q (use: text, json, sarif, markdown)", format)
+	}
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeText writes the human-readable report
+func writeText(w io.Writer, r *Report) error {
+	var b strings.Builder
+	b.WriteString(r.Title + "\n")
+	for _, f := range r.Findings {
+		b.WriteString("  ")
+		if f.mark != "" {
+			b.WriteString(f.mark + " ")
+		}
+		b.WriteString(f.Message + "\n")
+	}
+	if len(r.Findings) == 0 && r.empty != "" {
+		b.WriteString("  " + r.empty + "\n")
+	}
+	if r.Summary != "" {
+		b.WriteString("\n" + r.Summary + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdown writes the report as a heading and a findings table
+func writeMarkdown(w io.Writer, r *Report) error {
+	var b strings.Builder
+	heading, rest, _ := strings.Cut(r.Title, "\n")
+	fmt.Fprintf(&b, "### %s\n\n", heading)
+	for _, line := range strings.Split(rest, "\n") {
+		if line != "" {
+			b.WriteString(line + "\n\n")
+		}
+	}
+	if len(r.Findings) == 0 {
+		msg := r.empty
+		if msg == "" {
+			msg = "No findings."
+		}
+		b.WriteString(msg + "\n")
+	} else {
+		b.WriteString("| Level | Rule | Subject | Message |\n")
+		b.WriteString("|-------|------|---------|---------|\n")
+		for _, f := range r.Findings {
+			fmt.Fprintf(&b, "| %s | `%s` | `%s` | %s |\n", f.Level, f.Rule, f.Subject, markdownEscape(f.Message))
+		}
+	}
+	if r.Summary != "" {
+		b.WriteString("\n" + r.Summary + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscape keeps a message inside its table cell
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// sarifLog is the subset of SARIF 2.1.0 GitHub code scanning reads
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// ruleDescriptions describe the rules findings can carry
+var ruleDescriptions = map[string]string{
+	"dependency-available": "Dependency is registered",
+	"dependency-missing":   "Dependency is not registered",
+	"dependency-error":     "Dependency lookup failed",
+	"consumer":             "Service depends on this service",
+	"field":                "Config field",
+	"field-added":          "Config field added",
+	"field-removed":        "Config field removed",
+	"field-changed":        "Config field changed",
+	"breaking-change":      "Config change breaks existing deployments or consumers",
+}
+
+// toSARIF converts r into a SARIF log. Results point at the report's
+// artifact (the schema file, or go.mod), since config findings have no
+// source line of their own.
+func toSARIF(r *Report) sarifLog {
+	artifact := r.artifact
+	if artifact == "" {
+		artifact = "go.mod"
+	}
+
+	ruleIDs := map[string]bool{}
+	results := make([]sarifResult, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		ruleIDs[f.Rule] = true
+		results = append(results, sarifResult{
+			RuleID:  f.Rule,
+			Level:   f.Level,
+			Message: sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact{URI: artifact},
+				Region:           sarifRegion{StartLine: 1},
+			}}},
+		})
+	}
+
+	rules := make([]sarifRule, 0, len(ruleIDs))
+	for id := range ruleIDs {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: ruleDescriptions[id]}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "wellknown-check",
+				InformationURI: "https://github.com/joeblew999/wellnown-env",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
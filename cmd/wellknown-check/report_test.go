@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testReport has findings of every level, two with the same rule
+func testReport() *Report {
+	r := &Report{Command: "deps", Service: "acme/api", Title: "Dependencies of acme/api", artifact: "wellknown.schema.json"}
+	r.add("dependency-missing", levelError, "acme/auth", "✗", "acme/auth is not registered")
+	r.add("dependency-available", levelNote, "acme/db", "✓", "acme/db: 2 instances")
+	r.add("dependency-missing", levelError, "acme/mail", "✗", "acme/mail | smtp is not registered")
+	r.add("breaking-change", levelWarning, "DB_URL", "!", "DB_URL became required")
+	r.Summary = "2 missing"
+	return r
+}
+
+func TestWriteReportSARIF(t *testing.T) {
+	tests := []struct {
+		name         string
+		report       *Report
+		wantRules    []string
+		wantLevels   []string
+		wantArtifact string
+	}{
+		{
+			name:         "findings",
+			report:       testReport(),
+			wantRules:    []string{"breaking-change", "dependency-available", "dependency-missing"},
+			wantLevels:   []string{levelError, levelNote, levelError, levelWarning},
+			wantArtifact: "wellknown.schema.json",
+		},
+		{
+			name:         "no findings",
+			report:       &Report{Command: "deps", Title: "Dependencies"},
+			wantRules:    []string{},
+			wantLevels:   []string{},
+			wantArtifact: "go.mod",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeReport(&buf, tt.report, formatSARIF); err != nil {
+				t.Fatalf("writeReport() error = %v", err)
+			}
+			var log sarifLog
+			if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+				t.Fatalf("SARIF is not valid JSON: %v\n%s", err, buf.String())
+			}
+
+			if log.Version != "2.1.0" || !strings.Contains(log.Schema, "sarif-2.1.0") {
+				t.Errorf("version = %q, $schema = %q, want SARIF 2.1.0", log.Version, log.Schema)
+			}
+			if len(log.Runs) != 1 {
+				t.Fatalf("got %d runs, want 1", len(log.Runs))
+			}
+			run := log.Runs[0]
+			if run.Tool.Driver.Name != "wellknown-check" {
+				t.Errorf("driver name = %q", run.Tool.Driver.Name)
+			}
+
+			rules := []string{}
+			for _, rule := range run.Tool.Driver.Rules {
+				rules = append(rules, rule.ID)
+				if rule.ShortDescription.Text == "" {
+					t.Errorf("rule %s has no description", rule.ID)
+				}
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("rules = %v, want %v", rules, tt.wantRules)
+			}
+
+			levels := []string{}
+			for i, res := range run.Results {
+				levels = append(levels, res.Level)
+				if f := tt.report.Findings[i]; res.RuleID != f.Rule || res.Message.Text != f.Message {
+					t.Errorf("result %d = %s %q, want %s %q", i, res.RuleID, res.Message.Text, f.Rule, f.Message)
+				}
+				if len(res.Locations) != 1 {
+					t.Errorf("result %d has %d locations, want 1", i, len(res.Locations))
+					continue
+				}
+				loc := res.Locations[0].PhysicalLocation
+				if loc.ArtifactLocation.URI != tt.wantArtifact || loc.Region.StartLine != 1 {
+					t.Errorf("result %d location = %s:%d, want %s:1", i, loc.ArtifactLocation.URI, loc.Region.StartLine, tt.wantArtifact)
+				}
+			}
+			if !reflect.DeepEqual(levels, tt.wantLevels) {
+				t.Errorf("levels = %v, want %v", levels, tt.wantLevels)
+			}
+		})
+	}
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		report *Report
+	}{
+		{"findings", testReport()},
+		{"no findings", &Report{Command: "deps", Title: "Dependencies", Findings: []Finding{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeReport(&buf, tt.report, formatJSON); err != nil {
+				t.Fatalf("writeReport() error = %v", err)
+			}
+			var got Report
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v\n%s", err, buf.String())
+			}
+
+			// The text marks and output hints stay out of the JSON
+			want := *tt.report
+			want.artifact, want.empty = "", ""
+			want.Findings = make([]Finding, len(tt.report.Findings))
+			for i, f := range tt.report.Findings {
+				f.mark = ""
+				want.Findings[i] = f
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+			if got.Errors() != tt.report.Errors() {
+				t.Errorf("Errors() = %d after the round trip, want %d", got.Errors(), tt.report.Errors())
+			}
+		})
+	}
+}
+
+func TestWriteReportMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		report *Report
+		want   string
+	}{
+		{
+			name:   "findings",
+			report: testReport(),
+			want: "### Dependencies of acme/api\n\n" +
+				"| Level | Rule | Subject | Message |\n" +
+				"|-------|------|---------|---------|\n" +
+				"| error | `dependency-missing` | `acme/auth` | acme/auth is not registered |\n" +
+				"| note | `dependency-available` | `acme/db` | acme/db: 2 instances |\n" +
+				"| error | `dependency-missing` | `acme/mail` | acme/mail \\| smtp is not registered |\n" +
+				"| warning | `breaking-change` | `DB_URL` | DB_URL became required |\n" +
+				"\n2 missing\n",
+		},
+		{
+			name:   "multi-line title",
+			report: &Report{Title: "Schema diff\nold.json -> new.json", empty: "No changes."},
+			want:   "### Schema diff\n\nold.json -> new.json\n\nNo changes.\n",
+		},
+		{
+			name:   "no findings",
+			report: &Report{Title: "Dependencies"},
+			want:   "### Dependencies\n\nNo findings.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeReport(&buf, tt.report, formatMarkdown); err != nil {
+				t.Fatalf("writeReport() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("markdown =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteReportUnknownFormat(t *testing.T) {
+	if err := writeReport(&bytes.Buffer{}, testReport(), "xml"); err == nil {
+		t.Error("writeReport(xml) succeeded, want an error")
+	}
+}
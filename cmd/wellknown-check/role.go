@@ -0,0 +1,129 @@
+// role.go: Who may view, operate and administer the fleet
+//
+//	wellknown-check role list                          # Roles and bindings
+//	wellknown-check role set alice operator
+//	wellknown-check role set grafana viewer --key UABC... # NKey user (hub ROLES=true)
+//	wellknown-check role show alice
+//	wellknown-check role remove alice
+//
+// Roles and bindings live in the access_roles bucket; the dashboard
+// middleware, access grants and the hub's NKey users all read them (see
+// pkg/env/roles.go).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// roleUsage lists the role commands
+const roleUsage = "usage: wellknown-check role list | set <user> <role> [--key <nkey>] | show <user> | remove <user>"
+
+// runRole runs the role subcommand
+func runRole(args []string) error {
+	if len(args) == 0 {
+		return errors.New(roleUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("role "+cmd, flag.ContinueOnError)
+	key := fs.String("key", "", "Public NKey the user connects with (set)")
+	by := fs.String("by", currentUser(), "Who changes the binding")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for NATS operations")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cmd == "list" && len(pos) == 0:
+	case cmd == "set" && len(pos) == 2:
+	case (cmd == "show" || cmd == "remove") && len(pos) == 1:
+	default:
+		return errors.New(roleUsage)
+	}
+
+	mgr, err := env.New("WELLKNOWN_CHECK",
+		env.WithoutGUI(),
+		env.WithoutHeartbeat(),
+		env.WithoutRegistration(),
+		env.WithLightweightNATS(),
+	)
+	if err != nil {
+		return fmt.Errorf("creating manager: %w", err)
+	}
+	defer mgr.Close()
+	if mgr.JetStream() == nil {
+		return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	store, err := env.OpenRoleStore(ctx, mgr.JetStream())
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "list":
+		roles, err := store.Roles(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range roles {
+			fmt.Printf("%s\t%s\t%s\n", r.Name, strings.Join(r.Capabilities, ","), r.Description)
+		}
+		bindings, err := store.Bindings(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		if len(bindings) == 0 {
+			fmt.Println("No role bindings (access is not role-checked yet)")
+		}
+		for _, b := range bindings {
+			printBinding(b)
+		}
+
+	case "set":
+		if err := store.Bind(ctx, env.RoleBinding{User: pos[0], Role: pos[1], PublicKey: *key, By: *by}); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %s\n", pos[0], pos[1])
+
+	case "show":
+		b, err := store.Binding(ctx, pos[0])
+		if err != nil {
+			return err
+		}
+		r, err := store.Role(ctx, b.Role)
+		if err != nil {
+			return err
+		}
+		printBinding(b)
+		fmt.Printf("capabilities: %s\npublish:      %s\nsubscribe:    %s\n",
+			strings.Join(r.Capabilities, ", "), strings.Join(r.Permissions.Publish, " "), strings.Join(r.Permissions.Subscribe, " "))
+
+	case "remove":
+		if err := store.Unbind(ctx, pos[0]); err != nil {
+			return err
+		}
+		fmt.Printf("%s has no role\n", pos[0])
+	}
+	return nil
+}
+
+// printBinding prints one role binding
+func printBinding(b env.RoleBinding) {
+	key := b.PublicKey
+	if key == "" {
+		key = "-"
+	}
+	fmt.Printf("%s\t%s\t%s\tby %s\t%s\n", b.User, b.Role, key, b.By, b.Updated.Local().Format(time.RFC3339))
+}
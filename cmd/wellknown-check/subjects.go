@@ -0,0 +1,190 @@
+// subjects.go: Lint the subjects a service uses against its contract
+//
+//	wellknown-check --lint-subjects --repo acme/orders --monitor http://edge-7:8222 --sample 1m
+//
+// The contract is the newest registration of the service: its served
+// subjects (Capabilities.Subjects) and dependencies, as env.LintSubjects
+// reads them. What it uses is sampled at runtime:
+//
+//   - Subscriptions come from /connz on the monitor of the node the service
+//     runs on (its connections are named org/repo/instance)
+//   - Publishes are the requests seen on the mesh during --sample whose
+//     reply goes to one of the service's inboxes; plain publishes carry no
+//     sender and are not attributed
+//
+// Undeclared subjects are errors (scoped permissions would break them);
+// unused ones are warnings, dependencies not requested in the sample notes.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// connzLimit caps the connections read from /connz
+const connzLimit = 1024
+
+// connz is the part of the /connz?subs=detail response the lint reads
+type connz struct {
+	Connections []struct {
+		Name string `json:"name"`
+		Subs []struct {
+			Subject string `json:"subject"`
+		} `json:"subscriptions_list_detail"`
+	} `json:"connections"`
+}
+
+// lintSubjects compares the subjects service declares with the ones it
+// uses on the node behind monitorURL
+func lintSubjects(ctx context.Context, mgr *env.Manager, repo, monitorURL string, sample time.Duration) (*Report, error) {
+	if mgr.KV() == nil {
+		return nil, fmt.Errorf("NATS KV not available (not connected to hub?)")
+	}
+	service := repo
+	if service == "" {
+		if reg := mgr.Registration(); reg != nil && reg.GitHub.Org != "" {
+			service = reg.GitHub.Org + "/" + reg.GitHub.Repo
+		}
+	}
+	if service == "" {
+		return nil, fmt.Errorf("service identity required (use --repo flag or set GitOrg/GitRepo)")
+	}
+
+	instances, err := mgr.GetService(ctx, service)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", service, err)
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("%s is not registered", service)
+	}
+	reg := instances[0]
+	for _, inst := range instances[1:] {
+		if inst.Instance.Started.After(reg.Instance.Started) {
+			reg = inst
+		}
+	}
+
+	conns, subscribed, err := sampleSubscriptions(ctx, monitorURL, service)
+	if err != nil {
+		return nil, err
+	}
+	if conns == 0 {
+		return nil, fmt.Errorf("no connections of %s on %s (monitor the node it runs on)", service, monitorURL)
+	}
+	published, err := samplePublishes(mgr.NC(), inboxPrefixes(subscribed), sample)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{
+		Command: "lint-subjects",
+		Service: service,
+		Title:   fmt.Sprintf("Subjects of %s (%d connection(s), requests sampled for %s):", service, conns, sample),
+		empty:   "Declared and used subjects match.",
+	}
+	for _, issue := range env.LintSubjects(reg, env.ObservedSubjects{Subscribed: subscribed, Published: published}) {
+		switch issue.Kind {
+		case env.SubjectUndeclaredSubscribe, env.SubjectUndeclaredPublish:
+			r.add("subject-undeclared", levelError, issue.Subject, "✗", issue.String())
+		case env.SubjectUnused:
+			r.add("subject-unused", levelWarning, issue.Subject, "?", issue.String())
+		case env.SubjectUnusedDependency:
+			r.add("dependency-unused", levelNote, issue.Subject, "•", issue.String()+" during the sample")
+		}
+	}
+	if n := r.Errors(); n > 0 {
+		r.Summary = fmt.Sprintf("%d undeclared subject(s): declare them (Capabilities.Subjects or a dependency) or stop using them.", n)
+	}
+	return r, nil
+}
+
+// sampleSubscriptions reads the subscriptions of service's connections
+// from the monitor's /connz
+func sampleSubscriptions(ctx context.Context, monitorURL, service string) (int, []string, error) {
+	url := fmt.Sprintf("%s/connz?subs=detail&limit=%d", strings.TrimSuffix(monitorURL, "/"), connzLimit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading connz: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading connz: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, fmt.Errorf("reading connz: %s", resp.Status)
+	}
+	var cz connz
+	if err := json.NewDecoder(resp.Body).Decode(&cz); err != nil {
+		return 0, nil, fmt.Errorf("decoding connz: %w", err)
+	}
+
+	conns := 0
+	var subjects []string
+	for _, c := range cz.Connections {
+		if !strings.HasPrefix(c.Name, service+"/") {
+			continue
+		}
+		conns++
+		for _, s := range c.Subs {
+			subjects = append(subjects, s.Subject)
+		}
+	}
+	return conns, subjects, nil
+}
+
+// inboxPrefixes returns the reply prefixes of inbox subscriptions
+// (_INBOX.abc.* becomes _INBOX.abc.)
+func inboxPrefixes(subscribed []string) []string {
+	var prefixes []string
+	for _, s := range subscribed {
+		if strings.HasPrefix(s, nats.InboxPrefix) {
+			prefixes = append(prefixes, strings.TrimRight(s, "*>"))
+		}
+	}
+	return prefixes
+}
+
+// samplePublishes taps the mesh for d and returns the subjects of requests
+// replying to one of inboxes
+func samplePublishes(nc *nats.Conn, inboxes []string, d time.Duration) ([]string, error) {
+	if len(inboxes) == 0 {
+		return nil, nil
+	}
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	sub, err := nc.Subscribe(">", func(msg *nats.Msg) {
+		if msg.Reply == "" || !slices.ContainsFunc(inboxes, func(p string) bool { return strings.HasPrefix(msg.Reply, p) }) {
+			return
+		}
+		mu.Lock()
+		seen[msg.Subject] = true
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tapping requests: %w", err)
+	}
+	time.Sleep(d)
+	if err := sub.Unsubscribe(); err != nil {
+		return nil, fmt.Errorf("tapping requests: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	subjects := make([]string, 0, len(seen))
+	for s := range seen {
+		subjects = append(subjects, s)
+	}
+	slices.Sort(subjects)
+	return subjects, nil
+}
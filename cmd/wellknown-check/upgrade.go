@@ -0,0 +1,90 @@
+// upgrade.go: Self-update from GitHub releases or the hub's object store
+//
+//	wellknown-check upgrade              # Install the latest GitHub release
+//	wellknown-check upgrade --check      # Only report whether one exists
+//	wellknown-check upgrade --from nats  # From the hub's "releases" object store
+//
+// --check exits non-zero when an upgrade is available, for scripts.
+// Binaries installed with brew or apt are upgraded by the package manager.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/joeblew999/wellnown-env/pkg/env/selfupdate"
+)
+
+// binaryName is the release asset prefix of this binary
+const binaryName = "wellknown-check"
+
+// runUpgrade runs the upgrade subcommand
+func runUpgrade(args []string) error {
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	check := fs.Bool("check", false, "Only report whether a newer version is available")
+	from := fs.String("from", "github", "Release source: github or nats")
+	repo := fs.String("repo", "joeblew999/wellnown-env", "GitHub repository (org/repo) publishing releases")
+	bucket := fs.String("bucket", selfupdate.DefaultBucket, "Object store bucket holding releases (--from nats)")
+	force := fs.Bool("force", false, "Install the latest release even if it is not newer")
+	timeout := fs.Duration("timeout", 2*time.Minute, "Timeout for the check and download")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var src selfupdate.Source
+	switch *from {
+	case "github":
+		src = selfupdate.GitHub{Repo: *repo}
+	case "nats":
+		mgr, err := env.New("WELLKNOWN_CHECK",
+			env.WithoutGUI(),
+			env.WithoutHeartbeat(),
+			env.WithoutRegistration(),
+			env.WithLightweightNATS(),
+		)
+		if err != nil {
+			return fmt.Errorf("creating manager: %w", err)
+		}
+		defer mgr.Close()
+		if mgr.JetStream() == nil {
+			return fmt.Errorf("NATS JetStream not available (not connected to hub?)")
+		}
+		store, err := mgr.JetStream().ObjectStore(ctx, *bucket)
+		if err != nil {
+			return fmt.Errorf("opening object store %s: %w", *bucket, err)
+		}
+		src = selfupdate.ObjectStore{Store: store}
+	default:
+		return fmt.Errorf("unknown release source %q (use: github, nats)", *from)
+	}
+
+	current := env.ReadBuildVersion().Version
+	rel, err := src.Latest(ctx, binaryName)
+	if err != nil {
+		return err
+	}
+	if !*force && !selfupdate.Newer(rel.Version, current) {
+		fmt.Printf("%s %s is up to date (latest: %s)\n", binaryName, current, rel.Version)
+		return nil
+	}
+	if *check {
+		return fmt.Errorf("%s %s is available (running %s)", binaryName, rel.Version, current)
+	}
+
+	fmt.Printf("Upgrading %s %s -> %s...\n", binaryName, current, rel.Version)
+	if err := selfupdate.Update(ctx, src, rel); err != nil {
+		if errors.Is(err, selfupdate.ErrPackageManaged) {
+			return fmt.Errorf("not upgrading: %w", err)
+		}
+		return fmt.Errorf("upgrading: %w", err)
+	}
+	fmt.Printf("Upgraded to %s\n", rel.Version)
+	return nil
+}
@@ -0,0 +1,57 @@
+// a11y.go: Accessibility helpers for the Via dashboards
+//
+// - AriaLabel names icon-like or repeated action buttons ("Stop ticker")
+// - LiveRegion/AlertRegion announce status changes pushed over SSE
+// - RegisterFocusRetention keeps keyboard focus across c.Sync re-renders
+//
+// Interactive elements need a stable id for focus retention to find them
+// again after a re-render.
+package env
+
+import (
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+)
+
+// visuallyHidden hides content visually but keeps it for screen readers
+const visuallyHidden = "position:absolute;width:1px;height:1px;padding:0;margin:-1px;overflow:hidden;clip:rect(0,0,0,0);white-space:nowrap;border:0"
+
+// AriaLabel returns an aria-label attribute
+func AriaLabel(label string) h.H {
+	return h.Attr("aria-label", label)
+}
+
+// LiveRegion returns a polite live region; screen readers announce its
+// text whenever it changes. Hidden visually unless visible is true.
+func LiveRegion(visible bool, children ...h.H) h.H {
+	attrs := []h.H{h.Role("status"), h.Attr("aria-live", "polite"), h.Attr("aria-atomic", "true")}
+	if !visible {
+		attrs = append(attrs, h.Style(visuallyHidden))
+	}
+	return h.Div(append(attrs, children...)...)
+}
+
+// AlertRegion returns an assertive live region for errors
+func AlertRegion(children ...h.H) h.H {
+	return h.Div(append([]h.H{h.Role("alert"), h.Attr("aria-live", "assertive")}, children...)...)
+}
+
+// RegisterFocusRetention restores focus to the previously focused element
+// (matched by id) after a server-side re-render replaced it
+func RegisterFocusRetention(v *via.V) {
+	v.AppendToFoot(h.Script(h.Raw(focusScript)))
+}
+
+// focusScript remembers the focused element id and refocuses it after DOM patches
+const focusScript = `(() => {
+  let lastId = null;
+  document.addEventListener('focusin', (e) => { lastId = e.target.id || null; });
+  // A focused element that is removed by a patch fires no focusout, so
+  // lastId survives re-renders but is cleared when the user moves away
+  document.addEventListener('focusout', (e) => { if (!e.relatedTarget) lastId = null; });
+  new MutationObserver(() => {
+    if (!lastId || (document.activeElement && document.activeElement !== document.body)) return;
+    const el = document.getElementById(lastId);
+    if (el) el.focus({ preventScroll: true });
+  }).observe(document.body, { childList: true, subtree: true });
+})();`
@@ -0,0 +1,794 @@
+// access.go: Time-limited operator access grants
+//
+// Dashboards and operators on the CLI often need access to the fleet for
+// an afternoon, not forever. The hub mints short-lived credentials with
+// scoped permissions on request:
+//
+//	wellknown-check access grant --user alice --ttl 4h --scope control
+//	wellknown-check access list
+//	wellknown-check access revoke 3f2a9c1e
+//
+// Scopes: read (watch events, read KV and streams), control (read, plus
+// fleet KV writes, fleet and process commands) and admin (no restrictions)
+// are the viewer, operator and admin roles; any role of roles.go can be
+// granted by name. Once roles are bound, the granter's own role must cover
+// the one granted. Granted users get their replies below
+// UserInboxPrefix(user) only, so they connect with that inbox prefix. The
+// credentials depend on the hub's auth mode:
+//
+//	nkey     an NKey seed; the hub accepts the key until the grant ends
+//	jwt      a creds file whose user JWT expires with the grant
+//	callout  a token (grant_<id>_<secret>) checked by the auth callout
+//
+// Grants are kept in the access_grants bucket (the token only as a hash)
+// and every grant, revocation and expiry is recorded in the audit stream
+// (audit.go). The hub revokes grants at expiry: it drops NKeys, and JWTs
+// and callout users expire on the server. A revoked callout token can't
+// reconnect; clients already connected stay until DefaultCalloutExpiry at
+// most.
+//
+// The hub serves requests with mgr.ServeAccessGrants; give the CLI
+// credentials that may publish to access.grant and access.revoke.
+// Requests are signed with the caller's NKey (caller.go), and the granter
+// is the user bound to that key, never a name in the request.
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// AccessBucket holds the active access grants, keyed by grant ID
+const AccessBucket = "access_grants"
+
+// Subjects of the hub's access service
+const (
+	AccessGrantSubject  = "access.grant"
+	AccessRevokeSubject = "access.revoke"
+)
+
+// Access scopes
+const (
+	ScopeRead    = "read"    // Watch and read, e.g. dashboards
+	ScopeControl = "control" // Read, plus KV writes, fleet and process commands
+	ScopeAdmin   = "admin"   // Everything
+)
+
+// Kinds of access credentials
+const (
+	AccessNKey  = "nkey"  // NKey seed (nkey mode)
+	AccessJWT   = "jwt"   // Creds file (jwt mode)
+	AccessToken = "token" // Token checked by the auth callout (callout mode)
+)
+
+const (
+	// DefaultAccessTTL is how long a grant lasts without a TTL
+	DefaultAccessTTL = time.Hour
+	// MaxAccessTTL is the longest grant the hub hands out
+	MaxAccessTTL = 24 * time.Hour
+
+	accessTokenPrefix   = "grant_"
+	accessSweepInterval = 10 * time.Second
+)
+
+// ScopeRole returns the role an access scope grants: read, control and
+// admin are the viewer, operator and admin roles (roles.go), any other
+// scope names a role
+func ScopeRole(scope string) string {
+	switch scope {
+	case ScopeRead:
+		return RoleViewer
+	case ScopeControl:
+		return RoleOperator
+	}
+	return scope
+}
+
+// ScopePermissions returns the permissions of an access scope with the
+// built-in roles
+func ScopePermissions(scope string) (SubjectPermissions, error) {
+	if r, ok := defaultRole(ScopeRole(scope)); ok {
+		return r.Permissions, nil
+	}
+	return SubjectPermissions{}, fmt.Errorf("unknown access scope %q (want %s, %s, %s or a role)", scope, ScopeRead, ScopeControl, ScopeAdmin)
+}
+
+// AccessGrant is an active access grant
+type AccessGrant struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Scope     string    `json:"scope"`
+	Kind      string    `json:"kind"`                 // nkey, jwt or token
+	PublicKey string    `json:"public_key,omitempty"` // User key (nkey, jwt)
+	TokenHash string    `json:"token_hash,omitempty"` // SHA-256 of the token (token)
+	GrantedBy string    `json:"granted_by"`
+	Reason    string    `json:"reason,omitempty"`
+	Granted   time.Time `json:"granted"`
+	Expires   time.Time `json:"expires"`
+
+	Permissions SubjectPermissions `json:"permissions"` // Of the scope's role when granted
+}
+
+// Expired reports whether the grant has ended at now
+func (g AccessGrant) Expired(now time.Time) bool {
+	return !now.Before(g.Expires)
+}
+
+// permissions returns what the grant allows; grants recorded before
+// roles carry no permissions and get their scope's built-in ones
+func (g AccessGrant) permissions() (SubjectPermissions, error) {
+	if len(g.Permissions.Publish) > 0 || len(g.Permissions.Subscribe) > 0 {
+		return g.Permissions, nil
+	}
+	perms, err := ScopePermissions(g.Scope)
+	if err != nil {
+		return SubjectPermissions{}, err
+	}
+	return perms.forUser(g.User), nil
+}
+
+// AccessRequest asks the hub for a grant
+type AccessRequest struct {
+	User   string        `json:"user"`
+	Scope  string        `json:"scope"`
+	TTL    time.Duration `json:"ttl"` // 0 = DefaultAccessTTL
+	Reason string        `json:"reason,omitempty"`
+}
+
+// AccessRevokeRequest asks the hub to end a grant early
+type AccessRevokeRequest struct {
+	ID string `json:"id"`
+}
+
+// AccessReply is the hub's answer
+type AccessReply struct {
+	Grant       *AccessGrant `json:"grant,omitempty"`
+	Credentials string       `json:"credentials,omitempty"` // Seed, creds file or token (grant only)
+	Error       string       `json:"error,omitempty"`
+}
+
+// OpenAccessBucket creates (or opens) the access_grants bucket
+func OpenAccessBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      AccessBucket,
+		Description: "Time-limited access grants for wellnown-env",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening access bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// ListAccessGrants returns the grants, soonest expiry first
+func ListAccessGrants(ctx context.Context, kv jetstream.KeyValue) ([]AccessGrant, error) {
+	list, err := NewTypedKV[AccessGrant](kv).List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Expires.Before(list[j].Expires) })
+	return list, nil
+}
+
+// RequestAccess asks the hub for a grant, signed with the granter's key
+// (caller.go), and returns it with its credentials
+func RequestAccess(ctx context.Context, nc *nats.Conn, req AccessRequest, kp nkeys.KeyPair) (AccessGrant, string, error) {
+	var reply AccessReply
+	if err := accessCall(ctx, nc, AccessGrantSubject, req, kp, &reply); err != nil {
+		return AccessGrant{}, "", err
+	}
+	if reply.Grant == nil {
+		return AccessGrant{}, "", fmt.Errorf("hub returned no grant")
+	}
+	return *reply.Grant, reply.Credentials, nil
+}
+
+// RevokeAccess asks the hub to end grant id now, signed with the
+// revoker's key
+func RevokeAccess(ctx context.Context, nc *nats.Conn, id string, kp nkeys.KeyPair) error {
+	var reply AccessReply
+	return accessCall(ctx, nc, AccessRevokeSubject, AccessRevokeRequest{ID: id}, kp, &reply)
+}
+
+// accessCall sends req, signed with kp, to the hub's access service
+func accessCall(ctx context.Context, nc *nats.Conn, subject string, req any, kp nkeys.KeyPair, reply *AccessReply) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	msg, err := signedRequest(ctx, nc, subject, data, kp)
+	if err != nil {
+		return fmt.Errorf("asking hub (%s): %w", subject, err)
+	}
+	if err := json.Unmarshal(msg.Data, reply); err != nil {
+		return fmt.Errorf("malformed reply from hub: %w", err)
+	}
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+	return nil
+}
+
+// accessIssuer mints and revokes the credentials of one auth mode
+type accessIssuer struct {
+	kind    string
+	mint    func(ctx context.Context, g *AccessGrant, perms SubjectPermissions) (string, error)
+	revoke  func(ctx context.Context, g AccessGrant) error // nil = credentials end on their own
+	restore func(ctx context.Context, g AccessGrant) error // Re-issue an active grant after a restart (nil = none)
+}
+
+// ServeAccessGrants answers access requests on the hub and revokes grants
+// when they expire
+func (m *Manager) ServeAccessGrants() (stop func(), err error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("access grants need NATS")
+	}
+	issuer, err := m.accessIssuer()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	js := m.natsNode.ControlJetStream()
+	kv, err := OpenAccessBucket(ctx, js)
+	if err != nil {
+		return nil, err
+	}
+	if err := CreateAuditStream(ctx, js); err != nil {
+		return nil, err
+	}
+	roles, err := OpenRoleStore(ctx, js)
+	if err != nil {
+		return nil, err
+	}
+	s := newAccessService(kv, issuer, func(ctx context.Context, e AuditEvent) error {
+		return PublishAudit(ctx, js, e)
+	}, m.opts.Logger)
+	s.roles = roles
+	if err := s.start(ctx, m.natsNode.ControlConn()); err != nil {
+		return nil, err
+	}
+	return s.stop, nil
+}
+
+// accessIssuer returns the issuer for the node's auth mode
+func (m *Manager) accessIssuer() (accessIssuer, error) {
+	node := m.natsNode
+	cfg := node.Auth()
+	mode := "none"
+	if cfg != nil {
+		mode = cfg.Mode
+	}
+
+	switch mode {
+	case "nkey":
+		return accessIssuer{
+			kind: AccessNKey,
+			mint: func(ctx context.Context, g *AccessGrant, perms SubjectPermissions) (string, error) {
+				kp, err := auth.GenerateNKeyPair()
+				if err != nil {
+					return "", err
+				}
+				if err := node.AllowServiceNKey(kp.Public, perms); err != nil {
+					return "", err
+				}
+				g.PublicKey = kp.Public
+				return kp.Seed, nil
+			},
+			revoke: func(ctx context.Context, g AccessGrant) error {
+				return node.RevokeServiceNKey(g.PublicKey)
+			},
+			restore: func(ctx context.Context, g AccessGrant) error {
+				perms, err := g.permissions()
+				if err != nil {
+					return err
+				}
+				return node.AllowServiceNKey(g.PublicKey, perms)
+			},
+		}, nil
+
+	case "jwt":
+		acct, err := credsAccount(cfg.CredsDir)
+		if err != nil {
+			return accessIssuer{}, err
+		}
+		return accessIssuer{
+			kind: AccessJWT,
+			mint: func(ctx context.Context, g *AccessGrant, perms SubjectPermissions) (string, error) {
+				kp, err := auth.GenerateNKeyPair()
+				if err != nil {
+					return "", err
+				}
+				uc := jwt.NewUserClaims(kp.Public)
+				uc.Name = "access-" + g.ID
+				perms.UserOption()(uc)
+				uc.Expires = g.Expires.Unix()
+				token, err := acct.SignUser(uc)
+				if err != nil {
+					return "", err
+				}
+				creds, err := jwt.FormatUserConfig(token, []byte(kp.Seed))
+				if err != nil {
+					return "", fmt.Errorf("formatting creds: %w", err)
+				}
+				g.PublicKey = kp.Public
+				return string(creds), nil
+			},
+			revoke: func(ctx context.Context, g AccessGrant) error {
+				if g.Expired(time.Now()) {
+					return nil // The JWT has expired on its own
+				}
+				token, err := acct.Update(func(ac *jwt.AccountClaims) { ac.Revoke(g.PublicKey) })
+				if err != nil {
+					return err
+				}
+				return node.StoreAccounts(map[string]string{acct.PublicKey: token})
+			},
+		}, nil
+
+	case "callout":
+		return accessIssuer{
+			kind: AccessToken,
+			mint: func(ctx context.Context, g *AccessGrant, perms SubjectPermissions) (string, error) {
+				secret, err := auth.GenerateToken()
+				if err != nil {
+					return "", err
+				}
+				g.TokenHash = accessTokenHash(secret)
+				return accessTokenPrefix + g.ID + "_" + secret, nil
+			},
+		}, nil
+	}
+	return accessIssuer{}, fmt.Errorf("access grants need NATS_AUTH=nkey, jwt or callout (got %s)", mode)
+}
+
+// credsAccount returns the account that issued the node's user creds (jwt
+// mode), with its seed from the NSC store
+func credsAccount(credsDir string) (*auth.Account, error) {
+	path := filepath.Join(credsDir, "user.creds")
+	creds, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	token, err := jwt.ParseDecoratedJWT(creds)
+	if err != nil {
+		return nil, fmt.Errorf("parsing user creds: %w", err)
+	}
+	uc, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding user creds: %w", err)
+	}
+	issuer := uc.Issuer
+	if uc.IssuerAccount != "" {
+		issuer = uc.IssuerAccount
+	}
+
+	store, err := auth.DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	op, err := auth.LoadOperator(store, auth.DefaultOperator)
+	if err != nil {
+		return nil, err
+	}
+	names, err := op.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		acct, err := op.Account(name)
+		if err == nil && acct.PublicKey == issuer {
+			return acct, nil
+		}
+	}
+	return nil, fmt.Errorf("account %s of the node creds is not in the NSC store", issuer)
+}
+
+// accessTokenHash returns the stored form of a token secret
+func accessTokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkAccessToken returns the active grant of a grant token
+func checkAccessToken(ctx context.Context, kv jetstream.KeyValue, token string, now time.Time) (AccessGrant, error) {
+	rest, _ := strings.CutPrefix(token, accessTokenPrefix)
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return AccessGrant{}, fmt.Errorf("malformed access token")
+	}
+	g, _, err := NewTypedKV[AccessGrant](kv).Get(ctx, id)
+	if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrInvalidKey) {
+		return AccessGrant{}, fmt.Errorf("unknown or revoked access grant")
+	}
+	if err != nil {
+		return AccessGrant{}, fmt.Errorf("looking up access grant: %w", err)
+	}
+	if g.Kind != AccessToken || subtle.ConstantTimeCompare([]byte(g.TokenHash), []byte(accessTokenHash(secret))) != 1 {
+		return AccessGrant{}, fmt.Errorf("unknown or revoked access grant")
+	}
+	if g.Expired(now) {
+		return AccessGrant{}, fmt.Errorf("access grant %s expired", g.ID)
+	}
+	return g, nil
+}
+
+// accessAuthorizer admits clients presenting a grant token (callout mode)
+// and hands every other client to next
+func (m *Manager) accessAuthorizer(next CalloutAuthorizer) CalloutAuthorizer {
+	return func(ctx context.Context, req *jwt.AuthorizationRequest) (*CalloutGrant, error) {
+		token := req.ConnectOptions.Token
+		if !strings.HasPrefix(token, accessTokenPrefix) {
+			return next(ctx, req)
+		}
+		kv, err := OpenAccessBucket(ctx, m.natsNode.ControlJetStream())
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		g, err := checkAccessToken(ctx, kv, token, now)
+		if err != nil {
+			return nil, err
+		}
+		return accessCalloutGrant(g, now)
+	}
+}
+
+// accessCalloutGrant returns the callout user of an active grant. It ends
+// with the grant, or sooner so that revocations reach connected clients.
+func accessCalloutGrant(g AccessGrant, now time.Time) (*CalloutGrant, error) {
+	perms, err := g.permissions()
+	if err != nil {
+		return nil, err
+	}
+	return &CalloutGrant{
+		Name:        "access-" + g.User,
+		Permissions: perms.jwtPermissions(),
+		Expires:     min(g.Expires.Sub(now), DefaultCalloutExpiry),
+	}, nil
+}
+
+// accessService is the hub side of access grants
+type accessService struct {
+	grants *TypedKV[AccessGrant]
+	kv     jetstream.KeyValue
+	issuer accessIssuer
+	roles  *RoleStore // nil = built-in roles, any granter
+	audit  func(ctx context.Context, e AuditEvent) error
+	logger *slog.Logger
+
+	mu       sync.Mutex // Serializes grants and revocations
+	subs     []*nats.Subscription
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newAccessService returns an access service issuing with issuer
+func newAccessService(kv jetstream.KeyValue, issuer accessIssuer, audit func(ctx context.Context, e AuditEvent) error, logger *slog.Logger) *accessService {
+	return &accessService{
+		grants: NewTypedKV[AccessGrant](kv),
+		kv:     kv,
+		issuer: issuer,
+		audit:  audit,
+		logger: componentLogger(logger, "access"),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// start restores active grants, expires stale ones and serves requests
+func (s *accessService) start(ctx context.Context, nc *nats.Conn) error {
+	if err := s.sweep(ctx, time.Now()); err != nil {
+		return err
+	}
+	if s.issuer.restore != nil {
+		list, err := ListAccessGrants(ctx, s.kv)
+		if err != nil {
+			return err
+		}
+		for _, g := range list {
+			if g.Kind != s.issuer.kind {
+				continue
+			}
+			if err := s.issuer.restore(ctx, g); err != nil {
+				return fmt.Errorf("restoring access grant %s: %w", g.ID, err)
+			}
+		}
+	}
+
+	for subject, handle := range map[string]func(*nats.Msg){
+		AccessGrantSubject:  s.handleGrant,
+		AccessRevokeSubject: s.handleRevoke,
+	} {
+		sub, err := nc.Subscribe(subject, handle)
+		if err != nil {
+			s.unsubscribe()
+			return fmt.Errorf("subscribing to %s: %w", subject, err)
+		}
+		s.subs = append(s.subs, sub)
+	}
+
+	go s.run()
+	return nil
+}
+
+// handleGrant answers one grant request
+func (s *accessService) handleGrant(msg *nats.Msg) {
+	var reply AccessReply
+	var req AccessRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		reply.Error = "malformed access request"
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		now := time.Now()
+		caller, err := requestCaller(ctx, s.roles, msg, now)
+		var g AccessGrant
+		var creds string
+		if err == nil {
+			g, creds, err = s.grant(ctx, req, caller, now)
+		}
+		cancel()
+		if err != nil {
+			reply.Error = err.Error()
+			s.logger.Warn("access request refused", "user", req.User, "by", caller.name(), "error", err)
+		} else {
+			reply.Grant, reply.Credentials = &g, creds
+		}
+	}
+	data, _ := json.Marshal(reply)
+	_ = msg.Respond(data)
+}
+
+// handleRevoke answers one revoke request
+func (s *accessService) handleRevoke(msg *nats.Msg) {
+	var reply AccessReply
+	var req AccessRevokeRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		reply.Error = "malformed revoke request"
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		caller, err := requestCaller(ctx, s.roles, msg, time.Now())
+		if err == nil {
+			err = s.mayRevoke(ctx, caller)
+		}
+		if err == nil {
+			err = s.revoke(ctx, req.ID, caller.name(), "access.revoked")
+		}
+		cancel()
+		if err != nil {
+			reply.Error = err.Error()
+		}
+	}
+	data, _ := json.Marshal(reply)
+	_ = msg.Respond(data)
+}
+
+// grant mints the credentials of req for caller, who signed it, and
+// records the grant
+func (s *accessService) grant(ctx context.Context, req AccessRequest, caller RoleBinding, now time.Time) (AccessGrant, string, error) {
+	if req.User == "" || strings.ContainsAny(req.User, ".*> ") {
+		return AccessGrant{}, "", fmt.Errorf("invalid user %q", req.User)
+	}
+	if caller.PublicKey == "" {
+		return AccessGrant{}, "", ErrUnsigned
+	}
+	perms, err := s.scopePermissions(ctx, req.Scope, caller)
+	if err != nil {
+		return AccessGrant{}, "", err
+	}
+	perms = perms.forUser(req.User)
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = DefaultAccessTTL
+	}
+	if ttl < 0 || ttl > MaxAccessTTL {
+		return AccessGrant{}, "", fmt.Errorf("access ttl must be between 0 and %s", MaxAccessTTL)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := AccessGrant{
+		ID:        uuid.New().String()[:8],
+		User:      req.User,
+		Scope:     req.Scope,
+		Kind:      s.issuer.kind,
+		GrantedBy: caller.name(),
+		Reason:    req.Reason,
+		Granted:   now.UTC(),
+		Expires:   now.Add(ttl).UTC(),
+
+		Permissions: perms,
+	}
+	creds, err := s.issuer.mint(ctx, &g, perms)
+	if err != nil {
+		return AccessGrant{}, "", fmt.Errorf("minting credentials: %w", err)
+	}
+	if _, err := s.grants.Put(ctx, g.ID, g); err != nil {
+		if s.issuer.revoke != nil {
+			_ = s.issuer.revoke(ctx, g)
+		}
+		return AccessGrant{}, "", fmt.Errorf("recording access grant: %w", err)
+	}
+
+	s.record(ctx, AuditEvent{Action: "access.granted", Actor: g.GrantedBy, Target: g.User, Details: g.auditDetails()})
+	s.logger.Info("access granted", "id", g.ID, "user", g.User, "scope", g.Scope, "by", g.GrantedBy, "expires", g.Expires)
+	return g, creds, nil
+}
+
+// scopePermissions returns the permissions of scope's role. Once roles are
+// bound, only callers whose own role may operate and covers that role can
+// grant it.
+func (s *accessService) scopePermissions(ctx context.Context, scope string, caller RoleBinding) (SubjectPermissions, error) {
+	if s.roles == nil {
+		return ScopePermissions(scope)
+	}
+	role, err := s.roles.Role(ctx, ScopeRole(scope))
+	if err != nil {
+		return SubjectPermissions{}, fmt.Errorf("access scope %q: %w", scope, err)
+	}
+	bindings, err := s.roles.Bindings(ctx)
+	if err != nil {
+		return SubjectPermissions{}, err
+	}
+	if len(bindings) == 0 {
+		return role.Permissions, nil // Roles not in use yet
+	}
+	own, err := s.callerRole(ctx, caller)
+	if err != nil {
+		return SubjectPermissions{}, fmt.Errorf("%s may not grant access: %w", caller.name(), err)
+	}
+	if !own.Can(CapOperate) || !own.Covers(role) {
+		return SubjectPermissions{}, fmt.Errorf("%s (%s) may not grant %s", caller.name(), own.Name, role.Name)
+	}
+	return role.Permissions, nil
+}
+
+// callerRole returns the role of caller (ErrNoRole if its key is unbound)
+func (s *accessService) callerRole(ctx context.Context, caller RoleBinding) (Role, error) {
+	if caller.User == "" {
+		return Role{}, ErrNoRole
+	}
+	return s.roles.Role(ctx, caller.Role)
+}
+
+// mayRevoke checks that caller may end grants: once roles are bound, its
+// role must be able to operate
+func (s *accessService) mayRevoke(ctx context.Context, caller RoleBinding) error {
+	if s.roles == nil {
+		return nil
+	}
+	bindings, err := s.roles.Bindings(ctx)
+	if err != nil || len(bindings) == 0 {
+		return err
+	}
+	own, err := s.callerRole(ctx, caller)
+	if err != nil {
+		return fmt.Errorf("%s may not revoke access: %w", caller.name(), err)
+	}
+	if !own.Can(CapOperate) {
+		return fmt.Errorf("%s (%s) may not revoke access", caller.name(), own.Name)
+	}
+	return nil
+}
+
+// revoke ends grant id and records action (access.revoked or
+// access.expired)
+func (s *accessService) revoke(ctx context.Context, id, by, action string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, _, err := s.grants.Get(ctx, id)
+	if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrInvalidKey) {
+		return fmt.Errorf("no access grant %s", id)
+	}
+	if err != nil {
+		return err
+	}
+	if s.issuer.revoke != nil && g.Kind == s.issuer.kind {
+		if err := s.issuer.revoke(ctx, g); err != nil {
+			return fmt.Errorf("revoking access grant %s: %w", id, err)
+		}
+	}
+	if err := s.kv.Delete(ctx, id); err != nil {
+		return fmt.Errorf("removing access grant %s: %w", id, err)
+	}
+
+	s.record(ctx, AuditEvent{Action: action, Actor: by, Target: g.User, Details: g.auditDetails()})
+	s.logger.Info(strings.ReplaceAll(action, ".", " "), "id", g.ID, "user", g.User, "by", by)
+	return nil
+}
+
+// record publishes an audit event; failures are logged, as the grant or
+// revocation already happened
+func (s *accessService) record(ctx context.Context, e AuditEvent) {
+	if err := s.audit(ctx, e); err != nil {
+		s.logger.Warn("recording audit event failed", "action", e.Action, "error", err)
+	}
+}
+
+// auditDetails describes the grant in audit events
+func (g AccessGrant) auditDetails() map[string]string {
+	details := map[string]string{
+		"id":      g.ID,
+		"scope":   g.Scope,
+		"kind":    g.Kind,
+		"expires": g.Expires.Format(time.RFC3339),
+	}
+	if g.Reason != "" {
+		details["reason"] = g.Reason
+	}
+	return details
+}
+
+// run revokes expired grants on every tick
+func (s *accessService) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(accessSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := s.sweep(ctx, time.Now()); err != nil {
+				s.logger.Warn("access sweep failed", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// sweep revokes the grants that have expired at now
+func (s *accessService) sweep(ctx context.Context, now time.Time) error {
+	list, err := ListAccessGrants(ctx, s.kv)
+	if err != nil {
+		return err
+	}
+	for _, g := range list {
+		if !g.Expired(now) {
+			break // Sorted by expiry
+		}
+		if err := s.revoke(ctx, g.ID, "expiry", "access.expired"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unsubscribe stops serving requests
+func (s *accessService) unsubscribe() {
+	for _, sub := range s.subs {
+		sub.Unsubscribe()
+	}
+}
+
+// stop stops serving requests and sweeping
+func (s *accessService) stop() {
+	s.stopOnce.Do(func() {
+		s.unsubscribe()
+		close(s.stopCh)
+		<-s.done
+	})
+}
@@ -0,0 +1,148 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopePermissions(t *testing.T) {
+	read, err := ScopePermissions(ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, err := ScopePermissions(ScopeControl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := "$KV." + NodeTagsBucket + ".>"
+	if slices.Contains(read.Publish, tags) || slices.Contains(read.Publish, FleetSubject) {
+		t.Errorf("read scope may write: %v", read.Publish)
+	}
+	for _, subject := range append([]string{tags, FleetSubject}, read.Publish...) {
+		if !slices.Contains(control.Publish, subject) {
+			t.Errorf("control scope lacks %s", subject)
+		}
+	}
+	if _, err := ScopePermissions("root"); err == nil {
+		t.Error("ScopePermissions(root) succeeded, want error")
+	}
+}
+
+// newTestAccessService returns an access service issuing tokens, with
+// the keys it revoked and the audit actions it recorded
+func newTestAccessService() (*accessService, *memKV, *[]string, *[]string) {
+	kv := newMemKV()
+	var revoked, actions []string
+	issuer := accessIssuer{
+		kind: AccessToken,
+		mint: func(ctx context.Context, g *AccessGrant, perms SubjectPermissions) (string, error) {
+			g.TokenHash = accessTokenHash("secret-" + g.ID)
+			return accessTokenPrefix + g.ID + "_secret-" + g.ID, nil
+		},
+		revoke: func(ctx context.Context, g AccessGrant) error {
+			revoked = append(revoked, g.ID)
+			return nil
+		},
+	}
+	s := newAccessService(kv, issuer, func(ctx context.Context, e AuditEvent) error {
+		actions = append(actions, e.Action+" "+e.Target+" by "+e.Actor)
+		return nil
+	}, nil)
+	return s, kv, &revoked, &actions
+}
+
+// testBob is a caller with a bound key, as requestCaller returns it
+var testBob = RoleBinding{User: "bob", Role: RoleOperator, PublicKey: "UBOB"}
+
+func TestAccessGrantLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s, kv, revoked, actions := newTestAccessService()
+	now := time.Now()
+
+	g, token, err := s.grant(ctx, AccessRequest{User: "alice", Scope: ScopeControl, TTL: 4 * time.Hour}, testBob, now)
+	if err != nil {
+		t.Fatalf("grant() error = %v", err)
+	}
+	short, _, err := s.grant(ctx, AccessRequest{User: "carol", Scope: ScopeRead, TTL: time.Minute}, testBob, now)
+	if err != nil {
+		t.Fatalf("grant() error = %v", err)
+	}
+	if !g.Expires.Equal(now.Add(4 * time.Hour).UTC()) {
+		t.Errorf("Expires = %v, want now+4h", g.Expires)
+	}
+
+	got, err := checkAccessToken(ctx, kv, token, now)
+	if err != nil || got.User != "alice" {
+		t.Fatalf("checkAccessToken() = %+v, %v; want alice's grant", got, err)
+	}
+	if _, err := checkAccessToken(ctx, kv, accessTokenPrefix+g.ID+"_wrong", now); err == nil {
+		t.Error("checkAccessToken() accepted a wrong secret")
+	}
+	if _, err := checkAccessToken(ctx, kv, token, now.Add(5*time.Hour)); err == nil {
+		t.Error("checkAccessToken() accepted an expired grant")
+	}
+
+	// The short grant expires, alice's stays
+	if err := s.sweep(ctx, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("sweep() error = %v", err)
+	}
+	if err := s.revoke(ctx, g.ID, "bob", "access.revoked"); err != nil {
+		t.Fatalf("revoke() error = %v", err)
+	}
+	if _, err := checkAccessToken(ctx, kv, token, now); err == nil {
+		t.Error("checkAccessToken() accepted a revoked grant")
+	}
+
+	if want := []string{short.ID, g.ID}; !slices.Equal(*revoked, want) {
+		t.Errorf("revoked = %v, want %v", *revoked, want)
+	}
+	want := []string{
+		"access.granted alice by bob",
+		"access.granted carol by bob",
+		"access.expired carol by expiry",
+		"access.revoked alice by bob",
+	}
+	if !slices.Equal(*actions, want) {
+		t.Errorf("audit = %v, want %v", *actions, want)
+	}
+}
+
+func TestAccessGrantRefused(t *testing.T) {
+	s, _, _, _ := newTestAccessService()
+	for _, req := range []AccessRequest{
+		{User: "a.b", Scope: ScopeRead},                          // Subject characters
+		{User: "alice", Scope: "root"},                           // Unknown scope
+		{User: "alice", Scope: ScopeRead, TTL: MaxAccessTTL + 1}, // Too long
+	} {
+		if _, _, err := s.grant(context.Background(), req, testBob, time.Now()); err == nil {
+			t.Errorf("grant(%+v) succeeded, want error", req)
+		}
+	}
+	if _, _, err := s.grant(context.Background(), AccessRequest{User: "alice", Scope: ScopeRead}, RoleBinding{}, time.Now()); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("grant() without a caller error = %v, want ErrUnsigned", err)
+	}
+}
+
+func TestAccessCalloutGrant(t *testing.T) {
+	now := time.Now()
+	g := AccessGrant{User: "alice", Scope: ScopeRead, Expires: now.Add(4 * time.Hour)}
+	grant, err := accessCalloutGrant(g, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.Expires != DefaultCalloutExpiry {
+		t.Errorf("Expires = %v, want capped at %v", grant.Expires, DefaultCalloutExpiry)
+	}
+	if !strings.Contains(grant.Name, "alice") || len(grant.Permissions.Pub.Allow) == 0 {
+		t.Errorf("grant = %+v, want alice with read permissions", grant)
+	}
+
+	g.Expires = now.Add(time.Minute)
+	if grant, _ := accessCalloutGrant(g, now); grant.Expires != time.Minute {
+		t.Errorf("Expires = %v, want the rest of the grant", grant.Expires)
+	}
+}
@@ -0,0 +1,489 @@
+// admin.go: Hub admin API over NATS micro
+//
+// The hub serves its operations as the NATS micro service wellknown-admin,
+// so dashboards and CLIs inspect it with plain requests instead of
+// shelling out to task:
+//
+//	nats req wellknown.admin.services ''
+//	nats req wellknown.admin.buckets ''
+//	nats req wellknown.admin.streams ''
+//
+//	services, err := env.AdminListServices(ctx, nc)
+//	keys, err := env.AdminPurge(ctx, nc, env.AdminRegistryRequest{Key: "acme.orders.a1b2"}, kp)
+//
+// services, buckets and streams only read. purge removes registrations
+// with their history from services_registry and services_static; expire
+// deletes them from services_registry as if their TTL had run out (an
+// instance that is still alive registers again on its next heartbeat).
+// Both are recorded in the audit stream.
+//
+// Reads follow the client's subject permissions (the viewer role may
+// read, see roles.go). Purge and expire are refused without auth, and
+// otherwise only served to callers that sign the request with their NKey
+// (caller.go) and are bound to a role that may administer. The audit
+// records that user, whatever the request says.
+//
+// The hub serves it with mgr.ServeAdmin (nats-node: ADMIN_API=true).
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nkeys"
+)
+
+// Subjects of the hub's admin service
+const (
+	AdminSubject         = "wellknown.admin"
+	AdminServicesSubject = AdminSubject + ".services"
+	AdminBucketsSubject  = AdminSubject + ".buckets"
+	AdminStreamsSubject  = AdminSubject + ".streams"
+	AdminPurgeSubject    = AdminSubject + ".purge"
+	AdminExpireSubject   = AdminSubject + ".expire"
+)
+
+// AdminServiceName and AdminAPIVersion identify the admin micro service
+const (
+	AdminServiceName = "wellknown-admin"
+	AdminAPIVersion  = "1.0.0"
+)
+
+// AdminService is a registration listed by the admin API
+type AdminService struct {
+	Bucket       string                       `json:"bucket"` // services_registry or services_static
+	Key          string                       `json:"key"`
+	Registration registry.ServiceRegistration `json:"registration"`
+}
+
+// BucketStats describes a KV bucket
+type BucketStats struct {
+	Bucket  string        `json:"bucket"`
+	Values  uint64        `json:"values"`
+	Bytes   uint64        `json:"bytes"`
+	History int64         `json:"history"`
+	TTL     time.Duration `json:"ttl,omitempty"`
+}
+
+// StreamStats describes a stream
+type StreamStats struct {
+	Name      string    `json:"name"`
+	Subjects  []string  `json:"subjects,omitempty"`
+	Msgs      uint64    `json:"msgs"`
+	Bytes     uint64    `json:"bytes"`
+	Consumers int       `json:"consumers"`
+	FirstSeq  uint64    `json:"first_seq"`
+	LastSeq   uint64    `json:"last_seq"`
+	LastTime  time.Time `json:"last_time,omitzero"`
+}
+
+// AdminRegistryRequest selects registrations to purge or expire: one
+// instance by key, or every instance of a service
+type AdminRegistryRequest struct {
+	Key     string `json:"key,omitempty"`     // org.repo.instance
+	Service string `json:"service,omitempty"` // org/repo
+}
+
+// AdminListServices returns the registrations on the hub
+func AdminListServices(ctx context.Context, nc *nats.Conn) ([]AdminService, error) {
+	var services []AdminService
+	return services, adminCall(ctx, nc, AdminServicesSubject, nil, nil, &services)
+}
+
+// AdminBucketStats returns the stats of the hub's KV buckets
+func AdminBucketStats(ctx context.Context, nc *nats.Conn) ([]BucketStats, error) {
+	var stats []BucketStats
+	return stats, adminCall(ctx, nc, AdminBucketsSubject, nil, nil, &stats)
+}
+
+// AdminStreamStats returns the stats of the hub's streams
+func AdminStreamStats(ctx context.Context, nc *nats.Conn) ([]StreamStats, error) {
+	var stats []StreamStats
+	return stats, adminCall(ctx, nc, AdminStreamsSubject, nil, nil, &stats)
+}
+
+// AdminPurge removes registrations and their history, returning the keys.
+// The request is signed with the caller's key kp.
+func AdminPurge(ctx context.Context, nc *nats.Conn, req AdminRegistryRequest, kp nkeys.KeyPair) ([]string, error) {
+	var keys []string
+	return keys, adminCall(ctx, nc, AdminPurgeSubject, req, kp, &keys)
+}
+
+// AdminExpire deletes registrations from services_registry, returning the
+// keys. The request is signed with the caller's key kp.
+func AdminExpire(ctx context.Context, nc *nats.Conn, req AdminRegistryRequest, kp nkeys.KeyPair) ([]string, error) {
+	var keys []string
+	return keys, adminCall(ctx, nc, AdminExpireSubject, req, kp, &keys)
+}
+
+// adminCall sends req (nil = empty body) to the hub's admin service,
+// signed with kp unless it is nil
+func adminCall(ctx context.Context, nc *nats.Conn, subject string, req any, kp nkeys.KeyPair, reply any) error {
+	var data []byte
+	if req != nil {
+		var err error
+		if data, err = json.Marshal(req); err != nil {
+			return err
+		}
+	}
+	var msg *nats.Msg
+	var err error
+	if kp != nil {
+		msg, err = signedRequest(ctx, nc, subject, data, kp)
+	} else {
+		msg, err = nc.RequestWithContext(ctx, subject, data)
+	}
+	if err != nil {
+		return fmt.Errorf("asking hub (%s): %w", subject, err)
+	}
+	if desc := msg.Header.Get(micro.ErrorHeader); desc != "" {
+		return errors.New(desc)
+	}
+	if err := json.Unmarshal(msg.Data, reply); err != nil {
+		return fmt.Errorf("malformed reply from hub: %w", err)
+	}
+	return nil
+}
+
+// ServeAdmin serves the admin API on the hub. Purge and expire are only
+// served when the hub requires auth, to callers whose role may
+// administer.
+func (m *Manager) ServeAdmin() (stop func(), err error) {
+	if m.natsNode == nil || m.KV() == nil {
+		return nil, fmt.Errorf("admin API needs NATS")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	js := m.natsNode.ControlJetStream()
+	if err := CreateAuditStream(ctx, js); err != nil {
+		return nil, err
+	}
+	roles, err := OpenRoleStore(ctx, js)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := "none"
+	if cfg := m.natsNode.Auth(); cfg != nil {
+		mode = cfg.Mode
+	}
+	s := &adminService{
+		registry: m.KV(),
+		static:   m.StaticKV(),
+		js:       js,
+		writes:   adminWrites(mode),
+		roles:    roles,
+		audit: func(ctx context.Context, e AuditEvent) error {
+			return PublishAudit(ctx, js, e)
+		},
+		logger: componentLogger(m.opts.Logger, "admin"),
+	}
+	svc, err := s.start(m.natsNode.ControlConn())
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = svc.Stop() }, nil
+}
+
+// adminWrites reports whether auth mode lets clients purge and expire
+func adminWrites(mode string) bool {
+	return mode != "" && mode != "none"
+}
+
+// adminService answers the admin endpoints
+type adminService struct {
+	registry jetstream.KeyValue
+	static   jetstream.KeyValue // nil = no services_static
+	js       jetstream.JetStream
+	writes   bool // Purge and expire allowed
+	roles    *RoleStore
+	audit    func(ctx context.Context, e AuditEvent) error
+	logger   *slog.Logger
+}
+
+// start adds the micro service and its endpoints to nc
+func (s *adminService) start(nc *nats.Conn) (micro.Service, error) {
+	svc, err := micro.AddService(nc, micro.Config{
+		Name:        AdminServiceName,
+		Version:     AdminAPIVersion,
+		Description: "wellnown-env hub admin API",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("adding admin service: %w", err)
+	}
+
+	group := svc.AddGroup(AdminSubject)
+	for name, handle := range map[string]func(ctx context.Context, msg *nats.Msg) (any, error){
+		"services": func(ctx context.Context, _ *nats.Msg) (any, error) { return s.services(ctx) },
+		"buckets":  func(ctx context.Context, _ *nats.Msg) (any, error) { return s.buckets(ctx) },
+		"streams":  func(ctx context.Context, _ *nats.Msg) (any, error) { return s.streams(ctx) },
+		"purge":    s.handleRegistry(s.purge),
+		"expire":   s.handleRegistry(s.expire),
+	} {
+		if err := group.AddEndpoint(name, s.handler(name, handle)); err != nil {
+			_ = svc.Stop()
+			return nil, fmt.Errorf("adding admin endpoint %s: %w", name, err)
+		}
+	}
+	return svc, nil
+}
+
+// handler answers requests with the JSON result of handle, or a micro
+// error. handle gets the request as a message, to check its signature.
+func (s *adminService) handler(name string, handle func(ctx context.Context, msg *nats.Msg) (any, error)) micro.Handler {
+	return micro.HandlerFunc(func(req micro.Request) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		msg := &nats.Msg{Subject: req.Subject(), Reply: req.Reply(), Header: nats.Header(req.Headers()), Data: req.Data()}
+		result, err := handle(ctx, msg)
+		if err != nil {
+			s.logger.Warn("admin request failed", "endpoint", name, "error", err)
+			_ = req.Error(adminErrorCode(err), err.Error(), nil)
+			return
+		}
+		_ = req.RespondJSON(result)
+	})
+}
+
+// errAdminRefused is returned for requests the service won't serve
+var errAdminRefused = errors.New("refused")
+
+// adminErrorCode is the micro error code of err
+func adminErrorCode(err error) string {
+	if errors.Is(err, errAdminRefused) {
+		return "403"
+	}
+	return "500"
+}
+
+// handleRegistry decodes an AdminRegistryRequest for op, which runs for
+// the caller that signed it
+func (s *adminService) handleRegistry(op func(ctx context.Context, req AdminRegistryRequest, caller RoleBinding) ([]string, error)) func(ctx context.Context, msg *nats.Msg) (any, error) {
+	return func(ctx context.Context, msg *nats.Msg) (any, error) {
+		var req AdminRegistryRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return nil, fmt.Errorf("%w: malformed admin request", errAdminRefused)
+		}
+		caller, err := requestCaller(ctx, s.roles, msg, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errAdminRefused, err)
+		}
+		return op(ctx, req, caller)
+	}
+}
+
+// services lists the registrations of both registry buckets
+func (s *adminService) services(ctx context.Context) ([]AdminService, error) {
+	var services []AdminService
+	for _, b := range s.registryBuckets() {
+		keys, err := adminKeys(ctx, b.kv)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			entry, err := b.kv.Get(ctx, key)
+			if errors.Is(err, jetstream.ErrKeyNotFound) {
+				continue // Expired meanwhile
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", key, err)
+			}
+			reg, err := decodeRegistration(entry.Value())
+			if err != nil {
+				s.logger.Warn("skipping undecodable registration", "key", key, "error", err)
+				continue
+			}
+			services = append(services, AdminService{Bucket: b.name, Key: key, Registration: reg})
+		}
+	}
+	return services, nil
+}
+
+// registryBucket is an open registry bucket and its name
+type registryBucket struct {
+	name string
+	kv   jetstream.KeyValue
+}
+
+// registryBuckets returns services_registry, and services_static if open
+func (s *adminService) registryBuckets() []registryBucket {
+	buckets := []registryBucket{{RegistryBucket, s.registry}}
+	if s.static != nil {
+		buckets = append(buckets, registryBucket{StaticRegistryBucket, s.static})
+	}
+	return buckets
+}
+
+// buckets returns the stats of every KV bucket
+func (s *adminService) buckets(ctx context.Context) ([]BucketStats, error) {
+	lister := s.js.KeyValueStores(ctx)
+	var stats []BucketStats
+	for st := range lister.Status() {
+		stats = append(stats, BucketStats{
+			Bucket:  st.Bucket(),
+			Values:  st.Values(),
+			Bytes:   st.Bytes(),
+			History: st.History(),
+			TTL:     st.TTL(),
+		})
+	}
+	if err := lister.Error(); err != nil {
+		return nil, fmt.Errorf("listing KV buckets: %w", err)
+	}
+	slices.SortFunc(stats, func(a, b BucketStats) int { return strings.Compare(a.Bucket, b.Bucket) })
+	return stats, nil
+}
+
+// streams returns the stats of every stream
+func (s *adminService) streams(ctx context.Context) ([]StreamStats, error) {
+	lister := s.js.ListStreams(ctx)
+	var stats []StreamStats
+	for info := range lister.Info() {
+		stats = append(stats, StreamStats{
+			Name:      info.Config.Name,
+			Subjects:  info.Config.Subjects,
+			Msgs:      info.State.Msgs,
+			Bytes:     info.State.Bytes,
+			Consumers: info.State.Consumers,
+			FirstSeq:  info.State.FirstSeq,
+			LastSeq:   info.State.LastSeq,
+			LastTime:  info.State.LastTime,
+		})
+	}
+	if err := lister.Err(); err != nil {
+		return nil, fmt.Errorf("listing streams: %w", err)
+	}
+	slices.SortFunc(stats, func(a, b StreamStats) int { return strings.Compare(a.Name, b.Name) })
+	return stats, nil
+}
+
+// purge removes the registrations req selects, with their history, from
+// both registry buckets
+func (s *adminService) purge(ctx context.Context, req AdminRegistryRequest, caller RoleBinding) ([]string, error) {
+	pattern, err := s.checkRegistry(ctx, req, caller)
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	for _, b := range s.registryBuckets() {
+		keys, err := matchingKeys(ctx, b.kv, pattern)
+		if err != nil {
+			return purged, err
+		}
+		for _, key := range keys {
+			if err := b.kv.Purge(ctx, key); err != nil {
+				return purged, fmt.Errorf("purging %s: %w", key, err)
+			}
+			purged = append(purged, key)
+			s.record(ctx, AuditEvent{Action: "admin.purged", Actor: caller.User, Target: key})
+		}
+	}
+	s.logger.Info("registrations purged", "keys", purged, "by", caller.User)
+	return purged, nil
+}
+
+// expire deletes the registrations req selects from services_registry
+func (s *adminService) expire(ctx context.Context, req AdminRegistryRequest, caller RoleBinding) ([]string, error) {
+	pattern, err := s.checkRegistry(ctx, req, caller)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := matchingKeys(ctx, s.registry, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for _, key := range keys {
+		if err := s.registry.Delete(ctx, key); err != nil {
+			return expired, fmt.Errorf("expiring %s: %w", key, err)
+		}
+		expired = append(expired, key)
+		s.record(ctx, AuditEvent{Action: "admin.expired", Actor: caller.User, Target: key})
+	}
+	s.logger.Info("registrations expired", "keys", expired, "by", caller.User)
+	return expired, nil
+}
+
+// checkRegistry refuses writes without auth or by callers who may not
+// administer, and returns the key pattern req selects
+func (s *adminService) checkRegistry(ctx context.Context, req AdminRegistryRequest, caller RoleBinding) (string, error) {
+	if !s.writes {
+		return "", fmt.Errorf("%w: purge and expire need NATS auth (token, nkey, jwt or callout)", errAdminRefused)
+	}
+	if err := s.checkCaller(ctx, caller); err != nil {
+		return "", err
+	}
+	switch {
+	case (req.Key == "") == (req.Service == ""):
+		return "", fmt.Errorf("%w: admin request needs a key or a service", errAdminRefused)
+	case req.Key != "":
+		if strings.ContainsAny(req.Key, "*> ") || strings.Count(req.Key, ".") != 2 {
+			return "", fmt.Errorf("%w: invalid registration key %q", errAdminRefused, req.Key)
+		}
+		return req.Key, nil
+	}
+	pattern, err := servicePattern(req.Service)
+	if err != nil || strings.ContainsAny(req.Service, ".*> ") {
+		return "", fmt.Errorf("%w: invalid service %q", errAdminRefused, req.Service)
+	}
+	return pattern, nil
+}
+
+// checkCaller refuses callers that are not bound to a role that may
+// administer
+func (s *adminService) checkCaller(ctx context.Context, caller RoleBinding) error {
+	if caller.PublicKey == "" {
+		return fmt.Errorf("%w: %v", errAdminRefused, ErrUnsigned)
+	}
+	if caller.User == "" || s.roles == nil {
+		return fmt.Errorf("%w: %s has no role", errAdminRefused, caller.PublicKey)
+	}
+	role, err := s.roles.Role(ctx, caller.Role)
+	if err != nil {
+		return err
+	}
+	if !role.Can(CapAdminister) {
+		return fmt.Errorf("%w: %s (%s) may not purge or expire", errAdminRefused, caller.User, role.Name)
+	}
+	return nil
+}
+
+// record publishes an audit event; failures are logged, as the change
+// already happened
+func (s *adminService) record(ctx context.Context, e AuditEvent) {
+	if err := s.audit(ctx, e); err != nil {
+		s.logger.Warn("recording audit event failed", "action", e.Action, "error", err)
+	}
+}
+
+// matchingKeys returns the sorted keys of kv matching pattern
+func matchingKeys(ctx context.Context, kv jetstream.KeyValue, pattern string) ([]string, error) {
+	keys, err := adminKeys(ctx, kv)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(keys, func(k string) bool { return !matchKey(pattern, k) }), nil
+}
+
+// adminKeys returns the sorted keys of kv (none for an empty bucket)
+func adminKeys(ctx context.Context, kv jetstream.KeyValue) ([]string, error) {
+	keys, err := kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %w", err)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
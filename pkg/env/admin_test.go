@@ -0,0 +1,190 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nkeys"
+)
+
+// Callers of the admin tests, as requestCaller returns them
+var (
+	testAdmin    = RoleBinding{User: "alice", Role: RoleAdmin, PublicKey: "UALICE"}
+	testOperator = RoleBinding{User: "bob", Role: RoleOperator, PublicKey: "UBOB"}
+)
+
+// newTestAdminService returns an admin service over in-memory registry
+// buckets, with the audit actions it recorded
+func newTestAdminService(writes bool) (*adminService, *memKV, *memKV, *[]string) {
+	registry, static := newMemKV(), newMemKV()
+	var actions []string
+	s := &adminService{
+		registry: registry,
+		static:   static,
+		writes:   writes,
+		roles:    NewRoleStore(newMemKV()),
+		audit: func(ctx context.Context, e AuditEvent) error {
+			actions = append(actions, e.Action+" "+e.Target+" by "+e.Actor)
+			return nil
+		},
+		logger: componentLogger(nil, "admin"),
+	}
+	for _, key := range []string{"acme.orders.a", "acme.orders.b", "acme.stock.c"} {
+		_, _ = registry.Put(context.Background(), key, []byte(`{"version":2,"github":{"org":"acme","repo":"x"},"instance":{"id":"x"}}`))
+	}
+	_, _ = static.Put(context.Background(), "acme.orders.d", []byte(`{"version":2,"github":{"org":"acme","repo":"orders"},"instance":{"id":"d"}}`))
+	return s, registry, static, &actions
+}
+
+func TestAdminServices(t *testing.T) {
+	s, registry, _, _ := newTestAdminService(false)
+	registry.values["acme.broken.e"] = []byte("not json")
+
+	services, err := s.services(context.Background())
+	if err != nil {
+		t.Fatalf("services() error = %v", err)
+	}
+	var got []string
+	for _, svc := range services {
+		got = append(got, svc.Bucket+" "+svc.Key)
+	}
+	want := []string{
+		"services_registry acme.orders.a",
+		"services_registry acme.orders.b",
+		"services_registry acme.stock.c",
+		"services_static acme.orders.d",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("services() = %v, want %v", got, want)
+	}
+}
+
+func TestAdminPurgeAndExpire(t *testing.T) {
+	ctx := context.Background()
+	s, registry, static, actions := newTestAdminService(true)
+
+	expired, err := s.expire(ctx, AdminRegistryRequest{Service: "acme/orders"}, testAdmin)
+	if err != nil {
+		t.Fatalf("expire() error = %v", err)
+	}
+	if want := []string{"acme.orders.a", "acme.orders.b"}; !slices.Equal(expired, want) {
+		t.Errorf("expire() = %v, want %v", expired, want)
+	}
+	if _, ok := static.values["acme.orders.d"]; !ok {
+		t.Error("expire() removed a services_static entry")
+	}
+
+	admin2 := RoleBinding{User: "carol", Role: RoleAdmin, PublicKey: "UCAROL"}
+	purged, err := s.purge(ctx, AdminRegistryRequest{Key: "acme.orders.d"}, admin2)
+	if err != nil {
+		t.Fatalf("purge() error = %v", err)
+	}
+	if want := []string{"acme.orders.d"}; !slices.Equal(purged, want) {
+		t.Errorf("purge() = %v, want %v", purged, want)
+	}
+	if len(registry.values) != 1 || len(static.values) != 0 {
+		t.Errorf("left %d registrations and %d static, want 1 and 0", len(registry.values), len(static.values))
+	}
+
+	want := []string{
+		"admin.expired acme.orders.a by alice",
+		"admin.expired acme.orders.b by alice",
+		"admin.purged acme.orders.d by carol",
+	}
+	if !slices.Equal(*actions, want) {
+		t.Errorf("audit = %v, want %v", *actions, want)
+	}
+}
+
+func TestAdminRefused(t *testing.T) {
+	ctx := context.Background()
+	s, _, _, _ := newTestAdminService(true)
+	for _, req := range []AdminRegistryRequest{
+		{}, // Nothing selected
+		{Key: "acme.orders.a", Service: "acme/orders"}, // Both
+		{Key: "acme.orders.*"},                         // Wildcard
+		{Service: "acme"},                              // Not org/repo
+		{Service: "acme/>"},                            // Wildcard
+	} {
+		if _, err := s.purge(ctx, req, testAdmin); !errors.Is(err, errAdminRefused) {
+			t.Errorf("purge(%+v) error = %v, want refused", req, err)
+		}
+	}
+
+	// Only callers bound to a role that may administer write
+	for _, caller := range []RoleBinding{
+		{},                   // Unsigned
+		{PublicKey: "UDAVE"}, // Unbound key
+		testOperator,         // Operators may not
+	} {
+		if _, err := s.purge(ctx, AdminRegistryRequest{Key: "acme.orders.a"}, caller); !errors.Is(err, errAdminRefused) {
+			t.Errorf("purge() by %+v error = %v, want refused", caller, err)
+		}
+	}
+
+	// Without auth nobody may write
+	s, registry, _, _ := newTestAdminService(false)
+	if _, err := s.expire(ctx, AdminRegistryRequest{Key: "acme.orders.a"}, testAdmin); !errors.Is(err, errAdminRefused) {
+		t.Errorf("expire() without auth error = %v, want refused", err)
+	}
+	if len(registry.values) != 3 {
+		t.Errorf("expire() without auth removed registrations")
+	}
+}
+
+func TestAdminWrites(t *testing.T) {
+	for mode, want := range map[string]bool{"": false, "none": false, "token": true, "nkey": true, "jwt": true, "callout": true} {
+		if got := adminWrites(mode); got != want {
+			t.Errorf("adminWrites(%q) = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+// Over NATS the actor is whoever signed the request, not a "by" in it
+func TestAdminSignedCaller(t *testing.T) {
+	n := startTestNode(t, NATSConfig{})
+	ctx := context.Background()
+	s, registry, _, actions := newTestAdminService(true)
+	svc, err := s.start(n.Conn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Stop()
+
+	keys := make(map[string]nkeys.KeyPair)
+	for user, role := range map[string]string{"alice": RoleAdmin, "bob": RoleOperator} {
+		kp, _ := nkeys.CreateUser()
+		pub, _ := kp.PublicKey()
+		keys[user] = kp
+		if err := s.roles.Bind(ctx, RoleBinding{User: user, Role: role, PublicKey: pub}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unsigned, and an operator claiming to be alice
+	data := []byte(`{"key":"acme.orders.a","by":"alice"}`)
+	if _, err := n.Conn().RequestWithContext(ctx, AdminExpireSubject, data); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := signedRequest(ctx, n.Conn(), AdminExpireSubject, data, keys["bob"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := msg.Header.Get(micro.ErrorCodeHeader); code != "403" {
+		t.Errorf("expire by bob = %s %q, want 403", code, msg.Header.Get(micro.ErrorHeader))
+	}
+	if _, ok := registry.values["acme.orders.a"]; !ok {
+		t.Fatal("registration expired by an unsigned request or an operator")
+	}
+
+	expired, err := AdminExpire(ctx, n.Conn(), AdminRegistryRequest{Key: "acme.orders.a"}, keys["alice"])
+	if err != nil || !slices.Equal(expired, []string{"acme.orders.a"}) {
+		t.Fatalf("AdminExpire() by alice = %v, %v", expired, err)
+	}
+	if want := []string{"admin.expired acme.orders.a by alice"}; !slices.Equal(*actions, want) {
+		t.Errorf("audit = %v, want %v", *actions, want)
+	}
+}
@@ -0,0 +1,161 @@
+// advertise.go: The address discovery consumers dial
+//
+// Registrations carry Instance.Host, the host:port other services use to
+// reach an instance (see resolver.go). WithAdvertiseAddr (or
+// ADVERTISE_ADDR) sets it; otherwise it is detected from config fields
+// tagged wellknown:"host" (host:port or host) and wellknown:"port":
+//
+//	type Config struct {
+//	    Addr string `conf:"default::8080" wellknown:"host"`
+//	}
+//
+//	type Config struct {
+//	    Host string `conf:"default:0.0.0.0" wellknown:"host"`
+//	    Port int    `conf:"default:8080" wellknown:"port"`
+//	}
+//
+// Listen addresses without a host or with a wildcard one (":8080",
+// "0.0.0.0:8080", "[::]:8080") are advertised with this machine's first
+// non-loopback IP, or its hostname. Without either source Host stays empty.
+package env
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+)
+
+// advertiseTag is the struct tag marking the advertised host and port
+const advertiseTag = "wellknown"
+
+// WithAdvertiseAddr sets the host:port registered for this instance
+// instead of detecting it from config
+func WithAdvertiseAddr(addr string) Option {
+	return func(o *Options) {
+		o.AdvertiseAddr = addr
+	}
+}
+
+// DetectAdvertiseAddr returns the address advertised for cfg (after
+// Parse), from its wellknown:"host" and wellknown:"port" fields. Empty if
+// cfg has neither.
+func DetectAdvertiseAddr(cfg interface{}) string {
+	return detectAdvertiseAddr(cfg, localAddr)
+}
+
+// detectAdvertiseAddr is DetectAdvertiseAddr with the machine's address
+// from local
+func detectAdvertiseAddr(cfg interface{}, local func() string) string {
+	var hostPath, portPath string
+	advertiseFields(reflect.TypeOf(cfg), "", &hostPath, &portPath)
+	if hostPath == "" && portPath == "" {
+		return ""
+	}
+
+	root := reflect.ValueOf(cfg)
+	var host, port string
+	if v, ok := fieldValue(root, hostPath); ok {
+		host = fmt.Sprint(v.Interface())
+	}
+	if v, ok := fieldValue(root, portPath); ok {
+		port = fmt.Sprint(v.Interface())
+	}
+	return advertiseAddr(host, port, local)
+}
+
+// advertiseFields finds the paths of the first fields tagged as host and
+// port, walking nested structs like ExtractFields
+func advertiseFields(t reflect.Type, path string, host, port *string) {
+	if t == nil {
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+		if field.Anonymous {
+			advertiseFields(field.Type, path, host, port)
+			continue
+		}
+
+		switch field.Tag.Get(advertiseTag) {
+		case "host":
+			if *host == "" {
+				*host = fieldPath
+			}
+		case "port":
+			if *port == "" {
+				*port = fieldPath
+			}
+		default:
+			if field.Type.Kind() == reflect.Struct && field.Tag.Get("conf") == "" {
+				advertiseFields(field.Type, fieldPath, host, port)
+			}
+		}
+	}
+}
+
+// advertiseAddr joins host (host:port or host) and port into a dialable
+// address; port wins over a port in host, and wildcard hosts become
+// local()
+func advertiseAddr(host, port string, local func() string) string {
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		if port == "" || port == "0" {
+			port = p
+		}
+	}
+	if port == "0" {
+		port = ""
+	}
+
+	switch host {
+	case "", "0.0.0.0", "::":
+		if port == "" {
+			return ""
+		}
+		host = local()
+	}
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// localAddr returns the first non-loopback IP of this machine (IPv4
+// first), or its hostname
+func localAddr() string {
+	var v6 string
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			if ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+			if v6 == "" {
+				v6 = ipnet.IP.String()
+			}
+		}
+	}
+	if v6 != "" {
+		return v6
+	}
+	host, _ := os.Hostname()
+	return host
+}
@@ -0,0 +1,51 @@
+package env
+
+import "testing"
+
+func TestDetectAdvertiseAddr(t *testing.T) {
+	type server struct {
+		Host string `wellknown:"host"`
+		Port int    `wellknown:"port"`
+	}
+	type nested struct {
+		Server server
+	}
+	type addr struct {
+		Addr string `conf:"default::8080" wellknown:"host"`
+	}
+	local := func() string { return "10.0.0.7" }
+
+	tests := []struct {
+		name string
+		cfg  interface{}
+		want string
+	}{
+		{"listen address", &addr{Addr: ":8080"}, "10.0.0.7:8080"},
+		{"wildcard IPv6", &addr{Addr: "[::]:9000"}, "10.0.0.7:9000"},
+		{"explicit host", &addr{Addr: "api.internal:8080"}, "api.internal:8080"},
+		{"host and port fields", &nested{Server: server{Host: "0.0.0.0", Port: 8443}}, "10.0.0.7:8443"},
+		{"port field only", &struct {
+			Port int `wellknown:"port"`
+		}{Port: 80}, "10.0.0.7:80"},
+		{"host without port", &nested{Server: server{Host: "api.internal"}}, "api.internal"},
+		{"wildcard without port", &nested{Server: server{Host: "0.0.0.0"}}, ""},
+		{"untagged", &struct{ Addr string }{Addr: ":8080"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectAdvertiseAddr(tt.cfg, local); got != tt.want {
+				t.Errorf("detectAdvertiseAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvertiseAddrPortOverride(t *testing.T) {
+	local := func() string { return "10.0.0.7" }
+	if got := advertiseAddr("api.internal:8080", "9090", local); got != "api.internal:9090" {
+		t.Errorf("advertiseAddr() = %q, want the port field to win", got)
+	}
+	if got := advertiseAddr(":8080", "0", local); got != "10.0.0.7:8080" {
+		t.Errorf("advertiseAddr() = %q, want port 0 ignored", got)
+	}
+}
@@ -0,0 +1,140 @@
+// attest.go: Device attestation at enrollment
+//
+// A node can back its enrollment request with evidence about the device:
+// a TPM quote, a cloud instance identity document or a machine
+// fingerprint. The hub verifies it before the request is queued, so only
+// attested nodes can be approved and get credentials:
+//
+//	// Device (or ENROLL_ATTESTATION=fingerprint)
+//	mgr, _ := env.New("APP", env.WithEnrollment(token), env.WithAttestation(env.FingerprintAttester()))
+//
+//	// Hub
+//	mgr.ServeEnrollment(env.EnrollmentConfig{
+//	    Token: token,
+//	    Verifiers: map[string]env.AttestationVerifier{
+//	        env.AttestFingerprint: env.FingerprintVerifier(known), // node -> fingerprint
+//	    },
+//	})
+//
+// Attesters get AttestationBinding (node name and key) to put in the
+// evidence, e.g. as the TPM quote's nonce, so evidence can't be replayed
+// for another key. The fingerprint is only as strong as the machine ID
+// it hashes; use it to catch mistakes, not attackers.
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AttestFingerprint is the kind of FingerprintAttester evidence
+const AttestFingerprint = "fingerprint"
+
+// machineIDFiles are read in order by MachineFingerprint
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// Attestation is evidence about the device sent with an enrollment request
+type Attestation struct {
+	Kind     string `json:"kind"`     // Selects the hub's verifier, e.g. "tpm" or "fingerprint"
+	Evidence []byte `json:"evidence"` // Quote, identity document, fingerprint, ...
+}
+
+// Attester produces a node's attestation. binding identifies the node and
+// its key (see AttestationBinding).
+type Attester func(ctx context.Context, binding []byte) (*Attestation, error)
+
+// AttestationVerifier checks a request's attestation and returns the
+// claims to record with the enrollment (shown to the operator)
+type AttestationVerifier func(ctx context.Context, req EnrollmentRequest) (map[string]string, error)
+
+// WithAttestation sends the attester's evidence with enrollment requests
+func WithAttestation(attester Attester) Option {
+	return func(o *Options) {
+		o.Attester = attester
+	}
+}
+
+// AttestationBinding returns the bytes evidence should cover: the node
+// name and its public key
+func AttestationBinding(node, publicKey string) []byte {
+	return []byte(node + "\n" + publicKey)
+}
+
+// verifyAttestation runs the verifier for the request's attestation kind.
+// Without verifiers any attestation is ignored.
+func verifyAttestation(ctx context.Context, verifiers map[string]AttestationVerifier, req EnrollmentRequest) (map[string]string, error) {
+	if len(verifiers) == 0 {
+		return nil, nil
+	}
+	if req.Attestation == nil {
+		return nil, fmt.Errorf("attestation required")
+	}
+	verify, ok := verifiers[req.Attestation.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported attestation %q", req.Attestation.Kind)
+	}
+	claims, err := verify(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("attestation failed: %w", err)
+	}
+	return claims, nil
+}
+
+// attesterFromEnv returns the built-in attester named by ENROLL_ATTESTATION
+func attesterFromEnv(kind string) (Attester, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case AttestFingerprint:
+		return FingerprintAttester(), nil
+	default:
+		return nil, fmt.Errorf("unknown attestation %q (want %s)", kind, AttestFingerprint)
+	}
+}
+
+// MachineFingerprint returns a hash of the machine ID
+func MachineFingerprint() (string, error) {
+	for _, path := range machineIDFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if id := strings.TrimSpace(string(data)); id != "" {
+			sum := sha256.Sum256([]byte(id))
+			return hex.EncodeToString(sum[:]), nil
+		}
+	}
+	return "", fmt.Errorf("no machine ID found")
+}
+
+// FingerprintAttester attests with MachineFingerprint
+func FingerprintAttester() Attester {
+	return func(ctx context.Context, binding []byte) (*Attestation, error) {
+		fp, err := MachineFingerprint()
+		if err != nil {
+			return nil, err
+		}
+		return &Attestation{Kind: AttestFingerprint, Evidence: []byte(fp)}, nil
+	}
+}
+
+// FingerprintVerifier accepts nodes whose fingerprint matches known
+// (node name -> MachineFingerprint)
+func FingerprintVerifier(known map[string]string) AttestationVerifier {
+	return func(ctx context.Context, req EnrollmentRequest) (map[string]string, error) {
+		want, ok := known[req.Node]
+		if !ok {
+			return nil, fmt.Errorf("no fingerprint on record for %s", req.Node)
+		}
+		got := string(req.Attestation.Evidence)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			return nil, fmt.Errorf("fingerprint mismatch")
+		}
+		return map[string]string{AttestFingerprint: got}, nil
+	}
+}
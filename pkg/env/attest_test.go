@@ -0,0 +1,114 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+)
+
+func TestVerifyAttestation(t *testing.T) {
+	ctx := context.Background()
+	verifiers := map[string]AttestationVerifier{
+		AttestFingerprint: FingerprintVerifier(map[string]string{"edge-7": "abc123"}),
+	}
+	fingerprint := func(fp string) *Attestation {
+		return &Attestation{Kind: AttestFingerprint, Evidence: []byte(fp)}
+	}
+	tests := []struct {
+		name      string
+		verifiers map[string]AttestationVerifier
+		req       EnrollmentRequest
+		wantErr   bool
+	}{
+		{name: "not required", req: EnrollmentRequest{Node: "edge-7"}},
+		{name: "missing", verifiers: verifiers, req: EnrollmentRequest{Node: "edge-7"}, wantErr: true},
+		{name: "unsupported kind", verifiers: verifiers, req: EnrollmentRequest{Node: "edge-7", Attestation: &Attestation{Kind: "tpm"}}, wantErr: true},
+		{name: "unknown node", verifiers: verifiers, req: EnrollmentRequest{Node: "edge-8", Attestation: fingerprint("abc123")}, wantErr: true},
+		{name: "mismatch", verifiers: verifiers, req: EnrollmentRequest{Node: "edge-7", Attestation: fingerprint("def456")}, wantErr: true},
+		{name: "match", verifiers: verifiers, req: EnrollmentRequest{Node: "edge-7", Attestation: fingerprint("abc123")}},
+	}
+	for _, tt := range tests {
+		_, err := verifyAttestation(ctx, tt.verifiers, tt.req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifyAttestation() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEnrollWithAttestation(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+
+	var binding []byte
+	attester := func(ctx context.Context, b []byte) (*Attestation, error) {
+		binding = b
+		return &Attestation{Kind: "test", Evidence: []byte("good")}, nil
+	}
+	cfg := EnrollmentConfig{
+		Token: "s3cret",
+		Verifiers: map[string]AttestationVerifier{
+			"test": func(ctx context.Context, req EnrollmentRequest) (map[string]string, error) {
+				return map[string]string{"evidence": string(req.Attestation.Evidence)}, nil
+			},
+		},
+	}
+
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := newEnrollmentRequest(ctx, kp, "edge-7", "", "s3cret", attester)
+	if err != nil {
+		t.Fatalf("newEnrollmentRequest() error = %v", err)
+	}
+	pub, _ := kp.PublicKey()
+	if want := string(AttestationBinding("edge-7", pub)); string(binding) != want {
+		t.Errorf("attester binding = %q, want %q", binding, want)
+	}
+
+	if _, err := enroll(ctx, kv, cfg, req); err != nil {
+		t.Fatalf("enroll() error = %v", err)
+	}
+	list, err := ListEnrollments(ctx, kv)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListEnrollments() = %+v, %v; want one entry", list, err)
+	}
+	if e := list[0]; e.Attestation != "test" || e.Claims["evidence"] != "good" {
+		t.Errorf("enrollment attestation = %q %v, want test with evidence=good", e.Attestation, e.Claims)
+	}
+
+	req.Attestation = nil
+	if _, err := enroll(ctx, kv, cfg, req); err == nil {
+		t.Error("enroll() without attestation succeeded, want error")
+	}
+}
+
+func TestMachineFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "machine-id")
+	if err := os.WriteFile(path, []byte("4c4c4544\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := machineIDFiles
+	machineIDFiles = []string{filepath.Join(dir, "missing"), path}
+	defer func() { machineIDFiles = old }()
+
+	fp, err := MachineFingerprint()
+	if err != nil {
+		t.Fatalf("MachineFingerprint() error = %v", err)
+	}
+	if len(fp) != 64 {
+		t.Errorf("MachineFingerprint() = %q, want a SHA-256 hex digest", fp)
+	}
+	a, err := FingerprintAttester()(context.Background(), nil)
+	if err != nil || string(a.Evidence) != fp {
+		t.Errorf("FingerprintAttester() = %+v, %v; want evidence %s", a, err, fp)
+	}
+
+	if _, err := attesterFromEnv("tpm"); err == nil {
+		t.Error("attesterFromEnv(tpm) succeeded, want error")
+	}
+}
@@ -0,0 +1,68 @@
+// audit.go: Audit trail of security-relevant actions
+//
+// Actions that change who may do what (access grants today) are published
+// as AuditEvents to audit.{action} and kept in the "audit" stream for a
+// year. Forward them to other tools with an Exporter (subjects: [audit.>]):
+//
+//	_ = env.PublishAudit(ctx, js, env.AuditEvent{
+//	    Action: "access.granted", Actor: "alice", Target: "bob",
+//	})
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// AuditStream holds audit events
+	AuditStream = "audit"
+
+	auditSubjectPrefix = "audit."
+	auditRetention     = 365 * 24 * time.Hour
+)
+
+// AuditEvent records who did what to whom
+type AuditEvent struct {
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`            // Dotted, e.g. access.granted
+	Actor   string            `json:"actor"`             // Who did it (operator or component)
+	Target  string            `json:"target,omitempty"`  // Who or what it was done to
+	Details map[string]string `json:"details,omitempty"` // Action specific
+}
+
+// CreateAuditStream creates (or opens) the audit stream
+func CreateAuditStream(ctx context.Context, js jetstream.JetStream) error {
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        AuditStream,
+		Description: "Audit trail of wellnown-env",
+		Subjects:    []string{auditSubjectPrefix + ">"},
+		MaxAge:      auditRetention,
+	})
+	if err != nil {
+		return fmt.Errorf("creating audit stream: %w", err)
+	}
+	return nil
+}
+
+// PublishAudit records e in the audit stream (Time defaults to now)
+func PublishAudit(ctx context.Context, js jetstream.JetStream, e AuditEvent) error {
+	if e.Action == "" {
+		return fmt.Errorf("audit event needs an action")
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := js.Publish(ctx, auditSubjectPrefix+e.Action, data); err != nil {
+		return fmt.Errorf("publishing audit event %s: %w", e.Action, err)
+	}
+	return nil
+}
@@ -6,15 +6,19 @@
 //	Test/CI:     NATS_AUTH=token  - Shared token via env var
 //	Staging:     NATS_AUTH=nkey   - NKey public/private keypairs
 //	Production:  NATS_AUTH=jwt    - Full NSC accounts with revocation
+//	Delegated:   NATS_AUTH=callout - Auth callout service decides (see callout.go)
 //
 // Files read from .auth/ directory:
 //
-//	.auth/mode         - Current auth mode (token/nkey/jwt)
+//	.auth/mode         - Current auth mode (token/nkey/jwt/callout)
 //	.auth/token        - Shared token for token mode
 //	.auth/user.pub     - NKey public key for nkey mode
 //	.auth/user.nk      - NKey seed for client auth (nkey mode)
+//	.auth/services.json - Scoped service NKeys and their permissions (nkey mode, optional)
 //	.auth/creds/       - JWT credentials directory (jwt mode)
 //	.auth/creds/user.creds - User credentials file (jwt mode)
+//	.auth/callout.pass - Password of the callout service user (callout mode)
+//	.auth/callout.nk   - Account NKey seed signing callout responses (callout mode)
 package env
 
 import (
@@ -32,13 +36,15 @@ import (
 
 // Auth file paths (relative to working directory)
 const (
-	authDir       = ".auth"
-	authModeFile  = ".auth/mode"
-	authTokenFile = ".auth/token"
-	authNKeyPub   = ".auth/user.pub"
-	authNKeySeed  = ".auth/user.nk"
-	authCredsDir  = ".auth/creds"
-	authCredsFile = ".auth/creds/user.creds"
+	authDir         = ".auth"
+	authModeFile    = ".auth/mode"
+	authTokenFile   = ".auth/token"
+	authNKeyPub     = ".auth/user.pub"
+	authNKeySeed    = ".auth/user.nk"
+	authCredsDir    = ".auth/creds"
+	authCredsFile   = ".auth/creds/user.creds"
+	authCalloutPass = ".auth/callout.pass"
+	authCalloutSeed = ".auth/callout.nk"
 )
 
 // readAuthFile reads and trims a file from the auth directory
@@ -100,10 +106,17 @@ func (r *preloadedResolver) Close() {
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
-	Mode     string // none, token, nkey, jwt
+	Mode     string // none, token, nkey, jwt, callout
 	Token    string // for token mode
 	NKeyPub  string // for nkey mode (user public key)
 	CredsDir string // for jwt mode
+
+	// nkey mode: scoped service users (public key -> permissions), see permissions.go
+	ServiceNKeys map[string]SubjectPermissions
+
+	CalloutPassword string // for callout mode (password of CalloutUser)
+	CalloutIssuer   string // for callout mode (account public key signing responses)
+	CalloutSeed     string // for callout mode (issuer seed; empty = service runs elsewhere)
 }
 
 // LoadAuthConfig reads auth configuration from environment and .auth/ directory
@@ -146,6 +159,10 @@ func LoadAuthConfig() (*AuthConfig, error) {
 		if _, err := os.Stat(authNKeySeed); os.IsNotExist(err) {
 			return nil, fmt.Errorf("nkey auth requires seed file: %s", authNKeySeed)
 		}
+		cfg.ServiceNKeys, err = loadServiceNKeys(authServicesFile)
+		if err != nil {
+			return nil, err
+		}
 
 	case "jwt":
 		// Check for credentials directory
@@ -157,13 +174,51 @@ func LoadAuthConfig() (*AuthConfig, error) {
 			return nil, fmt.Errorf("jwt auth requires credentials directory: %s", cfg.CredsDir)
 		}
 
+	case "callout":
+		if err := loadCalloutConfig(cfg); err != nil {
+			return nil, err
+		}
+
 	default:
-		return nil, fmt.Errorf("unknown auth mode: %s (use: none, token, nkey, jwt)", cfg.Mode)
+		return nil, fmt.Errorf("unknown auth mode: %s (use: none, token, nkey, jwt, callout)", cfg.Mode)
 	}
 
 	return cfg, nil
 }
 
+// loadCalloutConfig reads the callout user password and issuer key
+func loadCalloutConfig(cfg *AuthConfig) error {
+	cfg.CalloutPassword = os.Getenv("NATS_CALLOUT_PASSWORD")
+	if cfg.CalloutPassword == "" {
+		cfg.CalloutPassword, _ = readAuthFile(authCalloutPass)
+	}
+	if cfg.CalloutPassword == "" {
+		return fmt.Errorf("callout auth requires NATS_CALLOUT_PASSWORD env var or %s file", authCalloutPass)
+	}
+
+	// The seed is only needed if this node runs the callout service itself
+	cfg.CalloutIssuer = os.Getenv("NATS_CALLOUT_ISSUER")
+	cfg.CalloutSeed, _ = readAuthFile(authCalloutSeed)
+	if cfg.CalloutSeed != "" {
+		kp, err := calloutIssuer(cfg.CalloutSeed)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", authCalloutSeed, err)
+		}
+		pub, _ := kp.PublicKey()
+		if cfg.CalloutIssuer != "" && cfg.CalloutIssuer != pub {
+			return fmt.Errorf("NATS_CALLOUT_ISSUER does not match %s", authCalloutSeed)
+		}
+		cfg.CalloutIssuer = pub
+	}
+	if cfg.CalloutIssuer == "" {
+		return fmt.Errorf("callout auth requires %s or NATS_CALLOUT_ISSUER", authCalloutSeed)
+	}
+	if !nkeys.IsValidPublicAccountKey(cfg.CalloutIssuer) {
+		return fmt.Errorf("invalid callout issuer %s (must be an account key starting with A)", cfg.CalloutIssuer)
+	}
+	return nil
+}
+
 // ConfigureAuth applies authentication settings to NATS server options
 func ConfigureAuth(opts *server.Options, cfg *AuthConfig) error {
 	switch cfg.Mode {
@@ -180,6 +235,15 @@ func ConfigureAuth(opts *server.Options, cfg *AuthConfig) error {
 	case "jwt":
 		return configureJWTAuth(opts, cfg)
 
+	case "callout":
+		// The callout user bypasses the callout; everyone else is delegated
+		opts.Users = []*server.User{{Username: CalloutUser, Password: cfg.CalloutPassword}}
+		opts.AuthCallout = &server.AuthCallout{
+			Issuer:    cfg.CalloutIssuer,
+			AuthUsers: []string{CalloutUser},
+		}
+		return nil
+
 	default:
 		return fmt.Errorf("unknown auth mode: %s", cfg.Mode)
 	}
@@ -187,9 +251,21 @@ func ConfigureAuth(opts *server.Options, cfg *AuthConfig) error {
 
 // configureNKeyAuth sets up NKey-based authentication
 func configureNKeyAuth(opts *server.Options, cfg *AuthConfig) error {
-	// Create NKey user with full permissions
-	nkeyUser := &server.NkeyUser{
-		Nkey: cfg.NKeyPub,
+	opts.Nkeys = []*server.NkeyUser{nkeyUser(cfg.NKeyPub)}
+	for pub, perms := range cfg.ServiceNKeys {
+		if !nkeys.IsValidPublicUserKey(pub) {
+			return fmt.Errorf("invalid service NKey %s (must start with U)", pub)
+		}
+		opts.Nkeys = append(opts.Nkeys, &server.NkeyUser{Nkey: pub, Permissions: perms.permissions()})
+	}
+	return nil
+}
+
+// nkeyUser creates an NKey user with full permissions (the node's own user;
+// services get scoped users through ServiceNKeys)
+func nkeyUser(pub string) *server.NkeyUser {
+	return &server.NkeyUser{
+		Nkey: pub,
 		Permissions: &server.Permissions{
 			Publish: &server.SubjectPermission{
 				Allow: []string{">"},
@@ -199,9 +275,6 @@ func configureNKeyAuth(opts *server.Options, cfg *AuthConfig) error {
 			},
 		},
 	}
-
-	opts.Nkeys = []*server.NkeyUser{nkeyUser}
-	return nil
 }
 
 // configureJWTAuth sets up JWT/Account-based authentication
@@ -216,11 +289,17 @@ func configureJWTAuth(opts *server.Options, cfg *AuthConfig) error {
 		}
 		nscStore = filepath.Join(homeDir, ".local", "share", "nats", "nsc", "stores")
 	}
+	return configureJWTAuthFromStore(opts, nscStore)
+}
 
+// configureJWTAuthFromStore loads the wellnown operator and its accounts
+// from an NSC store directory, including the per-service accounts written
+// by ProvisionServiceAccounts
+func configureJWTAuthFromStore(opts *server.Options, nscStore string) error {
 	// Look for wellnown operator
 	operatorDir := filepath.Join(nscStore, "wellnown")
 	if _, err := os.Stat(operatorDir); os.IsNotExist(err) {
-		return fmt.Errorf("NSC operator not found at %s - run 'task auth:jwt' first", operatorDir)
+		return fmt.Errorf("NSC operator not found at %s - create it with auth.BootstrapOperator or nsc", operatorDir)
 	}
 
 	// Find the operator JWT file
@@ -297,6 +376,10 @@ func GetClientConnectOptions(cfg *AuthConfig) ([]nats.Option, error) {
 	case "jwt":
 		return getJWTClientOptions(cfg.CredsDir)
 
+	case "callout":
+		// The node's own connections are trusted and skip the callout
+		return []nats.Option{nats.UserInfo(CalloutUser, cfg.CalloutPassword)}, nil
+
 	default:
 		return nil, fmt.Errorf("unknown auth mode: %s", cfg.Mode)
 	}
@@ -308,7 +391,11 @@ func getNKeyClientOptions() ([]nats.Option, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading NKey seed %s: %w", authNKeySeed, err)
 	}
+	return nkeyClientOptions(seed)
+}
 
+// nkeyClientOptions returns client options signing with an NKey seed
+func nkeyClientOptions(seed string) ([]nats.Option, error) {
 	kp, err := nkeys.FromSeed([]byte(seed))
 	if err != nil {
 		return nil, fmt.Errorf("parsing NKey seed: %w", err)
@@ -0,0 +1,583 @@
+// Package auth generates NATS credentials: shared tokens, NKey pairs and
+// NSC-compatible operator/account/user JWTs.
+//
+// GUIs and CLIs call it instead of shelling out to task, nsc or nk:
+//
+//	token, _ := auth.SetupToken(".auth") // NATS_AUTH=token
+//	kp, _ := auth.SetupNKey(".auth")     // NATS_AUTH=nkey
+//	store, _ := auth.DefaultStore()
+//	_ = auth.SetupJWT(".auth", store)    // NATS_AUTH=jwt
+//
+// The Setup functions keep existing credentials, like the old task
+// auth:* targets. Lower-level calls build custom stores:
+//
+//	op, _ := auth.BootstrapOperator(store, "acme")
+//	orders, _ := op.AddAccount("ORDERS")
+//	creds, _ := orders.AddUser("worker")
+//
+// Stores use the nsc layout, so nsc keeps working on them and env reads
+// them unchanged:
+//
+//	<store>/<operator>/<operator>.jwt
+//	<store>/<operator>/accounts/<account>/<account>.jwt
+//	<store>/<operator>/accounts/<account>/users/<user>.jwt
+//	<keys>/keys/<K>/<EY>/<KEY>.nk                     (seeds)
+//	<keys>/creds/<operator>/<account>/<user>.creds
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// DefaultOperator is the operator name env looks for in the NSC store
+const DefaultOperator = "wellnown"
+
+// SystemAccount is the name of the account BootstrapOperator creates for
+// server monitoring
+const SystemAccount = "SYS"
+
+// ErrExists is returned when creating an operator, account or user whose
+// JWT is already in the store
+var ErrExists = errors.New("already exists")
+
+// GenerateToken returns a random 32-byte hex token
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// KeyPair is an encoded NKey
+type KeyPair struct {
+	Public string // U... (user), A... (account) or O... (operator)
+	Seed   string // SU..., SA... or SO...
+}
+
+// GenerateNKeyPair returns a new user NKey
+func GenerateNKeyPair() (KeyPair, error) {
+	return generate(nkeys.CreateUser)
+}
+
+// generate creates a key with create and encodes it
+func generate(create func() (nkeys.KeyPair, error)) (KeyPair, error) {
+	kp, err := create()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("generating NKey: %w", err)
+	}
+	return encode(kp)
+}
+
+// encode returns the public key and seed of kp
+func encode(kp nkeys.KeyPair) (KeyPair, error) {
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("encoding public key: %w", err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("encoding seed: %w", err)
+	}
+	return KeyPair{Public: pub, Seed: string(seed)}, nil
+}
+
+// SetupToken selects token mode in dir (usually .auth), generating
+// <dir>/token unless it exists, and returns the token
+func SetupToken(dir string) (string, error) {
+	token, err := readFile(filepath.Join(dir, "token"))
+	if err != nil {
+		if token, err = GenerateToken(); err != nil {
+			return "", err
+		}
+	}
+	if err := writeFiles(dir, map[string]string{"token": token, "mode": "token"}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SetupNKey selects nkey mode in dir, generating <dir>/user.nk and
+// <dir>/user.pub unless the seed exists, and returns the key
+func SetupNKey(dir string) (KeyPair, error) {
+	kp, err := readKeyPair(filepath.Join(dir, "user.nk"))
+	if err != nil {
+		if kp, err = GenerateNKeyPair(); err != nil {
+			return KeyPair{}, err
+		}
+	}
+	if err := writeFiles(dir, map[string]string{"user.nk": kp.Seed, "user.pub": kp.Public, "mode": "nkey"}); err != nil {
+		return KeyPair{}, err
+	}
+	return kp, nil
+}
+
+// SetupCallout selects callout mode in dir, generating the callout user
+// password (<dir>/callout.pass) and the account key signing responses
+// (<dir>/callout.nk) unless they exist. It returns the account key.
+func SetupCallout(dir string) (KeyPair, error) {
+	password, err := readFile(filepath.Join(dir, "callout.pass"))
+	if err != nil {
+		if password, err = GenerateToken(); err != nil {
+			return KeyPair{}, err
+		}
+	}
+	kp, err := readKeyPair(filepath.Join(dir, "callout.nk"))
+	if err != nil {
+		if kp, err = generate(nkeys.CreateAccount); err != nil {
+			return KeyPair{}, err
+		}
+	}
+	if err := writeFiles(dir, map[string]string{"callout.pass": password, "callout.nk": kp.Seed, "mode": "callout"}); err != nil {
+		return KeyPair{}, err
+	}
+	return kp, nil
+}
+
+// SetupJWT selects jwt mode in dir. It creates what is missing in s - the
+// DefaultOperator, an APP account with JetStream and a user "user" - and
+// writes the user's creds to <dir>/creds/user.creds.
+func SetupJWT(dir string, s Store) error {
+	op, err := LoadOperator(s, DefaultOperator)
+	if errors.Is(err, os.ErrNotExist) {
+		op, err = BootstrapOperator(s, DefaultOperator)
+	}
+	if err != nil {
+		return err
+	}
+	app, err := op.Account("APP")
+	if errors.Is(err, os.ErrNotExist) {
+		app, err = op.AddAccount("APP")
+	}
+	if err != nil {
+		return err
+	}
+	creds, err := app.Creds("user")
+	if errors.Is(err, os.ErrNotExist) {
+		creds, err = app.AddUser("user")
+	}
+	if err != nil {
+		return err
+	}
+	return writeFiles(dir, map[string]string{filepath.Join("creds", "user.creds"): string(creds), "mode": "jwt"})
+}
+
+// readFile reads and trims a file
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readKeyPair reads an NKey seed file
+func readKeyPair(path string) (KeyPair, error) {
+	seed, err := readFile(path)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("parsing seed %s: %w", path, err)
+	}
+	return encode(kp)
+}
+
+// writeFiles writes files below dir; mode is written last so a reader
+// never sees a mode without its credentials
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		if name == "mode" {
+			continue
+		}
+		if err := WriteFile(filepath.Join(dir, name), content); err != nil {
+			return err
+		}
+	}
+	if mode, ok := files["mode"]; ok {
+		return WriteFile(filepath.Join(dir, "mode"), mode)
+	}
+	return nil
+}
+
+// WriteFile replaces path atomically, readable by the owner only. Content
+// is written as is: JWT files must not end in a newline.
+func WriteFile(path, content string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	f, err := os.CreateTemp(dir, ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	defer os.Remove(f.Name()) // No-op after the rename
+
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Store is an NSC store and the keystore holding its seeds
+type Store struct {
+	Dir     string // JWTs (NATS_NSC_STORE, default ~/.local/share/nats/nsc/stores)
+	KeysDir string // Seeds and creds (NKEYS_PATH, default ~/.local/share/nats/nsc/keys)
+}
+
+// DefaultStore returns the store nsc and env use
+func DefaultStore() (Store, error) {
+	s := Store{Dir: os.Getenv("NATS_NSC_STORE"), KeysDir: os.Getenv("NKEYS_PATH")}
+	if s.Dir != "" && s.KeysDir != "" {
+		return s, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Store{}, fmt.Errorf("cannot find home directory: %w", err)
+	}
+	nsc := filepath.Join(home, ".local", "share", "nats", "nsc")
+	if s.Dir == "" {
+		s.Dir = filepath.Join(nsc, "stores")
+	}
+	if s.KeysDir == "" {
+		s.KeysDir = filepath.Join(nsc, "keys")
+	}
+	return s, nil
+}
+
+// keyPath returns the keystore path of a seed
+func (s Store) keyPath(pub string) string {
+	return filepath.Join(s.KeysDir, "keys", pub[:1], pub[1:3], pub+".nk")
+}
+
+// KeyPair reads the seed of pub from the keystore
+func (s Store) KeyPair(pub string) (nkeys.KeyPair, error) {
+	if len(pub) < 3 {
+		return nil, fmt.Errorf("invalid public key %q", pub)
+	}
+	path := s.keyPath(pub)
+	seed, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seed: %w", err)
+	}
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("parsing seed %s: %w", path, err)
+	}
+	if got, _ := kp.PublicKey(); got != pub {
+		return nil, fmt.Errorf("seed in %s does not belong to %s", path, pub)
+	}
+	return kp, nil
+}
+
+// saveKey writes the seed of kp to the keystore
+func (s Store) saveKey(kp KeyPair) error {
+	return WriteFile(s.keyPath(kp.Public), kp.Seed)
+}
+
+// Operator is an operator in a Store
+type Operator struct {
+	Name          string
+	PublicKey     string
+	SystemAccount string // Public key of the SYS account
+
+	store Store
+	kp    nkeys.KeyPair
+}
+
+// BootstrapOperator creates operator name with a SYS system account. It
+// fails with ErrExists if the store already has the operator.
+func BootstrapOperator(s Store, name string) (*Operator, error) {
+	path := filepath.Join(s.Dir, name, name+".jwt")
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("operator %s: %w", name, ErrExists)
+	}
+
+	kp, err := generate(nkeys.CreateOperator)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveKey(kp); err != nil {
+		return nil, err
+	}
+	signer, _ := nkeys.FromSeed([]byte(kp.Seed))
+	op := &Operator{Name: name, PublicKey: kp.Public, store: s, kp: signer}
+
+	sys, err := op.AddAccount(SystemAccount)
+	if err != nil {
+		return nil, err
+	}
+	op.SystemAccount = sys.PublicKey
+
+	// The operator JWT goes last: its presence marks a complete operator
+	claims := jwt.NewOperatorClaims(kp.Public)
+	claims.Name = name
+	claims.SystemAccount = sys.PublicKey
+	token, err := claims.Encode(signer)
+	if err != nil {
+		return nil, fmt.Errorf("encoding operator %s: %w", name, err)
+	}
+	if err := WriteFile(path, token); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// LoadOperator reads operator name and its seed from s
+func LoadOperator(s Store, name string) (*Operator, error) {
+	claims, err := readClaims(filepath.Join(s.Dir, name, name+".jwt"), jwt.DecodeOperatorClaims)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := s.KeyPair(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s: %w", name, err)
+	}
+	return &Operator{Name: name, PublicKey: claims.Subject, SystemAccount: claims.SystemAccount, store: s, kp: kp}, nil
+}
+
+// Account is an account signed by an Operator
+type Account struct {
+	Name      string
+	PublicKey string
+
+	op *Operator
+	kp nkeys.KeyPair
+}
+
+// accountDir returns the store directory of account name
+func (o *Operator) accountDir(name string) string {
+	return filepath.Join(o.store.Dir, o.Name, "accounts", name)
+}
+
+// AddAccount creates account name. Accounts other than SYS get unlimited
+// JetStream, which the registry and KV buckets need.
+func (o *Operator) AddAccount(name string) (*Account, error) {
+	path := filepath.Join(o.accountDir(name), name+".jwt")
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("account %s: %w", name, ErrExists)
+	}
+
+	kp, err := generate(nkeys.CreateAccount)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.store.saveKey(kp); err != nil {
+		return nil, err
+	}
+
+	claims := jwt.NewAccountClaims(kp.Public)
+	claims.Name = name
+	if name != SystemAccount {
+		claims.Limits.JetStreamLimits = jwt.JetStreamLimits{MemoryStorage: -1, DiskStorage: -1, Streams: -1, Consumer: -1}
+	}
+	token, err := claims.Encode(o.kp)
+	if err != nil {
+		return nil, fmt.Errorf("encoding account %s: %w", name, err)
+	}
+	if err := WriteFile(path, token); err != nil {
+		return nil, err
+	}
+
+	signer, _ := nkeys.FromSeed([]byte(kp.Seed))
+	return &Account{Name: name, PublicKey: kp.Public, op: o, kp: signer}, nil
+}
+
+// Account reads account name and its seed
+func (o *Operator) Account(name string) (*Account, error) {
+	claims, err := readClaims(filepath.Join(o.accountDir(name), name+".jwt"), jwt.DecodeAccountClaims)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := o.store.KeyPair(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("account %s: %w", name, err)
+	}
+	return &Account{Name: name, PublicKey: claims.Subject, op: o, kp: kp}, nil
+}
+
+// Accounts returns the names of the operator's accounts, sorted
+func (o *Operator) Accounts() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(o.store.Dir, o.Name, "accounts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading accounts of %s: %w", o.Name, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(o.accountDir(e.Name()), e.Name()+".jwt")); e.IsDir() && err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Claims reads the current claims of the account
+func (a *Account) Claims() (*jwt.AccountClaims, error) {
+	return readClaims(filepath.Join(a.op.accountDir(a.Name), a.Name+".jwt"), jwt.DecodeAccountClaims)
+}
+
+// UserOption customises the claims of a user
+type UserOption func(*jwt.UserClaims)
+
+// WithPermissions limits a user to publishing on pub and subscribing to
+// sub (default: everything)
+func WithPermissions(pub, sub []string) UserOption {
+	return func(uc *jwt.UserClaims) {
+		uc.Pub.Allow.Add(pub...)
+		uc.Sub.Allow.Add(sub...)
+	}
+}
+
+// AddUser creates user name, saves its JWT and creds in the store and
+// returns the creds file content
+func (a *Account) AddUser(name string, opts ...UserOption) ([]byte, error) {
+	if _, err := os.Stat(a.userPath(name)); err == nil {
+		return nil, fmt.Errorf("user %s: %w", name, ErrExists)
+	}
+
+	kp, err := GenerateNKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.op.store.saveKey(kp); err != nil {
+		return nil, err
+	}
+	return a.issueUser(name, kp, opts)
+}
+
+// UpdateUser re-issues the JWT of user name with opts, keeping its key so
+// running clients only need the new creds file. Previous permissions are
+// replaced.
+func (a *Account) UpdateUser(name string, opts ...UserOption) ([]byte, error) {
+	old, err := readClaims(a.userPath(name), jwt.DecodeUserClaims)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := a.op.store.KeyPair(old.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", name, err)
+	}
+	encoded, err := encode(kp)
+	if err != nil {
+		return nil, err
+	}
+	return a.issueUser(name, encoded, opts)
+}
+
+// issueUser signs a JWT for user key kp and writes it and its creds
+func (a *Account) issueUser(name string, kp KeyPair, opts []UserOption) ([]byte, error) {
+	claims := jwt.NewUserClaims(kp.Public)
+	claims.Name = name
+	for _, opt := range opts {
+		opt(claims)
+	}
+	token, err := claims.Encode(a.kp)
+	if err != nil {
+		return nil, fmt.Errorf("encoding user %s: %w", name, err)
+	}
+	creds, err := jwt.FormatUserConfig(token, []byte(kp.Seed))
+	if err != nil {
+		return nil, fmt.Errorf("formatting creds: %w", err)
+	}
+
+	if err := WriteFile(a.userPath(name), token); err != nil {
+		return nil, err
+	}
+	if err := WriteFile(a.credsPath(name), string(creds)); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// SignUser signs a user JWT without saving it or its key in the store,
+// for short-lived users the caller hands out directly
+func (a *Account) SignUser(claims *jwt.UserClaims) (string, error) {
+	token, err := claims.Encode(a.kp)
+	if err != nil {
+		return "", fmt.Errorf("encoding user %s: %w", claims.Name, err)
+	}
+	return token, nil
+}
+
+// Update re-signs the account JWT after fn changed its claims (exports,
+// imports, limits) and returns the new JWT
+func (a *Account) Update(fn func(*jwt.AccountClaims)) (string, error) {
+	claims, err := a.Claims()
+	if err != nil {
+		return "", err
+	}
+	fn(claims)
+	token, err := claims.Encode(a.op.kp)
+	if err != nil {
+		return "", fmt.Errorf("encoding account %s: %w", a.Name, err)
+	}
+	if err := WriteFile(filepath.Join(a.op.accountDir(a.Name), a.Name+".jwt"), token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// userPath returns the store path of the JWT of user name
+func (a *Account) userPath(name string) string {
+	return filepath.Join(a.op.accountDir(a.Name), "users", name+".jwt")
+}
+
+// Creds returns the creds file content of user name
+func (a *Account) Creds(name string) ([]byte, error) {
+	path := a.userPath(name)
+	token, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading user %s: %w", name, err)
+	}
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	kp, err := a.op.store.KeyPair(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", name, err)
+	}
+	seed, _ := kp.Seed()
+	creds, err := jwt.FormatUserConfig(token, seed)
+	if err != nil {
+		return nil, fmt.Errorf("formatting creds: %w", err)
+	}
+	return creds, nil
+}
+
+// credsPath returns where nsc keeps the creds of user name
+func (a *Account) credsPath(name string) string {
+	return filepath.Join(a.op.store.KeysDir, "creds", a.op.Name, a.Name, name+".creds")
+}
+
+// readClaims reads and decodes a JWT file
+func readClaims[T any](path string, decode func(string) (T, error)) (T, error) {
+	var zero T
+	token, err := readFile(path)
+	if err != nil {
+		return zero, fmt.Errorf("reading %s: %w", path, err)
+	}
+	claims, err := decode(token)
+	if err != nil {
+		return zero, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return claims, nil
+}
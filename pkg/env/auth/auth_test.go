@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+func TestSetupKeepsCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  string
+		setup func(dir string) (string, error) // Returns the credential
+	}{
+		{name: "token", mode: "token", setup: SetupToken},
+		{name: "nkey", mode: "nkey", setup: func(dir string) (string, error) {
+			kp, err := SetupNKey(dir)
+			return kp.Public, err
+		}},
+		{name: "callout", mode: "callout", setup: func(dir string) (string, error) {
+			kp, err := SetupCallout(dir)
+			return kp.Public, err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), ".auth")
+			first, err := tt.setup(dir)
+			if err != nil {
+				t.Fatalf("setup error = %v", err)
+			}
+			second, err := tt.setup(dir)
+			if err != nil {
+				t.Fatalf("second setup error = %v", err)
+			}
+			if first == "" || first != second {
+				t.Errorf("credential %q, then %q; want the same", first, second)
+			}
+			if mode, _ := readFile(filepath.Join(dir, "mode")); mode != tt.mode {
+				t.Errorf("mode = %q, want %q", mode, tt.mode)
+			}
+		})
+	}
+}
+
+func TestSetupNKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	kp, err := SetupNKey(dir)
+	if err != nil {
+		t.Fatalf("SetupNKey() error = %v", err)
+	}
+	if !nkeys.IsValidPublicUserKey(kp.Public) {
+		t.Errorf("public key %q is not a user key", kp.Public)
+	}
+	if pub, _ := readFile(filepath.Join(dir, "user.pub")); pub != kp.Public {
+		t.Errorf("user.pub = %q, want %q", pub, kp.Public)
+	}
+	info, err := os.Stat(filepath.Join(dir, "user.nk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("seed file mode = %o, want 600", perm)
+	}
+}
+
+func TestSetupJWT(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".auth")
+	store := Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+
+	if err := SetupJWT(dir, store); err != nil {
+		t.Fatalf("SetupJWT() error = %v", err)
+	}
+	creds, err := os.ReadFile(filepath.Join(dir, "creds", "user.creds"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := LoadOperator(store, DefaultOperator)
+	if err != nil {
+		t.Fatalf("LoadOperator() error = %v", err)
+	}
+	if op.SystemAccount == "" {
+		t.Error("operator has no system account")
+	}
+	// env decodes the operator JWT without trimming it
+	raw, _ := os.ReadFile(filepath.Join(store.Dir, DefaultOperator, DefaultOperator+".jwt"))
+	if _, err := jwt.DecodeOperatorClaims(string(raw)); err != nil {
+		t.Errorf("operator JWT file does not decode: %v", err)
+	}
+	app, err := op.Account("APP")
+	if err != nil {
+		t.Fatalf("Account(APP) error = %v", err)
+	}
+
+	token, err := jwt.ParseDecoratedJWT(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Issuer != app.PublicKey {
+		t.Errorf("user issuer = %s, want APP account %s", user.Issuer, app.PublicKey)
+	}
+
+	// A second run reuses the operator, account and user
+	if err := SetupJWT(dir, store); err != nil {
+		t.Fatalf("second SetupJWT() error = %v", err)
+	}
+	again, _ := os.ReadFile(filepath.Join(dir, "creds", "user.creds"))
+	if string(again) != string(creds) {
+		t.Error("creds changed on second SetupJWT")
+	}
+}
+
+func TestBootstrapOperatorExists(t *testing.T) {
+	store := Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+	op, err := BootstrapOperator(store, "acme")
+	if err != nil {
+		t.Fatalf("BootstrapOperator() error = %v", err)
+	}
+	if _, err := BootstrapOperator(store, "acme"); !errors.Is(err, ErrExists) {
+		t.Errorf("second BootstrapOperator() error = %v, want ErrExists", err)
+	}
+	if _, err := op.AddAccount(SystemAccount); !errors.Is(err, ErrExists) {
+		t.Errorf("AddAccount(SYS) error = %v, want ErrExists", err)
+	}
+
+	acct, err := op.AddAccount("ORDERS")
+	if err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+	if _, err := acct.AddUser("worker"); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	if _, err := acct.AddUser("worker"); !errors.Is(err, ErrExists) {
+		t.Errorf("second AddUser() error = %v, want ErrExists", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.KeysDir, "creds", "acme", "ORDERS", "worker.creds")); err != nil {
+		t.Errorf("creds not saved in keystore: %v", err)
+	}
+}
+
+func TestUpdateUserKeepsKey(t *testing.T) {
+	store := Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+	op, err := BootstrapOperator(store, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := op.AddAccount("ORDERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := acct.AddUser("worker", WithPermissions([]string{"orders.>"}, nil))
+	if err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	after, err := acct.UpdateUser("worker", WithPermissions([]string{"billing.>"}, []string{"_INBOX.>"}))
+	if err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+
+	old, updated := decodeCredsUser(t, before), decodeCredsUser(t, after)
+	if updated.Subject != old.Subject {
+		t.Errorf("user key changed: %s -> %s", old.Subject, updated.Subject)
+	}
+	if len(updated.Pub.Allow) != 1 || updated.Pub.Allow[0] != "billing.>" {
+		t.Errorf("Pub.Allow = %v, want [billing.>] (replaced)", updated.Pub.Allow)
+	}
+	if len(updated.Sub.Allow) != 1 || updated.Sub.Allow[0] != "_INBOX.>" {
+		t.Errorf("Sub.Allow = %v, want [_INBOX.>]", updated.Sub.Allow)
+	}
+}
+
+func TestAccountUpdate(t *testing.T) {
+	store := Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+	op, err := BootstrapOperator(store, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := op.AddAccount("ORDERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := acct.Update(func(ac *jwt.AccountClaims) {
+		ac.Exports.Add(&jwt.Export{Subject: "orders.>", Type: jwt.Service})
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	claims, err := jwt.DecodeAccountClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != op.PublicKey {
+		t.Errorf("Issuer = %s, want operator %s", claims.Issuer, op.PublicKey)
+	}
+	if len(claims.Exports) != 1 || claims.Limits.JetStreamLimits.Streams != -1 {
+		t.Errorf("claims lost exports or limits: %+v", claims)
+	}
+
+	reloaded, err := op.Account("ORDERS")
+	if err != nil || reloaded.PublicKey != acct.PublicKey {
+		t.Errorf("Account() = %v, %v; want the updated account", reloaded, err)
+	}
+}
+
+func TestSignUserNotStored(t *testing.T) {
+	store := Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+	op, err := BootstrapOperator(store, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := op.AddAccount("ORDERS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp, err := GenerateNKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uc := jwt.NewUserClaims(kp.Public)
+	uc.Name = "temp"
+	token, err := acct.SignUser(uc)
+	if err != nil {
+		t.Fatalf("SignUser() error = %v", err)
+	}
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != acct.PublicKey || claims.Subject != kp.Public {
+		t.Errorf("claims = %s issued by %s, want %s by account %s", claims.Subject, claims.Issuer, kp.Public, acct.PublicKey)
+	}
+	if _, err := acct.Creds("temp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Creds(temp) error = %v, want not stored", err)
+	}
+}
+
+// decodeCredsUser returns the user claims in a creds file
+func decodeCredsUser(t *testing.T, creds []byte) *jwt.UserClaims {
+	t.Helper()
+	token, err := jwt.ParseDecoratedJWT(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
@@ -0,0 +1,402 @@
+// authtest.go: In-process self-test of the auth lifecycle
+//
+// RunAuthSelfTest walks every auth mode (none -> token -> nkey -> jwt -> callout)
+// against ephemeral embedded servers: it generates throwaway credentials,
+// configures the server through the same code paths as a real node, and
+// checks that valid clients connect, invalid ones are rejected and
+// JetStream KV works for the authorised account. Nothing is read from
+// .auth/ or the NSC store, and no external tools (task, nsc, nk) are run,
+// so downstream repos can call it from CI:
+//
+//	func TestAuth(t *testing.T) {
+//	    if _, err := env.RunAuthSelfTest(context.Background()); err != nil {
+//	        t.Fatal(err)
+//	    }
+//	}
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// AuthModes are the auth lifecycle phases, from dev to production
+var AuthModes = []string{"none", "token", "nkey", "jwt", "callout"}
+
+// AuthCheckResult is the outcome of one self-test check
+type AuthCheckResult struct {
+	Mode     string        `json:"mode"`
+	Check    string        `json:"check"` // setup, accept, reject, jetstream
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Passed reports whether the check succeeded
+func (r AuthCheckResult) Passed() bool {
+	return r.Error == ""
+}
+
+// authFixture holds the throwaway credentials for one mode
+type authFixture struct {
+	cfg       *AuthConfig       // Server auth config (none/token/nkey/callout)
+	nscStore  string            // Ephemeral NSC store (jwt)
+	authorize CalloutAuthorizer // Callout service policy (callout)
+	valid     []nats.Option     // Credentials the server must accept
+	invalid   []nats.Option     // Credentials the server must reject (nil = none)
+}
+
+// RunAuthSelfTest runs the auth lifecycle checks for every mode and returns
+// all results; the error joins the failed checks
+func RunAuthSelfTest(ctx context.Context) ([]AuthCheckResult, error) {
+	dir, err := os.MkdirTemp("", "wellnown-authtest-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var results []AuthCheckResult
+	var errs []error
+	for _, mode := range AuthModes {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		for _, r := range runAuthMode(ctx, mode, filepath.Join(dir, mode)) {
+			results = append(results, r)
+			if !r.Passed() {
+				errs = append(errs, fmt.Errorf("%s %s: %s", r.Mode, r.Check, r.Error))
+			}
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// runAuthMode starts a server for mode and runs its checks
+func runAuthMode(ctx context.Context, mode, dir string) []AuthCheckResult {
+	var results []AuthCheckResult
+	check := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		r := AuthCheckResult{Mode: mode, Check: name, Duration: time.Since(start)}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+		return err == nil
+	}
+
+	var fixture *authFixture
+	var ns *server.Server
+	var callout *nats.Conn
+	ok := check("setup", func() error {
+		var err error
+		if fixture, err = newAuthFixture(mode, dir); err != nil {
+			return err
+		}
+		if ns, err = startAuthTestServer(mode, dir, fixture); err != nil {
+			return err
+		}
+		if fixture.authorize != nil {
+			if callout, err = startAuthTestCallout(ns.ClientURL(), fixture); err != nil {
+				ns.Shutdown()
+				return err
+			}
+		}
+		return nil
+	})
+	if !ok {
+		return results
+	}
+	defer func() {
+		if callout != nil {
+			callout.Close()
+		}
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	}()
+	url := ns.ClientURL()
+
+	var nc *nats.Conn
+	ok = check("accept", func() error {
+		var err error
+		nc, err = nats.Connect(url, append(fixture.valid, nats.Name("authtest"), nats.Timeout(5*time.Second))...)
+		if err != nil {
+			return fmt.Errorf("valid credentials rejected: %w", err)
+		}
+		return authTestRoundTrip(ctx, nc)
+	})
+	if nc != nil {
+		defer nc.Close()
+	}
+	if !ok {
+		return results
+	}
+
+	if mode != "none" {
+		check("reject", func() error {
+			if err := expectRejected(url, nil); err != nil {
+				return fmt.Errorf("no credentials: %w", err)
+			}
+			if err := expectRejected(url, fixture.invalid); err != nil {
+				return fmt.Errorf("invalid credentials: %w", err)
+			}
+			return nil
+		})
+	}
+
+	check("jetstream", func() error {
+		return authTestKV(ctx, nc)
+	})
+
+	return results
+}
+
+// startAuthTestServer starts an ephemeral server configured for mode
+func startAuthTestServer(mode, dir string, f *authFixture) (*server.Server, error) {
+	opts := &server.Options{
+		ServerName: "authtest-" + mode,
+		Host:       "127.0.0.1",
+		Port:       server.RANDOM_PORT,
+		JetStream:  true,
+		StoreDir:   filepath.Join(dir, "jetstream"),
+		NoLog:      true,
+		NoSigs:     true,
+	}
+
+	var err error
+	if mode == "jwt" {
+		err = configureJWTAuthFromStore(opts, f.nscStore)
+	} else {
+		err = ConfigureAuth(opts, f.cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuring auth: %w", err)
+	}
+
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("creating server: %w", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("server not ready within 10s")
+	}
+	return ns, nil
+}
+
+// startAuthTestCallout runs the fixture's callout service against url
+func startAuthTestCallout(url string, f *authFixture) (*nats.Conn, error) {
+	opts, err := GetClientConnectOptions(f.cfg)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := nats.Connect(url, append(opts, nats.Name("authtest-callout"), nats.Timeout(5*time.Second))...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting callout service: %w", err)
+	}
+	if _, err := StartAuthCallout(nc, f.cfg.CalloutSeed, f.authorize, nil); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return nc, nil
+}
+
+// newAuthFixture generates throwaway credentials for mode
+func newAuthFixture(mode, dir string) (*authFixture, error) {
+	switch mode {
+	case "none":
+		return &authFixture{cfg: &AuthConfig{Mode: "none"}}, nil
+
+	case "token":
+		token, err := auth.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		cfg := &AuthConfig{Mode: "token", Token: token}
+		valid, err := GetClientConnectOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &authFixture{cfg: cfg, valid: valid, invalid: []nats.Option{nats.Token("wrong-" + token)}}, nil
+
+	case "nkey":
+		kp, err := auth.GenerateNKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		other, err := auth.GenerateNKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		valid, err := nkeyClientOptions(kp.Seed)
+		if err != nil {
+			return nil, err
+		}
+		invalid, err := nkeyClientOptions(other.Seed)
+		if err != nil {
+			return nil, err
+		}
+		return &authFixture{cfg: &AuthConfig{Mode: "nkey", NKeyPub: kp.Public}, valid: valid, invalid: invalid}, nil
+
+	case "jwt":
+		return newJWTFixture(dir)
+
+	case "callout":
+		return newCalloutFixture()
+
+	default:
+		return nil, fmt.Errorf("unknown auth mode: %s", mode)
+	}
+}
+
+// newJWTFixture writes an ephemeral NSC store (operator, SYS and APP
+// accounts) plus creds for an APP user and for a user of an unknown account
+func newJWTFixture(dir string) (*authFixture, error) {
+	store := auth.Store{Dir: filepath.Join(dir, "nsc"), KeysDir: filepath.Join(dir, "keys")}
+	operator, err := auth.BootstrapOperator(store, auth.DefaultOperator)
+	if err != nil {
+		return nil, err
+	}
+	app, err := operator.AddAccount("APP")
+	if err != nil {
+		return nil, err
+	}
+	creds, err := app.AddUser("authtest")
+	if err != nil {
+		return nil, err
+	}
+	validDir := filepath.Join(dir, "creds")
+	if err := auth.WriteFile(filepath.Join(validDir, "user.creds"), string(creds)); err != nil {
+		return nil, err
+	}
+
+	// A well-formed user of an account the operator never signed
+	rogueStore := auth.Store{Dir: filepath.Join(dir, "rogue"), KeysDir: filepath.Join(dir, "rogue-keys")}
+	rogueOperator, err := auth.BootstrapOperator(rogueStore, auth.DefaultOperator)
+	if err != nil {
+		return nil, err
+	}
+	rogue, err := rogueOperator.AddAccount("APP")
+	if err != nil {
+		return nil, err
+	}
+	if creds, err = rogue.AddUser("authtest"); err != nil {
+		return nil, err
+	}
+	invalidDir := filepath.Join(dir, "creds-unknown")
+	if err := auth.WriteFile(filepath.Join(invalidDir, "user.creds"), string(creds)); err != nil {
+		return nil, err
+	}
+
+	valid, err := GetClientConnectOptions(&AuthConfig{Mode: "jwt", CredsDir: validDir})
+	if err != nil {
+		return nil, err
+	}
+	invalid, err := GetClientConnectOptions(&AuthConfig{Mode: "jwt", CredsDir: invalidDir})
+	if err != nil {
+		return nil, err
+	}
+	return &authFixture{nscStore: store.Dir, valid: valid, invalid: invalid}, nil
+}
+
+// newCalloutFixture creates an issuer account key and a callout service
+// that accepts one random token
+func newCalloutFixture() (*authFixture, error) {
+	issuer, err := nkeys.CreateAccount()
+	if err != nil {
+		return nil, err
+	}
+	issuerPub, _ := issuer.PublicKey()
+	seed, _ := issuer.Seed()
+
+	password, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	authorize := func(ctx context.Context, req *jwt.AuthorizationRequest) (*CalloutGrant, error) {
+		if req.ConnectOptions.Token != token {
+			return nil, fmt.Errorf("invalid token")
+		}
+		return &CalloutGrant{Name: "authtest"}, nil
+	}
+	return &authFixture{
+		cfg:       &AuthConfig{Mode: "callout", CalloutPassword: password, CalloutIssuer: issuerPub, CalloutSeed: string(seed)},
+		authorize: authorize,
+		valid:     []nats.Option{nats.Token(token)},
+		invalid:   []nats.Option{nats.Token("wrong-" + token)},
+	}, nil
+}
+
+// expectRejected fails if a client with opts can connect
+func expectRejected(url string, opts []nats.Option) error {
+	nc, err := nats.Connect(url, append(opts, nats.Name("authtest-reject"), nats.Timeout(5*time.Second))...)
+	if err != nil {
+		return nil
+	}
+	nc.Close()
+	return fmt.Errorf("connection accepted")
+}
+
+// authTestRoundTrip checks request/reply through the server
+func authTestRoundTrip(ctx context.Context, nc *nats.Conn) error {
+	sub, err := nc.Subscribe("authtest.echo", func(msg *nats.Msg) {
+		_ = msg.Respond(msg.Data)
+	})
+	if err != nil {
+		return fmt.Errorf("subscribing: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	reply, err := nc.RequestWithContext(ctx, "authtest.echo", []byte("ping"))
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	if string(reply.Data) != "ping" {
+		return fmt.Errorf("unexpected reply %q", reply.Data)
+	}
+	return nil
+}
+
+// authTestKV checks that the authorised account can use JetStream KV
+func authTestKV(ctx context.Context, nc *nats.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return fmt.Errorf("creating jetstream: %w", err)
+	}
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "authtest", Storage: jetstream.MemoryStorage})
+	if err != nil {
+		return fmt.Errorf("creating KV bucket: %w", err)
+	}
+	if _, err := kv.Put(ctx, "probe", []byte("ok")); err != nil {
+		return fmt.Errorf("putting: %w", err)
+	}
+	entry, err := kv.Get(ctx, "probe")
+	if err != nil {
+		return fmt.Errorf("getting: %w", err)
+	}
+	if string(entry.Value()) != "ok" {
+		return fmt.Errorf("unexpected value %q", entry.Value())
+	}
+	return nil
+}
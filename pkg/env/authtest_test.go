@@ -0,0 +1,33 @@
+package env
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunAuthSelfTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts an embedded server per auth mode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	results, err := RunAuthSelfTest(ctx)
+	if err != nil {
+		t.Fatalf("RunAuthSelfTest() error = %v", err)
+	}
+
+	// Every mode accepts, uses JetStream, and all but none reject
+	want := map[string]int{"none": 3, "token": 4, "nkey": 4, "jwt": 4, "callout": 4}
+	got := map[string]int{}
+	for _, r := range results {
+		got[r.Mode]++
+	}
+	for mode, n := range want {
+		if got[mode] != n {
+			t.Errorf("%s: %d checks, want %d", mode, got[mode], n)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// backend.go: Pluggable storage for the service registry
+//
+// Registrations live in the NATS KV bucket services_registry by default.
+// Programs that embed the SDK without NATS (or tests) can plug in another
+// store with WithRegistryBackend:
+//
+//	mgr, _ := env.New("APP", env.WithoutNATS(), env.WithRegistryBackend(env.NewMemoryRegistry()))
+//
+// A backend stores raw registration JSON under org.repo.instance keys and
+// must expire entries RegistryTTL after their last Put; heartbeats refresh
+// them. etcd (leases) and SQLite (an expires_at column) map onto this
+// directly. The registrar, discovery (GetService, WatchService, Resolver)
+// and RegistryAuthorizer work unchanged on any backend. services_static,
+// history and read replicas remain NATS-only.
+package env
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// RegistryTTL is how long a registration lives without a heartbeat
+const RegistryTTL = 30 * time.Second
+
+// ErrKeyNotFound is returned by RegistryBackend.Get for missing keys
+var ErrKeyNotFound = jetstream.ErrKeyNotFound
+
+// RegistryBackend stores service registrations
+type RegistryBackend interface {
+	// Put stores value under key and resets its expiry to RegistryTTL
+	Put(ctx context.Context, key string, value []byte) error
+	// Get returns the value of key, or ErrKeyNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Keys returns all live keys
+	Keys(ctx context.Context) ([]string, error)
+	// Watch calls fn for every later Put and Delete (deleted = true) until
+	// the watcher is stopped. Expiries need not be reported.
+	Watch(ctx context.Context, fn func(key string, value []byte, deleted bool)) (Watcher, error)
+}
+
+// WithRegistryBackend stores registrations in b instead of the NATS KV
+// bucket. Registration works without NATS when a backend is set.
+func WithRegistryBackend(b RegistryBackend) Option {
+	return func(o *Options) {
+		o.RegistryBackend = b
+	}
+}
+
+// backendKV presents a RegistryBackend as the jetstream.KeyValue the
+// registrar and discovery code use. Other KeyValue methods are not
+// implemented (the embedded interface is nil).
+type backendKV struct {
+	jetstream.KeyValue
+	b   RegistryBackend
+	rev atomic.Uint64 // Local revisions, KV entries carry one
+}
+
+// newBackendKV wraps b
+func newBackendKV(b RegistryBackend) *backendKV {
+	return &backendKV{b: b}
+}
+
+func (k *backendKV) Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error) {
+	value, err := k.b.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return backendEntry{key: key, value: value, op: jetstream.KeyValuePut}, nil
+}
+
+func (k *backendKV) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	if err := k.b.Put(ctx, key, value); err != nil {
+		return 0, err
+	}
+	return k.rev.Add(1), nil
+}
+
+func (k *backendKV) Delete(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	return k.b.Delete(ctx, key)
+}
+
+// Purge deletes key; backends keep no history to remove
+func (k *backendKV) Purge(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	return k.b.Delete(ctx, key)
+}
+
+func (k *backendKV) Keys(ctx context.Context, opts ...jetstream.WatchOpt) ([]string, error) {
+	keys, err := k.b.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, jetstream.ErrNoKeysFound
+	}
+	return keys, nil
+}
+
+func (k *backendKV) Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	return k.watch(ctx, keys)
+}
+
+func (k *backendKV) WatchAll(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	return k.watch(ctx, ">")
+}
+
+// watch delivers the current values of keys matching pattern, a nil
+// marker, then every change - the order a NATS KV watcher uses
+func (k *backendKV) watch(ctx context.Context, pattern string) (jetstream.KeyWatcher, error) {
+	w := &backendWatcher{
+		updates: make(chan jetstream.KeyValueEntry, 256),
+		stopCh:  make(chan struct{}),
+	}
+
+	// Changes wait until the initial values are queued; the lock is
+	// released by the goroutine sending them
+	w.mu.Lock()
+	sub, err := k.b.Watch(ctx, func(key string, value []byte, deleted bool) {
+		if !matchKey(pattern, key) {
+			return
+		}
+		e := backendEntry{key: key, value: value, op: jetstream.KeyValuePut}
+		if deleted {
+			e = backendEntry{key: key, op: jetstream.KeyValueDelete}
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.send(e)
+	})
+	if err != nil {
+		w.mu.Unlock()
+		return nil, fmt.Errorf("watching registry backend: %w", err)
+	}
+	w.sub = sub
+
+	keys, err := k.b.Keys(ctx)
+	if err != nil {
+		w.mu.Unlock()
+		w.Stop()
+		return nil, fmt.Errorf("listing registry backend: %w", err)
+	}
+
+	go func() {
+		defer w.mu.Unlock()
+		for _, key := range keys {
+			if !matchKey(pattern, key) {
+				continue
+			}
+			value, err := k.b.Get(ctx, key)
+			if err != nil {
+				continue // Deleted or expired since listing
+			}
+			w.send(backendEntry{key: key, value: value, op: jetstream.KeyValuePut})
+		}
+		w.send(nil) // End of initial values
+	}()
+
+	return w, nil
+}
+
+// matchKey reports whether key matches a NATS-style pattern (* = one
+// token, > = the rest)
+func matchKey(pattern, key string) bool {
+	pt := strings.Split(pattern, ".")
+	kt := strings.Split(key, ".")
+	for i, p := range pt {
+		if p == ">" {
+			return len(kt) > i
+		}
+		if i >= len(kt) || (p != "*" && p != kt[i]) {
+			return false
+		}
+	}
+	return len(pt) == len(kt)
+}
+
+// backendWatcher is the KeyWatcher returned by backendKV
+type backendWatcher struct {
+	mu       sync.Mutex // Orders initial values before changes
+	updates  chan jetstream.KeyValueEntry
+	sub      Watcher
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// send queues e unless the watcher is stopped
+func (w *backendWatcher) send(e jetstream.KeyValueEntry) {
+	select {
+	case w.updates <- e:
+	case <-w.stopCh:
+	}
+}
+
+func (w *backendWatcher) Updates() <-chan jetstream.KeyValueEntry {
+	return w.updates
+}
+
+func (w *backendWatcher) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+		if w.sub != nil {
+			w.stopErr = w.sub.Stop()
+		}
+	})
+	return w.stopErr
+}
+
+// backendEntry is a KeyValueEntry built from backend data
+type backendEntry struct {
+	key   string
+	value []byte
+	op    jetstream.KeyValueOp
+}
+
+func (e backendEntry) Bucket() string                  { return RegistryBucket }
+func (e backendEntry) Key() string                     { return e.key }
+func (e backendEntry) Value() []byte                   { return e.value }
+func (e backendEntry) Revision() uint64                { return 0 }
+func (e backendEntry) Created() time.Time              { return time.Time{} }
+func (e backendEntry) Delta() uint64                   { return 0 }
+func (e backendEntry) Operation() jetstream.KeyValueOp { return e.op }
+
+// MemoryRegistry is an in-memory RegistryBackend for single-process use
+// and tests. It is safe for concurrent use.
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	entries  map[string]memoryEntry
+	watchers map[*memoryWatcher]struct{}
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+// memoryEntry is a stored value and its expiry
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryRegistry creates an empty in-memory registry
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		entries:  make(map[string]memoryEntry),
+		watchers: make(map[*memoryWatcher]struct{}),
+		ttl:      RegistryTTL,
+		now:      time.Now,
+	}
+}
+
+// Put stores value under key
+func (r *MemoryRegistry) Put(ctx context.Context, key string, value []byte) error {
+	r.mu.Lock()
+	r.entries[key] = memoryEntry{value: append([]byte(nil), value...), expires: r.now().Add(r.ttl)}
+	watchers := r.watcherList()
+	r.mu.Unlock()
+
+	for _, w := range watchers {
+		w.notify(key, value, false)
+	}
+	return nil
+}
+
+// Get returns the value of a live key
+func (r *MemoryRegistry) Get(ctx context.Context, key string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[key]
+	if !ok || !r.now().Before(e.expires) {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), e.value...), nil
+}
+
+// Delete removes key
+func (r *MemoryRegistry) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	_, ok := r.entries[key]
+	delete(r.entries, key)
+	watchers := r.watcherList()
+	r.mu.Unlock()
+
+	if ok {
+		for _, w := range watchers {
+			w.notify(key, nil, true)
+		}
+	}
+	return nil
+}
+
+// Keys returns the live keys in sorted order, dropping expired entries
+func (r *MemoryRegistry) Keys(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	keys := make([]string, 0, len(r.entries))
+	for key, e := range r.entries {
+		if !now.Before(e.expires) {
+			delete(r.entries, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Watch calls fn for every later Put and Delete
+func (r *MemoryRegistry) Watch(ctx context.Context, fn func(key string, value []byte, deleted bool)) (Watcher, error) {
+	w := &memoryWatcher{registry: r, fn: fn}
+	r.mu.Lock()
+	r.watchers[w] = struct{}{}
+	r.mu.Unlock()
+	return w, nil
+}
+
+// watcherList copies the watchers so they are called without r.mu held
+func (r *MemoryRegistry) watcherList() []*memoryWatcher {
+	list := make([]*memoryWatcher, 0, len(r.watchers))
+	for w := range r.watchers {
+		list = append(list, w)
+	}
+	return list
+}
+
+// memoryWatcher is a Watch subscription on a MemoryRegistry
+type memoryWatcher struct {
+	registry *MemoryRegistry
+	mu       sync.Mutex // One callback at a time, none after Stop
+	fn       func(key string, value []byte, deleted bool)
+	stopped  bool
+}
+
+// notify calls the callback unless the watcher is stopped
+func (w *memoryWatcher) notify(key string, value []byte, deleted bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stopped {
+		w.fn(key, value, deleted)
+	}
+}
+
+// Stop ends the subscription
+func (w *memoryWatcher) Stop() error {
+	w.registry.mu.Lock()
+	delete(w.registry.watchers, w)
+	w.registry.mu.Unlock()
+
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	return nil
+}
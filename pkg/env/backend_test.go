@@ -0,0 +1,169 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestMatchKey(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{pattern: "o.r.*", key: "o.r.abc", want: true},
+		{pattern: "o.r.*", key: "o.x.abc", want: false},
+		{pattern: "o.r.*", key: "o.r", want: false},
+		{pattern: "o.r.*", key: "o.r.a.b", want: false},
+		{pattern: ">", key: "o.r.abc", want: true},
+		{pattern: "o.>", key: "o.r.abc", want: true},
+		{pattern: "o.>", key: "o", want: false},
+		{pattern: "o.r.abc", key: "o.r.abc", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := matchKey(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("matchKey(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	r := NewMemoryRegistry()
+	r.now = func() time.Time { return now }
+
+	var events []string
+	w, err := r.Watch(ctx, func(key string, value []byte, deleted bool) {
+		if deleted {
+			events = append(events, "del "+key)
+		} else {
+			events = append(events, "put "+key+"="+string(value))
+		}
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	_ = r.Put(ctx, "o.r.a", []byte("1"))
+	_ = r.Put(ctx, "o.r.b", []byte("2"))
+	_ = r.Delete(ctx, "o.r.b")
+	_ = r.Delete(ctx, "o.r.missing") // Not an error, no event
+
+	if v, err := r.Get(ctx, "o.r.a"); err != nil || string(v) != "1" {
+		t.Errorf("Get(o.r.a) = %q, %v; want \"1\"", v, err)
+	}
+	if _, err := r.Get(ctx, "o.r.b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get(o.r.b) error = %v, want ErrKeyNotFound", err)
+	}
+
+	want := []string{"put o.r.a=1", "put o.r.b=2", "del o.r.b"}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("events[%d] = %q, want %q", i, events[i], want[i])
+		}
+	}
+
+	// Entries expire without a heartbeat
+	now = now.Add(RegistryTTL)
+	if keys, _ := r.Keys(ctx); len(keys) != 0 {
+		t.Errorf("Keys() after TTL = %v, want none", keys)
+	}
+
+	w.Stop()
+	_ = r.Put(ctx, "o.r.c", []byte("3"))
+	if len(events) != len(want) {
+		t.Errorf("watcher called after Stop: %v", events)
+	}
+}
+
+func TestBackendDiscovery(t *testing.T) {
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+
+	ctx := context.Background()
+	kv := newBackendKV(NewMemoryRegistry())
+
+	existing := NewRegistrar(kv, 0)
+	if err := existing.Register(ctx, "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	seen := make(chan registry.ServiceRegistration, 4)
+	w, err := WatchAll(ctx, kv, func(key string, reg *registry.ServiceRegistration, deleted bool) {
+		if !deleted {
+			seen <- *reg
+		}
+	})
+	if err != nil {
+		t.Fatalf("WatchAll() error = %v", err)
+	}
+	defer w.Stop()
+
+	// The current registration arrives first, then later ones
+	added := NewRegistrar(kv, 0)
+	if err := added.Register(ctx, "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	for _, want := range []string{existing.Registration().Instance.ID, added.Registration().Instance.ID} {
+		select {
+		case reg := <-seen:
+			if reg.Instance.ID != want {
+				t.Errorf("watched instance %s, want %s", reg.Instance.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("instance %s not watched", want)
+		}
+	}
+
+	all, err := GetAllServices(ctx, kv)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("GetAllServices() = %d registrations, %v; want 2", len(all), err)
+	}
+
+	if err := existing.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	if all, _ := GetAllServices(ctx, kv); len(all) != 1 {
+		t.Errorf("GetAllServices() after Deregister = %d registrations, want 1", len(all))
+	}
+}
+
+func TestManagerRegistryBackend(t *testing.T) {
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+
+	ctx := context.Background()
+	backend := NewMemoryRegistry()
+	m, err := New("APP", WithoutNATS(), WithRegistryBackend(backend))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if m.registrar == nil {
+		t.Fatal("no registrar with a registry backend")
+	}
+	if err := m.registrar.Register(ctx, "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	regs, err := m.GetAllServices(ctx)
+	if err != nil || len(regs) != 1 {
+		t.Fatalf("GetAllServices() = %d registrations, %v; want 1", len(regs), err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if keys, _ := backend.Keys(ctx); len(keys) != 0 {
+		t.Errorf("registrations left after Close: %v", keys)
+	}
+}
@@ -0,0 +1,333 @@
+// breakglass.go: Read-only snapshot for control plane outages
+//
+// When NATS auth is broken or the hub is down, the dashboard and
+// wellknown-check have nothing to show. A node can still serve what it
+// last knew: a snapshot over plain HTTP on its own port, guarded by a
+// token and independent of NATS.
+//
+//	BREAKGLASS_ADDR=:9911 BREAKGLASS_TOKEN=... BREAKGLASS_FILE=/var/lib/app/breakglass.json
+//
+//	curl -H "Authorization: Bearer $BREAKGLASS_TOKEN" http://edge-7:9911/snapshot
+//
+// The snapshot holds the config (secrets redacted), this registration,
+// the registrations last read from the registry, the latest process
+// states from the LocalStore, and NATS, maintenance and tag state. It is
+// refreshed every BreakGlassInterval. Parts that can't be read keep
+// their last value and the error is noted. With BreakGlassFile every
+// refresh is also written to disk (0600), so a node restarted during the
+// outage still has the registrations it last read.
+package env
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// BreakGlassInterval is how often the snapshot is refreshed
+var BreakGlassInterval = 30 * time.Second
+
+// breakGlassProcessWindow is how far back process states are read
+const breakGlassProcessWindow = 7 * 24 * time.Hour
+
+// BreakGlassSnapshot is what a node last knew about itself and the mesh
+type BreakGlassSnapshot struct {
+	Taken    time.Time `json:"taken"`
+	Restored bool      `json:"restored,omitempty"` // Loaded from BreakGlassFile, not refreshed yet
+
+	Prefix       string                         `json:"prefix"`
+	Build        BuildVersion                   `json:"build"`
+	Config       []supportField                 `json:"config,omitempty"`
+	Options      map[string]any                 `json:"options"`
+	Registration *registry.ServiceRegistration  `json:"registration,omitempty"`
+	Services     []registry.ServiceRegistration `json:"services,omitempty"`
+	ServicesAt   time.Time                      `json:"services_at,omitzero"` // Last successful registry read
+	Processes    []LocalEvent                   `json:"processes,omitempty"`  // Latest state per process
+	NATS         map[string]any                 `json:"nats"`
+	Maintenance  *Maintenance                   `json:"maintenance,omitempty"`
+	Tags         map[string]string              `json:"tags,omitempty"`
+
+	Errors map[string]string `json:"errors,omitempty"` // Parts that could not be refreshed
+}
+
+// WithBreakGlass serves the break-glass snapshot at addr, for requests
+// with token as bearer token
+func WithBreakGlass(addr, token string) Option {
+	return func(o *Options) {
+		o.BreakGlassAddr = addr
+		o.BreakGlassToken = token
+	}
+}
+
+// WithBreakGlassFile keeps the last break-glass snapshot in path
+func WithBreakGlassFile(path string) Option {
+	return func(o *Options) {
+		o.BreakGlassFile = path
+	}
+}
+
+// breakGlass refreshes and serves the snapshot
+type breakGlass struct {
+	token   string
+	file    string
+	collect func(ctx context.Context) BreakGlassSnapshot
+	logger  *slog.Logger
+
+	mu   sync.RWMutex
+	snap BreakGlassSnapshot
+
+	srv    *http.Server
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// newBreakGlass returns a break-glass endpoint serving collect's
+// snapshots, starting from the one in file (if any)
+func newBreakGlass(token, file string, collect func(ctx context.Context) BreakGlassSnapshot, logger *slog.Logger) *breakGlass {
+	b := &breakGlass{
+		token:   token,
+		file:    file,
+		collect: collect,
+		logger:  componentLogger(logger, "breakglass"),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if file != "" {
+		snap, err := readBreakGlassFile(file)
+		switch {
+		case err == nil:
+			snap.Restored = true
+			b.snap = snap
+		case !errors.Is(err, os.ErrNotExist):
+			b.logger.Warn("ignoring break-glass snapshot", "file", file, "error", err)
+		}
+	}
+	return b
+}
+
+// startBreakGlass serves the snapshot on addr in the background
+func (m *Manager) startBreakGlass(addr string) error {
+	if m.opts.BreakGlassToken == "" {
+		return fmt.Errorf("break-glass endpoint %s needs a token (BREAKGLASS_TOKEN)", addr)
+	}
+	b := newBreakGlass(m.opts.BreakGlassToken, m.opts.BreakGlassFile, m.breakGlassSnapshot, m.opts.Logger)
+	b.srv = &http.Server{
+		Addr:              addr,
+		Handler:           b,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	m.breakGlass = b
+
+	go func() {
+		if err := b.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			b.logger.Error("break-glass server failed", "addr", addr, "error", err)
+		}
+	}()
+	go b.run()
+	return nil
+}
+
+// stopBreakGlass stops refreshing and serving the snapshot
+func (m *Manager) stopBreakGlass() {
+	b := m.breakGlass
+	if b == nil {
+		return
+	}
+	close(b.stopCh)
+	<-b.done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.srv.Shutdown(ctx); err != nil {
+		b.logger.Warn("break-glass server shutdown failed", "error", err)
+	}
+}
+
+// run refreshes the snapshot now and then every BreakGlassInterval
+// until stopped
+func (b *breakGlass) run() {
+	defer close(b.done)
+	b.refresh()
+	ticker := time.NewTicker(BreakGlassInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-ticker.C:
+			b.refresh()
+		}
+	}
+}
+
+// refresh takes a new snapshot, keeping the last value of parts that
+// could not be read, and writes it to the file
+func (b *breakGlass) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	next := b.collect(ctx)
+
+	b.mu.Lock()
+	next = mergeBreakGlass(b.snap, next)
+	b.snap = next
+	b.mu.Unlock()
+
+	if b.file != "" {
+		if err := writeBreakGlassFile(b.file, next); err != nil {
+			b.logger.Warn("writing break-glass snapshot failed", "file", b.file, "error", err)
+		}
+	}
+}
+
+// snapshot returns the current snapshot
+func (b *breakGlass) snapshot() BreakGlassSnapshot {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.snap
+}
+
+// ServeHTTP serves the snapshot as JSON to requests with the token
+func (b *breakGlass) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	want := "Bearer " + b.token
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="breakglass"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != "/" && r.URL.Path != "/snapshot" {
+		http.NotFound(w, r)
+		return
+	}
+
+	snap := b.snapshot()
+	if snap.Taken.IsZero() {
+		http.Error(w, "no snapshot yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(snap)
+}
+
+// mergeBreakGlass fills the parts of next that could not be read from
+// prev
+func mergeBreakGlass(prev, next BreakGlassSnapshot) BreakGlassSnapshot {
+	if len(next.Config) == 0 {
+		next.Config = prev.Config
+	}
+	if next.Registration == nil {
+		next.Registration = prev.Registration
+	}
+	if _, failed := next.Errors["services"]; failed {
+		next.Services, next.ServicesAt = prev.Services, prev.ServicesAt
+	}
+	if _, failed := next.Errors["processes"]; failed || next.Processes == nil {
+		next.Processes = prev.Processes
+	}
+	return next
+}
+
+// breakGlassSnapshot collects the node's current state
+func (m *Manager) breakGlassSnapshot(ctx context.Context) BreakGlassSnapshot {
+	now := time.Now().UTC()
+	snap := BreakGlassSnapshot{
+		Taken:        now,
+		Prefix:       m.prefix,
+		Build:        ReadBuildVersion(),
+		Config:       m.supportConfig(),
+		Options:      supportOptions(m.opts),
+		Registration: m.Registration(),
+		NATS:         m.supportNATS(),
+		Maintenance:  m.Maintenance(),
+		Tags:         m.NodeTags(),
+	}
+	fail := func(part string, err error) {
+		if snap.Errors == nil {
+			snap.Errors = make(map[string]string)
+		}
+		snap.Errors[part] = err.Error()
+	}
+
+	if services, err := m.GetAllServices(ctx); err != nil {
+		fail("services", err)
+	} else {
+		snap.Services, snap.ServicesAt = services, now
+	}
+
+	if store := m.opts.LocalStore; store != nil {
+		events, err := store.Query(ctx, LocalQuery{Kind: LocalProcess, Since: now.Add(-breakGlassProcessWindow)})
+		if err != nil {
+			fail("processes", err)
+		} else {
+			snap.Processes = latestProcessStates(events)
+		}
+	}
+	return snap
+}
+
+// latestProcessStates returns the last event of each process
+func latestProcessStates(events []LocalEvent) []LocalEvent {
+	latest := make(map[string]int)
+	var out []LocalEvent
+	for _, e := range events {
+		i, ok := latest[e.Subject]
+		if !ok {
+			latest[e.Subject] = len(out)
+			out = append(out, e)
+			continue
+		}
+		if e.At.After(out[i].At) {
+			out[i] = e
+		}
+	}
+	return out
+}
+
+// readBreakGlassFile loads a snapshot written by writeBreakGlassFile
+func readBreakGlassFile(path string) (BreakGlassSnapshot, error) {
+	var snap BreakGlassSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// writeBreakGlassFile replaces path with snap, readable by the owner only
+func writeBreakGlassFile(path string, snap BreakGlassSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
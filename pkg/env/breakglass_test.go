@@ -0,0 +1,124 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestBreakGlassHandler(t *testing.T) {
+	b := newBreakGlass("s3cret", "", func(ctx context.Context) BreakGlassSnapshot {
+		return BreakGlassSnapshot{Taken: time.Now(), Prefix: "APP"}
+	}, nil)
+
+	req := func(method, path, auth string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if got := req(http.MethodGet, "/snapshot", "Bearer s3cret"); got != http.StatusServiceUnavailable {
+		t.Errorf("before the first refresh = %d, want 503", got)
+	}
+	b.refresh()
+
+	tests := []struct {
+		method, path, auth string
+		want               int
+	}{
+		{http.MethodGet, "/snapshot", "", http.StatusUnauthorized},
+		{http.MethodGet, "/snapshot", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/snapshot", "s3cret", http.StatusUnauthorized},
+		{http.MethodPost, "/snapshot", "Bearer s3cret", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/other", "Bearer s3cret", http.StatusNotFound},
+		{http.MethodGet, "/snapshot", "Bearer s3cret", http.StatusOK},
+		{http.MethodGet, "/", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := req(tt.method, tt.path, tt.auth); got != tt.want {
+			t.Errorf("%s %s (%q) = %d, want %d", tt.method, tt.path, tt.auth, got, tt.want)
+		}
+	}
+}
+
+func TestBreakGlassKeepsLastKnown(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "breakglass.json")
+	reg := &registry.ServiceRegistration{}
+	services := []registry.ServiceRegistration{*reg, *reg}
+	hubDown := false
+	collect := func(ctx context.Context) BreakGlassSnapshot {
+		snap := BreakGlassSnapshot{Taken: time.Now(), Registration: reg}
+		if hubDown {
+			snap.Errors = map[string]string{"services": "nats: no responders"}
+		} else {
+			snap.Services, snap.ServicesAt = services, snap.Taken
+		}
+		return snap
+	}
+
+	b := newBreakGlass("t", file, collect, nil)
+	b.refresh()
+	hubDown = true
+	b.refresh()
+	if got := b.snapshot(); len(got.Services) != 2 || got.Errors["services"] == "" {
+		t.Errorf("snapshot with the hub down = %d services, errors %v; want the last 2 and the error", len(got.Services), got.Errors)
+	}
+
+	// A restart starts from the file, before reaching the registry
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("snapshot file mode = %v, want 0600", info.Mode().Perm())
+	}
+	restarted := newBreakGlass("t", file, func(ctx context.Context) BreakGlassSnapshot {
+		return BreakGlassSnapshot{Taken: time.Now(), Errors: map[string]string{"services": "NATS is disabled"}}
+	}, nil)
+	snap := restarted.snapshot()
+	if !snap.Restored || len(snap.Services) != 2 {
+		t.Errorf("restored snapshot = %+v, want the 2 services from the file", snap)
+	}
+	restarted.refresh()
+	if snap := restarted.snapshot(); snap.Restored || len(snap.Services) != 2 || snap.Registration == nil {
+		t.Errorf("refreshed snapshot lost the last known state: %+v", snap)
+	}
+}
+
+func TestBreakGlassBadFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "breakglass.json")
+	if err := os.WriteFile(file, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b := newBreakGlass("t", file, nil, nil)
+	if !b.snapshot().Taken.IsZero() {
+		t.Error("a corrupt file was loaded")
+	}
+	if _, err := readBreakGlassFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readBreakGlassFile(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLatestProcessStates(t *testing.T) {
+	now := time.Now()
+	events := []LocalEvent{
+		{At: now.Add(-time.Minute), Subject: "api", State: "Running"},
+		{At: now, Subject: "api", State: "Completed"},
+		{At: now.Add(-time.Hour), Subject: "db", State: "Running"},
+	}
+	got := latestProcessStates(events)
+	if len(got) != 2 || got[0].State != "Completed" || got[1].State != "Running" {
+		t.Errorf("latestProcessStates() = %+v, want api Completed and db Running", got)
+	}
+}
@@ -0,0 +1,273 @@
+// Package build cross-compiles service binaries with their identity
+// stamped into the registry ldflags, replacing hand-written Makefiles:
+//
+//	info, _ := build.GitInfo(ctx, ".")
+//	artifacts, _ := build.Build(ctx, build.Config{
+//	    Package:   "./cmd/api",
+//	    Platforms: []build.Platform{{"linux", "amd64"}, {"linux", "arm64"}},
+//	    Info:      info,
+//	})
+//
+// Binaries are named <name>_<os>_<arch> (plus .exe on Windows) in the
+// output directory, next to a checksums.txt in sha256sum format. Those are
+// the names selfupdate looks for on GitHub releases; selfupdate.Publish
+// puts them in the object store for offline sites.
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/joeblew999/wellnown-env/pkg/env/selfupdate"
+)
+
+// registryPkg is the import path holding the identity ldflags variables
+const registryPkg = "github.com/joeblew999/wellnown-env/pkg/env/registry"
+
+// DefaultOutDir is where Build writes artifacts by default
+const DefaultOutDir = "dist"
+
+// Platform is a GOOS/GOARCH pair
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+// String returns os/arch
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// HostPlatform returns the platform of the running binary
+func HostPlatform() Platform {
+	return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+// ParsePlatforms parses a comma-separated os/arch list
+// (linux/amd64,linux/arm64)
+func ParsePlatforms(s string) ([]Platform, error) {
+	var platforms []Platform
+	seen := make(map[Platform]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		goos, goarch, ok := strings.Cut(part, "/")
+		if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+			return nil, fmt.Errorf("invalid platform %q (want os/arch)", part)
+		}
+		p := Platform{OS: goos, Arch: goarch}
+		if !seen[p] {
+			seen[p] = true
+			platforms = append(platforms, p)
+		}
+	}
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platforms in %q", s)
+	}
+	return platforms, nil
+}
+
+// GitInfo reads the identity of the repository containing dir: org and
+// repo from the origin remote, the commit, tag (git describe) and branch
+func GitInfo(ctx context.Context, dir string) (registry.GitHubInfo, error) {
+	var info registry.GitHubInfo
+	commit, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return info, err
+	}
+	info.Commit = commit
+
+	// Optional: tags, branch and remote may all be missing
+	info.Tag, _ = git(ctx, dir, "describe", "--tags", "--always", "--dirty")
+	if branch, err := git(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		info.Branch = branch
+	}
+	if remote, err := git(ctx, dir, "remote", "get-url", "origin"); err == nil {
+		info.Org, info.Repo, _ = ParseRemote(remote)
+	}
+	return info, nil
+}
+
+// git runs a git command in dir and returns its trimmed output
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ParseRemote returns the org and repo of a GitHub-style remote URL
+// (https://github.com/org/repo.git, git@github.com:org/repo.git)
+func ParseRemote(url string) (org, repo string, ok bool) {
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+		_, url, _ = strings.Cut(url, "/") // Drop the host
+	} else if _, rest, found := strings.Cut(url, ":"); found {
+		url = rest // scp-style user@host:org/repo
+	}
+	parts := strings.Split(url, "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", false
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], true
+}
+
+// LDFlags returns the -X flags stamping info into the registry variables
+// (empty fields are left out)
+func LDFlags(info registry.GitHubInfo) string {
+	var flags []string
+	for _, v := range []struct{ name, value string }{
+		{"GitOrg", info.Org},
+		{"GitRepo", info.Repo},
+		{"GitCommit", info.Commit},
+		{"GitTag", info.Tag},
+		{"GitBranch", info.Branch},
+	} {
+		if v.value != "" {
+			flags = append(flags, fmt.Sprintf("-X %s.%s=%s", registryPkg, v.name, v.value))
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// Config describes a build
+type Config struct {
+	Package   string              // Package to build (./cmd/api)
+	Dir       string              // Module directory ("" = current)
+	OutDir    string              // Output directory (default: DefaultOutDir)
+	Name      string              // Binary name (default: last element of Package)
+	Platforms []Platform          // Default: HostPlatform
+	Info      registry.GitHubInfo // Identity stamped with LDFlags
+	CGO       bool                // Keep cgo enabled (default: static builds)
+}
+
+// BinaryName returns the default binary name of pkg, its last path element
+func BinaryName(pkg string) string {
+	return path.Base(filepath.ToSlash(pkg))
+}
+
+// Artifact is one built binary
+type Artifact struct {
+	Platform Platform
+	Path     string
+	SHA256   string // Hex digest
+}
+
+// Build compiles cfg.Package for every platform and writes checksums.txt
+// to the output directory
+func Build(ctx context.Context, cfg Config) ([]Artifact, error) {
+	if cfg.Package == "" {
+		return nil, fmt.Errorf("no package to build")
+	}
+	if cfg.OutDir == "" {
+		cfg.OutDir = DefaultOutDir
+	}
+	if cfg.Name == "" {
+		cfg.Name = BinaryName(cfg.Package)
+	}
+	if cfg.Name == "." || cfg.Name == "/" {
+		return nil, fmt.Errorf("cannot name binary of %q (set Name)", cfg.Package)
+	}
+	if len(cfg.Platforms) == 0 {
+		cfg.Platforms = []Platform{HostPlatform()}
+	}
+	out, err := filepath.Abs(cfg.OutDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving output directory: %w", err)
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", out, err)
+	}
+
+	ldflags := strings.TrimSpace("-s -w " + LDFlags(cfg.Info))
+	cgo := "0"
+	if cfg.CGO {
+		cgo = "1"
+	}
+
+	var artifacts []Artifact
+	for _, p := range cfg.Platforms {
+		bin := filepath.Join(out, selfupdate.PlatformAssetName(cfg.Name, p.OS, p.Arch))
+		cmd := exec.CommandContext(ctx, "go", "build", "-trimpath", "-ldflags", ldflags, "-o", bin, cfg.Package)
+		cmd.Dir = cfg.Dir
+		cmd.Env = append(os.Environ(), "GOOS="+p.OS, "GOARCH="+p.Arch, "CGO_ENABLED="+cgo)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("building %s for %s: %w\n%s", cfg.Package, p, err, output)
+		}
+
+		sum, err := fileSHA256(bin)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, Artifact{Platform: p, Path: bin, SHA256: sum})
+	}
+
+	if err := WriteChecksums(filepath.Join(out, selfupdate.ChecksumsAsset), artifacts); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteChecksums merges artifacts into the sha256sum listing at path, so
+// several builds can share one output directory
+func WriteChecksums(path string, artifacts []Artifact) error {
+	sums := make(map[string]string)
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 {
+				sums[fields[1]] = fields[0]
+			}
+		}
+	}
+	for _, a := range artifacts {
+		sums[filepath.Base(a.Path)] = a.SHA256
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package build
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Platform
+		wantErr bool
+	}{
+		{in: "linux/amd64", want: []Platform{{"linux", "amd64"}}},
+		{in: "linux/amd64, linux/arm64,", want: []Platform{{"linux", "amd64"}, {"linux", "arm64"}}},
+		{in: "linux/amd64,linux/amd64", want: []Platform{{"linux", "amd64"}}},
+		{in: "linux", wantErr: true},
+		{in: "linux/", wantErr: true},
+		{in: "linux/arm/v7", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePlatforms(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePlatforms(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParsePlatforms(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParsePlatforms(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		url    string
+		org    string
+		repo   string
+		wantOK bool
+	}{
+		{url: "https://github.com/joeblew999/wellnown-env.git", org: "joeblew999", repo: "wellnown-env", wantOK: true},
+		{url: "https://github.com/joeblew999/wellnown-env/", org: "joeblew999", repo: "wellnown-env", wantOK: true},
+		{url: "git@github.com:joeblew999/wellnown-env.git", org: "joeblew999", repo: "wellnown-env", wantOK: true},
+		{url: "ssh://git@github.com/joeblew999/wellnown-env", org: "joeblew999", repo: "wellnown-env", wantOK: true},
+		{url: "https://github.com/joeblew999", wantOK: false},
+	}
+	for _, tt := range tests {
+		org, repo, ok := ParseRemote(tt.url)
+		if ok != tt.wantOK || org != tt.org || repo != tt.repo {
+			t.Errorf("ParseRemote(%q) = %q, %q, %v; want %q, %q, %v", tt.url, org, repo, ok, tt.org, tt.repo, tt.wantOK)
+		}
+	}
+}
+
+func TestLDFlags(t *testing.T) {
+	got := LDFlags(registry.GitHubInfo{Org: "acme", Repo: "api", Commit: "abc123", Tag: "v1.2.0"})
+	for _, want := range []string{
+		"-X " + registryPkg + ".GitOrg=acme",
+		"-X " + registryPkg + ".GitRepo=api",
+		"-X " + registryPkg + ".GitCommit=abc123",
+		"-X " + registryPkg + ".GitTag=v1.2.0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("LDFlags() = %q, missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, "GitBranch") {
+		t.Errorf("LDFlags() = %q, empty branch should be left out", got)
+	}
+	if got := LDFlags(registry.GitHubInfo{}); got != "" {
+		t.Errorf("LDFlags(empty) = %q, want empty", got)
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checksums.txt")
+	if err := WriteChecksums(path, []Artifact{{Path: "/dist/api_linux_amd64", SHA256: "aaa"}}); err != nil {
+		t.Fatal(err)
+	}
+	// A second build merges into the same listing
+	if err := WriteChecksums(path, []Artifact{{Path: "/dist/api_darwin_arm64", SHA256: "bbb"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "bbb  api_darwin_arm64\naaa  api_linux_amd64\n"
+	if string(data) != want {
+		t.Errorf("checksums.txt = %q, want %q", data, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/hello\n\ngo 1.21\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+
+	out := filepath.Join(dir, "dist")
+	artifacts, err := Build(context.Background(), Config{
+		Package:   ".",
+		Dir:       dir,
+		OutDir:    out,
+		Name:      "hello",
+		Platforms: []Platform{{"linux", "amd64"}, {"windows", "arm64"}},
+		Info:      registry.GitHubInfo{Tag: "v0.1.0"},
+	})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("Build() = %d artifacts, want 2", len(artifacts))
+	}
+	for i, want := range []string{"hello_linux_amd64", "hello_windows_arm64.exe"} {
+		if filepath.Base(artifacts[i].Path) != want {
+			t.Errorf("artifact %d = %s, want %s", i, artifacts[i].Path, want)
+		}
+		if sum, _ := fileSHA256(artifacts[i].Path); sum != artifacts[i].SHA256 {
+			t.Errorf("artifact %d SHA256 = %s, file has %s", i, artifacts[i].SHA256, sum)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(out, "checksums.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), artifacts[0].SHA256+"  hello_linux_amd64") {
+		t.Errorf("checksums.txt = %q, missing hello_linux_amd64", data)
+	}
+}
@@ -0,0 +1,165 @@
+// caller.go: Who sent a request to the hub
+//
+// Request bodies say whatever the sender likes, so the hub's access and
+// admin services don't take the caller's name from them. Callers sign
+// their requests with their NKey instead, and the hub looks the key up in
+// the role bindings (roles.go):
+//
+//	kp, _ := env.LoadCallerKey("alice.nk")
+//	g, creds, err := env.RequestAccess(ctx, nc, req, kp)
+//
+// The signature covers the subject, the reply subject, the time and the
+// body. A request someone copies therefore still answers to the signer's
+// inbox, and it is only accepted for CallerMaxSkew.
+package env
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// Headers of signed requests
+const (
+	callerKeyHeader       = "Wellknown-Caller-Key"
+	callerTimeHeader      = "Wellknown-Caller-Time"
+	callerSignatureHeader = "Wellknown-Caller-Signature"
+)
+
+// CallerMaxSkew is how far the time of a signed request may be off
+const CallerMaxSkew = time.Minute
+
+// ErrUnsigned is returned for requests without a caller signature
+var ErrUnsigned = errors.New("request is not signed")
+
+// LoadCallerKey reads the NKey seed a caller signs requests with (e.g.
+// from nk -gen user); bind its public key with role set --key
+func LoadCallerKey(path string) (nkeys.KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading caller key: %w", err)
+	}
+	kp, err := nkeys.FromSeed([]byte(strings.TrimSpace(string(data))))
+	if err != nil {
+		return nil, fmt.Errorf("parsing caller key %s: %w", path, err)
+	}
+	return kp, nil
+}
+
+// SignRequest signs msg, whose Subject and Reply must be set, with the
+// caller's key
+func SignRequest(msg *nats.Msg, kp nkeys.KeyPair, now time.Time) error {
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	stamp := now.UTC().Format(time.RFC3339Nano)
+	sig, err := kp.Sign(callerPayload(msg, stamp))
+	if err != nil {
+		return fmt.Errorf("signing request: %w", err)
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Header.Set(callerKeyHeader, pub)
+	msg.Header.Set(callerTimeHeader, stamp)
+	msg.Header.Set(callerSignatureHeader, base64.RawURLEncoding.EncodeToString(sig))
+	return nil
+}
+
+// VerifyRequest returns the public key that signed msg
+func VerifyRequest(msg *nats.Msg, now time.Time) (string, error) {
+	pub := msg.Header.Get(callerKeyHeader)
+	stamp := msg.Header.Get(callerTimeHeader)
+	if pub == "" || stamp == "" {
+		return "", ErrUnsigned
+	}
+	at, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return "", fmt.Errorf("malformed request time %q", stamp)
+	}
+	if d := now.Sub(at); d > CallerMaxSkew || d < -CallerMaxSkew {
+		return "", fmt.Errorf("request signed at %s, more than %s from now", stamp, CallerMaxSkew)
+	}
+	key, err := nkeys.FromPublicKey(pub)
+	if err != nil || !nkeys.IsValidPublicUserKey(pub) {
+		return "", fmt.Errorf("invalid caller key %q", pub)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(msg.Header.Get(callerSignatureHeader))
+	if err != nil {
+		return "", fmt.Errorf("malformed request signature")
+	}
+	if err := key.Verify(callerPayload(msg, stamp), sig); err != nil {
+		return "", fmt.Errorf("bad request signature from %s", pub)
+	}
+	return pub, nil
+}
+
+// callerPayload is what a caller signs
+func callerPayload(msg *nats.Msg, stamp string) []byte {
+	head := msg.Subject + "\n" + msg.Reply + "\n" + stamp + "\n"
+	return append([]byte(head), msg.Data...)
+}
+
+// signedRequest sends data to subject signed with kp and waits for the
+// reply. The reply subject is chosen before signing, as it is signed too.
+func signedRequest(ctx context.Context, nc *nats.Conn, subject string, data []byte, kp nkeys.KeyPair) (*nats.Msg, error) {
+	msg := nats.NewMsg(subject)
+	msg.Reply = nc.NewInbox()
+	msg.Data = data
+	if err := SignRequest(msg, kp, time.Now()); err != nil {
+		return nil, err
+	}
+
+	sub, err := nc.SubscribeSync(msg.Reply)
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to the reply: %w", err)
+	}
+	defer sub.Unsubscribe()
+	if err := sub.AutoUnsubscribe(1); err != nil {
+		return nil, err
+	}
+	if err := nc.PublishMsg(msg); err != nil {
+		return nil, err
+	}
+	reply, err := sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Data) == 0 && reply.Header.Get("Status") == "503" {
+		return nil, nats.ErrNoResponders
+	}
+	return reply, nil
+}
+
+// requestCaller returns the binding of whoever signed msg. A key bound to
+// no user, or any key without roles, gets a binding with only the key.
+func requestCaller(ctx context.Context, roles *RoleStore, msg *nats.Msg, now time.Time) (RoleBinding, error) {
+	pub, err := VerifyRequest(msg, now)
+	if err != nil {
+		return RoleBinding{}, err
+	}
+	if roles == nil {
+		return RoleBinding{PublicKey: pub}, nil
+	}
+	b, err := roles.KeyBinding(ctx, pub)
+	if errors.Is(err, ErrNoRole) {
+		return RoleBinding{PublicKey: pub}, nil
+	}
+	return b, err
+}
+
+// name returns who the caller is in audit events: the user, else the key
+func (b RoleBinding) name() string {
+	if b.User != "" {
+		return b.User
+	}
+	return b.PublicKey
+}
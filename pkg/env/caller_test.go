@@ -0,0 +1,59 @@
+package env
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	kp, _ := nkeys.CreateUser()
+	pub, _ := kp.PublicKey()
+	now := time.Now()
+
+	signed := func() *nats.Msg {
+		msg := nats.NewMsg(AccessGrantSubject)
+		msg.Reply = "_INBOX_alice.r1"
+		msg.Data = []byte(`{"user":"alice"}`)
+		if err := SignRequest(msg, kp, now); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	if got, err := VerifyRequest(signed(), now.Add(time.Second)); err != nil || got != pub {
+		t.Fatalf("VerifyRequest() = %q, %v; want %s", got, err, pub)
+	}
+	if _, err := VerifyRequest(nats.NewMsg(AccessGrantSubject), now); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("VerifyRequest(unsigned) error = %v, want ErrUnsigned", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(msg *nats.Msg)
+		at     time.Time
+	}{
+		{"data", func(msg *nats.Msg) { msg.Data = []byte(`{"user":"mallory"}`) }, now},
+		{"reply", func(msg *nats.Msg) { msg.Reply = "_INBOX_mallory.r1" }, now},
+		{"subject", func(msg *nats.Msg) { msg.Subject = AccessRevokeSubject }, now},
+		{"key", func(msg *nats.Msg) {
+			other, _ := nkeys.CreateUser()
+			otherPub, _ := other.PublicKey()
+			msg.Header.Set(callerKeyHeader, otherPub)
+		}, now},
+		{"stale", func(msg *nats.Msg) {}, now.Add(2 * CallerMaxSkew)},
+		{"early", func(msg *nats.Msg) {}, now.Add(-2 * CallerMaxSkew)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := signed()
+			tt.change(msg)
+			if got, err := VerifyRequest(msg, tt.at); err == nil {
+				t.Errorf("VerifyRequest() = %q, want error", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// callout.go: NATS auth callout (NATS_AUTH=callout)
+//
+// In callout mode the embedded server delegates client authentication to a
+// service subscribed to $SYS.REQ.USER.AUTH. The node's own connections log
+// in as CalloutUser, which bypasses the callout; every other client is sent
+// to the service, which answers with a signed user JWT or a rejection.
+//
+// Configuration (read by LoadAuthConfig):
+//
+//	NATS_CALLOUT_PASSWORD or .auth/callout.pass - password of CalloutUser
+//	.auth/callout.nk    - account NKey seed that signs responses
+//	NATS_CALLOUT_ISSUER - issuer public key, if the service runs elsewhere
+//
+// When the seed is present the Manager runs the reference handler itself.
+// RegistryAuthorizer accepts a client whose token is {key}:{secret}: key
+// names a live registration in services_registry (org.repo.instance) and
+// secret hashes to its token_hash. Every instance draws a random secret
+// and registers only the hash, so reading the registry grants nothing.
+// The registration must match the key it is stored under, and clients get
+// the service's own namespace (ServicePermissions without self-declared
+// subjects), only while the instance runs:
+//
+//	nc, _ := nats.Connect(url, nats.Token(mgr.CalloutToken()))
+//
+// Replace the policy with WithCalloutAuthorizer. Request encryption (xkey)
+// is not used.
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// CalloutUser is the server user the callout service (and the node's own
+// connections) log in as
+const CalloutUser = "auth"
+
+// DefaultCalloutExpiry is how long RegistryAuthorizer's users stay valid;
+// clients re-authenticate (and are re-checked) on reconnect after that
+const DefaultCalloutExpiry = 10 * time.Minute
+
+// calloutAccount is the account callout users are placed in (the global
+// account, as the server runs without operator JWTs)
+const calloutAccount = "$G"
+
+// calloutTimeout bounds an authorizer call; the server gives up after its
+// own auth timeout (2s by default)
+const calloutTimeout = time.Second
+
+// CalloutGrant is what an authorizer grants a client
+type CalloutGrant struct {
+	Name        string           // User name shown in connz (optional)
+	Permissions *jwt.Permissions // nil = no restrictions
+	Expires     time.Duration    // 0 = never
+}
+
+// CalloutAuthorizer decides whether a client may connect; an error rejects it
+type CalloutAuthorizer func(ctx context.Context, req *jwt.AuthorizationRequest) (*CalloutGrant, error)
+
+// AuthCallout is a running callout service
+type AuthCallout struct {
+	sub       *nats.Subscription
+	issuer    nkeys.KeyPair
+	authorize CalloutAuthorizer
+	logger    *slog.Logger
+}
+
+// calloutIssuer parses the account seed that signs callout responses
+func calloutIssuer(seed string) (nkeys.KeyPair, error) {
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("parsing issuer seed: %w", err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("getting issuer public key: %w", err)
+	}
+	if !nkeys.IsValidPublicAccountKey(pub) {
+		return nil, fmt.Errorf("issuer seed is not an account key")
+	}
+	return kp, nil
+}
+
+// StartAuthCallout serves auth callout requests on nc, which must be
+// logged in as CalloutUser. A nil logger uses slog.Default.
+func StartAuthCallout(nc *nats.Conn, issuerSeed string, authorize CalloutAuthorizer, logger *slog.Logger) (*AuthCallout, error) {
+	issuer, err := calloutIssuer(issuerSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AuthCallout{
+		issuer:    issuer,
+		authorize: authorize,
+		logger:    componentLogger(logger, "callout"),
+	}
+	a.sub, err = nc.Subscribe(server.AuthCalloutSubject, a.handle)
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to %s: %w", server.AuthCalloutSubject, err)
+	}
+	return a, nil
+}
+
+// handle answers one authorization request
+func (a *AuthCallout) handle(msg *nats.Msg) {
+	req, err := jwt.DecodeAuthorizationRequestClaims(string(msg.Data))
+	if err == nil && req.UserNkey == "" {
+		err = fmt.Errorf("missing user nkey")
+	}
+	if err != nil {
+		// Without the user key and server ID there is nothing to answer;
+		// the server times the client out
+		a.logger.Warn("dropping malformed callout request", "error", err)
+		return
+	}
+
+	resp := jwt.NewAuthorizationResponseClaims(req.UserNkey)
+	resp.Audience = req.Server.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), calloutTimeout)
+	grant, err := a.authorize(ctx, &req.AuthorizationRequest)
+	cancel()
+	if err == nil {
+		resp.Jwt, err = a.userJWT(req.UserNkey, grant)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		a.logger.Info("client rejected", "host", req.ClientInformation.Host, "name", req.ClientInformation.Name, "error", err)
+	}
+
+	token, err := resp.Encode(a.issuer)
+	if err != nil {
+		a.logger.Error("encoding callout response", "error", err)
+		return
+	}
+	if err := msg.Respond([]byte(token)); err != nil {
+		a.logger.Warn("sending callout response", "error", err)
+	}
+}
+
+// userJWT issues the user JWT for a granted client
+func (a *AuthCallout) userJWT(userKey string, grant *CalloutGrant) (string, error) {
+	if grant == nil {
+		grant = &CalloutGrant{}
+	}
+	uc := jwt.NewUserClaims(userKey)
+	uc.Audience = calloutAccount
+	uc.Name = grant.Name
+	if grant.Permissions != nil {
+		uc.Permissions = *grant.Permissions
+	}
+	if grant.Expires > 0 {
+		uc.Expires = time.Now().Add(grant.Expires).Unix()
+	}
+
+	token, err := uc.Encode(a.issuer)
+	if err != nil {
+		return "", fmt.Errorf("encoding user JWT: %w", err)
+	}
+	return token, nil
+}
+
+// Stop stops serving callout requests
+func (a *AuthCallout) Stop() error {
+	return a.sub.Unsubscribe()
+}
+
+// RegistryAuthorizer accepts clients whose token is {key}:{secret} for a
+// live registration in kv (services_registry) whose token_hash matches
+// secret and whose org/repo and instance match key. A client name, if
+// set, must be the service's. Grants cover the service's namespace and
+// dependencies (ServicePermissions without Capabilities.Subjects). Grants expire
+// after DefaultCalloutExpiry, so clients of a stopped instance are
+// dropped.
+func RegistryAuthorizer(kv jetstream.KeyValue) CalloutAuthorizer {
+	return func(ctx context.Context, req *jwt.AuthorizationRequest) (*CalloutGrant, error) {
+		token := req.ConnectOptions.Token
+		if token == "" {
+			return nil, fmt.Errorf("token required")
+		}
+		key, secret, ok := strings.Cut(token, ":")
+		if !ok || key == "" || secret == "" {
+			return nil, fmt.Errorf("unknown service token")
+		}
+
+		entry, err := kv.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrInvalidKey) {
+			return nil, fmt.Errorf("unknown service token")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("looking up token: %w", err)
+		}
+		reg, err := decodeRegistration(entry.Value())
+		if err != nil || reg.Instance.TokenHash == "" {
+			return nil, fmt.Errorf("unknown service token")
+		}
+		if subtle.ConstantTimeCompare([]byte(CalloutTokenHash(secret)), []byte(reg.Instance.TokenHash)) != 1 {
+			return nil, fmt.Errorf("unknown service token")
+		}
+
+		// The body is written by the service itself: it must describe
+		// the entry it is stored under
+		name := reg.GitHub.Name()
+		if key != reg.KVKey() || !validServiceName(name) {
+			return nil, fmt.Errorf("registration %s does not match its key", key)
+		}
+		if client := req.ConnectOptions.Name; client != "" && client != name && !strings.HasPrefix(client, name+"/") {
+			return nil, fmt.Errorf("client name %q is not service %s", client, name)
+		}
+
+		// Only the service's own namespace (and its dependencies), never
+		// subjects it declared for itself
+		reg.Capabilities.Subjects = nil
+		return &CalloutGrant{
+			Name:        name,
+			Permissions: ServicePermissions(reg).jwtPermissions(),
+			Expires:     DefaultCalloutExpiry,
+		}, nil
+	}
+}
+
+// CalloutTokenHash returns the token_hash registered for a callout token
+// secret (hex SHA-256)
+func CalloutTokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,157 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+func TestLoadCalloutConfig(t *testing.T) {
+	issuer, _ := nkeys.CreateAccount()
+	issuerPub, _ := issuer.PublicKey()
+	seed, _ := issuer.Seed()
+	other, _ := nkeys.CreateAccount()
+	otherPub, _ := other.PublicKey()
+	user, _ := nkeys.CreateUser()
+	userSeed, _ := user.Seed()
+
+	tests := []struct {
+		name       string
+		password   string
+		issuer     string // NATS_CALLOUT_ISSUER
+		seedFile   string // .auth/callout.nk
+		wantIssuer string
+		wantErr    bool
+	}{
+		{name: "seed", password: "pw", seedFile: string(seed), wantIssuer: issuerPub},
+		{name: "issuer only", password: "pw", issuer: issuerPub, wantIssuer: issuerPub},
+		{name: "matching issuer and seed", password: "pw", issuer: issuerPub, seedFile: string(seed), wantIssuer: issuerPub},
+		{name: "mismatched issuer", password: "pw", issuer: otherPub, seedFile: string(seed), wantErr: true},
+		{name: "no password", seedFile: string(seed), wantErr: true},
+		{name: "no issuer", password: "pw", wantErr: true},
+		{name: "user seed", password: "pw", seedFile: string(userSeed), wantErr: true},
+		{name: "user key as issuer", password: "pw", issuer: "U" + issuerPub[1:], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("NATS_AUTH", "callout")
+			t.Setenv("NATS_CALLOUT_PASSWORD", tt.password)
+			t.Setenv("NATS_CALLOUT_ISSUER", tt.issuer)
+			if tt.seedFile != "" {
+				if err := os.MkdirAll(filepath.Dir(authCalloutSeed), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(authCalloutSeed, []byte(tt.seedFile), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := LoadAuthConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadAuthConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.CalloutIssuer != tt.wantIssuer {
+				t.Errorf("CalloutIssuer = %q, want %q", cfg.CalloutIssuer, tt.wantIssuer)
+			}
+		})
+	}
+}
+
+func TestRegistryAuthorizer(t *testing.T) {
+	hash := CalloutTokenHash("s3cret")
+	kv := newMemKV()
+	kv.values["o.r.live"] = []byte(`{"version":10,"github":{"org":"o","repo":"r"},"instance":{"id":"live","token_hash":"` + hash + `"}}`)
+	kv.values["o.r.old"] = []byte(`{"version":2,"github":{"org":"o","repo":"r"},"instance":{"id":"old"}}`)
+	kv.values["o.r.bad"] = []byte(`{"github":`)
+	// Bodies a service could write under its own key
+	kv.values["o.r.spoof"] = []byte(`{"version":10,"github":{"org":"acme","repo":"billing"},"instance":{"id":"spoof","token_hash":"` + hash + `"}}`)
+	kv.values["o.r.other"] = []byte(`{"version":10,"github":{"org":"o","repo":"r"},"instance":{"id":"live","token_hash":"` + hash + `"}}`)
+	kv.values["o.r.wide"] = []byte(`{"version":10,"github":{"org":"o","repo":"r"},"instance":{"id":"wide","token_hash":"` + hash + `"},"capabilities":{"subjects":[">","$SYS.>","o.r.api.>"]}}`)
+	authorize := RegistryAuthorizer(kv)
+
+	tests := []struct {
+		name     string
+		token    string
+		client   string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "live registration", token: "o.r.live:s3cret", wantName: "o/r"},
+		{name: "client name of the service", token: "o.r.live:s3cret", client: "o/r/live", wantName: "o/r"},
+		{name: "client name of another service", token: "o.r.live:s3cret", client: "acme/billing", wantErr: true},
+		{name: "body claims another service", token: "o.r.spoof:s3cret", wantErr: true},
+		{name: "body claims another instance", token: "o.r.other:s3cret", wantErr: true},
+		{name: "declared subjects ignored", token: "o.r.wide:s3cret", wantName: "o/r"},
+		{name: "registry key alone", token: "o.r.live", wantErr: true},
+		{name: "wrong secret", token: "o.r.live:guess", wantErr: true},
+		{name: "token hash as secret", token: "o.r.live:" + hash, wantErr: true},
+		{name: "registration without token hash", token: "o.r.old:s3cret", wantErr: true},
+		{name: "unknown key", token: "o.r.gone:s3cret", wantErr: true},
+		{name: "malformed registration", token: "o.r.bad:s3cret", wantErr: true},
+		{name: "no token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &jwt.AuthorizationRequest{ConnectOptions: jwt.ConnectOptions{Token: tt.token, Name: tt.client}}
+			grant, err := authorize(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if grant.Name != tt.wantName {
+				t.Errorf("grant.Name = %q, want %q", grant.Name, tt.wantName)
+			}
+			if grant.Expires != DefaultCalloutExpiry {
+				t.Errorf("grant.Expires = %v, want %v", grant.Expires, DefaultCalloutExpiry)
+			}
+			// Scoped to the service, not the whole account
+			if grant.Permissions == nil || !grant.Permissions.Pub.Allow.Contains("o.r.>") {
+				t.Fatalf("grant.Permissions = %+v, want the service's permissions", grant.Permissions)
+			}
+			for _, subject := range []string{">", "$SYS.>", "o.r.api.>"} {
+				if grant.Permissions.Pub.Allow.Contains(subject) || grant.Permissions.Sub.Allow.Contains(subject) {
+					t.Errorf("grant.Permissions allow %s, want only the registry namespace", subject)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistrarCalloutToken(t *testing.T) {
+	org, repo := registry.GitOrg, registry.GitRepo
+	registry.GitOrg, registry.GitRepo = "acme", "orders"
+	t.Cleanup(func() { registry.GitOrg, registry.GitRepo = org, repo })
+
+	kv := newMemKV()
+	r := NewRegistrar(kv, 0)
+	if r.CalloutToken() != "" {
+		t.Error("CalloutToken() before Register is not empty")
+	}
+	if err := r.Register(context.Background(), "APP", &struct{}{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	token := r.CalloutToken()
+	key, secret, _ := strings.Cut(token, ":")
+	if key != r.Key() || len(secret) != 64 {
+		t.Fatalf("CalloutToken() = %q, want {key}:{secret}", token)
+	}
+	if strings.Contains(string(kv.values[key]), secret) {
+		t.Error("registration contains the secret")
+	}
+
+	req := &jwt.AuthorizationRequest{ConnectOptions: jwt.ConnectOptions{Token: token}}
+	if _, err := RegistryAuthorizer(kv)(context.Background(), req); err != nil {
+		t.Errorf("authorize(CalloutToken()) error = %v", err)
+	}
+}
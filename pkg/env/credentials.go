@@ -0,0 +1,318 @@
+// credentials.go: NATS credential rotation
+//
+// RotateCredentials replaces the credentials of the current auth mode in
+// .auth/ (the files auth.SetupToken, SetupNKey and SetupCreds write):
+//
+//	token - new random .auth/token
+//	nkey  - new .auth/user.nk and .auth/user.pub
+//	jwt   - new user key and JWT in .auth/creds/user.creds, signed by the
+//	        issuer of the old JWT (its seed is read from the nsc keystore)
+//
+// A CredentialRotator (WithCredentialRotation, or mgr.RotateCredentials on
+// demand) also switches the embedded server over and announces the
+// rotation, so clients can re-read .auth/ before their credentials stop
+// working:
+//
+//	env.OnRotate(nc, func(path string) { ... }) // path == env.CredentialsRotationPath
+//
+// How each mode hands over:
+//
+//	token - one token at a time: clients with the old token are
+//	        disconnected. The node's own connections reconnect with the new one.
+//	nkey  - the previous key stays accepted for the grace period. The
+//	        node's own connections keep the key they started with, so this
+//	        node accepts it until restart.
+//	jwt   - the server is not reloaded; new connections (the node's own
+//	        too) use the new creds file. Old user JWTs stay valid until they
+//	        expire or are revoked with nsc.
+package env
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/nats-io/jwt/v2"
+)
+
+// CredentialsRotationPath is the path rotation events carry
+// (subject secrets.rotated.nats.credentials)
+const CredentialsRotationPath = "nats.credentials"
+
+// DefaultRotationGrace is how long the previous NKey stays accepted
+const DefaultRotationGrace = 10 * time.Minute
+
+// RotateCredentials generates new credentials for cfg's mode, writes them
+// to .auth/ and returns the updated config. It does not touch a running
+// server; see CredentialRotator.
+func RotateCredentials(cfg *AuthConfig) (*AuthConfig, error) {
+	next := *cfg
+
+	switch cfg.Mode {
+	case "token":
+		if os.Getenv("NATS_TOKEN") != "" {
+			return nil, fmt.Errorf("token is set by NATS_TOKEN; rotate it there")
+		}
+		token, err := auth.GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		if err := auth.WriteFile(authTokenFile, token); err != nil {
+			return nil, err
+		}
+		next.Token = token
+
+	case "nkey":
+		kp, err := auth.GenerateNKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		if err := auth.WriteFile(authNKeySeed, kp.Seed); err != nil {
+			return nil, err
+		}
+		if err := auth.WriteFile(authNKeyPub, kp.Public); err != nil {
+			return nil, err
+		}
+		next.NKeyPub = kp.Public
+
+	case "jwt":
+		if err := rotateUserCreds(filepath.Join(cfg.CredsDir, "user.creds")); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("credential rotation needs NATS_AUTH=token, nkey or jwt (got %s)", cfg.Mode)
+	}
+
+	return &next, nil
+}
+
+// rotateUserCreds replaces the user in a creds file with a new key and JWT
+// carrying the same name and permissions
+func rotateUserCreds(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	token, err := jwt.ParseDecoratedJWT(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	old, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return fmt.Errorf("decoding user JWT in %s: %w", path, err)
+	}
+
+	store, err := auth.DefaultStore()
+	if err != nil {
+		return err
+	}
+	issuer, err := store.KeyPair(old.Issuer)
+	if err != nil {
+		return fmt.Errorf("signing key of %s: %w", old.Issuer, err)
+	}
+
+	kp, err := auth.GenerateNKeyPair()
+	if err != nil {
+		return err
+	}
+
+	uc := jwt.NewUserClaims(kp.Public)
+	uc.Name = old.Name
+	uc.User = old.User
+	if old.Expires > 0 {
+		uc.Expires = time.Now().Unix() + old.Expires - old.IssuedAt // Same lifetime
+	}
+	userJWT, err := uc.Encode(issuer)
+	if err != nil {
+		return fmt.Errorf("encoding user JWT: %w", err)
+	}
+
+	creds, err := jwt.FormatUserConfig(userJWT, []byte(kp.Seed))
+	if err != nil {
+		return fmt.Errorf("formatting creds: %w", err)
+	}
+	return auth.WriteFile(path, string(creds))
+}
+
+// CredentialRotator rotates a node's credentials, on a schedule or on demand
+type CredentialRotator struct {
+	node   *NATSNode
+	own    string // NKey of the node's own connections (nkey mode)
+	grace  time.Duration
+	logger *slog.Logger
+
+	mu   sync.Mutex  // Serialises rotations
+	prev string      // Previous NKey, accepted until drop fires
+	drop *time.Timer // Ends the grace period
+
+	paused atomic.Bool // Scheduled rotations skipped (maintenance)
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+// StartCredentialRotator rotates node's credentials every interval (0 =
+// only on Rotate). The previous NKey stays accepted for grace (0 =
+// DefaultRotationGrace). A nil logger uses slog.Default.
+func StartCredentialRotator(node *NATSNode, every, grace time.Duration, logger *slog.Logger) (*CredentialRotator, error) {
+	cfg := node.Auth()
+	if cfg == nil || (cfg.Mode != "token" && cfg.Mode != "nkey" && cfg.Mode != "jwt") {
+		return nil, fmt.Errorf("credential rotation needs NATS_AUTH=token, nkey or jwt")
+	}
+	if grace <= 0 {
+		grace = DefaultRotationGrace
+	}
+
+	r := &CredentialRotator{
+		node:   node,
+		own:    cfg.NKeyPub,
+		grace:  grace,
+		logger: componentLogger(logger, "rotation"),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if every > 0 {
+		go r.run(every)
+	} else {
+		close(r.done)
+	}
+
+	return r, nil
+}
+
+// run rotates on every tick until Stop
+func (r *CredentialRotator) run(every time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			if r.paused.Load() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := r.Rotate(ctx); err != nil {
+				r.logger.Warn("scheduled credential rotation failed", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// SetPaused pauses or resumes scheduled rotation; Rotate still works
+func (r *CredentialRotator) SetPaused(paused bool) {
+	r.paused.Store(paused)
+}
+
+// Rotate writes new credentials, switches the server over and publishes a
+// rotation event on CredentialsRotationPath
+func (r *CredentialRotator) Rotate(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cur := r.node.Auth()
+	next, err := RotateCredentials(cur)
+	if err != nil {
+		return fmt.Errorf("rotating %s credentials: %w", cur.Mode, err)
+	}
+
+	switch next.Mode {
+	case "token":
+		// The old token stops working on reload, so announce first
+		if err := r.announce(ctx); err != nil {
+			return err
+		}
+		if err := r.node.ReloadAuth(next); err != nil {
+			return err
+		}
+
+	case "nkey":
+		// Accept the new key before clients are told about it
+		if err := r.node.ReloadAuth(next, r.own, cur.NKeyPub); err != nil {
+			return err
+		}
+		r.prev = cur.NKeyPub
+		if r.drop != nil {
+			r.drop.Stop()
+		}
+		r.drop = time.AfterFunc(r.grace, r.dropPrevious)
+		if err := r.announce(ctx); err != nil {
+			return err
+		}
+
+	case "jwt":
+		// New user JWTs are valid as soon as they are signed
+		if err := r.announce(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.logger.Info("credentials rotated", "mode", next.Mode)
+	return nil
+}
+
+// announce publishes the rotation event and waits until the server has it
+func (r *CredentialRotator) announce(ctx context.Context) error {
+	conn := r.node.ControlConn()
+	if err := PublishRotation(conn, CredentialsRotationPath); err != nil {
+		return fmt.Errorf("publishing rotation event: %w", err)
+	}
+	if err := conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("publishing rotation event: %w", err)
+	}
+	return nil
+}
+
+// dropPrevious stops accepting the previous NKey once the grace period ends
+func (r *CredentialRotator) dropPrevious() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.prev == "" {
+		return
+	}
+	if err := r.node.ReloadAuth(r.node.Auth(), r.own); err != nil {
+		r.logger.Warn("dropping previous nkey failed", "nkey", r.prev, "error", err)
+		return
+	}
+	r.logger.Info("previous nkey no longer accepted", "nkey", r.prev)
+	r.prev = ""
+}
+
+// Stop ends scheduled rotation; credentials in use stay valid. Safe to
+// call more than once.
+func (r *CredentialRotator) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+		<-r.done
+
+		r.mu.Lock()
+		if r.drop != nil {
+			r.drop.Stop()
+		}
+		r.prev = ""
+		r.mu.Unlock()
+	})
+}
+
+// RotateCredentials rotates the node's credentials now
+func (m *Manager) RotateCredentials(ctx context.Context) error {
+	if m.rotator == nil {
+		return fmt.Errorf("credential rotation needs NATS with NATS_AUTH=token, nkey or jwt")
+	}
+	return m.rotator.Rotate(ctx)
+}
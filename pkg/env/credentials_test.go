@@ -0,0 +1,178 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+func TestRotateCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		setup   func(t *testing.T) // Writes the current credentials
+		wantErr bool
+	}{
+		{name: "token", mode: "token", setup: func(t *testing.T) {
+			writeTestFile(t, authTokenFile, "old-token")
+		}},
+		{name: "nkey", mode: "nkey", setup: func(t *testing.T) {
+			kp, _ := nkeys.CreateUser()
+			seed, _ := kp.Seed()
+			pub, _ := kp.PublicKey()
+			writeTestFile(t, authNKeySeed, string(seed))
+			writeTestFile(t, authNKeyPub, pub)
+		}},
+		{name: "jwt", mode: "jwt", setup: func(t *testing.T) {
+			writeTestFile(t, authCredsFile, testCreds(t))
+		}},
+		{name: "token from env", mode: "token", setup: func(t *testing.T) {
+			t.Setenv("NATS_TOKEN", "env-token")
+		}, wantErr: true},
+		{name: "none", mode: "none", setup: func(t *testing.T) {}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("NATS_AUTH", tt.mode)
+			t.Setenv("NATS_TOKEN", "")
+			t.Setenv("NKEYS_PATH", "") // Set by testCreds
+			tt.setup(t)
+
+			cur, err := LoadAuthConfig()
+			if err != nil {
+				t.Fatalf("LoadAuthConfig() error = %v", err)
+			}
+			before := authSnapshot(t, cur)
+
+			next, err := RotateCredentials(cur)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RotateCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			loaded, err := LoadAuthConfig()
+			if err != nil {
+				t.Fatalf("LoadAuthConfig() after rotation error = %v", err)
+			}
+			if !reflect.DeepEqual(loaded, next) {
+				t.Errorf("RotateCredentials() = %+v, but .auth/ now loads %+v", *next, *loaded)
+			}
+			if after := authSnapshot(t, loaded); after == before {
+				t.Errorf("credentials unchanged after rotation: %q", after)
+			}
+		})
+	}
+}
+
+func TestRotateUserCredsKeepsClaims(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, authCredsFile, testCreds(t))
+	old := readTestClaims(t)
+
+	if err := rotateUserCreds(authCredsFile); err != nil {
+		t.Fatalf("rotateUserCreds() error = %v", err)
+	}
+	rotated := readTestClaims(t)
+
+	if rotated.Subject == old.Subject {
+		t.Error("user key unchanged after rotation")
+	}
+	if rotated.Issuer != old.Issuer {
+		t.Errorf("Issuer = %s, want %s", rotated.Issuer, old.Issuer)
+	}
+	if rotated.Name != old.Name {
+		t.Errorf("Name = %q, want %q", rotated.Name, old.Name)
+	}
+	if len(rotated.Pub.Allow) != 1 || rotated.Pub.Allow[0] != "orders.>" {
+		t.Errorf("Pub.Allow = %v, want [orders.>]", rotated.Pub.Allow)
+	}
+
+	info, err := os.Stat(authCredsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("creds file mode = %o, want 600", perm)
+	}
+}
+
+// testCreds creates an account in a temporary nsc keystore (NKEYS_PATH)
+// and returns creds for a user it signed
+func testCreds(t *testing.T) string {
+	t.Helper()
+	account, _ := nkeys.CreateAccount()
+	accountPub, _ := account.PublicKey()
+	accountSeed, _ := account.Seed()
+
+	keys := t.TempDir()
+	t.Setenv("NKEYS_PATH", keys)
+	writeTestFile(t, filepath.Join(keys, "keys", accountPub[:1], accountPub[1:3], accountPub+".nk"), string(accountSeed))
+
+	user, _ := nkeys.CreateUser()
+	userPub, _ := user.PublicKey()
+	userSeed, _ := user.Seed()
+	uc := jwt.NewUserClaims(userPub)
+	uc.Name = "app"
+	uc.Pub.Allow.Add("orders.>")
+	token, err := uc.Encode(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := jwt.FormatUserConfig(token, userSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(creds)
+}
+
+// readTestClaims decodes the user JWT in .auth/creds/user.creds
+func readTestClaims(t *testing.T) *jwt.UserClaims {
+	t.Helper()
+	data, err := os.ReadFile(authCredsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.ParseDecoratedJWT(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+// authSnapshot returns the secret material cfg authenticates with
+func authSnapshot(t *testing.T, cfg *AuthConfig) string {
+	t.Helper()
+	switch cfg.Mode {
+	case "nkey":
+		seed, _ := readAuthFile(authNKeySeed)
+		return cfg.NKeyPub + seed
+	case "jwt":
+		data, _ := os.ReadFile(filepath.Join(cfg.CredsDir, "user.creds"))
+		return string(data)
+	default:
+		return cfg.Token
+	}
+}
+
+// writeTestFile writes content to path, creating its directory
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+// dashboard.go: The mesh dashboard of nats-node and wellknown-check
+//
+//	stop, err := mgr.ServeDashboard(":8090", env.HeaderIdentity("X-Forwarded-User"))
+//	handler, err := mgr.DashboardHandler(identify) // Mount it yourself
+//
+// Registers the mesh-wide pages (services, fleet, micro, changelog,
+// usage, server, auth, enrollment) on one Via instance and serves it behind
+// RoleMiddleware. Every request needs a user, identified by the
+// authenticating proxy in front, and the user's role in access_roles
+// decides what they see and do. Users without a role are refused.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+)
+
+// DefaultDashboardUserHeader is the header ServeDashboard callers read the
+// user from by default (oauth2-proxy and most ingress auth set it)
+const DefaultDashboardUserHeader = "X-Forwarded-User"
+
+// dashboardPages are the pages ServeDashboard registers, in nav order
+var dashboardPages = []struct{ title, href string }{
+	{"Dashboard", "/"},
+	{"Fleet", "/fleet"},
+	{"Micro", "/micro"},
+	{"Changelog", "/changelog"},
+	{"Usage", "/usage"},
+	{"Server", "/server"},
+	{"Auth", "/auth"},
+	{"Enrollment", "/enrollment"},
+}
+
+// DashboardHandler returns the mesh dashboard behind RoleMiddleware.
+// identify returns the user of a request (see HeaderIdentity).
+func (m *Manager) DashboardHandler(identify func(*http.Request) string) (http.Handler, error) {
+	js := m.JetStream()
+	if js == nil {
+		return nil, fmt.Errorf("dashboard needs JetStream (not connected to NATS?)")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	roles, err := OpenRoleStore(ctx, js)
+	if err != nil {
+		return nil, err
+	}
+
+	v := via.New()
+	v.Config(via.Options{DocumentTitle: "Mesh Dashboard", LogLvl: via.LogLevelWarn})
+	opts := DashboardOptions{NavBar: dashboardNav}
+	RegisterDashboardPage(v, m, nil, opts)
+	RegisterFleetPage(v, m, opts)
+	RegisterMicroPage(v, m, opts)
+	RegisterChangelogPage(v, m, opts)
+	RegisterUsagePage(v, m, opts)
+	RegisterServerPage(v, m, opts)
+	RegisterAuthPage(v, m, opts)
+	RegisterEnrollmentPage(v, m, opts)
+	RegisterFocusRetention(v)
+	return RoleMiddleware(roles, identify, v.Handler()), nil
+}
+
+// ServeDashboard serves DashboardHandler on addr. The listener is bound
+// before it returns, so a taken port is an error.
+func (m *Manager) ServeDashboard(addr string, identify func(*http.Request) string) (stop func(), err error) {
+	handler, err := m.DashboardHandler(identify)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			componentLogger(m.opts.Logger, "dashboard").Error("dashboard server failed", "addr", addr, "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			componentLogger(m.opts.Logger, "dashboard").Warn("dashboard shutdown failed", "error", err)
+		}
+	}, nil
+}
+
+// dashboardNav links the dashboard pages, title being the current one
+func dashboardNav(title string) h.H {
+	links := []h.H{h.Style("margin:20px 0")}
+	for i, page := range dashboardPages {
+		if i > 0 {
+			links = append(links, h.Text(" | "))
+		}
+		if page.title == title {
+			links = append(links, h.Strong(h.Text(page.title)))
+		} else {
+			links = append(links, h.A(h.Href(page.href), h.Text(page.title)))
+		}
+	}
+	return h.Nav(links...)
+}
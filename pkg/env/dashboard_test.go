@@ -0,0 +1,70 @@
+package env
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	t.Setenv("NATS_NO_TCP", "true")
+	m, err := New("DASH", WithoutGUI(), WithoutHeartbeat(), WithoutRegistration())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+
+	store, err := OpenRoleStore(context.Background(), m.JetStream())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Bind(context.Background(), RoleBinding{User: "alice", Role: RoleViewer})
+
+	handler, err := m.DashboardHandler(HeaderIdentity(DefaultDashboardUserHeader))
+	if err != nil {
+		t.Fatalf("DashboardHandler() error = %v", err)
+	}
+	get := func(user, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != "" {
+			req.Header.Set(DefaultDashboardUserHeader, user)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/", "/fleet", "/usage", "/server"} {
+		if rec := get("alice", path); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Enrollment") {
+			t.Errorf("GET %s as viewer = %d:\n%s", path, rec.Code, rec.Body)
+		}
+	}
+	if rec := get("", "/fleet"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /fleet anonymously = %d, want 401", rec.Code)
+	}
+	if rec := get("alice", "/enrollment"); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /enrollment as viewer = %d, want 403", rec.Code)
+	}
+}
+
+func TestServeDashboardPortTaken(t *testing.T) {
+	t.Setenv("NATS_NO_TCP", "true")
+	m, err := New("DASH", WithoutGUI(), WithoutHeartbeat(), WithoutRegistration())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if stop, err := m.ServeDashboard(ln.Addr().String(), HeaderIdentity(DefaultDashboardUserHeader)); err == nil {
+		stop()
+		t.Error("ServeDashboard() on a taken port succeeded")
+	}
+}
@@ -0,0 +1,313 @@
+// Package deploy runs binaries pulled from a NATS object store as
+// processes on a node, and rolls back to the previous build when a new one
+// fails its health check.
+//
+// Artifacts are the releases `wellknown-check build --publish` uploads
+// (one object per binary and platform, see selfupdate.ObjectName): raw
+// executables or .tar.gz archives. Signing one records an NKey signature
+// over its SHA-256 in the object's metadata:
+//
+//	kp, _ := nkeys.FromSeed(seed)
+//	deploy.Sign(ctx, obs, selfupdate.ObjectName("camera", "linux", "arm64"), kp)
+//
+// A Deployer on the node downloads the artifact into Dir, checks its
+// SHA-256 (and signature, when Signers is set), hands the executable to a
+// Runner and waits for the process to turn healthy. If it does not, the
+// previous build runs again:
+//
+//	d := &deploy.Deployer{Store: obs, Dir: "artifacts", Runner: r, Signers: []string{pub}}
+//	b, err := d.Deploy(ctx, deploy.Spec{Name: "camera", Version: "v1.2.0"})
+//
+// Nodes learn what to run from the deployments bucket, keyed by node name
+// (see WatchDeployments); pc-node runs the builds as process-compose
+// processes.
+package deploy
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/selfupdate"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// Object metadata keys (the version key is selfupdate's)
+const (
+	versionKey   = "version"
+	signatureKey = "signature" // Base64 NKey signature of the hex SHA-256
+	signerKey    = "signer"    // Public NKey of the signer
+)
+
+// DefaultHealthTimeout is how long a new build has to turn healthy
+const DefaultHealthTimeout = time.Minute
+
+// ErrRolledBack is returned by Deploy when the new build failed its
+// health check and the previous one runs again
+var ErrRolledBack = errors.New("rolled back")
+
+// Spec says which artifact a node runs as which process
+type Spec struct {
+	Name     string   `json:"name"`               // Process name
+	Artifact string   `json:"artifact,omitempty"` // Binary in the store (empty = Name)
+	Version  string   `json:"version,omitempty"`  // Required version (empty = the stored one)
+	SHA256   string   `json:"sha256,omitempty"`   // Required digest, hex (empty = any)
+	Entry    string   `json:"entry,omitempty"`    // Executable in an archive (empty = Artifact)
+	Args     []string `json:"args,omitempty"`     // Command line arguments
+}
+
+// Validate checks that spec names a process and, inside its build, an
+// entry
+func (s Spec) Validate() error {
+	if s.Name == "" || strings.ContainsAny(s.Name, `/\ `) || s.Name == "." || s.Name == ".." {
+		return fmt.Errorf("invalid process name %q", s.Name)
+	}
+	if s.Entry != "" && !filepath.IsLocal(filepath.FromSlash(s.Entry)) {
+		return fmt.Errorf("%s: entry %q escapes the build directory", s.Name, s.Entry)
+	}
+	return nil
+}
+
+// artifact returns the binary name in the store
+func (s Spec) artifact() string {
+	if s.Artifact != "" {
+		return s.Artifact
+	}
+	return s.Name
+}
+
+// Build is a downloaded and verified artifact
+type Build struct {
+	Name    string   `json:"name"`    // Process name
+	Version string   `json:"version"` // Artifact version
+	SHA256  string   `json:"sha256"`  // Artifact digest, hex
+	Path    string   `json:"path"`    // Executable
+	Args    []string `json:"args,omitempty"`
+}
+
+// Runner runs builds as processes
+type Runner interface {
+	// Run starts process b.Name with b's executable, replacing what it ran
+	Run(b Build) error
+	// Healthy returns once process name is up and healthy, or an error if
+	// it failed or ctx ended first
+	Healthy(ctx context.Context, name string) error
+}
+
+// Deployer downloads artifacts and runs them with rollback
+type Deployer struct {
+	Store   jetstream.ObjectStore // Artifacts (e.g. selfupdate.DefaultBucket)
+	Dir     string                // Local builds, one directory per process
+	Runner  Runner
+	Signers []string // Public NKeys trusted to sign artifacts (empty = unsigned accepted)
+
+	HealthTimeout time.Duration // Time a new build has to turn healthy (0 = DefaultHealthTimeout)
+	Logger        *slog.Logger  // nil = slog.Default
+}
+
+// Deploy fetches the artifact of spec and runs it. A build that does not
+// turn healthy in time is replaced by the previous one and Deploy returns
+// an error wrapping ErrRolledBack. Deploying the running build again only
+// makes sure it runs; it does not wait for health again.
+func (d *Deployer) Deploy(ctx context.Context, spec Spec) (Build, error) {
+	prev, hasPrev, err := d.current(spec.Name)
+	if err != nil {
+		return Build{}, err
+	}
+	b, err := d.Fetch(ctx, spec)
+	if err != nil {
+		return Build{}, err
+	}
+	if hasPrev && b.SHA256 == prev.SHA256 && slices.Equal(b.Args, prev.Args) {
+		// Already healthy; make sure it runs (e.g. after a node restart)
+		if err := d.Runner.Run(prev); err != nil {
+			return Build{}, fmt.Errorf("running %s %s: %w", spec.Name, prev.Version, err)
+		}
+		return prev, nil
+	}
+
+	logger := d.logger().With("process", spec.Name, "version", b.Version)
+	if err := d.Runner.Run(b); err != nil {
+		return Build{}, fmt.Errorf("running %s %s: %w", spec.Name, b.Version, err)
+	}
+	hctx, cancel := context.WithTimeout(ctx, d.healthTimeout())
+	err = d.Runner.Healthy(hctx, spec.Name)
+	cancel()
+	if err != nil {
+		if !hasPrev {
+			return Build{}, fmt.Errorf("%s %s unhealthy: %w", spec.Name, b.Version, err)
+		}
+		logger.Warn("build unhealthy, rolling back", "previous", prev.Version, "error", err)
+		if rerr := d.Runner.Run(prev); rerr != nil {
+			return Build{}, fmt.Errorf("%s %s unhealthy (%v), rolling back to %s: %w", spec.Name, b.Version, err, prev.Version, rerr)
+		}
+		return prev, fmt.Errorf("%s %s unhealthy (%v), %w to %s", spec.Name, b.Version, err, ErrRolledBack, prev.Version)
+	}
+
+	if err := d.setCurrent(b); err != nil {
+		return b, err
+	}
+	d.prune(b, prev)
+	logger.Info("deployed", "sha256", b.SHA256)
+	return b, nil
+}
+
+// Current returns the build running as process name, if any
+func (d *Deployer) Current(name string) (Build, bool, error) {
+	return d.current(name)
+}
+
+// current reads the build recorded for process name
+func (d *Deployer) current(name string) (Build, bool, error) {
+	data, err := os.ReadFile(d.currentFile(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return Build{}, false, nil
+	}
+	if err != nil {
+		return Build{}, false, fmt.Errorf("reading current build of %s: %w", name, err)
+	}
+	var b Build
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Build{}, false, fmt.Errorf("decoding current build of %s: %w", name, err)
+	}
+	return b, true, nil
+}
+
+// setCurrent records b as the healthy build of its process
+func (d *Deployer) setCurrent(b Build) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding current build of %s: %w", b.Name, err)
+	}
+	path := d.currentFile(b.Name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("recording current build of %s: %w", b.Name, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("recording current build of %s: %w", b.Name, err)
+	}
+	return nil
+}
+
+// currentFile is where the healthy build of process name is recorded
+func (d *Deployer) currentFile(name string) string {
+	return filepath.Join(d.Dir, name, "current.json")
+}
+
+// prune removes the builds of b's process other than b and prev
+func (d *Deployer) prune(b, prev Build) {
+	entries, err := os.ReadDir(filepath.Join(d.Dir, b.Name))
+	if err != nil {
+		return
+	}
+	keep := []string{buildDir(b), buildDir(prev)}
+	for _, e := range entries {
+		if e.IsDir() && !slices.Contains(keep, e.Name()) {
+			os.RemoveAll(filepath.Join(d.Dir, b.Name, e.Name()))
+		}
+	}
+}
+
+func (d *Deployer) healthTimeout() time.Duration {
+	if d.HealthTimeout > 0 {
+		return d.HealthTimeout
+	}
+	return DefaultHealthTimeout
+}
+
+func (d *Deployer) logger() *slog.Logger {
+	if d.Logger != nil {
+		return d.Logger.With("component", "deploy")
+	}
+	return slog.Default().With("component", "deploy")
+}
+
+// Sign records kp's signature over the SHA-256 of object name, so
+// Deployers trusting kp's public key accept it
+func Sign(ctx context.Context, store jetstream.ObjectStore, name string, kp nkeys.KeyPair) error {
+	info, err := store.GetInfo(ctx, name)
+	if err != nil {
+		return fmt.Errorf("signing %s: %w", name, err)
+	}
+	sum, err := objectSHA256(info)
+	if err != nil {
+		return fmt.Errorf("signing %s: %w", name, err)
+	}
+	sig, err := kp.Sign([]byte(sum))
+	if err != nil {
+		return fmt.Errorf("signing %s: %w", name, err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return fmt.Errorf("signing %s: %w", name, err)
+	}
+
+	meta := info.ObjectMeta
+	meta.Metadata = make(map[string]string, len(info.Metadata)+2)
+	for k, v := range info.Metadata {
+		meta.Metadata[k] = v
+	}
+	meta.Metadata[signatureKey] = encodeSignature(sig)
+	meta.Metadata[signerKey] = pub
+	if err := store.UpdateMeta(ctx, name, meta); err != nil {
+		return fmt.Errorf("signing %s: %w", name, err)
+	}
+	return nil
+}
+
+// objectSHA256 returns the hex SHA-256 the object store recorded
+func objectSHA256(info *jetstream.ObjectInfo) (string, error) {
+	digest, err := jetstream.DecodeObjectDigest(info.Digest)
+	if err != nil {
+		return "", fmt.Errorf("reading digest: %w", err)
+	}
+	return hex.EncodeToString(digest), nil
+}
+
+// verifySignature checks that a trusted signer signed sum
+func verifySignature(meta map[string]string, sum string, signers []string) error {
+	signer := meta[signerKey]
+	if signer == "" || meta[signatureKey] == "" {
+		return fmt.Errorf("artifact is not signed")
+	}
+	if !slices.Contains(signers, signer) {
+		return fmt.Errorf("artifact signed by untrusted key %s", signer)
+	}
+	pub, err := nkeys.FromPublicKey(signer)
+	if err != nil {
+		return fmt.Errorf("invalid signer key: %w", err)
+	}
+	sig, err := decodeSignature(meta[signatureKey])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if err := pub.Verify([]byte(sum), sig); err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// objectName returns the artifact object of spec for this platform
+func objectName(spec Spec) string {
+	return selfupdate.ObjectName(spec.artifact(), runtime.GOOS, runtime.GOARCH)
+}
+
+// buildDir names the directory of b under its process directory
+func buildDir(b Build) string {
+	if b.SHA256 == "" {
+		return ""
+	}
+	version := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(b.Version)
+	return version + "-" + b.SHA256[:12]
+}
@@ -0,0 +1,358 @@
+package deploy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// memStore is an object store in memory
+type memStore struct {
+	jetstream.ObjectStore
+	data map[string][]byte
+	info map[string]*jetstream.ObjectInfo
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: map[string][]byte{}, info: map[string]*jetstream.ObjectInfo{}}
+}
+
+// put stores data as the version of the artifact for this platform
+func (s *memStore) put(artifact, version string, data []byte) string {
+	name := objectName(Spec{Name: artifact})
+	sum := sha256.Sum256(data)
+	s.data[name] = data
+	s.info[name] = &jetstream.ObjectInfo{
+		ObjectMeta: jetstream.ObjectMeta{Name: name, Metadata: map[string]string{versionKey: version}},
+		Size:       uint64(len(data)),
+		Digest:     "SHA-256=" + base64.URLEncoding.EncodeToString(sum[:]),
+	}
+	return name
+}
+
+func (s *memStore) GetInfo(ctx context.Context, name string, opts ...jetstream.GetObjectInfoOpt) (*jetstream.ObjectInfo, error) {
+	info, ok := s.info[name]
+	if !ok {
+		return nil, jetstream.ErrObjectNotFound
+	}
+	copied := *info
+	return &copied, nil
+}
+
+func (s *memStore) Get(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) (jetstream.ObjectResult, error) {
+	data, ok := s.data[name]
+	if !ok {
+		return nil, jetstream.ErrObjectNotFound
+	}
+	return &memResult{Reader: bytes.NewReader(data), info: s.info[name]}, nil
+}
+
+func (s *memStore) UpdateMeta(ctx context.Context, name string, meta jetstream.ObjectMeta) error {
+	info, ok := s.info[name]
+	if !ok {
+		return jetstream.ErrObjectNotFound
+	}
+	info.ObjectMeta = meta
+	return nil
+}
+
+type memResult struct {
+	*bytes.Reader
+	info *jetstream.ObjectInfo
+}
+
+func (r *memResult) Close() error                         { return nil }
+func (r *memResult) Info() (*jetstream.ObjectInfo, error) { return r.info, nil }
+func (r *memResult) Error() error                         { return nil }
+
+// tarGz packs files (name to content) into a .tar.gz
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		h := &tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchExecutable(t *testing.T) {
+	store := newMemStore()
+	store.put("camera", "v1.0.0", []byte("#!/bin/sh\necho v1\n"))
+	d := &Deployer{Store: store, Dir: t.TempDir()}
+
+	b, err := d.Fetch(context.Background(), Spec{Name: "camera", Version: "v1.0.0", Args: []string{"-v"}})
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if b.Version != "v1.0.0" || len(b.SHA256) != 64 || len(b.Args) != 1 {
+		t.Errorf("Fetch() = %+v", b)
+	}
+	if filepath.Base(b.Path) != "camera" || !filepath.IsAbs(b.Path) {
+		t.Errorf("Path = %s, want an absolute path to camera", b.Path)
+	}
+	fi, err := os.Stat(b.Path)
+	if err != nil {
+		t.Fatalf("stat executable: %v", err)
+	}
+	if fi.Mode().Perm()&0o100 == 0 {
+		t.Errorf("executable mode = %v", fi.Mode())
+	}
+
+	// Fetched again from disk, even once the store lost it
+	delete(store.data, objectName(Spec{Name: "camera"}))
+	again, err := d.Fetch(context.Background(), Spec{Name: "camera"})
+	if err != nil || again.Path != b.Path {
+		t.Errorf("second Fetch() = %+v, %v, want %s", again, err, b.Path)
+	}
+}
+
+func TestFetchArchive(t *testing.T) {
+	store := newMemStore()
+	store.put("camera", "v1.0.0", tarGz(t, map[string]string{
+		"bin/camera":       "binary",
+		"share/model.onnx": "weights",
+	}))
+	d := &Deployer{Store: store, Dir: t.TempDir()}
+
+	b, err := d.Fetch(context.Background(), Spec{Name: "cam", Artifact: "camera", Entry: "bin/camera"})
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if !strings.HasSuffix(b.Path, filepath.Join("cam", buildDir(b), "bin", "camera")) {
+		t.Errorf("Path = %s", b.Path)
+	}
+	if data, err := os.ReadFile(filepath.Join(filepath.Dir(b.Path), "..", "share", "model.onnx")); err != nil || string(data) != "weights" {
+		t.Errorf("unpacked model = %q, %v", data, err)
+	}
+
+	// An archive without the entry is refused and leaves nothing behind
+	_, err = d.Fetch(context.Background(), Spec{Name: "other", Artifact: "camera", Entry: "bin/other"})
+	if err == nil || !strings.Contains(err.Error(), "has no bin/other") {
+		t.Errorf("Fetch() of a missing entry error = %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(d.Dir, "other")); len(entries) != 0 {
+		t.Errorf("failed fetch left %d entries", len(entries))
+	}
+}
+
+func TestFetchVerifies(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	name := store.put("camera", "v1.0.0", []byte("binary"))
+	d := &Deployer{Store: store, Dir: t.TempDir()}
+
+	tests := []struct {
+		name string
+		spec Spec
+		want string
+	}{
+		{name: "missing", spec: Spec{Name: "radar"}, want: "no artifact radar/"},
+		{name: "version", spec: Spec{Name: "camera", Version: "v2.0.0"}, want: "want v2.0.0"},
+		{name: "checksum", spec: Spec{Name: "camera", SHA256: strings.Repeat("0", 64)}, want: "checksum mismatch"},
+		{name: "name", spec: Spec{Name: "../camera"}, want: "invalid process name"},
+		{name: "entry", spec: Spec{Name: "camera", Entry: "../../bin/sh"}, want: "escapes the build directory"},
+	}
+	for _, tt := range tests {
+		_, err := d.Fetch(ctx, tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Fetch() error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Content that does not match the recorded digest
+	store.data[name] = []byte("tampered")
+	if _, err := d.Fetch(ctx, Spec{Name: "camera"}); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Fetch() of tampered content error = %v", err)
+	}
+}
+
+func TestFetchSignature(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	name := store.put("camera", "v1.0.0", []byte("binary"))
+
+	signer, _ := nkeys.CreateUser()
+	other, _ := nkeys.CreateUser()
+	pub, _ := signer.PublicKey()
+	d := &Deployer{Store: store, Dir: t.TempDir(), Signers: []string{pub}}
+
+	if _, err := d.Fetch(ctx, Spec{Name: "camera"}); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("Fetch() of unsigned artifact error = %v", err)
+	}
+
+	if err := Sign(ctx, store, name, other); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := d.Fetch(ctx, Spec{Name: "camera"}); err == nil || !strings.Contains(err.Error(), "untrusted key") {
+		t.Errorf("Fetch() signed by untrusted key error = %v", err)
+	}
+
+	if err := Sign(ctx, store, name, signer); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if got := store.info[name].Metadata[versionKey]; got != "v1.0.0" {
+		t.Errorf("Sign() lost the version, got %q", got)
+	}
+	if _, err := d.Fetch(ctx, Spec{Name: "camera"}); err != nil {
+		t.Errorf("Fetch() of signed artifact error = %v", err)
+	}
+
+	// A signature over another digest
+	store.put("radar", "v1.0.0", []byte("radar"))
+	radar := objectName(Spec{Name: "radar"})
+	store.info[radar].Metadata[signerKey] = pub
+	store.info[radar].Metadata[signatureKey] = store.info[name].Metadata[signatureKey]
+	if _, err := d.Fetch(ctx, Spec{Name: "radar"}); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("Fetch() with a copied signature error = %v", err)
+	}
+}
+
+func TestExtractTarGzRefusesEscapes(t *testing.T) {
+	data := tarGz(t, map[string]string{"../evil": "x"})
+	err := extractTarGz(bytes.NewReader(data), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "escapes") {
+		t.Errorf("extractTarGz() error = %v", err)
+	}
+}
+
+// fakeRunner records the builds it ran; versions in unhealthy fail
+type fakeRunner struct {
+	ran       []string
+	unhealthy map[string]bool
+	current   Build
+}
+
+func (r *fakeRunner) Run(b Build) error {
+	r.ran = append(r.ran, b.Version)
+	r.current = b
+	return nil
+}
+
+func (r *fakeRunner) Healthy(ctx context.Context, name string) error {
+	if r.unhealthy[r.current.Version] {
+		return errors.New("exited with code 1")
+	}
+	return nil
+}
+
+func TestDeployRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	runner := &fakeRunner{unhealthy: map[string]bool{"v2.0.0": true}}
+	d := &Deployer{
+		Store:         store,
+		Dir:           t.TempDir(),
+		Runner:        runner,
+		HealthTimeout: time.Second,
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	// A first build that fails has nothing to roll back to
+	store.put("camera", "v2.0.0", []byte("v2"))
+	if _, err := d.Deploy(ctx, Spec{Name: "camera"}); err == nil || errors.Is(err, ErrRolledBack) {
+		t.Errorf("Deploy() of unhealthy first build error = %v", err)
+	}
+	if _, ok, _ := d.Current("camera"); ok {
+		t.Error("unhealthy build recorded as current")
+	}
+
+	store.put("camera", "v1.0.0", []byte("v1"))
+	v1, err := d.Deploy(ctx, Spec{Name: "camera"})
+	if err != nil {
+		t.Fatalf("Deploy(v1) error = %v", err)
+	}
+
+	store.put("camera", "v2.0.0", []byte("v2"))
+	b, err := d.Deploy(ctx, Spec{Name: "camera"})
+	if !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("Deploy(v2) error = %v, want ErrRolledBack", err)
+	}
+	if b.Version != "v1.0.0" || runner.current.Path != v1.Path {
+		t.Errorf("after rollback running %+v, want %s", runner.current, v1.Path)
+	}
+	if cur, ok, err := d.Current("camera"); !ok || err != nil || cur.Version != "v1.0.0" {
+		t.Errorf("Current() = %+v, %v, %v, want v1.0.0", cur, ok, err)
+	}
+
+	// The healthy build again only makes sure it runs
+	store.put("camera", "v1.0.0", []byte("v1"))
+	runner.ran = nil
+	if _, err := d.Deploy(ctx, Spec{Name: "camera"}); err != nil {
+		t.Errorf("Deploy(v1) again error = %v", err)
+	}
+	if len(runner.ran) != 1 || runner.ran[0] != "v1.0.0" {
+		t.Errorf("ran %v, want [v1.0.0]", runner.ran)
+	}
+}
+
+func TestDeployPrunes(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	d := &Deployer{Store: store, Dir: t.TempDir(), Runner: &fakeRunner{}, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	for _, version := range []string{"v1.0.0", "v2.0.0", "v3.0.0"} {
+		store.put("camera", version, []byte(version))
+		if _, err := d.Deploy(ctx, Spec{Name: "camera"}); err != nil {
+			t.Fatalf("Deploy(%s) error = %v", version, err)
+		}
+	}
+	var builds []string
+	entries, _ := os.ReadDir(filepath.Join(d.Dir, "camera"))
+	for _, e := range entries {
+		if e.IsDir() {
+			builds = append(builds, e.Name())
+		}
+	}
+	if len(builds) != 2 || !strings.HasPrefix(builds[0], "v2.0.0-") || !strings.HasPrefix(builds[1], "v3.0.0-") {
+		t.Errorf("kept builds %v, want v2.0.0 and v3.0.0", builds)
+	}
+}
+
+func TestDecodeSpecs(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{data: `[{"name":"camera"},{"name":"radar","artifact":"radar-arm"}]`},
+		{data: `[{"name":"camera"},{"name":"camera"}]`, want: "deployed twice"},
+		{data: `[{"name":"a/b"}]`, want: "invalid process name"},
+		{data: `{`, want: "unexpected end"},
+	}
+	for _, tt := range tests {
+		specs, err := decodeSpecs([]byte(tt.data))
+		if tt.want == "" && (err != nil || len(specs) != 2) {
+			t.Errorf("decodeSpecs(%s) = %v, %v", tt.data, specs, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("decodeSpecs(%s) error = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
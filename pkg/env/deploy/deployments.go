@@ -0,0 +1,97 @@
+// deployments.go: What each node runs, in a KV bucket
+//
+//	kv, _ := deploy.OpenDeploymentsBucket(ctx, js)
+//	deploy.SetDeployments(ctx, kv, "edge-7", []deploy.Spec{{Name: "camera", Version: "v1.2.0"}})
+//
+//	w, _ := deploy.WatchDeployments(ctx, kv, "edge-7", func(specs []deploy.Spec) { ... })
+//	defer w.Stop()
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DeploymentsBucket holds the specs each node runs, keyed by node name
+const DeploymentsBucket = "deployments"
+
+// OpenDeploymentsBucket creates (or opens) the deployments bucket
+func OpenDeploymentsBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      DeploymentsBucket,
+		Description: "Artifacts each node runs, for wellnown-env",
+		History:     5,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening deployments bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// SetDeployments replaces what node runs (no specs deletes the entry)
+func SetDeployments(ctx context.Context, kv jetstream.KeyValue, node string, specs []Spec) error {
+	if node == "" {
+		return fmt.Errorf("deployments need a node name")
+	}
+	if len(specs) == 0 {
+		if err := kv.Delete(ctx, node); err != nil {
+			return fmt.Errorf("clearing deployments of %s: %w", node, err)
+		}
+		return nil
+	}
+	if err := validateSpecs(specs); err != nil {
+		return err
+	}
+	if _, err := env.NewTypedKV[[]Spec](kv).Put(ctx, node, specs); err != nil {
+		return fmt.Errorf("setting deployments of %s: %w", node, err)
+	}
+	return nil
+}
+
+// WatchDeployments calls fn with the specs of node, now and on every
+// change; nil once they are deleted. Invalid entries are skipped.
+func WatchDeployments(ctx context.Context, kv jetstream.KeyValue, node string, fn func(specs []Spec)) (env.Watcher, error) {
+	deployments := env.NewTypedKV(kv, env.WithDecoder(decodeSpecs))
+	w, err := deployments.Watch(ctx, node, func(key string, specs *[]Spec, deleted bool) {
+		if deleted {
+			fn(nil)
+			return
+		}
+		fn(*specs)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("watching deployments of %s: %w", node, err)
+	}
+	return w, nil
+}
+
+// decodeSpecs decodes and validates a deployments entry
+func decodeSpecs(data []byte) ([]Spec, error) {
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, err
+	}
+	if err := validateSpecs(specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// validateSpecs checks every spec and that process names are unique
+func validateSpecs(specs []Spec) error {
+	seen := make(map[string]bool, len(specs))
+	for _, s := range specs {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("process %s deployed twice", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
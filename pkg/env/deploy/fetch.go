@@ -0,0 +1,200 @@
+// fetch.go: Download and verify artifacts
+package deploy
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// gzipMagic starts .tar.gz artifacts; anything else is an executable
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Fetch downloads the artifact of spec into Dir and verifies it. A build
+// already on disk with the same version and digest is reused.
+func (d *Deployer) Fetch(ctx context.Context, spec Spec) (Build, error) {
+	if err := spec.Validate(); err != nil {
+		return Build{}, err
+	}
+	name := objectName(spec)
+	info, err := d.Store.GetInfo(ctx, name)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return Build{}, fmt.Errorf("no artifact %s in the store", name)
+	}
+	if err != nil {
+		return Build{}, fmt.Errorf("looking up %s: %w", name, err)
+	}
+
+	version := info.Metadata[versionKey]
+	if spec.Version != "" && version != spec.Version {
+		return Build{}, fmt.Errorf("store has %s %s, want %s", name, version, spec.Version)
+	}
+	sum, err := objectSHA256(info)
+	if err != nil {
+		return Build{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if spec.SHA256 != "" && !strings.EqualFold(spec.SHA256, sum) {
+		return Build{}, fmt.Errorf("%s: checksum mismatch: store has %s, want %s", name, sum, spec.SHA256)
+	}
+	if len(d.Signers) > 0 {
+		if err := verifySignature(info.Metadata, sum, d.Signers); err != nil {
+			return Build{}, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	b := Build{Name: spec.Name, Version: version, SHA256: sum, Args: spec.Args}
+	dir, err := filepath.Abs(filepath.Join(d.Dir, spec.Name, buildDir(b)))
+	if err != nil {
+		return Build{}, fmt.Errorf("fetching %s: %w", name, err)
+	}
+	entry := spec.Entry
+	if entry == "" {
+		entry = spec.artifact()
+	}
+	b.Path = filepath.Join(dir, filepath.FromSlash(entry))
+	if _, err := os.Stat(b.Path); err == nil {
+		return b, nil // Fetched before
+	}
+
+	if err := d.download(ctx, name, sum, entry, dir); err != nil {
+		return Build{}, err
+	}
+	return b, nil
+}
+
+// download writes object name into dir: the executable as entry, or the
+// unpacked archive, which must contain entry. dir appears complete or not
+// at all.
+func (d *Deployer) download(ctx context.Context, name, sum, entry, dir string) error {
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return fmt.Errorf("fetching %s: %w", name, err)
+	}
+	tmp, err := os.MkdirTemp(parent, ".fetch-")
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", name, err)
+	}
+	defer os.RemoveAll(tmp) // Empty after the rename
+
+	r, err := d.Store.Get(ctx, name)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", name, err)
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, h))
+	head, _ := br.Peek(len(gzipMagic))
+	if bytes.Equal(head, gzipMagic) {
+		err = extractTarGz(br, tmp)
+	} else {
+		err = writeExecutable(br, filepath.Join(tmp, filepath.FromSlash(entry)))
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", name, err)
+	}
+	if _, err := io.Copy(io.Discard, br); err != nil { // Hash trailing archive padding
+		return fmt.Errorf("downloading %s: %w", name, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("downloading %s: checksum mismatch: got %s, want %s", name, got, sum)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, filepath.FromSlash(entry))); err != nil {
+		return fmt.Errorf("%s has no %s", name, entry)
+	}
+
+	os.RemoveAll(dir) // Left over from an interrupted fetch
+	if err := os.Rename(tmp, dir); err != nil {
+		return fmt.Errorf("fetching %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeExecutable writes r to path with mode 0755
+func writeExecutable(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// extractTarGz unpacks the regular files and directories of a .tar.gz
+// into dir. Entries escaping dir and links are refused.
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		name := filepath.FromSlash(h.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q escapes the build directory", h.Name)
+		}
+		path := filepath.Join(dir, name)
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, h.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("archive entry %q: unsupported type %c", h.Name, h.Typeflag)
+		}
+	}
+}
+
+// encodeSignature encodes an NKey signature for object metadata
+func encodeSignature(sig []byte) string {
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// decodeSignature decodes a signature from object metadata
+func decodeSignature(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s)
+}
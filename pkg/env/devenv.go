@@ -0,0 +1,191 @@
+// devenv.go: devenv.nix and process-compose fragments for local development
+//
+// BuildDevEnv turns a service's registration into a process with its env
+// vars and dependencies, ready to paste into devenv.nix or a
+// process-compose.yaml:
+//
+//	d := env.BuildDevEnv(*mgr.Registration(), "go run .")
+//	d.WriteNix(os.Stdout)            // env + processes.<repo>
+//	d.WriteProcessCompose(os.Stdout) // processes.<repo>
+//
+// Defaults become values. Secrets get a ref+file://./secrets/<key>.txt
+// placeholder, resolved by vals like any other ref. Required fields without
+// a default are left empty to fill in. Each service: dependency starts
+// first (depends_on, by repo name).
+package env
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// DevEnvVar is an environment variable of a DevEnv process
+type DevEnvVar struct {
+	Key      string
+	Value    string
+	Secret   bool // Value is a ref+file:// placeholder
+	Required bool // Required with no default; Value is empty
+}
+
+// DevEnv is one service as a local development process
+type DevEnv struct {
+	Service   string      // org/repo
+	Process   string      // Process name (repo)
+	Command   string      // Command starting the service
+	Env       []DevEnvVar // Sorted by key
+	DependsOn []string    // Process names of dependencies, sorted
+}
+
+// BuildDevEnv builds the process of reg run by command
+func BuildDevEnv(reg registry.ServiceRegistration, command string) *DevEnv {
+	d := &DevEnv{
+		Service: reg.GitHub.Name(),
+		Process: devProcessName(reg.GitHub.Name()),
+		Command: command,
+	}
+	if d.Process == "" {
+		d.Process = "service"
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range reg.Fields {
+		if f.EnvKey == "" || seen[f.EnvKey] {
+			continue
+		}
+		seen[f.EnvKey] = true
+		switch {
+		case f.IsSecret:
+			d.Env = append(d.Env, DevEnvVar{Key: f.EnvKey, Value: secretPlaceholder(f.EnvKey), Secret: true})
+		case f.Default != "":
+			d.Env = append(d.Env, DevEnvVar{Key: f.EnvKey, Value: f.Default})
+		case f.Required:
+			d.Env = append(d.Env, DevEnvVar{Key: f.EnvKey, Required: true})
+		}
+	}
+	sort.Slice(d.Env, func(i, j int) bool { return d.Env[i].Key < d.Env[j].Key })
+
+	for _, dep := range GetDependencies(reg.Fields) {
+		d.DependsOn = append(d.DependsOn, devProcessName(dep))
+	}
+	sort.Strings(d.DependsOn)
+	return d
+}
+
+// devProcessName returns the process name of org/repo (the repo)
+func devProcessName(service string) string {
+	_, repo, found := strings.Cut(service, "/")
+	if !found {
+		return service
+	}
+	return repo
+}
+
+// secretPlaceholder returns the local file ref of a secret env var
+func secretPlaceholder(key string) string {
+	return "ref+file://./secrets/" + strings.ToLower(key) + ".txt"
+}
+
+// WriteNix writes a devenv.nix module with the process's env vars and the
+// process itself
+func (d *DevEnv) WriteNix(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# devenv.nix fragment for %s\n", d.displayName())
+	b.WriteString("{ pkgs, ... }:\n\n{\n")
+
+	if len(d.Env) > 0 {
+		b.WriteString("  env = {\n")
+		for _, v := range d.Env {
+			fmt.Fprintf(&b, "    %s = %s;%s\n", v.Key, nixString(v.Value), v.comment(" #"))
+		}
+		b.WriteString("  };\n\n")
+	}
+
+	fmt.Fprintf(&b, "  processes.%s = {\n", nixString(d.Process))
+	fmt.Fprintf(&b, "    exec = %s;\n", nixString(d.Command))
+	if len(d.DependsOn) > 0 {
+		b.WriteString("    process-compose.depends_on = {\n")
+		for _, dep := range d.DependsOn {
+			fmt.Fprintf(&b, "      %s.condition = \"process_started\";\n", nixString(dep))
+		}
+		b.WriteString("    };\n")
+	}
+	b.WriteString("  };\n}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// nixString quotes s as a Nix string literal
+func nixString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// devProcess is a process in a process-compose.yaml
+type devProcess struct {
+	Command     string                   `yaml:"command"`
+	Environment []string                 `yaml:"environment,omitempty"`
+	DependsOn   map[string]devDependency `yaml:"depends_on,omitempty"`
+}
+
+// devDependency is a process-compose depends_on entry
+type devDependency struct {
+	Condition string `yaml:"condition"`
+}
+
+// WriteProcessCompose writes a process-compose.yaml processes fragment.
+// Secret and required vars are listed in the header comment.
+func (d *DevEnv) WriteProcessCompose(w io.Writer) error {
+	p := devProcess{Command: d.Command}
+	var notes []string
+	for _, v := range d.Env {
+		p.Environment = append(p.Environment, v.Key+"="+v.Value)
+		if c := v.comment(""); c != "" {
+			notes = append(notes, v.Key+":"+c)
+		}
+	}
+	if len(d.DependsOn) > 0 {
+		p.DependsOn = make(map[string]devDependency, len(d.DependsOn))
+		for _, dep := range d.DependsOn {
+			p.DependsOn[dep] = devDependency{Condition: "process_started"}
+		}
+	}
+
+	out, err := yaml.Marshal(map[string]map[string]devProcess{"processes": {d.Process: p}})
+	if err != nil {
+		return fmt.Errorf("encoding process-compose fragment: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# process-compose fragment for %s\n", d.displayName())
+	for _, n := range notes {
+		fmt.Fprintf(&b, "#   %s\n", n)
+	}
+	b.Write(out)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// displayName returns org/repo, or the process name without one
+func (d *DevEnv) displayName() string {
+	if d.Service != "" {
+		return d.Service
+	}
+	return d.Process
+}
+
+// comment describes a var that needs attention, prefixed with sep
+func (v DevEnvVar) comment(sep string) string {
+	switch {
+	case v.Secret:
+		return sep + " secret (value in " + strings.TrimPrefix(v.Value, "ref+file://") + ")"
+	case v.Required:
+		return sep + " required"
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package env
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// devReg is acme/orders with a default, a secret, a required field and
+// two fields on the same dependency
+func devReg() registry.ServiceRegistration {
+	reg := svc("acme/orders", "acme/billing")
+	reg.Fields = append(reg.Fields,
+		registry.FieldInfo{EnvKey: "APP_PORT", Default: "8080"},
+		registry.FieldInfo{EnvKey: "APP_DB_PASSWORD", IsSecret: true, Required: true},
+		registry.FieldInfo{EnvKey: "APP_REGION", Required: true},
+		registry.FieldInfo{EnvKey: "APP_DEBUG"},
+		registry.FieldInfo{EnvKey: "APP_BILLING_ADMIN", Dependency: "acme/billing"},
+	)
+	return reg
+}
+
+func TestBuildDevEnv(t *testing.T) {
+	d := BuildDevEnv(devReg(), "go run .")
+
+	if d.Process != "orders" || d.Service != "acme/orders" {
+		t.Errorf("process = %s (%s), want orders (acme/orders)", d.Process, d.Service)
+	}
+	if strings.Join(d.DependsOn, ",") != "billing" {
+		t.Errorf("DependsOn = %v, want [billing]", d.DependsOn)
+	}
+
+	tests := []struct {
+		key      string
+		value    string
+		secret   bool
+		required bool
+	}{
+		{key: "APP_DB_PASSWORD", value: "ref+file://./secrets/app_db_password.txt", secret: true},
+		{key: "APP_PORT", value: "8080"},
+		{key: "APP_REGION", required: true},
+	}
+	if len(d.Env) != len(tests) {
+		t.Fatalf("Env = %+v, want %d vars", d.Env, len(tests))
+	}
+	for i, tt := range tests {
+		v := d.Env[i]
+		if v.Key != tt.key || v.Value != tt.value || v.Secret != tt.secret || v.Required != tt.required {
+			t.Errorf("Env[%d] = %+v, want %+v", i, v, tt)
+		}
+	}
+}
+
+func TestDevEnvWriteNix(t *testing.T) {
+	var buf bytes.Buffer
+	if err := BuildDevEnv(devReg(), `go run . -tag "dev"`).WriteNix(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`APP_PORT = "8080";`,
+		`APP_DB_PASSWORD = "ref+file://./secrets/app_db_password.txt"; # secret`,
+		`APP_REGION = ""; # required`,
+		`processes."orders" = {`,
+		`exec = "go run . -tag \"dev\"";`,
+		`"billing".condition = "process_started";`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteNix() output does not contain %s:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "{") != strings.Count(out, "}") {
+		t.Errorf("unbalanced braces:\n%s", out)
+	}
+}
+
+func TestNixString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "plain", want: `"plain"`},
+		{in: `a"b\c`, want: `"a\"b\\c"`},
+		{in: "${HOME}", want: `"\${HOME}"`},
+		{in: "a\nb", want: `"a\nb"`},
+	}
+	for _, tt := range tests {
+		if got := nixString(tt.in); got != tt.want {
+			t.Errorf("nixString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDevEnvWriteProcessCompose(t *testing.T) {
+	var buf bytes.Buffer
+	if err := BuildDevEnv(devReg(), "go run .").WriteProcessCompose(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "#   APP_REGION: required") {
+		t.Errorf("header does not list the required var:\n%s", buf.String())
+	}
+
+	var pc struct {
+		Processes map[string]devProcess `yaml:"processes"`
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &pc); err != nil {
+		t.Fatalf("output is not YAML: %v", err)
+	}
+	p, ok := pc.Processes["orders"]
+	if !ok {
+		t.Fatalf("processes = %v, want orders", pc.Processes)
+	}
+	if p.Command != "go run ." || p.DependsOn["billing"].Condition != "process_started" {
+		t.Errorf("orders = %+v", p)
+	}
+	if strings.Join(p.Environment, " ") != "APP_DB_PASSWORD=ref+file://./secrets/app_db_password.txt APP_PORT=8080 APP_REGION=" {
+		t.Errorf("environment = %v", p.Environment)
+	}
+}
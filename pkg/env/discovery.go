@@ -2,17 +2,22 @@
 //
 // Enables services to:
 // - Watch for changes to specific services (by org/repo)
+// - Track exact instance sets, deletes included (WatchServiceInstances)
 // - Get current instances of a service
 // - List all registered services
+// - Detect config drift between instances of a service (GetDrift)
 //
 // Uses NATS KV watch for push-based updates - no polling.
 package env
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/joeblew999/wellnown-env/pkg/env/registry"
 	"github.com/nats-io/nats.go/jetstream"
@@ -24,163 +29,222 @@ type Watcher interface {
 	Stop() error
 }
 
-// ServiceWatcher watches for changes to services
+// ErrWatcherClosed is returned by ServiceWatcher.Err when NATS closed the
+// watch (e.g. the connection closed)
+var ErrWatcherClosed = errors.New("watch closed")
+
+// ServiceWatcher watches for changes to services. Its goroutine ends with
+// Stop, when the watch's context is canceled, or when NATS closes the
+// watch.
 type ServiceWatcher struct {
 	kvWatcher jetstream.KeyWatcher
 	stopCh    chan struct{}
+	stopOnce  sync.Once
+	stopErr   error
+	done      chan struct{}
+
+	mu  sync.Mutex
+	err error
 }
 
-// Stop stops the watcher
+// Stop stops the watcher. It is safe to call more than once and from
+// several goroutines.
 func (w *ServiceWatcher) Stop() error {
-	close(w.stopCh)
-	return w.kvWatcher.Stop()
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+		w.stopErr = w.kvWatcher.Stop()
+	})
+	return w.stopErr
 }
 
-// WatchService watches for changes to a specific service (org/repo)
-// The callback is called whenever any instance of the service changes
-func WatchService(kv jetstream.KeyValue, name string, fn func(registry.ServiceRegistration)) (*ServiceWatcher, error) {
-	// Convert org/repo to key pattern: org.repo.*
-	parts := strings.SplitN(name, "/", 2)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid service name %q, expected org/repo", name)
-	}
-	pattern := parts[0] + "." + parts[1] + ".*"
+// Done is closed once the watcher no longer calls its callback
+func (w *ServiceWatcher) Done() <-chan struct{} {
+	return w.done
+}
 
-	ctx := context.Background()
-	watcher, err := kv.Watch(ctx, pattern)
-	if err != nil {
-		return nil, fmt.Errorf("watching service %s: %w", name, err)
+// Err returns why the watcher ended on its own: the context's error, or
+// ErrWatcherClosed. It is nil while the watcher runs and after Stop.
+func (w *ServiceWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// end records why the watcher ended, unless it was stopped, and stops it
+func (w *ServiceWatcher) end(err error) {
+	select {
+	case <-w.stopCh:
+		return // Stopped: the closed update channel is expected
+	default:
 	}
+	w.mu.Lock()
+	w.err = err
+	w.mu.Unlock()
+	w.Stop()
+}
 
-	sw := &ServiceWatcher{
-		kvWatcher: watcher,
-		stopCh:    make(chan struct{}),
+// WatchService watches for changes to a specific service (org/repo)
+// until ctx is canceled or the watcher is stopped.
+// The callback is called whenever any instance of the service changes.
+// Deletes are not delivered; use WatchServiceInstances to track instances.
+func WatchService(ctx context.Context, kv jetstream.KeyValue, name string, fn func(registry.ServiceRegistration)) (*ServiceWatcher, error) {
+	return watchService(ctx, kv, name, fn, componentLogger(nil, "discovery"))
+}
+
+// watchService is WatchService with an explicit logger
+func watchService(ctx context.Context, kv jetstream.KeyValue, name string, fn func(registry.ServiceRegistration), logger *slog.Logger) (*ServiceWatcher, error) {
+	pattern, err := servicePattern(name)
+	if err != nil {
+		return nil, err
 	}
 
-	go func() {
-		for {
-			select {
-			case <-sw.stopCh:
-				return
-			case entry := <-watcher.Updates():
-				if entry == nil {
-					continue
-				}
-				// Skip deletes for the callback
-				if entry.Operation() == jetstream.KeyValueDelete {
-					continue
-				}
-
-				var reg registry.ServiceRegistration
-				if err := json.Unmarshal(entry.Value(), &reg); err != nil {
-					continue
-				}
-				fn(reg)
-			}
+	return registrations(kv, logger).Watch(ctx, pattern, func(key string, reg *registry.ServiceRegistration, deleted bool) {
+		// Skip deletes for the callback
+		if !deleted {
+			fn(*reg)
 		}
-	}()
+	})
+}
+
+// InstanceFunc is called for each change to an instance of a service,
+// with its registry key (org.repo.instance). Deletes pass a nil
+// registration.
+type InstanceFunc func(key string, reg *registry.ServiceRegistration, deleted bool)
 
-	return sw, nil
+// WatchServiceInstances returns the current instances of a service
+// (org/repo) by registry key, then calls fn for every change, deletes
+// included, so callers can keep an exact instance set:
+//
+//	instances, w, err := env.WatchServiceInstances(ctx, kv, "acme/api",
+//	    func(key string, reg *registry.ServiceRegistration, deleted bool) {
+//	        if deleted {
+//	            delete(instances, key)
+//	        } else {
+//	            instances[key] = *reg
+//	        }
+//	    })
+//
+// fn is not called before WatchServiceInstances returns. ctx bounds both
+// the snapshot and the watch.
+func WatchServiceInstances(ctx context.Context, kv jetstream.KeyValue, name string, fn InstanceFunc) (map[string]registry.ServiceRegistration, *ServiceWatcher, error) {
+	return watchServiceInstances(ctx, kv, name, fn, componentLogger(nil, "discovery"))
 }
 
-// WatchAll watches for all service registration changes
-func WatchAll(kv jetstream.KeyValue, fn func(key string, reg *registry.ServiceRegistration, deleted bool)) (*ServiceWatcher, error) {
-	ctx := context.Background()
-	watcher, err := kv.WatchAll(ctx)
+// watchServiceInstances is WatchServiceInstances with an explicit logger
+func watchServiceInstances(ctx context.Context, kv jetstream.KeyValue, name string, fn InstanceFunc, logger *slog.Logger) (map[string]registry.ServiceRegistration, *ServiceWatcher, error) {
+	pattern, err := servicePattern(name)
 	if err != nil {
-		return nil, fmt.Errorf("watching all services: %w", err)
+		return nil, nil, err
 	}
+	return registrations(kv, logger).WatchSnapshot(ctx, pattern, fn)
+}
 
-	sw := &ServiceWatcher{
-		kvWatcher: watcher,
-		stopCh:    make(chan struct{}),
+// servicePattern converts org/repo to the key pattern org.repo.*
+func servicePattern(name string) (string, error) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid service name %q, expected org/repo", name)
 	}
+	return parts[0] + "." + parts[1] + ".*", nil
+}
 
-	go func() {
-		for {
-			select {
-			case <-sw.stopCh:
-				return
-			case entry := <-watcher.Updates():
-				if entry == nil {
-					continue
-				}
-
-				deleted := entry.Operation() == jetstream.KeyValueDelete
-				if deleted {
-					fn(entry.Key(), nil, true)
-					continue
-				}
-
-				var reg registry.ServiceRegistration
-				if err := json.Unmarshal(entry.Value(), &reg); err != nil {
-					continue
-				}
-				fn(entry.Key(), &reg, false)
-			}
-		}
-	}()
+// WatchAll watches for all service registration changes until ctx is
+// canceled or the watcher is stopped
+func WatchAll(ctx context.Context, kv jetstream.KeyValue, fn func(key string, reg *registry.ServiceRegistration, deleted bool)) (*ServiceWatcher, error) {
+	return watchAll(ctx, kv, fn, componentLogger(nil, "discovery"))
+}
 
-	return sw, nil
+// watchAll is WatchAll with an explicit logger
+func watchAll(ctx context.Context, kv jetstream.KeyValue, fn func(key string, reg *registry.ServiceRegistration, deleted bool), logger *slog.Logger) (*ServiceWatcher, error) {
+	return registrations(kv, logger).Watch(ctx, "", fn)
 }
 
 // GetService returns all instances of a service
 func GetService(ctx context.Context, kv jetstream.KeyValue, name string) ([]registry.ServiceRegistration, error) {
+	return getService(ctx, kv, name, componentLogger(nil, "discovery"))
+}
+
+// getService is GetService with an explicit logger
+func getService(ctx context.Context, kv jetstream.KeyValue, name string, logger *slog.Logger) ([]registry.ServiceRegistration, error) {
 	// Convert org/repo to key pattern
 	parts := strings.SplitN(name, "/", 2)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid service name %q, expected org/repo", name)
 	}
-	prefix := parts[0] + "." + parts[1] + "."
+	return registrations(kv, logger).List(ctx, parts[0]+"."+parts[1]+".")
+}
 
-	keys, err := kv.Keys(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("listing keys: %w", err)
-	}
+// GetAllServices returns all registered services
+func GetAllServices(ctx context.Context, kv jetstream.KeyValue) ([]registry.ServiceRegistration, error) {
+	return getAllServices(ctx, kv, componentLogger(nil, "discovery"))
+}
 
-	var registrations []registry.ServiceRegistration
-	for _, key := range keys {
-		if !strings.HasPrefix(key, prefix) {
-			continue
-		}
+// getAllServices is GetAllServices with an explicit logger
+func getAllServices(ctx context.Context, kv jetstream.KeyValue, logger *slog.Logger) ([]registry.ServiceRegistration, error) {
+	return registrations(kv, logger).List(ctx, "")
+}
 
-		entry, err := kv.Get(ctx, key)
-		if err != nil {
-			continue
-		}
+// registrations returns a typed view of a registry bucket
+func registrations(kv jetstream.KeyValue, logger *slog.Logger) *TypedKV[registry.ServiceRegistration] {
+	regs := NewTypedKV(kv, WithDecoder(decodeRegistration))
+	regs.SetLogger(logger)
+	return regs
+}
 
-		var reg registry.ServiceRegistration
-		if err := json.Unmarshal(entry.Value(), &reg); err != nil {
-			continue
-		}
-		registrations = append(registrations, reg)
+// decodeRegistration is registry.Decode that counts rejected payloads in
+// wellnown_registrations_rejected_total
+func decodeRegistration(data []byte) (registry.ServiceRegistration, error) {
+	reg, err := registry.Decode(data)
+	switch {
+	case errors.Is(err, registry.ErrPayloadTooLarge):
+		metrics.regsTooLarge.Add(1)
+	case err != nil:
+		metrics.regsMalformed.Add(1)
 	}
+	return reg, err
+}
 
-	return registrations, nil
+// DriftGroup is a set of instances of one service running the same config
+type DriftGroup struct {
+	Hash      string   `json:"hash"`      // registry.ServiceRegistration.ConfigHash ("" = not reported)
+	Instances []string `json:"instances"` // Instance IDs, sorted
 }
 
-// GetAllServices returns all registered services
-func GetAllServices(ctx context.Context, kv jetstream.KeyValue) ([]registry.ServiceRegistration, error) {
-	keys, err := kv.Keys(ctx)
+// GetDrift groups the instances of a service (org/repo) by config hash.
+// More than one group means the instances have drifted apart.
+func GetDrift(ctx context.Context, kv jetstream.KeyValue, name string) ([]DriftGroup, error) {
+	regs, err := GetService(ctx, kv, name)
 	if err != nil {
-		return nil, fmt.Errorf("listing keys: %w", err)
+		return nil, err
 	}
+	return GroupByConfigHash(regs), nil
+}
 
-	var registrations []registry.ServiceRegistration
-	for _, key := range keys {
-		entry, err := kv.Get(ctx, key)
-		if err != nil {
-			continue
-		}
-
-		var reg registry.ServiceRegistration
-		if err := json.Unmarshal(entry.Value(), &reg); err != nil {
-			continue
-		}
-		registrations = append(registrations, reg)
+// GroupByConfigHash groups registrations by ConfigHash, largest group
+// first. Instances from SDKs that predate config hashes share the ""
+// group, which is listed last.
+func GroupByConfigHash(regs []registry.ServiceRegistration) []DriftGroup {
+	byHash := make(map[string][]string)
+	for _, reg := range regs {
+		byHash[reg.ConfigHash] = append(byHash[reg.ConfigHash], reg.Instance.ID)
 	}
 
-	return registrations, nil
+	groups := make([]DriftGroup, 0, len(byHash))
+	for hash, ids := range byHash {
+		sort.Strings(ids)
+		groups = append(groups, DriftGroup{Hash: hash, Instances: ids})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if (a.Hash == "") != (b.Hash == "") {
+			return b.Hash == ""
+		}
+		if len(a.Instances) != len(b.Instances) {
+			return len(a.Instances) > len(b.Instances)
+		}
+		return a.Hash < b.Hash
+	})
+	return groups
 }
 
 // ServiceExists checks if at least one instance of a service exists
@@ -0,0 +1,170 @@
+package env
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestGetAllServicesRejectsMalformed(t *testing.T) {
+	kv := newMemKV()
+	kv.values["o.r.good"] = []byte(`{"version":2,"github":{"org":"o","repo":"r"},"instance":{"id":"good"}}`)
+	kv.values["o.r.json"] = []byte(`{"github":`)
+	kv.values["o.r.unknown"] = []byte(`{"version":2,"github":{"org":"o","repo":"r"},"injected":"x"}`)
+	kv.values["o.r.huge"] = []byte(`{"github":{"org":"` + strings.Repeat("o", registry.MaxPayloadSize) + `"}}`)
+
+	tooLarge, malformed := metrics.regsTooLarge.Load(), metrics.regsMalformed.Load()
+
+	regs, err := GetAllServices(context.Background(), kv)
+	if err != nil {
+		t.Fatalf("GetAllServices() error = %v", err)
+	}
+	if len(regs) != 1 || regs[0].Instance.ID != "good" {
+		t.Errorf("GetAllServices() = %+v, want only the good instance", regs)
+	}
+
+	if got := metrics.regsTooLarge.Load() - tooLarge; got != 1 {
+		t.Errorf("too_large rejections = %d, want 1", got)
+	}
+	if got := metrics.regsMalformed.Load() - malformed; got != 2 {
+		t.Errorf("malformed rejections = %d, want 2", got)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	type config struct {
+		Port     int    `conf:"default:8080"`
+		Password string `conf:"mask"`
+		Limit    *int
+		DB       struct {
+			Host string
+		}
+	}
+	fields := ExtractFields("APP", &config{})
+	limit := 5
+
+	base := config{Port: 8080, Password: "a"}
+	base.DB.Host = "db1"
+
+	secret := base
+	secret.Password = "b"
+
+	host := base
+	host.DB.Host = "db2"
+
+	limited, otherLimited := base, base
+	limited.Limit = &limit
+	otherLimit := 5
+	otherLimited.Limit = &otherLimit
+
+	hash := ConfigHash(fields, &base)
+	if len(hash) != 16 {
+		t.Errorf("ConfigHash() = %q, want 16 hex chars", hash)
+	}
+	if got := ConfigHash(fields, &secret); got != hash {
+		t.Error("secret value changed the hash")
+	}
+	if got := ConfigHash(fields, &host); got == hash {
+		t.Error("nested value did not change the hash")
+	}
+	if ConfigHash(fields, &limited) == hash {
+		t.Error("setting a pointer field did not change the hash")
+	}
+	if ConfigHash(fields, &limited) != ConfigHash(fields, &otherLimited) {
+		t.Error("equal pointer values hash differently")
+	}
+}
+
+func TestGroupByConfigHash(t *testing.T) {
+	inst := func(id, hash string) registry.ServiceRegistration {
+		return registry.ServiceRegistration{Instance: registry.InstanceInfo{ID: id}, ConfigHash: hash}
+	}
+
+	tests := []struct {
+		name string
+		regs []registry.ServiceRegistration
+		want []DriftGroup
+	}{
+		{
+			name: "no drift",
+			regs: []registry.ServiceRegistration{inst("b", "h1"), inst("a", "h1")},
+			want: []DriftGroup{{Hash: "h1", Instances: []string{"a", "b"}}},
+		},
+		{
+			name: "drift, largest group first",
+			regs: []registry.ServiceRegistration{inst("a", "h2"), inst("b", "h1"), inst("c", "h1")},
+			want: []DriftGroup{
+				{Hash: "h1", Instances: []string{"b", "c"}},
+				{Hash: "h2", Instances: []string{"a"}},
+			},
+		},
+		{
+			name: "unreported hash last",
+			regs: []registry.ServiceRegistration{inst("a", ""), inst("b", ""), inst("c", "h1")},
+			want: []DriftGroup{
+				{Hash: "h1", Instances: []string{"c"}},
+				{Hash: "", Instances: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "empty",
+			want: []DriftGroup{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GroupByConfigHash(tt.regs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GroupByConfigHash() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchServiceInstances(t *testing.T) {
+	kv := newMemKV()
+	kv.values["o.r.a"] = []byte(`{"version":2,"github":{"org":"o","repo":"r"},"instance":{"id":"a"}}`)
+	kv.values["o.r.b"] = []byte(`{"version":2,"github":{"org":"o","repo":"r"},"instance":{"id":"b"}}`)
+	kv.values["o.other.c"] = []byte(`{"version":2,"github":{"org":"o","repo":"other"},"instance":{"id":"c"}}`)
+
+	type change struct {
+		key     string
+		deleted bool
+	}
+	changes := make(chan change, 10)
+	instances, w, err := WatchServiceInstances(context.Background(), kv, "o/r", func(key string, reg *registry.ServiceRegistration, deleted bool) {
+		if deleted != (reg == nil) {
+			t.Errorf("change of %s: deleted = %v with registration %v", key, deleted, reg)
+		}
+		changes <- change{key, deleted}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if len(instances) != 2 || instances["o.r.a"].Instance.ID != "a" || instances["o.r.b"].Instance.ID != "b" {
+		t.Errorf("snapshot = %+v, want instances a and b by key", instances)
+	}
+
+	kv.Delete(context.Background(), "o.r.a")
+	kv.Put(context.Background(), "o.r.d", []byte(`{"version":2,"github":{"org":"o","repo":"r"},"instance":{"id":"d"}}`))
+	for _, want := range []change{{"o.r.a", true}, {"o.r.d", false}} {
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Errorf("change = %+v, want %+v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no change for %s", want.key)
+		}
+	}
+
+	if _, _, err := WatchServiceInstances(context.Background(), kv, "nope", nil); err == nil {
+		t.Error("WatchServiceInstances(bad name) error = nil")
+	}
+}
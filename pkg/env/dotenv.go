@@ -0,0 +1,168 @@
+// dotenv.go: .env file loading
+//
+// New loads dotenv files from the working directory before reading any
+// other setting, so NATS_HUB, CONFIG_FILE and config fields can all live
+// in them. Precedence (highest first):
+//
+//	real environment
+//	.env.{ENVIRONMENT}.local
+//	.env.local
+//	.env.{ENVIRONMENT}
+//	.env
+//
+// A file never overrides the real environment or a file ranked above it.
+// Missing files are skipped. Values may be ref+ secrets: they are resolved
+// in Parse like any other env var. Keep the .local files out of git.
+//
+// Format: KEY=value lines, with optional "export ", # comments, and
+// 'single' (literal) or "double" (\n, \t, \", \\ escapes) quotes. There
+// is no ${VAR} expansion.
+//
+// Use WithDotenv to load other files and WithoutDotenv to load none.
+package env
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadDotenv loads dotenv files into the environment. Earlier paths take
+// precedence, and no file overrides a variable that is already set.
+// Missing files are skipped.
+func LoadDotenv(paths ...string) error {
+	_, err := loadDotenv(paths)
+	return err
+}
+
+// DotenvFiles returns the conventional dotenv files for environment (e.g.
+// "production"), highest precedence first
+func DotenvFiles(environment string) []string {
+	if environment == "" {
+		return []string{".env.local", ".env"}
+	}
+	return []string{
+		".env." + environment + ".local",
+		".env.local",
+		".env." + environment,
+		".env",
+	}
+}
+
+// WithDotenv loads paths (highest precedence first) in New instead of
+// DotenvFiles(ENVIRONMENT)
+func WithDotenv(paths ...string) Option {
+	return func(o *Options) {
+		o.DotenvFiles = paths
+	}
+}
+
+// WithoutDotenv disables dotenv loading in New
+func WithoutDotenv() Option {
+	return func(o *Options) {
+		o.DisableDotenv = true
+	}
+}
+
+// loadDotenv loads paths and returns the file that set each variable
+func loadDotenv(paths []string) (map[string]string, error) {
+	loaded := make(map[string]string)
+	for _, path := range paths {
+		vars, err := readDotenv(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range vars {
+			if _, set := os.LookupEnv(kv[0]); set {
+				continue
+			}
+			if err := os.Setenv(kv[0], kv[1]); err != nil {
+				return nil, fmt.Errorf("setting %s: %w", kv[0], err)
+			}
+			loaded[kv[0]] = path
+		}
+	}
+	return loaded, nil
+}
+
+// readDotenv parses a dotenv file into key/value pairs in file order
+func readDotenv(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		key, value, ok, err := parseDotenvLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if ok {
+			vars = append(vars, [2]string{key, value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// parseDotenvLine parses one line; ok is false for blanks and comments
+func parseDotenvLine(line string) (key, value string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimPrefix(line, "export ")
+
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", false, fmt.Errorf("invalid line %q (want KEY=value)", line)
+	}
+	value = strings.TrimSpace(value)
+
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", "", false, fmt.Errorf("unterminated quote in %s", key)
+		}
+		return key, value[1 : end+1], true, nil
+	case strings.HasPrefix(value, `"`):
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			if c == '"' {
+				return key, b.String(), true, nil
+			}
+			if c == '\\' && i+1 < len(value) {
+				i++
+				switch value[i] {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				default:
+					c = value[i] // \" \\ and anything else: literal
+				}
+			}
+			b.WriteByte(c)
+		}
+		return "", "", false, fmt.Errorf("unterminated quote in %s", key)
+	}
+
+	// Unquoted: a " #" starts a comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return key, value, true, nil
+}
@@ -0,0 +1,99 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDotenvLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		key     string
+		value   string
+		ok      bool
+		wantErr bool
+	}{
+		{line: "", ok: false},
+		{line: "  # comment", ok: false},
+		{line: "PORT=8080", key: "PORT", value: "8080", ok: true},
+		{line: "export HUB = nats://hub:4222 ", key: "HUB", value: "nats://hub:4222", ok: true},
+		{line: "NAME=web # trailing comment", key: "NAME", value: "web", ok: true},
+		{line: "URL=http://x/#anchor", key: "URL", value: "http://x/#anchor", ok: true},
+		{line: "EMPTY=", key: "EMPTY", value: "", ok: true},
+		{line: `LIT='a\nb #c'`, key: "LIT", value: `a\nb #c`, ok: true},
+		{line: `ESC="a\nb \"q\" \\"`, key: "ESC", value: "a\nb \"q\" \\", ok: true},
+		{line: "SECRET=ref+vault://db#password", key: "SECRET", value: "ref+vault://db#password", ok: true},
+		{line: "no equals", wantErr: true},
+		{line: "=value", wantErr: true},
+		{line: "BAD KEY=x", wantErr: true},
+		{line: `OPEN="unterminated`, wantErr: true},
+		{line: `OPEN='unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		key, value, ok, err := parseDotenvLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDotenvLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if key != tt.key || value != tt.value || ok != tt.ok {
+			t.Errorf("parseDotenvLine(%q) = %q, %q, %v; want %q, %q, %v", tt.line, key, value, ok, tt.key, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestLoadDotenvPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	local := write(".env.local", "DOTENVTEST_A=local\n")
+	base := write(".env", "DOTENVTEST_A=base\nDOTENVTEST_B=base\nDOTENVTEST_REAL=base\n")
+	t.Setenv("DOTENVTEST_REAL", "real")
+	for _, key := range []string{"DOTENVTEST_A", "DOTENVTEST_B"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	loaded, err := loadDotenv([]string{filepath.Join(dir, ".env.production"), local, base})
+	if err != nil {
+		t.Fatalf("loadDotenv() error = %v", err)
+	}
+
+	want := map[string]string{"DOTENVTEST_A": "local", "DOTENVTEST_B": "base", "DOTENVTEST_REAL": "real"}
+	for key, value := range want {
+		if got := os.Getenv(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if loaded["DOTENVTEST_A"] != local || loaded["DOTENVTEST_B"] != base {
+		t.Errorf("loaded = %v, want A from .env.local and B from .env", loaded)
+	}
+	if _, ok := loaded["DOTENVTEST_REAL"]; ok {
+		t.Error("real env var reported as loaded from a file")
+	}
+
+	if err := LoadDotenv(write(".env.bad", "oops\n")); err == nil {
+		t.Error("LoadDotenv() of a malformed file succeeded")
+	}
+}
+
+func TestDotenvFiles(t *testing.T) {
+	if got := DotenvFiles(""); len(got) != 2 || got[0] != ".env.local" || got[1] != ".env" {
+		t.Errorf("DotenvFiles(\"\") = %v", got)
+	}
+	want := []string{".env.production.local", ".env.local", ".env.production", ".env"}
+	got := DotenvFiles("production")
+	if len(got) != len(want) {
+		t.Fatalf("DotenvFiles(production) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("DotenvFiles(production)[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,708 @@
+// enroll.go: First-boot enrollment with hub-side approval
+//
+// New devices don't join the registry on their own. A node started with an
+// enrollment token (ENROLL_TOKEN or WithEnrollment) creates its NKey
+// identity on first boot (ENROLL_KEY_FILE, default .auth/node.nk) and asks
+// the hub to enroll it. The request lands in the hub's node_enrollment
+// bucket as pending, and Parse holds the registration until an operator
+// approves the node:
+//
+//	wellknown-check enroll list
+//	wellknown-check enroll approve edge-7
+//	wellknown-check enroll reject edge-7
+//
+// or on the /enrollment page (RegisterEnrollmentPage). Approval issues the
+// node's credentials: by default, in nkey auth mode, the hub accepts the
+// node's key as an NKey user; other modes plug in an EnrollmentIssuer. The
+// node registers with its next request (every DefaultEnrollRetry). Hubs
+// can require device attestation before a request is queued (attest.go).
+//
+// The hub serves requests with mgr.ServeEnrollment. With Required set it
+// also removes registrations of nodes that are not approved, so rogue
+// devices cannot join silently. Give nodes a fixed NATS_NAME: enrollment
+// is keyed by node name.
+package env
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// EnrollmentBucket holds enrollment requests and decisions, keyed by node name
+const EnrollmentBucket = "node_enrollment"
+
+// EnrollSubject is where nodes send enrollment requests
+const EnrollSubject = "enroll.request"
+
+// Enrollment states
+const (
+	EnrollPending  = "pending"
+	EnrollApproved = "approved"
+	EnrollRejected = "rejected"
+)
+
+// DefaultEnrollRetry is how often a pending node asks again
+const DefaultEnrollRetry = 30 * time.Second
+
+// enrollSweepInterval is how often Required removes unenrolled registrations
+const enrollSweepInterval = 10 * time.Second
+
+// ErrEnrollmentRejected is returned by Parse when the hub rejected the node
+var ErrEnrollmentRejected = errors.New("enrollment rejected")
+
+// defaultEnrollKeyFile holds the node's NKey seed
+var defaultEnrollKeyFile = filepath.Join(authDir, "node.nk")
+
+// Enrollment is a node's enrollment record
+type Enrollment struct {
+	Node      string    `json:"node"`
+	PublicKey string    `json:"public_key"`        // The node's NKey user key
+	Host      string    `json:"host,omitempty"`    // Hostname reported by the node
+	Service   string    `json:"service,omitempty"` // Service that sent the first request
+	State     string    `json:"state"`
+	Requested time.Time `json:"requested"`
+	Decided   time.Time `json:"decided,omitempty"`
+	DecidedBy string    `json:"decided_by,omitempty"`
+
+	Attestation string            `json:"attestation,omitempty"` // Verified attestation kind (see attest.go)
+	Claims      map[string]string `json:"claims,omitempty"`      // What the verifier found
+}
+
+// EnrollmentRequest is what a node sends to EnrollSubject
+type EnrollmentRequest struct {
+	Node      string `json:"node"`
+	PublicKey string `json:"public_key"`
+	Host      string `json:"host,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Token     string `json:"token"`
+	Signature []byte `json:"signature"` // Node name signed with the node's key
+
+	Attestation *Attestation `json:"attestation,omitempty"` // Device evidence (see attest.go)
+}
+
+// EnrollmentReply is the hub's answer
+type EnrollmentReply struct {
+	State string `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// EnrollmentIssuer issues the credentials of an approved node
+type EnrollmentIssuer func(ctx context.Context, e Enrollment) error
+
+// EnrollmentConfig configures the hub side of enrollment
+type EnrollmentConfig struct {
+	Token     string                         // Enrollment token nodes must present
+	Issuer    EnrollmentIssuer               // nil = accept the node key in nkey auth mode
+	Verifiers map[string]AttestationVerifier // By attestation kind (empty = no attestation needed)
+	Required  bool                           // Remove registrations of nodes that are not approved
+	Trusted   []string                       // Nodes that need no enrollment, e.g. the other hubs
+}
+
+// WithEnrollment makes a new node ask the hub to enroll it before it
+// registers
+func WithEnrollment(token string) Option {
+	return func(o *Options) {
+		o.EnrollToken = token
+	}
+}
+
+// OpenEnrollmentBucket creates (or opens) the node_enrollment bucket
+func OpenEnrollmentBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      EnrollmentBucket,
+		Description: "Node enrollment for wellnown-env",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening enrollment bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// ListEnrollments returns all enrollments, pending first, then by node name
+func ListEnrollments(ctx context.Context, kv jetstream.KeyValue) ([]Enrollment, error) {
+	list, err := NewTypedKV[Enrollment](kv).List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if pi, pj := list[i].State == EnrollPending, list[j].State == EnrollPending; pi != pj {
+			return pi
+		}
+		return list[i].Node < list[j].Node
+	})
+	return list, nil
+}
+
+// ApproveEnrollment approves a node; the hub then issues its credentials
+func ApproveEnrollment(ctx context.Context, kv jetstream.KeyValue, node, by string) error {
+	return decideEnrollment(ctx, kv, node, EnrollApproved, by)
+}
+
+// RejectEnrollment rejects a node. Credentials already issued to it stay
+// valid until the hub restarts.
+func RejectEnrollment(ctx context.Context, kv jetstream.KeyValue, node, by string) error {
+	return decideEnrollment(ctx, kv, node, EnrollRejected, by)
+}
+
+// decideEnrollment records an operator's decision
+func decideEnrollment(ctx context.Context, kv jetstream.KeyValue, node, state, by string) error {
+	entries := NewTypedKV[Enrollment](kv)
+	e, _, err := entries.Get(ctx, node)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("no enrollment request from %s", node)
+	}
+	if err != nil {
+		return err
+	}
+	e.State, e.Decided, e.DecidedBy = state, time.Now().UTC(), by
+	if _, err := entries.Put(ctx, node, e); err != nil {
+		return fmt.Errorf("recording %s enrollment: %w", node, err)
+	}
+	return nil
+}
+
+// enroll records a node's request and returns its state
+func enroll(ctx context.Context, kv jetstream.KeyValue, cfg EnrollmentConfig, req EnrollmentRequest) (string, error) {
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(cfg.Token)) != 1 {
+		return "", fmt.Errorf("invalid enrollment token")
+	}
+	if req.Node == "" || strings.ContainsAny(req.Node, ".*> ") {
+		return "", fmt.Errorf("invalid node name %q", req.Node)
+	}
+	if !nkeys.IsValidPublicUserKey(req.PublicKey) {
+		return "", fmt.Errorf("invalid node key")
+	}
+	pub, err := nkeys.FromPublicKey(req.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid node key: %w", err)
+	}
+	if err := pub.Verify([]byte(req.Node), req.Signature); err != nil {
+		return "", fmt.Errorf("invalid signature")
+	}
+	claims, err := verifyAttestation(ctx, cfg.Verifiers, req)
+	if err != nil {
+		return "", err
+	}
+
+	entries := NewTypedKV[Enrollment](kv)
+	e, _, err := entries.Get(ctx, req.Node)
+	if err == nil {
+		if e.PublicKey != req.PublicKey {
+			return "", fmt.Errorf("node %s is enrolled with another key", req.Node)
+		}
+		return e.State, nil
+	}
+	if !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return "", err
+	}
+
+	e = Enrollment{
+		Node:      req.Node,
+		PublicKey: req.PublicKey,
+		Host:      req.Host,
+		Service:   req.Service,
+		State:     EnrollPending,
+		Requested: time.Now().UTC(),
+		Claims:    claims,
+	}
+	if len(cfg.Verifiers) > 0 {
+		e.Attestation = req.Attestation.Kind
+	}
+	if _, err := entries.Put(ctx, req.Node, e); err != nil {
+		return "", fmt.Errorf("recording %s enrollment: %w", req.Node, err)
+	}
+	return EnrollPending, nil
+}
+
+// ServeEnrollment answers enrollment requests on the hub and issues the
+// credentials of approved nodes, including those approved before it
+// started
+func (m *Manager) ServeEnrollment(cfg EnrollmentConfig) (stop func(), err error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("enrollment needs NATS")
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("enrollment needs a token")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := OpenEnrollmentBucket(ctx, m.natsNode.ControlJetStream())
+	if err != nil {
+		return nil, err
+	}
+	s := &enrollService{
+		m:       m,
+		kv:      kv,
+		cfg:     cfg,
+		issued:  make(map[string]bool),
+		logger:  componentLogger(m.opts.Logger, "enroll"),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+		trusted: map[string]bool{m.natsNode.Name(): true},
+	}
+	for _, node := range cfg.Trusted {
+		s.trusted[node] = true
+	}
+	if err := s.start(ctx); err != nil {
+		return nil, err
+	}
+	return s.stop, nil
+}
+
+// enrollService is the hub side of enrollment
+type enrollService struct {
+	m       *Manager
+	kv      jetstream.KeyValue
+	cfg     EnrollmentConfig
+	logger  *slog.Logger
+	trusted map[string]bool
+
+	mu       sync.Mutex
+	issued   map[string]bool // Node keys with credentials
+	approved map[string]bool // Approved node names
+
+	sub      *nats.Subscription
+	watch    Watcher
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// start issues existing approvals, then serves requests and watches decisions
+func (s *enrollService) start(ctx context.Context) error {
+	list, err := ListEnrollments(ctx, s.kv)
+	if err != nil {
+		return err
+	}
+	s.approved = make(map[string]bool)
+	var approved []Enrollment
+	for _, e := range list {
+		if e.State == EnrollApproved {
+			approved = append(approved, e)
+			s.approved[e.Node] = true
+		}
+	}
+	if err := s.issue(ctx, approved...); err != nil {
+		return err
+	}
+
+	entries := NewTypedKV[Enrollment](s.kv)
+	entries.SetLogger(s.logger)
+	s.watch, err = entries.Watch(context.Background(), "", func(key string, e *Enrollment, deleted bool) {
+		s.mu.Lock()
+		s.approved[key] = e != nil && e.State == EnrollApproved
+		s.mu.Unlock()
+		if e == nil || e.State != EnrollApproved {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.issue(ctx, *e); err != nil {
+			s.logger.Warn("issuing node credentials failed", "node", e.Node, "error", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("watching enrollments: %w", err)
+	}
+
+	s.sub, err = s.m.natsNode.ControlConn().Subscribe(EnrollSubject, s.handle)
+	if err != nil {
+		s.watch.Stop()
+		return fmt.Errorf("subscribing to %s: %w", EnrollSubject, err)
+	}
+
+	go s.run()
+	return nil
+}
+
+// handle answers one enrollment request
+func (s *enrollService) handle(msg *nats.Msg) {
+	var reply EnrollmentReply
+	var req EnrollmentRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		reply.Error = "malformed enrollment request"
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		state, err := enroll(ctx, s.kv, s.cfg, req)
+		cancel()
+		if err != nil {
+			reply.Error = err.Error()
+			s.logger.Warn("enrollment request refused", "node", req.Node, "error", err)
+		} else {
+			reply.State = state
+			if state == EnrollPending {
+				s.logger.Info("enrollment pending", "node", req.Node, "host", req.Host)
+			}
+		}
+	}
+	data, _ := json.Marshal(reply)
+	_ = msg.Respond(data)
+}
+
+// issue issues credentials to approved nodes that don't have them yet
+func (s *enrollService) issue(ctx context.Context, approved ...Enrollment) error {
+	s.mu.Lock()
+	var todo []Enrollment
+	for _, e := range approved {
+		switch {
+		case s.issued[e.PublicKey]:
+		case len(s.cfg.Verifiers) > 0 && e.Attestation == "":
+			// Queued before attestation was required
+			s.logger.Warn("not issuing credentials to unattested node", "node", e.Node)
+		default:
+			todo = append(todo, e)
+		}
+	}
+	s.mu.Unlock()
+	if len(todo) == 0 {
+		return nil
+	}
+
+	if s.cfg.Issuer == nil {
+		pubs := make([]string, len(todo))
+		for i, e := range todo {
+			pubs[i] = e.PublicKey
+		}
+		if err := s.m.allowNodeKeys(pubs); err != nil {
+			return err
+		}
+	} else {
+		for _, e := range todo {
+			if err := s.cfg.Issuer(ctx, e); err != nil {
+				return fmt.Errorf("issuing credentials to %s: %w", e.Node, err)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	for _, e := range todo {
+		s.issued[e.PublicKey] = true
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// run sweeps unenrolled registrations when enrollment is required
+func (s *enrollService) run() {
+	defer close(s.done)
+	if !s.cfg.Required {
+		<-s.stopCh
+		return
+	}
+
+	ticker := time.NewTicker(enrollSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			for _, kv := range []jetstream.KeyValue{s.m.KV(), s.m.StaticKV()} {
+				if kv != nil {
+					if err := s.sweep(ctx, kv); err != nil {
+						s.logger.Warn("enrollment sweep failed", "error", err)
+					}
+				}
+			}
+			cancel()
+		}
+	}
+}
+
+// sweep removes the registrations of nodes that are neither approved nor
+// trusted
+func (s *enrollService) sweep(ctx context.Context, kv jetstream.KeyValue) error {
+	keys, err := kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("listing registrations: %w", err)
+	}
+	for _, key := range keys {
+		entry, err := kv.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		reg, err := decodeRegistration(entry.Value())
+		if err != nil || s.allowed(reg) {
+			continue
+		}
+		if err := kv.Delete(ctx, key); err != nil {
+			return fmt.Errorf("removing %s: %w", key, err)
+		}
+		s.logger.Warn("removed registration of unenrolled node", "key", key, "node", reg.Instance.Node)
+	}
+	return nil
+}
+
+// allowed reports whether reg comes from an approved or trusted node
+func (s *enrollService) allowed(reg registry.ServiceRegistration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trusted[reg.Instance.Node] || s.approved[reg.Instance.Node]
+}
+
+// stop stops serving requests
+func (s *enrollService) stop() {
+	s.stopOnce.Do(func() {
+		s.sub.Unsubscribe()
+		s.watch.Stop()
+		close(s.stopCh)
+		<-s.done
+	})
+}
+
+// nodePermissions is what an enrolled node key may do: the same as the
+// shared user key (scope services with ServicePermissions)
+var nodePermissions = SubjectPermissions{Publish: []string{">"}, Subscribe: []string{">"}}
+
+// allowNodeKeys lets approved node keys connect to the hub in nkey mode;
+// other auth modes need an EnrollmentIssuer
+func (m *Manager) allowNodeKeys(pubs []string) error {
+	cfg := m.natsNode.Auth()
+	if cfg == nil || cfg.Mode != "nkey" {
+		m.logger.Warn("approved nodes get no credentials without an EnrollmentIssuer outside nkey mode", "nodes", len(pubs))
+		return nil
+	}
+	next := *cfg
+	next.ServiceNKeys = make(map[string]SubjectPermissions, len(cfg.ServiceNKeys)+len(pubs))
+	for k, v := range cfg.ServiceNKeys {
+		next.ServiceNKeys[k] = v
+	}
+	for _, pub := range pubs {
+		if _, ok := next.ServiceNKeys[pub]; !ok {
+			next.ServiceNKeys[pub] = nodePermissions
+		}
+	}
+	return m.natsNode.ReloadAuth(&next)
+}
+
+// loadOrCreateNodeKey reads the node's NKey seed, creating it on first boot
+func loadOrCreateNodeKey(path string) (nkeys.KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		kp, err := nkeys.FromSeed([]byte(strings.TrimSpace(string(data))))
+		if err != nil {
+			return nil, fmt.Errorf("parsing node key %s: %w", path, err)
+		}
+		return kp, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading node key: %w", err)
+	}
+
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, fmt.Errorf("generating node key: %w", err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.WriteFile(path, string(seed)+"\n"); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// newEnrollmentRequest builds a signed request for node, with the
+// attester's evidence if there is one
+func newEnrollmentRequest(ctx context.Context, kp nkeys.KeyPair, node, service, token string, attester Attester) (EnrollmentRequest, error) {
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return EnrollmentRequest{}, err
+	}
+	sig, err := kp.Sign([]byte(node))
+	if err != nil {
+		return EnrollmentRequest{}, fmt.Errorf("signing enrollment request: %w", err)
+	}
+	host, _ := os.Hostname()
+	req := EnrollmentRequest{Node: node, PublicKey: pub, Host: host, Service: service, Token: token, Signature: sig}
+	if attester != nil {
+		if req.Attestation, err = attester(ctx, AttestationBinding(node, pub)); err != nil {
+			return EnrollmentRequest{}, fmt.Errorf("attesting device: %w", err)
+		}
+	}
+	return req, nil
+}
+
+// enrollmentKV opens the node_enrollment bucket on the control lane
+func (m *Manager) enrollmentKV(ctx context.Context) (jetstream.KeyValue, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	return OpenEnrollmentBucket(ctx, m.natsNode.ControlJetStream())
+}
+
+// Enrollments returns all enrollments, pending first
+func (m *Manager) Enrollments(ctx context.Context) ([]Enrollment, error) {
+	kv, err := m.enrollmentKV(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ListEnrollments(ctx, kv)
+}
+
+// ApproveEnrollment approves a node (see ApproveEnrollment)
+func (m *Manager) ApproveEnrollment(ctx context.Context, node, by string) error {
+	kv, err := m.enrollmentKV(ctx)
+	if err != nil {
+		return err
+	}
+	return ApproveEnrollment(ctx, kv, node, by)
+}
+
+// RejectEnrollment rejects a node (see RejectEnrollment)
+func (m *Manager) RejectEnrollment(ctx context.Context, node, by string) error {
+	kv, err := m.enrollmentKV(ctx)
+	if err != nil {
+		return err
+	}
+	return RejectEnrollment(ctx, kv, node, by)
+}
+
+// enrolling reports whether Parse must wait for approval (leaf nodes with
+// an enrollment token)
+func (m *Manager) enrolling() bool {
+	return m.opts.EnrollToken != "" && m.natsNode != nil && m.natsNode.IsLeaf()
+}
+
+// EnrollmentState returns the node's enrollment state (empty without
+// enrollment)
+func (m *Manager) EnrollmentState() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enrollState
+}
+
+// registerEnrolled registers once the hub approves the node, asking
+// again in the background while it is pending or the hub is unreachable
+func (m *Manager) registerEnrolled(ctx context.Context, cfg interface{}) error {
+	path := m.opts.EnrollKeyFile
+	if path == "" {
+		path = defaultEnrollKeyFile
+	}
+	kp, err := loadOrCreateNodeKey(path)
+	if err != nil {
+		return err
+	}
+	service := registry.GetGitHubInfo().Name()
+	if service == "" {
+		service = m.prefix
+	}
+	req, err := newEnrollmentRequest(ctx, kp, m.natsNode.Name(), service, m.opts.EnrollToken, m.opts.Attester)
+	if err != nil {
+		return err
+	}
+
+	state, err := m.requestEnrollment(ctx, req)
+	switch {
+	case err == nil && state == EnrollApproved:
+		return m.register(ctx, cfg)
+	case err == nil && state == EnrollRejected:
+		return fmt.Errorf("node %s: %w", req.Node, ErrEnrollmentRejected)
+	case err != nil:
+		m.logger.Warn("enrollment request failed, retrying", "error", err)
+	default:
+		m.logger.Warn("waiting for enrollment approval", "node", req.Node, "key", req.PublicKey)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || m.enrollStop != nil {
+		return nil
+	}
+	m.enrollStop = make(chan struct{})
+	m.enrollDone = make(chan struct{})
+	go m.awaitEnrollment(req, cfg)
+	return nil
+}
+
+// awaitEnrollment asks every DefaultEnrollRetry until the node is
+// approved (then registers) or rejected
+func (m *Manager) awaitEnrollment(req EnrollmentRequest, cfg interface{}) {
+	defer close(m.enrollDone)
+
+	ticker := time.NewTicker(DefaultEnrollRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.enrollStop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		state, err := m.requestEnrollment(ctx, req)
+		if err == nil && state == EnrollApproved {
+			err = m.register(ctx, cfg)
+			cancel()
+			if err != nil {
+				m.logger.Warn("registering after enrollment failed", "error", err)
+				continue
+			}
+			return
+		}
+		cancel()
+		if err != nil {
+			m.logger.Debug("enrollment request failed", "error", err)
+		} else if state == EnrollRejected {
+			m.logger.Error("enrollment rejected; not registering", "node", req.Node)
+			return
+		}
+	}
+}
+
+// requestEnrollment sends req to the hub and records the answer
+func (m *Manager) requestEnrollment(ctx context.Context, req EnrollmentRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	msg, err := m.natsNode.ControlConn().RequestWithContext(ctx, EnrollSubject, data)
+	if err != nil {
+		return "", fmt.Errorf("requesting enrollment: %w", err)
+	}
+	var reply EnrollmentReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return "", fmt.Errorf("decoding enrollment reply: %w", err)
+	}
+	if reply.Error != "" {
+		return "", fmt.Errorf("enrollment refused: %s", reply.Error)
+	}
+
+	m.mu.Lock()
+	m.enrollState = reply.State
+	m.mu.Unlock()
+	return reply.State, nil
+}
+
+// stopEnrollment stops asking for approval
+func (m *Manager) stopEnrollment() {
+	m.mu.Lock()
+	stop, done := m.enrollStop, m.enrollDone
+	m.enrollStop = nil
+	m.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,140 @@
+package env
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+)
+
+func TestEnroll(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+	cfg := EnrollmentConfig{Token: "s3cret"}
+
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := newEnrollmentRequest(ctx, kp, "edge-7", "acme/sensor", "s3cret", nil)
+	if err != nil {
+		t.Fatalf("newEnrollmentRequest() error = %v", err)
+	}
+	otherReq, err := newEnrollmentRequest(ctx, other, "edge-7", "acme/sensor", "s3cret", nil)
+	if err != nil {
+		t.Fatalf("newEnrollmentRequest() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(r *EnrollmentRequest)
+		wantErr bool
+	}{
+		{name: "wrong token", edit: func(r *EnrollmentRequest) { r.Token = "guess" }, wantErr: true},
+		{name: "bad node name", edit: func(r *EnrollmentRequest) { r.Node = "edge.*" }, wantErr: true},
+		{name: "bad key", edit: func(r *EnrollmentRequest) { r.PublicKey = "not-a-key" }, wantErr: true},
+		{name: "signed for another node", edit: func(r *EnrollmentRequest) { r.Node = "edge-8" }, wantErr: true},
+		{name: "signed by another key", edit: func(r *EnrollmentRequest) { r.Signature = otherReq.Signature }, wantErr: true},
+		{name: "valid", edit: func(r *EnrollmentRequest) {}},
+	}
+	for _, tt := range tests {
+		r := req
+		tt.edit(&r)
+		state, err := enroll(ctx, kv, cfg, r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: enroll() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if !tt.wantErr && state != EnrollPending {
+			t.Errorf("%s: enroll() = %q, want pending", tt.name, state)
+		}
+	}
+
+	// Asking again keeps the request; another key can't take the name
+	if state, err := enroll(ctx, kv, cfg, req); err != nil || state != EnrollPending {
+		t.Errorf("enroll() again = %q, %v; want pending", state, err)
+	}
+	if _, err := enroll(ctx, kv, cfg, otherReq); err == nil {
+		t.Error("enroll() with another key succeeded, want error")
+	}
+
+	if err := ApproveEnrollment(ctx, kv, "edge-7", "alice"); err != nil {
+		t.Fatalf("ApproveEnrollment() error = %v", err)
+	}
+	if state, err := enroll(ctx, kv, cfg, req); err != nil || state != EnrollApproved {
+		t.Errorf("enroll() after approval = %q, %v; want approved", state, err)
+	}
+}
+
+func TestDecideEnrollment(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+	cfg := EnrollmentConfig{Token: "s3cret"}
+
+	for _, node := range []string{"edge-3", "edge-1", "edge-2"} {
+		kp, err := nkeys.CreateUser()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := newEnrollmentRequest(ctx, kp, node, "", "s3cret", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := enroll(ctx, kv, cfg, req); err != nil {
+			t.Fatalf("enroll(%s) error = %v", node, err)
+		}
+	}
+
+	if err := ApproveEnrollment(ctx, kv, "edge-9", "alice"); err == nil {
+		t.Error("ApproveEnrollment(unknown) succeeded, want error")
+	}
+	if err := ApproveEnrollment(ctx, kv, "edge-1", "alice"); err != nil {
+		t.Fatalf("ApproveEnrollment() error = %v", err)
+	}
+	if err := RejectEnrollment(ctx, kv, "edge-3", "bob"); err != nil {
+		t.Fatalf("RejectEnrollment() error = %v", err)
+	}
+
+	list, err := ListEnrollments(ctx, kv)
+	if err != nil {
+		t.Fatalf("ListEnrollments() error = %v", err)
+	}
+	want := []struct{ node, state, by string }{
+		{"edge-2", EnrollPending, ""},
+		{"edge-1", EnrollApproved, "alice"},
+		{"edge-3", EnrollRejected, "bob"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("ListEnrollments() = %d entries, want %d", len(list), len(want))
+	}
+	for i, w := range want {
+		if e := list[i]; e.Node != w.node || e.State != w.state || e.DecidedBy != w.by {
+			t.Errorf("ListEnrollments()[%d] = %s %s by %q, want %s %s by %q", i, e.Node, e.State, e.DecidedBy, w.node, w.state, w.by)
+		}
+	}
+}
+
+func TestLoadOrCreateNodeKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".auth", "node.nk")
+
+	kp, err := loadOrCreateNodeKey(path)
+	if err != nil {
+		t.Fatalf("loadOrCreateNodeKey() error = %v", err)
+	}
+	again, err := loadOrCreateNodeKey(path)
+	if err != nil {
+		t.Fatalf("loadOrCreateNodeKey() again error = %v", err)
+	}
+	pub, _ := kp.PublicKey()
+	pubAgain, _ := again.PublicKey()
+	if pub != pubAgain {
+		t.Errorf("node key changed between boots: %s, %s", pub, pubAgain)
+	}
+	if !nkeys.IsValidPublicUserKey(pub) {
+		t.Errorf("node key %s is not a user key", pub)
+	}
+}
@@ -1,7 +1,7 @@
 // Package env provides shared environment variable utilities for wellnown-env projects.
 //
 // This package consolidates common patterns used across examples:
-//   - GetEnv/GetEnvInt/GetEnvBool: Read environment variables with defaults
+//   - GetEnv/GetEnvInt/GetEnvBool/GetEnvList: Read environment variables with defaults
 //   - GetProcessComposeURL: Build PC API URL from env vars
 //   - GetViaAddr: Get Via server address from env vars
 //
@@ -20,8 +20,45 @@
 //	NATS:
 //	  NATS_NAME   - Node name
 //	  NATS_PORT   - NATS client port
-//	  NATS_HUB    - Hub URL for leaf nodes
+//	  NATS_HUB    - Hub URL for leaf nodes (comma-separated for failover)
+//	  NATS_CLUSTER_NAME - Cluster name; set on each hub to run a hub cluster
+//	  NATS_CLUSTER_ADDR - Cluster route listener address (default: :6222)
+//	  NATS_CLUSTER_ROUTES - Comma-separated routes to the other hubs
+//	  NATS_CLUSTER_REPLICAS - Registry replicas (default: cluster size, max 3)
 //	  NATS_DATA   - Data directory
+//	  NATS_WS_ADDR - WebSocket listener address (e.g. :8443)
+//	  NATS_MONITOR_ADDR - NATS HTTP monitoring address (e.g. :8222)
+//	  NATS_MQTT_PORT - MQTT listener port for IoT devices (e.g. 1883)
+//	  NATS_MQTT_USER - MQTT username (auth modes none and token)
+//	  NATS_MQTT_PASSWORD - MQTT password
+//	  LIVENESS_MODE - heartbeat (default) or leafnode
+//	  POWER_PROFILE - normal (default) or low for battery devices
+//	  LOW_POWER_HEARTBEAT - Low-power heartbeat in seconds (default: 25)
+//	  LOW_POWER_BATCH - Low-power publish batch interval in seconds (default: 30)
+//	  ENROLL_TOKEN - Enrollment token; leaf nodes register once the hub approves them
+//	  ENROLL_KEY_FILE - Node NKey seed created on first boot (default: .auth/node.nk)
+//	  ENROLL_ATTESTATION - Device evidence sent with enrollment requests (fingerprint)
+//	  ADVERTISE_ADDR - host:port registered for discovery (default: from wellknown:"host"/"port" fields)
+//	  NATS_READ_REPLICA - Serve registry reads from local replicas (true/false)
+//	  NATS_LIGHTWEIGHT - Core NATS only, buckets opened on first use (true/false)
+//	  NATS_LOCAL_NODE - Share a running node instead of embedding one (auto or URL)
+//	  NATS_SOCKET - Unix socket path for same-host clients (empty = none)
+//	  NATS_NO_TCP - Open no TCP client port; local clients use NATS_SOCKET (true/false)
+//	  NATS_HUB_DOMAIN - Hub JetStream domain for replica sources
+//	  NATS_JS_DOMAIN - JetStream domain of this node (empty = shared default domain)
+//	  NATS_OUTBOX - Buffer publishes while the hub is down (true/false)
+//	  JETSTREAM_SPEC - YAML file of streams/consumers provisioned at startup
+//
+//	Config:
+//	  CONFIG_FILE - YAML/JSON config file layered under env vars
+//	  ENVIRONMENT - Selects .env.{ENVIRONMENT} files loaded by New (e.g. production)
+//
+//	Observability:
+//	  METRICS_ADDR - Prometheus /metrics address (e.g. :9100)
+//	  HEALTH_ADDR - /healthz and /readyz address (e.g. :8081)
+//	  BREAKGLASS_ADDR - Token-protected read-only snapshot for outages (e.g. :9911)
+//	  BREAKGLASS_TOKEN - Bearer token of the snapshot endpoint (required with BREAKGLASS_ADDR)
+//	  BREAKGLASS_FILE - Keep the last snapshot in this file across restarts
 //
 // Usage:
 //
@@ -71,6 +108,18 @@ func GetEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// GetEnvList returns a comma-separated environment variable as a list,
+// trimming spaces and dropping empty entries.
+func GetEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 // GetProcessComposeURL constructs the process-compose API URL from env vars.
 // Checks PC_URL first (full override), then builds from PC_ADDRESS and PC_PORT.
 func GetProcessComposeURL() string {
@@ -2,6 +2,7 @@ package env
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -424,3 +425,29 @@ func TestLoadConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestGetEnvList(t *testing.T) {
+	tests := []struct {
+		name   string
+		envVal string
+		want   []string
+	}{
+		{name: "not set", envVal: "", want: nil},
+		{name: "one", envVal: "nats://hub-1:6222", want: []string{"nats://hub-1:6222"}},
+		{name: "several", envVal: "a, b ,c", want: []string{"a", "b", "c"}},
+		{name: "drops empty", envVal: "a,,b,", want: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const key = "TEST_GET_ENV_LIST"
+			os.Setenv(key, tt.envVal)
+			defer os.Unsetenv(key)
+
+			got := GetEnvList(key)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetEnvList(%q) = %q, want %q", tt.envVal, got, tt.want)
+			}
+		})
+	}
+}
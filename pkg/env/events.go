@@ -0,0 +1,203 @@
+// events.go: In-process lifecycle events
+//
+// The Manager announces its lifecycle on an in-process bus, so plugins and
+// application code hook in without wrapping Parse or Close:
+//
+//	unsubscribe := mgr.Events().Subscribe(func(e env.Event) {
+//	    log.Printf("%s at %s", e.Type, e.Time.Format(time.RFC3339))
+//	}, env.EventHubConnected, env.EventHubDisconnected)
+//	defer unsubscribe()
+//
+// Events:
+//
+//	config-parsed         Parse validated the config (Event.Config)
+//	registered            The service registered with the mesh
+//	hub-connected         The leaf link to the hub came up (leaf nodes only)
+//	hub-disconnected      The leaf link went down
+//	secret-rotated        A secrets.rotated.* notice or synced bundle arrived (Event.Path)
+//	maintenance-started   The node was put in maintenance (Event.Maintenance)
+//	maintenance-ended     The node's maintenance flag was cleared
+//	slow-consumer         A subscription fell behind and NATS dropped messages (Event.SlowConsumer)
+//	shutting-down         Close started; the manager is still usable
+//
+// Handlers run synchronously in subscription order on the goroutine that
+// emits the event, so they must not block. They may subscribe and
+// unsubscribe.
+package env
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventType names a lifecycle event
+type EventType string
+
+// Lifecycle events
+const (
+	EventConfigParsed    EventType = "config-parsed"
+	EventRegistered      EventType = "registered"
+	EventHubConnected    EventType = "hub-connected"
+	EventHubDisconnected EventType = "hub-disconnected"
+	EventSecretRotated   EventType = "secret-rotated"
+	EventSlowConsumer    EventType = "slow-consumer"
+	EventShuttingDown    EventType = "shutting-down"
+
+	EventMaintenanceStarted EventType = "maintenance-started"
+	EventMaintenanceEnded   EventType = "maintenance-ended"
+)
+
+// hubWatchInterval is how often the leaf link state is checked
+const hubWatchInterval = time.Second
+
+// Event is a lifecycle event
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Config any    // config-parsed: the parsed config
+	Path   string // secret-rotated: the secret path
+
+	Maintenance  *Maintenance  // maintenance-started: the flag
+	SlowConsumer *SlowConsumer // slow-consumer: the subscription
+}
+
+// EventBus delivers events to subscribers. It is safe for concurrent use;
+// a nil bus drops events.
+type EventBus struct {
+	mu   sync.Mutex
+	next int
+	subs []eventSub
+}
+
+// eventSub is one subscription
+type eventSub struct {
+	id    int
+	fn    func(Event)
+	types []EventType // Empty = all
+}
+
+// Subscribe calls fn for events of types (all events if none) and returns
+// a function that ends the subscription
+func (b *EventBus) Subscribe(fn func(Event), types ...EventType) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next++
+	id := b.next
+	b.subs = append(b.subs, eventSub{id: id, fn: fn, types: types})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subs = slices.DeleteFunc(b.subs, func(s eventSub) bool { return s.id == id })
+	}
+}
+
+// emit delivers e to the current subscribers
+func (b *EventBus) emit(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.Lock()
+	subs := slices.Clone(b.subs)
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		if len(s.types) == 0 || slices.Contains(s.types, e.Type) {
+			s.fn(e)
+		}
+	}
+}
+
+// Events returns the manager's lifecycle event bus
+func (m *Manager) Events() *EventBus {
+	return m.events
+}
+
+// startEvents emits secret-rotated and, on leaf nodes, hub link events
+func (m *Manager) startEvents() error {
+	if m.natsNode == nil {
+		return nil
+	}
+	sub, err := OnRotate(m.natsNode.ControlConn(), func(path string) {
+		m.events.emit(Event{Type: EventSecretRotated, Path: path})
+	})
+	if err != nil {
+		return err
+	}
+	m.rotationSub = sub
+
+	if err := m.watchMaintenance(); err != nil {
+		return err
+	}
+	if err := m.watchNodeTags(); err != nil {
+		return err
+	}
+	if err := m.watchNodePower(); err != nil {
+		return err
+	}
+
+	if m.natsNode.IsLeaf() {
+		m.eventsStop = make(chan struct{})
+		m.eventsDone = make(chan struct{})
+		go m.watchHub()
+	}
+	return nil
+}
+
+// watchHub emits hub-connected and hub-disconnected as the leaf link
+// changes state
+func (m *Manager) watchHub() {
+	defer close(m.eventsDone)
+
+	ticker := time.NewTicker(hubWatchInterval)
+	defer ticker.Stop()
+
+	connected := false
+	for {
+		select {
+		case <-m.eventsStop:
+			return
+		case <-ticker.C:
+			now := m.natsNode.HubConnected()
+			if now == connected {
+				continue
+			}
+			connected = now
+			if now {
+				m.events.emit(Event{Type: EventHubConnected})
+			} else {
+				m.events.emit(Event{Type: EventHubDisconnected})
+			}
+		}
+	}
+}
+
+// stopEvents stops the rotation and secret sync subscriptions and the hub
+// watcher
+func (m *Manager) stopEvents() {
+	if m.rotationSub != nil {
+		m.rotationSub.Unsubscribe()
+		m.rotationSub = nil
+	}
+	m.mu.Lock()
+	if m.syncSub != nil {
+		m.syncSub.Unsubscribe()
+		m.syncSub = nil
+	}
+	watches := []Watcher{m.maintWatch, m.tagsWatch, m.powerWatch}
+	m.maintWatch, m.tagsWatch, m.powerWatch = nil, nil, nil
+	m.mu.Unlock()
+	for _, w := range watches {
+		if w != nil {
+			w.Stop()
+		}
+	}
+	if m.eventsStop != nil {
+		close(m.eventsStop)
+		<-m.eventsDone
+		m.eventsStop = nil
+	}
+}
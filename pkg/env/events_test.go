@@ -0,0 +1,61 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventBus(t *testing.T) {
+	var b EventBus
+	var got []string
+	record := func(name string) func(Event) {
+		return func(e Event) {
+			got = append(got, name+":"+string(e.Type))
+			if e.Time.IsZero() {
+				t.Errorf("%s got an event without a time", name)
+			}
+		}
+	}
+
+	b.Subscribe(record("all"))
+	unsub := b.Subscribe(record("hub"), EventHubConnected, EventHubDisconnected)
+	b.Subscribe(func(e Event) {
+		// Handlers may subscribe; the new one sees the next event
+		if e.Type == EventHubConnected {
+			b.Subscribe(record("late"))
+		}
+	})
+
+	b.emit(Event{Type: EventHubConnected})
+	b.emit(Event{Type: EventConfigParsed})
+	unsub()
+	b.emit(Event{Type: EventHubDisconnected})
+
+	want := "all:hub-connected hub:hub-connected all:config-parsed late:config-parsed all:hub-disconnected late:hub-disconnected"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("deliveries = %q, want %q", s, want)
+	}
+
+	var nilBus *EventBus
+	nilBus.emit(Event{Type: EventShuttingDown}) // Dropped, no panic
+}
+
+func TestManagerShutdownEvent(t *testing.T) {
+	var log []string
+	p := &recordingPlugin{name: "p", log: &log}
+	m, err := New("APP", WithoutNATS(), WithPlugins(p))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	m.Events().Subscribe(func(e Event) {
+		// The manager is still usable while shutting down
+		_ = m.SecretReport()
+		log = append(log, string(e.Type))
+	})
+	m.Close()
+
+	want := "p.init shutting-down p.shutdown"
+	if got := strings.Join(log, " "); got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,547 @@
+// exporter.go: Forward mesh events to external systems
+//
+// Enterprises with existing observability pipelines want registry changes,
+// alerts and audit messages in their own tools. An Exporter forwards
+// selected events to sinks outside NATS, batched and retried in the
+// background. Routes come from a YAML file (WithExportSpec or EXPORT_SPEC,
+// e.g. on nats-node):
+//
+//	exports:
+//	  - name: registry-to-splunk
+//	    registry: true                     # services_registry puts/deletes
+//	    template: '{"event": {{json .}}, "sourcetype": "wellnown"}'
+//	    sink: {type: webhook, url: "https://splunk:8088/services/collector/event",
+//	           headers: {Authorization: "Splunk <token>"}}
+//	  - name: alerts-to-kafka
+//	    subjects: [alerts.>, audit.>]
+//	    sink: {type: kafka-rest, url: "http://kafka-rest:8082", topic: mesh-events}
+//	  - name: audit-to-otel
+//	    subjects: [audit.>]
+//	    sink: {type: otlp, url: "http://collector:4318"}
+//
+// Sinks:
+//
+//	webhook    - one HTTP POST per event (JSON body)
+//	kafka-rest - Confluent REST Proxy v2, one request per batch
+//	otlp       - OTLP/HTTP logs (JSON encoding), one request per batch
+//
+// Native Kafka or other protocols plug in as a Sink via ExportRoute.Target.
+// Each event is rendered with the route's text/template (default: the
+// ExportEvent as JSON). Subjects are core subscriptions: events published
+// while the exporter is down are not replayed.
+package env
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/yaml.v3"
+)
+
+// Export defaults
+const (
+	DefaultExportBatch    = 100
+	DefaultExportInterval = time.Second
+	DefaultExportBuffer   = 4096
+	DefaultExportTimeout  = 10 * time.Second
+)
+
+// ExportEvent is an event handed to an export route
+type ExportEvent struct {
+	Source  string            `json:"source"`  // registry or subject
+	Subject string            `json:"subject"` // NATS subject or registry key
+	Op      string            `json:"op"`      // put or delete (registry), msg (subject)
+	Time    time.Time         `json:"time"`
+	Payload json.RawMessage   `json:"payload,omitempty"` // JSON payloads as is, others as a JSON string
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// newExportEvent builds an event, keeping JSON payloads as JSON
+func newExportEvent(source, subject, op string, data []byte) ExportEvent {
+	e := ExportEvent{Source: source, Subject: subject, Op: op, Time: time.Now().UTC()}
+	if len(data) > 0 {
+		if json.Valid(data) {
+			e.Payload = json.RawMessage(data)
+		} else {
+			e.Payload, _ = json.Marshal(string(data))
+		}
+	}
+	return e
+}
+
+// ExportRecord is a rendered event
+type ExportRecord struct {
+	Event ExportEvent
+	Body  []byte // Output of the route template
+}
+
+// Sink delivers records to an external system. Export is called from one
+// goroutine per route; an error retries the whole batch, so delivery is
+// at least once.
+type Sink interface {
+	Export(ctx context.Context, records []ExportRecord) error
+}
+
+// ExportSpec is a set of export routes
+type ExportSpec struct {
+	Exports []ExportRoute `yaml:"exports"`
+}
+
+// ExportRoute forwards the events of its sources to one sink
+type ExportRoute struct {
+	Name     string   `yaml:"name"`
+	Registry bool     `yaml:"registry"` // Registry puts and deletes
+	Subjects []string `yaml:"subjects"` // NATS subjects (wildcards allowed)
+	Template string   `yaml:"template"` // text/template over ExportEvent (empty = JSON)
+	Sink     SinkSpec `yaml:"sink"`
+	Target   Sink     `yaml:"-"` // Custom sink; overrides Sink
+
+	BatchSize     int           `yaml:"batch_size"`     // Default: DefaultExportBatch
+	FlushInterval time.Duration `yaml:"flush_interval"` // Default: DefaultExportInterval
+	Buffer        int           `yaml:"buffer"`         // Events queued before dropping (default: DefaultExportBuffer)
+}
+
+// SinkSpec configures a built-in sink
+type SinkSpec struct {
+	Type    string            `yaml:"type"` // webhook, kafka-rest or otlp
+	URL     string            `yaml:"url"`
+	Topic   string            `yaml:"topic"` // kafka-rest
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"` // Per request (default: DefaultExportTimeout)
+}
+
+// LoadExportSpec reads a YAML export spec file
+func LoadExportSpec(path string) (*ExportSpec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading export spec: %w", err)
+	}
+	var spec ExportSpec
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("parsing export spec %s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+// WithExportSpec forwards events as declared in a YAML export spec
+func WithExportSpec(path string) Option {
+	return func(o *Options) {
+		o.ExportSpec = path
+	}
+}
+
+// exportFuncs are available in route templates
+var exportFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"string": func(raw json.RawMessage) string {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+		return string(raw)
+	},
+}
+
+// renderFunc formats an event for a sink
+type renderFunc func(ExportEvent) ([]byte, error)
+
+// newRender parses a route template
+func newRender(name, text string) (renderFunc, error) {
+	if text == "" {
+		return func(e ExportEvent) ([]byte, error) { return json.Marshal(e) }, nil
+	}
+	tmpl, err := template.New(name).Funcs(exportFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("export %s: parsing template: %w", name, err)
+	}
+	return func(e ExportEvent) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, e); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}, nil
+}
+
+// build creates the sink of a spec
+func (s SinkSpec) build() (Sink, error) {
+	if s.URL == "" {
+		return nil, fmt.Errorf("sink url is required")
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExportTimeout
+	}
+	h := httpSink{url: strings.TrimSuffix(s.URL, "/"), headers: s.Headers, client: &http.Client{Timeout: timeout}}
+
+	switch s.Type {
+	case "webhook":
+		return &webhookSink{h}, nil
+	case "kafka-rest":
+		if s.Topic == "" {
+			return nil, fmt.Errorf("kafka-rest sink needs a topic")
+		}
+		return &kafkaRESTSink{httpSink: h, topic: s.Topic}, nil
+	case "otlp":
+		return &otlpSink{h}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q (use: webhook, kafka-rest, otlp)", s.Type)
+	}
+}
+
+// httpSink posts to an HTTP endpoint
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// post sends body and fails on non-2xx responses
+func (h httpSink) post(ctx context.Context, url, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// webhookSink posts every record on its own
+type webhookSink struct{ httpSink }
+
+func (s *webhookSink) Export(ctx context.Context, records []ExportRecord) error {
+	for _, r := range records {
+		if err := s.post(ctx, s.url, "application/json", r.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kafkaRESTSink produces to a topic through a Confluent REST Proxy
+type kafkaRESTSink struct {
+	httpSink
+	topic string
+}
+
+func (s *kafkaRESTSink) Export(ctx context.Context, records []ExportRecord) error {
+	type kafkaRecord struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	batch := struct {
+		Records []kafkaRecord `json:"records"`
+	}{}
+	for _, r := range records {
+		value := json.RawMessage(r.Body)
+		if !json.Valid(r.Body) {
+			value, _ = json.Marshal(string(r.Body))
+		}
+		batch.Records = append(batch.Records, kafkaRecord{Key: r.Event.Subject, Value: value})
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return s.post(ctx, s.url+"/topics/"+s.topic, "application/vnd.kafka.json.v2+json", body)
+}
+
+// otlpSink sends records as OTLP log records
+type otlpSink struct{ httpSink }
+
+func (s *otlpSink) Export(ctx context.Context, records []ExportRecord) error {
+	type value struct {
+		StringValue string `json:"stringValue"`
+	}
+	type attr struct {
+		Key   string `json:"key"`
+		Value value  `json:"value"`
+	}
+	type logRecord struct {
+		TimeUnixNano string `json:"timeUnixNano"`
+		Body         value  `json:"body"`
+		Attributes   []attr `json:"attributes"`
+	}
+
+	logs := make([]logRecord, 0, len(records))
+	for _, r := range records {
+		logs = append(logs, logRecord{
+			TimeUnixNano: strconv.FormatInt(r.Event.Time.UnixNano(), 10),
+			Body:         value{string(r.Body)},
+			Attributes: []attr{
+				{"wellnown.source", value{r.Event.Source}},
+				{"wellnown.subject", value{r.Event.Subject}},
+				{"wellnown.op", value{r.Event.Op}},
+			},
+		})
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceLogs": []any{map[string]any{
+			"resource": map[string]any{"attributes": []attr{{"service.name", value{"wellnown-env"}}}},
+			"scopeLogs": []any{map[string]any{
+				"scope":      map[string]string{"name": "wellnown-env/exporter"},
+				"logRecords": logs,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return s.post(ctx, s.url+"/v1/logs", "application/json", body)
+}
+
+// Exporter runs export routes until stopped
+type Exporter struct {
+	routes []*exportRoute
+	subs   []*nats.Subscription
+	watch  Watcher
+	logger *slog.Logger
+}
+
+// StartExporter subscribes the routes' sources and starts delivering. kv
+// is the registry bucket (nil if no route exports the registry).
+func StartExporter(nc *nats.Conn, kv jetstream.KeyValue, routes []ExportRoute, logger *slog.Logger) (*Exporter, error) {
+	x := &Exporter{logger: componentLogger(logger, "exporter")}
+
+	var registryRoutes []*exportRoute
+	for _, spec := range routes {
+		r, err := newExportRoute(spec, x.logger)
+		if err != nil {
+			x.Stop()
+			return nil, err
+		}
+		x.routes = append(x.routes, r)
+		go r.run()
+
+		for _, subject := range spec.Subjects {
+			sub, err := nc.Subscribe(subject, func(msg *nats.Msg) {
+				e := newExportEvent("subject", msg.Subject, "msg", msg.Data)
+				if len(msg.Header) > 0 {
+					e.Headers = make(map[string]string, len(msg.Header))
+					for k := range msg.Header {
+						e.Headers[k] = msg.Header.Get(k)
+					}
+				}
+				r.enqueue(e)
+			})
+			if err != nil {
+				x.Stop()
+				return nil, fmt.Errorf("export %s: subscribing %s: %w", spec.Name, subject, err)
+			}
+			x.subs = append(x.subs, sub)
+		}
+		if spec.Registry {
+			registryRoutes = append(registryRoutes, r)
+		}
+	}
+
+	if len(registryRoutes) > 0 {
+		if kv == nil {
+			x.Stop()
+			return nil, fmt.Errorf("registry export needs the registry bucket")
+		}
+		w, err := WatchAll(context.Background(), kv, func(key string, reg *registry.ServiceRegistration, deleted bool) {
+			op, data := "put", []byte(nil)
+			if deleted {
+				op = "delete"
+			} else if reg != nil {
+				data, _ = json.Marshal(reg)
+			}
+			e := newExportEvent("registry", key, op, data)
+			for _, r := range registryRoutes {
+				r.enqueue(e)
+			}
+		})
+		if err != nil {
+			x.Stop()
+			return nil, fmt.Errorf("watching registry for export: %w", err)
+		}
+		x.watch = w
+	}
+
+	x.logger.Info("exporter started", "routes", len(x.routes))
+	return x, nil
+}
+
+// Stop unsubscribes and flushes what is queued (bounded by the sink
+// timeouts)
+func (x *Exporter) Stop() {
+	if x.watch != nil {
+		_ = x.watch.Stop()
+	}
+	for _, sub := range x.subs {
+		_ = sub.Unsubscribe()
+	}
+	for _, r := range x.routes {
+		r.stop()
+	}
+}
+
+// exportRoute is a running route: a queue and a delivery goroutine
+type exportRoute struct {
+	name     string
+	render   renderFunc
+	sink     Sink
+	batch    int
+	interval time.Duration
+	logger   *slog.Logger
+
+	queue    chan ExportEvent
+	mu       sync.Mutex // Guards stopped against enqueue
+	stopped  bool
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newExportRoute validates spec and applies defaults
+func newExportRoute(spec ExportRoute, logger *slog.Logger) (*exportRoute, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("export name is required")
+	}
+	if !spec.Registry && len(spec.Subjects) == 0 {
+		return nil, fmt.Errorf("export %s: no registry or subjects to export", spec.Name)
+	}
+	render, err := newRender(spec.Name, spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	sink := spec.Target
+	if sink == nil {
+		if sink, err = spec.Sink.build(); err != nil {
+			return nil, fmt.Errorf("export %s: %w", spec.Name, err)
+		}
+	}
+
+	r := &exportRoute{
+		name:     spec.Name,
+		render:   render,
+		sink:     sink,
+		batch:    spec.BatchSize,
+		interval: spec.FlushInterval,
+		logger:   logger.With("export", spec.Name),
+		done:     make(chan struct{}),
+	}
+	if r.batch <= 0 {
+		r.batch = DefaultExportBatch
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultExportInterval
+	}
+	buffer := spec.Buffer
+	if buffer <= 0 {
+		buffer = DefaultExportBuffer
+	}
+	r.queue = make(chan ExportEvent, buffer)
+	return r, nil
+}
+
+// enqueue queues e, dropping it if the sink can't keep up
+func (r *exportRoute) enqueue(e ExportEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	select {
+	case r.queue <- e:
+	default:
+		metrics.exportDropped.Add(1)
+	}
+}
+
+// run batches queued events until the queue is closed
+func (r *exportRoute) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var batch []ExportRecord
+	for {
+		select {
+		case e, ok := <-r.queue:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			body, err := r.render(e)
+			if err != nil {
+				metrics.exportFailed.Add(1)
+				r.logger.Warn("rendering event failed", "subject", e.Subject, "error", err)
+				continue
+			}
+			batch = append(batch, ExportRecord{Event: e, Body: body})
+			if len(batch) >= r.batch {
+				r.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+// flush delivers a batch, retrying with the write policy backoff, and
+// drops it when all attempts failed
+func (r *exportRoute) flush(batch []ExportRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	p := DefaultWritePolicy
+	var err error
+	for attempt := 1; attempt <= p.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(p.backoff(attempt - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultExportTimeout)
+		err = r.sink.Export(ctx, batch)
+		cancel()
+		if err == nil {
+			metrics.exportSent.Add(uint64(len(batch)))
+			return
+		}
+	}
+	metrics.exportFailed.Add(uint64(len(batch)))
+	r.logger.Warn("export failed, batch dropped", "records", len(batch), "error", err)
+}
+
+// stop closes the queue and waits for the last flush
+func (r *exportRoute) stop() {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		r.stopped = true
+		close(r.queue)
+		r.mu.Unlock()
+		<-r.done
+	})
+}
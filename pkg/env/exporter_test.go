@@ -0,0 +1,213 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewExportEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "json", data: `{"level":"critical"}`, want: `{"level":"critical"}`},
+		{name: "text", data: "disk full", want: `"disk full"`},
+		{name: "empty", data: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExportEvent("subject", "alerts.disk", "msg", []byte(tt.data))
+			if got := string(e.Payload); got != tt.want {
+				t.Errorf("Payload = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportTemplate(t *testing.T) {
+	e := newExportEvent("subject", "alerts.disk", "msg", []byte("disk full"))
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "fields", template: `{{.Subject}}: {{string .Payload}}`, want: "alerts.disk: disk full"},
+		{name: "json", template: `{"event": {{json .Subject}}}`, want: `{"event": "alerts.disk"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			render, err := newRender(tt.name, tt.template)
+			if err != nil {
+				t.Fatalf("newRender() error = %v", err)
+			}
+			got, err := render(e)
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("render() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := newRender("bad", "{{.Subject"); err == nil {
+		t.Error("newRender() accepted a broken template")
+	}
+}
+
+func TestExportSinks(t *testing.T) {
+	records := []ExportRecord{
+		{Event: newExportEvent("registry", "o.r.a", "put", nil), Body: []byte(`{"n":1}`)},
+		{Event: newExportEvent("registry", "o.r.b", "delete", nil), Body: []byte("plain")},
+	}
+
+	tests := []struct {
+		name        string
+		spec        SinkSpec
+		wantPath    string
+		wantType    string
+		wantBodies  int
+		wantContain string
+	}{
+		{name: "webhook", spec: SinkSpec{Type: "webhook"}, wantPath: "/", wantType: "application/json", wantBodies: 2, wantContain: `{"n":1}`},
+		{name: "kafka-rest", spec: SinkSpec{Type: "kafka-rest", Topic: "mesh"}, wantPath: "/topics/mesh", wantType: "application/vnd.kafka.json.v2+json", wantBodies: 1, wantContain: `{"key":"o.r.b","value":"plain"}`},
+		{name: "otlp", spec: SinkSpec{Type: "otlp"}, wantPath: "/v1/logs", wantType: "application/json", wantBodies: 1, wantContain: `"key":"wellnown.subject","value":{"stringValue":"o.r.a"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.wantPath {
+					t.Errorf("path = %s, want %s", r.URL.Path, tt.wantPath)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != tt.wantType {
+					t.Errorf("Content-Type = %s, want %s", ct, tt.wantType)
+				}
+				if r.Header.Get("Authorization") != "Bearer x" {
+					t.Error("configured header not sent")
+				}
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			tt.spec.URL = srv.URL
+			tt.spec.Headers = map[string]string{"Authorization": "Bearer x"}
+			sink, err := tt.spec.build()
+			if err != nil {
+				t.Fatalf("build() error = %v", err)
+			}
+			if err := sink.Export(context.Background(), records); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			if len(bodies) != tt.wantBodies {
+				t.Fatalf("%d requests, want %d", len(bodies), tt.wantBodies)
+			}
+			if all := strings.Join(bodies, "\n"); !strings.Contains(all, tt.wantContain) {
+				t.Errorf("bodies %s do not contain %s", all, tt.wantContain)
+			}
+			for _, b := range bodies {
+				if tt.name != "webhook" && !json.Valid([]byte(b)) {
+					t.Errorf("invalid JSON body %s", b)
+				}
+			}
+		})
+	}
+}
+
+func TestExportSinkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	sink, _ := SinkSpec{Type: "webhook", URL: srv.URL}.build()
+	err := sink.Export(context.Background(), []ExportRecord{{Body: []byte("{}")}})
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("Export() error = %v, want the response status and body", err)
+	}
+}
+
+func TestExportRouteValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		route ExportRoute
+	}{
+		{name: "no name", route: ExportRoute{Registry: true, Target: &fakeSink{}}},
+		{name: "no sources", route: ExportRoute{Name: "x", Target: &fakeSink{}}},
+		{name: "unknown sink", route: ExportRoute{Name: "x", Registry: true, Sink: SinkSpec{Type: "syslog", URL: "udp://x"}}},
+		{name: "no url", route: ExportRoute{Name: "x", Registry: true, Sink: SinkSpec{Type: "webhook"}}},
+		{name: "kafka without topic", route: ExportRoute{Name: "x", Registry: true, Sink: SinkSpec{Type: "kafka-rest", URL: "http://k"}}},
+		{name: "bad template", route: ExportRoute{Name: "x", Registry: true, Template: "{{", Target: &fakeSink{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newExportRoute(tt.route, slog.Default()); err == nil {
+				t.Error("newExportRoute() accepted an invalid route")
+			}
+		})
+	}
+}
+
+func TestExportRouteDelivers(t *testing.T) {
+	sink := &fakeSink{failures: 1}
+	r, err := newExportRoute(ExportRoute{Name: "test", Registry: true, Target: sink, BatchSize: 2}, slog.Default())
+	if err != nil {
+		t.Fatalf("newExportRoute() error = %v", err)
+	}
+	go r.run()
+
+	for _, key := range []string{"o.r.a", "o.r.b", "o.r.c"} {
+		r.enqueue(newExportEvent("registry", key, "put", nil))
+	}
+	r.stop() // Flushes the partial batch
+	r.enqueue(newExportEvent("registry", "o.r.late", "put", nil))
+
+	if got := strings.Join(sink.subjects(), ","); got != "o.r.a,o.r.b,o.r.c" {
+		t.Errorf("delivered %s, want o.r.a,o.r.b,o.r.c (first batch retried)", got)
+	}
+}
+
+// fakeSink records delivered subjects and fails the first failures calls
+type fakeSink struct {
+	mu        sync.Mutex
+	failures  int
+	delivered []string
+}
+
+func (s *fakeSink) Export(ctx context.Context, records []ExportRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	for _, r := range records {
+		s.delivered = append(s.delivered, r.Event.Subject)
+	}
+	return nil
+}
+
+func (s *fakeSink) subjects() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.delivered...)
+}
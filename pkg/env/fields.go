@@ -4,12 +4,19 @@
 // - Field paths (DB.Password)
 // - Types (string, int, etc.)
 // - Env var names (APP_DB_PASSWORD)
-// - Defaults, required flags, mask (secret) flags
+// - Defaults, required flags, mask (secret) flags, help text
 // - Service dependencies (service:org/repo)
+//
+// ConfigHash fingerprints the resolved non-secret values so instances of
+// one service can be compared for drift (see GetDrift).
 package env
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/joeblew999/wellnown-env/pkg/env/registry"
@@ -18,6 +25,9 @@ import (
 // ExtractFields extracts FieldInfo from a config struct using reflection.
 // The prefix is the env var prefix (e.g., "APP").
 func ExtractFields(prefix string, cfg interface{}) []registry.FieldInfo {
+	if cfg == nil {
+		return nil // No config (e.g. the mesh dashboard)
+	}
 	var fields []registry.FieldInfo
 	extractFieldsRecursive(prefix, "", reflect.TypeOf(cfg), &fields)
 	return fields
@@ -72,7 +82,7 @@ func parseConfTag(prefix, path, typeName, tag string) registry.FieldInfo {
 	fi := registry.FieldInfo{
 		Path:   path,
 		Type:   typeName,
-		EnvKey: buildEnvKey(prefix, path),
+		EnvKey: confEnvKey(prefix, confPathKey(path)),
 	}
 
 	if tag == "" {
@@ -89,8 +99,11 @@ func parseConfTag(prefix, path, typeName, tag string) registry.FieldInfo {
 			fi.Default = strings.TrimPrefix(part, "default:")
 
 		case strings.HasPrefix(part, "env:"):
-			// Custom env var name overrides default
-			fi.EnvKey = strings.TrimPrefix(part, "env:")
+			// Custom env var name overrides default (conf still adds the prefix)
+			fi.EnvKey = confEnvKey(prefix, strings.Split(strings.TrimPrefix(part, "env:"), "_"))
+
+		case strings.HasPrefix(part, "help:"):
+			fi.Help = strings.TrimPrefix(part, "help:")
 
 		case strings.HasPrefix(part, "service:"):
 			// Service dependency: service:org/repo
@@ -111,20 +124,6 @@ func parseConfTag(prefix, path, typeName, tag string) registry.FieldInfo {
 	return fi
 }
 
-// buildEnvKey converts a field path to env var name
-// e.g., prefix="APP", path="DB.Password" -> "APP_DB_PASSWORD"
-func buildEnvKey(prefix, path string) string {
-	// Replace dots with underscores and uppercase
-	key := strings.ReplaceAll(path, ".", "_")
-	key = strings.ToUpper(key)
-
-	if prefix != "" {
-		key = strings.ToUpper(prefix) + "_" + key
-	}
-
-	return key
-}
-
 // GetDependencies extracts service dependencies from fields
 func GetDependencies(fields []registry.FieldInfo) []string {
 	var deps []string
@@ -161,3 +160,59 @@ func GetRequired(fields []registry.FieldInfo) []registry.FieldInfo {
 	}
 	return required
 }
+
+// ConfigHash returns a short hash of the resolved values of all non-secret
+// fields in cfg (after Parse). Instances running the same config report
+// the same hash; secrets never contribute, so the hash is safe to publish.
+func ConfigHash(fields []registry.FieldInfo, cfg interface{}) string {
+	sorted := make([]registry.FieldInfo, 0, len(fields))
+	for _, f := range fields {
+		if !f.IsSecret {
+			sorted = append(sorted, f)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	root := reflect.ValueOf(cfg)
+	h := sha256.New()
+	for _, f := range sorted {
+		value, ok := fieldValue(root, f.Path)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(h, "%s=%v\n", f.Path, value.Interface())
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// fieldValue follows a field path (e.g. "DB.Host") through cfg; promoted
+// fields of embedded structs resolve like ExtractFields paths. Pointers are
+// followed so the value, not its address, is returned; nil is not found.
+func fieldValue(v reflect.Value, path string) (reflect.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		var ok bool
+		if v, ok = deref(v); !ok || v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return reflect.Value{}, false
+		}
+	}
+	v, ok := deref(v)
+	if !ok || !v.CanInterface() {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// deref follows pointers and interfaces; false if one is nil
+func deref(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
@@ -0,0 +1,404 @@
+// fleet.go: Node tags and bulk commands by tag
+//
+// Nodes are grouped by tags kept in the node_tags KV bucket, keyed by NATS
+// node name:
+//
+//	wellknown-check node tag edge-7 site=warehouse-3 hw=rpi4
+//	wellknown-check node tag edge-7 hw-              # Remove a tag
+//	wellknown-check node list --tags site=warehouse-3
+//
+// Every Manager watches its node's tags and carries them in its
+// registration (Instance.Tags), so discovery can filter on them:
+//
+//	regs, _ := mgr.GetService(ctx, "joeblew999/camera")
+//	regs = env.FilterTags(regs, env.TagSelector{"site": "warehouse-3"})
+//
+// Commands go to every node matching a selector at once. Nodes opt in with
+// HandleFleetCommands (pcview.FleetHandler runs process actions):
+//
+//	wellknown-check node exec site=warehouse-3 restart camera
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NodeTagsBucket holds the node tags, keyed by node name
+const NodeTagsBucket = "node_tags"
+
+// FleetSubject carries bulk commands to the nodes
+const FleetSubject = "fleet.commands"
+
+// NodeTags are the tags of one node
+type NodeTags struct {
+	Node    string            `json:"node"`
+	Tags    map[string]string `json:"tags"`
+	Updated time.Time         `json:"updated"`
+}
+
+// TagSelector matches nodes carrying all of its tags (empty = all nodes)
+type TagSelector map[string]string
+
+// ParseTagSelector parses "site=warehouse-3,hw=rpi4"
+func ParseTagSelector(s string) (TagSelector, error) {
+	sel := TagSelector{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag selector %q (want key=value)", part)
+		}
+		sel[key] = value
+	}
+	return sel, nil
+}
+
+// Matches reports whether tags carry every tag of the selector
+func (s TagSelector) Matches(tags map[string]string) bool {
+	for k, v := range s {
+		if got, ok := tags[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the selector like ParseTagSelector's input
+func (s TagSelector) String() string {
+	parts := make([]string, 0, len(s))
+	for k, v := range s {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// OpenNodeTagsBucket creates (or opens) the node_tags bucket
+func OpenNodeTagsBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      NodeTagsBucket,
+		Description: "Node tags for wellnown-env",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening node tags bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// GetNodeTags returns a node's tags (nil if it has none)
+func GetNodeTags(ctx context.Context, kv jetstream.KeyValue, node string) (map[string]string, error) {
+	entry, _, err := NewTypedKV[NodeTags](kv).Get(ctx, node)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting tags of %s: %w", node, err)
+	}
+	return entry.Tags, nil
+}
+
+// SetNodeTags replaces a node's tags (no tags deletes the entry)
+func SetNodeTags(ctx context.Context, kv jetstream.KeyValue, node string, tags map[string]string) error {
+	if node == "" {
+		return fmt.Errorf("node tags need a node name")
+	}
+	if len(tags) == 0 {
+		if err := kv.Delete(ctx, node); err != nil {
+			return fmt.Errorf("clearing tags of %s: %w", node, err)
+		}
+		return nil
+	}
+	entry := NodeTags{Node: node, Tags: tags, Updated: time.Now().UTC()}
+	if _, err := NewTypedKV[NodeTags](kv).Put(ctx, node, entry); err != nil {
+		return fmt.Errorf("setting tags of %s: %w", node, err)
+	}
+	return nil
+}
+
+// ListNodeTags returns the tagged nodes matching sel, sorted by name
+func ListNodeTags(ctx context.Context, kv jetstream.KeyValue, sel TagSelector) ([]NodeTags, error) {
+	all, err := NewTypedKV[NodeTags](kv).List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var nodes []NodeTags
+	for _, n := range all {
+		if sel.Matches(n.Tags) {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes, nil
+}
+
+// FilterTags returns the registrations whose node matches sel
+func FilterTags(regs []registry.ServiceRegistration, sel TagSelector) []registry.ServiceRegistration {
+	var matched []registry.ServiceRegistration
+	for _, reg := range regs {
+		if sel.Matches(reg.Instance.Tags) {
+			matched = append(matched, reg)
+		}
+	}
+	return matched
+}
+
+// FleetNode is a node with its tags and the services registered on it
+type FleetNode struct {
+	Node        string
+	Tags        map[string]string
+	Services    []string              // org/repo, sorted
+	Maintenance *registry.Maintenance // From its registrations (nil = in service)
+	Power       string                // Low if a registration is in the low-power profile
+	Late        bool                  // A registration's heartbeat is overdue for its profile
+}
+
+// NodeGroup is the nodes sharing one value of a tag ("" = untagged)
+type NodeGroup struct {
+	Value string
+	Nodes []FleetNode
+}
+
+// FleetNodes returns the tagged nodes and the nodes with registered
+// services, sorted by name
+func (m *Manager) FleetNodes(ctx context.Context) ([]FleetNode, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	kv, err := OpenNodeTagsBucket(ctx, m.natsNode.ControlJetStream())
+	if err != nil {
+		return nil, err
+	}
+	tagged, err := ListNodeTags(ctx, kv, nil)
+	if err != nil {
+		return nil, err
+	}
+	regs, err := m.GetAllServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	byName := make(map[string]*FleetNode)
+	node := func(name string) *FleetNode {
+		if byName[name] == nil {
+			byName[name] = &FleetNode{Node: name}
+		}
+		return byName[name]
+	}
+	for _, t := range tagged {
+		node(t.Node).Tags = t.Tags
+	}
+	for _, reg := range regs {
+		if reg.Instance.Node == "" {
+			continue
+		}
+		n := node(reg.Instance.Node)
+		if name := reg.GitHub.Name(); name != "" && !slices.Contains(n.Services, name) {
+			n.Services = append(n.Services, name)
+		}
+		if reg.Maintenance != nil {
+			n.Maintenance = reg.Maintenance
+		}
+		if reg.Power != nil {
+			n.Power = reg.Power.Profile
+		}
+		if heartbeatLate(reg, time.Duration(m.opts.HeartbeatInterval)*time.Second, now) {
+			n.Late = true
+		}
+	}
+
+	nodes := make([]FleetNode, 0, len(byName))
+	for _, n := range byName {
+		sort.Strings(n.Services)
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes, nil
+}
+
+// GroupNodes groups nodes by the value of tag key, sorted by value with
+// the untagged nodes last
+func GroupNodes(nodes []FleetNode, key string) []NodeGroup {
+	byValue := make(map[string][]FleetNode)
+	for _, n := range nodes {
+		byValue[n.Tags[key]] = append(byValue[n.Tags[key]], n)
+	}
+	groups := make([]NodeGroup, 0, len(byValue))
+	for value, members := range byValue {
+		groups = append(groups, NodeGroup{Value: value, Nodes: members})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if (groups[i].Value == "") != (groups[j].Value == "") {
+			return groups[j].Value == ""
+		}
+		return groups[i].Value < groups[j].Value
+	})
+	return groups
+}
+
+// NodeTags returns the node's tags (nil = untagged)
+func (m *Manager) NodeTags() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return maps.Clone(m.tags)
+}
+
+// watchNodeTags applies the node's tags as they change
+func (m *Manager) watchNodeTags() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := OpenNodeTagsBucket(ctx, m.natsNode.ControlJetStream())
+	if err != nil {
+		return err
+	}
+
+	entries := NewTypedKV[NodeTags](kv)
+	entries.SetLogger(componentLogger(m.opts.Logger, "fleet"))
+	w, err := entries.Watch(context.Background(), m.natsNode.Name(), func(key string, entry *NodeTags, deleted bool) {
+		var tags map[string]string
+		if entry != nil {
+			tags = entry.Tags
+		}
+		m.setNodeTags(tags)
+	})
+	if err != nil {
+		return fmt.Errorf("watching node tags: %w", err)
+	}
+
+	m.mu.Lock()
+	m.tagsWatch = w
+	m.mu.Unlock()
+	return nil
+}
+
+// setNodeTags records the tags and puts them in the registration
+func (m *Manager) setNodeTags(tags map[string]string) {
+	m.mu.Lock()
+	if maps.Equal(m.tags, tags) {
+		m.mu.Unlock()
+		return
+	}
+	m.tags = tags
+	registrar := m.registrar
+	m.mu.Unlock()
+
+	m.logger.Info("node tags changed", "tags", TagSelector(tags).String())
+	if registrar != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := registrar.SetTags(ctx, tags); err != nil {
+			m.logger.Warn("tagging registration failed", "error", err)
+		}
+	}
+}
+
+// FleetCommand is a command sent to every node matching Selector
+type FleetCommand struct {
+	Selector TagSelector `json:"selector,omitempty"`
+	Action   string      `json:"action"`           // e.g. restart
+	Target   string      `json:"target,omitempty"` // e.g. a process name
+}
+
+// FleetReply is one node's answer to a FleetCommand
+type FleetReply struct {
+	Node    string `json:"node"`
+	Service string `json:"service,omitempty"`
+	Error   string `json:"error,omitempty"` // Empty on success
+}
+
+// FleetHandler runs a command on this node
+type FleetHandler func(ctx context.Context, cmd FleetCommand) error
+
+// HandleFleetCommands runs fn for the fleet commands matching this node's
+// tags and replies with the outcome. Call the returned function to stop.
+func (m *Manager) HandleFleetCommands(fn FleetHandler) (stop func(), err error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("fleet commands need NATS")
+	}
+	sub, err := m.natsNode.ControlConn().Subscribe(FleetSubject, func(msg *nats.Msg) {
+		var cmd FleetCommand
+		if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+			m.logger.Warn("malformed fleet command", "error", err)
+			return
+		}
+		if !cmd.Selector.Matches(m.NodeTags()) {
+			return
+		}
+
+		reply := FleetReply{Node: m.natsNode.Name()}
+		if reg := m.Registration(); reg != nil {
+			reply.Service = reg.GitHub.Name()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := fn(ctx, cmd); err != nil {
+			reply.Error = err.Error()
+		}
+		m.logger.Info("fleet command", "action", cmd.Action, "target", cmd.Target, "error", reply.Error)
+
+		if msg.Reply != "" {
+			data, _ := json.Marshal(reply)
+			_ = msg.Respond(data)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to %s: %w", FleetSubject, err)
+	}
+	return func() { sub.Unsubscribe() }, nil
+}
+
+// SendFleetCommand sends cmd to the matching nodes and collects their
+// replies until ctx is done, sorted by node
+func SendFleetCommand(ctx context.Context, nc *nats.Conn, cmd FleetCommand) ([]FleetReply, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling fleet command: %w", err)
+	}
+
+	inbox := nc.NewRespInbox()
+	replies := make(chan *nats.Msg, 256)
+	sub, err := nc.ChanSubscribe(inbox, replies)
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to replies: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := nc.PublishRequest(FleetSubject, inbox, data); err != nil {
+		return nil, fmt.Errorf("sending fleet command: %w", err)
+	}
+
+	var out []FleetReply
+	for {
+		select {
+		case msg := <-replies:
+			var reply FleetReply
+			if err := json.Unmarshal(msg.Data, &reply); err != nil {
+				continue
+			}
+			out = append(out, reply)
+		case <-ctx.Done():
+			sort.Slice(out, func(i, j int) bool {
+				if out[i].Node != out[j].Node {
+					return out[i].Node < out[j].Node
+				}
+				return out[i].Service < out[j].Service
+			})
+			return out, nil
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package env
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestParseTagSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    TagSelector
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: TagSelector{}},
+		{name: "one", in: "site=warehouse-3", want: TagSelector{"site": "warehouse-3"}},
+		{name: "several", in: "site=warehouse-3, hw=rpi4", want: TagSelector{"site": "warehouse-3", "hw": "rpi4"}},
+		{name: "empty value", in: "site=", want: TagSelector{"site": ""}},
+		{name: "no value", in: "site", wantErr: true},
+		{name: "no key", in: "=rpi4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTagSelector(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTagSelector(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTagSelector(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagSelectorMatches(t *testing.T) {
+	tags := map[string]string{"site": "warehouse-3", "hw": "rpi4"}
+	tests := []struct {
+		sel  TagSelector
+		want bool
+	}{
+		{sel: nil, want: true},
+		{sel: TagSelector{"site": "warehouse-3"}, want: true},
+		{sel: TagSelector{"site": "warehouse-3", "hw": "rpi4"}, want: true},
+		{sel: TagSelector{"site": "warehouse-1"}, want: false},
+		{sel: TagSelector{"rack": "a"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.sel.Matches(tags); got != tt.want {
+			t.Errorf("%v.Matches() = %v, want %v", tt.sel, got, tt.want)
+		}
+	}
+}
+
+func TestNodeTags(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+
+	if err := SetNodeTags(ctx, kv, "edge-7", map[string]string{"site": "warehouse-3", "hw": "rpi4"}); err != nil {
+		t.Fatalf("SetNodeTags() error = %v", err)
+	}
+	if err := SetNodeTags(ctx, kv, "edge-2", map[string]string{"site": "warehouse-1"}); err != nil {
+		t.Fatalf("SetNodeTags() error = %v", err)
+	}
+
+	tags, err := GetNodeTags(ctx, kv, "edge-7")
+	if err != nil || tags["hw"] != "rpi4" {
+		t.Errorf("GetNodeTags() = %v, %v; want hw=rpi4", tags, err)
+	}
+	if tags, err := GetNodeTags(ctx, kv, "edge-9"); err != nil || tags != nil {
+		t.Errorf("GetNodeTags(untagged) = %v, %v; want nil, nil", tags, err)
+	}
+
+	nodes, err := ListNodeTags(ctx, kv, TagSelector{"site": "warehouse-3"})
+	if err != nil {
+		t.Fatalf("ListNodeTags() error = %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Node != "edge-7" {
+		t.Errorf("ListNodeTags(site=warehouse-3) = %+v, want edge-7", nodes)
+	}
+
+	if err := SetNodeTags(ctx, kv, "edge-7", nil); err != nil {
+		t.Fatalf("SetNodeTags(nil) error = %v", err)
+	}
+	nodes, err = ListNodeTags(ctx, kv, nil)
+	if err != nil {
+		t.Fatalf("ListNodeTags() error = %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Node != "edge-2" {
+		t.Errorf("ListNodeTags() after untagging = %+v, want edge-2", nodes)
+	}
+}
+
+func TestFilterTagsAndGroupNodes(t *testing.T) {
+	reg := func(id string, tags map[string]string) registry.ServiceRegistration {
+		return registry.ServiceRegistration{Instance: registry.InstanceInfo{ID: id, Tags: tags}}
+	}
+	regs := []registry.ServiceRegistration{
+		reg("a", map[string]string{"site": "warehouse-3"}),
+		reg("b", map[string]string{"site": "warehouse-1"}),
+		reg("c", nil),
+	}
+	got := FilterTags(regs, TagSelector{"site": "warehouse-3"})
+	if len(got) != 1 || got[0].Instance.ID != "a" {
+		t.Errorf("FilterTags() = %+v, want instance a", got)
+	}
+
+	groups := GroupNodes([]FleetNode{
+		{Node: "edge-1"},
+		{Node: "edge-2", Tags: map[string]string{"site": "warehouse-3"}},
+		{Node: "edge-3", Tags: map[string]string{"site": "warehouse-1"}},
+		{Node: "edge-4", Tags: map[string]string{"site": "warehouse-3"}},
+	}, "site")
+	var values []string
+	for _, g := range groups {
+		values = append(values, g.Value)
+	}
+	if want := []string{"warehouse-1", "warehouse-3", ""}; !reflect.DeepEqual(values, want) {
+		t.Errorf("GroupNodes() values = %q, want %q", values, want)
+	}
+	if len(groups[1].Nodes) != 2 {
+		t.Errorf("GroupNodes() warehouse-3 has %d nodes, want 2", len(groups[1].Nodes))
+	}
+}
+
+func TestManagerSetNodeTags(t *testing.T) {
+	type config struct{}
+	ctx := context.Background()
+	kv := newMemKV()
+
+	r := NewRegistrar(kv, 0)
+	if err := r.Register(ctx, "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	m := &Manager{registrar: r, logger: componentLogger(nil, "manager")}
+
+	m.setNodeTags(map[string]string{"site": "warehouse-3"})
+	if got := r.Registration().Instance.Tags["site"]; got != "warehouse-3" {
+		t.Errorf("registration site tag = %q, want warehouse-3", got)
+	}
+	if got := m.NodeTags(); got["site"] != "warehouse-3" {
+		t.Errorf("NodeTags() = %v, want site=warehouse-3", got)
+	}
+
+	m.setNodeTags(nil)
+	if got := r.Registration().Instance.Tags; got != nil {
+		t.Errorf("registration tags after untagging = %v, want nil", got)
+	}
+}
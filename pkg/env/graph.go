@@ -0,0 +1,250 @@
+// graph.go: Service dependency graph from registrations
+//
+// Every `conf:"service:org/repo"` field is an edge from the registering
+// service to the one it names. BuildDependencyGraph merges all instances
+// into one graph per org/repo and finds dependency cycles:
+//
+//	regs, _ := mgr.GetAllServices(ctx)
+//	g := env.BuildDependencyGraph(regs)
+//	g.WriteMermaid(os.Stdout)
+//	if len(g.Cycles) > 0 { ... }
+package env
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// DependencyEdge is one service depending on another
+type DependencyEdge struct {
+	From    string `json:"from"`              // Dependent service (org/repo)
+	To      string `json:"to"`                // Dependency (org/repo)
+	EnvKey  string `json:"env_key"`           // Field declaring the dependency
+	Missing bool   `json:"missing,omitempty"` // Dependency is not registered
+}
+
+// DependencyGraph is the service mesh as declared by service: tags
+type DependencyGraph struct {
+	Services []string         `json:"services"`         // Registered services, sorted
+	Edges    []DependencyEdge `json:"edges"`            // Sorted by From, To
+	Cycles   [][]string       `json:"cycles,omitempty"` // Services depending on each other
+}
+
+// BuildDependencyGraph builds the graph from registrations (any number of
+// instances per service)
+func BuildDependencyGraph(regs []registry.ServiceRegistration) *DependencyGraph {
+	registered := make(map[string]bool)
+	for _, reg := range regs {
+		if name := reg.GitHub.Name(); name != "" {
+			registered[name] = true
+		}
+	}
+
+	type edgeKey struct{ from, to string }
+	edges := make(map[edgeKey]DependencyEdge)
+	for _, reg := range regs {
+		from := reg.GitHub.Name()
+		if from == "" {
+			continue
+		}
+		for _, f := range reg.Fields {
+			if f.Dependency == "" {
+				continue
+			}
+			key := edgeKey{from, f.Dependency}
+			if _, seen := edges[key]; seen {
+				continue
+			}
+			edges[key] = DependencyEdge{From: from, To: f.Dependency, EnvKey: f.EnvKey, Missing: !registered[f.Dependency]}
+		}
+	}
+
+	g := &DependencyGraph{}
+	for name := range registered {
+		g.Services = append(g.Services, name)
+	}
+	sort.Strings(g.Services)
+	for _, e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	g.Cycles = findCycles(g.Edges)
+	return g
+}
+
+// findCycles returns the strongly connected components that form cycles
+// (two or more services, or a service depending on itself), using Tarjan's
+// algorithm. Each cycle is sorted; cycles are sorted by first service.
+func findCycles(edges []DependencyEdge) [][]string {
+	adj := make(map[string][]string)
+	var nodes []string
+	seen := make(map[string]bool)
+	selfLoop := make(map[string]bool)
+	for _, e := range edges {
+		adj[e.From] = append(adj[e.From], e.To)
+		if e.From == e.To {
+			selfLoop[e.From] = true
+		}
+		for _, n := range []string{e.From, e.To} {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.Strings(nodes)
+
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	next := 0
+
+	var connect func(v string)
+	connect = func(v string) {
+		index[v] = next
+		low[v] = next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range adj[v] {
+			if _, visited := index[w]; !visited {
+				connect(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+
+		if low[v] != index[v] {
+			return
+		}
+		var scc []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		if len(scc) > 1 || selfLoop[v] {
+			sort.Strings(scc)
+			cycles = append(cycles, scc)
+		}
+	}
+
+	for _, n := range nodes {
+		if _, visited := index[n]; !visited {
+			connect(n)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// inCycle reports whether the edge lies inside one of the graph's cycles
+func (g *DependencyGraph) inCycle(e DependencyEdge) bool {
+	for _, c := range g.Cycles {
+		from, to := false, false
+		for _, s := range c {
+			from = from || s == e.From
+			to = to || s == e.To
+		}
+		if from && to {
+			return true
+		}
+	}
+	return false
+}
+
+// nodes returns registered services plus unregistered dependencies
+func (g *DependencyGraph) nodes() []string {
+	seen := make(map[string]bool)
+	var nodes []string
+	add := func(n string) {
+		if !seen[n] {
+			seen[n] = true
+			nodes = append(nodes, n)
+		}
+	}
+	for _, s := range g.Services {
+		add(s)
+	}
+	for _, e := range g.Edges {
+		add(e.To)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// WriteDOT writes the graph in Graphviz DOT. Unregistered dependencies are
+// dashed, edges inside cycles red.
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph services {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	registered := make(map[string]bool, len(g.Services))
+	for _, s := range g.Services {
+		registered[s] = true
+	}
+	for _, n := range g.nodes() {
+		if registered[n] {
+			fmt.Fprintf(&b, "\t%q;\n", n)
+		} else {
+			fmt.Fprintf(&b, "\t%q [style=dashed];\n", n)
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := fmt.Sprintf("label=%q", e.EnvKey)
+		if g.inCycle(e) {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [%s];\n", e.From, e.To, attrs)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart (renders inline in
+// GitHub markdown). Unregistered dependencies are dashed, cycles red.
+func (g *DependencyGraph) WriteMermaid(w io.Writer) error {
+	ids := make(map[string]string)
+	for i, n := range g.nodes() {
+		ids[n] = fmt.Sprintf("s%d", i)
+	}
+	registered := make(map[string]bool, len(g.Services))
+	for _, s := range g.Services {
+		registered[s] = true
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.nodes() {
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[n], n)
+		if !registered[n] {
+			fmt.Fprintf(&b, "    style %s stroke-dasharray: 5 5\n", ids[n])
+		}
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "    %s -->|%s| %s\n", ids[e.From], e.EnvKey, ids[e.To])
+		if g.inCycle(e) {
+			fmt.Fprintf(&b, "    linkStyle %d stroke:red\n", i)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,102 @@
+package env
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// svc builds a registration for org/repo depending on deps
+func svc(name string, deps ...string) registry.ServiceRegistration {
+	org, repo, _ := strings.Cut(name, "/")
+	reg := registry.ServiceRegistration{GitHub: registry.GitHubInfo{Org: org, Repo: repo}}
+	for _, dep := range deps {
+		key := "APP_" + strings.ToUpper(strings.ReplaceAll(dep, "/", "_"))
+		reg.Fields = append(reg.Fields, registry.FieldInfo{EnvKey: key, Dependency: dep})
+	}
+	return reg
+}
+
+func TestBuildDependencyGraph(t *testing.T) {
+	tests := []struct {
+		name   string
+		regs   []registry.ServiceRegistration
+		edges  []string // from->to, * = missing
+		cycles [][]string
+	}{
+		{
+			name:  "chain",
+			regs:  []registry.ServiceRegistration{svc("o/web", "o/api"), svc("o/api", "o/db"), svc("o/db")},
+			edges: []string{"o/api->o/db", "o/web->o/api"},
+		},
+		{
+			name:  "instances merged",
+			regs:  []registry.ServiceRegistration{svc("o/web", "o/api"), svc("o/web", "o/api"), svc("o/api")},
+			edges: []string{"o/web->o/api"},
+		},
+		{
+			name:  "missing dependency",
+			regs:  []registry.ServiceRegistration{svc("o/web", "o/auth")},
+			edges: []string{"o/web->o/auth*"},
+		},
+		{
+			name:   "cycle",
+			regs:   []registry.ServiceRegistration{svc("o/a", "o/b"), svc("o/b", "o/c"), svc("o/c", "o/a"), svc("o/d", "o/a")},
+			edges:  []string{"o/a->o/b", "o/b->o/c", "o/c->o/a", "o/d->o/a"},
+			cycles: [][]string{{"o/a", "o/b", "o/c"}},
+		},
+		{
+			name:   "self dependency",
+			regs:   []registry.ServiceRegistration{svc("o/a", "o/a")},
+			edges:  []string{"o/a->o/a"},
+			cycles: [][]string{{"o/a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := BuildDependencyGraph(tt.regs)
+
+			var edges []string
+			for _, e := range g.Edges {
+				s := e.From + "->" + e.To
+				if e.Missing {
+					s += "*"
+				}
+				edges = append(edges, s)
+			}
+			if !reflect.DeepEqual(edges, tt.edges) {
+				t.Errorf("edges = %q, want %q", edges, tt.edges)
+			}
+			if !reflect.DeepEqual(g.Cycles, tt.cycles) {
+				t.Errorf("cycles = %q, want %q", g.Cycles, tt.cycles)
+			}
+		})
+	}
+}
+
+func TestDependencyGraphWriters(t *testing.T) {
+	g := BuildDependencyGraph([]registry.ServiceRegistration{svc("o/a", "o/b"), svc("o/b", "o/a"), svc("o/c", "o/x")})
+
+	var dot strings.Builder
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"o/a" -> "o/b" [label="APP_O_B", color=red];`, `"o/x" [style=dashed];`, `"o/c" -> "o/x" [label="APP_O_X"];`} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("DOT missing %s:\n%s", want, dot.String())
+		}
+	}
+
+	var mermaid strings.Builder
+	if err := g.WriteMermaid(&mermaid); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"flowchart LR", `s0["o/a"]`, "s0 -->|APP_O_B| s1", "linkStyle 0 stroke:red", "style s3 stroke-dasharray"} {
+		if !strings.Contains(mermaid.String(), want) {
+			t.Errorf("Mermaid missing %s:\n%s", want, mermaid.String())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// guard.go: In-flight protection for GUI actions
+//
+// Double clicks and impatient repeated clicks on slow actions (Start,
+// Restart, Refresh) would otherwise send duplicate control calls. An
+// ActionGuard runs at most one call per key at a time and drops repeats
+// that arrive within a short cooldown after the call finished:
+//
+//	guard := env.NewActionGuard(env.DefaultActionCooldown)
+//
+//	restart := c.Action(func() {
+//	    guard.Do("api", func() { client.Restart("api") })
+//	    c.Sync()
+//	})
+//
+//	attrs := env.BusyAttrs(guard.Busy("api"))
+//	h.Button(append(attrs, restart.OnClick(), h.Text("Restart"))...)
+//
+// Share one guard across contexts (create it outside v.Page) so two open
+// tabs can't race each other either.
+package env
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-via/via/h"
+)
+
+// DefaultActionCooldown drops repeats arriving right after a call finished
+const DefaultActionCooldown = 500 * time.Millisecond
+
+// ActionGuard serialises actions per key and drops duplicates
+type ActionGuard struct {
+	mu       sync.Mutex
+	busy     map[string]bool
+	done     map[string]time.Time // Key -> when its last call finished
+	cooldown time.Duration
+	now      func() time.Time
+}
+
+// NewActionGuard creates a guard; cooldown <= 0 only drops calls while one
+// is in flight
+func NewActionGuard(cooldown time.Duration) *ActionGuard {
+	return &ActionGuard{
+		busy:     make(map[string]bool),
+		done:     make(map[string]time.Time),
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+// Do runs fn unless a call for key is in flight or just finished. Returns
+// false if fn was dropped.
+func (g *ActionGuard) Do(key string, fn func()) bool {
+	g.mu.Lock()
+	if g.busy[key] || g.now().Sub(g.done[key]) < g.cooldown {
+		g.mu.Unlock()
+		return false
+	}
+	g.busy[key] = true
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.busy, key)
+		g.done[key] = g.now()
+		g.mu.Unlock()
+	}()
+
+	fn()
+	return true
+}
+
+// Busy reports whether a call for key is in flight
+func (g *ActionGuard) Busy(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.busy[key]
+}
+
+// BusyAttrs returns the attributes that disable a control and mark it busy
+// (Pico shows a spinner) while its action is in flight
+func BusyAttrs(busy bool) []h.H {
+	if !busy {
+		return nil
+	}
+	return []h.H{h.Attr("disabled"), h.Attr("aria-busy", "true")}
+}
@@ -0,0 +1,55 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActionGuardDropsWhileBusy(t *testing.T) {
+	g := NewActionGuard(0)
+
+	calls := 0
+	ran := g.Do("api", func() {
+		calls++
+		if !g.Busy("api") {
+			t.Error("Busy() = false during call")
+		}
+		if g.Do("api", func() { calls++ }) {
+			t.Error("nested Do() for same key ran")
+		}
+		if !g.Do("db", func() { calls++ }) {
+			t.Error("Do() for other key was dropped")
+		}
+	})
+
+	if !ran || calls != 2 {
+		t.Errorf("Do() = %v with %d calls, want true with 2", ran, calls)
+	}
+	if g.Busy("api") {
+		t.Error("Busy() = true after call finished")
+	}
+}
+
+func TestActionGuardCooldown(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := NewActionGuard(time.Second)
+	g.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    bool
+	}{
+		{"first call", 0, true},
+		{"repeat within cooldown", 500 * time.Millisecond, false},
+		{"after cooldown", time.Second, true},
+		{"immediate repeat", 0, false},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		if got := g.Do("api", func() {}); got != tt.want {
+			t.Errorf("%s: Do() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
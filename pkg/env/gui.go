@@ -3,6 +3,17 @@
 // Provides reusable Via pages that services can register:
 // - RegisterDashboardPage: Main dashboard with config, NATS, and dependencies
 // - RegisterConfigPage: Detailed configuration view
+// - RegisterUsagePage: Per-subject traffic accounting (needs WithUsageTracking)
+// - RegisterChangelogPage: Registration schema changes over time
+// - RegisterAuthPage: Current auth mode and the auth lifecycle self-test
+// - RegisterServerPage: Embedded NATS server stats, leafnodes and clients
+// - RegisterFleetPage: Nodes grouped by tag, with their services
+// - RegisterMicroPage: Request stats of NATS micro endpoints mesh-wide
+// - RegisterCommandPalette: "/" quick-switcher across pages (palette.go)
+// - RegisterFocusRetention: keep keyboard focus across re-renders (a11y.go)
+//
+// Tables on these pages use Table (table.go) for sorting, filtering and
+// column selection.
 //
 // Services create their own Via instance and register the pages they need:
 //
@@ -14,10 +25,13 @@
 package env
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-via/via"
@@ -29,6 +43,8 @@ import (
 type DashboardOptions struct {
 	// NavBar returns the navigation bar H element
 	NavBar func(title string) h.H
+	// Compact always renders tables as cards (default: cards on narrow viewports only)
+	Compact bool
 }
 
 // RegisterDashboardPage registers the main dashboard page (/) with Via
@@ -36,6 +52,12 @@ func RegisterDashboardPage(v *via.V, mgr *Manager, cfg interface{}, opts Dashboa
 	fields := ExtractFields(mgr.Prefix(), cfg)
 
 	v.Page("/", func(c *via.Context) {
+		table := NewTable(c,
+			Column{Key: "field", Title: "Field"},
+			Column{Key: "env", Title: "Env Var"},
+			Column{Key: "value", Title: "Value"},
+		).SetCompact(opts.Compact)
+
 		c.View(func() h.H {
 			var navEl h.H
 			if opts.NavBar != nil {
@@ -45,9 +67,10 @@ func RegisterDashboardPage(v *via.V, mgr *Manager, cfg interface{}, opts Dashboa
 			return h.Main(h.Class("container"),
 				navEl,
 				renderStatus(mgr),
-				renderConfig(fields),
+				renderConfig(fields, table),
 				renderDependencies(mgr, fields),
 				renderNATS(mgr),
+				renderStartup(mgr),
 			)
 		})
 	})
@@ -58,6 +81,17 @@ func RegisterConfigPage(v *via.V, mgr *Manager, cfg interface{}, opts DashboardO
 	fields := ExtractFields(mgr.Prefix(), cfg)
 
 	v.Page("/config", func(c *via.Context) {
+		table := NewTable(c,
+			Column{Key: "field", Title: "Field"},
+			Column{Key: "type", Title: "Type"},
+			Column{Key: "env", Title: "Env Var"},
+			Column{Key: "default", Title: "Default"},
+			Column{Key: "required", Title: "Required"},
+			Column{Key: "secret", Title: "Secret"},
+			Column{Key: "dependency", Title: "Dependency"},
+			Column{Key: "value", Title: "Current Value"},
+		).SetCompact(opts.Compact)
+
 		c.View(func() h.H {
 			var navEl h.H
 			if opts.NavBar != nil {
@@ -67,12 +101,513 @@ func RegisterConfigPage(v *via.V, mgr *Manager, cfg interface{}, opts DashboardO
 			return h.Main(h.Class("container"),
 				navEl,
 				h.H2(h.Text("Configuration")),
-				renderConfigDetail(fields),
+				renderConfigDetail(fields, table),
+			)
+		})
+	})
+}
+
+// RegisterUsagePage registers the traffic accounting page (/usage) with Via.
+// The Manager must be created with WithUsageTracking.
+func RegisterUsagePage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	v.Page("/usage", func(c *via.Context) {
+		refresh := c.Action(func() {
+			c.Sync()
+		})
+		table := NewTable(c,
+			Column{Key: "prefix", Title: "Subject Prefix"},
+			Column{Key: "service", Title: "Service"},
+			Column{Key: "messages", Title: "Messages", Numeric: true},
+			Column{Key: "bytes", Title: "Bytes", Numeric: true},
+			Column{Key: "share", Title: "Share", Numeric: true},
+		).SetCompact(opts.Compact)
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Usage")
+			}
+
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("Traffic Usage")),
+					h.P(h.Text("Messages and bytes per subject prefix")),
+					h.Button(h.ID("usage-refresh"), h.Text("Refresh"), refresh.OnClick()),
+				),
+				renderUsage(mgr, table),
+				renderUsageHistory(mgr),
+			)
+		})
+	})
+}
+
+// RegisterChangelogPage registers the registration changelog page (/changelog)
+// with Via. It opens on this service, or on the service in
+// /changelog/{org}/{repo}, and lists other registered services.
+func RegisterChangelogPage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	page := func(c *via.Context) {
+		selected := ""
+		if org, repo := c.GetPathParam("org"), c.GetPathParam("repo"); org != "" && repo != "" {
+			selected = org + "/" + repo
+		} else if reg := mgr.Registration(); reg != nil {
+			selected = reg.GitHub.Name()
+		}
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Changelog")
+			}
+
+			// One button per registered service
+			names := make(map[string]bool)
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			regs, err := mgr.GetAllServices(ctx)
+			cancel()
+			if err == nil {
+				for _, reg := range regs {
+					if name := reg.GitHub.Name(); name != "" {
+						names[name] = true
+					}
+				}
+			}
+			sorted := make([]string, 0, len(names))
+			for name := range names {
+				sorted = append(sorted, name)
+			}
+			sort.Strings(sorted)
+
+			buttons := []h.H{h.Role("group")}
+			for _, name := range sorted {
+				class, pressed := "outline", "false"
+				if name == selected {
+					class, pressed = "", "true"
+				}
+				buttons = append(buttons, h.Button(h.ID("changelog-"+name), h.Text(name), h.Class(class),
+					h.Attr("aria-pressed", pressed),
+					c.Action(func() {
+						selected = name
+						c.Sync()
+					}).OnClick(),
+				))
+			}
+
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("Registration Changelog")),
+					h.P(h.Text("Config schema changes per service, newest first")),
+					h.Div(buttons...),
+				),
+				renderChangelog(mgr, selected),
+			)
+		})
+	}
+
+	v.Page("/changelog", page)
+	v.Page("/changelog/{org}/{repo}", page)
+}
+
+// authSelfTestGuard keeps concurrent tabs from starting overlapping self-tests
+var authSelfTestGuard = NewActionGuard(DefaultActionCooldown)
+
+// RegisterAuthPage registers the auth page (/auth) with Via. It shows the
+// node's auth mode and runs RunAuthSelfTest on demand.
+func RegisterAuthPage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	v.Page("/auth", func(c *via.Context) {
+		var results []AuthCheckResult
+		var runErr error
+		ran := false
+
+		run := c.Action(func() {
+			authSelfTestGuard.Do("selftest", func() {
+				c.Sync() // Show the busy button while the servers spin up
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+				results, runErr = RunAuthSelfTest(ctx)
+				cancel()
+				ran = true
+			})
+			c.Sync()
+		})
+		table := NewTable(c,
+			Column{Key: "mode", Title: "Mode"},
+			Column{Key: "check", Title: "Check"},
+			Column{Key: "result", Title: "Result"},
+			Column{Key: "duration", Title: "Duration", Numeric: true},
+		).SetCompact(opts.Compact)
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Auth")
+			}
+
+			attrs := BusyAttrs(authSelfTestGuard.Busy("selftest"))
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("Authentication")),
+					h.P(h.Strong(h.Text("Mode: ")), h.Code(h.Text(mgr.opts.AuthMode))),
+					h.P(h.Text("The self-test starts a throwaway server per auth mode and checks that valid credentials connect, invalid ones are rejected and JetStream works.")),
+					h.Button(append(attrs, h.ID("auth-selftest"), h.Text("Run self-test"), run.OnClick())...),
+				),
+				renderAuthSelfTest(ran, results, runErr, table),
+			)
+		})
+	})
+}
+
+// RegisterServerPage registers the NATS server page (/server) with Via.
+// It renders Manager.ServerStats (monitor.go).
+func RegisterServerPage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	v.Page("/server", func(c *via.Context) {
+		refresh := c.Action(func() {
+			c.Sync()
+		})
+		leafTable := NewTable(c,
+			Column{Key: "leaf", Title: "Leafnode"},
+			Column{Key: "account", Title: "Account"},
+			Column{Key: "addr", Title: "Address"},
+			Column{Key: "rtt", Title: "RTT"},
+			Column{Key: "in", Title: "In Msgs", Numeric: true},
+			Column{Key: "out", Title: "Out Msgs", Numeric: true},
+			Column{Key: "subs", Title: "Subs", Numeric: true},
+		).SetCompact(opts.Compact)
+		clientTable := NewTable(c,
+			Column{Key: "cid", Title: "CID", Numeric: true},
+			Column{Key: "client", Title: "Name"},
+			Column{Key: "account", Title: "Account"},
+			Column{Key: "addr", Title: "Address"},
+			Column{Key: "pending", Title: "Pending", Numeric: true},
+			Column{Key: "in", Title: "In Msgs", Numeric: true},
+			Column{Key: "out", Title: "Out Msgs", Numeric: true},
+			Column{Key: "subs", Title: "Subs", Numeric: true},
+		).SetCompact(opts.Compact)
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Server")
+			}
+
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("NATS Server")),
+					h.P(h.Text("Embedded server stats (varz, leafz, connz, jsz)")),
+					h.Button(h.ID("server-refresh"), h.Text("Refresh"), refresh.OnClick()),
+				),
+				renderServerStats(mgr, leafTable, clientTable),
 			)
 		})
 	})
 }
 
+// DefaultMicroPageInterval is how often the micro page collects stats
+const DefaultMicroPageInterval = 10 * time.Second
+
+// RegisterMicroPage registers the micro services page (/micro) with Via.
+// It collects $SRV.STATS mesh-wide every DefaultMicroPageInterval
+// (microstats.go) and lists request counts and latencies per endpoint,
+// with the registered services declaring each micro service.
+func RegisterMicroPage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	v.Page("/micro", func(c *via.Context) {
+		var (
+			mu        sync.Mutex
+			stats     []registry.EndpointStats
+			providers map[string][]string
+			lastErr   string
+		)
+		collect := func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			got, err := mgr.MicroStats(ctx)
+			regs, _ := mgr.GetAllServices(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			stats, providers, lastErr = got, microProviders(regs), ""
+			if err != nil {
+				lastErr = err.Error()
+			}
+		}
+		collect()
+
+		refresh := c.Action(func() {
+			collect()
+			c.Sync()
+		})
+		c.OnInterval(DefaultMicroPageInterval, func() {
+			collect()
+			c.Sync()
+		}).Start()
+
+		table := NewTable(c,
+			Column{Key: "service", Title: "Micro Service"},
+			Column{Key: "endpoint", Title: "Endpoint"},
+			Column{Key: "subject", Title: "Subject"},
+			Column{Key: "provided", Title: "Provided By"},
+			Column{Key: "instances", Title: "Instances", Numeric: true},
+			Column{Key: "requests", Title: "Requests", Numeric: true},
+			Column{Key: "errors", Title: "Errors", Numeric: true},
+			Column{Key: "avg", Title: "Avg Time", Numeric: true},
+			Column{Key: "last_error", Title: "Last Error"},
+		).SetCompact(opts.Compact)
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Micro")
+			}
+
+			mu.Lock()
+			shown, byMicro, errText := stats, providers, lastErr
+			mu.Unlock()
+
+			var errorEl h.H
+			if errText != "" {
+				errorEl = h.P(h.Text("Error: " + errText))
+			}
+
+			var body h.H = h.P(h.Text("No micro services answered."))
+			if len(shown) > 0 {
+				rows := make([]TableRow, 0, len(shown))
+				for _, e := range shown {
+					provided := strings.Join(byMicro[e.Service], ", ")
+					rows = append(rows, TableRow{
+						TextCell(e.Service),
+						TextCell(e.Endpoint),
+						NodeCell(e.Subject, h.Code(h.Text(e.Subject))),
+						TextCell(cmp.Or(provided, "-")),
+						NumCell(float64(e.Instances), nil),
+						NumCell(float64(e.Requests), nil),
+						NumCell(float64(e.Errors), nil),
+						NumCell(float64(e.AverageTime), h.Text(e.AverageTime.Round(time.Microsecond).String())),
+						TextCell(e.LastError),
+					})
+				}
+				body = table.Render(rows)
+			}
+
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("Micro Services")),
+					h.P(h.Text("Requests and latency per endpoint, from $SRV.STATS across the mesh")),
+					h.Button(h.ID("micro-refresh"), h.Text("Refresh"), refresh.OnClick()),
+				),
+				AlertRegion(errorEl),
+				body,
+			)
+		})
+	})
+}
+
+// RegisterFleetPage registers the fleet page (/fleet) with Via. It lists
+// the nodes grouped by one of their tags (fleet.go).
+func RegisterFleetPage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	v.Page("/fleet", func(c *via.Context) {
+		groupBy := ""
+		table := NewTable(c,
+			Column{Key: "group", Title: "Group"},
+			Column{Key: "node", Title: "Node"},
+			Column{Key: "tags", Title: "Tags"},
+			Column{Key: "services", Title: "Services"},
+			Column{Key: "status", Title: "Status"},
+		).SetCompact(opts.Compact)
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Fleet")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			nodes, err := mgr.FleetNodes(ctx)
+			cancel()
+			if err != nil {
+				return h.Main(h.Class("container"), navEl, h.P(h.Text("Error: "+err.Error())))
+			}
+
+			// One button per tag key
+			keys := make(map[string]bool)
+			for _, n := range nodes {
+				for k := range n.Tags {
+					keys[k] = true
+				}
+			}
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				sorted = append(sorted, k)
+			}
+			sort.Strings(sorted)
+			if !keys[groupBy] && len(sorted) > 0 {
+				groupBy = sorted[0]
+			}
+
+			buttons := []h.H{h.Role("group")}
+			for _, key := range sorted {
+				class, pressed := "outline", "false"
+				if key == groupBy {
+					class, pressed = "", "true"
+				}
+				buttons = append(buttons, h.Button(h.ID("fleet-"+key), h.Text(key), h.Class(class),
+					h.Attr("aria-pressed", pressed),
+					c.Action(func() {
+						groupBy = key
+						c.Sync()
+					}).OnClick(),
+				))
+			}
+
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("Fleet")),
+					h.P(h.Text("Nodes grouped by tag")),
+					h.Div(buttons...),
+				),
+				renderFleet(GroupNodes(nodes, groupBy), groupBy, table),
+			)
+		})
+	})
+}
+
+// RegisterEnrollmentPage registers the enrollment page (/enrollment) with
+// Via. Operators approve or reject the nodes waiting to join (enroll.go).
+func RegisterEnrollmentPage(v *via.V, mgr *Manager, opts DashboardOptions) {
+	v.Page("/enrollment", func(c *via.Context) {
+		var decideErr error
+		table := NewTable(c,
+			Column{Key: "node", Title: "Node"},
+			Column{Key: "key", Title: "Key"},
+			Column{Key: "host", Title: "Host"},
+			Column{Key: "service", Title: "Service"},
+			Column{Key: "attestation", Title: "Attestation"},
+			Column{Key: "requested", Title: "Requested"},
+			Column{Key: "state", Title: "State"},
+			Column{Key: "actions", Title: ""},
+		).SetCompact(opts.Compact)
+
+		c.View(func() h.H {
+			var navEl h.H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Enrollment")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			list, err := mgr.Enrollments(ctx)
+			cancel()
+			if err != nil {
+				return h.Main(h.Class("container"), navEl, h.P(h.Text("Error: "+err.Error())))
+			}
+
+			decide := func(node string, approve bool) h.H {
+				return c.Action(func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if approve {
+						decideErr = mgr.ApproveEnrollment(ctx, node, "gui")
+					} else {
+						decideErr = mgr.RejectEnrollment(ctx, node, "gui")
+					}
+					c.Sync()
+				}).OnClick()
+			}
+
+			var errEl h.H
+			if decideErr != nil {
+				errEl = h.P(h.Mark(h.Text("Error: " + decideErr.Error())))
+			}
+			return h.Main(h.Class("container"),
+				navEl,
+				h.Section(
+					h.H2(h.Text("Enrollment")),
+					h.P(h.Text("New nodes register once they are approved")),
+					errEl,
+				),
+				renderEnrollments(list, decide, table),
+			)
+		})
+	})
+}
+
+// renderEnrollments renders the enrollments with approve and reject
+// buttons for the nodes that can still change state
+func renderEnrollments(list []Enrollment, decide func(node string, approve bool) h.H, table *Table) h.H {
+	if len(list) == 0 {
+		return h.P(h.Text("No enrollment requests."))
+	}
+
+	var rows []TableRow
+	for _, e := range list {
+		state := TextCell(e.State)
+		if e.State == EnrollPending {
+			state = NodeCell("Pending", h.Mark(h.Text("Pending")))
+		} else if e.DecidedBy != "" {
+			state = TextCell(e.State + " by " + e.DecidedBy)
+		}
+
+		attestation := "none"
+		if e.Attestation != "" {
+			attestation = e.Attestation + " " + TagSelector(e.Claims).String()
+		}
+
+		var buttons []h.H
+		if e.State != EnrollApproved {
+			buttons = append(buttons, h.Button(h.ID("approve-"+e.Node), h.Text("Approve"), decide(e.Node, true)))
+		}
+		if e.State != EnrollRejected {
+			buttons = append(buttons, h.Button(h.ID("reject-"+e.Node), h.Text("Reject"), h.Class("outline"), decide(e.Node, false)))
+		}
+
+		rows = append(rows, TableRow{
+			NodeCell(e.Node, h.Code(h.Text(e.Node))),
+			NodeCell(e.PublicKey, h.Code(h.Text(e.PublicKey))),
+			TextCell(e.Host),
+			TextCell(e.Service),
+			TextCell(attestation),
+			TextCell(e.Requested.Format(time.RFC3339)),
+			state,
+			NodeCell("", h.Div(append([]h.H{h.Role("group")}, buttons...)...)),
+		})
+	}
+	return table.Render(rows)
+}
+
+// renderAuthSelfTest renders the self-test results
+func renderAuthSelfTest(ran bool, results []AuthCheckResult, err error, table *Table) h.H {
+	if !ran {
+		return nil
+	}
+
+	summary := h.P(h.Strong(h.Text("All checks passed.")))
+	if err != nil {
+		summary = h.P(h.Strong(h.Text("Self-test failed: ")), h.Text(err.Error()))
+	}
+
+	var rows []TableRow
+	for _, r := range results {
+		result := "pass"
+		if !r.Passed() {
+			result = "FAIL: " + r.Error
+		}
+		rows = append(rows, TableRow{
+			TextCell(r.Mode),
+			TextCell(r.Check),
+			TextCell(result),
+			NumCell(float64(r.Duration.Milliseconds()), h.Text(r.Duration.Round(time.Millisecond).String())),
+		})
+	}
+
+	return h.Section(
+		h.H3(h.Text("Self-test results")),
+		summary,
+		table.Render(rows),
+	)
+}
+
 // renderStatus renders the service status section
 func renderStatus(mgr *Manager) h.H {
 	reg := mgr.Registration()
@@ -104,6 +639,41 @@ func renderStatus(mgr *Manager) h.H {
 		)
 	}
 
+	// Runtime stats from the last heartbeat
+	if reg != nil && reg.Runtime != nil {
+		statusItems = append(statusItems,
+			h.Li(h.Strong(h.Text("Runtime: ")), h.Text(reg.Runtime.String())),
+		)
+		if reg.Runtime.LastError != "" {
+			statusItems = append(statusItems,
+				h.Li(h.Strong(h.Text("Last error: ")), h.Text(reg.Runtime.LastError+" ("+reg.Runtime.LastErrorAt.Format(time.RFC3339)+")")),
+			)
+		}
+		if eps := reg.Runtime.Endpoints; len(eps) > 0 {
+			requests, errs := 0, 0
+			for _, e := range eps {
+				requests, errs = requests+e.Requests, errs+e.Errors
+			}
+			statusItems = append(statusItems,
+				h.Li(h.Strong(h.Text("Micro endpoints: ")), h.Textf("%d, %d requests, %d errors", len(eps), requests, errs)),
+			)
+		}
+	}
+
+	// Power profile
+	if reg != nil && reg.Power != nil {
+		statusItems = append(statusItems,
+			h.Li(h.Strong(h.Text("Power: ")), h.Text(fmt.Sprintf("%s (heartbeat every %ds)", reg.Power.Profile, reg.Power.Heartbeat))),
+		)
+	}
+
+	// Maintenance badge
+	if maint := mgr.Maintenance(); maint != nil {
+		statusItems = append(statusItems,
+			h.Li(h.Mark(h.Text("Maintenance")), h.Text(" "+maint.Reason+" (since "+maint.Since.Format(time.RFC3339)+")")),
+		)
+	}
+
 	return h.Section(
 		h.H2(h.Text("Status")),
 		h.Ul(statusItems...),
@@ -111,7 +681,7 @@ func renderStatus(mgr *Manager) h.H {
 }
 
 // renderConfig renders the configuration section
-func renderConfig(fields []registry.FieldInfo) h.H {
+func renderConfig(fields []registry.FieldInfo, table *Table) h.H {
 	if len(fields) == 0 {
 		return h.Section(
 			h.H2(h.Text("Configuration")),
@@ -119,7 +689,7 @@ func renderConfig(fields []registry.FieldInfo) h.H {
 		)
 	}
 
-	var rows []h.H
+	var rows []TableRow
 	for _, f := range fields {
 		if f.Dependency != "" {
 			continue // Skip dependencies, shown separately
@@ -138,35 +708,26 @@ func renderConfig(fields []registry.FieldInfo) h.H {
 			required = " *"
 		}
 
-		rows = append(rows, h.Tr(
-			h.Td(h.Text(f.Path+required)),
-			h.Td(h.Code(h.Text(f.EnvKey))),
-			h.Td(h.Text(value)),
-		))
+		rows = append(rows, TableRow{
+			TextCell(f.Path + required),
+			NodeCell(f.EnvKey, h.Code(h.Text(f.EnvKey))),
+			TextCell(value),
+		})
 	}
 
 	return h.Section(
 		h.H2(h.Text("Configuration")),
-		h.Table(h.Role("grid"),
-			h.THead(
-				h.Tr(
-					h.Th(h.Text("Field")),
-					h.Th(h.Text("Env Var")),
-					h.Th(h.Text("Value")),
-				),
-			),
-			h.TBody(rows...),
-		),
+		table.Render(rows),
 	)
 }
 
 // renderConfigDetail renders the detailed configuration page
-func renderConfigDetail(fields []registry.FieldInfo) h.H {
+func renderConfigDetail(fields []registry.FieldInfo, table *Table) h.H {
 	if len(fields) == 0 {
 		return h.P(h.Text("No configuration fields defined."))
 	}
 
-	var rows []h.H
+	var rows []TableRow
 	for _, f := range fields {
 		value := os.Getenv(f.EnvKey)
 		if value == "" && f.Default != "" {
@@ -191,33 +752,19 @@ func renderConfigDetail(fields []registry.FieldInfo) h.H {
 			depText = f.Dependency
 		}
 
-		rows = append(rows, h.Tr(
-			h.Td(h.Text(f.Path)),
-			h.Td(h.Code(h.Text(f.Type))),
-			h.Td(h.Code(h.Text(f.EnvKey))),
-			h.Td(h.Text(f.Default)),
-			h.Td(h.Text(requiredText)),
-			h.Td(h.Text(secretText)),
-			h.Td(h.Text(depText)),
-			h.Td(h.Text(value)),
-		))
+		rows = append(rows, TableRow{
+			TextCell(f.Path),
+			NodeCell(f.Type, h.Code(h.Text(f.Type))),
+			NodeCell(f.EnvKey, h.Code(h.Text(f.EnvKey))),
+			TextCell(f.Default),
+			TextCell(requiredText),
+			TextCell(secretText),
+			TextCell(depText),
+			TextCell(value),
+		})
 	}
 
-	return h.Table(
-		h.THead(
-			h.Tr(
-				h.Th(h.Text("Field")),
-				h.Th(h.Text("Type")),
-				h.Th(h.Text("Env Var")),
-				h.Th(h.Text("Default")),
-				h.Th(h.Text("Required")),
-				h.Th(h.Text("Secret")),
-				h.Th(h.Text("Dependency")),
-				h.Th(h.Text("Current Value")),
-			),
-		),
-		h.TBody(rows...),
-	)
+	return table.Render(rows)
 }
 
 // renderDependencies renders the service dependencies section
@@ -267,12 +814,20 @@ func renderNATS(mgr *Manager) h.H {
 		h.Li(h.Strong(h.Text("Node Name: ")), h.Text(mgr.natsNode.Name())),
 	}
 
+	if url := mgr.MQTTURL(); url != "" {
+		items = append(items, h.Li(h.Strong(h.Text("MQTT URL: ")), h.Code(h.Text(url))))
+	}
+
 	if mgr.natsNode.IsLeaf() {
 		items = append(items, h.Li(h.Strong(h.Text("Mode: ")), h.Text("Leaf (connected to hub)")))
 	} else {
 		items = append(items, h.Li(h.Strong(h.Text("Mode: ")), h.Text("Standalone")))
 	}
 
+	if mgr.IsReadReplica() {
+		items = append(items, h.Li(h.Strong(h.Text("Reads: ")), h.Text("Local replica")))
+	}
+
 	// Show registered services count
 	if mgr.KV() != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -289,6 +844,161 @@ func renderNATS(mgr *Manager) h.H {
 	)
 }
 
+// renderStartup renders the startup timing breakdown, slowest phase
+// first (nothing before the first Parse is done)
+func renderStartup(mgr *Manager) h.H {
+	report := mgr.StartupReport()
+	if report.Total == 0 {
+		return nil
+	}
+
+	items := []h.H{
+		h.Li(h.Strong(h.Text("Total: ")), h.Text(report.Total.Round(time.Millisecond).String())),
+		h.Li(h.Strong(h.Text("New: ")), h.Text(report.New.Round(time.Millisecond).String())),
+	}
+	for _, p := range report.Slowest() {
+		items = append(items, h.Li(
+			h.Strong(h.Text(p.Name+": ")),
+			h.Text(fmt.Sprintf("%s (%.0f%%)", p.Duration.Round(time.Millisecond), 100*p.Duration.Seconds()/report.Total.Seconds())),
+		))
+	}
+
+	return h.Section(
+		h.H2(h.Text("Startup")),
+		h.Ul(items...),
+	)
+}
+
+// renderUsage renders today's per-prefix counters
+func renderUsage(mgr *Manager, table *Table) h.H {
+	tracker := mgr.Usage()
+	if tracker == nil {
+		return h.P(h.Text("Usage tracking is disabled."))
+	}
+
+	report := tracker.Snapshot()
+	total := report.TotalBytes()
+
+	// Map prefixes to registered services (org.repo -> org/repo)
+	services := make(map[string]string)
+	if mgr.KV() != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		regs, err := GetAllServices(ctx, mgr.KV())
+		cancel()
+		if err == nil {
+			for _, reg := range regs {
+				services[reg.GitHub.Org+"."+reg.GitHub.Repo] = reg.GitHub.Name()
+			}
+		}
+	}
+
+	var rows []TableRow
+	for _, u := range report.Subjects {
+		service := services[u.Prefix]
+		if service == "" {
+			service = "-"
+		}
+		share := 0.0
+		if total > 0 {
+			share = float64(u.Bytes) * 100 / float64(total)
+		}
+		rows = append(rows, TableRow{
+			NodeCell(u.Prefix, h.Code(h.Text(u.Prefix))),
+			TextCell(service),
+			NumCell(float64(u.Messages), nil),
+			NumCell(float64(u.Bytes), nil),
+			NumCell(share, h.Textf("%.1f%%", share)),
+		})
+	}
+
+	return h.Section(
+		h.H3(h.Text("Today ("+report.Day+")")),
+		table.Render(rows),
+	)
+}
+
+// renderUsageHistory renders daily totals from the usage_daily stream
+func renderUsageHistory(mgr *Manager) h.H {
+	tracker := mgr.Usage()
+	if tracker == nil || mgr.JetStream() == nil {
+		return h.Div()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	reports, err := GetUsageHistory(ctx, mgr.JetStream(), tracker.Node(), 7)
+	cancel()
+	if err != nil || len(reports) == 0 {
+		return h.Div()
+	}
+
+	var items []h.H
+	for _, r := range reports {
+		var msgs uint64
+		for _, s := range r.Subjects {
+			msgs += s.Messages
+		}
+		items = append(items, h.Li(
+			h.Strong(h.Text(r.Day+": ")),
+			h.Textf("%d messages, %d bytes", msgs, r.TotalBytes()),
+		))
+	}
+
+	return h.Section(
+		h.H3(h.Text("Last 7 Days")),
+		h.Ul(items...),
+	)
+}
+
+// renderChangelog renders the schema changes of a service, newest first
+func renderChangelog(mgr *Manager, name string) h.H {
+	if name == "" {
+		return h.P(h.Text("Select a service."))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	entries, err := mgr.RegistrationChangelog(ctx, name)
+	cancel()
+	if err != nil {
+		return h.P(h.Text("Error: " + err.Error()))
+	}
+	if len(entries) == 0 {
+		return h.P(h.Text("No history recorded for " + name + "."))
+	}
+
+	var articles []h.H
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+
+		version := e.Tag
+		if version == "" && len(e.Commit) >= 8 {
+			version = e.Commit[:8]
+		}
+		var versionEl h.H
+		if version != "" {
+			versionEl = h.Text(" - " + version)
+		}
+
+		var items []h.H
+		for _, change := range e.Changes {
+			items = append(items, h.Li(h.Code(h.Text(change.String()))))
+		}
+
+		articles = append(articles, h.Article(
+			h.Header(
+				h.Strong(h.Text(e.Time.Format(time.RFC3339))),
+				h.Textf(" rev %d", e.Revision),
+				versionEl,
+			),
+			h.Ul(items...),
+		))
+	}
+
+	return h.Section(
+		h.H3(h.Text(name)),
+		h.Div(articles...),
+	)
+}
+
 // maskSecret masks a secret value for display
 func maskSecret(value string) string {
 	if len(value) <= 8 {
@@ -296,3 +1006,100 @@ func maskSecret(value string) string {
 	}
 	return value[:4] + strings.Repeat("*", len(value)-8) + value[len(value)-4:]
 }
+
+// renderFleet renders the node groups as one table, group by group
+func renderFleet(groups []NodeGroup, key string, table *Table) h.H {
+	if len(groups) == 0 {
+		return h.P(h.Text("No nodes registered or tagged."))
+	}
+
+	var rows []TableRow
+	for _, g := range groups {
+		group := key + "=" + g.Value
+		if key == "" || g.Value == "" {
+			group = "(untagged)"
+		}
+		for _, n := range g.Nodes {
+			status := TextCell("In service")
+			switch {
+			case n.Maintenance != nil:
+				status = NodeCell("Maintenance", h.Mark(h.Text("Maintenance")))
+			case n.Late:
+				status = NodeCell("Heartbeat late", h.Mark(h.Text("Heartbeat late")))
+			case n.Power == PowerLow:
+				status = TextCell("Low power")
+			}
+			rows = append(rows, TableRow{
+				TextCell(group),
+				NodeCell(n.Node, h.Code(h.Text(n.Node))),
+				TextCell(TagSelector(n.Tags).String()),
+				TextCell(strings.Join(n.Services, ", ")),
+				status,
+			})
+		}
+	}
+	return table.Render(rows)
+}
+
+// renderServerStats renders the embedded server snapshot
+func renderServerStats(mgr *Manager, leafTable, clientTable *Table) h.H {
+	stats, err := mgr.ServerStats()
+	if err != nil {
+		return h.P(h.Text(err.Error()))
+	}
+
+	items := []h.H{
+		h.Li(h.Strong(h.Text("Server: ")), h.Text(stats.Name+" (nats-server "+stats.Version+")")),
+		h.Li(h.Strong(h.Text("Uptime: ")), h.Text(stats.Uptime)),
+		h.Li(h.Strong(h.Text("Memory: ")), h.Textf("%.1f MiB, CPU %.1f%%", float64(stats.Mem)/(1<<20), stats.CPU)),
+		h.Li(h.Strong(h.Text("Connections: ")), h.Textf("%d (%d total), %d subscriptions", stats.Connections, stats.TotalConnections, stats.Subscriptions)),
+		h.Li(h.Strong(h.Text("Traffic: ")), h.Textf("%d msgs / %d bytes in, %d msgs / %d bytes out", stats.InMsgs, stats.InBytes, stats.OutMsgs, stats.OutBytes)),
+		h.Li(h.Strong(h.Text("Slow Consumers: ")), h.Textf("%d", stats.SlowConsumers)),
+	}
+	if js := stats.JetStream; js != nil {
+		items = append(items, h.Li(h.Strong(h.Text("JetStream: ")),
+			h.Textf("%d streams, %d consumers, %d msgs, %d bytes (memory %d, file %d)", js.Streams, js.Consumers, js.Messages, js.Bytes, js.Memory, js.Storage)))
+	}
+	if stats.MonitorURL != "" {
+		items = append(items, h.Li(h.Strong(h.Text("Monitoring: ")), h.A(h.Href(stats.MonitorURL+"/varz"), h.Text(stats.MonitorURL))))
+	} else {
+		items = append(items, h.Li(h.Strong(h.Text("Monitoring: ")), h.Text("HTTP port disabled (set NATS_MONITOR_ADDR)")))
+	}
+
+	leafSection := h.P(h.Text("No leafnode links."))
+	if len(stats.Leafnodes) > 0 {
+		var rows []TableRow
+		for _, l := range stats.Leafnodes {
+			rows = append(rows, TableRow{
+				TextCell(l.Name),
+				TextCell(l.Account),
+				NodeCell(l.Addr, h.Code(h.Text(l.Addr))),
+				TextCell(l.RTT),
+				NumCell(float64(l.InMsgs), nil),
+				NumCell(float64(l.OutMsgs), nil),
+				NumCell(float64(l.Subscriptions), nil),
+			})
+		}
+		leafSection = leafTable.Render(rows)
+	}
+
+	var rows []TableRow
+	for _, cl := range stats.Clients {
+		rows = append(rows, TableRow{
+			NumCell(float64(cl.CID), nil),
+			TextCell(cl.Name),
+			TextCell(cl.Account),
+			NodeCell(cl.Addr, h.Code(h.Text(cl.Addr))),
+			NumCell(float64(cl.Pending), nil),
+			NumCell(float64(cl.InMsgs), nil),
+			NumCell(float64(cl.OutMsgs), nil),
+			NumCell(float64(cl.Subscriptions), nil),
+		})
+	}
+
+	return h.Div(
+		h.Section(h.Ul(items...)),
+		h.Section(h.H3(h.Text("Leafnodes")), leafSection),
+		h.Section(h.H3(h.Textf("Clients (busiest %d)", serverStatsClients)), clientTable.Render(rows)),
+	)
+}
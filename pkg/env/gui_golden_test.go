@@ -0,0 +1,70 @@
+package env
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-via/via"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/joeblew999/wellnown-env/pkg/env/viatest/golden"
+)
+
+// goldenConfig covers every column the config renderers have
+type goldenConfig struct {
+	Port     int    `conf:"default:8080"`
+	Name     string `conf:"required"`
+	Password string `conf:"mask"`
+	Orders   string `conf:"service:acme/orders"`
+	DB       struct {
+		Host string `conf:"default:localhost"`
+	}
+}
+
+// goldenManager returns a NATS-less Manager with a fixed registration and
+// the config's env vars pinned
+func goldenManager(t *testing.T) *Manager {
+	t.Helper()
+
+	values := map[string]string{
+		"GOLDEN_PORT":     "9090",
+		"GOLDEN_NAME":     "orders-api",
+		"GOLDEN_PASSWORD": "hunter2-correct-horse",
+	}
+	for _, f := range ExtractFields("GOLDEN", &goldenConfig{}) {
+		t.Setenv(f.EnvKey, values[f.EnvKey])
+	}
+
+	r := NewRegistrar(nil, 0)
+	r.reg = registry.ServiceRegistration{
+		GitHub: registry.GitHubInfo{Org: "acme", Repo: "api", Tag: "v1.2.3", Commit: "c0ffee00c0ffee00"},
+		Instance: registry.InstanceInfo{
+			ID:      "instance-1",
+			Started: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+	return &Manager{prefix: "GOLDEN", registrar: r}
+}
+
+func TestDashboardPageGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		opts DashboardOptions
+	}{
+		{name: "dashboard", opts: DashboardOptions{}},
+		{name: "dashboard_compact", opts: DashboardOptions{Compact: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := via.New()
+			RegisterDashboardPage(v, goldenManager(t), &goldenConfig{}, tt.opts)
+			golden.AssertPage(t, v, "/", tt.name)
+		})
+	}
+}
+
+func TestConfigPageGolden(t *testing.T) {
+	v := via.New()
+	RegisterConfigPage(v, goldenManager(t), &goldenConfig{}, DashboardOptions{})
+	golden.AssertPage(t, v, "/config", "config")
+}
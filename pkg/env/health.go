@@ -0,0 +1,230 @@
+// health.go: Named health checks with liveness/readiness reporting
+//
+// Services register checks on the Manager's HealthRegistry. The registrar
+// runs them before every heartbeat and stores the aggregated result in the
+// registration, so consumers can skip unhealthy instances:
+//
+//	mgr.Health().AddReadiness("db", func(ctx context.Context) error {
+//	    return db.PingContext(ctx)
+//	})
+//
+//	regs, _ := mgr.GetHealthyService(ctx, "joeblew999/api")
+//
+// The same checks are served over HTTP (WithHealthEndpoints or HEALTH_ADDR):
+//
+//	/healthz - 200 if all liveness checks pass, else 503
+//	/readyz  - 200 if all liveness and readiness checks pass, else 503
+//
+// Leaf registrars (leafnode liveness) don't heartbeat, so their stored
+// health is only updated on registration; the HTTP endpoints are always live.
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// Health check kinds
+const (
+	CheckLiveness  = "liveness"
+	CheckReadiness = "readiness"
+)
+
+// DefaultCheckTimeout bounds each health check run
+const DefaultCheckTimeout = 5 * time.Second
+
+// HealthCheck returns nil if the checked dependency is healthy
+type HealthCheck func(ctx context.Context) error
+
+// namedCheck is a registered check
+type namedCheck struct {
+	name  string
+	kind  string
+	check HealthCheck
+}
+
+// HealthRegistry holds named liveness and readiness checks
+type HealthRegistry struct {
+	mu      sync.RWMutex
+	checks  map[string]namedCheck
+	timeout time.Duration
+}
+
+// NewHealthRegistry creates an empty health registry
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{
+		checks:  make(map[string]namedCheck),
+		timeout: DefaultCheckTimeout,
+	}
+}
+
+// AddLiveness registers a check that fails when the process must be restarted
+func (h *HealthRegistry) AddLiveness(name string, check HealthCheck) {
+	h.add(name, CheckLiveness, check)
+}
+
+// AddReadiness registers a check that fails when the instance can't serve traffic
+func (h *HealthRegistry) AddReadiness(name string, check HealthCheck) {
+	h.add(name, CheckReadiness, check)
+}
+
+// add registers (or replaces) a check
+func (h *HealthRegistry) add(name, kind string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = namedCheck{name: name, kind: kind, check: check}
+}
+
+// Remove unregisters a check
+func (h *HealthRegistry) Remove(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.checks, name)
+}
+
+// Len returns the number of registered checks
+func (h *HealthRegistry) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.checks)
+}
+
+// Check runs all checks concurrently and aggregates the results
+func (h *HealthRegistry) Check(ctx context.Context) registry.HealthInfo {
+	h.mu.RLock()
+	checks := make([]namedCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		checks = append(checks, c)
+	}
+	timeout := h.timeout
+	h.mu.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].name < checks[j].name
+	})
+
+	results := make([]registry.CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c, timeout)
+		}()
+	}
+	wg.Wait()
+
+	info := registry.HealthInfo{Live: true, Ready: true, Checks: results, Checked: time.Now()}
+	for _, res := range results {
+		if res.Error == "" {
+			continue
+		}
+		info.Ready = false
+		if res.Kind == CheckLiveness {
+			info.Live = false
+		}
+	}
+	return info
+}
+
+// runCheck runs one check with a timeout, recovering from panics
+func runCheck(ctx context.Context, c namedCheck, timeout time.Duration) (res registry.CheckResult) {
+	res = registry.CheckResult{Name: c.name, Kind: c.kind}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	defer func() {
+		if p := recover(); p != nil {
+			res.Error = "check panicked"
+		}
+	}()
+
+	if err := c.check(ctx); err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Handler serves /healthz and /readyz
+func (h *HealthRegistry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		info := h.Check(r.Context())
+		writeHealth(w, info, info.Live)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		info := h.Check(r.Context())
+		writeHealth(w, info, info.Ready)
+	})
+	return mux
+}
+
+// writeHealth writes info as JSON with 200 if ok, else 503
+func writeHealth(w http.ResponseWriter, info registry.HealthInfo, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+// Health returns the Manager's health registry
+func (m *Manager) Health() *HealthRegistry {
+	return m.health
+}
+
+// GetHealthyService returns the instances of a service that report ready
+// (or don't report health at all)
+func (m *Manager) GetHealthyService(ctx context.Context, name string) ([]registry.ServiceRegistration, error) {
+	regs, err := m.GetService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return FilterHealthy(regs), nil
+}
+
+// FilterHealthy returns the registrations whose instances are healthy
+func FilterHealthy(regs []registry.ServiceRegistration) []registry.ServiceRegistration {
+	var healthy []registry.ServiceRegistration
+	for _, reg := range regs {
+		if reg.Healthy() {
+			healthy = append(healthy, reg)
+		}
+	}
+	return healthy
+}
+
+// startHealthServer serves /healthz and /readyz on addr in the background
+func (m *Manager) startHealthServer(addr string) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           m.health.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	m.healthSrv = srv
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			componentLogger(m.opts.Logger, "health").Error("health server failed", "addr", addr, "error", err)
+		}
+	}()
+}
+
+// stopHealthServer shuts down the health endpoints
+func (m *Manager) stopHealthServer() {
+	if m.healthSrv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.healthSrv.Shutdown(ctx); err != nil {
+		componentLogger(m.opts.Logger, "health").Warn("health server shutdown failed", "error", err)
+	}
+}
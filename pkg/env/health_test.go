@@ -0,0 +1,64 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthRegistryCheck(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	fail := func(ctx context.Context) error { return errors.New("down") }
+
+	tests := []struct {
+		name      string
+		liveness  HealthCheck
+		readiness HealthCheck
+		wantLive  bool
+		wantReady bool
+	}{
+		{"all pass", ok, ok, true, true},
+		{"readiness fails", ok, fail, true, false},
+		{"liveness fails", fail, ok, false, false},
+		{"panicking check fails", func(ctx context.Context) error { panic("boom") }, ok, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthRegistry()
+			h.AddLiveness("loop", tt.liveness)
+			h.AddReadiness("db", tt.readiness)
+
+			info := h.Check(context.Background())
+			if info.Live != tt.wantLive || info.Ready != tt.wantReady {
+				t.Errorf("Live, Ready = %v, %v, want %v, %v", info.Live, info.Ready, tt.wantLive, tt.wantReady)
+			}
+			if len(info.Checks) != 2 || info.Checks[0].Name != "db" {
+				t.Errorf("Checks = %+v, want db and loop sorted by name", info.Checks)
+			}
+		})
+	}
+}
+
+func TestHealthRegistryHandler(t *testing.T) {
+	h := NewHealthRegistry()
+	h.AddReadiness("db", func(ctx context.Context) error { return errors.New("down") })
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
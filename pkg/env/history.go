@@ -0,0 +1,267 @@
+// history.go: Per-service registration history and field changelog
+//
+// Each time an instance registers, its field schema is appended to the
+// "services_history" KV bucket under {org}.{repo} (history depth 64).
+// Consecutive identical schemas are compacted away, so heartbeats and
+// restarts without config changes don't consume history slots and every
+// stored revision is an actual change.
+//
+// RegistrationChangelog turns that history into a list of field changes:
+//
+//	entries, _ := mgr.RegistrationChangelog(ctx, "joeblew999/api")
+//	for _, e := range entries {
+//	    fmt.Println(e.Time, e.Tag)
+//	    for _, c := range e.Changes {
+//	        fmt.Println("  ", c)   // ~ APP_TIMEOUT (default: 5s -> 10s)
+//	    }
+//	}
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// HistoryBucket holds per-service registration history
+const HistoryBucket = "services_history"
+
+// historyDepth is the number of schema revisions kept per service
+const historyDepth = 64
+
+// Field change kinds
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldChanged = "changed"
+)
+
+// FieldChange describes how one field differs between two registrations
+type FieldChange struct {
+	EnvKey  string   `json:"env_key"`
+	Path    string   `json:"path"`
+	Kind    string   `json:"kind"`              // added, removed, changed
+	Details []string `json:"details,omitempty"` // e.g. "default: 5s -> 10s"
+}
+
+// String formats the change in +/-/~ notation
+func (c FieldChange) String() string {
+	switch c.Kind {
+	case FieldAdded:
+		if len(c.Details) > 0 {
+			return fmt.Sprintf("+ %s (%s)", c.EnvKey, strings.Join(c.Details, ", "))
+		}
+		return "+ " + c.EnvKey
+	case FieldRemoved:
+		return "- " + c.EnvKey
+	default:
+		return fmt.Sprintf("~ %s (%s)", c.EnvKey, strings.Join(c.Details, ", "))
+	}
+}
+
+// ChangelogEntry is one schema revision of a service
+type ChangelogEntry struct {
+	Revision uint64        `json:"revision"`
+	Time     time.Time     `json:"time"`
+	Commit   string        `json:"commit,omitempty"`
+	Tag      string        `json:"tag,omitempty"`
+	Instance string        `json:"instance"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+// CreateHistoryBucket creates (or opens) the services_history KV bucket
+func CreateHistoryBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      HistoryBucket,
+		Description: "Registration history for wellnown-env services",
+		History:     historyDepth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating history bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// RecordRegistration appends reg to the service history unless its fields
+// are unchanged since the latest revision. Returns true if a revision was written.
+func RecordRegistration(ctx context.Context, kv jetstream.KeyValue, reg registry.ServiceRegistration) (bool, error) {
+	if reg.GitHub.Org == "" || reg.GitHub.Repo == "" {
+		return false, nil // No stable identity to key history on
+	}
+	key := reg.GitHub.Org + "." + reg.GitHub.Repo
+
+	latest, err := kv.Get(ctx, key)
+	switch {
+	case err == nil:
+		prev, err := decodeRegistration(latest.Value())
+		if err == nil && len(DiffFields(prev.Fields, reg.Fields)) == 0 {
+			return false, nil
+		}
+	case !errors.Is(err, jetstream.ErrKeyNotFound):
+		return false, fmt.Errorf("reading history: %w", err)
+	}
+
+	data, err := json.Marshal(reg)
+	if err != nil {
+		return false, fmt.Errorf("marshaling registration: %w", err)
+	}
+	if _, err := kv.Put(ctx, key, data); err != nil {
+		return false, fmt.Errorf("recording history: %w", err)
+	}
+	return true, nil
+}
+
+// RegistrationChangelog returns the field changes of a service (org/repo)
+// over time, oldest first. The first entry lists the initial fields as added.
+func RegistrationChangelog(ctx context.Context, kv jetstream.KeyValue, name string) ([]ChangelogEntry, error) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid service name %q, expected org/repo", name)
+	}
+
+	history, err := kv.History(ctx, parts[0]+"."+parts[1])
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading history of %s: %w", name, err)
+	}
+
+	var (
+		entries []ChangelogEntry
+		prev    []registry.FieldInfo
+	)
+	for _, h := range history {
+		if h.Operation() != jetstream.KeyValuePut {
+			prev = nil
+			continue
+		}
+
+		reg, err := decodeRegistration(h.Value())
+		if err != nil {
+			continue
+		}
+
+		changes := DiffFields(prev, reg.Fields)
+		prev = reg.Fields
+		if len(changes) == 0 {
+			continue
+		}
+
+		entries = append(entries, ChangelogEntry{
+			Revision: h.Revision(),
+			Time:     h.Created(),
+			Commit:   reg.GitHub.Commit,
+			Tag:      reg.GitHub.Tag,
+			Instance: reg.Instance.ID,
+			Changes:  changes,
+		})
+	}
+
+	return entries, nil
+}
+
+// DiffFields compares two field sets by env key, sorted by env key
+func DiffFields(old, new []registry.FieldInfo) []FieldChange {
+	oldMap := make(map[string]registry.FieldInfo, len(old))
+	for _, f := range old {
+		oldMap[f.EnvKey] = f
+	}
+	newMap := make(map[string]registry.FieldInfo, len(new))
+	for _, f := range new {
+		newMap[f.EnvKey] = f
+	}
+
+	var changes []FieldChange
+	for key, f := range newMap {
+		prev, exists := oldMap[key]
+		if !exists {
+			var details []string
+			if f.Required {
+				details = append(details, "required")
+			}
+			if f.Default != "" {
+				details = append(details, "default: "+f.Default)
+			}
+			changes = append(changes, FieldChange{EnvKey: key, Path: f.Path, Kind: FieldAdded, Details: details})
+			continue
+		}
+
+		var details []string
+		if prev.Type != f.Type {
+			details = append(details, fmt.Sprintf("type: %s -> %s", prev.Type, f.Type))
+		}
+		if prev.Default != f.Default {
+			details = append(details, fmt.Sprintf("default: %s -> %s", prev.Default, f.Default))
+		}
+		if prev.Required != f.Required {
+			if f.Required {
+				details = append(details, "now required")
+			} else {
+				details = append(details, "no longer required")
+			}
+		}
+		if prev.IsSecret != f.IsSecret {
+			if f.IsSecret {
+				details = append(details, "now secret")
+			} else {
+				details = append(details, "no longer secret")
+			}
+		}
+		if prev.Dependency != f.Dependency {
+			details = append(details, fmt.Sprintf("dependency: %s -> %s", prev.Dependency, f.Dependency))
+		}
+		if len(details) > 0 {
+			changes = append(changes, FieldChange{EnvKey: key, Path: f.Path, Kind: FieldChanged, Details: details})
+		}
+	}
+	for key, f := range oldMap {
+		if _, exists := newMap[key]; !exists {
+			changes = append(changes, FieldChange{EnvKey: key, Path: f.Path, Kind: FieldRemoved})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].EnvKey < changes[j].EnvKey
+	})
+	return changes
+}
+
+// BreakingChanges returns the changes from old to new that break existing
+// deployments: fields that became required without a default (deployments
+// don't set them yet) and, if other services consume this one, removed
+// fields
+func BreakingChanges(old, new []registry.FieldInfo, consumed bool) []FieldChange {
+	oldMap := make(map[string]registry.FieldInfo, len(old))
+	for _, f := range old {
+		oldMap[f.EnvKey] = f
+	}
+	newMap := make(map[string]registry.FieldInfo, len(new))
+	for _, f := range new {
+		newMap[f.EnvKey] = f
+	}
+
+	var breaking []FieldChange
+	for _, c := range DiffFields(old, new) {
+		switch c.Kind {
+		case FieldAdded, FieldChanged:
+			f := newMap[c.EnvKey]
+			wasRequired := c.Kind == FieldChanged && oldMap[c.EnvKey].Required
+			if f.Required && f.Default == "" && !wasRequired {
+				breaking = append(breaking, c)
+			}
+		case FieldRemoved:
+			if consumed {
+				breaking = append(breaking, c)
+			}
+		}
+	}
+	return breaking
+}
@@ -0,0 +1,135 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestDiffFields(t *testing.T) {
+	base := []registry.FieldInfo{
+		{Path: "Server.Port", Type: "int", EnvKey: "APP_SERVER_PORT", Default: "8080"},
+		{Path: "DB.Password", Type: "string", EnvKey: "APP_DB_PASSWORD", Required: true, IsSecret: true},
+	}
+
+	tests := []struct {
+		name string
+		old  []registry.FieldInfo
+		new  []registry.FieldInfo
+		want []string
+	}{
+		{
+			name: "unchanged",
+			old:  base,
+			new:  base,
+			want: nil,
+		},
+		{
+			name: "initial registration",
+			old:  nil,
+			new:  base,
+			want: []string{"+ APP_DB_PASSWORD (required)", "+ APP_SERVER_PORT (default: 8080)"},
+		},
+		{
+			name: "default changed",
+			old:  base,
+			new: []registry.FieldInfo{
+				{Path: "Server.Port", Type: "int", EnvKey: "APP_SERVER_PORT", Default: "9090"},
+				base[1],
+			},
+			want: []string{"~ APP_SERVER_PORT (default: 8080 -> 9090)"},
+		},
+		{
+			name: "field removed and added",
+			old:  base,
+			new: []registry.FieldInfo{
+				base[0],
+				{Path: "DB.Token", Type: "string", EnvKey: "APP_DB_TOKEN"},
+			},
+			want: []string{"- APP_DB_PASSWORD", "+ APP_DB_TOKEN"},
+		},
+		{
+			name: "flags flipped",
+			old:  base,
+			new: []registry.FieldInfo{
+				base[0],
+				{Path: "DB.Password", Type: "string", EnvKey: "APP_DB_PASSWORD"},
+			},
+			want: []string{"~ APP_DB_PASSWORD (no longer required, no longer secret)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range DiffFields(tt.old, tt.new) {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffFields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakingChanges(t *testing.T) {
+	base := []registry.FieldInfo{
+		{Path: "Server.Port", Type: "int", EnvKey: "APP_SERVER_PORT", Default: "8080"},
+		{Path: "DB.Password", Type: "string", EnvKey: "APP_DB_PASSWORD", Required: true, IsSecret: true},
+	}
+
+	tests := []struct {
+		name     string
+		new      []registry.FieldInfo
+		consumed bool
+		want     []string
+	}{
+		{
+			name: "optional field added",
+			new:  append([]registry.FieldInfo{{Path: "Debug", Type: "bool", EnvKey: "APP_DEBUG"}}, base...),
+			want: nil,
+		},
+		{
+			name: "required field added",
+			new:  append([]registry.FieldInfo{{Path: "Token", Type: "string", EnvKey: "APP_TOKEN", Required: true}}, base...),
+			want: []string{"+ APP_TOKEN (required)"},
+		},
+		{
+			name: "required field with default added",
+			new:  append([]registry.FieldInfo{{Path: "Region", Type: "string", EnvKey: "APP_REGION", Required: true, Default: "eu"}}, base...),
+			want: nil,
+		},
+		{
+			name: "field became required",
+			new: []registry.FieldInfo{
+				{Path: "Server.Port", Type: "int", EnvKey: "APP_SERVER_PORT", Required: true},
+				base[1],
+			},
+			want: []string{"~ APP_SERVER_PORT (default: 8080 -> , now required)"},
+		},
+		{
+			name: "field removed without consumers",
+			new:  base[:1],
+			want: nil,
+		},
+		{
+			name:     "field removed with consumers",
+			new:      base[:1],
+			consumed: true,
+			want:     []string{"- APP_DB_PASSWORD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range BreakingChanges(base, tt.new, tt.consumed) {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BreakingChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+// hubplan.go: Machine-readable plan of hub resources
+//
+// A HubPlan lists the accounts, KV buckets, streams and consumers of a hub
+// as JSON, so infrastructure-as-code tools can manage them declaratively:
+//
+//	nats-node plan > hub.json    # What this hub provisions
+//	HUB_PLAN=hub.json nats-node  # Apply a (generated) plan at startup
+//
+// Terraform can render the file with jsonencode, Pulumi from any language.
+// Applying is idempotent: missing resources are created, existing ones
+// updated to match; nothing is deleted. Resources marked "system" are
+// managed by the SDK itself and are listed for reference only. Durations
+// are nanoseconds, as in encoding/json. Accounts need NATS_AUTH=jwt; their
+// public keys are output only.
+//
+//	{
+//	  "version": 1,
+//	  "accounts": [{"name": "ORDERS", "limits": {"connections": 100, "memory_storage": -1, "disk_storage": -1}}],
+//	  "buckets": [{"name": "orders_cache", "ttl": 3600000000000}],
+//	  "streams": [{"name": "ORDERS", "subjects": ["orders.>"]}],
+//	  "consumers": [{"stream": "ORDERS", "durable": "billing"}]
+//	}
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// HubPlanVersion is the plan format written by HubPlan
+const HubPlanVersion = 1
+
+// HubPlan is the declarative state of a hub
+type HubPlan struct {
+	Version   int            `json:"version"`
+	Operator  string         `json:"operator,omitempty"` // jwt mode (default: wellnown)
+	Accounts  []PlanAccount  `json:"accounts,omitempty"`
+	Buckets   []PlanBucket   `json:"buckets,omitempty"`
+	Streams   []PlanStream   `json:"streams,omitempty"`
+	Consumers []ConsumerSpec `json:"consumers,omitempty"`
+}
+
+// PlanAccount is an account under the operator
+type PlanAccount struct {
+	Name      string         `json:"name"`
+	PublicKey string         `json:"public_key,omitempty"` // Output only
+	Limits    *AccountLimits `json:"limits,omitempty"`     // nil = keep the current limits
+}
+
+// AccountLimits caps an account; -1 is unlimited, 0 disables JetStream
+// storage
+type AccountLimits struct {
+	Connections   int64 `json:"connections"`
+	MemoryStorage int64 `json:"memory_storage"`
+	DiskStorage   int64 `json:"disk_storage"`
+	Streams       int64 `json:"streams"`
+	Consumers     int64 `json:"consumers"`
+}
+
+// PlanBucket is a KV bucket
+type PlanBucket struct {
+	Name         string        `json:"name"`
+	Description  string        `json:"description,omitempty"`
+	TTL          time.Duration `json:"ttl,omitempty"`
+	History      uint8         `json:"history,omitempty"`
+	MaxBytes     int64         `json:"max_bytes,omitempty"`
+	MaxValueSize int32         `json:"max_value_size,omitempty"`
+	Memory       bool          `json:"memory,omitempty"`
+	System       bool          `json:"system,omitempty"` // Managed by the SDK
+}
+
+// PlanStream is a stream
+type PlanStream struct {
+	StreamSpec
+	System bool `json:"system,omitempty"` // Managed by the SDK
+}
+
+// LoadHubPlan reads a JSON plan file
+func LoadHubPlan(path string) (*HubPlan, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading hub plan: %w", err)
+	}
+	var plan HubPlan
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return nil, fmt.Errorf("parsing hub plan %s: %w", path, err)
+	}
+	if plan.Version > HubPlanVersion {
+		return nil, fmt.Errorf("hub plan %s is version %d, this SDK reads up to %d", path, plan.Version, HubPlanVersion)
+	}
+	return &plan, nil
+}
+
+// WriteJSON writes the plan as indented JSON, subjects unescaped
+func (p *HubPlan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false) // Keep ">" readable in subjects
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// WithHubPlan applies a JSON hub plan at startup
+func WithHubPlan(path string) Option {
+	return func(o *Options) {
+		o.HubPlan = path
+	}
+}
+
+// systemBuckets returns the buckets the SDK creates with opts
+func systemBuckets(o Options) []PlanBucket {
+	buckets := []PlanBucket{
+		{Name: RegistryBucket, Description: "Service registration for wellnown-env", TTL: RegistryTTL, MaxValueSize: registry.MaxPayloadSize, System: true},
+		{Name: HistoryBucket, Description: "Registration history for wellnown-env services", History: historyDepth, System: true},
+	}
+	if o.Liveness == LivenessLeafnode || o.LeafMonitor {
+		buckets = append(buckets, PlanBucket{Name: StaticRegistryBucket, Description: "Service registration kept alive by leafnode liveness", MaxValueSize: registry.MaxPayloadSize, System: true})
+	}
+	if o.KVOverrides {
+		buckets = append(buckets, PlanBucket{Name: ConfigOverridesBucket, Description: "Per-service config overrides for wellnown-env", System: true})
+	}
+	return buckets
+}
+
+// HubPlan returns the plan of what this Manager provisions: system
+// buckets and streams, the JetStream spec, the applied hub plan, and in
+// jwt mode the operator's accounts. NATS need not be running.
+func (m *Manager) HubPlan() (*HubPlan, error) {
+	plan := &HubPlan{Version: HubPlanVersion, Buckets: systemBuckets(m.opts)}
+	if m.opts.EnableUsage {
+		plan.Streams = append(plan.Streams, PlanStream{
+			StreamSpec: StreamSpec{Name: usageStreamName, Description: "Daily per-subject message accounting for wellnown-env", Subjects: []string{usageSubjectPrefix + ">"}},
+			System:     true,
+		})
+	}
+	if m.opts.Janitor {
+		plan.Streams = append(plan.Streams, PlanStream{
+			StreamSpec: StreamSpec{Name: TombstoneStream, Description: "Tombstones of vanished wellnown-env registrations", Subjects: []string{tombstoneSubjectPrefix + ">"}, MaxAge: tombstoneRetention},
+			System:     true,
+		})
+	}
+
+	if m.opts.HubPlan != "" {
+		applied, err := LoadHubPlan(m.opts.HubPlan)
+		if err != nil {
+			return nil, err
+		}
+		plan.Operator = applied.Operator
+		for _, b := range applied.Buckets {
+			if !b.System {
+				plan.Buckets = append(plan.Buckets, b)
+			}
+		}
+		for _, s := range applied.Streams {
+			if !s.System {
+				plan.Streams = append(plan.Streams, s)
+			}
+		}
+		plan.Consumers = append(plan.Consumers, applied.Consumers...)
+	}
+	if m.opts.JetStreamSpec != "" {
+		spec, err := LoadJetStreamSpec(m.opts.JetStreamSpec)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range spec.Streams {
+			plan.Streams = append(plan.Streams, PlanStream{StreamSpec: s})
+		}
+		plan.Consumers = append(plan.Consumers, spec.Consumers...)
+	}
+
+	if m.authMode() == "jwt" {
+		accounts, err := planAccounts(plan.Operator)
+		if err != nil {
+			return nil, err
+		}
+		plan.Accounts = accounts
+	}
+	return plan, nil
+}
+
+// authMode returns the auth mode of the node, or the configured one when
+// NATS is not running
+func (m *Manager) authMode() string {
+	if m.natsNode != nil && m.natsNode.Auth() != nil {
+		return m.natsNode.Auth().Mode
+	}
+	if cfg, err := LoadAuthConfig(); err == nil {
+		return cfg.Mode
+	}
+	return m.opts.AuthMode
+}
+
+// planAccounts lists the accounts of operator (default: wellnown) in the
+// default store with their limits
+func planAccounts(operator string) ([]PlanAccount, error) {
+	op, err := loadPlanOperator(operator)
+	if err != nil {
+		return nil, err
+	}
+	names, err := op.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]PlanAccount, 0, len(names))
+	for _, name := range names {
+		acct, err := op.Account(name)
+		if err != nil {
+			return nil, err
+		}
+		claims, err := acct.Claims()
+		if err != nil {
+			return nil, err
+		}
+		js := claims.Limits.JetStreamLimits
+		accounts = append(accounts, PlanAccount{
+			Name:      name,
+			PublicKey: acct.PublicKey,
+			Limits: &AccountLimits{
+				Connections:   claims.Limits.Conn,
+				MemoryStorage: js.MemoryStorage,
+				DiskStorage:   js.DiskStorage,
+				Streams:       js.Streams,
+				Consumers:     js.Consumer,
+			},
+		})
+	}
+	return accounts, nil
+}
+
+// loadPlanOperator loads operator (default: wellnown) from the default store
+func loadPlanOperator(operator string) (*auth.Operator, error) {
+	if operator == "" {
+		operator = auth.DefaultOperator
+	}
+	store, err := auth.DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	return auth.LoadOperator(store, operator)
+}
+
+// ApplyHubPlan creates or updates the accounts, buckets, streams and
+// consumers of plan; system resources are skipped
+func (m *Manager) ApplyHubPlan(ctx context.Context, plan *HubPlan) error {
+	if m.natsNode == nil {
+		return fmt.Errorf("NATS is disabled")
+	}
+
+	if len(plan.Accounts) > 0 {
+		if mode := m.authMode(); mode != "jwt" {
+			return fmt.Errorf("hub plan accounts need jwt auth mode (got %s)", mode)
+		}
+		jwts, err := applyPlanAccounts(plan.Operator, plan.Accounts)
+		if err != nil {
+			return err
+		}
+		if err := m.natsNode.StoreAccounts(jwts); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range plan.Buckets {
+		if b.System {
+			continue
+		}
+		cfg := jetstream.KeyValueConfig{
+			Bucket:       b.Name,
+			Description:  b.Description,
+			TTL:          b.TTL,
+			History:      b.History,
+			MaxBytes:     b.MaxBytes,
+			MaxValueSize: b.MaxValueSize,
+		}
+		if b.Memory {
+			cfg.Storage = jetstream.MemoryStorage
+		}
+		if _, err := m.natsNode.JetStream().CreateOrUpdateKeyValue(ctx, cfg); err != nil {
+			return fmt.Errorf("ensuring bucket %s: %w", b.Name, err)
+		}
+	}
+
+	for _, s := range plan.Streams {
+		if s.System {
+			continue
+		}
+		if _, err := m.EnsureStream(ctx, s.StreamSpec); err != nil {
+			return err
+		}
+	}
+	for _, c := range plan.Consumers {
+		if _, err := m.EnsureConsumer(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPlanAccounts creates missing accounts, sets their limits and
+// returns their JWTs by public key
+func applyPlanAccounts(operator string, accounts []PlanAccount) (map[string]string, error) {
+	op, err := loadPlanOperator(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	jwts := make(map[string]string)
+	for _, pa := range accounts {
+		acct, err := op.Account(pa.Name)
+		if errors.Is(err, fs.ErrNotExist) {
+			acct, err = op.AddAccount(pa.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("plan account %s: %w", pa.Name, err)
+		}
+		limits := pa.Limits
+		token, err := acct.Update(func(ac *jwt.AccountClaims) {
+			if limits == nil {
+				return
+			}
+			ac.Limits.Conn = limits.Connections
+			ac.Limits.JetStreamLimits.MemoryStorage = limits.MemoryStorage
+			ac.Limits.JetStreamLimits.DiskStorage = limits.DiskStorage
+			ac.Limits.JetStreamLimits.Streams = limits.Streams
+			ac.Limits.JetStreamLimits.Consumer = limits.Consumers
+		})
+		if err != nil {
+			return nil, fmt.Errorf("plan account %s: %w", pa.Name, err)
+		}
+		jwts[acct.PublicKey] = token
+	}
+	return jwts, nil
+}
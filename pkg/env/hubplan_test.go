@@ -0,0 +1,140 @@
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+)
+
+func TestHubPlanJSON(t *testing.T) {
+	plan := HubPlan{
+		Version: HubPlanVersion,
+		Streams: []PlanStream{{StreamSpec: StreamSpec{Name: "ORDERS", Subjects: []string{"orders.>"}, MaxAge: time.Hour}}},
+		Buckets: []PlanBucket{{Name: RegistryBucket, System: true}},
+	}
+	var buf bytes.Buffer
+	if err := plan.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+
+	// Stream fields are inline and subjects unescaped, as tools write them
+	for _, want := range []string{`"name": "ORDERS"`, `"orders.>"`, `"max_age": 3600000000000`, `"system": true`} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("plan JSON %s does not contain %s", raw, want)
+		}
+	}
+
+	var back HubPlan
+	if err := json.Unmarshal(raw, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Streams[0].Name != "ORDERS" || back.Streams[0].MaxAge != time.Hour {
+		t.Errorf("round trip = %+v", back.Streams[0])
+	}
+}
+
+func TestLoadHubPlan(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"version": 1, "buckets": [{"name": "cache", "ttl": 60000000000}]}`},
+		{name: "unversioned", content: `{"streams": [{"name": "S"}]}`},
+		{name: "newer version", content: `{"version": 99}`, wantErr: true},
+		{name: "invalid json", content: `{"version":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			os.WriteFile(path, []byte(tt.content), 0o600)
+			_, err := LoadHubPlan(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadHubPlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSystemBuckets(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "default", want: []string{RegistryBucket, HistoryBucket}},
+		{name: "leaf monitor", opts: Options{LeafMonitor: true}, want: []string{RegistryBucket, HistoryBucket, StaticRegistryBucket}},
+		{name: "overrides", opts: Options{KVOverrides: true}, want: []string{RegistryBucket, HistoryBucket, ConfigOverridesBucket}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, b := range systemBuckets(tt.opts) {
+				if !b.System {
+					t.Errorf("bucket %s not marked system", b.Name)
+				}
+				got = append(got, b.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("systemBuckets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanAccounts(t *testing.T) {
+	store := auth.Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+	t.Setenv("NATS_NSC_STORE", store.Dir)
+	t.Setenv("NKEYS_PATH", store.KeysDir)
+	if _, err := auth.BootstrapOperator(store, auth.DefaultOperator); err != nil {
+		t.Fatal(err)
+	}
+
+	jwts, err := applyPlanAccounts("", []PlanAccount{
+		{Name: "ORDERS", Limits: &AccountLimits{Connections: 10, MemoryStorage: -1, DiskStorage: 1 << 30, Streams: 5, Consumers: -1}},
+		{Name: "BILLING"},
+	})
+	if err != nil {
+		t.Fatalf("applyPlanAccounts() error = %v", err)
+	}
+	if len(jwts) != 2 {
+		t.Errorf("got %d account JWTs, want 2", len(jwts))
+	}
+
+	accounts, err := planAccounts("")
+	if err != nil {
+		t.Fatalf("planAccounts() error = %v", err)
+	}
+	byName := make(map[string]PlanAccount)
+	for _, a := range accounts {
+		byName[a.Name] = a
+	}
+	if _, ok := byName[auth.SystemAccount]; !ok || len(accounts) != 3 {
+		t.Errorf("planAccounts() = %+v, want SYS, BILLING and ORDERS", accounts)
+	}
+	if l := byName["ORDERS"].Limits; l == nil || l.Connections != 10 || l.DiskStorage != 1<<30 || l.Streams != 5 {
+		t.Errorf("ORDERS limits = %+v, want the planned ones", l)
+	}
+	if l := byName["BILLING"].Limits; l == nil || l.DiskStorage != -1 {
+		t.Errorf("BILLING limits = %+v, want unlimited JetStream defaults", l)
+	}
+
+	// Applying the emitted plan again changes nothing
+	again, err := applyPlanAccounts("", accounts)
+	if err != nil {
+		t.Fatalf("reapplying error = %v", err)
+	}
+	if _, ok := again[byName["ORDERS"].PublicKey]; !ok {
+		t.Error("account key changed on reapply")
+	}
+}
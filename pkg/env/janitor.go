@@ -0,0 +1,420 @@
+// janitor.go: Registry garbage collection and tombstone history
+//
+// Registrations vanish in three ways: the instance deregisters on
+// shutdown, its heartbeat stops and the 30s TTL of "services_registry"
+// expires it, or the hub's leafnode liveness monitor prunes it from
+// "services_static". Only the first is expected.
+//
+// The hub runs a RegistryJanitor that watches both buckets and records a
+// Tombstone for every registration that disappears in the
+// "services_history" stream, with the reason. TTL expiry leaves no delete
+// marker, so the janitor notices it by sweeping keys that missed their
+// heartbeats. It also purges old delete markers from services_static,
+// which has no TTL to age them out.
+//
+//	mgr, _ := env.New("HUB", env.WithRegistryJanitor())
+//
+//	// Which instances died unexpectedly in the last 24h?
+//	dead, _ := env.GetHistory(ctx, js, env.HistoryQuery{
+//	    Since:   time.Now().Add(-24 * time.Hour),
+//	    Reasons: []string{env.TombstoneExpired, env.TombstonePruned},
+//	})
+//
+// Subject pattern: services.history.{org}.{repo}.{instance_id}
+//
+// Every hub of a cluster may run a janitor; tombstones carry a message ID,
+// so the stream keeps one copy.
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// TombstoneStream holds the tombstones of vanished registrations (the
+	// registration changelog is the KV bucket of the same name, stored in
+	// stream KV_services_history)
+	TombstoneStream = "services_history"
+
+	tombstoneSubjectPrefix = "services.history."
+	tombstoneRetention     = 30 * 24 * time.Hour
+	janitorInterval        = 5 * time.Second
+	janitorGCInterval      = time.Hour
+	historyBatch           = 256
+)
+
+// Tombstone reasons
+const (
+	TombstoneDeregistered = "deregistered" // Deleted by the instance (or an operator)
+	TombstoneExpired      = "expired"      // TTL ran out without a heartbeat
+	TombstonePruned       = "pruned"       // Leaf node disconnected (leafnode liveness)
+)
+
+// Tombstone records a registration that left the registry
+type Tombstone struct {
+	Key      string    `json:"key"`
+	Service  string    `json:"service"` // org/repo
+	Instance string    `json:"instance"`
+	Node     string    `json:"node,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Tag      string    `json:"tag,omitempty"`
+	Started  time.Time `json:"started,omitzero"`   // Instance start (zero = unknown)
+	LastSeen time.Time `json:"last_seen,omitzero"` // Last registration write seen (zero = unknown)
+	Reason   string    `json:"reason"`             // deregistered, expired or pruned
+	Time     time.Time `json:"time"`               // When the janitor noticed
+}
+
+// Unexpected reports whether the instance went away without deregistering
+func (t Tombstone) Unexpected() bool {
+	return t.Reason != TombstoneDeregistered
+}
+
+// HistoryQuery selects tombstones for GetHistory
+type HistoryQuery struct {
+	Service string    // org/repo (empty = all services)
+	Since   time.Time // Oldest tombstone (zero = all retained)
+	Reasons []string  // Reasons to include (empty = all)
+}
+
+// WithRegistryJanitor records vanished registrations in the
+// services_history stream (hub only)
+func WithRegistryJanitor() Option {
+	return func(o *Options) {
+		o.Janitor = true
+	}
+}
+
+// CreateTombstoneStream creates (or opens) the services_history stream
+func CreateTombstoneStream(ctx context.Context, js jetstream.JetStream) error {
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        TombstoneStream,
+		Description: "Tombstones of vanished wellnown-env registrations",
+		Subjects:    []string{tombstoneSubjectPrefix + ">"},
+		MaxAge:      tombstoneRetention,
+	})
+	if err != nil {
+		return fmt.Errorf("creating tombstone stream: %w", err)
+	}
+	return nil
+}
+
+// janitorEntry is a live registration as last seen by the janitor
+type janitorEntry struct {
+	reg    registry.ServiceRegistration
+	rev    uint64
+	seen   time.Time
+	static bool
+}
+
+// RegistryJanitor records tombstones for registrations that disappear
+type RegistryJanitor struct {
+	mu       sync.Mutex
+	registry jetstream.KeyValue // services_registry (TTL)
+	static   jetstream.KeyValue // services_static (nil = not watched)
+	live     map[string]janitorEntry
+	pruned   map[string]bool // Keys the liveness monitor is removing
+	record   func(ctx context.Context, t Tombstone, msgID string) error
+	watches  []jetstream.KeyWatcher
+	logger   *slog.Logger
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// StartRegistryJanitor creates the tombstone stream and starts watching
+// the registry buckets. static may be nil; a nil logger uses slog.Default.
+func StartRegistryJanitor(ctx context.Context, js jetstream.JetStream, registryKV, staticKV jetstream.KeyValue, logger *slog.Logger) (*RegistryJanitor, error) {
+	if err := CreateTombstoneStream(ctx, js); err != nil {
+		return nil, err
+	}
+	j := newRegistryJanitor(registryKV, staticKV, func(ctx context.Context, t Tombstone, msgID string) error {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		_, err = js.Publish(ctx, tombstoneSubjectPrefix+t.Key, data, jetstream.WithMsgID(msgID))
+		return err
+	}, logger)
+	if err := j.start(ctx); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// newRegistryJanitor returns a janitor that records tombstones with record
+func newRegistryJanitor(registryKV, staticKV jetstream.KeyValue, record func(ctx context.Context, t Tombstone, msgID string) error, logger *slog.Logger) *RegistryJanitor {
+	return &RegistryJanitor{
+		registry: registryKV,
+		static:   staticKV,
+		live:     make(map[string]janitorEntry),
+		pruned:   make(map[string]bool),
+		record:   record,
+		logger:   componentLogger(logger, "janitor"),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start opens the bucket watches and the sweep loop
+func (j *RegistryJanitor) start(ctx context.Context) error {
+	buckets := []jetstream.KeyValue{j.registry}
+	if j.static != nil {
+		buckets = append(buckets, j.static)
+	}
+	for i, kv := range buckets {
+		w, err := kv.WatchAll(ctx)
+		if err != nil {
+			close(j.stopCh)
+			j.stopWatches()
+			return fmt.Errorf("watching registry: %w", err)
+		}
+		j.watches = append(j.watches, w)
+		j.wg.Add(1)
+		go j.watch(w, i == 1)
+	}
+	go j.run()
+	return nil
+}
+
+// watch applies the updates of one bucket. Delete markers among the
+// initial values are old news and skipped.
+func (j *RegistryJanitor) watch(w jetstream.KeyWatcher, static bool) {
+	defer j.wg.Done()
+	initial := true
+	for {
+		select {
+		case <-j.stopCh:
+			return
+		case entry, ok := <-w.Updates():
+			if !ok {
+				return // Watcher stopped (or its connection closed)
+			}
+			if entry == nil {
+				initial = false // End of initial values
+				continue
+			}
+			if initial && entry.Operation() != jetstream.KeyValuePut {
+				continue
+			}
+			j.observe(entry, static)
+		}
+	}
+}
+
+// observe tracks puts and records a tombstone for deletes
+func (j *RegistryJanitor) observe(entry jetstream.KeyValueEntry, static bool) {
+	key := entry.Key()
+	if entry.Operation() == jetstream.KeyValuePut {
+		reg, err := decodeRegistration(entry.Value())
+		if err != nil {
+			return
+		}
+		j.mu.Lock()
+		j.live[key] = janitorEntry{reg: reg, rev: entry.Revision(), seen: time.Now(), static: static}
+		j.mu.Unlock()
+		return
+	}
+
+	j.mu.Lock()
+	e, ok := j.live[key]
+	delete(j.live, key)
+	reason := TombstoneDeregistered
+	if j.pruned[key] {
+		reason = TombstonePruned
+		delete(j.pruned, key)
+	}
+	j.mu.Unlock()
+
+	if !ok {
+		e = janitorEntry{rev: entry.Revision()}
+	}
+	j.tombstone(key, e, reason)
+}
+
+// tombstone records that key went away
+func (j *RegistryJanitor) tombstone(key string, e janitorEntry, reason string) {
+	t := Tombstone{
+		Key:      key,
+		Instance: e.reg.Instance.ID,
+		Node:     e.reg.Instance.Node,
+		Host:     e.reg.Instance.Host,
+		Tag:      e.reg.GitHub.Tag,
+		Started:  e.reg.Instance.Started,
+		LastSeen: e.seen,
+		Reason:   reason,
+		Time:     time.Now(),
+	}
+	// Keys are {org}.{repo}.{instance_id}
+	if parts := strings.SplitN(key, ".", 3); len(parts) == 3 {
+		t.Service = parts[0] + "/" + parts[1]
+		if t.Instance == "" {
+			t.Instance = parts[2]
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := j.record(ctx, t, fmt.Sprintf("%s.%s.%d", key, reason, e.rev)); err != nil {
+		j.logger.Warn("recording tombstone failed", "key", key, "reason", reason, "error", err)
+		return
+	}
+	if t.Unexpected() {
+		j.logger.Info("registration vanished", "key", key, "reason", reason, "node", t.Node)
+	}
+}
+
+// markPruned tells the janitor the liveness monitor is removing key
+func (j *RegistryJanitor) markPruned(key string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pruned[key] = true
+}
+
+// run sweeps for expired registrations and collects delete markers
+func (j *RegistryJanitor) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	gc := time.NewTicker(janitorGCInterval)
+	defer gc.Stop()
+
+	for {
+		select {
+		case <-j.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := j.sweep(ctx, time.Now()); err != nil {
+				j.logger.Warn("janitor sweep failed", "error", err)
+			}
+			cancel()
+		case <-gc.C:
+			if j.static == nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := j.static.PurgeDeletes(ctx); err != nil {
+				j.logger.Warn("purging static registry delete markers failed", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// sweep records registrations whose TTL ran out by now. The bucket
+// expires them silently, so every key that missed its heartbeats is
+// looked up until it is gone.
+func (j *RegistryJanitor) sweep(ctx context.Context, now time.Time) error {
+	j.mu.Lock()
+	var stale []string
+	for key, e := range j.live {
+		if !e.static && now.Sub(e.seen) > RegistryTTL {
+			stale = append(stale, key)
+		}
+	}
+	j.mu.Unlock()
+	slices.Sort(stale)
+
+	for _, key := range stale {
+		_, err := j.registry.Get(ctx, key)
+		if err == nil {
+			continue // Not expired yet, or the heartbeat is in flight
+		}
+		if !errors.Is(err, jetstream.ErrKeyNotFound) {
+			return fmt.Errorf("looking up %s: %w", key, err)
+		}
+
+		j.mu.Lock()
+		e, ok := j.live[key]
+		if ok && now.Sub(e.seen) > RegistryTTL {
+			delete(j.live, key)
+		} else {
+			ok = false // Refreshed or deleted meanwhile
+		}
+		j.mu.Unlock()
+		if ok {
+			j.tombstone(key, e, TombstoneExpired)
+		}
+	}
+	return nil
+}
+
+// stopWatches stops the bucket watches
+func (j *RegistryJanitor) stopWatches() {
+	for _, w := range j.watches {
+		_ = w.Stop()
+	}
+	j.wg.Wait()
+}
+
+// Stop stops the janitor. It is safe to call more than once.
+func (j *RegistryJanitor) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stopCh)
+		j.stopWatches()
+		<-j.done
+	})
+}
+
+// GetHistory returns the tombstones matching q, oldest first
+func GetHistory(ctx context.Context, js jetstream.JetStream, q HistoryQuery) ([]Tombstone, error) {
+	filter := tombstoneSubjectPrefix + ">"
+	if q.Service != "" {
+		parts := strings.SplitN(q.Service, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid service name %q, expected org/repo", q.Service)
+		}
+		filter = tombstoneSubjectPrefix + parts[0] + "." + parts[1] + ".*"
+	}
+	cfg := jetstream.OrderedConsumerConfig{FilterSubjects: []string{filter}}
+	if !q.Since.IsZero() {
+		since := q.Since
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &since
+	}
+	cons, err := js.OrderedConsumer(ctx, TombstoneStream, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("reading tombstones: %w", err)
+	}
+
+	var out []Tombstone
+	for {
+		batch, err := cons.FetchNoWait(historyBatch)
+		if err != nil {
+			return nil, fmt.Errorf("reading tombstones: %w", err)
+		}
+		n, last := 0, false
+		for msg := range batch.Messages() {
+			n++
+			if md, err := msg.Metadata(); err == nil && md.NumPending == 0 {
+				last = true
+			}
+			var t Tombstone
+			if err := json.Unmarshal(msg.Data(), &t); err != nil {
+				continue
+			}
+			if len(q.Reasons) == 0 || slices.Contains(q.Reasons, t.Reason) {
+				out = append(out, t)
+			}
+		}
+		if err := batch.Error(); err != nil {
+			return nil, fmt.Errorf("reading tombstones: %w", err)
+		}
+		if n == 0 || last {
+			return out, nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package env
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestRegistryJanitor(t *testing.T) {
+	ctx := context.Background()
+	kv, static := newMemKV(), newMemKV()
+
+	var mu sync.Mutex
+	var got []Tombstone
+	ids := map[string]bool{}
+	j := newRegistryJanitor(kv, static, func(ctx context.Context, ts Tombstone, msgID string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if ids[msgID] {
+			t.Errorf("message ID %s used twice", msgID)
+		}
+		ids[msgID] = true
+		got = append(got, ts)
+		return nil
+	}, nil)
+
+	put := func(kv *memKV, key, id string, static bool) {
+		value := []byte(`{"version":2,"github":{"org":"acme","repo":"api"},"instance":{"id":"` + id + `","node":"edge-7"}}`)
+		rev, _ := kv.Put(ctx, key, value)
+		j.observe(memEntry{key: key, value: value, rev: rev, op: jetstream.KeyValuePut}, static)
+	}
+	del := func(kv *memKV, key string, static bool) {
+		_ = kv.Delete(ctx, key)
+		j.observe(memEntry{key: key, rev: kv.revs[key], op: jetstream.KeyValueDelete}, static)
+	}
+
+	// Deregistered
+	put(kv, "acme.api.a", "a", false)
+	del(kv, "acme.api.a", false)
+
+	// Expired: the bucket drops the key without a delete marker
+	put(kv, "acme.api.b", "b", false)
+	put(kv, "acme.api.c", "c", false)
+	delete(kv.values, "acme.api.b")
+	if err := j.sweep(ctx, time.Now()); err != nil {
+		t.Fatalf("sweep() error = %v", err)
+	}
+	if err := j.sweep(ctx, time.Now().Add(RegistryTTL+time.Second)); err != nil {
+		t.Fatalf("sweep() error = %v", err)
+	}
+
+	// Pruned by the liveness monitor
+	put(static, "acme.api.d", "d", true)
+	j.markPruned("acme.api.d")
+	del(static, "acme.api.d", true)
+
+	want := []struct{ instance, reason string }{
+		{"a", TombstoneDeregistered},
+		{"b", TombstoneExpired},
+		{"d", TombstonePruned},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tombstones = %+v, want %d", got, len(want))
+	}
+	for i, w := range want {
+		ts := got[i]
+		if ts.Instance != w.instance || ts.Reason != w.reason || ts.Service != "acme/api" || ts.Node != "edge-7" {
+			t.Errorf("tombstone %d = %s %s %s on %q, want %s %s acme/api on edge-7", i, ts.Instance, ts.Reason, ts.Service, ts.Node, w.instance, w.reason)
+		}
+		if ts.Unexpected() != (w.reason != TombstoneDeregistered) {
+			t.Errorf("tombstone %d Unexpected() = %v for %s", i, ts.Unexpected(), w.reason)
+		}
+	}
+	if _, ok := j.live["acme.api.c"]; !ok {
+		t.Error("live registration acme.api.c was forgotten")
+	}
+}
@@ -0,0 +1,152 @@
+// jsdomain.go: JetStream domains for hub and leaves, leaf-to-hub streams
+//
+// By default hub and leaves share the default JetStream domain. Giving
+// each its own domain keeps a leaf's streams on the leaf, so they take
+// writes while the hub is unreachable:
+//
+//	NATS_JS_DOMAIN=hub ./nats-node                                  # hub
+//	NATS_JS_DOMAIN=edge-7 NATS_HUB_DOMAIN=hub NATS_HUB=nats://hub:4222 ./sensor
+//
+// On such a split-domain leaf, JetStream() is the leaf's own domain, while
+// the control plane (registry and node buckets) stays in the hub domain,
+// so the leaf needs the hub at startup.
+//
+// Data written offline reaches the hub through stream sources, which
+// resume where they stopped when the leaf link comes back:
+//
+//	mgr.EnsureStream(ctx, env.StreamSpec{Name: "READINGS", Subjects: []string{"readings.edge-7.>"}})
+//	mgr.SourceToHub(ctx, "READINGS", env.StreamSpec{Name: "ALL_READINGS"})
+//
+// The hub stream needs no subjects: every leaf adds its stream as one more
+// source. MirrorFromHub goes the other way and keeps a read-only local copy
+// of a hub stream.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// sourceRetries bounds SourceToHub's attempts when leaves update the hub
+// stream at the same time
+const sourceRetries = 3
+
+// WithJetStreamDomain sets the node's JetStream domain (see jsdomain.go)
+func WithJetStreamDomain(domain string) Option {
+	return func(o *Options) {
+		o.JetStreamDomain = domain
+	}
+}
+
+// JetStreamDomain returns the node's JetStream domain (empty = default)
+func (m *Manager) JetStreamDomain() string {
+	if m.natsNode == nil {
+		return ""
+	}
+	return m.natsNode.Domain()
+}
+
+// HubJetStream returns a data-plane JetStream context in the hub's domain
+// (NATS_HUB_DOMAIN; the node's own domain when unset)
+func (m *Manager) HubJetStream() (jetstream.JetStream, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	if m.opts.HubDomain == "" {
+		return m.natsNode.JetStream(), nil
+	}
+	js, err := jetstream.NewWithDomain(m.natsNode.Conn(), m.opts.HubDomain)
+	if err != nil {
+		return nil, fmt.Errorf("opening hub JetStream: %w", err)
+	}
+	return js, nil
+}
+
+// SourceToHub makes the hub stream source the local stream, creating the
+// hub stream from spec if it doesn't exist. Messages stored while the hub
+// is unreachable follow when the link is back. The node must have a
+// JetStream domain.
+func (m *Manager) SourceToHub(ctx context.Context, stream string, hub StreamSpec) error {
+	domain := m.JetStreamDomain()
+	if domain == "" {
+		return fmt.Errorf("sourcing %s to the hub needs a JetStream domain", stream)
+	}
+	js, err := m.HubJetStream()
+	if err != nil {
+		return err
+	}
+	return AddStreamSource(ctx, js, hub, SourceSpec{Name: stream, Domain: domain})
+}
+
+// MirrorFromHub keeps the local stream a read-only mirror of a hub stream
+func (m *Manager) MirrorFromHub(ctx context.Context, stream, hubStream string) (jetstream.Stream, error) {
+	return m.EnsureStream(ctx, StreamSpec{
+		Name:   stream,
+		Mirror: &SourceSpec{Name: hubStream, Domain: m.opts.HubDomain},
+	})
+}
+
+// AddStreamSource adds src to the sources of the stream, creating it from
+// spec (plus src) if it doesn't exist. Adding a source twice is a no-op.
+func AddStreamSource(ctx context.Context, js jetstream.JetStream, spec StreamSpec, src SourceSpec) error {
+	for attempt := 0; ; attempt++ {
+		stream, err := js.Stream(ctx, spec.Name)
+		missing := errors.Is(err, jetstream.ErrStreamNotFound)
+		if err != nil && !missing {
+			return fmt.Errorf("looking up stream %s: %w", spec.Name, err)
+		}
+		if !missing && hasSource(stream.CachedInfo().Config, src) {
+			return nil
+		}
+		// Another leaf may have created or updated the stream meanwhile,
+		// so every write is checked by the next lookup
+		if attempt == sourceRetries {
+			return fmt.Errorf("adding source %s to %s: stream kept changing", src.Name, spec.Name)
+		}
+
+		if missing {
+			create := spec
+			create.Sources = append(append([]SourceSpec(nil), spec.Sources...), src)
+			cfg, err := create.streamConfig()
+			if err != nil {
+				return err
+			}
+			if _, err := js.CreateStream(ctx, cfg); err != nil && !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+				return fmt.Errorf("creating stream %s: %w", spec.Name, err)
+			}
+			continue
+		}
+		cfg := stream.CachedInfo().Config
+		cfg.Sources = append(cfg.Sources, src.streamSource())
+		if _, err := js.UpdateStream(ctx, cfg); err != nil {
+			return fmt.Errorf("adding source %s to %s: %w", src.Name, spec.Name, err)
+		}
+	}
+}
+
+// hasSource reports whether cfg already sources src. Sources read back
+// from the server carry the domain as an external API prefix.
+func hasSource(cfg jetstream.StreamConfig, src SourceSpec) bool {
+	prefix := ""
+	if src.Domain != "" {
+		prefix = "$JS." + src.Domain + ".API"
+	}
+	for _, s := range cfg.Sources {
+		if s == nil || s.Name != src.Name {
+			continue
+		}
+		got := ""
+		if s.External != nil {
+			got = s.External.APIPrefix
+		} else if s.Domain != "" {
+			got = "$JS." + s.Domain + ".API"
+		}
+		if got == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestHasSource(t *testing.T) {
+	cfg := jetstream.StreamConfig{
+		Name: "ALL_READINGS",
+		Sources: []*jetstream.StreamSource{
+			{Name: "READINGS", External: &jetstream.ExternalStream{APIPrefix: "$JS.edge-7.API"}},
+			{Name: "READINGS", Domain: "edge-8"},
+			{Name: "LOCAL"},
+		},
+	}
+	tests := []struct {
+		src  SourceSpec
+		want bool
+	}{
+		{SourceSpec{Name: "READINGS", Domain: "edge-7"}, true}, // Read back from the server
+		{SourceSpec{Name: "READINGS", Domain: "edge-8"}, true}, // Added in this process
+		{SourceSpec{Name: "READINGS", Domain: "edge-9"}, false},
+		{SourceSpec{Name: "READINGS"}, false},
+		{SourceSpec{Name: "LOCAL"}, true},
+		{SourceSpec{Name: "LOCAL", Domain: "edge-7"}, false},
+	}
+	for _, tt := range tests {
+		if got := hasSource(cfg, tt.src); got != tt.want {
+			t.Errorf("hasSource(%s@%s) = %v, want %v", tt.src.Name, tt.src.Domain, got, tt.want)
+		}
+	}
+}
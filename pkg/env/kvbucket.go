@@ -0,0 +1,183 @@
+// kvbucket.go: Application KV buckets with JSON helpers
+//
+// Apps get their own buckets next to services_registry without repeating
+// CreateOrUpdateKeyValue and json.Marshal/Unmarshal at every call site:
+//
+//	settings, _ := mgr.KVBucket(ctx, "via_config", env.KVConfig{History: 5})
+//
+//	_, err := settings.Put(ctx, "theme", Theme{Dark: true})
+//
+//	var theme Theme
+//	_, err = settings.Get(ctx, "theme", &theme)
+//
+//	_, err = settings.Update(ctx, "theme", theme, rev) // Conflict-checked (kvconflict.go)
+//
+//	w, _ := settings.Watch(ctx, "*", func(key string, value json.RawMessage, deleted bool) { ... })
+//	defer w.Stop()
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// KVConfig configures an application KV bucket
+type KVConfig struct {
+	Description string
+	TTL         time.Duration // Entry expiry (0 = never)
+	History     uint8         // Revisions kept per key (0 = 1)
+	Memory      bool          // Memory storage instead of file
+}
+
+// KVBucket wraps a KV bucket with JSON get/put/watch helpers
+type KVBucket struct {
+	kv     jetstream.KeyValue
+	name   string
+	logger *slog.Logger
+	write  WritePolicy
+
+	strategy  ConflictStrategy // Resolves Update conflicts (see kvconflict.go)
+	conflicts *KVBucket        // Conflict log (nil = none)
+}
+
+// KVBucket creates (or updates) a bucket on the data-plane JetStream
+func (m *Manager) KVBucket(ctx context.Context, name string, cfg KVConfig) (*KVBucket, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+
+	kvCfg := jetstream.KeyValueConfig{
+		Bucket:      name,
+		Description: cfg.Description,
+		TTL:         cfg.TTL,
+		History:     cfg.History,
+	}
+	if cfg.Memory {
+		kvCfg.Storage = jetstream.MemoryStorage
+	}
+
+	kv, err := m.natsNode.JetStream().CreateOrUpdateKeyValue(ctx, kvCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating KV bucket %s: %w", name, err)
+	}
+	b := newKVBucket(kv, name, componentLogger(m.opts.Logger, "kv"))
+	b.SetWritePolicy(m.opts.WritePolicy)
+	if m.opts.ConflictStrategy != nil && name != ConflictBucket {
+		log, err := m.ConflictLog(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b.SetConflictStrategy(m.opts.ConflictStrategy)
+		b.SetConflictLog(log)
+	}
+	return b, nil
+}
+
+// NewKVBucket wraps an existing bucket
+func NewKVBucket(kv jetstream.KeyValue, name string) *KVBucket {
+	return newKVBucket(kv, name, componentLogger(nil, "kv"))
+}
+
+// newKVBucket wraps kv with an explicit logger
+func newKVBucket(kv jetstream.KeyValue, name string, logger *slog.Logger) *KVBucket {
+	return &KVBucket{kv: kv, name: name, logger: logger.With("bucket", name)}
+}
+
+// SetWritePolicy sets the timeout and retries of Put, Update and Delete
+func (b *KVBucket) SetWritePolicy(p WritePolicy) {
+	b.write = p
+}
+
+// Name returns the bucket name
+func (b *KVBucket) Name() string {
+	return b.name
+}
+
+// KV returns the underlying bucket
+func (b *KVBucket) KV() jetstream.KeyValue {
+	return b.kv
+}
+
+// Get decodes the JSON value of key into v and returns its revision.
+// Missing keys return an error wrapping jetstream.ErrKeyNotFound.
+func (b *KVBucket) Get(ctx context.Context, key string, v any) (uint64, error) {
+	entry, err := b.kv.Get(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("getting %s/%s: %w", b.name, key, err)
+	}
+	if err := json.Unmarshal(entry.Value(), v); err != nil {
+		return 0, fmt.Errorf("decoding %s/%s: %w", b.name, key, err)
+	}
+	return entry.Revision(), nil
+}
+
+// Put stores v as JSON under key and returns the new revision
+func (b *KVBucket) Put(ctx context.Context, key string, v any) (uint64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s/%s: %w", b.name, key, err)
+	}
+	rev, err := b.put(ctx, key, data)
+	if err != nil {
+		return 0, fmt.Errorf("putting %s/%s: %w", b.name, key, err)
+	}
+	return rev, nil
+}
+
+// put writes data unconditionally
+func (b *KVBucket) put(ctx context.Context, key string, data []byte) (uint64, error) {
+	var rev uint64
+	err := b.write.do(ctx, "put", b.name+"/"+key, func(ctx context.Context) (err error) {
+		rev, err = b.kv.Put(ctx, key, data)
+		return err
+	})
+	return rev, err
+}
+
+// Delete removes key
+func (b *KVBucket) Delete(ctx context.Context, key string) error {
+	err := b.write.do(ctx, "delete", b.name+"/"+key, func(ctx context.Context) error {
+		return b.kv.Delete(ctx, key)
+	})
+	if err != nil {
+		return fmt.Errorf("deleting %s/%s: %w", b.name, key, err)
+	}
+	return nil
+}
+
+// Keys returns all keys (empty, not an error, for an empty bucket)
+func (b *KVBucket) Keys(ctx context.Context) ([]string, error) {
+	keys, err := b.kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", b.name, err)
+	}
+	return keys, nil
+}
+
+// Watch calls fn for the current value and every change of keys matching
+// pattern (e.g. "*", "orders.>") until ctx is canceled; deleted is true
+// for deletes and purges
+func (b *KVBucket) Watch(ctx context.Context, pattern string, fn func(key string, value json.RawMessage, deleted bool)) (Watcher, error) {
+	raw := NewTypedKV[json.RawMessage](b.kv)
+	raw.SetLogger(b.logger)
+	w, err := raw.Watch(ctx, pattern, func(key string, v *json.RawMessage, deleted bool) {
+		if deleted {
+			fn(key, nil, true)
+			return
+		}
+		fn(key, *v, false)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: %w", b.name, err)
+	}
+	return w, nil
+}
@@ -0,0 +1,213 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// memKV is an in-memory stand-in for the KV methods KVBucket, TypedKV and
+// the registrar use. It is safe for concurrent use.
+type memKV struct {
+	jetstream.KeyValue
+	mu       sync.Mutex
+	values   map[string][]byte
+	revs     map[string]uint64 // Last revision per key, including deletes
+	rev      uint64
+	watchers []*memWatcher
+}
+
+func newMemKV() *memKV {
+	return &memKV{values: make(map[string][]byte), revs: make(map[string]uint64)}
+}
+
+func (m *memKV) Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return memEntry{key: key, value: v, rev: m.revs[key]}, nil
+}
+
+func (m *memKV) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.put(key, value), nil
+}
+
+func (m *memKV) Update(ctx context.Context, key string, value []byte, last uint64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.revs[key] != last {
+		return 0, jetstream.ErrKeyExists
+	}
+	return m.put(key, value), nil
+}
+
+// put stores value (m.mu held)
+func (m *memKV) put(key string, value []byte) uint64 {
+	m.rev++
+	m.values[key] = value
+	m.revs[key] = m.rev
+	m.notify(memEntry{key: key, value: value, rev: m.rev, op: jetstream.KeyValuePut})
+	return m.rev
+}
+
+func (m *memKV) Delete(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	m.rev++
+	m.revs[key] = m.rev
+	m.notify(memEntry{key: key, rev: m.rev, op: jetstream.KeyValueDelete})
+	return nil
+}
+
+func (m *memKV) Purge(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	m.rev++
+	m.revs[key] = m.rev
+	m.notify(memEntry{key: key, rev: m.rev, op: jetstream.KeyValuePurge})
+	return nil
+}
+
+func (m *memKV) Keys(ctx context.Context, opts ...jetstream.WatchOpt) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.values) == 0 {
+		return nil, jetstream.ErrNoKeysFound
+	}
+	var keys []string
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (m *memKV) Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := &memWatcher{prefix: strings.TrimSuffix(keys, "*"), updates: make(chan jetstream.KeyValueEntry, 1024)}
+	for k, v := range m.values {
+		w.send(memEntry{key: k, value: v, rev: m.rev, op: jetstream.KeyValuePut})
+	}
+	w.updates <- nil // End of initial values
+	m.watchers = append(m.watchers, w)
+	return w, nil
+}
+
+func (m *memKV) WatchAll(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	return m.Watch(ctx, "", opts...)
+}
+
+// notify sends an entry to the matching open watchers (m.mu held)
+func (m *memKV) notify(e memEntry) {
+	for _, w := range m.watchers {
+		w.send(e)
+	}
+}
+
+// memWatcher is a watcher returned by memKV. Updates are dropped when the
+// buffer is full, which only matters to tests that count them.
+type memWatcher struct {
+	mu      sync.Mutex
+	prefix  string
+	updates chan jetstream.KeyValueEntry
+	stopped bool
+}
+
+func (w *memWatcher) send(e memEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped || !strings.HasPrefix(e.key, w.prefix) {
+		return
+	}
+	select {
+	case w.updates <- e:
+	default:
+	}
+}
+
+func (w *memWatcher) Updates() <-chan jetstream.KeyValueEntry { return w.updates }
+
+func (w *memWatcher) Stop() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.updates)
+	}
+	return nil
+}
+
+// memEntry is a KV entry returned by memKV
+type memEntry struct {
+	key   string
+	value []byte
+	rev   uint64
+	op    jetstream.KeyValueOp
+}
+
+func (e memEntry) Bucket() string                  { return "test" }
+func (e memEntry) Key() string                     { return e.key }
+func (e memEntry) Value() []byte                   { return e.value }
+func (e memEntry) Revision() uint64                { return e.rev }
+func (e memEntry) Created() time.Time              { return time.Time{} }
+func (e memEntry) Delta() uint64                   { return 0 }
+func (e memEntry) Operation() jetstream.KeyValueOp { return e.op }
+
+func TestKVBucketJSON(t *testing.T) {
+	type settings struct {
+		Theme string `json:"theme"`
+		Size  int    `json:"size"`
+	}
+
+	ctx := context.Background()
+	b := NewKVBucket(newMemKV(), "test")
+
+	keys, err := b.Keys(ctx)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("Keys() on empty bucket = %v, %v; want empty, nil", keys, err)
+	}
+
+	rev, err := b.Put(ctx, "ui", settings{Theme: "dark", Size: 12})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	var got settings
+	gotRev, err := b.Get(ctx, "ui", &got)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got != (settings{Theme: "dark", Size: 12}) || gotRev != rev {
+		t.Errorf("Get() = %+v rev %d, want dark/12 rev %d", got, gotRev, rev)
+	}
+
+	if err := b.Delete(ctx, "ui"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := b.Get(ctx, "ui", &got); !errors.Is(err, jetstream.ErrKeyNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestKVBucketGetInvalidJSON(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+	kv.values["bad"] = []byte("not json")
+
+	var v map[string]any
+	if _, err := NewKVBucket(kv, "test").Get(ctx, "bad", &v); err == nil {
+		t.Error("Get() of invalid JSON succeeded, want error")
+	}
+}
@@ -0,0 +1,290 @@
+// kvconflict.go: Conflict resolution for KV writes replayed from offline leaves
+//
+// A leaf that was offline replays its KV writes when the hub comes back.
+// If the hub-side value changed in the meantime, a plain Put silently
+// overwrites it. Writes that carry the revision they were based on go
+// through Update instead, which detects the mismatch and hands it to the
+// bucket's ConflictStrategy:
+//
+//	var theme Theme
+//	rev, _ := settings.Get(ctx, "theme", &theme)
+//	// ... offline edit ...
+//	_, err := settings.Update(ctx, "theme", theme, rev)
+//
+//	settings.SetConflictStrategy(env.LastWriterWins)       // Local value wins
+//	settings.SetConflictStrategy(env.MergeWith(mergeTheme)) // Merge both
+//	settings.SetConflictStrategy(env.QueueForReview)       // Keep remote, queue local
+//
+// Every resolution is logged, counted and recorded in the conflict log
+// (SetConflictLog; the kv_conflicts bucket for buckets from
+// Manager.KVBucket with WithConflictStrategy). QueuedConflicts lists the
+// writes waiting for a human decision. Without a strategy, Update returns
+// the conflict as an error wrapping jetstream.ErrKeyExists.
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ConflictBucket is the KV bucket recording resolved conflicts
+const ConflictBucket = "kv_conflicts"
+
+// maxConflictAttempts bounds how often a conflict is resolved again when
+// the remote value keeps changing
+const maxConflictAttempts = 3
+
+// ErrConflictQueued is returned by Update when the local write was queued
+// for review instead of written
+var ErrConflictQueued = errors.New("write conflicts with a newer value; queued for review")
+
+// ConflictAction is how a conflict was resolved
+type ConflictAction string
+
+// Conflict actions
+const (
+	ConflictOverwrite ConflictAction = "overwrite" // Local value written over the remote one
+	ConflictMerge     ConflictAction = "merge"     // Merged value written
+	ConflictQueue     ConflictAction = "queue"     // Remote value kept, local value queued
+)
+
+// Conflict is a write based on a revision that is no longer current
+type Conflict struct {
+	Bucket         string          `json:"bucket"`
+	Key            string          `json:"key"`
+	BaseRevision   uint64          `json:"base_revision"` // Revision the local write was based on
+	Local          json.RawMessage `json:"local"`
+	Remote         json.RawMessage `json:"remote,omitempty"` // Current value (nil if deleted)
+	RemoteRevision uint64          `json:"remote_revision"`  // 0 if deleted
+}
+
+// Resolution is a strategy's decision
+type Resolution struct {
+	Action ConflictAction
+	Value  json.RawMessage // Value to write (ConflictMerge)
+}
+
+// ConflictStrategy decides how a conflict is resolved
+type ConflictStrategy func(ctx context.Context, c Conflict) (Resolution, error)
+
+// LastWriterWins writes the local value over the remote one
+func LastWriterWins(ctx context.Context, c Conflict) (Resolution, error) {
+	return Resolution{Action: ConflictOverwrite}, nil
+}
+
+// QueueForReview keeps the remote value and records the local one for
+// review (Update returns ErrConflictQueued)
+func QueueForReview(ctx context.Context, c Conflict) (Resolution, error) {
+	return Resolution{Action: ConflictQueue}, nil
+}
+
+// MergeWith writes the value merge returns for the conflict
+func MergeWith(merge func(c Conflict) (json.RawMessage, error)) ConflictStrategy {
+	return func(ctx context.Context, c Conflict) (Resolution, error) {
+		v, err := merge(c)
+		if err != nil {
+			return Resolution{}, err
+		}
+		return Resolution{Action: ConflictMerge, Value: v}, nil
+	}
+}
+
+// ConflictRecord is a resolved conflict as recorded in ConflictBucket
+type ConflictRecord struct {
+	ID string `json:"id"` // Key in ConflictBucket
+	Conflict
+	Action   ConflictAction  `json:"action"`
+	Written  json.RawMessage `json:"written,omitempty"` // Value written (overwrite, merge)
+	Revision uint64          `json:"revision"`          // Resulting revision of the key
+	Time     time.Time       `json:"time"`
+}
+
+// WithConflictStrategy sets the strategy of buckets from Manager.KVBucket
+// (default: none, Update returns conflicts as errors)
+func WithConflictStrategy(s ConflictStrategy) Option {
+	return func(o *Options) {
+		o.ConflictStrategy = s
+	}
+}
+
+// SetConflictStrategy sets how Update resolves conflicts (nil = return
+// them as errors)
+func (b *KVBucket) SetConflictStrategy(s ConflictStrategy) {
+	b.strategy = s
+}
+
+// SetConflictLog records resolved conflicts in log (nil = log them only)
+func (b *KVBucket) SetConflictLog(log *KVBucket) {
+	b.conflicts = log
+}
+
+// Update stores v as JSON under key if the key is still at revision
+// baseRev (0 = the key must not exist) and returns the new revision. A
+// mismatch is resolved by the bucket's ConflictStrategy.
+func (b *KVBucket) Update(ctx context.Context, key string, v any, baseRev uint64) (uint64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s/%s: %w", b.name, key, err)
+	}
+	rev, err := b.update(ctx, key, data, baseRev)
+	if err == nil {
+		return rev, nil
+	}
+	if !errors.Is(err, jetstream.ErrKeyExists) || b.strategy == nil {
+		return 0, fmt.Errorf("updating %s/%s: %w", b.name, key, err)
+	}
+	return b.resolveConflict(ctx, key, data, baseRev)
+}
+
+// update writes data if key is at revision rev (0 = key must not exist)
+func (b *KVBucket) update(ctx context.Context, key string, data []byte, rev uint64) (uint64, error) {
+	var newRev uint64
+	err := b.write.do(ctx, "update", b.name+"/"+key, func(ctx context.Context) (err error) {
+		newRev, err = b.kv.Update(ctx, key, data, rev)
+		return err
+	})
+	return newRev, err
+}
+
+// resolveConflict applies the strategy, trying again if the remote value
+// changes while the conflict is being resolved
+func (b *KVBucket) resolveConflict(ctx context.Context, key string, local []byte, baseRev uint64) (uint64, error) {
+	for range maxConflictAttempts {
+		c, err := b.conflict(ctx, key, local, baseRev)
+		if err != nil {
+			return 0, err
+		}
+		res, err := b.strategy(ctx, c)
+		if err != nil {
+			return 0, fmt.Errorf("resolving conflict on %s/%s: %w", b.name, key, err)
+		}
+
+		var written []byte
+		switch res.Action {
+		case ConflictOverwrite:
+			written = local
+		case ConflictMerge:
+			written = res.Value
+		case ConflictQueue:
+			if err := b.recordConflict(ctx, c, res.Action, nil, c.RemoteRevision); err != nil {
+				return 0, err // The log is the only copy of the local value
+			}
+			return c.RemoteRevision, fmt.Errorf("updating %s/%s: %w", b.name, key, ErrConflictQueued)
+		default:
+			return 0, fmt.Errorf("resolving conflict on %s/%s: unknown action %q", b.name, key, res.Action)
+		}
+
+		var rev uint64
+		if c.RemoteRevision == 0 {
+			rev, err = b.put(ctx, key, written) // Deleted remotely; no revision to match
+		} else {
+			rev, err = b.update(ctx, key, written, c.RemoteRevision)
+		}
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("updating %s/%s: %w", b.name, key, err)
+		}
+		if err := b.recordConflict(ctx, c, res.Action, written, rev); err != nil {
+			b.logger.Warn("recording KV conflict failed", "key", key, "error", err)
+		}
+		return rev, nil
+	}
+	return 0, fmt.Errorf("updating %s/%s: value kept changing while resolving conflict: %w", b.name, key, jetstream.ErrKeyExists)
+}
+
+// conflict reads the current value of key
+func (b *KVBucket) conflict(ctx context.Context, key string, local []byte, baseRev uint64) (Conflict, error) {
+	c := Conflict{Bucket: b.name, Key: key, BaseRevision: baseRev, Local: local}
+	entry, err := b.kv.Get(ctx, key)
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+		return c, nil
+	case err != nil:
+		return c, fmt.Errorf("getting %s/%s: %w", b.name, key, err)
+	}
+	c.Remote = entry.Value()
+	c.RemoteRevision = entry.Revision()
+	return c, nil
+}
+
+// recordConflict logs, counts and (with a conflict log) stores a resolution
+func (b *KVBucket) recordConflict(ctx context.Context, c Conflict, action ConflictAction, written []byte, rev uint64) error {
+	b.logger.Info("KV conflict resolved", "key", c.Key, "action", action,
+		"base_revision", c.BaseRevision, "remote_revision", c.RemoteRevision, "revision", rev)
+	metrics.observeConflict(action)
+
+	if b.conflicts == nil {
+		if action == ConflictQueue {
+			return fmt.Errorf("queueing conflict on %s/%s: no conflict log", b.name, c.Key)
+		}
+		return nil
+	}
+	now := time.Now().UTC()
+	rec := ConflictRecord{
+		ID:       b.name + "." + c.Key + "." + strconv.FormatInt(now.UnixNano(), 10),
+		Conflict: c,
+		Action:   action,
+		Written:  written,
+		Revision: rev,
+		Time:     now,
+	}
+	if _, err := b.conflicts.Put(ctx, rec.ID, rec); err != nil {
+		return fmt.Errorf("recording conflict: %w", err)
+	}
+	return nil
+}
+
+// QueuedConflicts returns the conflicts in log waiting for review, oldest
+// first. Resolve one by writing the chosen value and deleting its ID.
+func QueuedConflicts(ctx context.Context, log *KVBucket) ([]ConflictRecord, error) {
+	keys, err := log.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var queued []ConflictRecord
+	for _, key := range keys {
+		var rec ConflictRecord
+		if _, err := log.Get(ctx, key, &rec); err != nil {
+			if errors.Is(err, jetstream.ErrKeyNotFound) {
+				continue // Reviewed meanwhile
+			}
+			return nil, err
+		}
+		if rec.Action == ConflictQueue {
+			queued = append(queued, rec)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].Time.Before(queued[j].Time) })
+	return queued, nil
+}
+
+// ConflictLog returns the ConflictBucket of the data-plane JetStream,
+// creating it on first use
+func (m *Manager) ConflictLog(ctx context.Context) (*KVBucket, error) {
+	m.mu.RLock()
+	log := m.conflictLog
+	m.mu.RUnlock()
+	if log != nil {
+		return log, nil
+	}
+
+	log, err := m.KVBucket(ctx, ConflictBucket, KVConfig{Description: "Resolved KV write conflicts"})
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conflictLog == nil {
+		m.conflictLog = log
+	}
+	return m.conflictLog, nil
+}
@@ -0,0 +1,166 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestKVBucketUpdateConflicts(t *testing.T) {
+	type counter struct {
+		N int `json:"n"`
+	}
+	sum := MergeWith(func(c Conflict) (json.RawMessage, error) {
+		var local, remote counter
+		if err := json.Unmarshal(c.Local, &local); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(c.Remote, &remote); err != nil {
+			return nil, err
+		}
+		return json.Marshal(counter{N: local.N + remote.N})
+	})
+
+	tests := []struct {
+		name     string
+		strategy ConflictStrategy
+		want     int // Value of the key afterwards
+		wantErr  error
+		action   ConflictAction // Recorded in the log ("" = nothing)
+	}{
+		{name: "no strategy", want: 2, wantErr: jetstream.ErrKeyExists},
+		{name: "last writer wins", strategy: LastWriterWins, want: 5, action: ConflictOverwrite},
+		{name: "merge", strategy: sum, want: 7, action: ConflictMerge},
+		{name: "queue for review", strategy: QueueForReview, want: 2, wantErr: ErrConflictQueued, action: ConflictQueue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := NewKVBucket(newMemKV(), "counters")
+			log := NewKVBucket(newMemKV(), ConflictBucket)
+			b.SetConflictStrategy(tt.strategy)
+			b.SetConflictLog(log)
+
+			base, err := b.Put(ctx, "hits", counter{N: 1})
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if _, err := b.Put(ctx, "hits", counter{N: 2}); err != nil { // Hub-side change
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			_, err = b.Update(ctx, "hits", counter{N: 5}, base) // Replayed offline write
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var got counter
+			if _, err := b.Get(ctx, "hits", &got); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got.N != tt.want {
+				t.Errorf("value after Update() = %d, want %d", got.N, tt.want)
+			}
+
+			keys, _ := log.Keys(ctx)
+			if tt.action == "" {
+				if len(keys) != 0 {
+					t.Errorf("conflict log has %d records, want none", len(keys))
+				}
+				return
+			}
+			if len(keys) != 1 {
+				t.Fatalf("conflict log has %d records, want 1", len(keys))
+			}
+			var rec ConflictRecord
+			if _, err := log.Get(ctx, keys[0], &rec); err != nil {
+				t.Fatalf("Get() record error = %v", err)
+			}
+			if rec.Action != tt.action || rec.Key != "hits" || rec.BaseRevision != base || string(rec.Local) != `{"n":5}` {
+				t.Errorf("record = %+v, want %s of hits based on %d", rec, tt.action, base)
+			}
+		})
+	}
+}
+
+func TestKVBucketUpdateNoConflict(t *testing.T) {
+	ctx := context.Background()
+	b := NewKVBucket(newMemKV(), "test")
+	b.SetConflictStrategy(func(ctx context.Context, c Conflict) (Resolution, error) {
+		t.Errorf("strategy called for %+v", c)
+		return Resolution{}, nil
+	})
+
+	rev, err := b.Update(ctx, "k", "one", 0)
+	if err != nil {
+		t.Fatalf("Update() creating error = %v", err)
+	}
+	if _, err := b.Update(ctx, "k", "two", rev); err != nil {
+		t.Fatalf("Update() at current revision error = %v", err)
+	}
+}
+
+func TestKVBucketUpdateRemoteDeleted(t *testing.T) {
+	ctx := context.Background()
+	b := NewKVBucket(newMemKV(), "test")
+	b.SetConflictStrategy(LastWriterWins)
+
+	base, _ := b.Put(ctx, "k", "one")
+	if err := b.Delete(ctx, "k"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := b.Update(ctx, "k", "two", base); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	var got string
+	if _, err := b.Get(ctx, "k", &got); err != nil || got != "two" {
+		t.Errorf("Get() = %q, %v; want two", got, err)
+	}
+}
+
+func TestQueuedConflicts(t *testing.T) {
+	ctx := context.Background()
+	b := NewKVBucket(newMemKV(), "test")
+	log := NewKVBucket(newMemKV(), ConflictBucket)
+	b.SetConflictLog(log)
+
+	for _, key := range []string{"a", "b"} {
+		base, _ := b.Put(ctx, key, 1)
+		b.Put(ctx, key, 2)
+		b.SetConflictStrategy(QueueForReview)
+		if key == "b" {
+			b.SetConflictStrategy(LastWriterWins)
+		}
+		b.Update(ctx, key, 3, base)
+	}
+
+	queued, err := QueuedConflicts(ctx, log)
+	if err != nil {
+		t.Fatalf("QueuedConflicts() error = %v", err)
+	}
+	if len(queued) != 1 || queued[0].Key != "a" || string(queued[0].Remote) != "2" {
+		t.Fatalf("QueuedConflicts() = %+v, want the write to a", queued)
+	}
+
+	if err := log.Delete(ctx, queued[0].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if queued, _ := QueuedConflicts(ctx, log); len(queued) != 0 {
+		t.Errorf("QueuedConflicts() after review = %+v, want none", queued)
+	}
+}
+
+func TestQueueForReviewNeedsLog(t *testing.T) {
+	ctx := context.Background()
+	b := NewKVBucket(newMemKV(), "test")
+	b.SetConflictStrategy(QueueForReview)
+
+	base, _ := b.Put(ctx, "k", 1)
+	b.Put(ctx, "k", 2)
+	if _, err := b.Update(ctx, "k", 3, base); err == nil || errors.Is(err, ErrConflictQueued) {
+		t.Errorf("Update() without a conflict log error = %v, want a failure to queue", err)
+	}
+}
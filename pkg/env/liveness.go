@@ -0,0 +1,234 @@
+// liveness.go: Leafnode-based liveness as an alternative to KV heartbeats
+//
+// In the default heartbeat mode every instance rewrites its registration
+// every 10s to keep it inside the 30s TTL of "services_registry". For very
+// large fleets that is a lot of KV writes.
+//
+// In leafnode mode an instance writes its registration once, to the
+// "services_static" bucket (no TTL), tagged with its leaf node name. The hub
+// runs a LeafLiveness monitor that watches its own leafnode connections and
+// deletes registrations whose node has been gone longer than a grace period.
+//
+// Discovery through the Manager (GetService, GetAllServices, WatchService)
+// reads both buckets, so callers see one registry either way.
+//
+// Usage:
+//
+//	// Service (leaf)
+//	mgr, _ := env.New("APP", env.WithLeafLiveness())
+//
+//	// Hub
+//	mgr, _ := env.New("HUB", env.WithLeafLivenessMonitor())
+package env
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// StaticRegistryBucket holds registrations kept alive by leafnode liveness
+const StaticRegistryBucket = "services_static"
+
+// Liveness modes
+const (
+	LivenessHeartbeat = "heartbeat" // Instance refreshes its KV entry (default)
+	LivenessLeafnode  = "leafnode"  // Hub derives liveness from leafnode connections
+)
+
+// DefaultLivenessGrace is how long a leaf may be disconnected before its
+// registrations are removed
+const DefaultLivenessGrace = 30 * time.Second
+
+// CreateStaticRegistry creates (or opens) the services_static KV bucket
+func CreateStaticRegistry(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:       StaticRegistryBucket,
+		Description:  "Service registration kept alive by leafnode liveness",
+		MaxValueSize: registry.MaxPayloadSize, // Oversized registrations are refused on write
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating static registry: %w", err)
+	}
+	return kv, nil
+}
+
+// LeafLiveness prunes static registrations whose leaf node disconnected
+type LeafLiveness struct {
+	mu       sync.Mutex
+	srv      *server.Server
+	kv       jetstream.KeyValue
+	grace    time.Duration
+	missing  map[string]time.Time // key -> first time its node was not seen
+	logger   *slog.Logger
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	interval time.Duration
+	onPrune  func(key string) // Called before a registration is pruned (nil = none)
+}
+
+// StartLeafLiveness starts the liveness monitor on a hub node.
+// grace <= 0 uses DefaultLivenessGrace; a nil logger uses slog.Default.
+func StartLeafLiveness(node *NATSNode, kv jetstream.KeyValue, grace time.Duration, logger *slog.Logger) *LeafLiveness {
+	if grace <= 0 {
+		grace = DefaultLivenessGrace
+	}
+
+	l := &LeafLiveness{
+		srv:      node.server,
+		kv:       kv,
+		grace:    grace,
+		missing:  make(map[string]time.Time),
+		logger:   componentLogger(logger, "liveness"),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+		interval: 5 * time.Second,
+	}
+
+	go l.run()
+
+	return l
+}
+
+// run sweeps the static registry on every tick
+func (l *LeafLiveness) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := l.sweep(ctx); err != nil {
+				l.logger.Warn("liveness sweep failed", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// sweep removes registrations whose node has been gone longer than grace
+func (l *LeafLiveness) sweep(ctx context.Context) error {
+	connected, err := l.connectedNodes()
+	if err != nil {
+		return err
+	}
+
+	keys, err := l.kv.Keys(ctx)
+	if err != nil {
+		if err == jetstream.ErrNoKeysFound {
+			return nil
+		}
+		return fmt.Errorf("listing static registry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key] = true
+
+		entry, err := l.kv.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		reg, err := decodeRegistration(entry.Value())
+		if err != nil {
+			continue
+		}
+
+		if connected[reg.Instance.Node] {
+			delete(l.missing, key)
+			continue
+		}
+
+		since, ok := l.missing[key]
+		if !ok {
+			l.missing[key] = now
+			continue
+		}
+		if now.Sub(since) >= l.grace {
+			if l.onPrune != nil {
+				l.onPrune(key)
+			}
+			if err := l.kv.Delete(ctx, key); err != nil {
+				return fmt.Errorf("removing %s: %w", key, err)
+			}
+			l.logger.Info("pruned registration of disconnected node", "key", key, "node", reg.Instance.Node)
+			delete(l.missing, key)
+		}
+	}
+
+	// Forget keys that were deregistered normally
+	for key := range l.missing {
+		if !seen[key] {
+			delete(l.missing, key)
+		}
+	}
+
+	return nil
+}
+
+// connectedNodes returns the server names of this node and its connected leafs
+func (l *LeafLiveness) connectedNodes() (map[string]bool, error) {
+	leafz, err := l.srv.Leafz(&server.LeafzOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading leafz: %w", err)
+	}
+
+	nodes := map[string]bool{l.srv.Name(): true}
+	for _, leaf := range leafz.Leafs {
+		nodes[leaf.Name] = true
+	}
+	return nodes, nil
+}
+
+// Connected reports whether a node is currently reachable from the hub
+func (l *LeafLiveness) Connected(node string) bool {
+	nodes, err := l.connectedNodes()
+	if err != nil {
+		return false
+	}
+	return nodes[node]
+}
+
+// OnPrune sets a function called with each key before the monitor prunes
+// it (the registry janitor uses it to tell pruning from deregistration)
+func (l *LeafLiveness) OnPrune(fn func(key string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onPrune = fn
+}
+
+// Stop stops the monitor. It is safe to call more than once.
+func (l *LeafLiveness) Stop() {
+	l.stopOnce.Do(func() { close(l.stopCh) })
+	<-l.done
+}
+
+// multiWatcher stops several watchers together
+type multiWatcher []Watcher
+
+// Stop stops all watchers, returning the first error
+func (w multiWatcher) Stop() error {
+	var first error
+	for _, watcher := range w {
+		if err := watcher.Stop(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
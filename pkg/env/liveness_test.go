@@ -0,0 +1,150 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// putStatic stores a registration of an instance on node in kv
+func putStatic(t *testing.T, kv jetstream.KeyValue, key, node string) {
+	t.Helper()
+	data, err := json.Marshal(registry.ServiceRegistration{
+		Version:  registry.SchemaVersion,
+		Instance: registry.InstanceInfo{ID: key, Node: node, Liveness: LivenessLeafnode},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Put(context.Background(), key, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hasKey reports whether kv still holds key
+func hasKey(t *testing.T, kv jetstream.KeyValue, key string) bool {
+	t.Helper()
+	_, err := kv.Get(context.Background(), key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return false
+	}
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", key, err)
+	}
+	return true
+}
+
+func TestLeafLiveness(t *testing.T) {
+	port := freeHubPort(t)
+	hub := startTestNode(t, NATSConfig{Name: "hub", Port: port})
+	leaf, err := StartNATSNode(NATSConfig{
+		Name:   "edge-1",
+		Port:   -1,
+		HubURL: fmt.Sprintf("nats://127.0.0.1:%d", port+1000),
+	}, nil)
+	if err != nil {
+		t.Fatalf("StartNATSNode(leaf) error = %v", err)
+	}
+	defer leaf.Close()
+
+	ctx := context.Background()
+	kv, err := CreateStaticRegistry(ctx, hub.JetStream())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const grace = 300 * time.Millisecond
+	l := StartLeafLiveness(hub, kv, grace, nil)
+	defer l.Stop()
+	var pruned []string
+	l.OnPrune(func(key string) { pruned = append(pruned, key) })
+
+	waitFor(t, 5*time.Second, "the leaf to show up in leafz", func() bool { return l.Connected("edge-1") })
+	if !l.Connected("hub") {
+		t.Error("Connected(hub) = false, want the hub itself counted")
+	}
+
+	putStatic(t, kv, "acme.edge.a1", "edge-1")
+	putStatic(t, kv, "acme.hub.h1", "hub")
+	putStatic(t, kv, "acme.gone.g1", "edge-9")
+
+	sweep := func() {
+		t.Helper()
+		if err := l.sweep(ctx); err != nil {
+			t.Fatalf("sweep() error = %v", err)
+		}
+	}
+
+	// A node that is not connected keeps its entries for the grace period
+	sweep()
+	sweep()
+	if !hasKey(t, kv, "acme.gone.g1") {
+		t.Fatal("registration of a missing node removed within the grace period")
+	}
+
+	time.Sleep(grace)
+	sweep()
+	if hasKey(t, kv, "acme.gone.g1") {
+		t.Error("registration of a missing node kept after the grace period")
+	}
+	if !hasKey(t, kv, "acme.edge.a1") || !hasKey(t, kv, "acme.hub.h1") {
+		t.Error("registrations of connected nodes removed")
+	}
+	if len(pruned) != 1 || pruned[0] != "acme.gone.g1" {
+		t.Errorf("OnPrune saw %v, want [acme.gone.g1]", pruned)
+	}
+
+	// The leaf disconnects: same again for its registration
+	leaf.Close()
+	waitFor(t, 5*time.Second, "the leaf to leave leafz", func() bool { return !l.Connected("edge-1") })
+	sweep()
+	if !hasKey(t, kv, "acme.edge.a1") {
+		t.Fatal("registration of a disconnected leaf removed within the grace period")
+	}
+	time.Sleep(grace)
+	sweep()
+	if hasKey(t, kv, "acme.edge.a1") {
+		t.Error("registration of a disconnected leaf kept after the grace period")
+	}
+	if !hasKey(t, kv, "acme.hub.h1") {
+		t.Error("registration of the hub removed")
+	}
+}
+
+func TestLeafLivenessReconnectWithinGrace(t *testing.T) {
+	hub := startTestNode(t, NATSConfig{Name: "hub"})
+	ctx := context.Background()
+	kv, err := CreateStaticRegistry(ctx, hub.JetStream())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const grace = 300 * time.Millisecond
+	l := StartLeafLiveness(hub, kv, grace, nil)
+	defer l.Stop()
+
+	// Missing once, then back (here: re-registered from the hub) before
+	// the grace period ends, forgets the first sighting
+	putStatic(t, kv, "acme.edge.a1", "edge-1")
+	if err := l.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	putStatic(t, kv, "acme.edge.a1", "hub")
+	if err := l.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	putStatic(t, kv, "acme.edge.a1", "edge-1")
+	time.Sleep(grace)
+	if err := l.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !hasKey(t, kv, "acme.edge.a1") {
+		t.Error("registration removed although its node came back within the grace period")
+	}
+}
@@ -0,0 +1,354 @@
+// localstore.go: Local SQLite record of heartbeats, process transitions and alerts
+//
+// Field devices that rarely sync lose their history when the hub can't be
+// reached. A LocalStore keeps it on the node, in an SQLite database, so
+// root-cause analysis works offline:
+//
+//	import _ "modernc.org/sqlite" // or any database/sql SQLite driver
+//
+//	db, _ := sql.Open("sqlite", "/var/lib/app/state.db")
+//	store, _ := env.OpenLocalStore(ctx, db, env.LocalRetention{MaxAge: 30 * 24 * time.Hour})
+//	defer store.Close()
+//	mgr, _ := env.New("APP", env.WithLocalStore(store))
+//
+// The SDK links no driver; the caller picks one and owns the database
+// file. With a store set the registrar records every heartbeat (and its
+// error) and raises an alert when a health check starts failing. Process
+// supervisors report states with ObserveProcess; anything else can call
+// RecordAlert. Query, Transitions and HeartbeatGaps answer the usual
+// "what happened before it went dark" questions.
+package env
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// Local event kinds
+const (
+	LocalHeartbeat = "heartbeat" // Subject: registry key, State: ok or failed
+	LocalProcess   = "process"   // Subject: process name, State: new status
+	LocalAlert     = "alert"     // Subject: source, State: severity
+)
+
+// DefaultLocalRetention keeps a week of events, at most a million rows
+var DefaultLocalRetention = LocalRetention{MaxAge: 7 * 24 * time.Hour, MaxRows: 1_000_000, Interval: time.Hour}
+
+// LocalRetention bounds the size of a LocalStore
+type LocalRetention struct {
+	MaxAge   time.Duration // Events older than this are pruned (0 = default)
+	MaxRows  int           // Oldest events beyond this are pruned (0 = default)
+	Interval time.Duration // How often to prune (0 = default)
+}
+
+// withDefaults fills zero fields from DefaultLocalRetention
+func (r LocalRetention) withDefaults() LocalRetention {
+	if r.MaxAge <= 0 {
+		r.MaxAge = DefaultLocalRetention.MaxAge
+	}
+	if r.MaxRows <= 0 {
+		r.MaxRows = DefaultLocalRetention.MaxRows
+	}
+	if r.Interval <= 0 {
+		r.Interval = DefaultLocalRetention.Interval
+	}
+	return r
+}
+
+// LocalEvent is one recorded event
+type LocalEvent struct {
+	At      time.Time `json:"at"`
+	Kind    string    `json:"kind"`
+	Subject string    `json:"subject"`
+	State   string    `json:"state"`
+	Detail  string    `json:"detail,omitempty"` // Error, previous process status or alert message
+}
+
+// LocalQuery selects events; zero fields match everything
+type LocalQuery struct {
+	Kind    string
+	Subject string
+	Since   time.Time
+	Until   time.Time
+	Limit   int // Newest first when set
+}
+
+// localSchema creates the events table; timestamps are Unix milliseconds
+const localSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	at      INTEGER NOT NULL,
+	kind    TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	state   TEXT NOT NULL,
+	detail  TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS events_kind_at ON events (kind, subject, at);
+CREATE INDEX IF NOT EXISTS events_at ON events (at);
+`
+
+// LocalStore records node events in an SQLite database. It is safe for
+// concurrent use.
+type LocalStore struct {
+	db        *sql.DB
+	retention LocalRetention
+	now       func() time.Time
+
+	mu        sync.Mutex
+	processes map[string]string   // Last observed status per process
+	failing   map[string]struct{} // Health checks failing at the last heartbeat
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+// OpenLocalStore creates the schema in db if needed and starts pruning
+// with retention (zero fields use DefaultLocalRetention)
+func OpenLocalStore(ctx context.Context, db *sql.DB, retention LocalRetention) (*LocalStore, error) {
+	if _, err := db.ExecContext(ctx, localSchema); err != nil {
+		return nil, fmt.Errorf("creating local store schema: %w", err)
+	}
+
+	s := &LocalStore{
+		db:        db,
+		retention: retention.withDefaults(),
+		now:       time.Now,
+		processes: make(map[string]string),
+		failing:   make(map[string]struct{}),
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// WithLocalStore records heartbeats and health alerts in s
+func WithLocalStore(s *LocalStore) Option {
+	return func(o *Options) {
+		o.LocalStore = s
+	}
+}
+
+// run prunes on every interval until Close
+func (s *LocalStore) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			_, _ = s.Prune(ctx)
+			cancel()
+		}
+	}
+}
+
+// Record stores an event; a zero At is set to now
+func (s *LocalStore) Record(ctx context.Context, e LocalEvent) error {
+	if e.At.IsZero() {
+		e.At = s.now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO events (at, kind, subject, state, detail) VALUES (?, ?, ?, ?, ?)`,
+		e.At.UnixMilli(), e.Kind, e.Subject, e.State, e.Detail)
+	if err != nil {
+		return fmt.Errorf("recording %s event: %w", e.Kind, err)
+	}
+	return nil
+}
+
+// RecordHeartbeat stores the outcome of a heartbeat of key
+func (s *LocalStore) RecordHeartbeat(ctx context.Context, key string, err error) error {
+	e := LocalEvent{Kind: LocalHeartbeat, Subject: key, State: "ok"}
+	if err != nil {
+		e.State, e.Detail = "failed", err.Error()
+	}
+	return s.Record(ctx, e)
+}
+
+// RecordAlert stores an alert from source
+func (s *LocalStore) RecordAlert(ctx context.Context, source, severity, message string) error {
+	return s.Record(ctx, LocalEvent{Kind: LocalAlert, Subject: source, State: severity, Detail: message})
+}
+
+// ObserveProcess records a transition when the status of process differs
+// from the last one observed. Call it with every status poll.
+func (s *LocalStore) ObserveProcess(ctx context.Context, process, status string) error {
+	s.mu.Lock()
+	prev, seen := s.processes[process]
+	s.processes[process] = status
+	s.mu.Unlock()
+
+	if seen && prev == status {
+		return nil
+	}
+	return s.Record(ctx, LocalEvent{Kind: LocalProcess, Subject: process, State: status, Detail: prev})
+}
+
+// ObserveHealth raises an alert for every check that started failing
+// since the last call
+func (s *LocalStore) ObserveHealth(ctx context.Context, info registry.HealthInfo) error {
+	failing := make(map[string]struct{})
+	var started []registry.CheckResult
+
+	s.mu.Lock()
+	for _, c := range info.Checks {
+		if c.Error == "" {
+			continue
+		}
+		failing[c.Name] = struct{}{}
+		if _, ok := s.failing[c.Name]; !ok {
+			started = append(started, c)
+		}
+	}
+	s.failing = failing
+	s.mu.Unlock()
+
+	for _, c := range started {
+		severity := "warning"
+		if c.Kind == CheckLiveness {
+			severity = "critical"
+		}
+		if err := s.RecordAlert(ctx, "health."+c.Name, severity, c.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query returns the events matching q, oldest first (newest first when
+// q.Limit is set)
+func (s *LocalStore) Query(ctx context.Context, q LocalQuery) ([]LocalEvent, error) {
+	var where []string
+	var args []any
+	if q.Kind != "" {
+		where, args = append(where, "kind = ?"), append(args, q.Kind)
+	}
+	if q.Subject != "" {
+		where, args = append(where, "subject = ?"), append(args, q.Subject)
+	}
+	if !q.Since.IsZero() {
+		where, args = append(where, "at >= ?"), append(args, q.Since.UnixMilli())
+	}
+	if !q.Until.IsZero() {
+		where, args = append(where, "at < ?"), append(args, q.Until.UnixMilli())
+	}
+
+	query := "SELECT at, kind, subject, state, detail FROM events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if q.Limit > 0 {
+		query += " ORDER BY at DESC, id DESC LIMIT ?"
+		args = append(args, q.Limit)
+	} else {
+		query += " ORDER BY at, id"
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying local store: %w", err)
+	}
+	defer rows.Close()
+
+	var events []LocalEvent
+	for rows.Next() {
+		var e LocalEvent
+		var at int64
+		if err := rows.Scan(&at, &e.Kind, &e.Subject, &e.State, &e.Detail); err != nil {
+			return nil, fmt.Errorf("reading local store: %w", err)
+		}
+		e.At = time.UnixMilli(at)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading local store: %w", err)
+	}
+	return events, nil
+}
+
+// Transitions returns the status changes of process since a time
+func (s *LocalStore) Transitions(ctx context.Context, process string, since time.Time) ([]LocalEvent, error) {
+	return s.Query(ctx, LocalQuery{Kind: LocalProcess, Subject: process, Since: since})
+}
+
+// HeartbeatGap is a period in which key had no successful heartbeat
+type HeartbeatGap struct {
+	From time.Time     `json:"from"` // Last successful heartbeat before the gap
+	To   time.Time     `json:"to"`   // First successful heartbeat after it
+	Gap  time.Duration `json:"gap"`
+}
+
+// HeartbeatGaps returns the periods since a time in which successful
+// heartbeats of key were more than max apart - when the node was down,
+// hung or could not reach NATS
+func (s *LocalStore) HeartbeatGaps(ctx context.Context, key string, since time.Time, max time.Duration) ([]HeartbeatGap, error) {
+	events, err := s.Query(ctx, LocalQuery{Kind: LocalHeartbeat, Subject: key, Since: since})
+	if err != nil {
+		return nil, err
+	}
+	var ok []time.Time
+	for _, e := range events {
+		if e.State == "ok" {
+			ok = append(ok, e.At)
+		}
+	}
+	return heartbeatGaps(ok, max), nil
+}
+
+// heartbeatGaps finds gaps longer than max between sorted times
+func heartbeatGaps(times []time.Time, max time.Duration) []HeartbeatGap {
+	var gaps []HeartbeatGap
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d > max {
+			gaps = append(gaps, HeartbeatGap{From: times[i-1], To: times[i], Gap: d})
+		}
+	}
+	return gaps
+}
+
+// Prune deletes events beyond the retention policy and returns how many
+func (s *LocalStore) Prune(ctx context.Context) (int64, error) {
+	cutoff := s.now().Add(-s.retention.MaxAge).UnixMilli()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("pruning local store: %w", err)
+	}
+	byAge, _ := res.RowsAffected()
+
+	res, err = s.db.ExecContext(ctx,
+		`DELETE FROM events WHERE id <= (SELECT id FROM events ORDER BY id DESC LIMIT 1 OFFSET ?)`,
+		s.retention.MaxRows)
+	if err != nil {
+		return byAge, fmt.Errorf("pruning local store: %w", err)
+	}
+	byRows, _ := res.RowsAffected()
+	return byAge + byRows, nil
+}
+
+// Close stops pruning. The database stays open; the caller closes it.
+// Safe to call more than once.
+func (s *LocalStore) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		<-s.done
+	})
+	return nil
+}
+
+// LocalStore returns the store set with WithLocalStore (nil if none)
+func (m *Manager) LocalStore() *LocalStore {
+	return m.opts.LocalStore
+}
@@ -0,0 +1,137 @@
+package env
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestHeartbeatGaps(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  int
+	}{
+		{name: "none", times: nil, want: 0},
+		{name: "steady", times: []time.Time{at(0), at(10), at(20), at(30)}, want: 0},
+		{name: "one gap", times: []time.Time{at(0), at(10), at(100), at(110)}, want: 1},
+		{name: "two gaps", times: []time.Time{at(0), at(60), at(70), at(200)}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gaps := heartbeatGaps(tt.times, 30*time.Second)
+			if len(gaps) != tt.want {
+				t.Fatalf("heartbeatGaps() = %v, want %d gaps", gaps, tt.want)
+			}
+			for _, g := range gaps {
+				if g.Gap != g.To.Sub(g.From) || g.Gap <= 30*time.Second {
+					t.Errorf("gap %v..%v = %v", g.From, g.To, g.Gap)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalStoreObserve(t *testing.T) {
+	ctx := context.Background()
+	rec := &recordingDB{}
+	s, err := OpenLocalStore(ctx, sql.OpenDB(rec), LocalRetention{})
+	if err != nil {
+		t.Fatalf("OpenLocalStore() error = %v", err)
+	}
+	defer s.Close()
+
+	// Only status changes are transitions
+	for _, status := range []string{"Running", "Running", "Completed", "Completed", "Running"} {
+		if err := s.ObserveProcess(ctx, "api", status); err != nil {
+			t.Fatalf("ObserveProcess() error = %v", err)
+		}
+	}
+
+	// An alert when a check starts failing, not while it keeps failing
+	db := registry.CheckResult{Name: "db", Kind: CheckReadiness, Error: "connection refused"}
+	for _, checks := range [][]registry.CheckResult{{db}, {db}, {}, {db}} {
+		if err := s.ObserveHealth(ctx, registry.HealthInfo{Checks: checks}); err != nil {
+			t.Fatalf("ObserveHealth() error = %v", err)
+		}
+	}
+
+	if err := s.RecordHeartbeat(ctx, "o.r.i", errors.New("timeout")); err != nil {
+		t.Fatalf("RecordHeartbeat() error = %v", err)
+	}
+
+	want := []string{
+		"process api Running ",
+		"process api Completed Running",
+		"process api Running Completed",
+		"alert health.db warning connection refused",
+		"alert health.db warning connection refused",
+		"heartbeat o.r.i failed timeout",
+	}
+	got := rec.inserts()
+	if len(got) != len(want) {
+		t.Fatalf("recorded %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLocalRetentionDefaults(t *testing.T) {
+	r := LocalRetention{MaxRows: 10}.withDefaults()
+	if r.MaxRows != 10 {
+		t.Errorf("MaxRows = %d, want 10", r.MaxRows)
+	}
+	if r.MaxAge != DefaultLocalRetention.MaxAge || r.Interval != DefaultLocalRetention.Interval {
+		t.Errorf("withDefaults() = %+v, want defaults for MaxAge and Interval", r)
+	}
+}
+
+// recordingDB is a database/sql connector that keeps the events inserted
+// into it; other statements succeed without effect
+type recordingDB struct {
+	mu   sync.Mutex
+	rows []string
+}
+
+func (d *recordingDB) Connect(context.Context) (driver.Conn, error) { return recordingConn{d}, nil }
+func (d *recordingDB) Driver() driver.Driver                        { return nil }
+
+// inserts returns the inserted events as "kind subject state detail"
+func (d *recordingDB) inserts() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.rows...)
+}
+
+type recordingConn struct{ db *recordingDB }
+
+func (c recordingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c recordingConn) Close() error                        { return nil }
+func (c recordingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.HasPrefix(query, "INSERT INTO events") {
+		var fields []string
+		for _, a := range args[1:] { // Skip the timestamp
+			fields = append(fields, a.Value.(string))
+		}
+		c.db.mu.Lock()
+		c.db.rows = append(c.db.rows, strings.Join(fields, " "))
+		c.db.mu.Unlock()
+	}
+	return driver.RowsAffected(1), nil
+}
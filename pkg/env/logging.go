@@ -0,0 +1,21 @@
+// logging.go: Structured SDK logging via log/slog
+//
+// All SDK components log through a *slog.Logger tagged with a "component"
+// attribute (manager, nats, registrar, discovery, usage, liveness, metrics),
+// so services can route and filter SDK logs in their own pipeline:
+//
+//	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+//	mgr, _ := env.New("APP", env.WithLogger(logger))
+//
+// Without WithLogger, slog.Default() is used.
+package env
+
+import "log/slog"
+
+// componentLogger returns l (or slog.Default) tagged with a component name
+func componentLogger(l *slog.Logger, component string) *slog.Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With("component", component)
+}
@@ -0,0 +1,155 @@
+// logpane.go: Terminal-style live log pane for the Via dashboards
+//
+// A LogPane is a bounded buffer of log lines that renders as a scrolling,
+// monospace pane. It implements io.Writer, so command output can be piped
+// straight into it:
+//
+//	pane := env.NewLogPane("build-log", 200)
+//	cmd.Stdout, cmd.Stderr = pane, pane
+//
+//	c.View(func() h.H { return pane.Render() })
+//
+// ANSI escape sequences are stripped and carriage-return progress lines
+// keep only their last state. Call RegisterLogPanes once so panes follow
+// new output and pause while hovered.
+package env
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+)
+
+// DefaultLogLines is the line limit of a LogPane created with maxLines <= 0
+const DefaultLogLines = 500
+
+// ansiPattern matches CSI (colors, cursor movement) and OSC (titles, links)
+// escape sequences
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripANSI removes terminal escape sequences from s
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// LogPane holds the most recent lines of a log
+type LogPane struct {
+	mu       sync.Mutex
+	id       string
+	maxLines int
+	lines    []string
+	partial  []byte // Unterminated output from Write
+}
+
+// NewLogPane creates a pane with a stable element id keeping at most
+// maxLines lines
+func NewLogPane(id string, maxLines int) *LogPane {
+	if maxLines <= 0 {
+		maxLines = DefaultLogLines
+	}
+	return &LogPane{id: id, maxLines: maxLines}
+}
+
+// Append adds lines, dropping the oldest beyond the limit
+func (p *LogPane) Append(lines ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, line := range lines {
+		p.lines = append(p.lines, cleanLogLine(line))
+	}
+	p.trim()
+}
+
+// Write appends complete lines of b; a trailing partial line is held until
+// its newline arrives
+func (p *LogPane) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		p.lines = append(p.lines, cleanLogLine(string(p.partial[:i])))
+		p.partial = p.partial[i+1:]
+	}
+	p.trim()
+	return len(b), nil
+}
+
+// trim drops the oldest lines beyond maxLines (caller holds mu)
+func (p *LogPane) trim() {
+	if over := len(p.lines) - p.maxLines; over > 0 {
+		p.lines = append(p.lines[:0:0], p.lines[over:]...)
+	}
+}
+
+// Lines returns the buffered lines, including a pending partial line
+func (p *LogPane) Lines() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lines := append([]string(nil), p.lines...)
+	if len(p.partial) > 0 {
+		lines = append(lines, cleanLogLine(string(p.partial)))
+	}
+	return lines
+}
+
+// Clear empties the pane
+func (p *LogPane) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lines = nil
+	p.partial = nil
+}
+
+// Render returns the pane element
+func (p *LogPane) Render() h.H {
+	return h.Pre(h.ID(p.id), h.Class("wn-logpane"), h.Role("log"),
+		h.Attr("tabindex", "0"), h.Attr("title", "Hover to pause auto-scroll"),
+		h.Text(strings.Join(p.Lines(), "\n")),
+	)
+}
+
+// cleanLogLine strips escapes and keeps the text after the last carriage
+// return, like a terminal redrawing a progress line
+func cleanLogLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return StripANSI(line)
+}
+
+// RegisterLogPanes adds the pane styles and the auto-scroll script to every page
+func RegisterLogPanes(v *via.V) {
+	v.AppendToHead(h.StyleEl(h.Raw(logPaneCSS)))
+	v.AppendToFoot(h.Script(h.Raw(logPaneScript)))
+}
+
+// logPaneCSS gives panes a terminal look and a bounded height
+const logPaneCSS = `.wn-logpane{max-height:24rem;overflow:auto;margin:0;padding:.75rem;
+background:#111;color:#ddd;font-size:.8rem;line-height:1.4;white-space:pre-wrap;word-break:break-all}
+.wn-logpane:hover{outline:1px dashed #888}`
+
+// logPaneScript scrolls panes to the bottom after each patch unless hovered
+const logPaneScript = `(() => {
+  const paused = new Set();
+  const pane = (el) => el && el.closest ? el.closest('.wn-logpane') : null;
+  document.addEventListener('mouseover', (e) => { const p = pane(e.target); if (p) paused.add(p.id); });
+  document.addEventListener('mouseout', (e) => {
+    const p = pane(e.target);
+    if (p && !p.contains(e.relatedTarget)) paused.delete(p.id);
+  });
+  const follow = () => document.querySelectorAll('.wn-logpane').forEach((p) => {
+    if (!paused.has(p.id)) p.scrollTop = p.scrollHeight;
+  });
+  new MutationObserver(follow).observe(document.body, { childList: true, subtree: true, characterData: true });
+  follow();
+})();`
@@ -0,0 +1,76 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello", "hello"},
+		{"color", "\x1b[31merror\x1b[0m: failed", "error: failed"},
+		{"bold color", "\x1b[1;32mok\x1b[m", "ok"},
+		{"cursor", "\x1b[2K\x1b[1Gdone", "done"},
+		{"osc title", "\x1b]0;title\x07text", "text"},
+		{"osc link", "\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripANSI(tt.in); got != tt.want {
+				t.Errorf("StripANSI(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogPaneWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{"single line", []string{"a\n"}, []string{"a"}},
+		{"split line", []string{"he", "llo\nwor", "ld\n"}, []string{"hello", "world"}},
+		{"partial shown", []string{"a\nb"}, []string{"a", "b"}},
+		{"crlf", []string{"a\r\nb\r\n"}, []string{"a", "b"}},
+		{"progress", []string{"10%\r50%\r100%\n"}, []string{"100%"}},
+		{"colors", []string{"\x1b[33mwarn\x1b[0m\n"}, []string{"warn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pane := NewLogPane("log", 10)
+			for _, w := range tt.writes {
+				if _, err := pane.Write([]byte(w)); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if got := pane.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogPaneMaxLines(t *testing.T) {
+	pane := NewLogPane("log", 3)
+	for i := range 5 {
+		pane.Append(fmt.Sprintf("line %d", i))
+	}
+
+	want := []string{"line 2", "line 3", "line 4"}
+	if got := pane.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+
+	pane.Clear()
+	if got := pane.Lines(); len(got) != 0 {
+		t.Errorf("Lines() after Clear = %q, want empty", got)
+	}
+}
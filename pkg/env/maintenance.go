@@ -0,0 +1,162 @@
+// maintenance.go: Per-node maintenance mode
+//
+// Before working on a node, an operator drains it:
+//
+//	wellknown-check node drain edge-7 --reason "disk swap"
+//	wellknown-check node clear edge-7
+//
+// The flag lives in the node_maintenance KV bucket, keyed by NATS node
+// name, and every Manager on the node watches its key. While it is set:
+//
+//   - registrations carry it, so GetHealthyService and resolvers with
+//     WithHealthyInstances send the node no new work
+//   - maintenance-started/maintenance-ended events tell plugins and the app
+//     to stop and resume taking work (the wasmjob plugin does)
+//   - syncers and scheduled credential rotation pause
+//   - the dashboard shows a maintenance badge
+package env
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// MaintenanceBucket holds the maintenance flags, keyed by node name
+const MaintenanceBucket = "node_maintenance"
+
+// Maintenance is a node's maintenance flag
+type Maintenance struct {
+	Node   string    `json:"node"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"` // Who set it
+	Since  time.Time `json:"since"`
+}
+
+// OpenMaintenanceBucket creates (or opens) the node_maintenance bucket
+func OpenMaintenanceBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      MaintenanceBucket,
+		Description: "Node maintenance flags for wellnown-env",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening maintenance bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// SetMaintenance puts a node in maintenance (Since defaults to now)
+func SetMaintenance(ctx context.Context, kv jetstream.KeyValue, m Maintenance) error {
+	if m.Node == "" {
+		return fmt.Errorf("maintenance needs a node name")
+	}
+	if m.Since.IsZero() {
+		m.Since = time.Now().UTC()
+	}
+	if _, err := NewTypedKV[Maintenance](kv).Put(ctx, m.Node, m); err != nil {
+		return fmt.Errorf("setting maintenance on %s: %w", m.Node, err)
+	}
+	return nil
+}
+
+// ClearMaintenance takes a node out of maintenance
+func ClearMaintenance(ctx context.Context, kv jetstream.KeyValue, node string) error {
+	if err := kv.Delete(ctx, node); err != nil {
+		return fmt.Errorf("clearing maintenance on %s: %w", node, err)
+	}
+	return nil
+}
+
+// ListMaintenance returns the nodes in maintenance, sorted by name
+func ListMaintenance(ctx context.Context, kv jetstream.KeyValue) ([]Maintenance, error) {
+	flags, err := NewTypedKV[Maintenance](kv).List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Node < flags[j].Node })
+	return flags, nil
+}
+
+// Maintenance returns the node's maintenance flag (nil = in service)
+func (m *Manager) Maintenance() *Maintenance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.maintenance == nil {
+		return nil
+	}
+	flag := *m.maintenance
+	return &flag
+}
+
+// watchMaintenance applies the node's flag as it changes
+func (m *Manager) watchMaintenance() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := OpenMaintenanceBucket(ctx, m.natsNode.ControlJetStream())
+	if err != nil {
+		return err
+	}
+
+	flags := NewTypedKV[Maintenance](kv)
+	flags.SetLogger(componentLogger(m.opts.Logger, "maintenance"))
+	w, err := flags.Watch(context.Background(), m.natsNode.Name(), func(key string, flag *Maintenance, deleted bool) {
+		m.setMaintenance(flag)
+	})
+	if err != nil {
+		return fmt.Errorf("watching maintenance flag: %w", err)
+	}
+
+	m.mu.Lock()
+	m.maintWatch = w
+	m.mu.Unlock()
+	return nil
+}
+
+// setMaintenance marks the registration and, when the node enters or
+// leaves maintenance, pauses or resumes background work and emits the
+// event (nil = cleared)
+func (m *Manager) setMaintenance(flag *Maintenance) {
+	m.mu.Lock()
+	wasIn := m.maintenance != nil
+	m.maintenance = flag
+	registrar, syncers, rotator := m.registrar, m.syncers, m.rotator
+	m.mu.Unlock()
+	changed := wasIn != (flag != nil)
+	if !changed && flag == nil {
+		return
+	}
+
+	var mark *registry.Maintenance
+	if flag != nil {
+		mark = &registry.Maintenance{Reason: flag.Reason, Since: flag.Since}
+	}
+	if registrar != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := registrar.SetMaintenance(ctx, mark); err != nil {
+			m.logger.Warn("marking registration failed", "error", err)
+		}
+		cancel()
+	}
+	if !changed {
+		return // Only the reason changed
+	}
+
+	for _, s := range syncers {
+		s.SetPaused(flag != nil)
+	}
+	if rotator != nil {
+		rotator.SetPaused(flag != nil)
+	}
+	if flag != nil {
+		m.logger.Warn("node in maintenance", "reason", flag.Reason, "by", flag.By)
+		event := *flag
+		m.events.emit(Event{Type: EventMaintenanceStarted, Maintenance: &event})
+	} else {
+		m.logger.Info("node back in service")
+		m.events.emit(Event{Type: EventMaintenanceEnded})
+	}
+}
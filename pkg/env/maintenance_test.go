@@ -0,0 +1,108 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestMaintenanceFlags(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+
+	if err := SetMaintenance(ctx, kv, Maintenance{}); err == nil {
+		t.Error("SetMaintenance() without a node succeeded, want error")
+	}
+	for _, node := range []string{"edge-7", "edge-2"} {
+		if err := SetMaintenance(ctx, kv, Maintenance{Node: node, Reason: "disk swap"}); err != nil {
+			t.Fatalf("SetMaintenance(%s) error = %v", node, err)
+		}
+	}
+
+	flags, err := ListMaintenance(ctx, kv)
+	if err != nil {
+		t.Fatalf("ListMaintenance() error = %v", err)
+	}
+	if len(flags) != 2 || flags[0].Node != "edge-2" || flags[1].Node != "edge-7" {
+		t.Fatalf("ListMaintenance() = %+v, want edge-2 and edge-7", flags)
+	}
+	if flags[0].Since.IsZero() {
+		t.Error("SetMaintenance() left Since unset")
+	}
+
+	if err := ClearMaintenance(ctx, kv, "edge-7"); err != nil {
+		t.Fatalf("ClearMaintenance() error = %v", err)
+	}
+	flags, err = ListMaintenance(ctx, kv)
+	if err != nil {
+		t.Fatalf("ListMaintenance() error = %v", err)
+	}
+	if len(flags) != 1 || flags[0].Node != "edge-2" {
+		t.Errorf("ListMaintenance() after clear = %+v, want edge-2", flags)
+	}
+}
+
+func TestManagerSetMaintenance(t *testing.T) {
+	type config struct{}
+	ctx := context.Background()
+	kv := newMemKV()
+
+	r := NewRegistrar(kv, time.Hour)
+	if err := r.Register(ctx, "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer r.Deregister(ctx)
+
+	s := NewSyncer(nil, SyncConfig{}, nil, nil)
+	m := &Manager{
+		registrar: r,
+		syncers:   []*Syncer{s},
+		events:    &EventBus{},
+		logger:    componentLogger(nil, "manager"),
+	}
+	var events []EventType
+	m.Events().Subscribe(func(e Event) { events = append(events, e.Type) })
+
+	// registered reads the stored registration's maintenance mark
+	registered := func() *registry.Maintenance {
+		t.Helper()
+		keys, _ := kv.Keys(ctx)
+		entry, err := kv.Get(ctx, keys[0])
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		var reg registry.ServiceRegistration
+		if err := json.Unmarshal(entry.Value(), &reg); err != nil {
+			t.Fatalf("decoding registration: %v", err)
+		}
+		return reg.Maintenance
+	}
+
+	m.setMaintenance(&Maintenance{Node: "edge-7", Reason: "disk swap", Since: time.Now()})
+	m.setMaintenance(&Maintenance{Node: "edge-7", Reason: "still swapping"}) // No second event
+	if got := registered(); got == nil || got.Reason != "still swapping" {
+		t.Errorf("registration maintenance = %+v, want the new reason", got)
+	}
+	if !s.paused.Load() {
+		t.Error("syncer not paused during maintenance")
+	}
+	if m.Maintenance() == nil {
+		t.Error("Maintenance() = nil during maintenance")
+	}
+
+	m.setMaintenance(nil)
+	if got := registered(); got != nil {
+		t.Errorf("registration maintenance after clear = %+v, want nil", got)
+	}
+	if s.paused.Load() {
+		t.Error("syncer still paused after clear")
+	}
+
+	want := []EventType{EventMaintenanceStarted, EventMaintenanceEnded}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
@@ -23,15 +23,24 @@ package env
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/ardanlabs/conf/v3"
+	"github.com/google/uuid"
 	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/joeblew999/wellnown-env/pkg/env/secretcache"
+	"github.com/joeblew999/wellnown-env/pkg/env/secretsync"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Manager is the core SDK type that provides:
@@ -47,27 +56,199 @@ type Manager struct {
 	closed    bool
 	natsNode  *NATSNode
 	registrar *Registrar
+	usage     *UsageTracker
+	sources   []FieldSource
+	fields    []registry.FieldInfo
+	staticKV  jetstream.KeyValue // services_static (leafnode liveness)
+	liveness  *LeafLiveness
+	janitor   *RegistryJanitor // Tombstones of vanished registrations (hub)
+	outbox    *Outbox
+	syncers   []*Syncer          // Started with StartSyncer
+	callout   *AuthCallout       // Auth callout service (callout mode with issuer seed)
+	rotator   *CredentialRotator // Credential rotation (token, nkey and jwt modes)
+	exporter  *Exporter          // Event export to external sinks
+
+	registryKV      jetstream.KeyValue // Pluggable registry backend (nil = NATS KV)
+	replicaKV       jetstream.KeyValue // Local registry replica (read-replica mode)
+	replicaStaticKV jetstream.KeyValue
+	historyKV       jetstream.KeyValue // services_history
+	conflictLog     *KVBucket          // kv_conflicts (see kvconflict.go)
+
+	metricsSrv *http.Server
+	health     *HealthRegistry
+	healthSrv  *http.Server
+	breakGlass *breakGlass // Read-only snapshot endpoint (see breakglass.go)
+	tracer     trace.Tracer
+	logger     *slog.Logger
+	recentLogs *LogPane      // Captured SDK logs for support bundles
+	runtime    *runtimeStats // Heartbeat runtime stats (see runtimestats.go)
+	startup    *startupTimer // Startup phase timings (see startup.go)
+
+	dotenv       map[string]string // Env vars loaded from dotenv files -> file
+	secretReport *ResolutionReport // Last secret resolution in Parse
+	plugins      []Plugin          // Initialized plugins
+
+	events      *EventBus          // Lifecycle events (see events.go)
+	rotationSub *nats.Subscription // secret-rotated source
+	eventsStop  chan struct{}      // Stops the hub link watcher
+	eventsDone  chan struct{}
+
+	syncSub *nats.Subscription // Secret bundle updates (see secretsync.go)
+
+	maintenance *Maintenance // Node maintenance flag (nil = in service, see maintenance.go)
+	maintWatch  Watcher      // Watches the flag
+
+	tags      map[string]string // Node tags (see fleet.go)
+	tagsWatch Watcher           // Watches the tags
+
+	power      string        // Power profile ("" = normal, see power.go)
+	powerWatch Watcher       // Watches the node_power override
+	batch      *publishBatch // Batches Publish in the low-power profile
+
+	enrollState string        // Last enrollment answer from the hub (see enroll.go)
+	enrollStop  chan struct{} // Stops waiting for approval
+	enrollDone  chan struct{}
+
+	instance string        // Instance ID in the registry and NATS connection names
+	watchers []Watcher     // From WatchService and WatchServiceInstances, stopped in Close
+	drain    time.Duration // Drain NATS for up to this long in Close (set by Run; 0 = DefaultDrainTimeout)
 }
 
 // Options for Manager configuration
 type Options struct {
 	// NATS settings
-	HubURL      string // NATS hub URL (empty = standalone)
+	HubURL      string // NATS hub URLs, comma-separated (empty = standalone)
 	DataDir     string // Data directory (empty = in-memory)
 	NATSPort    int    // NATS client port (0 = random)
 	NATSName    string // Node name
+	WSAddr      string // WebSocket listener address (empty = disabled)
+	MonitorAddr string // NATS HTTP monitoring address (empty = disabled)
+	LocalNode   string // Running node to share instead of embedding one (empty = embed, see sharednode.go)
+	Socket      string // Unix socket for same-host clients (empty = none, see unixsocket.go)
+	NoTCP       bool   // Open no TCP client port
+
+	// Hub cluster membership (zero = not clustered)
+	Cluster ClusterConfig
+
+	// MQTT listener for IoT devices (zero = disabled)
+	MQTT MQTTConfig
+
+	// Core NATS only, buckets opened on first use (see nats.go)
+	LightweightNATS bool
+
+	// Offline behaviour
+	Reconnect ReconnectPolicy // Leaf link and client reconnect policy
+	Outbox    bool            // Buffer publishes in local JetStream while the hub is down
+
+	// Extra nats.go options for the node's own connections, applied after
+	// the defaults (name org/repo/instance, reconnect forever, drain on close)
+	ClientOptions []nats.Option
+
+	// Timeout and retries of registry, KVBucket and outbox writes
+	WritePolicy WritePolicy
+
+	// Resolution of KVBucket.Update conflicts (nil = return them as errors)
+	ConflictStrategy ConflictStrategy
+
+	// Local record of heartbeats and alerts (nil = none)
+	LocalStore *LocalStore
+
+	// Encrypted cache of resolved secrets for offline starts (nil = none)
+	SecretCache *secretcache.Cache
+
+	// Resolver of ref+ env vars (nil = DefaultSecretResolver)
+	SecretResolver *SecretResolver
+
+	// Handling of ref+ env vars that fail to resolve ("" = SecretFailFast)
+	SecretFailurePolicy SecretFailurePolicy
+
+	// Secret bundles pushed from the hub, applied in Parse (nil = none)
+	SecretSync *secretsync.Receiver
+
+	// Streams and consumers provisioned at startup
+	JetStreamSpec string // YAML spec file (empty = none)
+
+	// Event export to external systems
+	ExportSpec string // YAML export spec file (empty = none)
+
+	// Declarative hub resources (accounts, buckets, streams, consumers)
+	HubPlan string // JSON plan file applied at startup (empty = none)
+
+	// Read replica
+	ReadReplica bool   // Serve registry reads from local JetStream-sourced copies
+	HubDomain   string // Hub JetStream domain for sources (empty = same domain)
+
+	// JetStream domain of this node (empty = default domain, see jsdomain.go)
+	JetStreamDomain string
 
 	// Registration
-	DisableRegistration bool // Skip service registration
-	DisableHeartbeat    bool // Skip heartbeat
-	HeartbeatInterval   int  // Heartbeat interval in seconds (default: 10)
+	DisableRegistration bool            // Skip service registration
+	DisableHeartbeat    bool            // Skip heartbeat
+	HeartbeatInterval   int             // Heartbeat interval in seconds (default: 10)
+	RegistryBackend     RegistryBackend // Registration store (nil = NATS KV services_registry)
+
+	// Power
+	PowerProfile string         // normal (default) or low
+	LowPower     LowPowerConfig // Low-power heartbeat and publish batching
+
+	// Enrollment (leaf nodes register only once the hub approved them)
+	EnrollToken   string   // Enrollment token (empty = no enrollment)
+	EnrollKeyFile string   // Node NKey seed, created on first boot (default: .auth/node.nk)
+	Attester      Attester // Device evidence sent with enrollment requests (nil = none)
+
+	// Advertised capabilities (subjects, endpoints, micro services, health URL)
+	Capabilities registry.Capabilities
+
+	// Address consumers dial (empty = detect from config, see advertise.go)
+	AdvertiseAddr string
+
+	// Liveness
+	Liveness      string        // heartbeat (default) or leafnode
+	LeafMonitor   bool          // Run the leafnode liveness monitor (hub only)
+	LivenessGrace time.Duration // Disconnect grace before pruning (default: 30s)
+	Janitor       bool          // Record vanished registrations in services_history (hub only)
 
 	// GUI
 	GUIAddr    string // GUI address (default: :3001)
 	DisableGUI bool   // Disable GUI
 
 	// Auth
-	AuthMode string // none, token, nkey, jwt
+	AuthMode           string            // none, token, nkey, jwt, callout
+	CalloutAuthorizer  CalloutAuthorizer // Callout policy (nil = RegistryAuthorizer)
+	CredentialRotation time.Duration     // Rotate credentials this often (0 = on demand only)
+
+	// Config sources
+	ConfigFile    string   // YAML/JSON config file (empty = none)
+	KVOverrides   bool     // Read overrides from the config_overrides KV bucket
+	DotenvFiles   []string // Dotenv files loaded in New (nil = DotenvFiles(ENVIRONMENT))
+	DisableDotenv bool     // Load no dotenv files
+
+	// Usage accounting
+	EnableUsage bool // Track messages/bytes per subject prefix
+	UsageDepth  int  // Subject tokens used as accounting key (default: 2)
+
+	// Metrics
+	MetricsAddr string // Prometheus /metrics address (empty = disabled)
+
+	// Health
+	HealthAddr string // /healthz and /readyz address (empty = disabled)
+
+	// Break-glass snapshot for control plane outages (see breakglass.go)
+	BreakGlassAddr  string // Snapshot address (empty = disabled)
+	BreakGlassToken string // Bearer token required by the snapshot endpoint
+	BreakGlassFile  string // Last snapshot kept on disk (empty = memory only)
+
+	// Tracing
+	TracerProvider trace.TracerProvider // OTel provider (nil = global provider)
+
+	// Logging
+	Logger *slog.Logger // SDK logger (nil = slog.Default)
+
+	// Lifecycle extensions (see plugin.go)
+	Plugins []Plugin
+
+	// Shutdown
+	ShutdownGrace time.Duration // Run's wait for in-flight work (default: 10s)
 
 	// Disable NATS completely (for simple config-only use)
 	DisableNATS bool
@@ -83,6 +264,13 @@ func WithHub(url string) Option {
 	}
 }
 
+// WithCluster makes this node a member of a hub cluster (see ClusterConfig)
+func WithCluster(cfg ClusterConfig) Option {
+	return func(o *Options) {
+		o.Cluster = cfg
+	}
+}
+
 // WithDataDir sets the NATS data directory for persistence
 func WithDataDir(path string) Option {
 	return func(o *Options) {
@@ -97,6 +285,101 @@ func WithPort(port int) Option {
 	}
 }
 
+// WithWebSocket enables a WebSocket listener on the embedded NATS node
+// so browser clients (e.g. Via frontends) can subscribe directly
+func WithWebSocket(addr string) Option {
+	return func(o *Options) {
+		o.WSAddr = addr
+	}
+}
+
+// WithMQTT enables an MQTT listener on the embedded NATS node so devices
+// can publish MQTT straight into it. Empty creds use the node's auth.
+func WithMQTT(port int, creds MQTTCredentials) Option {
+	return func(o *Options) {
+		o.MQTT = MQTTConfig{Port: port, Creds: creds}
+	}
+}
+
+// WithMonitoring enables the NATS HTTP monitoring endpoints (/varz,
+// /connz, /leafz, /jsz, ...) on the embedded node, e.g. ":8222"
+func WithMonitoring(addr string) Option {
+	return func(o *Options) {
+		o.MonitorAddr = addr
+	}
+}
+
+// WithReconnectPolicy sets how the leaf link and client connections reconnect
+func WithReconnectPolicy(p ReconnectPolicy) Option {
+	return func(o *Options) {
+		o.Reconnect = p
+	}
+}
+
+// WithClientOptions passes nats.go options to the node's own connections,
+// e.g. nats.DrainTimeout or nats.Name. They override the defaults.
+func WithClientOptions(opts ...nats.Option) Option {
+	return func(o *Options) {
+		o.ClientOptions = append(o.ClientOptions, opts...)
+	}
+}
+
+// WithOutbox buffers Manager.Publish calls in local JetStream while the
+// hub is unreachable and replays them on reconnect
+func WithOutbox() Option {
+	return func(o *Options) {
+		o.Outbox = true
+	}
+}
+
+// WithJetStreamSpec provisions the streams and consumers of a YAML spec
+// file at startup
+func WithJetStreamSpec(path string) Option {
+	return func(o *Options) {
+		o.JetStreamSpec = path
+	}
+}
+
+// WithReadReplica mirrors the registry buckets locally and serves all
+// reads from them, keeping dashboards responsive over a slow hub link
+func WithReadReplica() Option {
+	return func(o *Options) {
+		o.ReadReplica = true
+	}
+}
+
+// WithUnixSocket serves same-host clients on a unix socket at path
+func WithUnixSocket(path string) Option {
+	return func(o *Options) {
+		o.Socket = path
+	}
+}
+
+// WithoutTCP opens no TCP client port; local clients use the unix socket
+// (WithUnixSocket)
+func WithoutTCP() Option {
+	return func(o *Options) {
+		o.NoTCP = true
+	}
+}
+
+// WithLocalNode connects to the node already running at url ("auto" =
+// DefaultLocalNodeURL) instead of embedding one, if it answers
+func WithLocalNode(url string) Option {
+	return func(o *Options) {
+		o.LocalNode = url
+	}
+}
+
+// WithLightweightNATS starts the embedded node without JetStream and
+// opens the registry bucket on first use, for short-lived commands. The
+// hub's JetStream stays reachable over the leaf link.
+func WithLightweightNATS() Option {
+	return func(o *Options) {
+		o.LightweightNATS = true
+	}
+}
+
 // WithoutRegistration disables service registration
 func WithoutRegistration() Option {
 	return func(o *Options) {
@@ -118,6 +401,30 @@ func WithHeartbeatInterval(seconds int) Option {
 	}
 }
 
+// WithCapabilities advertises what this service offers in its registration
+func WithCapabilities(caps registry.Capabilities) Option {
+	return func(o *Options) {
+		o.Capabilities = caps
+	}
+}
+
+// WithLeafLiveness registers once without heartbeats; the hub derives
+// liveness from this node's leafnode connection instead
+func WithLeafLiveness() Option {
+	return func(o *Options) {
+		o.Liveness = LivenessLeafnode
+	}
+}
+
+// WithLeafLivenessMonitor runs the hub side of leafnode liveness, pruning
+// registrations of leaf nodes that stay disconnected longer than grace
+func WithLeafLivenessMonitor(grace time.Duration) Option {
+	return func(o *Options) {
+		o.LeafMonitor = true
+		o.LivenessGrace = grace
+	}
+}
+
 // WithGUI sets the GUI bind address
 func WithGUI(addr string) Option {
 	return func(o *Options) {
@@ -132,26 +439,168 @@ func WithoutGUI() Option {
 	}
 }
 
-// WithoutNATS disables embedded NATS (config-only mode)
+// WithConfigFile loads config values from a YAML, TOML or JSON file.
+// File values rank above defaults but below KV overrides, env and flags.
+func WithConfigFile(path string) Option {
+	return func(o *Options) {
+		o.ConfigFile = path
+	}
+}
+
+// WithKVOverrides reads config values from the config_overrides KV bucket.
+// KV values rank above the config file but below env and flags.
+func WithKVOverrides() Option {
+	return func(o *Options) {
+		o.KVOverrides = true
+	}
+}
+
+// WithCalloutAuthorizer replaces the policy of the auth callout service
+// this node runs in callout mode (default: RegistryAuthorizer)
+func WithCalloutAuthorizer(fn CalloutAuthorizer) Option {
+	return func(o *Options) {
+		o.CalloutAuthorizer = fn
+	}
+}
+
+// WithWritePolicy sets the timeout and retries of JetStream writes made by
+// the registrar, KVBucket and the outbox (default: DefaultWritePolicy)
+func WithWritePolicy(p WritePolicy) Option {
+	return func(o *Options) {
+		o.WritePolicy = p
+	}
+}
+
+// WithCredentialRotation rotates the node's credentials every interval
+// (token, nkey and jwt modes; see credentials.go)
+func WithCredentialRotation(every time.Duration) Option {
+	return func(o *Options) {
+		o.CredentialRotation = every
+	}
+}
+
+// WithHealthEndpoints serves /healthz and /readyz at addr
+func WithHealthEndpoints(addr string) Option {
+	return func(o *Options) {
+		o.HealthAddr = addr
+	}
+}
+
+// WithUsageTracking enables per-subject message accounting, rolled up
+// daily into the usage_daily stream
+func WithUsageTracking() Option {
+	return func(o *Options) {
+		o.EnableUsage = true
+	}
+}
+
+// WithMetrics serves Prometheus metrics for SDK internals at addr/metrics
+func WithMetrics(addr string) Option {
+	return func(o *Options) {
+		o.MetricsAddr = addr
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry provider used for SDK spans
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// WithLogger routes SDK logs to logger. Every record carries a "component"
+// attribute (manager, nats, registrar, usage, liveness, metrics).
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithoutNATS disables embedded NATS (config-only mode). Services only
+// register if a RegistryBackend is set.
 func WithoutNATS() Option {
 	return func(o *Options) {
 		o.DisableNATS = true
-		o.DisableRegistration = true
 	}
 }
 
 // New creates a new Manager with the given prefix for environment variables.
 // The prefix is used by ardanlabs/conf to namespace env vars (e.g., APP_DB_PASSWORD).
 func New(prefix string, opts ...Option) (*Manager, error) {
+	startup := newStartupTimer(time.Now())
+
+	// Load dotenv files first, as they feed the defaults below. Options
+	// only set fields, so applying them to a scratch copy is harmless.
+	var pre Options
+	for _, opt := range opts {
+		opt(&pre)
+	}
+	var dotenv map[string]string
+	if !pre.DisableDotenv {
+		files := pre.DotenvFiles
+		if files == nil {
+			files = DotenvFiles(os.Getenv("ENVIRONMENT"))
+		}
+		done := startup.begin("new.dotenv")
+		loaded, err := loadDotenv(files)
+		done()
+		if err != nil {
+			return nil, fmt.Errorf("loading dotenv: %w", err)
+		}
+		dotenv = loaded
+	}
+
 	// Build options with defaults from environment
 	o := Options{
-		HubURL:            os.Getenv("NATS_HUB"),
-		DataDir:           os.Getenv("NATS_DATA"),
-		NATSName:          GetEnv("NATS_NAME", ""),
-		NATSPort:          GetEnvInt("NATS_PORT", 0),
+		HubURL:          os.Getenv("NATS_HUB"),
+		DataDir:         os.Getenv("NATS_DATA"),
+		NATSName:        GetEnv("NATS_NAME", ""),
+		NATSPort:        GetEnvInt("NATS_PORT", 0),
+		WSAddr:          os.Getenv("NATS_WS_ADDR"),
+		MonitorAddr:     os.Getenv("NATS_MONITOR_ADDR"),
+		LocalNode:       os.Getenv("NATS_LOCAL_NODE"),
+		Socket:          os.Getenv("NATS_SOCKET"),
+		NoTCP:           GetEnvBool("NATS_NO_TCP", false),
+		ReadReplica:     GetEnvBool("NATS_READ_REPLICA", false),
+		LightweightNATS: GetEnvBool("NATS_LIGHTWEIGHT", false),
+		HubDomain:       os.Getenv("NATS_HUB_DOMAIN"),
+		JetStreamDomain: os.Getenv("NATS_JS_DOMAIN"),
+		Cluster: ClusterConfig{
+			Name:     os.Getenv("NATS_CLUSTER_NAME"),
+			Addr:     GetEnv("NATS_CLUSTER_ADDR", ":6222"),
+			Routes:   GetEnvList("NATS_CLUSTER_ROUTES"),
+			Replicas: GetEnvInt("NATS_CLUSTER_REPLICAS", 0),
+		},
+		MQTT: MQTTConfig{
+			Port: GetEnvInt("NATS_MQTT_PORT", 0),
+			Creds: MQTTCredentials{
+				Username: os.Getenv("NATS_MQTT_USER"),
+				Password: os.Getenv("NATS_MQTT_PASSWORD"),
+			},
+		},
+		Outbox:            GetEnvBool("NATS_OUTBOX", false),
+		JetStreamSpec:     os.Getenv("JETSTREAM_SPEC"),
+		ExportSpec:        os.Getenv("EXPORT_SPEC"),
+		HubPlan:           os.Getenv("HUB_PLAN"),
+		ConfigFile:        os.Getenv("CONFIG_FILE"),
 		AuthMode:          GetEnv("NATS_AUTH", "none"),
 		GUIAddr:           GetEnv("GUI_ADDR", ":3001"),
 		HeartbeatInterval: GetEnvInt("HEARTBEAT_INTERVAL", 10),
+		PowerProfile:      GetEnv("POWER_PROFILE", PowerNormal),
+		LowPower: LowPowerConfig{
+			Heartbeat: time.Duration(GetEnvInt("LOW_POWER_HEARTBEAT", 0)) * time.Second,
+			Batch:     time.Duration(GetEnvInt("LOW_POWER_BATCH", 0)) * time.Second,
+		},
+		EnrollToken:   os.Getenv("ENROLL_TOKEN"),
+		EnrollKeyFile: os.Getenv("ENROLL_KEY_FILE"),
+		Liveness:      GetEnv("LIVENESS_MODE", LivenessHeartbeat),
+		MetricsAddr:   os.Getenv("METRICS_ADDR"),
+		HealthAddr:    os.Getenv("HEALTH_ADDR"),
+		AdvertiseAddr: os.Getenv("ADVERTISE_ADDR"),
+
+		BreakGlassAddr:  os.Getenv("BREAKGLASS_ADDR"),
+		BreakGlassToken: os.Getenv("BREAKGLASS_TOKEN"),
+		BreakGlassFile:  os.Getenv("BREAKGLASS_FILE"),
 	}
 
 	// Apply functional options
@@ -159,9 +608,75 @@ func New(prefix string, opts ...Option) (*Manager, error) {
 		opt(&o)
 	}
 
+	// Secret cache from SECRET_CACHE unless set with WithSecretCache
+	if o.SecretCache == nil && os.Getenv("SECRET_CACHE") != "" {
+		cache, err := secretCacheFromEnv(os.Getenv("SECRET_CACHE"))
+		if err != nil {
+			return nil, err
+		}
+		o.SecretCache = cache
+	}
+
+	// Secret failure policy from SECRET_FAILURE_POLICY unless set
+	if o.SecretFailurePolicy == "" {
+		policy, err := ParseSecretFailurePolicy(os.Getenv("SECRET_FAILURE_POLICY"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing SECRET_FAILURE_POLICY: %w", err)
+		}
+		o.SecretFailurePolicy = policy
+	}
+
+	// Secret sync from SECRET_SYNC_SEED_FILE unless set with WithSecretSync
+	if o.SecretSync == nil {
+		r, err := secretSyncFromEnv(prefix)
+		if err != nil {
+			return nil, err
+		}
+		o.SecretSync = r
+	}
+
+	if err := validPower(o.PowerProfile); err != nil {
+		return nil, fmt.Errorf("parsing POWER_PROFILE: %w", err)
+	}
+
+	// The outbox and read replicas live in the node's own JetStream
+	if o.LightweightNATS && (o.Outbox || o.ReadReplica) {
+		return nil, fmt.Errorf("NATS_LIGHTWEIGHT has no local JetStream for NATS_OUTBOX or NATS_READ_REPLICA")
+	}
+
+	// Built-in attester from ENROLL_ATTESTATION unless set with WithAttestation
+	if o.Attester == nil {
+		attester, err := attesterFromEnv(os.Getenv("ENROLL_ATTESTATION"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing ENROLL_ATTESTATION: %w", err)
+		}
+		o.Attester = attester
+	}
+
+	// Keep recent SDK logs for support bundles
+	recentLogs := NewLogPane("support-logs", DefaultLogLines)
+	o.Logger = captureLogs(o.Logger, recentLogs)
+
+	// Record SDK errors as the last error in heartbeats
+	stats := newRuntimeStats(time.Now())
+	o.Logger = recordErrors(o.Logger, stats)
+
 	m := &Manager{
-		prefix: prefix,
-		opts:   o,
+		prefix:     prefix,
+		opts:       o,
+		tracer:     newTracer(o.TracerProvider),
+		logger:     componentLogger(o.Logger, "manager"),
+		health:     NewHealthRegistry(),
+		recentLogs: recentLogs,
+		runtime:    stats,
+		startup:    startup,
+		dotenv:     dotenv,
+		events:     &EventBus{},
+		instance:   uuid.New().String()[:8],
+	}
+
+	if o.RegistryBackend != nil {
+		m.registryKV = newBackendKV(o.RegistryBackend)
 	}
 
 	// Initialize embedded NATS if not disabled
@@ -172,31 +687,314 @@ func New(prefix string, opts ...Option) (*Manager, error) {
 		}
 
 		natsCfg := NATSConfig{
-			Name:    o.NATSName,
-			Port:    o.NATSPort,
-			HubURL:  o.HubURL,
-			DataDir: o.DataDir,
+			Name:          o.NATSName,
+			Port:          o.NATSPort,
+			HubURL:        o.HubURL,
+			DataDir:       o.DataDir,
+			WebSocketAddr: o.WSAddr,
+			MonitorAddr:   o.MonitorAddr,
+			Socket:        o.Socket,
+			NoTCP:         o.NoTCP,
+			MQTT:          o.MQTT,
+			Reconnect:     o.Reconnect,
+			ClientName:    clientName(registry.GetGitHubInfo(), m.instance),
+			ClientOptions: o.ClientOptions,
+			Cluster:       o.Cluster,
+			Domain:        o.JetStreamDomain,
+			HubDomain:     o.HubDomain,
+			Lightweight:   o.LightweightNATS,
+			Logger:        o.Logger,
+
+			OnSlowConsumer: func(sc SlowConsumer) {
+				m.events.emit(Event{Type: EventSlowConsumer, Time: sc.Time, SlowConsumer: &sc})
+			},
 		}
 
-		node, err := StartNATSNode(natsCfg, authCfg)
-		if err != nil {
-			return nil, fmt.Errorf("starting NATS node: %w", err)
+		// Share a node already running on the host (see sharednode.go)
+		var node *NATSNode
+		if url := localNodeURL(o.LocalNode); url != "" && !o.ownsServer() && authCfg.CalloutSeed == "" {
+			done := startup.begin("new.nats_shared")
+			node, err = ConnectLocalNode(url, natsCfg, authCfg)
+			done()
+			if err != nil {
+				m.logger.Info("no local node to share, embedding one", "url", url, "error", err)
+				node = nil
+			}
+		}
+		if node == nil {
+			done := startup.begin("new.nats")
+			node, err = StartNATSNode(natsCfg, authCfg)
+			done()
+			if err != nil {
+				return nil, fmt.Errorf("starting NATS node: %w", err)
+			}
 		}
 		m.natsNode = node
 
+		// Serve auth callout requests if this node holds the issuer seed
+		if authCfg.Mode == "callout" && authCfg.CalloutSeed != "" {
+			authorize := o.CalloutAuthorizer
+			if authorize == nil {
+				authorize = RegistryAuthorizer(m.KV())
+			}
+			authorize = m.accessAuthorizer(authorize) // Access grant tokens (access.go)
+			callout, err := StartAuthCallout(node.ControlConn(), authCfg.CalloutSeed, authorize, o.Logger)
+			if err != nil {
+				m.closeNATS()
+				return nil, fmt.Errorf("starting auth callout: %w", err)
+			}
+			m.callout = callout
+		}
+
+		// Credential rotation (on demand, and scheduled if configured)
+		switch authCfg.Mode {
+		case "token", "nkey", "jwt":
+			if node.Shared() {
+				break // The owner rotates its credentials
+			}
+			rotator, err := StartCredentialRotator(node, o.CredentialRotation, 0, o.Logger)
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			m.rotator = rotator
+		default:
+			if o.CredentialRotation > 0 {
+				m.closeNATS()
+				return nil, fmt.Errorf("credential rotation needs NATS_AUTH=token, nkey or jwt (got %s)", authCfg.Mode)
+			}
+		}
+
+		// Start usage accounting tap if enabled
+		if o.EnableUsage {
+			done := startup.begin("new.usage")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			tracker, err := StartUsageTracker(ctx, node.Conn(), node.JetStream(), node.Name(), o.UsageDepth, o.Logger)
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, fmt.Errorf("starting usage tracker: %w", err)
+			}
+			m.usage = tracker
+		}
+
+		// Declarative hub plan (accounts, buckets, streams)
+		if o.HubPlan != "" {
+			plan, err := LoadHubPlan(o.HubPlan)
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			done := startup.begin("new.hub_plan")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err = m.ApplyHubPlan(ctx, plan)
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+		}
+
+		// Declared streams and consumers
+		if o.JetStreamSpec != "" {
+			spec, err := LoadJetStreamSpec(o.JetStreamSpec)
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			done := startup.begin("new.jetstream_spec")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err = m.EnsureJetStream(ctx, spec)
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+		}
+
+		// Offline publish buffer
+		if o.Outbox {
+			done := startup.begin("new.outbox")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			outbox, err := StartOutbox(ctx, node, o.Logger)
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			outbox.SetWritePolicy(o.WritePolicy)
+			m.outbox = outbox
+		}
+
+		// Static registry for leafnode liveness (either side)
+		if o.Liveness == LivenessLeafnode || o.LeafMonitor {
+			done := startup.begin("new.static_registry")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			staticKV, err := CreateStaticRegistry(ctx, node.ControlJetStream())
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			m.staticKV = staticKV
+		}
+
+		if o.LeafMonitor {
+			m.liveness = StartLeafLiveness(node, m.staticKV, o.LivenessGrace, o.Logger)
+		}
+
+		// Tombstones of vanished registrations
+		if o.Janitor {
+			done := startup.begin("new.janitor")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			janitor, err := StartRegistryJanitor(ctx, node.ControlJetStream(), m.KV(), m.staticKV, o.Logger)
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, fmt.Errorf("starting registry janitor: %w", err)
+			}
+			m.janitor = janitor
+			if m.liveness != nil {
+				m.liveness.OnPrune(janitor.markPruned)
+			}
+		}
+
 		// Create registrar if registration is enabled
 		if !o.DisableRegistration {
-			interval := time.Duration(o.HeartbeatInterval) * time.Second
-			m.registrar = NewRegistrar(node.KV(), interval)
+			if o.Liveness == LivenessLeafnode {
+				m.registrar = NewLeafRegistrar(m.staticKV, node.Name())
+			} else {
+				interval := time.Duration(o.HeartbeatInterval) * time.Second
+				m.registrar = NewRegistrar(m.KV(), interval)
+				m.registrar.SetNode(node.Name())
+			}
+			m.setupRegistrar()
+		}
+
+		// Registration history (changelog); lightweight nodes that don't
+		// register open it in RegistrationChangelog
+		if !o.LightweightNATS || m.registrar != nil {
+			done := startup.begin("new.history_bucket")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			historyKV, err := CreateHistoryBucket(ctx, node.ControlJetStream())
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			m.historyKV = historyKV
+			if m.registrar != nil {
+				m.registrar.SetHistory(historyKV)
+			}
+		}
+
+		// Local replicas for reads (after the registrar took the real buckets)
+		if o.ReadReplica {
+			done := startup.begin("new.replicas")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := m.startReplicas(ctx)
+			cancel()
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+		}
+
+		// Event export to external sinks
+		if o.ExportSpec != "" {
+			spec, err := LoadExportSpec(o.ExportSpec)
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			// Exported subjects are bulk traffic: subscribe on the data connection
+			done := startup.begin("new.exporter")
+			exporter, err := StartExporter(node.Conn(), m.KV(), spec.Exports, o.Logger)
+			done()
+			if err != nil {
+				m.closeNATS()
+				return nil, err
+			}
+			m.exporter = exporter
 		}
+	} else if m.registryKV != nil && !o.DisableRegistration {
+		// No NATS: register to the pluggable backend only
+		m.registrar = NewRegistrar(m.registryKV, time.Duration(o.HeartbeatInterval)*time.Second)
+		m.setupRegistrar()
 	}
 
+	m.setPower(o.PowerProfile)
+
+	if o.MetricsAddr != "" {
+		if err := m.startMetricsServer(o.MetricsAddr); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+	if o.HealthAddr != "" {
+		m.startHealthServer(o.HealthAddr)
+	}
+	if o.BreakGlassAddr != "" {
+		if err := m.startBreakGlass(o.BreakGlassAddr); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+
+	if err := m.startEvents(); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("starting lifecycle events: %w", err)
+	}
+	done := startup.begin("new.plugins")
+	err := m.initPlugins()
+	done()
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	startup.constructed()
 	return m, nil
 }
 
+// setupRegistrar applies the Manager's options to a new registrar
+func (m *Manager) setupRegistrar() {
+	m.registrar.SetTracer(m.tracer)
+	m.registrar.SetCapabilities(m.opts.Capabilities)
+	m.registrar.SetAdvertiseAddr(m.opts.AdvertiseAddr)
+	m.registrar.SetHealth(m.health)
+	m.registrar.SetRuntimeStats(m.runtime.collect)
+	m.registrar.SetLogger(componentLogger(m.opts.Logger, "registrar"))
+	m.registrar.SetWritePolicy(m.opts.WritePolicy)
+	m.registrar.SetLocalStore(m.opts.LocalStore)
+	m.registrar.SetInstanceID(m.instance)
+}
+
+// clientName names an instance's NATS connections org/repo/instance
+// (unknown/instance when the build has no GitHub ldflags), so connz
+// lists them by service
+func clientName(gh registry.GitHubInfo, instance string) string {
+	name := gh.Name()
+	if name == "" {
+		name = "unknown"
+	}
+	return name + "/" + instance
+}
+
 // Parse parses config from environment variables, resolves secrets,
 // and registers the service to the mesh.
 //
+// Sources are layered: defaults < config file < KV overrides < env < flags.
+// Use ConfigSources to see which source supplied each field.
+//
 // The cfg parameter must be a pointer to a struct with conf tags.
 // Returns help text if --help was provided.
 func (m *Manager) Parse(cfg interface{}) (string, error) {
@@ -207,27 +1005,119 @@ func (m *Manager) Parse(cfg interface{}) (string, error) {
 	}
 	m.mu.RUnlock()
 
-	// Step 1: Resolve secrets in environment BEFORE parsing config
+	start := time.Now()
+	defer func() { metrics.observeParse(time.Since(start)) }()
+
+	ctx, span := startSpan(context.Background(), m.tracer, "env.Parse", attribute.String("env.prefix", m.prefix))
+	help, err := m.parse(withStartupTimer(ctx, m.startup), cfg)
+	endSpan(span, err)
+	if err == nil && help == "" && m.startup.finish() {
+		m.logStartup()
+	}
+	return help, err
+}
+
+// parse runs the Parse steps, each in its own span
+func (m *Manager) parse(ctx context.Context, cfg interface{}) (string, error) {
+	// Step 0: Layer config file and KV overrides underneath the environment
+	stepCtx, span := startSpan(ctx, m.tracer, "env.ConfigSources")
+	done := m.startup.begin("parse.config_sources")
+	injected, err := m.loadConfigSources(stepCtx, cfg)
+	done()
+	endSpan(span, err)
+	if err != nil {
+		return "", err
+	}
+
+	// Step 1: Apply secrets pushed from the hub, then resolve secrets in
+	// environment BEFORE parsing config.
 	// This replaces ref+vault://... with actual values
-	if err := ResolveEnvSecrets(); err != nil {
+	stepCtx, span = startSpan(ctx, m.tracer, "env.SyncSecrets")
+	done = m.startup.begin("parse.sync_secrets")
+	err = m.syncSecrets(stepCtx)
+	done()
+	endSpan(span, err)
+	if err != nil {
+		return "", err
+	}
+
+	stepCtx, span = startSpan(ctx, m.tracer, "env.ResolveSecrets", attribute.Int("env.secret_refs", len(ListSecretRefs())))
+	done = m.startup.begin("parse.secrets")
+	res := m.opts.SecretResolver
+	if res == nil {
+		res, err = DefaultSecretResolver()
+	}
+	var report *ResolutionReport
+	if err == nil {
+		report, err = resolveEnvSecrets(stepCtx, res, m.secretProviders(), m.opts.SecretCache, m.opts.SecretFailurePolicy)
+	}
+	done()
+	endSpan(span, err)
+	if report != nil {
+		m.mu.Lock()
+		m.secretReport = report
+		m.mu.Unlock()
+		for _, key := range report.Fallback {
+			m.logger.Warn("secret resolution failed, using previous value", "key", key)
+		}
+		if err == nil {
+			for _, f := range report.Failed {
+				m.logger.Warn("secret resolution failed, left unset", "key", f.Key, "error", f.Err)
+			}
+		}
+	}
+	if err != nil {
 		return "", fmt.Errorf("resolving secrets: %w", err)
 	}
 
 	// Step 2: Parse config using ardanlabs/conf
+	_, span = startSpan(ctx, m.tracer, "env.ParseConfig")
+	done = m.startup.begin("parse.config")
 	help, err := conf.Parse(m.prefix, cfg)
+	done()
+	if err == conf.ErrHelpWanted {
+		endSpan(span, nil)
+		return help, nil
+	}
+	endSpan(span, err)
 	if err != nil {
-		if err == conf.ErrHelpWanted {
-			return help, nil
-		}
 		return "", fmt.Errorf("parsing config: %w", err)
 	}
 
-	// Step 3: Register to mesh
+	// Step 3: Validate field rules and Validator implementations
+	_, span = startSpan(ctx, m.tracer, "env.Validate")
+	done = m.startup.begin("parse.validate")
+	err = ValidateConfig(m.prefix, cfg)
+	done()
+	endSpan(span, err)
+	if err != nil {
+		return "", fmt.Errorf("validating config: %w", err)
+	}
+
+	m.mu.Lock()
+	m.sources = resolveFieldSources(m.prefix, cfg, injected, os.Args[1:])
+	m.fields = ExtractFields(m.prefix, cfg)
+	m.mu.Unlock()
+
+	done = m.startup.begin("parse.plugins")
+	err = m.parsePlugins(cfg)
+	done()
+	if err != nil {
+		return "", err
+	}
+	m.events.emit(Event{Type: EventConfigParsed, Config: cfg})
+
+	// Step 4: Register to mesh (new leaf nodes once the hub enrolled them)
 	if m.registrar != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := m.registrar.Register(ctx, m.prefix, cfg); err != nil {
-			return "", fmt.Errorf("registering service: %w", err)
+		register := m.register
+		if m.enrolling() {
+			register = m.registerEnrolled
+		}
+		done = m.startup.begin("parse.register")
+		err = register(ctx, cfg)
+		done()
+		if err != nil {
+			return "", err
 		}
 	}
 
@@ -237,15 +1127,73 @@ func (m *Manager) Parse(cfg interface{}) (string, error) {
 	return "", nil
 }
 
+// register registers the service to the mesh
+func (m *Manager) register(ctx context.Context, cfg interface{}) error {
+	regCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	regCtx, span := startSpan(regCtx, m.tracer, "env.Register")
+	err := m.registrar.Register(regCtx, m.prefix, cfg)
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("registering service: %w", err)
+	}
+	m.events.emit(Event{Type: EventRegistered})
+	return nil
+}
+
+// loadConfigSources opens the KV overrides bucket (if enabled) and layers
+// the config file and overrides into the environment
+func (m *Manager) loadConfigSources(ctx context.Context, cfg interface{}) (map[string]ConfigSource, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var overrides jetstream.KeyValue
+	if m.opts.KVOverrides && m.natsNode != nil {
+		kv, err := m.natsNode.ControlJetStream().CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      ConfigOverridesBucket,
+			Description: "Per-service config overrides for wellnown-env",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("opening config overrides: %w", err)
+		}
+		overrides = kv
+	}
+
+	injected, err := applyConfigSources(ctx, m.prefix, cfg, m.opts.ConfigFile, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("loading config sources: %w", err)
+	}
+	for key := range m.dotenv {
+		injected[key] = SourceDotenv
+	}
+	return injected, nil
+}
+
 // Close shuts down the manager and disconnects from NATS
 func (m *Manager) Close() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if m.closed {
+		m.mu.Unlock()
 		return nil
 	}
 	m.closed = true
+	m.mu.Unlock()
+
+	// Subscribers and plugins go first, unlocked: they may still call the
+	// manager
+	m.events.emit(Event{Type: EventShuttingDown})
+	m.shutdownPlugins()
+	m.stopEvents()
+	m.stopEnrollment()
+	m.stopWatchers()
+	m.stopBatch()
+	m.stopBreakGlass()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopMetricsServer()
+	m.stopHealthServer()
 
 	// Deregister from mesh
 	if m.registrar != nil {
@@ -253,12 +1201,63 @@ func (m *Manager) Close() error {
 		defer cancel()
 		if err := m.registrar.Deregister(ctx); err != nil {
 			// Log but don't fail - we're shutting down anyway
-			fmt.Printf("deregister failed: %v\n", err)
+			m.logger.Warn("deregister failed", "error", err)
+		}
+	}
+
+	return m.closeNATS()
+}
+
+// closeNATS stops background NATS workers and shuts down the node
+func (m *Manager) closeNATS() error {
+	// Stop usage accounting (publishes a final rollup)
+	if m.usage != nil {
+		if err := m.usage.Stop(); err != nil {
+			m.logger.Warn("usage tracker stop failed", "error", err)
+		}
+	}
+
+	// Flush exports while NATS is still up
+	if m.exporter != nil {
+		m.exporter.Stop()
+	}
+
+	if m.liveness != nil {
+		m.liveness.Stop()
+	}
+
+	if m.janitor != nil {
+		m.janitor.Stop()
+	}
+
+	for _, s := range m.syncers {
+		s.Stop()
+	}
+	m.syncers = nil
+
+	if m.outbox != nil {
+		m.outbox.Stop()
+	}
+
+	if m.rotator != nil {
+		m.rotator.Stop()
+	}
+
+	if m.callout != nil {
+		if err := m.callout.Stop(); err != nil {
+			m.logger.Warn("auth callout stop failed", "error", err)
 		}
 	}
 
 	// Shutdown NATS
 	if m.natsNode != nil {
+		timeout := m.drain
+		if timeout <= 0 {
+			timeout = DefaultDrainTimeout
+		}
+		if err := m.natsNode.Drain(timeout); err != nil {
+			m.logger.Warn("NATS drain incomplete", "error", err)
+		}
 		if err := m.natsNode.Close(); err != nil {
 			return fmt.Errorf("closing NATS: %w", err)
 		}
@@ -277,7 +1276,8 @@ func (m *Manager) GUIAddr() string {
 	return m.opts.GUIAddr
 }
 
-// NC returns the NATS connection (nil if NATS disabled)
+// NC returns the data-plane NATS connection (nil if NATS disabled).
+// Use it for application publishing and subscriptions.
 func (m *Manager) NC() *nats.Conn {
 	if m.natsNode == nil {
 		return nil
@@ -285,11 +1285,37 @@ func (m *Manager) NC() *nats.Conn {
 	return m.natsNode.Conn()
 }
 
-// KV returns the services_registry KV bucket (nil if NATS disabled)
+// ControlNC returns the control-plane NATS connection (nil if NATS disabled).
+// Reserve it for low-volume, latency-sensitive traffic such as commands.
+func (m *Manager) ControlNC() *nats.Conn {
+	if m.natsNode == nil {
+		return nil
+	}
+	return m.natsNode.ControlConn()
+}
+
+// Request sends a request on the data connection and waits for the reply.
+// Close lets it finish before draining NATS.
+func (m *Manager) Request(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("requesting %s: NATS disabled", subject)
+	}
+	return m.natsNode.Request(ctx, subject, data)
+}
+
+// KV returns the services_registry KV bucket (nil if NATS disabled).
+// With a RegistryBackend this is the backend; in read-replica mode the
+// local replica.
 func (m *Manager) KV() jetstream.KeyValue {
+	if m.registryKV != nil {
+		return m.registryKV
+	}
 	if m.natsNode == nil {
 		return nil
 	}
+	if m.replicaKV != nil {
+		return m.replicaKV
+	}
 	return m.natsNode.KV()
 }
 
@@ -309,28 +1335,189 @@ func (m *Manager) ClientURL() string {
 	return m.natsNode.ClientURL()
 }
 
-// WatchService watches for changes to a specific service (org/repo)
-func (m *Manager) WatchService(name string, fn func(registry.ServiceRegistration)) (Watcher, error) {
+// WebSocketURL returns the NATS WebSocket URL (empty if disabled)
+func (m *Manager) WebSocketURL() string {
+	if m.natsNode == nil {
+		return ""
+	}
+	return m.natsNode.WebSocketURL()
+}
+
+// MQTTURL returns the MQTT URL devices should use (empty if disabled)
+func (m *Manager) MQTTURL() string {
 	if m.natsNode == nil {
+		return ""
+	}
+	return m.natsNode.MQTTURL()
+}
+
+// StaticKV returns the services_static KV bucket (nil unless leafnode
+// liveness or read-replica mode is in use)
+func (m *Manager) StaticKV() jetstream.KeyValue {
+	if m.replicaStaticKV != nil {
+		return m.replicaStaticKV
+	}
+	return m.staticKV
+}
+
+// WatchService watches for changes to a specific service (org/repo)
+// until ctx is canceled. Close stops the watcher if the caller has not.
+func (m *Manager) WatchService(ctx context.Context, name string, fn func(registry.ServiceRegistration)) (Watcher, error) {
+	if m.KV() == nil {
 		return nil, fmt.Errorf("NATS is disabled")
 	}
-	return WatchService(m.natsNode.KV(), name, fn)
+	logger := m.discoveryLogger()
+	if m.StaticKV() == nil {
+		w, err := watchService(ctx, m.KV(), name, fn, logger)
+		if err != nil {
+			return nil, err
+		}
+		return m.trackWatcher(w), nil
+	}
+
+	// Each bucket delivers on its own goroutine; callers get one at a time
+	var mu sync.Mutex
+	serial := func(reg registry.ServiceRegistration) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(reg)
+	}
+	w, err := watchService(ctx, m.KV(), name, serial, logger)
+	if err != nil {
+		return nil, err
+	}
+	sw, err := watchService(ctx, m.StaticKV(), name, serial, logger)
+	if err != nil {
+		w.Stop()
+		return nil, err
+	}
+	return m.trackWatcher(multiWatcher{w, sw}), nil
+}
+
+// WatchServiceInstances returns the current instances of a service
+// (org/repo) by registry key, then calls fn for every change, deletes
+// included (see discovery.go), until ctx is canceled. Close stops the
+// watcher if the caller has not.
+func (m *Manager) WatchServiceInstances(ctx context.Context, name string, fn InstanceFunc) (map[string]registry.ServiceRegistration, Watcher, error) {
+	if m.KV() == nil {
+		return nil, nil, fmt.Errorf("NATS is disabled")
+	}
+	logger := m.discoveryLogger()
+	if m.StaticKV() == nil {
+		instances, w, err := watchServiceInstances(ctx, m.KV(), name, fn, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		return instances, m.trackWatcher(w), nil
+	}
+
+	// Each bucket delivers on its own goroutine; callers get one at a time
+	var mu sync.Mutex
+	serial := func(key string, reg *registry.ServiceRegistration, deleted bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(key, reg, deleted)
+	}
+	instances, w, err := watchServiceInstances(ctx, m.KV(), name, serial, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	static, sw, err := watchServiceInstances(ctx, m.StaticKV(), name, serial, logger)
+	if err != nil {
+		w.Stop()
+		return nil, nil, err
+	}
+	maps.Copy(instances, static) // An instance registers in one bucket only
+	return instances, m.trackWatcher(multiWatcher{w, sw}), nil
 }
 
 // GetService returns all instances of a service
-func (m *Manager) GetService(ctx context.Context, name string) ([]registry.ServiceRegistration, error) {
-	if m.natsNode == nil {
+func (m *Manager) GetService(ctx context.Context, name string) (regs []registry.ServiceRegistration, err error) {
+	if m.KV() == nil {
 		return nil, fmt.Errorf("NATS is disabled")
 	}
-	return GetService(ctx, m.natsNode.KV(), name)
+	ctx, span := startSpan(ctx, m.tracer, "env.GetService", attribute.String("env.service", name))
+	defer func() {
+		span.SetAttributes(attribute.Int("env.instances", len(regs)))
+		endSpan(span, err)
+	}()
+
+	if m.StaticKV() == nil {
+		return getService(ctx, m.KV(), name, m.discoveryLogger())
+	}
+	return mergeRegistrations(
+		func(kv jetstream.KeyValue) ([]registry.ServiceRegistration, error) {
+			return getService(ctx, kv, name, m.discoveryLogger())
+		},
+		m.KV(), m.StaticKV(),
+	)
 }
 
 // GetAllServices returns all registered services
-func (m *Manager) GetAllServices(ctx context.Context) ([]registry.ServiceRegistration, error) {
+func (m *Manager) GetAllServices(ctx context.Context) (regs []registry.ServiceRegistration, err error) {
+	if m.KV() == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	ctx, span := startSpan(ctx, m.tracer, "env.GetAllServices")
+	defer func() {
+		span.SetAttributes(attribute.Int("env.instances", len(regs)))
+		endSpan(span, err)
+	}()
+
+	if m.StaticKV() == nil {
+		return getAllServices(ctx, m.KV(), m.discoveryLogger())
+	}
+	return mergeRegistrations(
+		func(kv jetstream.KeyValue) ([]registry.ServiceRegistration, error) {
+			return getAllServices(ctx, kv, m.discoveryLogger())
+		},
+		m.KV(), m.StaticKV(),
+	)
+}
+
+// GetDrift groups the instances of a service by config hash (see
+// GroupByConfigHash); more than one group means config drift
+func (m *Manager) GetDrift(ctx context.Context, name string) ([]DriftGroup, error) {
+	regs, err := m.GetService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return GroupByConfigHash(regs), nil
+}
+
+// discoveryLogger returns the logger for discovery calls
+func (m *Manager) discoveryLogger() *slog.Logger {
+	return componentLogger(m.opts.Logger, "discovery")
+}
+
+// mergeRegistrations runs a lookup against several buckets, treating an
+// empty bucket as no results
+func mergeRegistrations(lookup func(jetstream.KeyValue) ([]registry.ServiceRegistration, error), buckets ...jetstream.KeyValue) ([]registry.ServiceRegistration, error) {
+	var all []registry.ServiceRegistration
+	for _, kv := range buckets {
+		regs, err := lookup(kv)
+		if err != nil && !errors.Is(err, jetstream.ErrNoKeysFound) {
+			return nil, err
+		}
+		all = append(all, regs...)
+	}
+	return all, nil
+}
+
+// RegistrationChangelog returns the field changes of a service (org/repo)
+// over time, oldest first
+func (m *Manager) RegistrationChangelog(ctx context.Context, name string) ([]ChangelogEntry, error) {
 	if m.natsNode == nil {
 		return nil, fmt.Errorf("NATS is disabled")
 	}
-	return GetAllServices(ctx, m.natsNode.KV())
+	kv := m.historyKV
+	if kv == nil { // Lightweight node
+		var err error
+		if kv, err = m.natsNode.ControlJetStream().KeyValue(ctx, HistoryBucket); err != nil {
+			return nil, fmt.Errorf("opening history bucket: %w", err)
+		}
+	}
+	return RegistrationChangelog(ctx, kv, name)
 }
 
 // OnRotate subscribes to secret rotation notifications
@@ -338,7 +1525,29 @@ func (m *Manager) OnRotate(fn func(path string)) (*nats.Subscription, error) {
 	if m.natsNode == nil {
 		return nil, fmt.Errorf("NATS is disabled")
 	}
-	return OnRotate(m.natsNode.Conn(), fn)
+	return OnRotate(m.natsNode.ControlConn(), fn)
+}
+
+// ConfigSources reports which source supplied each config field
+// (nil until Parse has succeeded)
+func (m *Manager) ConfigSources() []FieldSource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sources
+}
+
+// Usage returns the usage tracker (nil if usage tracking is disabled)
+func (m *Manager) Usage() *UsageTracker {
+	return m.usage
+}
+
+// CalloutToken returns the token clients of this instance connect with
+// to a hub in callout mode (see RegistryAuthorizer; empty if not registered)
+func (m *Manager) CalloutToken() string {
+	if m.registrar == nil {
+		return ""
+	}
+	return m.registrar.CalloutToken()
 }
 
 // Registration returns the current service registration (nil if not registered)
@@ -0,0 +1,261 @@
+// metrics.go: Prometheus metrics endpoint for SDK internals
+//
+// Enable with env.WithMetrics(":9100") (or METRICS_ADDR). Exposes /metrics in
+// the Prometheus text format with:
+//
+//	wellnown_nats_*                         - per-connection NATS stats (data/control lanes)
+//	wellnown_nats_slow_consumers_total      - subscriptions that fell behind and dropped messages
+//	wellnown_heartbeat_total{result}        - registration heartbeat successes/failures
+//	wellnown_secret_resolutions_total{result} - ref+ secrets resolved/failed/cached/fallback
+//	wellnown_config_parse_duration_seconds  - Parse() duration (summary)
+//	wellnown_registrations_rejected_total{reason} - registry entries that failed to decode
+//	wellnown_power_profile{profile}         - 1 for the current power profile
+//	wellnown_startup_seconds                - New to the end of the first Parse
+//	wellnown_startup_phase_seconds{phase}   - Duration of each startup phase (see startup.go)
+//
+// Counters are always collected (they are cheap atomics); the option only
+// controls whether the HTTP endpoint is served. In the low-power profile
+// only wellnown_power_profile is served (see power.go). The metrics server also
+// serves /healthz and /readyz (see health.go).
+package env
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// sdkMetrics holds process-wide SDK counters
+type sdkMetrics struct {
+	heartbeatOK     atomic.Uint64
+	heartbeatFail   atomic.Uint64
+	secretsResolved atomic.Uint64
+	secretsFailed   atomic.Uint64
+	secretsCached   atomic.Uint64 // Served from the TTL or offline secret cache
+	secretsFallback atomic.Uint64 // Failed, served a previous value (fallback-cached)
+	parseCount      atomic.Uint64
+	parseNanos      atomic.Int64 // Sum of all parse durations
+	lastParseNanos  atomic.Int64
+	regsTooLarge    atomic.Uint64 // Registrations over registry.MaxPayloadSize
+	regsMalformed   atomic.Uint64 // Registrations that failed strict decoding
+	writeRetries    atomic.Uint64 // JetStream write attempts retried by a WritePolicy
+	writeTimeout    atomic.Uint64 // Failed JetStream writes, by class
+	writeUnavail    atomic.Uint64
+	writeRejected   atomic.Uint64
+	writeCanceled   atomic.Uint64
+	exportSent      atomic.Uint64 // Events delivered to export sinks
+	exportFailed    atomic.Uint64 // Events dropped after failed rendering or delivery
+	exportDropped   atomic.Uint64 // Events dropped because a route queue was full
+	kvOverwritten   atomic.Uint64 // KV write conflicts, by resolution
+	kvMerged        atomic.Uint64
+	kvQueued        atomic.Uint64
+	slowConsumers   atomic.Uint64 // Subscriptions reported slow (see slowconsumer.go)
+}
+
+var metrics sdkMetrics
+
+// observeParse records a Parse() duration
+func (s *sdkMetrics) observeParse(d time.Duration) {
+	s.parseCount.Add(1)
+	s.parseNanos.Add(int64(d))
+	s.lastParseNanos.Store(int64(d))
+}
+
+// observeWriteFailure counts a failed JetStream write by its class
+func (s *sdkMetrics) observeWriteFailure(class error) {
+	switch class {
+	case ErrWriteTimeout:
+		s.writeTimeout.Add(1)
+	case ErrWriteUnavailable:
+		s.writeUnavail.Add(1)
+	case ErrWriteRejected:
+		s.writeRejected.Add(1)
+	default:
+		s.writeCanceled.Add(1)
+	}
+}
+
+// observeConflict counts a resolved KV write conflict by its action
+func (s *sdkMetrics) observeConflict(action ConflictAction) {
+	switch action {
+	case ConflictOverwrite:
+		s.kvOverwritten.Add(1)
+	case ConflictMerge:
+		s.kvMerged.Add(1)
+	case ConflictQueue:
+		s.kvQueued.Add(1)
+	}
+}
+
+// MetricsHandler returns an http.Handler serving the SDK metrics
+func (m *Manager) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		profile := m.PowerProfile()
+		writeHeader(w, "wellnown_power_profile", "Current power profile.", "gauge")
+		fmt.Fprintf(w, "wellnown_power_profile{profile=%q} 1\n", profile)
+		if profile == PowerLow {
+			return
+		}
+		conns := map[string]*nats.Conn{}
+		if m.natsNode != nil {
+			conns["data"] = m.natsNode.Conn()
+			conns["control"] = m.natsNode.ControlConn()
+		}
+		writeMetrics(w, conns)
+		writeStartupMetrics(w, m.StartupReport())
+	})
+}
+
+// startMetricsServer serves /metrics on addr in the background. The
+// listener is bound before it returns, so a taken port is an error.
+func (m *Manager) startMetricsServer(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics endpoint: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.MetricsHandler())
+	mux.Handle("/healthz", m.health.Handler())
+	mux.Handle("/readyz", m.health.Handler())
+
+	srv := &http.Server{
+		Addr:              ln.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	m.metricsSrv = srv
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			componentLogger(m.opts.Logger, "metrics").Error("metrics server failed", "addr", addr, "error", err)
+		}
+	}()
+	return nil
+}
+
+// stopMetricsServer shuts down the metrics endpoint
+func (m *Manager) stopMetricsServer() {
+	if m.metricsSrv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.metricsSrv.Shutdown(ctx); err != nil {
+		componentLogger(m.opts.Logger, "metrics").Warn("metrics server shutdown failed", "error", err)
+	}
+}
+
+// writeMetrics renders all metrics in the Prometheus text format
+func writeMetrics(w io.Writer, conns map[string]*nats.Conn) {
+	lanes := make([]string, 0, len(conns))
+	for lane, nc := range conns {
+		if nc != nil {
+			lanes = append(lanes, lane)
+		}
+	}
+	sort.Strings(lanes)
+
+	// NATS connection stats, one series per lane
+	natsCounter := func(name, help string, value func(nats.Statistics) uint64) {
+		writeHeader(w, name, help, "counter")
+		for _, lane := range lanes {
+			fmt.Fprintf(w, "%s{conn=%q} %d\n", name, lane, value(conns[lane].Stats()))
+		}
+	}
+	natsCounter("wellnown_nats_in_msgs_total", "Messages received by the NATS connection.",
+		func(s nats.Statistics) uint64 { return s.InMsgs })
+	natsCounter("wellnown_nats_out_msgs_total", "Messages sent by the NATS connection.",
+		func(s nats.Statistics) uint64 { return s.OutMsgs })
+	natsCounter("wellnown_nats_in_bytes_total", "Bytes received by the NATS connection.",
+		func(s nats.Statistics) uint64 { return s.InBytes })
+	natsCounter("wellnown_nats_out_bytes_total", "Bytes sent by the NATS connection.",
+		func(s nats.Statistics) uint64 { return s.OutBytes })
+	natsCounter("wellnown_nats_reconnects_total", "Reconnects of the NATS connection.",
+		func(s nats.Statistics) uint64 { return s.Reconnects })
+
+	writeHeader(w, "wellnown_nats_connected", "Whether the NATS connection is connected (1) or not (0).", "gauge")
+	for _, lane := range lanes {
+		connected := 0
+		if conns[lane].IsConnected() {
+			connected = 1
+		}
+		fmt.Fprintf(w, "wellnown_nats_connected{conn=%q} %d\n", lane, connected)
+	}
+
+	writeHeader(w, "wellnown_nats_slow_consumers_total", "Subscriptions that fell behind and dropped messages.", "counter")
+	fmt.Fprintf(w, "wellnown_nats_slow_consumers_total %d\n", metrics.slowConsumers.Load())
+
+	// Registration heartbeats
+	writeHeader(w, "wellnown_heartbeat_total", "Registration heartbeats by result.", "counter")
+	fmt.Fprintf(w, "wellnown_heartbeat_total{result=\"success\"} %d\n", metrics.heartbeatOK.Load())
+	fmt.Fprintf(w, "wellnown_heartbeat_total{result=\"failure\"} %d\n", metrics.heartbeatFail.Load())
+
+	// Secret resolution
+	writeHeader(w, "wellnown_secret_resolutions_total", "ref+ secret resolutions by result.", "counter")
+	fmt.Fprintf(w, "wellnown_secret_resolutions_total{result=\"success\"} %d\n", metrics.secretsResolved.Load())
+	fmt.Fprintf(w, "wellnown_secret_resolutions_total{result=\"failure\"} %d\n", metrics.secretsFailed.Load())
+	fmt.Fprintf(w, "wellnown_secret_resolutions_total{result=\"cached\"} %d\n", metrics.secretsCached.Load())
+	fmt.Fprintf(w, "wellnown_secret_resolutions_total{result=\"fallback\"} %d\n", metrics.secretsFallback.Load())
+
+	// Rejected registry entries
+	writeHeader(w, "wellnown_registrations_rejected_total", "Registry entries rejected while decoding, by reason.", "counter")
+	fmt.Fprintf(w, "wellnown_registrations_rejected_total{reason=\"too_large\"} %d\n", metrics.regsTooLarge.Load())
+	fmt.Fprintf(w, "wellnown_registrations_rejected_total{reason=\"malformed\"} %d\n", metrics.regsMalformed.Load())
+
+	// JetStream writes (registrar, KVBucket, outbox)
+	writeHeader(w, "wellnown_jetstream_write_retries_total", "JetStream write attempts retried after a transient failure.", "counter")
+	fmt.Fprintf(w, "wellnown_jetstream_write_retries_total %d\n", metrics.writeRetries.Load())
+	writeHeader(w, "wellnown_jetstream_write_failures_total", "JetStream writes that failed after all attempts, by class.", "counter")
+	fmt.Fprintf(w, "wellnown_jetstream_write_failures_total{class=\"timeout\"} %d\n", metrics.writeTimeout.Load())
+	fmt.Fprintf(w, "wellnown_jetstream_write_failures_total{class=\"unavailable\"} %d\n", metrics.writeUnavail.Load())
+	fmt.Fprintf(w, "wellnown_jetstream_write_failures_total{class=\"rejected\"} %d\n", metrics.writeRejected.Load())
+	fmt.Fprintf(w, "wellnown_jetstream_write_failures_total{class=\"canceled\"} %d\n", metrics.writeCanceled.Load())
+
+	// Export routes
+	writeHeader(w, "wellnown_export_events_total", "Events handled by export routes, by result.", "counter")
+	fmt.Fprintf(w, "wellnown_export_events_total{result=\"sent\"} %d\n", metrics.exportSent.Load())
+	fmt.Fprintf(w, "wellnown_export_events_total{result=\"failed\"} %d\n", metrics.exportFailed.Load())
+	fmt.Fprintf(w, "wellnown_export_events_total{result=\"dropped\"} %d\n", metrics.exportDropped.Load())
+
+	// KV write conflicts (KVBucket.Update)
+	writeHeader(w, "wellnown_kv_conflicts_total", "KV write conflicts resolved, by action.", "counter")
+	fmt.Fprintf(w, "wellnown_kv_conflicts_total{action=\"overwrite\"} %d\n", metrics.kvOverwritten.Load())
+	fmt.Fprintf(w, "wellnown_kv_conflicts_total{action=\"merge\"} %d\n", metrics.kvMerged.Load())
+	fmt.Fprintf(w, "wellnown_kv_conflicts_total{action=\"queue\"} %d\n", metrics.kvQueued.Load())
+
+	// Config parse durations
+	writeHeader(w, "wellnown_config_parse_duration_seconds", "Duration of Manager.Parse calls.", "summary")
+	fmt.Fprintf(w, "wellnown_config_parse_duration_seconds_sum %g\n", time.Duration(metrics.parseNanos.Load()).Seconds())
+	fmt.Fprintf(w, "wellnown_config_parse_duration_seconds_count %d\n", metrics.parseCount.Load())
+
+	writeHeader(w, "wellnown_config_parse_last_seconds", "Duration of the most recent Manager.Parse call.", "gauge")
+	fmt.Fprintf(w, "wellnown_config_parse_last_seconds %g\n", time.Duration(metrics.lastParseNanos.Load()).Seconds())
+}
+
+// writeStartupMetrics renders the startup timing breakdown, once startup
+// is done
+func writeStartupMetrics(w io.Writer, r StartupReport) {
+	if r.Total == 0 {
+		return
+	}
+	writeHeader(w, "wellnown_startup_seconds", "Time from New to the end of the first Manager.Parse call.", "gauge")
+	fmt.Fprintf(w, "wellnown_startup_seconds %g\n", r.Total.Seconds())
+	writeHeader(w, "wellnown_startup_phase_seconds", "Duration of each startup phase.", "gauge")
+	for _, p := range r.Phases {
+		fmt.Fprintf(w, "wellnown_startup_phase_seconds{phase=%q} %g\n", p.Name, p.Duration.Seconds())
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines for a metric
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
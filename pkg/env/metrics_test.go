@@ -0,0 +1,133 @@
+package env
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics fetches /metrics and returns the declared type of each
+// metric and the label sets of its samples
+func scrapeMetrics(t *testing.T, url string) (types map[string]string, samples map[string][]string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("GET %s = %d: %s", url, resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+
+	types = make(map[string]string)
+	samples = make(map[string][]string)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, typ, _ := strings.Cut(rest, " ")
+			types[name] = typ
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		series, _, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Errorf("sample without a value: %q", line)
+			continue
+		}
+		name, labels, _ := strings.Cut(series, "{")
+		labels = strings.TrimSuffix(labels, "}")
+		if _, declared := types[name]; !declared {
+			// Summaries report name_sum and name_count
+			base := strings.TrimSuffix(strings.TrimSuffix(name, "_sum"), "_count")
+			if types[base] != "summary" {
+				t.Errorf("sample %q has no TYPE line before it", line)
+			}
+			name = base
+		}
+		samples[name] = append(samples[name], labels)
+	}
+	return types, samples
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Setenv("NATS_NO_TCP", "true")
+	m, err := New("METRICS", WithoutGUI(), WithoutHeartbeat(), WithoutRegistration(), WithMetrics("127.0.0.1:0"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+
+	types, samples := scrapeMetrics(t, "http://"+m.metricsSrv.Addr+"/metrics")
+
+	wantTypes := map[string]string{
+		"wellnown_power_profile":                  "gauge",
+		"wellnown_nats_in_msgs_total":             "counter",
+		"wellnown_nats_connected":                 "gauge",
+		"wellnown_nats_slow_consumers_total":      "counter",
+		"wellnown_heartbeat_total":                "counter",
+		"wellnown_secret_resolutions_total":       "counter",
+		"wellnown_registrations_rejected_total":   "counter",
+		"wellnown_jetstream_write_failures_total": "counter",
+		"wellnown_kv_conflicts_total":             "counter",
+		"wellnown_config_parse_duration_seconds":  "summary",
+		"wellnown_config_parse_last_seconds":      "gauge",
+	}
+	for name, want := range wantTypes {
+		if got := types[name]; got != want {
+			t.Errorf("TYPE of %s = %q, want %q", name, got, want)
+		}
+	}
+
+	wantLabels := map[string][]string{
+		"wellnown_power_profile":   {`profile="normal"`},
+		"wellnown_nats_connected":  {`conn="control"`, `conn="data"`},
+		"wellnown_heartbeat_total": {`result="success"`, `result="failure"`},
+		"wellnown_registrations_rejected_total": {
+			`reason="too_large"`, `reason="malformed"`,
+		},
+		"wellnown_config_parse_duration_seconds": {"", ""}, // _sum and _count
+	}
+	for name, want := range wantLabels {
+		if got := strings.Join(samples[name], " "); got != strings.Join(want, " ") {
+			t.Errorf("labels of %s = [%s], want [%s]", name, got, strings.Join(want, " "))
+		}
+	}
+
+	// The metrics server also answers health probes
+	resp, err := http.Get("http://" + m.metricsSrv.Addr + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestMetricsPortTaken(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	m, err := New("METRICS", WithoutNATS(), WithMetrics(ln.Addr().String()))
+	if err == nil {
+		m.Close()
+		t.Fatal("New() with a taken metrics port succeeded")
+	}
+	if !strings.Contains(err.Error(), "metrics endpoint") {
+		t.Errorf("New() error = %v, want the metrics endpoint named", err)
+	}
+}
@@ -0,0 +1,186 @@
+// microstats.go: Request stats of NATS micro services
+//
+// Services built with micro.AddService answer $SRV.STATS with request
+// counts and processing times per endpoint. The SDK reads them two ways,
+// with no instrumentation in the handlers:
+//
+// Per instance, in the registry: tracked services are read locally on
+// every heartbeat and sent in the registration's runtime stats.
+//
+//	svc, err := micro.AddService(mgr.NC(), micro.Config{Name: "billing", Version: "1.0.0"})
+//	mgr.TrackMicroService(svc)
+//
+// Mesh-wide, for dashboards: MicroStats asks every micro service on the
+// mesh and merges the answers per endpoint, whoever runs them.
+//
+//	stats, err := mgr.MicroStats(ctx)
+//	for _, e := range stats {
+//	    fmt.Printf("%s/%s: %d requests, %s avg\n", e.Service, e.Endpoint, e.Requests, e.AverageTime)
+//	}
+//
+// RegisterMicroPage (gui.go) shows them at /micro, next to the services
+// that declare the micro service in their capabilities.
+package env
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// DefaultMicroStatsWindow is how long MicroStats waits for answers
+const DefaultMicroStatsWindow = 500 * time.Millisecond
+
+// maxMicroStatsReplies bounds the answers buffered while collecting
+const maxMicroStatsReplies = 1024
+
+// TrackMicroService sends the endpoint stats of svc with every heartbeat.
+// Declare its name in the capabilities (WithCapabilities) too, so
+// dashboards can tell which service runs it.
+func (m *Manager) TrackMicroService(svc micro.Service) {
+	m.runtime.trackMicro(svc)
+}
+
+// MicroStats collects $SRV.STATS from every micro service on the mesh,
+// for DefaultMicroStatsWindow, and merges them per service and endpoint
+func (m *Manager) MicroStats(ctx context.Context) ([]registry.EndpointStats, error) {
+	nc := m.NC()
+	if nc == nil {
+		return nil, fmt.Errorf("collecting micro stats: NATS is disabled")
+	}
+	stats, err := CollectMicroStats(ctx, nc, DefaultMicroStatsWindow)
+	if err != nil {
+		return nil, err
+	}
+	return MergeMicroStats(stats), nil
+}
+
+// CollectMicroStats asks every micro service for its stats and returns
+// the answers that arrive within window
+func CollectMicroStats(ctx context.Context, nc *nats.Conn, window time.Duration) ([]micro.Stats, error) {
+	subject, err := micro.ControlSubject(micro.StatsVerb, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("collecting micro stats: %w", err)
+	}
+
+	inbox := nc.NewInbox()
+	replies := make(chan *nats.Msg, maxMicroStatsReplies)
+	sub, err := nc.ChanSubscribe(inbox, replies)
+	if err != nil {
+		return nil, fmt.Errorf("collecting micro stats: %w", err)
+	}
+	defer sub.Unsubscribe()
+	if err := nc.PublishRequest(subject, inbox, nil); err != nil {
+		return nil, fmt.Errorf("collecting micro stats: %w", err)
+	}
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	var stats []micro.Stats
+	for {
+		select {
+		case msg := <-replies:
+			var s micro.Stats
+			if err := json.Unmarshal(msg.Data, &s); err != nil {
+				continue // Not a micro service answer
+			}
+			stats = append(stats, s)
+		case <-timer.C:
+			return stats, nil
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		}
+	}
+}
+
+// microEndpoints returns the endpoint stats of one micro service instance
+func microEndpoints(s micro.Stats) []registry.EndpointStats {
+	out := make([]registry.EndpointStats, 0, len(s.Endpoints))
+	for _, e := range s.Endpoints {
+		if e == nil {
+			continue
+		}
+		out = append(out, registry.EndpointStats{
+			Service:     s.Name,
+			Endpoint:    e.Name,
+			Subject:     e.Subject,
+			Requests:    e.NumRequests,
+			Errors:      e.NumErrors,
+			AverageTime: e.AverageProcessingTime,
+			LastError:   e.LastError,
+		})
+	}
+	return out
+}
+
+// MergeMicroStats merges the stats of micro service instances per service
+// and endpoint: counts add up, the average is over all requests, and the
+// last error is that of the most recently started instance reporting one.
+// Sorted by service and endpoint.
+func MergeMicroStats(stats []micro.Stats) []registry.EndpointStats {
+	type key struct{ service, endpoint string }
+	merged := make(map[key]*registry.EndpointStats)
+	total := make(map[key]time.Duration) // Processing time over all requests
+	started := make(map[key]time.Time)   // Start of the instance that set LastError
+
+	for _, s := range stats {
+		for _, e := range s.Endpoints {
+			if e == nil {
+				continue
+			}
+			k := key{s.Name, e.Name}
+			m, ok := merged[k]
+			if !ok {
+				m = &registry.EndpointStats{Service: s.Name, Endpoint: e.Name, Subject: e.Subject}
+				merged[k] = m
+			}
+			m.Instances++
+			m.Requests += e.NumRequests
+			m.Errors += e.NumErrors
+			total[k] += e.ProcessingTime
+			if e.LastError != "" && !s.Started.Before(started[k]) {
+				m.LastError, started[k] = e.LastError, s.Started
+			}
+		}
+	}
+
+	out := make([]registry.EndpointStats, 0, len(merged))
+	for k, m := range merged {
+		if m.Requests > 0 {
+			m.AverageTime = total[k] / time.Duration(m.Requests)
+		}
+		out = append(out, *m)
+	}
+	slices.SortFunc(out, func(a, b registry.EndpointStats) int {
+		return cmp.Or(cmp.Compare(a.Service, b.Service), cmp.Compare(a.Endpoint, b.Endpoint))
+	})
+	return out
+}
+
+// microProviders maps micro service names to the services (org/repo)
+// declaring them in their capabilities
+func microProviders(regs []registry.ServiceRegistration) map[string][]string {
+	providers := make(map[string][]string)
+	for _, reg := range regs {
+		name := reg.GitHub.Name()
+		if name == "" {
+			continue
+		}
+		for _, svc := range reg.Capabilities.Micro {
+			if !slices.Contains(providers[svc], name) {
+				providers[svc] = append(providers[svc], name)
+			}
+		}
+	}
+	for svc := range providers {
+		slices.Sort(providers[svc])
+	}
+	return providers
+}
@@ -0,0 +1,83 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/micro"
+)
+
+func TestMergeMicroStats(t *testing.T) {
+	t0 := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	stats := []micro.Stats{
+		{
+			ServiceIdentity: micro.ServiceIdentity{Name: "billing", ID: "a"},
+			Started:         t0,
+			Endpoints: []*micro.EndpointStats{
+				{Name: "charge", Subject: "billing.charge", NumRequests: 10, NumErrors: 1, ProcessingTime: 10 * time.Millisecond, LastError: "card declined"},
+				{Name: "refund", Subject: "billing.refund", NumRequests: 0},
+			},
+		},
+		{
+			ServiceIdentity: micro.ServiceIdentity{Name: "billing", ID: "b"},
+			Started:         t0.Add(time.Hour),
+			Endpoints: []*micro.EndpointStats{
+				{Name: "charge", Subject: "billing.charge", NumRequests: 30, NumErrors: 2, ProcessingTime: 50 * time.Millisecond, LastError: "timeout"},
+			},
+		},
+		{
+			ServiceIdentity: micro.ServiceIdentity{Name: "auth", ID: "c"},
+			Endpoints:       []*micro.EndpointStats{{Name: "login", Subject: "auth.login", NumRequests: 4, ProcessingTime: 4 * time.Millisecond}, nil},
+		},
+	}
+
+	want := []registry.EndpointStats{
+		{Service: "auth", Endpoint: "login", Subject: "auth.login", Instances: 1, Requests: 4, AverageTime: time.Millisecond},
+		{Service: "billing", Endpoint: "charge", Subject: "billing.charge", Instances: 2, Requests: 40, Errors: 3,
+			AverageTime: 1500 * time.Microsecond, LastError: "timeout"},
+		{Service: "billing", Endpoint: "refund", Subject: "billing.refund", Instances: 1},
+	}
+	if got := MergeMicroStats(stats); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeMicroStats() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestMicroEndpoints(t *testing.T) {
+	s := micro.Stats{
+		ServiceIdentity: micro.ServiceIdentity{Name: "billing"},
+		Endpoints: []*micro.EndpointStats{
+			{Name: "charge", Subject: "billing.charge", NumRequests: 10, NumErrors: 1, AverageProcessingTime: time.Millisecond},
+		},
+	}
+	want := []registry.EndpointStats{
+		{Service: "billing", Endpoint: "charge", Subject: "billing.charge", Requests: 10, Errors: 1, AverageTime: time.Millisecond},
+	}
+	if got := microEndpoints(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("microEndpoints() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMicroProviders(t *testing.T) {
+	reg := func(org, repo string, micro ...string) registry.ServiceRegistration {
+		return registry.ServiceRegistration{
+			GitHub:       registry.GitHubInfo{Org: org, Repo: repo},
+			Capabilities: registry.Capabilities{Micro: micro},
+		}
+	}
+	regs := []registry.ServiceRegistration{
+		reg("acme", "payments", "billing"),
+		reg("acme", "payments", "billing"), // Second instance
+		reg("acme", "checkout", "billing", "cart"),
+		reg("", "", "orphan"), // Dev build without ldflags
+	}
+
+	want := map[string][]string{
+		"billing": {"acme/checkout", "acme/payments"},
+		"cart":    {"acme/checkout"},
+	}
+	if got := microProviders(regs); !reflect.DeepEqual(got, want) {
+		t.Errorf("microProviders() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+// monitor.go: Embedded NATS server monitoring
+//
+// WithMonitoring(":8222") (or NATS_MONITOR_ADDR) serves the standard NATS
+// HTTP monitoring endpoints (/varz, /connz, /leafz, /jsz, ...) from the
+// embedded server, so curl, nats-top and Prometheus exporters work against
+// it. ServerStats reads the same data in-process and works with the port
+// disabled:
+//
+//	stats, _ := mgr.ServerStats()
+//	for _, leaf := range stats.Leafnodes { ... }
+//
+// RegisterServerPage (gui.go) renders it at /server, which is usually
+// enough to debug a leaf that won't talk to its hub.
+package env
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// serverStatsClients caps the client connections listed in ServerStats
+const serverStatsClients = 50
+
+// ServerStats is a snapshot of the embedded NATS server
+type ServerStats struct {
+	Name       string    `json:"name"`
+	Version    string    `json:"version"`
+	Start      time.Time `json:"start"`
+	Uptime     string    `json:"uptime"`
+	MonitorURL string    `json:"monitor_url,omitempty"` // Empty if the HTTP port is disabled
+
+	Mem              int64   `json:"mem"` // Resident memory, bytes
+	CPU              float64 `json:"cpu"` // Percent
+	Connections      int     `json:"connections"`
+	TotalConnections uint64  `json:"total_connections"`
+	Subscriptions    uint32  `json:"subscriptions"`
+	SlowConsumers    int64   `json:"slow_consumers"`
+	InMsgs           int64   `json:"in_msgs"`
+	OutMsgs          int64   `json:"out_msgs"`
+	InBytes          int64   `json:"in_bytes"`
+	OutBytes         int64   `json:"out_bytes"`
+
+	Leafnodes []LeafStats       `json:"leafnodes"`
+	Clients   []ClientStats     `json:"clients"` // Busiest first (most pending bytes), capped
+	JetStream *JetStreamSummary `json:"jetstream,omitempty"`
+}
+
+// LeafStats is one leafnode link (to the hub, or from a leaf on a hub)
+type LeafStats struct {
+	Name          string `json:"name"`
+	Account       string `json:"account"`
+	Addr          string `json:"addr"`
+	RTT           string `json:"rtt,omitempty"`
+	InMsgs        int64  `json:"in_msgs"`
+	OutMsgs       int64  `json:"out_msgs"`
+	Subscriptions uint32 `json:"subscriptions"`
+}
+
+// ClientStats is one client connection
+type ClientStats struct {
+	CID           uint64 `json:"cid"`
+	Name          string `json:"name,omitempty"`
+	Account       string `json:"account,omitempty"`
+	Addr          string `json:"addr"`
+	Lang          string `json:"lang,omitempty"`
+	RTT           string `json:"rtt,omitempty"`
+	Pending       int    `json:"pending_bytes"`
+	InMsgs        int64  `json:"in_msgs"`
+	OutMsgs       int64  `json:"out_msgs"`
+	Subscriptions uint32 `json:"subscriptions"`
+}
+
+// JetStreamSummary is the server-wide JetStream usage
+type JetStreamSummary struct {
+	Streams   int    `json:"streams"`
+	Consumers int    `json:"consumers"`
+	Messages  uint64 `json:"messages"`
+	Bytes     uint64 `json:"bytes"`
+	Memory    uint64 `json:"memory"`  // Memory storage used
+	Storage   uint64 `json:"storage"` // File storage used
+}
+
+// MonitorURL returns the HTTP monitoring base URL (empty if disabled or
+// shared)
+func (n *NATSNode) MonitorURL() string {
+	if n.Shared() {
+		return ""
+	}
+	addr := n.server.MonitorAddr()
+	if addr == nil {
+		return ""
+	}
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+// Stats collects varz, leafz, connz and jsz from the embedded server
+// (ErrSharedNode when the server belongs to another process)
+func (n *NATSNode) Stats() (*ServerStats, error) {
+	if n.Shared() {
+		return nil, ErrSharedNode
+	}
+	varz, err := n.server.Varz(nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading varz: %w", err)
+	}
+	stats := &ServerStats{
+		Name:             varz.Name,
+		Version:          varz.Version,
+		Start:            varz.Start,
+		Uptime:           varz.Uptime,
+		MonitorURL:       n.MonitorURL(),
+		Mem:              varz.Mem,
+		CPU:              varz.CPU,
+		Connections:      varz.Connections,
+		TotalConnections: varz.TotalConnections,
+		Subscriptions:    varz.Subscriptions,
+		SlowConsumers:    varz.SlowConsumers,
+		InMsgs:           varz.InMsgs,
+		OutMsgs:          varz.OutMsgs,
+		InBytes:          varz.InBytes,
+		OutBytes:         varz.OutBytes,
+	}
+
+	leafz, err := n.server.Leafz(nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading leafz: %w", err)
+	}
+	for _, l := range leafz.Leafs {
+		stats.Leafnodes = append(stats.Leafnodes, LeafStats{
+			Name:          l.Name,
+			Account:       l.Account,
+			Addr:          net.JoinHostPort(l.IP, strconv.Itoa(l.Port)),
+			RTT:           l.RTT,
+			InMsgs:        l.InMsgs,
+			OutMsgs:       l.OutMsgs,
+			Subscriptions: l.NumSubs,
+		})
+	}
+
+	connz, err := n.server.Connz(&server.ConnzOptions{Sort: server.ByPending, Limit: serverStatsClients})
+	if err != nil {
+		return nil, fmt.Errorf("reading connz: %w", err)
+	}
+	for _, c := range connz.Conns {
+		stats.Clients = append(stats.Clients, ClientStats{
+			CID:           c.Cid,
+			Name:          c.Name,
+			Account:       c.Account,
+			Addr:          net.JoinHostPort(c.IP, strconv.Itoa(c.Port)),
+			Lang:          c.Lang,
+			RTT:           c.RTT,
+			Pending:       c.Pending,
+			InMsgs:        c.InMsgs,
+			OutMsgs:       c.OutMsgs,
+			Subscriptions: c.NumSubs,
+		})
+	}
+
+	jsz, err := n.server.Jsz(nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading jsz: %w", err)
+	}
+	if !jsz.Disabled {
+		stats.JetStream = &JetStreamSummary{
+			Streams:   jsz.Streams,
+			Consumers: jsz.Consumers,
+			Messages:  jsz.Messages,
+			Bytes:     jsz.Bytes,
+			Memory:    jsz.Memory,
+			Storage:   jsz.Store,
+		}
+	}
+
+	return stats, nil
+}
+
+// ServerStats returns a snapshot of the embedded NATS server
+func (m *Manager) ServerStats() (*ServerStats, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	return m.natsNode.Stats()
+}
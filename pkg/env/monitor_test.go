@@ -0,0 +1,67 @@
+package env
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMonitoring(t *testing.T) {
+	t.Setenv("NATS_NO_TCP", "true")
+	m, err := New("MONITOR", WithoutGUI(), WithoutHeartbeat(), WithoutRegistration(), WithMonitoring("127.0.0.1:0"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+
+	url := m.natsNode.MonitorURL()
+	if url == "" {
+		t.Fatal("MonitorURL() is empty with monitoring enabled")
+	}
+
+	resp, err := http.Get(url + "/varz")
+	if err != nil {
+		t.Fatalf("GET %s/varz: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /varz = %d, want 200", resp.StatusCode)
+	}
+	var varz struct {
+		ServerName  string `json:"server_name"`
+		Connections int    `json:"connections"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&varz); err != nil {
+		t.Fatalf("decoding /varz: %v", err)
+	}
+	if varz.Connections == 0 {
+		t.Error("/varz reports no connections, want the node's own")
+	}
+
+	// In-process stats: the node's data and control connections
+	node, err := m.natsNode.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	stats, err := m.ServerStats()
+	if err != nil {
+		t.Fatalf("ServerStats() error = %v", err)
+	}
+	for name, s := range map[string]*ServerStats{"Stats": node, "ServerStats": stats} {
+		if s.Connections < 2 || s.TotalConnections < 2 {
+			t.Errorf("%s() connections = %d (total %d), want at least 2", name, s.Connections, s.TotalConnections)
+		}
+		if len(s.Clients) != s.Connections {
+			t.Errorf("%s() lists %d clients, want %d", name, len(s.Clients), s.Connections)
+		}
+		if s.MonitorURL != url {
+			t.Errorf("%s() MonitorURL = %q, want %q", name, s.MonitorURL, url)
+		}
+		if s.JetStream == nil {
+			t.Errorf("%s() has no JetStream summary", name)
+		}
+	}
+	if varz.ServerName != stats.Name {
+		t.Errorf("/varz server_name = %q, ServerStats() name = %q", varz.ServerName, stats.Name)
+	}
+}
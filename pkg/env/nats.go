@@ -10,20 +10,54 @@
 //
 //	STANDALONE: Service runs its own NATS (dev mode, no hub)
 //	LEAF:       Service connects to a hub cluster (production)
+//	CLUSTER:    Hubs route to each other and replicate JetStream (HA hub)
+//
+// Leaves list every hub in HubURL ("nats://hub-1:5222,nats://hub-2:5222")
+// and fail over between them.
+//
+// JetStream domains (Domain, HubDomain) keep a leaf's streams apart from
+// the hub's; see jsdomain.go.
+//
+// Same-host clients can use a unix socket (Socket), and NoTCP closes the
+// client port entirely; see unixsocket.go.
+//
+// Lightweight nodes (Lightweight) run core NATS only: no local JetStream,
+// and the registry bucket is opened on the first KV call instead of at
+// startup. Short-lived commands like wellknown-check start in a fraction
+// of the time and still reach the hub's JetStream over the leaf link.
+//
+// MQTT: sensors that only speak MQTT publish into the node (MQTT.Port).
+// Topic "sensors/t1" arrives as subject "sensors.t1" and reaches the hub
+// over the leaf link like any other message.
 //
 // The embedded NATS provides:
 // - JetStream for persistence and KV
 // - Service registry via KV bucket
 // - Event streaming via subjects
+//
+// Priority lanes: the node opens two client connections. The control
+// connection carries registry heartbeats and commands; the data connection
+// carries application publishing. Each has its own socket and write
+// buffer, so heavy data traffic can't delay a heartbeat past the KV TTL.
 package env
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
@@ -33,17 +67,160 @@ import (
 type NATSConfig struct {
 	Name    string // Server name
 	Port    int    // Client port (0 = random)
-	HubURL  string // Hub URL for leaf mode (empty = standalone)
+	HubURL  string // Hub URLs for leaf mode, comma-separated (empty = standalone)
 	DataDir string // Data directory (empty = in-memory)
+
+	WebSocketAddr string // WebSocket listen address for browser clients (empty = disabled)
+	MonitorAddr   string // HTTP monitoring listen address (/varz, /connz, ...; empty = disabled)
+
+	Socket string // Unix socket path for same-host clients (empty = none)
+	NoTCP  bool   // Open no TCP client port (local clients use Socket)
+
+	Reconnect ReconnectPolicy // Leaf link and client reconnect behaviour
+
+	ClientName    string        // Name prefix of the node's connections in connz (empty = Name)
+	ClientOptions []nats.Option // Extra nats.go options for the node's connections, applied last
+
+	Cluster ClusterConfig // Hub cluster membership (zero = not clustered)
+
+	Domain    string // JetStream domain of this node (empty = shared default domain)
+	HubDomain string // Hub's domain; leaves with their own Domain keep the control plane there
+
+	MQTT MQTTConfig // MQTT listener for IoT devices (zero = disabled)
+
+	Lightweight bool // Core NATS only, registry bucket opened on first use (short-lived commands)
+
+	Logger *slog.Logger // Connection event logger (nil = slog.Default)
+
+	OnSlowConsumer func(SlowConsumer) // Called when a subscription falls behind (see slowconsumer.go)
+}
+
+// ClusterConfig makes a hub a member of a NATS cluster. Run three hubs
+// with the same Name, each listing the others in Routes, to replicate the
+// registry and survive losing one.
+type ClusterConfig struct {
+	Name     string   // Cluster name (empty = not clustered)
+	Addr     string   // Route listen address, e.g. ":6222"
+	Routes   []string // Other members, e.g. "nats-route://hub-2:6222"
+	Replicas int      // Registry bucket replicas (0 = members, at most 3)
+}
+
+// Enabled reports whether the node joins a cluster
+func (c ClusterConfig) Enabled() bool {
+	return c.Name != ""
+}
+
+// replicas returns the replica count of the buckets the node creates
+func (c ClusterConfig) replicas() int {
+	switch {
+	case !c.Enabled():
+		return 1
+	case c.Replicas > 0:
+		return c.Replicas
+	default:
+		return min(len(c.Routes)+1, 3)
+	}
+}
+
+// MQTTConfig enables the server's MQTT listener. MQTT sessions and
+// retained messages are kept in the node's JetStream.
+type MQTTConfig struct {
+	Port  int             // MQTT port, e.g. 1883 (0 = disabled)
+	Creds MQTTCredentials // Single user for MQTT clients (empty = the server's auth)
+}
+
+// MQTTCredentials is the username and password MQTT clients connect with
+type MQTTCredentials struct {
+	Username string
+	Password string
+}
+
+// Enabled reports whether the node listens for MQTT
+func (c MQTTConfig) Enabled() bool {
+	return c.Port != 0
+}
+
+// splitDomain reports whether the node is a leaf in its own JetStream
+// domain, apart from the hub
+func (c NATSConfig) splitDomain() bool {
+	return !c.Lightweight && c.HubURL != "" && c.Domain != "" && c.Domain != c.HubDomain
+}
+
+// ReconnectPolicy controls how the node reconnects after losing a link.
+//
+// The embedded server redials the hub every Interval plus a random jitter
+// of up to Interval, forever (the leaf link has no attempt limit). Client
+// connections back off exponentially from Interval to MaxInterval, add up
+// to Jitter, and retry forever unless MaxReconnects limits the attempts.
+type ReconnectPolicy struct {
+	Interval      time.Duration // Base delay between attempts (0 = server/client defaults)
+	MaxInterval   time.Duration // Client backoff cap (0 = no backoff, fixed Interval)
+	Jitter        time.Duration // Random extra client delay (0 = client default)
+	MaxReconnects int           // Client attempts before giving up (0 or -1 = forever)
+}
+
+// delay returns the client backoff delay before the given attempt (1-based),
+// excluding jitter
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	d := p.Interval
+	if d <= 0 {
+		d = nats.DefaultReconnectWait
+	}
+	if p.MaxInterval <= d {
+		return d
+	}
+	for i := 1; i < attempt && d < p.MaxInterval; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxInterval)
+}
+
+// clientOptions returns the nats.go options implementing the policy
+func (p ReconnectPolicy) clientOptions() []nats.Option {
+	maxReconnects := p.MaxReconnects
+	if maxReconnects == 0 {
+		maxReconnects = -1
+	}
+	opts := []nats.Option{nats.MaxReconnects(maxReconnects)}
+	if p.Jitter > 0 {
+		opts = append(opts, nats.ReconnectJitter(p.Jitter, p.Jitter))
+	}
+	if p.MaxInterval > 0 {
+		opts = append(opts, nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			d := p.delay(attempts)
+			if p.Jitter > 0 {
+				d += rand.N(p.Jitter)
+			}
+			return d
+		}))
+	} else if p.Interval > 0 {
+		opts = append(opts, nats.ReconnectWait(p.Interval))
+	}
+	return opts
 }
 
-// NATSNode wraps an embedded NATS server and client connection
+// NATSNode wraps an embedded NATS server (or a shared local one, see
+// sharednode.go) and its client connections
 type NATSNode struct {
-	server *server.Server
-	conn   *nats.Conn
-	js     jetstream.JetStream
-	kv     jetstream.KeyValue
-	config NATSConfig
+	server  *server.Server
+	conn    *nats.Conn          // Data plane
+	js      jetstream.JetStream // Data plane
+	ctrl    *nats.Conn          // Control plane (heartbeats, commands)
+	ctrlJS  jetstream.JetStream // Control plane (the hub's domain on split-domain leaves)
+	localJS jetstream.JetStream // Control connection, this node's domain
+	kv      jetstream.KeyValue  // Bound to the control connection
+	config  NATSConfig
+	shared  bool            // Client of another process's node (see sharednode.go)
+	socket  *socketListener // Unix socket listener (nil = none)
+	wsPort  int             // Bound WebSocket port (0 = listener disabled)
+
+	kvMu sync.Mutex // Guards opening kv on lightweight nodes
+
+	authMu sync.Mutex                  // Serialises auth reloads
+	opts   *server.Options             // Server options, cloned for reloads
+	auth   *atomic.Pointer[AuthConfig] // Current credentials (nil value = no auth)
+
+	inflight inflight // Requests and publishes Drain waits for
 }
 
 // StartNATSNode creates and starts an embedded NATS server
@@ -55,13 +232,15 @@ func StartNATSNode(cfg NATSConfig, authCfg *AuthConfig) (*NATSNode, error) {
 
 	// Configure server options
 	opts := &server.Options{
-		ServerName: cfg.Name,
-		Port:       cfg.Port,
-		JetStream:  true,
-		StoreDir:   cfg.DataDir,
-		NoLog:      true, // Quiet by default, apps can enable logging
-		Debug:      false,
-		Trace:      false,
+		ServerName:      cfg.Name,
+		Port:            cfg.Port,
+		JetStream:       !cfg.Lightweight,
+		StoreDir:        cfg.DataDir,
+		JetStreamDomain: cfg.Domain,
+		DontListen:      cfg.NoTCP, // In-process and unix socket clients only
+		NoLog:           true,      // Quiet by default, apps can enable logging
+		Debug:           false,
+		Trace:           false,
 	}
 
 	// Configure authentication if provided
@@ -71,16 +250,31 @@ func StartNATSNode(cfg NATSConfig, authCfg *AuthConfig) (*NATSNode, error) {
 		}
 	}
 
+	// Without local JetStream there is no domain of our own, nor anywhere
+	// to keep MQTT sessions
+	if cfg.Lightweight {
+		if cfg.MQTT.Enabled() {
+			return nil, fmt.Errorf("MQTT needs JetStream, which lightweight nodes don't run")
+		}
+		opts.JetStreamDomain = ""
+	}
+
+	// A leaf in its own domain reaches the hub's JetStream only by domain
+	if !cfg.Lightweight && cfg.HubURL != "" && cfg.Domain != "" && cfg.HubDomain == "" {
+		return nil, fmt.Errorf("leaf JetStream domain %q needs the hub's domain (NATS_HUB_DOMAIN)", cfg.Domain)
+	}
+
 	// Configure as leaf node if hub URL provided
 	if cfg.HubURL != "" {
-		u, err := url.Parse(cfg.HubURL)
+		urls, err := parseURLs(cfg.HubURL)
 		if err != nil {
 			return nil, fmt.Errorf("parsing hub URL: %w", err)
 		}
 		opts.LeafNode = server.LeafNodeOpts{
 			Remotes: []*server.RemoteLeafOpts{
-				{URLs: []*url.URL{u}},
+				{URLs: urls}, // The server fails over between them
 			},
+			ReconnectInterval: cfg.Reconnect.Interval, // 0 = server default
 		}
 	} else {
 		// Enable leaf node listening so other nodes can connect
@@ -91,6 +285,71 @@ func StartNATSNode(cfg NATSConfig, authCfg *AuthConfig) (*NATSNode, error) {
 		}
 	}
 
+	// Join the hub cluster
+	if cfg.Cluster.Enabled() {
+		host, port, err := splitHostPort(cfg.Cluster.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cluster address: %w", err)
+		}
+		routes, err := parseURLs(strings.Join(cfg.Cluster.Routes, ","))
+		if err != nil {
+			return nil, fmt.Errorf("parsing cluster routes: %w", err)
+		}
+		opts.Cluster = server.ClusterOpts{
+			Name: cfg.Cluster.Name,
+			Host: host,
+			Port: port,
+		}
+		opts.Routes = routes
+	}
+
+	// Enable WebSocket listener for browser clients
+	if cfg.WebSocketAddr != "" {
+		host, port, err := splitHostPort(cfg.WebSocketAddr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing websocket address: %w", err)
+		}
+		if port == 0 {
+			port = server.RANDOM_PORT // ":0" picks a free port (see WebSocketURL)
+		}
+		opts.Websocket = server.WebsocketOpts{
+			Host:  host,
+			Port:  port,
+			NoTLS: true, // TLS is terminated upstream (or local dev)
+		}
+	}
+
+	// Enable the MQTT listener for IoT devices
+	if cfg.MQTT.Enabled() {
+		// The server only takes a dedicated MQTT user when it has no
+		// user list of its own (auth modes none and token)
+		if cfg.MQTT.Creds.Username != "" && (len(opts.Users) > 0 || len(opts.Nkeys) > 0) {
+			return nil, fmt.Errorf("MQTT credentials need NATS_AUTH none or token; MQTT clients use the node's users in %s mode", authCfg.Mode)
+		}
+		opts.MQTT = server.MQTTOpts{
+			Port:     cfg.MQTT.Port,
+			Username: cfg.MQTT.Creds.Username,
+			Password: cfg.MQTT.Creds.Password,
+			JsDomain: cfg.Domain, // Keep sessions on the node
+		}
+	}
+
+	// Enable the HTTP monitoring endpoints (see monitor.go)
+	if cfg.MonitorAddr != "" {
+		host, port, err := splitHostPort(cfg.MonitorAddr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing monitoring address: %w", err)
+		}
+		if port == 0 {
+			port = server.RANDOM_PORT // ":0" picks a free port (see MonitorURL)
+		}
+		opts.HTTPHost = host
+		opts.HTTPPort = port
+	}
+
+	// Keep a pristine copy for auth reloads (the server mutates its own)
+	reloadOpts := opts.Clone()
+
 	// Create and start the embedded server
 	ns, err := server.NewServer(opts)
 	if err != nil {
@@ -105,73 +364,368 @@ func StartNATSNode(cfg NATSConfig, authCfg *AuthConfig) (*NATSNode, error) {
 		return nil, fmt.Errorf("server not ready within 15s")
 	}
 
+	// The server wrote the bound WebSocket port back into opts
+	wsPort := opts.Websocket.Port
+
 	// Connect as a client to our own embedded server
-	var connOpts []nats.Option
-	if authCfg != nil {
-		clientOpts, err := GetClientConnectOptions(authCfg)
-		if err != nil {
-			ns.Shutdown()
-			return nil, fmt.Errorf("getting client auth options: %w", err)
-		}
-		connOpts = clientOpts
+	logger := componentLogger(cfg.Logger, "nats")
+	auth := &atomic.Pointer[AuthConfig]{}
+	connOpts, err := nodeConnOptions(cfg, authCfg, auth, logger)
+	if err != nil {
+		ns.Shutdown()
+		return nil, err
+	}
+
+	clientURL := ns.ClientURL()
+	if cfg.NoTCP {
+		clientURL = "" // No port to dial
+		connOpts = append(connOpts, nats.InProcessServer(ns))
 	}
 
-	nc, err := nats.Connect(ns.ClientURL(), connOpts...)
+	client := cfg.clientName()
+	nc, err := nats.Connect(clientURL, cfg.laneOptions(connOpts, client+"-data")...)
 	if err != nil {
 		ns.Shutdown()
 		return nil, fmt.Errorf("connecting to server: %w", err)
 	}
 
-	// Create JetStream context
-	js, err := jetstream.New(nc)
+	// Separate control connection so heartbeats never queue behind data
+	ctrl, err := nats.Connect(clientURL, cfg.laneOptions(connOpts, client+"-control")...)
 	if err != nil {
 		nc.Close()
 		ns.Shutdown()
-		return nil, fmt.Errorf("creating jetstream: %w", err)
+		return nil, fmt.Errorf("connecting control lane: %w", err)
 	}
 
-	// Create the services_registry KV bucket
-	ctx := context.Background()
-	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
-		Bucket:      "services_registry",
-		Description: "Service registration for wellnown-env",
-		TTL:         30 * time.Second, // Entries expire if not refreshed
-	})
+	// Create JetStream contexts
+	js, err := cfg.jetStream(nc)
 	if err != nil {
+		ctrl.Close()
 		nc.Close()
 		ns.Shutdown()
-		return nil, fmt.Errorf("creating KV bucket: %w", err)
+		return nil, fmt.Errorf("creating jetstream: %w", err)
+	}
+	localJS, err := cfg.jetStream(ctrl)
+	if err != nil {
+		ctrl.Close()
+		nc.Close()
+		ns.Shutdown()
+		return nil, fmt.Errorf("creating control jetstream: %w", err)
+	}
+	ctrlJS := localJS
+	if cfg.splitDomain() {
+		// Registry and node buckets stay on the hub (see jsdomain.go)
+		if ctrlJS, err = jetstream.NewWithDomain(ctrl, cfg.HubDomain); err != nil {
+			ctrl.Close()
+			nc.Close()
+			ns.Shutdown()
+			return nil, fmt.Errorf("creating hub jetstream: %w", err)
+		}
 	}
 
+	// Create the services_registry KV bucket on the control lane
+	// (lightweight nodes open it in KV)
+	var kv jetstream.KeyValue
+	if !cfg.Lightweight {
+		if kv, err = createRegistryBucket(ctrlJS, cfg); err != nil {
+			ctrl.Close()
+			nc.Close()
+			ns.Shutdown()
+			return nil, fmt.Errorf("creating KV bucket: %w", err)
+		}
+	}
+
+	// Local clients over the unix socket
+	var socket *socketListener
+	if cfg.Socket != "" {
+		if socket, err = listenUnix(ns, cfg.Socket, logger); err != nil {
+			ctrl.Close()
+			nc.Close()
+			ns.Shutdown()
+			return nil, err
+		}
+	}
+
+	logger.Info("node started", "name", cfg.Name, "client_url", clientURL, "socket", cfg.Socket, "leaf", cfg.HubURL != "", "cluster", cfg.Cluster.Name, "domain", cfg.Domain, "lightweight", cfg.Lightweight)
+
 	return &NATSNode{
-		server: ns,
-		conn:   nc,
-		js:     js,
-		kv:     kv,
-		config: cfg,
+		server:  ns,
+		conn:    nc,
+		js:      js,
+		ctrl:    ctrl,
+		ctrlJS:  ctrlJS,
+		localJS: localJS,
+		kv:      kv,
+		config:  cfg,
+		socket:  socket,
+		wsPort:  wsPort,
+		opts:    reloadOpts,
+		auth:    auth,
 	}, nil
 }
 
-// ClientURL returns the NATS client URL
+// jetStream returns a JetStream context on nc. Lightweight nodes have no
+// JetStream of their own, so theirs address the hub's domain.
+func (c NATSConfig) jetStream(nc *nats.Conn) (jetstream.JetStream, error) {
+	if c.Lightweight && c.HubDomain != "" {
+		return jetstream.NewWithDomain(nc, c.HubDomain)
+	}
+	return jetstream.New(nc)
+}
+
+// clusterStartTimeout bounds the wait for a clustered JetStream to elect
+// a leader and place the registry bucket (or for a split-domain leaf's hub)
+const clusterStartTimeout = time.Minute
+
+// createRegistryBucket creates the services_registry bucket. In a cluster
+// it retries until enough members are up to place its replicas, and a
+// split-domain leaf retries until the hub is reachable.
+func createRegistryBucket(js jetstream.JetStream, node NATSConfig) (jetstream.KeyValue, error) {
+	cluster := node.Cluster
+	cfg := registryBucketConfig(cluster)
+	if !cluster.Enabled() && !node.splitDomain() {
+		return js.CreateOrUpdateKeyValue(context.Background(), cfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStartTimeout)
+	defer cancel()
+	for {
+		kv, err := js.CreateOrUpdateKeyValue(ctx, cfg)
+		if err == nil {
+			return kv, nil
+		}
+		select {
+		case <-ctx.Done():
+			if node.splitDomain() {
+				return nil, fmt.Errorf("waiting for hub domain %q: %w", node.HubDomain, err)
+			}
+			return nil, fmt.Errorf("waiting for %d cluster members: %w", cfg.Replicas, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// registryBucketConfig is the services_registry bucket a node creates
+func registryBucketConfig(cluster ClusterConfig) jetstream.KeyValueConfig {
+	return jetstream.KeyValueConfig{
+		Bucket:       RegistryBucket,
+		Description:  "Service registration for wellnown-env",
+		TTL:          RegistryTTL,             // Entries expire if not refreshed
+		MaxValueSize: registry.MaxPayloadSize, // Oversized registrations are refused on write
+		Replicas:     cluster.replicas(),
+	}
+}
+
+// lazyBucketTimeout bounds opening the registry bucket on a lightweight
+// node
+const lazyBucketTimeout = 5 * time.Second
+
+// openRegistryBucket binds to the services_registry bucket, creating it
+// only if nobody has yet. Lightweight nodes call it on first use.
+func openRegistryBucket(js jetstream.JetStream, node NATSConfig) (jetstream.KeyValue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lazyBucketTimeout)
+	defer cancel()
+	kv, err := js.KeyValue(ctx, RegistryBucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(ctx, registryBucketConfig(node.Cluster))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening KV bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// Replicas returns the replica count for buckets and streams on this node
+// (1 unless clustered)
+func (n *NATSNode) Replicas() int {
+	return n.config.Cluster.replicas()
+}
+
+// nodeConnOptions returns the options of the node's own connections:
+// event logging (slow consumers included), the reconnect policy and authCfg (stored in auth)
+func nodeConnOptions(cfg NATSConfig, authCfg *AuthConfig, auth *atomic.Pointer[AuthConfig], logger *slog.Logger) ([]nats.Option, error) {
+	connOpts := []nats.Option{
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			logger.Warn("disconnected", "conn", nc.Opts.Name, "error", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("reconnected", "conn", nc.Opts.Name, "url", nc.ConnectedUrl())
+		}),
+		nats.ErrorHandler(asyncErrorHandler(logger, cfg.OnSlowConsumer)),
+	}
+	connOpts = append(connOpts, nats.DrainTimeout(DefaultDrainTimeout))
+	connOpts = append(connOpts, cfg.Reconnect.clientOptions()...)
+	if authCfg != nil {
+		auth.Store(authCfg)
+		clientOpts, err := nodeClientOptions(auth)
+		if err != nil {
+			return nil, fmt.Errorf("getting client auth options: %w", err)
+		}
+		connOpts = append(connOpts, clientOpts...)
+	}
+	return connOpts, nil
+}
+
+// clientName returns the name prefix of the node's connections
+func (c NATSConfig) clientName() string {
+	if c.ClientName != "" {
+		return c.ClientName
+	}
+	return c.Name
+}
+
+// laneOptions returns the options of one of the node's connections:
+// connOpts, the connection name, then ClientOptions, which override both
+func (c NATSConfig) laneOptions(connOpts []nats.Option, name string) []nats.Option {
+	opts := append(slices.Clip(connOpts), nats.Name(name))
+	return append(opts, c.ClientOptions...)
+}
+
+// nodeClientOptions returns the auth options of the node's own connections.
+// In token mode the token is read on every (re)connect, so connections
+// dropped by a credential rotation come back with the new one.
+func nodeClientOptions(auth *atomic.Pointer[AuthConfig]) ([]nats.Option, error) {
+	cfg := auth.Load()
+	if cfg.Mode == "token" {
+		return []nats.Option{nats.TokenHandler(func() string { return auth.Load().Token })}, nil
+	}
+	return GetClientConnectOptions(cfg)
+}
+
+// Auth returns the credentials the server currently accepts (nil when
+// started without auth)
+func (n *NATSNode) Auth() *AuthConfig {
+	return n.auth.Load()
+}
+
+// ReloadAuth makes the running server accept cfg instead of the current
+// credentials; in nkey mode extraNKeys stay accepted too. Clients whose
+// credentials are no longer valid are disconnected.
+func (n *NATSNode) ReloadAuth(cfg *AuthConfig, extraNKeys ...string) error {
+	if n.Shared() {
+		return ErrSharedNode
+	}
+	n.authMu.Lock()
+	defer n.authMu.Unlock()
+
+	opts := n.opts.Clone()
+	opts.Authorization = ""
+	opts.Nkeys = nil
+	if err := ConfigureAuth(opts, cfg); err != nil {
+		return fmt.Errorf("configuring auth: %w", err)
+	}
+	if cfg.Mode == "nkey" {
+		for _, pub := range extraNKeys {
+			if pub != "" && pub != cfg.NKeyPub {
+				opts.Nkeys = append(opts.Nkeys, nkeyUser(pub))
+			}
+		}
+	}
+
+	next := opts.Clone() // The server owns opts after the reload
+	if err := n.server.ReloadOptions(opts); err != nil {
+		return fmt.Errorf("reloading server auth: %w", err)
+	}
+	n.opts = next
+	n.auth.Store(cfg)
+	return nil
+}
+
+// ClientURL returns the NATS client URL: the shared node's (see
+// sharednode.go), or unix:// plus the socket path without a TCP port
 func (n *NATSNode) ClientURL() string {
+	switch {
+	case n.Shared():
+		return n.conn.ConnectedUrl()
+	case n.config.NoTCP && n.config.Socket != "":
+		return unixScheme + n.config.Socket
+	case n.config.NoTCP:
+		return "" // In-process only
+	}
 	return n.server.ClientURL()
 }
 
-// Conn returns the NATS connection
+// WebSocketURL returns the WebSocket URL browser clients should use
+// (empty if the WebSocket listener is disabled)
+func (n *NATSNode) WebSocketURL() string {
+	if n.wsPort == 0 {
+		return ""
+	}
+	host, _, err := splitHostPort(n.config.WebSocketAddr)
+	if err != nil {
+		return ""
+	}
+	if host == "" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	return "ws://" + net.JoinHostPort(host, strconv.Itoa(n.wsPort))
+}
+
+// MQTTURL returns the URL MQTT clients should use (empty if the MQTT
+// listener is disabled)
+func (n *NATSNode) MQTTURL() string {
+	if !n.config.MQTT.Enabled() {
+		return ""
+	}
+	return "mqtt://" + net.JoinHostPort("localhost", strconv.Itoa(n.config.MQTT.Port))
+}
+
+// Conn returns the data-plane NATS connection
 func (n *NATSNode) Conn() *nats.Conn {
 	return n.conn
 }
 
-// JetStream returns the JetStream context
+// JetStream returns the data-plane JetStream context
 func (n *NATSNode) JetStream() jetstream.JetStream {
 	return n.js
 }
 
-// KV returns the services_registry KV bucket
+// ControlConn returns the control-plane NATS connection
+func (n *NATSNode) ControlConn() *nats.Conn {
+	return n.ctrl
+}
+
+// ControlJetStream returns the control-plane JetStream context
+func (n *NATSNode) ControlJetStream() jetstream.JetStream {
+	return n.ctrlJS
+}
+
+// LocalJetStream returns a control-lane JetStream context in this node's
+// own domain. It is ControlJetStream except on split-domain leaves.
+func (n *NATSNode) LocalJetStream() jetstream.JetStream {
+	return n.localJS
+}
+
+// Domain returns the node's JetStream domain (empty = default domain)
+func (n *NATSNode) Domain() string {
+	return n.config.Domain
+}
+
+// KV returns the services_registry KV bucket (on the control lane).
+// Lightweight nodes open it here on first use; it is nil while JetStream
+// is unreachable.
 func (n *NATSNode) KV() jetstream.KeyValue {
+	if !n.config.Lightweight {
+		return n.kv
+	}
+	n.kvMu.Lock()
+	defer n.kvMu.Unlock()
+	if n.kv == nil {
+		kv, err := openRegistryBucket(n.ctrlJS, n.config)
+		if err != nil {
+			componentLogger(n.config.Logger, "nats").Warn("registry unavailable", "error", err)
+			return nil
+		}
+		n.kv = kv
+	}
 	return n.kv
 }
 
+// Lightweight reports whether the node runs without local JetStream
+func (n *NATSNode) Lightweight() bool {
+	return n.config.Lightweight
+}
+
 // Name returns the server name
 func (n *NATSNode) Name() string {
 	return n.config.Name
@@ -182,11 +736,81 @@ func (n *NATSNode) IsLeaf() bool {
 	return n.config.HubURL != ""
 }
 
-// Close shuts down the NATS node gracefully
+// HubConnected reports whether the leaf link to the hub is up
+// (always true for standalone nodes). On a shared node it reports
+// whether the node answers; the leaf link is its owner's.
+func (n *NATSNode) HubConnected() bool {
+	if n.Shared() {
+		return n.conn.IsConnected()
+	}
+	if !n.IsLeaf() {
+		return true
+	}
+	return n.server.NumLeafNodes() > 0
+}
+
+// Drain waits for in-flight requests and publishes (see Track), then
+// drains both connections: subscriptions stop taking messages, the
+// pending ones are handled and buffered publishes flushed. New tracked
+// work fails with ErrNATSDraining. Close shuts down the server afterwards.
+func (n *NATSNode) Drain(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if err := n.inflight.wait(timeout); err != nil {
+		return err
+	}
+
+	return n.drainConns(deadline, timeout)
+}
+
+// drainConns drains the connections still open and waits until they
+// close or the deadline, timeout after the drain started, passes
+func (n *NATSNode) drainConns(deadline time.Time, timeout time.Duration) error {
+	var conns []*nats.Conn
+	for _, nc := range []*nats.Conn{n.conn, n.ctrl} {
+		if nc == nil || nc.IsClosed() {
+			continue
+		}
+		if err := nc.Drain(); err != nil {
+			return fmt.Errorf("draining NATS connection: %w", err)
+		}
+		conns = append(conns, nc)
+	}
+
+	for _, nc := range conns {
+		for !nc.IsClosed() {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("draining NATS connection: timed out after %s", timeout)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// Track marks work on the node that Drain lets finish, e.g. a JetStream
+// write. Call done when it completes; it fails with ErrNATSDraining once
+// Drain started.
+func (n *NATSNode) Track() (done func(), err error) {
+	if !n.inflight.begin() {
+		return nil, ErrNATSDraining
+	}
+	return n.inflight.end, nil
+}
+
+// Close closes the connections and shuts down the server. Connections
+// still open are drained first, for up to DefaultDrainTimeout; call Drain
+// to also wait for tracked work.
 func (n *NATSNode) Close() error {
+	n.drainConns(time.Now().Add(DefaultDrainTimeout), DefaultDrainTimeout) // Best effort, closed below
 	if n.conn != nil {
 		n.conn.Close()
 	}
+	if n.ctrl != nil {
+		n.ctrl.Close()
+	}
+	if n.socket != nil {
+		n.socket.Close()
+	}
 	if n.server != nil {
 		n.server.Shutdown()
 		n.server.WaitForShutdown()
@@ -196,9 +820,25 @@ func (n *NATSNode) Close() error {
 
 // Publish publishes a message to a subject
 func (n *NATSNode) Publish(subject string, data []byte) error {
+	done, err := n.Track()
+	if err != nil {
+		return fmt.Errorf("publishing %s: %w", subject, err)
+	}
+	defer done()
 	return n.conn.Publish(subject, data)
 }
 
+// Request sends a request on the data connection and waits for the
+// reply; Drain waits for it
+func (n *NATSNode) Request(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	done, err := n.Track()
+	if err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", subject, err)
+	}
+	defer done()
+	return n.conn.RequestWithContext(ctx, subject, data)
+}
+
 // Subscribe subscribes to a subject
 func (n *NATSNode) Subscribe(subject string, handler func(msg *nats.Msg)) (*nats.Subscription, error) {
 	return n.conn.Subscribe(subject, handler)
@@ -208,3 +848,95 @@ func (n *NATSNode) Subscribe(subject string, handler func(msg *nats.Msg)) (*nats
 func (n *NATSNode) QueueSubscribe(subject, queue string, handler func(msg *nats.Msg)) (*nats.Subscription, error) {
 	return n.conn.QueueSubscribe(subject, queue, handler)
 }
+
+// ErrNATSDraining is returned for requests and publishes after Drain started
+var ErrNATSDraining = errors.New("NATS node is draining")
+
+// DefaultDrainTimeout is how long Manager.Close drains NATS when Run did
+// not set a shutdown grace
+const DefaultDrainTimeout = 5 * time.Second
+
+// inflight counts the tracked requests and publishes of a node
+type inflight struct {
+	mu       sync.Mutex
+	n        int
+	draining bool
+	idle     chan struct{} // Closed when n drops to 0 while draining
+}
+
+// begin starts tracked work; false once draining
+func (f *inflight) begin() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return false
+	}
+	f.n++
+	return true
+}
+
+// end finishes tracked work
+func (f *inflight) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// wait stops new work and waits up to timeout for the running work
+func (f *inflight) wait(timeout time.Duration) error {
+	f.mu.Lock()
+	f.draining = true
+	if f.n == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle, n := f.idle, f.n
+	f.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("draining NATS: %d requests still in flight after %s", n, timeout)
+	}
+}
+
+// parseURLs parses a comma-separated URL list
+func parseURLs(list string) ([]*url.URL, error) {
+	var urls []*url.URL
+	for _, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("%q has no host", raw)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// splitHostPort parses a host:port (or :port) address into its parts
+func splitHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,333 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go"
+)
+
+// startTestNode runs an in-memory node on a random port for one test
+func startTestNode(t *testing.T, cfg NATSConfig) *NATSNode {
+	t.Helper()
+	if cfg.Name == "" {
+		cfg.Name = "test"
+	}
+	if cfg.Port == 0 {
+		cfg.Port = -1 // Random
+	}
+	n, err := StartNATSNode(cfg, nil)
+	if err != nil {
+		t.Fatalf("StartNATSNode() error = %v", err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ReconnectPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"fixed interval", ReconnectPolicy{Interval: time.Second}, 5, time.Second},
+		{"first attempt", ReconnectPolicy{Interval: time.Second, MaxInterval: time.Minute}, 1, time.Second},
+		{"doubles", ReconnectPolicy{Interval: time.Second, MaxInterval: time.Minute}, 3, 4 * time.Second},
+		{"capped", ReconnectPolicy{Interval: time.Second, MaxInterval: 10 * time.Second}, 10, 10 * time.Second},
+		{"cap below interval", ReconnectPolicy{Interval: 5 * time.Second, MaxInterval: time.Second}, 3, 5 * time.Second},
+		{"default interval", ReconnectPolicy{MaxInterval: time.Minute}, 1, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.delay(tt.attempt); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconnectPolicyMaxReconnects(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ReconnectPolicy
+		want   int
+	}{
+		{"default is forever", ReconnectPolicy{}, -1},
+		{"forever", ReconnectPolicy{MaxReconnects: -1}, -1},
+		{"limited", ReconnectPolicy{MaxReconnects: 10}, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := nats.GetDefaultOptions()
+			for _, opt := range tt.policy.clientOptions() {
+				opt(&opts)
+			}
+			if opts.MaxReconnect != tt.want {
+				t.Errorf("MaxReconnect = %d, want %d", opts.MaxReconnect, tt.want)
+			}
+		})
+	}
+}
+
+func TestNATSConfigLaneOptions(t *testing.T) {
+	cfg := NATSConfig{Name: "node-1", ClientName: "acme/billing/ab12cd34"}
+	if got := cfg.clientName(); got != "acme/billing/ab12cd34" {
+		t.Errorf("clientName() = %q, want the ClientName", got)
+	}
+	if got := (NATSConfig{Name: "node-1"}).clientName(); got != "node-1" {
+		t.Errorf("clientName() without ClientName = %q, want the server name", got)
+	}
+
+	opts := nats.GetDefaultOptions()
+	for _, opt := range cfg.laneOptions(nil, cfg.clientName()+"-data") {
+		opt(&opts)
+	}
+	if opts.Name != "acme/billing/ab12cd34-data" {
+		t.Errorf("Name = %q, want the lane name", opts.Name)
+	}
+
+	cfg.ClientOptions = []nats.Option{nats.Name("custom")}
+	opts = nats.GetDefaultOptions()
+	for _, opt := range cfg.laneOptions(nil, cfg.clientName()+"-data") {
+		opt(&opts)
+	}
+	if opts.Name != "custom" {
+		t.Errorf("Name = %q, want ClientOptions to override it", opts.Name)
+	}
+}
+
+func TestClientName(t *testing.T) {
+	if got := clientName(registry.GitHubInfo{Org: "acme", Repo: "billing"}, "ab12cd34"); got != "acme/billing/ab12cd34" {
+		t.Errorf("clientName() = %q, want org/repo/instance", got)
+	}
+	if got := clientName(registry.GitHubInfo{}, "ab12cd34"); got != "unknown/ab12cd34" {
+		t.Errorf("clientName() without ldflags = %q, want unknown/instance", got)
+	}
+}
+
+func TestControlDataLanes(t *testing.T) {
+	t.Setenv("NATS_NO_TCP", "true")
+	oldArgs := os.Args
+	os.Args = []string{"app"}
+	t.Cleanup(func() { os.Args = oldArgs })
+
+	m, err := New("LANES", WithoutGUI(), WithHeartbeatInterval(1))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+	node := m.natsNode
+
+	data, ctrl := node.Conn(), node.ControlConn()
+	if data == ctrl {
+		t.Fatal("Conn() and ControlConn() are the same connection")
+	}
+	if node.ControlJetStream().Conn() != ctrl {
+		t.Error("ControlJetStream() is not bound to the control connection")
+	}
+	if node.JetStream().Conn() != data {
+		t.Error("JetStream() is not bound to the data connection")
+	}
+
+	// Registration and a heartbeat go to the registry KV on the control lane
+	dataBefore, ctrlBefore := data.Stats(), ctrl.Stats()
+	beats := metrics.heartbeatOK.Load()
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+	if _, err := m.Parse(&config{}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	waitFor(t, 5*time.Second, "a heartbeat", func() bool { return metrics.heartbeatOK.Load() > beats })
+
+	dataAfter, ctrlAfter := data.Stats(), ctrl.Stats()
+	if ctrlAfter.OutMsgs < ctrlBefore.OutMsgs+2 {
+		t.Errorf("control lane sent %d messages for a registration and a heartbeat, want at least 2",
+			ctrlAfter.OutMsgs-ctrlBefore.OutMsgs)
+	}
+	if dataAfter.OutMsgs != dataBefore.OutMsgs {
+		t.Errorf("data lane sent %d messages during registration, want none", dataAfter.OutMsgs-dataBefore.OutMsgs)
+	}
+
+	// Application traffic stays on the data lane
+	const bulk = 200
+	payload := make([]byte, 1024)
+	for i := 0; i < bulk; i++ {
+		if err := m.NC().Publish("lanes.bulk", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.NC().Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	dataBulk, ctrlBulk := data.Stats(), ctrl.Stats()
+	if got := dataBulk.OutMsgs - dataAfter.OutMsgs; got < bulk {
+		t.Errorf("data lane sent %d messages, want %d", got, bulk)
+	}
+	if got := ctrlBulk.OutBytes - ctrlAfter.OutBytes; got >= bulk*uint64(len(payload)) {
+		t.Errorf("control lane sent %d bytes during the bulk publish", got)
+	}
+}
+
+func TestNATSNodeDrainWaitsForTrackedWork(t *testing.T) {
+	n := &NATSNode{}
+	done, err := n.Track()
+	if err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(finished)
+		done()
+	}()
+	if err := n.Drain(time.Second); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("Drain() returned before the tracked work finished")
+	}
+
+	if _, err := n.Track(); !errors.Is(err, ErrNATSDraining) {
+		t.Errorf("Track() after Drain error = %v, want ErrNATSDraining", err)
+	}
+}
+
+func TestNATSNodeDrainTimesOut(t *testing.T) {
+	n := &NATSNode{}
+	if _, err := n.Track(); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	if err := n.Drain(20 * time.Millisecond); err == nil {
+		t.Error("Drain() with stuck work succeeded, want timeout error")
+	}
+}
+
+func TestClusterConfigReplicas(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ClusterConfig
+		want int
+	}{
+		{"not clustered", ClusterConfig{Routes: []string{"nats://hub-2:6222"}}, 1},
+		{"three hubs", ClusterConfig{Name: "hub", Routes: []string{"nats://hub-2:6222", "nats://hub-3:6222"}}, 3},
+		{"capped at three", ClusterConfig{Name: "hub", Routes: []string{"a", "b", "c", "d"}}, 3},
+		{"explicit", ClusterConfig{Name: "hub", Replicas: 5}, 5},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.replicas(); got != tt.want {
+			t.Errorf("%s: replicas() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNATSConfigSplitDomain(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  NATSConfig
+		want bool
+	}{
+		{"standalone", NATSConfig{Domain: "hub"}, false},
+		{"leaf in the default domain", NATSConfig{HubURL: "nats://hub:4222"}, false},
+		{"leaf in the hub domain", NATSConfig{HubURL: "nats://hub:4222", Domain: "hub", HubDomain: "hub"}, false},
+		{"leaf in its own domain", NATSConfig{HubURL: "nats://hub:4222", Domain: "edge-7", HubDomain: "hub"}, true},
+		{"lightweight leaf (no local JetStream)", NATSConfig{HubURL: "nats://hub:4222", Domain: "edge-7", HubDomain: "hub", Lightweight: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.splitDomain(); got != tt.want {
+			t.Errorf("%s: splitDomain() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNATSNodeMQTTURL(t *testing.T) {
+	tests := []struct {
+		mqtt MQTTConfig
+		want string
+	}{
+		{MQTTConfig{}, ""},
+		{MQTTConfig{Port: 1883}, "mqtt://localhost:1883"},
+		{MQTTConfig{Port: 8883, Creds: MQTTCredentials{Username: "sensor", Password: "s3cret"}}, "mqtt://localhost:8883"},
+	}
+	for _, tt := range tests {
+		n := &NATSNode{config: NATSConfig{MQTT: tt.mqtt}}
+		if got := n.MQTTURL(); got != tt.want {
+			t.Errorf("MQTTURL() with port %d = %q, want %q", tt.mqtt.Port, got, tt.want)
+		}
+	}
+}
+
+func TestParseURLs(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"nats://hub:7422", 1, false},
+		{"nats://hub-1:7422, nats://hub-2:7422,", 2, false},
+		{"hub-1", 0, true},
+	}
+	for _, tt := range tests {
+		urls, err := parseURLs(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseURLs(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if len(urls) != tt.want {
+			t.Errorf("parseURLs(%q) = %d URLs, want %d", tt.list, len(urls), tt.want)
+		}
+	}
+}
+
+func TestNATSNodeWebSocket(t *testing.T) {
+	if got := startTestNode(t, NATSConfig{}).WebSocketURL(); got != "" {
+		t.Errorf("WebSocketURL() without a listener = %q, want empty", got)
+	}
+
+	n := startTestNode(t, NATSConfig{WebSocketAddr: "127.0.0.1:0"})
+	url := n.WebSocketURL()
+	if !strings.HasPrefix(url, "ws://127.0.0.1:") || strings.HasSuffix(url, ":0") {
+		t.Fatalf("WebSocketURL() = %q, want the bound port", url)
+	}
+
+	received := make(chan string, 1)
+	sub, err := n.Conn().Subscribe("browser.hello", func(msg *nats.Msg) {
+		received <- string(msg.Data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	if err := n.Conn().Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := nats.Connect(url)
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", url, err)
+	}
+	defer ws.Close()
+	if err := ws.Publish("browser.hello", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if got != "hi" {
+			t.Errorf("received %q, want hi", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message over WebSocket not delivered")
+	}
+}
@@ -0,0 +1,103 @@
+// natskv.go: ref+natskv:// secrets from a JetStream KV bucket
+//
+// Secrets kept in a KV bucket on the hub reach every leaf without a Vault
+// of their own:
+//
+//	nats kv put secrets db.password s3cret           # On the hub
+//	APP_DB_PASSWORD=ref+natskv://secrets/db.password # On a leaf
+//
+// Parse resolves ref+natskv refs through the manager's NATS connection.
+// Elsewhere, pass a provider to the resolver:
+//
+//	res, _ := env.NewSecretResolver(vals.Options{},
+//	    env.WithSecretProvider(env.NATSKVScheme, env.NewNATSKVProvider(js)))
+//
+// With SECRET_CACHE set, leaves keep starting from the encrypted cache
+// while the hub is unreachable. Limit read access to the bucket with NATS
+// permissions: its values are stored in the clear.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSKVScheme is the ref scheme of NATSKVProvider (ref+natskv://bucket/key)
+const NATSKVScheme = "natskv"
+
+// NATSKVProvider resolves ref+natskv://bucket/key from JetStream KV. It
+// is safe for concurrent use.
+type NATSKVProvider struct {
+	js jetstream.JetStream
+
+	mu      sync.Mutex
+	buckets map[string]jetstream.KeyValue
+}
+
+// NewNATSKVProvider returns a provider reading buckets through js
+func NewNATSKVProvider(js jetstream.JetStream) *NATSKVProvider {
+	return &NATSKVProvider{js: js, buckets: make(map[string]jetstream.KeyValue)}
+}
+
+// Get returns the value of the key named by ref
+func (p *NATSKVProvider) Get(ctx context.Context, ref string) (string, error) {
+	bucket, key, err := parseNATSKVRef(ref)
+	if err != nil {
+		return "", err
+	}
+	kv, err := p.bucket(ctx, bucket)
+	if err != nil {
+		return "", err
+	}
+	entry, err := kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return "", fmt.Errorf("no key %s in bucket %s", key, bucket)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading %s/%s: %w", bucket, key, err)
+	}
+	return string(entry.Value()), nil
+}
+
+// bucket returns the KV handle of bucket, opening it once
+func (p *NATSKVProvider) bucket(ctx context.Context, bucket string) (jetstream.KeyValue, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if kv, ok := p.buckets[bucket]; ok {
+		return kv, nil
+	}
+	kv, err := p.js.KeyValue(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("opening secrets bucket %s: %w", bucket, err)
+	}
+	p.buckets[bucket] = kv
+	return kv, nil
+}
+
+// parseNATSKVRef splits ref+natskv://bucket/key. Keys may contain slashes
+// and dots.
+func parseNATSKVRef(ref string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(ref, refPrefix+NATSKVScheme+"://")
+	if !ok {
+		return "", "", fmt.Errorf("not a %s ref: %q", NATSKVScheme, ref)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid %s ref %q (want ref+%s://bucket/key)", NATSKVScheme, ref, NATSKVScheme)
+	}
+	return bucket, key, nil
+}
+
+// secretProviders returns the providers Parse adds to the resolver:
+// ref+natskv through this manager's connection, if NATS is enabled
+func (m *Manager) secretProviders() map[string]SecretProvider {
+	if m.natsNode == nil {
+		return nil
+	}
+	return map[string]SecretProvider{NATSKVScheme: NewNATSKVProvider(m.natsNode.ControlJetStream())}
+}
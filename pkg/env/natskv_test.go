@@ -0,0 +1,102 @@
+package env
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// memJS serves memKV buckets by name
+type memJS struct {
+	jetstream.JetStream
+	buckets map[string]*memKV
+	opened  int
+}
+
+func (j *memJS) KeyValue(ctx context.Context, bucket string) (jetstream.KeyValue, error) {
+	kv, ok := j.buckets[bucket]
+	if !ok {
+		return nil, jetstream.ErrBucketNotFound
+	}
+	j.opened++
+	return kv, nil
+}
+
+func TestParseNATSKVRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		bucket  string
+		key     string
+		wantErr bool
+	}{
+		{ref: "ref+natskv://secrets/db.password", bucket: "secrets", key: "db.password"},
+		{ref: "ref+natskv://secrets/api/stripe/key", bucket: "secrets", key: "api/stripe/key"},
+		{ref: "ref+natskv://secrets", wantErr: true},
+		{ref: "ref+natskv:///key", wantErr: true},
+		{ref: "ref+vault://secrets/key", wantErr: true},
+	}
+	for _, tt := range tests {
+		bucket, key, err := parseNATSKVRef(tt.ref)
+		if (err != nil) != tt.wantErr || bucket != tt.bucket || key != tt.key {
+			t.Errorf("parseNATSKVRef(%q) = %q, %q, %v; want %q, %q, wantErr %v", tt.ref, bucket, key, err, tt.bucket, tt.key, tt.wantErr)
+		}
+	}
+}
+
+func TestNATSKVProvider(t *testing.T) {
+	kv := newMemKV()
+	kv.Put(context.Background(), "db.password", []byte("s3cret"))
+	js := &memJS{buckets: map[string]*memKV{"secrets": kv}}
+
+	f := &fakeVals{}
+	r := newTestResolver(t, f, WithSecretProvider(NATSKVScheme, NewNATSKVProvider(js)), WithSecretTTL(0))
+
+	got, err := r.Resolve(context.Background(), []string{
+		"ref+natskv://secrets/db.password",
+		"ref+echo://plain",
+	})
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if got["ref+natskv://secrets/db.password"] != "s3cret" || got["ref+echo://plain"] != "plain" {
+		t.Errorf("Resolve() = %v", got)
+	}
+	if n := f.calls.Load(); n != 1 {
+		t.Errorf("vals lookups = %d, want 1 (natskv bypasses vals)", n)
+	}
+
+	// The bucket is opened once
+	r.Resolve(context.Background(), []string{"ref+natskv://secrets/db.password"})
+	if js.opened != 1 {
+		t.Errorf("bucket opened %d times, want 1", js.opened)
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "ref+natskv://secrets/missing", want: "no key missing"},
+		{ref: "ref+natskv://other/key", want: "opening secrets bucket other"},
+	}
+	for _, tt := range tests {
+		_, err := r.Resolve(context.Background(), []string{tt.ref})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Resolve(%q) error = %v, want %q", tt.ref, err, tt.want)
+		}
+	}
+}
+
+func TestRefScheme(t *testing.T) {
+	for ref, want := range map[string]string{
+		"ref+natskv://secrets/key": "natskv",
+		"ref+vault://secret/db#pw": "vault",
+		"ref+echo":                 "",
+		"plain":                    "",
+	} {
+		if got := refScheme(ref); got != want {
+			t.Errorf("refScheme(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Package ops runs long operations in the background and streams their output
+// to Via pages while they run.
+//
+// A Runner starts tasks (shell commands or Go funcs) without blocking the
+// caller. Output lands in a per-task env.LogPane, and every change is
+// broadcast to subscribers, so pages can re-render progress live and offer
+// a cancel button:
+//
+//	runner := ops.NewRunner()
+//	task := runner.Command("build", "task", "build")
+//
+//	v.Page("/ops", func(c *via.Context) {
+//	    tasks := ops.TaskPanel(c, runner)
+//	    c.View(func() h.H { return h.Main(tasks()) })
+//	})
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// Status is the state of a task
+type Status string
+
+// Task statuses
+const (
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Canceled  Status = "canceled"
+)
+
+// DefaultHistory is how many finished tasks a Runner keeps
+const DefaultHistory = 20
+
+// Func is an operation; it writes progress to out and should return
+// promptly once ctx is canceled
+type Func func(ctx context.Context, out io.Writer) error
+
+// Event reports a change of a task (new output or completion)
+type Event struct {
+	Task *Task
+	Done bool
+}
+
+// Task is one run of an operation
+type Task struct {
+	ID   string
+	Name string
+
+	mu       sync.Mutex
+	status   Status
+	err      error
+	started  time.Time
+	finished time.Time
+	output   *env.LogPane
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Status returns the task status
+func (t *Task) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// Err returns the error of a failed task
+func (t *Task) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Duration returns how long the task ran (so far, if still running)
+func (t *Task) Duration() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.finished.IsZero() {
+		return time.Since(t.started)
+	}
+	return t.finished.Sub(t.started)
+}
+
+// Output returns the task's log pane
+func (t *Task) Output() *env.LogPane {
+	return t.output
+}
+
+// Cancel stops the task; it finishes with status Canceled
+func (t *Task) Cancel() {
+	t.cancel()
+}
+
+// Done is closed when the task finished
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until the task finished or ctx is done and returns the task error
+func (t *Task) Wait(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return t.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Option configures a Runner
+type Option func(*Runner)
+
+// WithMaxLines sets the output lines kept per task (default: env.DefaultLogLines)
+func WithMaxLines(n int) Option {
+	return func(r *Runner) {
+		r.maxLines = n
+	}
+}
+
+// WithHistory sets how many finished tasks are kept (default: DefaultHistory)
+func WithHistory(n int) Option {
+	return func(r *Runner) {
+		r.history = n
+	}
+}
+
+// Runner starts tasks and broadcasts their progress
+type Runner struct {
+	mu       sync.Mutex
+	tasks    []*Task // Oldest first
+	nextID   int
+	subs     map[int]func(Event)
+	nextSub  int
+	maxLines int
+	history  int
+	version  atomic.Uint64
+}
+
+// NewRunner creates a runner
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{
+		subs:    make(map[int]func(Event)),
+		history: DefaultHistory,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run starts fn in the background
+func (r *Runner) Run(name string, fn Func) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	r.nextID++
+	id := strconv.Itoa(r.nextID)
+	t := &Task{
+		ID:      id,
+		Name:    name,
+		status:  Running,
+		started: time.Now(),
+		output:  env.NewLogPane("task-"+id+"-log", r.maxLines),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	r.tasks = append(r.tasks, t)
+	r.prune()
+	r.mu.Unlock()
+
+	r.notify(Event{Task: t})
+
+	go func() {
+		defer cancel()
+		err := fn(ctx, &taskWriter{runner: r, task: t})
+		r.finish(ctx, t, err)
+	}()
+
+	return t
+}
+
+// Command runs an external command, streaming stdout and stderr
+func (r *Runner) Command(name, command string, args ...string) *Task {
+	return r.Run(name, func(ctx context.Context, out io.Writer) error {
+		cmd := exec.CommandContext(ctx, command, args...)
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.WaitDelay = 5 * time.Second // Don't hang on children holding the pipes
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", command, err)
+		}
+		return nil
+	})
+}
+
+// finish records the result of a task and broadcasts it
+func (r *Runner) finish(ctx context.Context, t *Task, err error) {
+	t.mu.Lock()
+	t.finished = time.Now()
+	switch {
+	case ctx.Err() != nil && (err == nil || errors.Is(err, context.Canceled) || isKilled(err)):
+		t.status = Canceled
+	case err != nil:
+		t.status = Failed
+		t.err = err
+	default:
+		t.status = Succeeded
+	}
+	t.mu.Unlock()
+
+	r.mu.Lock()
+	r.prune()
+	r.mu.Unlock()
+
+	r.notify(Event{Task: t, Done: true})
+	close(t.done)
+}
+
+// isKilled reports whether a command was killed by CommandContext
+func isKilled(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && !exitErr.Exited()
+}
+
+// prune drops the oldest finished tasks beyond the history limit (caller holds mu)
+func (r *Runner) prune() {
+	finished := 0
+	for _, t := range r.tasks {
+		if t.Status() != Running {
+			finished++
+		}
+	}
+
+	kept := r.tasks[:0]
+	for _, t := range r.tasks {
+		if finished > r.history && t.Status() != Running {
+			finished--
+			continue
+		}
+		kept = append(kept, t)
+	}
+	r.tasks = kept
+}
+
+// Tasks returns all kept tasks, newest first
+func (r *Runner) Tasks() []*Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tasks := make([]*Task, len(r.tasks))
+	for i, t := range r.tasks {
+		tasks[len(r.tasks)-1-i] = t
+	}
+	return tasks
+}
+
+// Get returns a task by ID (nil if unknown or pruned)
+func (r *Runner) Get(id string) *Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tasks {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// Subscribe calls fn for every task event until the returned func is
+// called. fn runs on the task goroutine and must not block.
+func (r *Runner) Subscribe(fn func(Event)) (unsubscribe func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextSub
+	r.nextSub++
+	r.subs[id] = fn
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subs, id)
+	}
+}
+
+// Version increases with every event; pages compare it to skip idle re-renders
+func (r *Runner) Version() uint64 {
+	return r.version.Load()
+}
+
+// notify broadcasts an event to all subscribers
+func (r *Runner) notify(e Event) {
+	r.version.Add(1)
+
+	r.mu.Lock()
+	subs := make([]func(Event), 0, len(r.subs))
+	for _, fn := range r.subs {
+		subs = append(subs, fn)
+	}
+	r.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(e)
+	}
+}
+
+// taskWriter feeds output into the task pane and broadcasts it
+type taskWriter struct {
+	runner *Runner
+	task   *Task
+}
+
+// Write implements io.Writer
+func (w *taskWriter) Write(p []byte) (int, error) {
+	n, err := w.task.output.Write(p)
+	w.runner.notify(Event{Task: w.task})
+	return n, err
+}
@@ -0,0 +1,132 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wait waits for a task with a test timeout
+func wait(t *testing.T, task *Task) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := task.Wait(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("task %s did not finish", task.Name)
+	}
+	return err
+}
+
+func TestRunnerStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     Func
+		cancel bool
+		want   Status
+	}{
+		{
+			name: "succeeds",
+			fn:   func(ctx context.Context, out io.Writer) error { return nil },
+			want: Succeeded,
+		},
+		{
+			name: "fails",
+			fn:   func(ctx context.Context, out io.Writer) error { return errors.New("boom") },
+			want: Failed,
+		},
+		{
+			name: "canceled",
+			fn: func(ctx context.Context, out io.Writer) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			cancel: true,
+			want:   Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := NewRunner().Run(tt.name, tt.fn)
+			if tt.cancel {
+				task.Cancel()
+			}
+			_ = wait(t, task)
+			if got := task.Status(); got != tt.want {
+				t.Errorf("Status() = %s, want %s", got, tt.want)
+			}
+			if tt.want == Failed && task.Err() == nil {
+				t.Error("Err() = nil for failed task")
+			}
+		})
+	}
+}
+
+func TestRunnerStreamsOutput(t *testing.T) {
+	r := NewRunner()
+
+	var events, done atomic.Int32
+	unsubscribe := r.Subscribe(func(e Event) {
+		events.Add(1)
+		if e.Done {
+			done.Add(1)
+		}
+	})
+	defer unsubscribe()
+
+	task := r.Run("count", func(ctx context.Context, out io.Writer) error {
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(out, "step %d\n", i)
+		}
+		return nil
+	})
+	if err := wait(t, task); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	want := []string{"step 1", "step 2", "step 3"}
+	if got := task.Output().Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+	// start + 3 writes + done
+	if events.Load() != 5 || done.Load() != 1 {
+		t.Errorf("events = %d (done %d), want 5 (done 1)", events.Load(), done.Load())
+	}
+	if r.Version() != 5 {
+		t.Errorf("Version() = %d, want 5", r.Version())
+	}
+}
+
+func TestRunnerHistory(t *testing.T) {
+	r := NewRunner(WithHistory(2))
+
+	block := make(chan struct{})
+	running := r.Run("long", func(ctx context.Context, out io.Writer) error {
+		<-block
+		return nil
+	})
+	for i := range 3 {
+		_ = wait(t, r.Run(fmt.Sprintf("quick-%d", i), func(ctx context.Context, out io.Writer) error { return nil }))
+	}
+
+	var names []string
+	for _, task := range r.Tasks() {
+		names = append(names, task.Name)
+	}
+	want := []string{"quick-2", "quick-1", "long"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Tasks() = %q, want %q (running tasks are never pruned)", names, want)
+	}
+	if r.Get(running.ID) != running {
+		t.Errorf("Get(%s) did not return the running task", running.ID)
+	}
+
+	close(block)
+	_ = wait(t, running)
+}
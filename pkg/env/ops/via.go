@@ -0,0 +1,87 @@
+package ops
+
+import (
+	"time"
+
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// DefaultFollowInterval is how often a following page checks for task changes
+const DefaultFollowInterval = 250 * time.Millisecond
+
+// Follow re-renders the page whenever a task of r changed, for as long as
+// the page is open. Bursts of output within one interval cause one Sync.
+func Follow(c *via.Context, r *Runner, interval time.Duration) {
+	var seen uint64
+	c.OnInterval(interval, func() {
+		if v := r.Version(); v != seen {
+			seen = v
+			c.Sync()
+		}
+	}).Start()
+}
+
+// TaskPanel registers the cancel action and live refresh for r on the page
+// and returns a render func listing its tasks. Call it once per context and
+// env.RegisterLogPanes once per app.
+func TaskPanel(c *via.Context, r *Runner) func() h.H {
+	target := c.Signal("")
+	cancel := c.Action(func() {
+		if t := r.Get(target.String()); t != nil {
+			t.Cancel()
+		}
+	})
+	Follow(c, r, DefaultFollowInterval)
+
+	return func() h.H {
+		tasks := r.Tasks()
+		if len(tasks) == 0 {
+			return h.P(h.Small(h.Text("No tasks have run yet.")))
+		}
+
+		items := []h.H{h.ID("tasks")}
+		for _, t := range tasks {
+			var cancelEl h.H
+			if t.Status() == Running {
+				cancelEl = h.Button(h.ID("cancel-"+t.ID), h.Class("secondary outline"),
+					env.AriaLabel("Cancel "+t.Name), cancel.OnClick(via.WithSignal(target, t.ID)), h.Text("Cancel"))
+			}
+			items = append(items, h.Article(h.ID("task-"+t.ID),
+				h.Header(
+					h.Strong(h.Text(t.Name)), h.Text(" "),
+					statusEl(t),
+					h.Small(h.Textf(" %s", t.Duration().Round(100*time.Millisecond))),
+					cancelEl,
+				),
+				t.Output().Render(),
+				errorEl(t),
+			))
+		}
+		return h.Div(items...)
+	}
+}
+
+// statusEl renders the task status, announced to screen readers on change
+func statusEl(t *Task) h.H {
+	status := t.Status()
+	var text h.H
+	switch status {
+	case Succeeded:
+		text = h.Ins(h.Text(string(status)))
+	case Failed, Canceled:
+		text = h.Del(h.Text(string(status)))
+	default:
+		text = h.Mark(h.Text(string(status)))
+	}
+	return h.Span(h.Role("status"), text)
+}
+
+// errorEl renders the error of a failed task
+func errorEl(t *Task) h.H {
+	if err := t.Err(); err != nil {
+		return h.Footer(h.Small(h.Class("pico-color-red"), h.Text(err.Error())))
+	}
+	return nil
+}
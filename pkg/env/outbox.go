@@ -0,0 +1,259 @@
+// outbox.go: Durable publish buffer for leaf nodes that lose the hub
+//
+// A plain publish made while the leaf link is down is dropped: nothing on
+// the local node is listening and the hub never sees it. The Outbox stores
+// such publishes in the local "outbox" JetStream stream instead and
+// replays them in order once the hub is reachable again:
+//
+//	mgr, _ := env.New("APP", env.WithHub(hubURL), env.WithOutbox())
+//	err := mgr.Publish(ctx, "orders.created", data)
+//
+// While connected (and nothing is queued) messages go straight out on the
+// data connection. Replay is at-least-once: a message sent just before a
+// crash may be sent again after restart. Set DataDir so queued messages
+// survive restarts.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	outboxStreamName    = "outbox"
+	outboxSubjectPrefix = "_outbox." // Stored subject = prefix + original subject
+	outboxConsumerName  = "outbox_replay"
+	outboxBatch         = 100
+)
+
+// DefaultOutboxPoll is how often the outbox checks the leaf link while
+// messages are queued
+const DefaultOutboxPoll = time.Second
+
+// errHubDisconnected stops a replay when the leaf link drops mid-way
+var errHubDisconnected = errors.New("hub disconnected")
+
+// Outbox buffers publishes in local JetStream while the hub is unreachable
+type Outbox struct {
+	mu      sync.Mutex // Orders direct publishes after queued ones
+	node    *NATSNode
+	js      jetstream.JetStream
+	cons    jetstream.Consumer
+	pending int // Messages stored but not yet replayed
+	write   WritePolicy
+	logger  *slog.Logger
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// StartOutbox creates the outbox stream on the node and starts replaying
+// queued messages whenever the hub is connected. A nil logger uses
+// slog.Default.
+func StartOutbox(ctx context.Context, node *NATSNode, logger *slog.Logger) (*Outbox, error) {
+	js := node.JetStream()
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        outboxStreamName,
+		Description: "Publishes buffered while the hub is unreachable",
+		Subjects:    []string{outboxSubjectPrefix + ">"},
+		Retention:   jetstream.WorkQueuePolicy, // Replayed messages are removed on ack
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox stream: %w", err)
+	}
+
+	cons, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       outboxConsumerName,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxAckPending: outboxBatch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox consumer: %w", err)
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading outbox state: %w", err)
+	}
+
+	o := &Outbox{
+		node:    node,
+		js:      js,
+		cons:    cons,
+		pending: int(info.State.Msgs), // Left over from before a restart
+		logger:  componentLogger(logger, "outbox"),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go o.run()
+
+	return o, nil
+}
+
+// SetWritePolicy sets the timeout and retries of buffering writes
+func (o *Outbox) SetWritePolicy(p WritePolicy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.write = p
+}
+
+// Publish sends data to subject, or stores it for replay if the hub is
+// unreachable or earlier messages are still queued
+func (o *Outbox) Publish(ctx context.Context, subject string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.pending == 0 && o.node.HubConnected() {
+		return o.node.Conn().Publish(subject, data)
+	}
+
+	err := o.write.do(ctx, "publish", outboxSubjectPrefix+subject, func(ctx context.Context) error {
+		_, err := o.js.Publish(ctx, outboxSubjectPrefix+subject, data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("buffering %s: %w", subject, err)
+	}
+	o.pending++
+	return nil
+}
+
+// Pending returns the number of messages waiting for replay
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending
+}
+
+// run replays queued messages whenever the hub is connected
+func (o *Outbox) run() {
+	defer close(o.done)
+
+	ticker := time.NewTicker(DefaultOutboxPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.stopCh:
+			return
+		case <-ticker.C:
+			if o.Pending() == 0 || !o.node.HubConnected() {
+				continue
+			}
+			sent, err := o.replay()
+			if sent > 0 {
+				o.logger.Info("replayed buffered messages", "count", sent, "pending", o.Pending())
+			}
+			if err != nil && !errors.Is(err, errHubDisconnected) {
+				o.logger.Warn("outbox replay failed", "error", err)
+			}
+		}
+	}
+}
+
+// replay sends queued messages in order until the outbox is empty, the hub
+// disconnects or a publish fails
+func (o *Outbox) replay() (int, error) {
+	sent := 0
+	for {
+		batch, err := o.cons.Fetch(outboxBatch, jetstream.FetchMaxWait(time.Second))
+		if err != nil {
+			return sent, fmt.Errorf("fetching outbox: %w", err)
+		}
+
+		n := 0
+		var failed error
+		for msg := range batch.Messages() {
+			n++
+			if failed != nil {
+				_ = msg.Nak() // Keep order: retry the rest of the batch later
+				continue
+			}
+			if err := o.forward(msg); err != nil {
+				failed = err
+				_ = msg.Nak()
+				continue
+			}
+			sent++
+		}
+		if failed != nil {
+			return sent, failed
+		}
+		if err := batch.Error(); err != nil {
+			return sent, fmt.Errorf("fetching outbox: %w", err)
+		}
+		if n == 0 {
+			return sent, nil
+		}
+	}
+}
+
+// forward publishes one stored message to its original subject and acks it
+func (o *Outbox) forward(msg jetstream.Msg) error {
+	if !o.node.HubConnected() {
+		return errHubDisconnected
+	}
+
+	conn := o.node.Conn()
+	out := &nats.Msg{
+		Subject: strings.TrimPrefix(msg.Subject(), outboxSubjectPrefix),
+		Data:    msg.Data(),
+	}
+	if err := conn.PublishMsg(out); err != nil {
+		return fmt.Errorf("publishing %s: %w", out.Subject, err)
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("flushing %s: %w", out.Subject, err)
+	}
+	if err := msg.Ack(); err != nil {
+		return fmt.Errorf("acking %s: %w", out.Subject, err)
+	}
+
+	o.mu.Lock()
+	o.pending--
+	o.mu.Unlock()
+	return nil
+}
+
+// Stop stops replaying; queued messages stay in the stream
+func (o *Outbox) Stop() {
+	close(o.stopCh)
+	<-o.done
+}
+
+// Outbox returns the publish outbox (nil unless enabled with WithOutbox)
+func (m *Manager) Outbox() *Outbox {
+	return m.outbox
+}
+
+// Publish publishes on the data connection, through the outbox if enabled.
+// In the low-power profile it queues the message for the next batch.
+func (m *Manager) Publish(ctx context.Context, subject string, data []byte) error {
+	m.mu.RLock()
+	batch := m.batch
+	m.mu.RUnlock()
+	if batch != nil {
+		return batch.add(subject, data)
+	}
+	return m.publish(ctx, subject, data)
+}
+
+// publish publishes at once
+func (m *Manager) publish(ctx context.Context, subject string, data []byte) error {
+	if m.outbox != nil {
+		return m.outbox.Publish(ctx, subject, data)
+	}
+	if m.natsNode == nil {
+		return fmt.Errorf("publishing %s: NATS disabled", subject)
+	}
+	return m.natsNode.Publish(subject, data)
+}
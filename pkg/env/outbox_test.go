@@ -0,0 +1,122 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// freeHubPort returns a client port whose leaf port (+1000) is free too,
+// so a hub can be restarted on the same address
+func freeHubPort(t *testing.T) int {
+	t.Helper()
+	for range 20 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		if port+1000 > 65535 {
+			continue
+		}
+		leaf, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port+1000))
+		if err != nil {
+			continue
+		}
+		leaf.Close()
+		return port
+	}
+	t.Fatal("no free hub port")
+	return 0
+}
+
+// waitFor polls cond until it holds or the timeout passes
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestOutboxReplaysAfterHubRestart(t *testing.T) {
+	port := freeHubPort(t)
+	hubCfg := NATSConfig{Name: "hub", Port: port}
+	hub, err := StartNATSNode(hubCfg, nil)
+	if err != nil {
+		t.Fatalf("StartNATSNode(hub) error = %v", err)
+	}
+
+	leaf := startTestNode(t, NATSConfig{
+		Name:      "leaf",
+		HubURL:    fmt.Sprintf("nats://127.0.0.1:%d", port+1000),
+		Reconnect: ReconnectPolicy{Interval: 100 * time.Millisecond},
+	})
+	waitFor(t, 5*time.Second, "the leaf link", leaf.HubConnected)
+
+	outbox, err := StartOutbox(context.Background(), leaf, nil)
+	if err != nil {
+		t.Fatalf("StartOutbox() error = %v", err)
+	}
+	defer outbox.Stop()
+
+	// Hub goes away: publishes are buffered
+	hub.Close()
+	waitFor(t, 5*time.Second, "the leaf link to drop", func() bool { return !leaf.HubConnected() })
+
+	const count = 20
+	for i := range count {
+		if err := outbox.Publish(context.Background(), "orders.created", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Publish(%d) error = %v", i, err)
+		}
+	}
+	if got := outbox.Pending(); got != count {
+		t.Fatalf("Pending() while disconnected = %d, want %d", got, count)
+	}
+
+	// Hub comes back: the subscriber there gets every message once, in order
+	hub, err = StartNATSNode(hubCfg, nil)
+	if err != nil {
+		t.Fatalf("restarting hub: %v", err)
+	}
+	defer hub.Close()
+
+	received := make(chan string, 2*count)
+	sub, err := hub.Conn().Subscribe("orders.created", func(msg *nats.Msg) {
+		received <- string(msg.Data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	if err := hub.Conn().Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 10*time.Second, "the outbox to drain", func() bool { return outbox.Pending() == 0 })
+
+	for i := range count {
+		select {
+		case got := <-received:
+			if got != strconv.Itoa(i) {
+				t.Fatalf("message %d = %s, want %d (out of order)", i, got, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d messages, want %d", i, count)
+		}
+	}
+	select {
+	case extra := <-received:
+		t.Errorf("message %s delivered twice", extra)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,191 @@
+// palette.go: Command palette for quick navigation across dashboard pages
+//
+// Pressing "/" on any page opens an overlay that searches pages, registered
+// services and anything else a PaletteSource provides (e.g. pcview
+// processes). Enter opens the first match, arrow keys move the selection,
+// Escape closes it.
+//
+//	env.RegisterCommandPalette(v, env.PaletteOptions{
+//	    Pages:   env.DashboardPages(),
+//	    Sources: []env.PaletteSource{env.ServicePaletteSource(mgr)},
+//	})
+//
+// Results come from GET /_palette?q=..., so the overlay stays a few lines
+// of script and all matching happens on the server.
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+)
+
+// paletteLimit caps the number of results returned per query
+const paletteLimit = 20
+
+// PaletteItem is one navigable palette entry
+type PaletteItem struct {
+	Kind  string `json:"kind"`  // page, service, process, ...
+	Title string `json:"title"` // Searched and displayed text
+	Href  string `json:"href"`  // Where Enter/click navigates
+}
+
+// PaletteSource returns palette items at query time
+type PaletteSource func(ctx context.Context) []PaletteItem
+
+// PaletteOptions configures the command palette
+type PaletteOptions struct {
+	Pages   []PaletteItem   // Static entries, usually pages
+	Sources []PaletteSource // Dynamic entries, queried on every search
+}
+
+// DashboardPages returns palette entries for the pages in gui.go
+func DashboardPages() []PaletteItem {
+	return []PaletteItem{
+		{Kind: "page", Title: "Dashboard", Href: "/"},
+		{Kind: "page", Title: "Config", Href: "/config"},
+		{Kind: "page", Title: "Usage", Href: "/usage"},
+		{Kind: "page", Title: "Changelog", Href: "/changelog"},
+		{Kind: "page", Title: "Server", Href: "/server"},
+	}
+}
+
+// ServicePaletteSource lists registered services, linking to their changelog
+func ServicePaletteSource(mgr *Manager) PaletteSource {
+	return func(ctx context.Context) []PaletteItem {
+		regs, err := mgr.GetAllServices(ctx)
+		if err != nil {
+			return nil
+		}
+		seen := make(map[string]bool)
+		var items []PaletteItem
+		for _, reg := range regs {
+			name := reg.GitHub.Name()
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			items = append(items, PaletteItem{Kind: "service", Title: name, Href: "/changelog/" + name})
+		}
+		return items
+	}
+}
+
+// RegisterCommandPalette adds the palette overlay to every page and serves
+// its search endpoint
+func RegisterCommandPalette(v *via.V, opts PaletteOptions) {
+	v.HandleFunc("GET /_palette", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		items := append([]PaletteItem(nil), opts.Pages...)
+		for _, source := range opts.Sources {
+			items = append(items, source(ctx)...)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(searchPalette(items, r.URL.Query().Get("q"), paletteLimit))
+	})
+
+	v.AppendToFoot(
+		h.Dialog(h.ID("palette"),
+			h.Article(
+				h.Input(h.ID("palette-input"), h.Type("search"), h.Placeholder("Jump to page, service, process...")),
+				h.Ul(h.ID("palette-results")),
+				h.Small(h.Text("Enter to open, arrows to select, Esc to close")),
+			),
+		),
+		h.Script(h.Raw(paletteScript)),
+	)
+}
+
+// searchPalette returns items matching query (case-insensitive substring of
+// title or kind), prefix matches first, then by kind and title
+func searchPalette(items []PaletteItem, query string, limit int) []PaletteItem {
+	q := strings.ToLower(strings.TrimSpace(query))
+
+	type match struct {
+		item   PaletteItem
+		prefix bool
+	}
+	var matches []match
+	for _, item := range items {
+		title := strings.ToLower(item.Title)
+		if q != "" && !strings.Contains(title, q) && !strings.Contains(strings.ToLower(item.Kind), q) {
+			continue
+		}
+		matches = append(matches, match{item: item, prefix: q != "" && strings.HasPrefix(title, q)})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].prefix != matches[j].prefix {
+			return matches[i].prefix
+		}
+		if matches[i].item.Kind != matches[j].item.Kind {
+			return matches[i].item.Kind < matches[j].item.Kind
+		}
+		return matches[i].item.Title < matches[j].item.Title
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	results := make([]PaletteItem, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, m.item)
+	}
+	return results
+}
+
+// paletteScript opens the palette on "/" and renders /_palette results
+const paletteScript = `(() => {
+  const dlg = document.getElementById('palette');
+  const input = document.getElementById('palette-input');
+  const list = document.getElementById('palette-results');
+  let results = [], selected = 0;
+
+  const render = () => {
+    list.replaceChildren(...results.map((r, i) => {
+      const li = document.createElement('li');
+      const a = document.createElement('a');
+      a.href = r.href;
+      a.textContent = r.title;
+      if (i === selected) a.setAttribute('aria-current', 'true');
+      const kind = document.createElement('small');
+      kind.textContent = ' ' + r.kind;
+      li.append(a, kind);
+      return li;
+    }));
+  };
+
+  const search = async () => {
+    const res = await fetch('/_palette?q=' + encodeURIComponent(input.value));
+    results = await res.json();
+    selected = 0;
+    render();
+  };
+
+  document.addEventListener('keydown', (e) => {
+    const tag = (e.target.tagName || '').toLowerCase();
+    if (e.key === '/' && !dlg.open && tag !== 'input' && tag !== 'textarea') {
+      e.preventDefault();
+      input.value = '';
+      dlg.showModal();
+      input.focus();
+      search();
+    }
+  });
+
+  input.addEventListener('input', search);
+  input.addEventListener('keydown', (e) => {
+    if (e.key === 'ArrowDown') { selected = Math.min(selected + 1, results.length - 1); render(); e.preventDefault(); }
+    if (e.key === 'ArrowUp') { selected = Math.max(selected - 1, 0); render(); e.preventDefault(); }
+    if (e.key === 'Enter' && results[selected]) { window.location.href = results[selected].href; }
+  });
+})();`
@@ -0,0 +1,40 @@
+package env
+
+import "testing"
+
+func TestSearchPalette(t *testing.T) {
+	items := []PaletteItem{
+		{Kind: "page", Title: "Config", Href: "/config"},
+		{Kind: "service", Title: "joeblew999/config-api", Href: "/changelog/joeblew999/config-api"},
+		{Kind: "process", Title: "ticker", Href: "/processes"},
+		{Kind: "page", Title: "Dashboard", Href: "/"},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{"empty query lists all by kind", "", 10, []string{"Config", "Dashboard", "ticker", "joeblew999/config-api"}},
+		{"prefix matches first", "conf", 10, []string{"Config", "joeblew999/config-api"}},
+		{"case-insensitive", "TICK", 10, []string{"ticker"}},
+		{"matches kind", "process", 10, []string{"ticker"}},
+		{"limit", "", 2, []string{"Config", "Dashboard"}},
+		{"no match", "nothing", 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchPalette(items, tt.query, tt.limit)
+			if len(got) != len(tt.want) {
+				t.Fatalf("searchPalette() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Title != tt.want[i] {
+					t.Errorf("result[%d] = %q, want %q", i, got[i].Title, tt.want[i])
+				}
+			}
+		})
+	}
+}
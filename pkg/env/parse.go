@@ -0,0 +1,64 @@
+// parse.go: Typed Parse helpers
+//
+// Parse[T] returns the config instead of filling a pointer, and MustParse
+// handles --help and errors the way every main() does by hand:
+//
+//	func main() {
+//	    mgr, _ := env.New("APP")
+//	    defer mgr.Close()
+//
+//	    cfg := env.MustParse[Config](mgr) // Prints help and exits on --help
+//	}
+package env
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ardanlabs/conf/v3"
+)
+
+// ErrHelpWanted is returned by Parse[T] after printing the help text for
+// --help (the same error as conf.ErrHelpWanted)
+var ErrHelpWanted = conf.ErrHelpWanted
+
+// Where Parse[T] prints help and MustParse reports errors; replaced in tests
+var (
+	helpOutput  io.Writer = os.Stdout
+	errorOutput io.Writer = os.Stderr
+	exit                  = os.Exit
+)
+
+// Parse parses the config struct T like Manager.Parse and returns it. On
+// --help it prints the help text and returns ErrHelpWanted.
+func Parse[T any](mgr *Manager) (T, error) {
+	var cfg T
+	help, err := mgr.Parse(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+	if help != "" {
+		fmt.Fprintln(helpOutput, help)
+		return cfg, ErrHelpWanted
+	}
+	return cfg, nil
+}
+
+// MustParse is Parse that closes the manager and exits on --help (status
+// 0) or an error (status 1)
+func MustParse[T any](mgr *Manager) T {
+	cfg, err := Parse[T](mgr)
+	if err == nil {
+		return cfg
+	}
+
+	code := 0
+	if err != ErrHelpWanted {
+		fmt.Fprintf(errorOutput, "%s: %v\n", mgr.Prefix(), err)
+		code = 1
+	}
+	mgr.Close()
+	exit(code)
+	return cfg // Only reached when exit is replaced in tests
+}
@@ -0,0 +1,36 @@
+package env
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMustParseExitsOnError(t *testing.T) {
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+
+	var stderr bytes.Buffer
+	code := -1
+	oldOutput, oldExit := errorOutput, exit
+	errorOutput, exit = &stderr, func(c int) { code = c }
+	t.Cleanup(func() { errorOutput, exit = oldOutput, oldExit })
+
+	m, err := New("APP", WithoutNATS())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	m.Close()
+
+	if _, err := Parse[config](m); err == nil {
+		t.Error("Parse() after Close succeeded, want error")
+	}
+	cfg := MustParse[config](m)
+	if code != 1 || cfg.Port != 0 {
+		t.Errorf("MustParse() = %+v, exit %d; want zero config, exit 1", cfg, code)
+	}
+	if !strings.HasPrefix(stderr.String(), "APP: ") {
+		t.Errorf("stderr = %q, want the error prefixed with APP", stderr.String())
+	}
+}
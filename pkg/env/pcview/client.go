@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/joeblew999/wellnown-env/pkg/env"
@@ -70,6 +71,65 @@ func (c *Client) Control(action, name string) error {
 	return nil
 }
 
+// ProcessLogs fetches the last limit lines of a process's log
+func (c *Client) ProcessLogs(name string, limit int) ([]string, error) {
+	resp, err := c.httpClient.Get(fmt.Sprintf("%s/process/logs/%s/0/%d", c.baseURL, url.PathEscape(name), limit))
+	if err != nil {
+		return nil, fmt.Errorf("fetch logs of %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var logs struct {
+		Logs []string `json:"logs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return nil, fmt.Errorf("decode logs of %s: %w", name, err)
+	}
+	return logs.Logs, nil
+}
+
+// ProcessDefinition fetches the configuration of a process
+func (c *Client) ProcessDefinition(name string) (ProcessDefinition, error) {
+	resp, err := c.httpClient.Get(fmt.Sprintf("%s/process/info/%s", c.baseURL, url.PathEscape(name)))
+	if err != nil {
+		return ProcessDefinition{}, fmt.Errorf("fetch definition of %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return ProcessDefinition{}, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var def ProcessDefinition
+	if err := json.NewDecoder(resp.Body).Decode(&def); err != nil {
+		return ProcessDefinition{}, fmt.Errorf("decode definition of %s: %w", name, err)
+	}
+	return def, nil
+}
+
+// Scale sets the number of replicas of a process
+func (c *Client) Scale(name string, replicas int) error {
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/process/scale/%s/%d", c.baseURL, url.PathEscape(name), replicas), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("scale %s to %d: %w", name, replicas, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // Start starts a process
 func (c *Client) Start(name string) error {
 	return c.Control("start", name)
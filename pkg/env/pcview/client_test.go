@@ -1,11 +1,15 @@
 package pcview
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/joeblew999/wellnown-env/pkg/env"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,6 +27,10 @@ func mockPCServer(t *testing.T, processes []ProcessState) *httptest.Server {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(`{}`))
 
+		case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/process/scale/"):
+			// Handle /process/scale/{name}/{replicas}
+			w.WriteHeader(http.StatusOK)
+
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
@@ -71,6 +79,14 @@ func TestClient_StartStopRestart(t *testing.T) {
 	assert.NoError(t, client.Restart("counter"))
 }
 
+func TestClient_Scale(t *testing.T) {
+	server := mockPCServer(t, nil)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	assert.NoError(t, client.Scale("worker", 3))
+}
+
 func TestClient_ConnectionError(t *testing.T) {
 	// Create client with invalid URL
 	client := NewClient("http://localhost:99999")
@@ -112,6 +128,11 @@ func (m *MockController) Restart(name string) error {
 	return m.Control("restart", name)
 }
 
+func (m *MockController) Scale(name string, replicas int) error {
+	m.actions = append(m.actions, fmt.Sprintf("scale:%s:%d", name, replicas))
+	return nil
+}
+
 func TestMockController(t *testing.T) {
 	// MockController can be used for testing Via pages
 	mock := &MockController{
@@ -134,3 +155,16 @@ func TestMockController(t *testing.T) {
 	assert.Contains(t, mock.actions, "start:counter")
 	assert.Contains(t, mock.actions, "stop:ticker")
 }
+
+func TestFleetHandler(t *testing.T) {
+	mock := &MockController{}
+	handle := FleetHandler(mock)
+	ctx := context.Background()
+
+	assert.NoError(t, handle(ctx, env.FleetCommand{Action: "restart", Target: "camera"}))
+	assert.Equal(t, []string{"restart:camera"}, mock.actions)
+
+	assert.Error(t, handle(ctx, env.FleetCommand{Action: "restart"}))
+	assert.Error(t, handle(ctx, env.FleetCommand{Action: "reboot", Target: "camera"}))
+	assert.Len(t, mock.actions, 1)
+}
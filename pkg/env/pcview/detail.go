@@ -0,0 +1,387 @@
+package pcview
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-via/via"
+	. "github.com/go-via/via/h"
+)
+
+// DefinitionSource reads process definitions from the loaded project.
+// Client reads them from the process-compose API; an embedded runner can
+// implement it directly.
+type DefinitionSource interface {
+	// ProcessDefinition returns how a process is configured
+	ProcessDefinition(name string) (ProcessDefinition, error)
+}
+
+// ProcessDefinition is a process as configured in the project, in the
+// JSON shape of process-compose's process config
+type ProcessDefinition struct {
+	Name           string                       `json:"name"`
+	Command        string                       `json:"command"`
+	WorkingDir     string                       `json:"working_dir,omitempty"`
+	Environment    []string                     `json:"environment,omitempty"` // KEY=value
+	DependsOn      map[string]ProcessDependency `json:"depends_on,omitempty"`
+	ReadinessProbe *Probe                       `json:"readiness_probe,omitempty"`
+	LivenessProbe  *Probe                       `json:"liveness_probe,omitempty"`
+	Availability   RestartPolicy                `json:"availability"`
+	Replicas       int                          `json:"replicas,omitempty"`
+}
+
+// ProcessDependency is the condition a dependency must reach first, e.g.
+// process_healthy
+type ProcessDependency struct {
+	Condition string `json:"condition"`
+}
+
+// Probe is a readiness or liveness check
+type Probe struct {
+	Exec             *ExecProbe `json:"exec,omitempty"`
+	HTTPGet          *HTTPProbe `json:"http_get,omitempty"`
+	InitialDelay     int        `json:"initial_delay_seconds,omitempty"`
+	PeriodSeconds    int        `json:"period_seconds,omitempty"`
+	TimeoutSeconds   int        `json:"timeout_seconds,omitempty"`
+	FailureThreshold int        `json:"failure_threshold,omitempty"`
+}
+
+// ExecProbe runs a command; exit code 0 passes
+type ExecProbe struct {
+	Command string `json:"command"`
+}
+
+// HTTPProbe requests a URL; a 2xx status passes
+type HTTPProbe struct {
+	Scheme string    `json:"scheme,omitempty"`
+	Host   string    `json:"host"`
+	Port   probePort `json:"port"`
+	Path   string    `json:"path,omitempty"`
+}
+
+// probePort is a probe port; process-compose writes it as a number or,
+// when it comes from an env var, a string
+type probePort string
+
+// UnmarshalJSON accepts both forms
+func (p *probePort) UnmarshalJSON(b []byte) error {
+	if s, err := strconv.Unquote(string(b)); err == nil {
+		*p = probePort(s)
+		return nil
+	}
+	*p = probePort(b)
+	return nil
+}
+
+// RestartPolicy is when process-compose restarts a process
+type RestartPolicy struct {
+	Restart        string `json:"restart,omitempty"` // always, on_failure, exit_on_failure, no
+	BackoffSeconds int    `json:"backoff_seconds,omitempty"`
+	MaxRestarts    int    `json:"max_restarts,omitempty"`
+}
+
+// ProcessPageOptions configures the process detail pages
+type ProcessPageOptions struct {
+	// NavBar returns the navigation bar H element
+	NavBar func(title string) H
+	// SyncInterval is how often an open page checks State for changes to render (default: DefaultSyncInterval)
+	SyncInterval time.Duration
+}
+
+// maxExitCodes is how many recent exit codes a detail page lists
+const maxExitCodes = 10
+
+// RegisterProcessPage registers the /processes/{name} pages with Via. Each
+// shows the definition of one process from src (command, environment,
+// dependencies, probes, restart policy) next to its runtime state and the
+// history State recorded: recent exit codes and restarts.
+func RegisterProcessPage(v *via.V, src DefinitionSource, state *State, opts ProcessPageOptions) {
+	v.Page("/processes/{name}", func(c *via.Context) {
+		name := c.GetPathParam("name")
+
+		var (
+			def     ProcessDefinition
+			lastErr string
+		)
+		load := func() {
+			d, err := src.ProcessDefinition(name)
+			if err != nil {
+				lastErr = err.Error()
+				return
+			}
+			def, lastErr = d, ""
+		}
+		load()
+
+		refresh := c.Action(func() {
+			load()
+			c.Sync()
+		})
+
+		Follow(c, state, opts.SyncInterval)
+
+		c.View(func() H {
+			processes, _ := state.GetProcesses()
+			var proc *ProcessState
+			for i := range processes {
+				if processes[i].Name == name {
+					proc = &processes[i]
+				}
+			}
+			history := state.History(name)
+
+			var navEl H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Processes")
+			}
+
+			return Main(Class("container"),
+				navEl,
+				Section(
+					P(A(Href("/processes"), Text("← All processes"))),
+					H1(Text(name)),
+					runtimeSummary(proc),
+					Button(ID("refresh"), Text("Refresh"), refresh.OnClick()),
+				),
+				messageRegion(lastErr, ""),
+				definitionSection(def),
+				historySection(history),
+			)
+		})
+	})
+}
+
+// runtimeSummary describes the current state of a process
+func runtimeSummary(proc *ProcessState) H {
+	if proc == nil {
+		return P(Small(Text("Not reported by process-compose.")))
+	}
+	status := proc.Status
+	if proc.IsRunning {
+		status = "Running"
+	}
+	parts := []string{status}
+	if proc.Pid != 0 {
+		parts = append(parts, fmt.Sprintf("PID %d", proc.Pid))
+	}
+	if proc.Health != "" {
+		parts = append(parts, proc.Health)
+	}
+	parts = append(parts, fmt.Sprintf("%d restarts", proc.Restarts))
+	return P(Text(strings.Join(parts, " · ")))
+}
+
+// definitionSection renders the definition of a process
+func definitionSection(def ProcessDefinition) H {
+	if def.Name == "" {
+		return nil
+	}
+
+	items := []H{
+		Dt(Text("Command")), Dd(Code(Text(def.Command))),
+	}
+	if def.WorkingDir != "" {
+		items = append(items, Dt(Text("Working directory")), Dd(Code(Text(def.WorkingDir))))
+	}
+	if def.Replicas > 1 {
+		items = append(items, Dt(Text("Replicas")), Dd(Textf("%d", def.Replicas)))
+	}
+	items = append(items, Dt(Text("Restart policy")), Dd(Text(restartPolicy(def.Availability))))
+	items = append(items, Dt(Text("Depends on")), Dd(dependencies(def.DependsOn)))
+	items = append(items, Dt(Text("Readiness probe")), Dd(Text(describeProbe(def.ReadinessProbe))))
+	if def.LivenessProbe != nil {
+		items = append(items, Dt(Text("Liveness probe")), Dd(Text(describeProbe(def.LivenessProbe))))
+	}
+	if ports := definitionPorts(def); len(ports) > 0 {
+		items = append(items, Dt(Text("Ports")), Dd(Text(strings.Join(ports, ", "))))
+	}
+
+	return Article(
+		Header(Strong(Text("Definition"))),
+		Dl(items...),
+		environmentTable(def.Environment),
+	)
+}
+
+// restartPolicy describes a restart policy
+func restartPolicy(p RestartPolicy) string {
+	restart := cmp.Or(p.Restart, "no")
+	if restart == "no" {
+		return "never restarted"
+	}
+	s := restart
+	if p.BackoffSeconds > 0 {
+		s += fmt.Sprintf(", %ds backoff", p.BackoffSeconds)
+	}
+	if p.MaxRestarts > 0 {
+		s += fmt.Sprintf(", at most %d restarts", p.MaxRestarts)
+	}
+	return s
+}
+
+// dependencies lists the dependencies of a process, linked to their pages
+func dependencies(deps map[string]ProcessDependency) H {
+	if len(deps) == 0 {
+		return Text("none")
+	}
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	items := make([]H, 0, len(names))
+	for _, name := range names {
+		items = append(items, Li(A(Href("/processes/"+name), Text(name)),
+			Small(Textf(" (%s)", cmp.Or(deps[name].Condition, "process_started")))))
+	}
+	return Ul(items...)
+}
+
+// describeProbe describes a readiness or liveness probe
+func describeProbe(p *Probe) string {
+	if p == nil {
+		return "none"
+	}
+	var check string
+	switch {
+	case p.Exec != nil:
+		check = "exec " + p.Exec.Command
+	case p.HTTPGet != nil:
+		check = "GET " + p.HTTPGet.url()
+	default:
+		check = "unknown check"
+	}
+	if p.PeriodSeconds > 0 {
+		check += fmt.Sprintf(" every %ds", p.PeriodSeconds)
+	}
+	if p.InitialDelay > 0 {
+		check += fmt.Sprintf(" after %ds", p.InitialDelay)
+	}
+	if p.FailureThreshold > 0 {
+		check += fmt.Sprintf(", fails after %d", p.FailureThreshold)
+	}
+	return check
+}
+
+// url returns the URL an HTTP probe requests
+func (p HTTPProbe) url() string {
+	return fmt.Sprintf("%s://%s:%s%s", cmp.Or(p.Scheme, "http"), cmp.Or(p.Host, "127.0.0.1"), p.Port, p.Path)
+}
+
+// portVar matches env vars holding a port or listen address
+var portVar = regexp.MustCompile(`(?i)(^|_)(PORT|ADDR)$`)
+
+// definitionPorts returns the ports a process uses as far as its
+// definition tells: HTTP probe ports and PORT/ADDR env vars
+func definitionPorts(def ProcessDefinition) []string {
+	var ports []string
+	for _, p := range []*Probe{def.ReadinessProbe, def.LivenessProbe} {
+		if p != nil && p.HTTPGet != nil && p.HTTPGet.Port != "" {
+			ports = append(ports, string(p.HTTPGet.Port)+" (probe)")
+		}
+	}
+	for _, kv := range def.Environment {
+		if key, value, ok := strings.Cut(kv, "="); ok && value != "" && portVar.MatchString(key) {
+			ports = append(ports, value+" ("+key+")")
+		}
+	}
+	return slices.Compact(ports)
+}
+
+// secretVar matches env vars whose values are masked
+var secretVar = regexp.MustCompile(`(?i)(PASSWORD|SECRET|TOKEN|KEY|CREDENTIAL)`)
+
+// envValue returns the displayed value of an env var
+func envValue(key, value string) string {
+	if value != "" && secretVar.MatchString(key) {
+		return "********"
+	}
+	return value
+}
+
+// environmentTable renders the environment of a process, secrets masked
+func environmentTable(environment []string) H {
+	if len(environment) == 0 {
+		return P(Small(Text("No environment variables set.")))
+	}
+	vars := slices.Clone(environment)
+	slices.Sort(vars)
+
+	rows := make([]H, 0, len(vars))
+	for _, kv := range vars {
+		key, value, _ := strings.Cut(kv, "=")
+		rows = append(rows, Tr(Td(Code(Text(key))), Td(Code(Text(envValue(key, value))))))
+	}
+	return Details(
+		Summary(Textf("Environment (%d)", len(vars))),
+		Table(THead(Tr(Th(Text("Variable")), Th(Text("Value")))), TBody(rows...)),
+	)
+}
+
+// historySection renders the recorded runtime changes of a process,
+// newest first, and its recent exit codes
+func historySection(history []ProcessEvent) H {
+	if len(history) == 0 {
+		return Article(Header(Strong(Text("History"))), P(Small(Text("No changes seen yet."))))
+	}
+
+	codes := exitCodes(history)
+	codesText := "none"
+	if len(codes) > 0 {
+		strs := make([]string, len(codes))
+		for i, code := range codes {
+			strs[i] = strconv.Itoa(code)
+		}
+		codesText = strings.Join(strs, ", ")
+	}
+
+	rows := make([]H, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		e := history[i]
+		exit := "-"
+		if e.exited() {
+			exit = strconv.Itoa(e.ExitCode)
+		}
+		rows = append(rows, Tr(
+			Td(Small(Text(e.Time.Format(time.TimeOnly)))),
+			Td(Text(e.Status)),
+			Td(Text(exit)),
+			Td(Textf("%d", e.Restarts)),
+		))
+	}
+
+	return Article(
+		Header(Strong(Text("History"))),
+		P(Text("Recent exit codes: "), Code(Text(codesText))),
+		Table(
+			THead(Tr(Th(Text("Time")), Th(Text("Status")), Th(Text("Exit code")), Th(Text("Restarts")))),
+			TBody(rows...),
+		),
+	)
+}
+
+// exitStatuses are the process-compose statuses of a process that exited
+var exitStatuses = map[string]bool{"Completed": true, "Error": true, "Restarting": true}
+
+// exited reports whether the event is the process exiting
+func (e ProcessEvent) exited() bool {
+	return !e.IsRunning && exitStatuses[e.Status]
+}
+
+// exitCodes returns the exit codes of the last exits in history, newest
+// first
+func exitCodes(history []ProcessEvent) []int {
+	var codes []int
+	for i := len(history) - 1; i >= 0 && len(codes) < maxExitCodes; i-- {
+		if history[i].exited() {
+			codes = append(codes, history[i].ExitCode)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,83 @@
+package pcview
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_ProcessDefinition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/process/info/api" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{
+			"name": "api",
+			"command": "./api --serve",
+			"environment": ["API_PORT=8080", "DB_PASSWORD=hunter2"],
+			"depends_on": {"nats": {"condition": "process_healthy"}},
+			"readiness_probe": {"http_get": {"host": "127.0.0.1", "port": "8080", "path": "/healthz"}, "period_seconds": 5},
+			"liveness_probe": {"http_get": {"host": "127.0.0.1", "port": 9090, "path": "/live"}},
+			"availability": {"restart": "on_failure", "backoff_seconds": 2, "max_restarts": 5}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	def, err := client.ProcessDefinition("api")
+	assert.NoError(t, err)
+	assert.Equal(t, "./api --serve", def.Command)
+	assert.Equal(t, "process_healthy", def.DependsOn["nats"].Condition)
+	assert.Equal(t, "http://127.0.0.1:8080/healthz", def.ReadinessProbe.HTTPGet.url(), "string port")
+	assert.Equal(t, "http://127.0.0.1:9090/live", def.LivenessProbe.HTTPGet.url(), "number port")
+	assert.Equal(t, "on_failure, 2s backoff, at most 5 restarts", restartPolicy(def.Availability))
+	assert.Equal(t, []string{"8080 (probe)", "9090 (probe)", "8080 (API_PORT)"}, definitionPorts(def))
+
+	_, err = client.ProcessDefinition("missing")
+	assert.Error(t, err)
+}
+
+func TestEnvValue(t *testing.T) {
+	assert.Equal(t, "8080", envValue("API_PORT", "8080"))
+	assert.Equal(t, "********", envValue("DB_PASSWORD", "hunter2"))
+	assert.Equal(t, "********", envValue("NATS_TOKEN", "s3cret"))
+	assert.Equal(t, "", envValue("NATS_TOKEN", ""))
+}
+
+func TestState_History(t *testing.T) {
+	state := NewState()
+	running := ProcessState{Name: "worker", Status: "Running", IsRunning: true}
+	failed := ProcessState{Name: "worker", Status: "Error", ExitCode: 2, Restarts: 1}
+
+	state.SetProcesses([]ProcessState{running}, "")
+	state.SetProcesses([]ProcessState{running}, "")
+	state.SetProcesses(nil, "connection refused")
+	state.SetProcesses([]ProcessState{running}, "")
+	assert.Len(t, state.History("worker"), 1, "unchanged states and API errors add nothing")
+
+	state.SetProcesses([]ProcessState{failed}, "")
+	running.Restarts = 1
+	state.SetProcesses([]ProcessState{running}, "")
+
+	history := state.History("worker")
+	assert.Len(t, history, 3)
+	assert.Equal(t, "Error", history[1].Status)
+	assert.Equal(t, []int{2}, exitCodes(history))
+	assert.Empty(t, state.History("other"))
+}
+
+func TestExitCodes(t *testing.T) {
+	now := time.Now()
+	history := []ProcessEvent{
+		{Time: now, Status: "Pending"},
+		{Time: now, Status: "Completed", ExitCode: 0},
+		{Time: now, Status: "Running", IsRunning: true},
+		{Time: now, Status: "Restarting", ExitCode: 137},
+		{Time: now, Status: "Disabled"},
+	}
+	assert.Equal(t, []int{137, 0}, exitCodes(history), "exits only, newest first")
+}
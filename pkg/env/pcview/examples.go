@@ -1,21 +1,33 @@
 package pcview
 
 import (
+	"time"
+
 	"github.com/go-via/via"
 	. "github.com/go-via/via/h"
+	"github.com/joeblew999/wellnown-env/pkg/env"
 )
 
 // ExampleProcesses defines the built-in demo processes for regression testing
 var ExampleProcesses = []string{"ticker", "counter", "logger"}
 
+// bulkKey guards the Start/Stop/Restart All buttons
+const bulkKey = "bulk:"
+
 // ExamplesPageOptions configures the examples page
 type ExamplesPageOptions struct {
 	// NavBar returns the navigation bar H element
 	NavBar func(title string) H
+	// Compact always renders processes as cards (default: cards on narrow viewports only)
+	Compact bool
+	// SyncInterval is how often an open page checks State for changes to render (default: DefaultSyncInterval)
+	SyncInterval time.Duration
 }
 
 // RegisterExamplesPage registers the /examples page for demo process testing
 func RegisterExamplesPage(v *via.V, client ProcessController, state *State, opts ExamplesPageOptions) {
+	guard := env.NewActionGuard(env.DefaultActionCooldown)
+
 	v.Page("/examples", func(c *via.Context) {
 		var lastAction string
 		var lastError string
@@ -23,66 +35,91 @@ func RegisterExamplesPage(v *via.V, client ProcessController, state *State, opts
 		// Helper to create control actions for examples
 		makeControl := func(action, name, msg string) H {
 			return c.Action(func() {
-				if err := client.Control(action, name); err != nil {
-					lastError = err.Error()
-					lastAction = ""
-				} else {
-					lastAction = msg
-					lastError = ""
+				ran := guard.Do(name, func() {
+					c.Sync() // Render the busy state while the call runs
+					if err := client.Control(action, name); err != nil {
+						lastError = err.Error()
+						lastAction = ""
+					} else {
+						lastAction = msg
+						lastError = ""
+					}
+				})
+				if ran {
+					c.Sync()
 				}
-				c.Sync()
 			}).OnClick()
 		}
 
-		// Quick actions for all demo processes
+		// Quick actions for all demo processes (one bulk action at a time)
 		startAll := c.Action(func() {
-			for _, name := range ExampleProcesses {
-				if err := client.Start(name); err != nil {
-					lastError = err.Error()
-					return
+			if guard.Do(bulkKey, func() {
+				c.Sync()
+				for _, name := range ExampleProcesses {
+					if err := client.Start(name); err != nil {
+						lastError = err.Error()
+						return
+					}
 				}
+				lastAction = "Started all demo processes"
+				lastError = ""
+			}) {
+				c.Sync()
 			}
-			lastAction = "Started all demo processes"
-			lastError = ""
-			c.Sync()
 		})
 
 		stopAll := c.Action(func() {
-			for _, name := range ExampleProcesses {
-				if err := client.Stop(name); err != nil {
-					// Ignore errors for already stopped processes
-					continue
+			if guard.Do(bulkKey, func() {
+				c.Sync()
+				for _, name := range ExampleProcesses {
+					if err := client.Stop(name); err != nil {
+						// Ignore errors for already stopped processes
+						continue
+					}
 				}
+				lastAction = "Stopped all demo processes"
+				lastError = ""
+			}) {
+				c.Sync()
 			}
-			lastAction = "Stopped all demo processes"
-			lastError = ""
-			c.Sync()
 		})
 
 		restartAll := c.Action(func() {
-			for _, name := range ExampleProcesses {
-				if err := client.Restart(name); err != nil {
-					lastError = err.Error()
-					return
+			if guard.Do(bulkKey, func() {
+				c.Sync()
+				for _, name := range ExampleProcesses {
+					if err := client.Restart(name); err != nil {
+						lastError = err.Error()
+						return
+					}
 				}
+				lastAction = "Restarted all demo processes"
+				lastError = ""
+			}) {
+				c.Sync()
 			}
-			lastAction = "Restarted all demo processes"
-			lastError = ""
-			c.Sync()
 		})
 
+		table := env.NewTable(c, processColumns()...).SetCompact(opts.Compact)
+
 		// Refresh action
 		refresh := c.Action(func() {
-			procs, err := client.GetProcesses()
-			if err != nil {
-				lastError = err.Error()
-			} else {
-				state.SetProcesses(procs, "")
-				lastError = ""
+			ran := guard.Do(refreshKey, func() {
+				procs, err := client.GetProcesses()
+				if err != nil {
+					lastError = err.Error()
+				} else {
+					state.SetProcesses(procs, "")
+					lastError = ""
+				}
+			})
+			if ran {
+				c.Sync()
 			}
-			c.Sync()
 		})
 
+		Follow(c, state, opts.SyncInterval)
+
 		c.View(func() H {
 			processes, stateErr := state.GetProcesses()
 			if stateErr != "" && lastError == "" {
@@ -95,69 +132,49 @@ func RegisterExamplesPage(v *via.V, client ProcessController, state *State, opts
 				exampleSet[name] = true
 			}
 
-			var rows []H
+			var rows []env.TableRow
 			for _, proc := range processes {
 				if !exampleSet[proc.Name] {
 					continue
 				}
 
-				statusEl := Del(Text(proc.Status))
-				if proc.IsRunning {
-					statusEl = Ins(Text("Running"))
-				}
-
-				health := proc.Health
-				if health == "" {
-					health = "N/A"
-				}
-
 				var actionsEl H
+				busy := guard.Busy(proc.Name)
 				if proc.IsRunning {
 					actionsEl = Div(Role("group"),
-						Button(Text("Stop"), Class("secondary outline"), makeControl("stop", proc.Name, "Stopped "+proc.Name)),
-						Button(Text("Restart"), Class("contrast outline"), makeControl("restart", proc.Name, "Restarted "+proc.Name)),
+						controlButton("Stop", proc.Name, "secondary outline", busy, makeControl("stop", proc.Name, "Stopped "+proc.Name)),
+						controlButton("Restart", proc.Name, "contrast outline", busy, makeControl("restart", proc.Name, "Restarted "+proc.Name)),
 					)
 				} else {
-					actionsEl = Button(Text("Start"), makeControl("start", proc.Name, "Started "+proc.Name))
+					actionsEl = controlButton("Start", proc.Name, "", busy, makeControl("start", proc.Name, "Started "+proc.Name))
 				}
 
-				rows = append(rows, Tr(
-					Td(Strong(Text(proc.Name))),
-					Td(statusEl),
-					Td(Code(Textf("%d", proc.Pid))),
-					Td(Text(health)),
-					Td(Textf("%d", proc.Restarts)),
-					Td(actionsEl),
-				))
+				rows = append(rows, processRow(proc, actionsEl))
 			}
 
-			var messageEl H
-			if lastError != "" {
-				messageEl = Article(Attr("data-theme", "light"),
-					P(Class("pico-color-red"), Strong(Text("Error: ")), Text(lastError)))
-			} else if lastAction != "" {
-				messageEl = Article(Attr("data-theme", "light"),
-					P(Class("pico-color-green"), Strong(Text("Action: ")), Text(lastAction)))
-			}
+			messageEl := messageRegion(lastError, lastAction)
 
 			var navEl H
 			if opts.NavBar != nil {
 				navEl = opts.NavBar("Examples")
 			}
 
+			bulkBusy := guard.Busy(bulkKey)
+
 			return Main(Class("container"),
 				navEl,
 				Section(
 					H1(Text("Demo Processes")),
 					P(Text("Built-in example processes for regression testing")),
 					Div(Role("group"),
-						Button(Text("Refresh"), refresh.OnClick()),
-						Button(Text("Start All"), Class("secondary"), startAll.OnClick()),
-						Button(Text("Stop All"), Class("secondary outline"), stopAll.OnClick()),
-						Button(Text("Restart All"), Class("contrast outline"), restartAll.OnClick()),
+						Button(append(env.BusyAttrs(guard.Busy(refreshKey)), ID("refresh"), Text("Refresh"), refresh.OnClick())...),
+						Button(append(env.BusyAttrs(bulkBusy), ID("start-all"), Text("Start All"), Class("secondary"), startAll.OnClick())...),
+						Button(append(env.BusyAttrs(bulkBusy), ID("stop-all"), Text("Stop All"), Class("secondary outline"), stopAll.OnClick())...),
+						Button(append(env.BusyAttrs(bulkBusy), ID("restart-all"), Text("Restart All"), Class("contrast outline"), restartAll.OnClick())...),
 					),
 				),
 				messageEl,
+				statusSummary(processes),
 				Article(
 					H4(Text("Example Processes")),
 					P(Small(Text("These 3 demo processes are defined in pc.yaml:"))),
@@ -167,13 +184,7 @@ func RegisterExamplesPage(v *via.V, client ProcessController, state *State, opts
 						Li(Strong(Text("logger")), Text(" - Logs status every 10 seconds (depends on ticker & counter)")),
 					),
 				),
-				Figure(Table(Role("grid"),
-					THead(Tr(
-						Th(Text("Process")), Th(Text("Status")), Th(Text("PID")),
-						Th(Text("Health")), Th(Text("Restarts")), Th(Text("Actions")),
-					)),
-					TBody(rows...),
-				)),
+				table.Render(rows),
 				Hr(),
 				Article(
 					H5(Text("Regression Test Scenarios")),
@@ -0,0 +1,35 @@
+// follow.go: Live refresh of pages showing State, coalesced per page
+//
+// Pages re-render when the processes change, but not on every update: each
+// open page checks State.Version on its own interval and syncs once if it
+// moved. A burst of updates costs one render per page per interval, and
+// updates that repeat the same content (pc-node polls every 2s, NATS
+// publishes idle processes) cost none, so CPU stays flat as viewers and
+// update rates grow:
+//
+//	pcview.Follow(c, state, pcview.DefaultSyncInterval)
+package pcview
+
+import (
+	"time"
+
+	"github.com/go-via/via"
+)
+
+// DefaultSyncInterval is how often a following page checks State for changes
+const DefaultSyncInterval = 500 * time.Millisecond
+
+// Follow re-renders the page whenever state changed, at most once per
+// interval (default: DefaultSyncInterval), for as long as the page is open
+func Follow(c *via.Context, state *State, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	seen := state.Version()
+	c.OnInterval(interval, func() {
+		if v := state.Version(); v != seen {
+			seen = v
+			c.Sync()
+		}
+	}).Start()
+}
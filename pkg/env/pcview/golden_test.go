@@ -0,0 +1,55 @@
+package pcview
+
+import (
+	"testing"
+
+	"github.com/go-via/via"
+	"github.com/joeblew999/wellnown-env/pkg/env/viatest/golden"
+)
+
+// goldenProcesses covers running, stopped and unhealthy rows
+var goldenProcesses = []ProcessState{
+	{Name: "ticker", Status: "Running", IsRunning: true, Pid: 1234, Health: "healthy"},
+	{Name: "counter", Status: "Running", IsRunning: true, Pid: 1235, Health: "unhealthy", Restarts: 3},
+	{Name: "logger", Status: "Disabled", IsRunning: false},
+}
+
+func TestProcessesPageGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PageOptions
+	}{
+		{name: "processes", opts: PageOptions{PCPort: "8181"}},
+		{name: "processes_restricted", opts: PageOptions{PCPort: "8181", Controllable: []string{"ticker"}}},
+		{name: "processes_compact", opts: PageOptions{PCPort: "8181", Compact: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewState()
+			state.SetProcesses(goldenProcesses, "")
+
+			v := via.New()
+			RegisterPage(v, &MockController{processes: goldenProcesses}, state, tt.opts)
+			golden.AssertPage(t, v, "/processes", tt.name)
+		})
+	}
+}
+
+func TestProcessesPageGolden_Error(t *testing.T) {
+	state := NewState()
+	state.SetProcesses(nil, "connection refused")
+
+	v := via.New()
+	RegisterPage(v, &MockController{}, state, PageOptions{PCPort: "8181"})
+	golden.AssertPage(t, v, "/processes", "processes_error")
+}
+
+func TestExamplesPageGolden(t *testing.T) {
+	state := NewState()
+	state.SetProcesses(goldenProcesses, "")
+
+	v := via.New()
+	RegisterExamplesPage(v, &MockController{processes: goldenProcesses}, state, ExamplesPageOptions{})
+	golden.AssertPage(t, v, "/examples", "examples")
+}
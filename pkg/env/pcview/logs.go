@@ -0,0 +1,314 @@
+package pcview
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-via/via"
+	. "github.com/go-via/via/h"
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// LogSource reads process logs. Client reads them from the process-compose
+// API; an embedded runner can implement it directly.
+type LogSource interface {
+	// ProcessLogs returns the last limit lines of a process's log
+	ProcessLogs(name string, limit int) ([]string, error)
+}
+
+// Defaults of LogsPageOptions
+const (
+	DefaultLogLines    = 200
+	DefaultLogInterval = time.Second
+)
+
+// LogsPageOptions configures the logs page
+type LogsPageOptions struct {
+	// NavBar returns the navigation bar H element
+	NavBar func(title string) H
+	// Lines is how many recent lines are shown per process (default: DefaultLogLines)
+	Lines int
+	// Interval is how often a following page polls for new lines (default: DefaultLogInterval)
+	Interval time.Duration
+}
+
+// allProcesses selects every process on the logs page
+const allProcesses = ""
+
+// RegisterLogsPage registers the /logs page with Via. It shows the recent
+// log lines of every process in state, or of one selected process, with
+// error and warning lines highlighted. While following, the page polls src
+// and re-renders when lines arrive. Call env.RegisterLogPanes once so the
+// panes scroll to new lines and pause while hovered.
+func RegisterLogsPage(v *via.V, src LogSource, state *State, opts LogsPageOptions) {
+	lines := opts.Lines
+	if lines <= 0 {
+		lines = DefaultLogLines
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultLogInterval
+	}
+	v.AppendToHead(StyleEl(Raw(logLevelCSS)))
+
+	v.Page("/logs", func(c *via.Context) {
+		var (
+			mu       sync.Mutex
+			selected = allProcesses
+			follow   = true
+			logs     map[string][]string
+			lastErr  string
+		)
+
+		// fetch reads the selected logs; it reports whether they changed
+		fetch := func() bool {
+			mu.Lock()
+			name := selected
+			mu.Unlock()
+
+			procs, _ := state.GetProcesses()
+			got, err := fetchLogs(src, logNames(procs, name), lines)
+			errText := ""
+			if err != nil {
+				errText = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if name != selected {
+				return false // Selection changed while fetching
+			}
+			changed := errText != lastErr || !logsEqual(got, logs)
+			logs, lastErr = got, errText
+			return changed
+		}
+
+		target := c.Signal("")
+		choose := c.Action(func() {
+			mu.Lock()
+			selected = target.String()
+			logs = nil
+			mu.Unlock()
+			fetch()
+			c.Sync()
+		})
+		toggleFollow := c.Action(func() {
+			mu.Lock()
+			follow = !follow
+			mu.Unlock()
+			c.Sync()
+		})
+
+		fetch()
+		c.OnInterval(interval, func() {
+			mu.Lock()
+			on := follow
+			mu.Unlock()
+			if on && fetch() {
+				c.Sync()
+			}
+		}).Start()
+
+		c.View(func() H {
+			procs, _ := state.GetProcesses()
+
+			mu.Lock()
+			name, following, errText := selected, follow, lastErr
+			shown := logs
+			mu.Unlock()
+
+			filters := []H{Role("group"), ID("log-filter")}
+			for _, n := range append([]string{allProcesses}, processNames(procs)...) {
+				label := n
+				if n == allProcesses {
+					label = "All"
+				}
+				class := "outline"
+				if n == name {
+					class = ""
+				}
+				filters = append(filters, Button(ID("logs-"+strings.ToLower(label)), Class(class),
+					Attr("aria-pressed", ariaBool(n == name)), env.AriaLabel("Show logs of "+label),
+					choose.OnClick(via.WithSignal(target, n)), Text(label)))
+			}
+
+			followLabel := "Pause"
+			if !following {
+				followLabel = "Follow"
+			}
+
+			var errorEl H
+			if errText != "" {
+				errorEl = Article(Attr("data-theme", "light"),
+					P(Class("pico-color-red"), Strong(Text("Error: ")), Text(errText)))
+			}
+
+			var panes []H
+			for _, n := range logNames(procs, name) {
+				panes = append(panes, Article(
+					Header(Strong(Text(n))),
+					renderLog(n, shown[n]),
+				))
+			}
+			if len(panes) == 0 {
+				panes = append(panes, P(Small(Text("No processes to show logs for."))))
+			}
+
+			var navEl H
+			if opts.NavBar != nil {
+				navEl = opts.NavBar("Logs")
+			}
+
+			return Main(Class("container"),
+				navEl,
+				Section(
+					H1(Text("Process Logs")),
+					P(Text("Recent output of process-compose processes")),
+					Div(filters...),
+					Button(ID("logs-follow"), Class("secondary"), Attr("aria-pressed", ariaBool(following)),
+						toggleFollow.OnClick(), Text(followLabel)),
+				),
+				env.AlertRegion(errorEl),
+				Div(panes...),
+			)
+		})
+	})
+}
+
+// logNames returns the processes whose logs are shown: the selected one,
+// or all of them
+func logNames(procs []ProcessState, selected string) []string {
+	if selected != allProcesses {
+		return []string{selected}
+	}
+	return processNames(procs)
+}
+
+// processNames returns the sorted names of procs
+func processNames(procs []ProcessState) []string {
+	names := make([]string, 0, len(procs))
+	for _, proc := range procs {
+		names = append(names, proc.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// fetchLogs reads the last limit lines of each process. Processes that
+// fail are left out; the first error is returned with the rest.
+func fetchLogs(src LogSource, names []string, limit int) (map[string][]string, error) {
+	logs := make(map[string][]string, len(names))
+	var firstErr error
+	for _, name := range names {
+		lines, err := src.ProcessLogs(name, limit)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		logs[name] = lines
+	}
+	return logs, firstErr
+}
+
+// logsEqual reports whether two log snapshots hold the same lines
+func logsEqual(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, lines := range a {
+		other, ok := b[name]
+		if !ok || !slices.Equal(lines, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderLog renders the lines of one process as a log pane, each line
+// classed by its level
+func renderLog(name string, lines []string) H {
+	children := []H{ID("log-" + name), Class("wn-logpane"), Role("log"), Attr("tabindex", "0"),
+		env.AriaLabel("Log of " + name)}
+	for _, line := range lines {
+		line = env.StripANSI(line)
+		if level := LogLevel(line); level != "" {
+			children = append(children, Span(Class("pc-log-"+level), Text(line)))
+		} else {
+			children = append(children, Text(line))
+		}
+		children = append(children, Text("\n"))
+	}
+	return Pre(children...)
+}
+
+// Log levels detected by LogLevel
+const (
+	LevelError = "error"
+	LevelWarn  = "warn"
+	LevelInfo  = "info"
+	LevelDebug = "debug"
+)
+
+var (
+	// structuredLevel matches slog/logfmt (level=WARN) and JSON ("level":"warn") levels
+	structuredLevel = regexp.MustCompile(`(?i)"?(?:level|lvl|severity)"?\s*[=:]\s*"?([a-z]+)`)
+	// levelWords match free-form lines, most severe first
+	levelWords = []struct {
+		level string
+		re    *regexp.Regexp
+	}{
+		{LevelError, regexp.MustCompile(`(?i)\b(?:fatal|panic|error|erro|err)\b`)},
+		{LevelWarn, regexp.MustCompile(`(?i)\b(?:warning|warn|wrn)\b`)},
+		{LevelInfo, regexp.MustCompile(`(?i)\b(?:info|inf)\b`)},
+		{LevelDebug, regexp.MustCompile(`(?i)\b(?:debug|dbg|trace)\b`)},
+	}
+)
+
+// LogLevel guesses the level of a log line ("" = unknown). A structured
+// level field wins over level words in the message.
+func LogLevel(line string) string {
+	if m := structuredLevel.FindStringSubmatch(line); m != nil {
+		if level := normalizeLevel(m[1]); level != "" {
+			return level
+		}
+	}
+	for _, w := range levelWords {
+		if w.re.MatchString(line) {
+			return w.level
+		}
+	}
+	return ""
+}
+
+// normalizeLevel maps level names to the LogLevel levels
+func normalizeLevel(s string) string {
+	switch strings.ToLower(s) {
+	case "fatal", "panic", "error", "erro", "err", "crit", "critical":
+		return LevelError
+	case "warning", "warn", "wrn":
+		return LevelWarn
+	case "info", "inf", "notice":
+		return LevelInfo
+	case "debug", "dbg", "trace":
+		return LevelDebug
+	}
+	return ""
+}
+
+// ariaBool renders a bool for aria-* attributes
+func ariaBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// logLevelCSS colors lines by level inside the dark log panes
+const logLevelCSS = `.pc-log-error{color:#ff6b6b;font-weight:bold}
+.pc-log-warn{color:#f5c542}
+.pc-log-debug{color:#888}`
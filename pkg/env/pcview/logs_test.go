@@ -0,0 +1,83 @@
+package pcview
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`time=2026-01-02T15:04:05Z level=ERROR msg="connect failed"`, LevelError},
+		{`{"level":"warn","msg":"slow"}`, LevelWarn},
+		{`level=info msg="no error here"`, LevelInfo}, // The field wins over words
+		{`2026/01/02 15:04:05 [ERROR] disk full`, LevelError},
+		{`WARNING: config file missing`, LevelWarn},
+		{`DBG tick 42`, LevelDebug},
+		{`tick 42`, ""},
+		{`terrible news`, ""}, // Whole words only
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, LogLevel(tt.line), tt.line)
+	}
+}
+
+func TestClient_ProcessLogs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/process/logs/ticker/0/50" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"logs":["tick 1","tick 2"]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	lines, err := client.ProcessLogs("ticker", 50)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tick 1", "tick 2"}, lines)
+
+	_, err = client.ProcessLogs("missing", 50)
+	assert.Error(t, err)
+}
+
+// mockLogs is a LogSource serving fixed lines
+type mockLogs map[string][]string
+
+func (m mockLogs) ProcessLogs(name string, limit int) ([]string, error) {
+	lines, ok := m[name]
+	if !ok {
+		return nil, errors.New("no such process: " + name)
+	}
+	return lines[max(0, len(lines)-limit):], nil
+}
+
+func TestFetchLogs(t *testing.T) {
+	src := mockLogs{
+		"ticker":  {"tick 1", "tick 2", "tick 3"},
+		"counter": {"count 1"},
+	}
+	procs := []ProcessState{{Name: "ticker"}, {Name: "counter"}, {Name: "gone"}}
+
+	assert.Equal(t, []string{"counter", "gone", "ticker"}, logNames(procs, allProcesses))
+	assert.Equal(t, []string{"ticker"}, logNames(procs, "ticker"))
+
+	logs, err := fetchLogs(src, logNames(procs, allProcesses), 2)
+	assert.Error(t, err, "a failing process is reported")
+	assert.Equal(t, map[string][]string{
+		"ticker":  {"tick 2", "tick 3"},
+		"counter": {"count 1"},
+	}, logs, "the other processes are still shown")
+
+	again, _ := fetchLogs(src, logNames(procs, allProcesses), 2)
+	assert.True(t, logsEqual(logs, again))
+	src["ticker"] = append(src["ticker"], "tick 4")
+	again, _ = fetchLogs(src, logNames(procs, allProcesses), 2)
+	assert.False(t, logsEqual(logs, again), "new lines are a change")
+}
@@ -1,10 +1,12 @@
 package pcview
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/joeblew999/wellnown-env/pkg/env"
 	"github.com/nats-io/nats.go"
 )
 
@@ -68,7 +70,13 @@ func (h *NATSHandler) StartControlResponder() error {
 			return
 		}
 
-		if err := h.client.Control(req.Action, req.Name); err != nil {
+		var err error
+		if req.Action == "scale" {
+			err = h.client.Scale(req.Name, req.Replicas)
+		} else {
+			err = h.client.Control(req.Action, req.Name)
+		}
+		if err != nil {
 			respond(false, err.Error())
 		} else {
 			respond(true, "")
@@ -115,45 +123,33 @@ func (h *NATSHandler) PublishUpdate(states []ProcessState) error {
 
 // RequestProcesses sends a request to get current process state via NATS
 func (h *NATSHandler) RequestProcesses() ([]ProcessState, error) {
-	resp, err := h.nc.Request(SubjectStatus, nil, 2*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("request processes: %w", err)
-	}
-
-	// Check for error response
-	var errResp struct {
-		Error string `json:"error"`
-	}
-	if json.Unmarshal(resp.Data, &errResp) == nil && errResp.Error != "" {
-		return nil, fmt.Errorf("%s", errResp.Error)
-	}
-
-	var states []ProcessState
-	if err := json.Unmarshal(resp.Data, &states); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
-	return states, nil
+	return requestProcesses(h.nc, 2*time.Second)
 }
 
 // ControlViaNATS sends a control command via NATS
 func (h *NATSHandler) ControlViaNATS(action, name string) error {
-	req := ControlRequest{Action: action, Name: name}
-	body, _ := json.Marshal(req)
+	return requestControl(h.nc, ControlRequest{Action: action, Name: name}, DefaultNATSTimeout)
+}
 
-	resp, err := h.nc.Request(SubjectControl, body, 3*time.Second)
-	if err != nil {
-		return fmt.Errorf("control request: %w", err)
-	}
+// ScaleViaNATS sets the replicas of a process via NATS
+func (h *NATSHandler) ScaleViaNATS(name string, replicas int) error {
+	return requestControl(h.nc, ControlRequest{Action: "scale", Name: name, Replicas: replicas}, DefaultNATSTimeout)
+}
 
-	var out ControlResponse
-	if err := json.Unmarshal(resp.Data, &out); err != nil {
-		return fmt.Errorf("decode response: %w", err)
-	}
-	if !out.OK {
-		if out.Error != "" {
-			return fmt.Errorf("%s", out.Error)
+// FleetHandler runs start/stop/restart fleet commands on ctl's processes,
+// so one command reaches a process on every tagged node:
+//
+//	mgr.HandleFleetCommands(pcview.FleetHandler(client))
+func FleetHandler(ctl ProcessController) env.FleetHandler {
+	return func(ctx context.Context, cmd env.FleetCommand) error {
+		if cmd.Target == "" {
+			return fmt.Errorf("%s needs a process name", cmd.Action)
+		}
+		switch cmd.Action {
+		case "start", "stop", "restart":
+			return ctl.Control(cmd.Action, cmd.Target)
+		default:
+			return fmt.Errorf("unknown action: %s", cmd.Action)
 		}
-		return fmt.Errorf("control failed")
 	}
-	return nil
 }
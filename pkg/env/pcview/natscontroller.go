@@ -0,0 +1,135 @@
+package pcview
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultNATSTimeout is how long NATSController waits for an answer
+const DefaultNATSTimeout = 3 * time.Second
+
+// Errors of NATSController requests, wrapped with the request
+var (
+	// ErrNoResponder means no node serves process-compose on NATS: none
+	// called StartStatusResponder or StartControlResponder
+	ErrNoResponder = errors.New("no process-compose node on NATS")
+	// ErrNATSTimeout means the node did not answer in time
+	ErrNATSTimeout = errors.New("process-compose node did not answer in time")
+)
+
+// NATSController is a ProcessController that works over NATS instead of
+// the process-compose HTTP API. A NATSHandler answers it on the node that
+// runs process-compose, so a remote Via dashboard only needs NATS:
+//
+//	ctl := pcview.NewNATSController(mgr.NC(), 0)
+//	pcview.RegisterPage(v, ctl, state, pcview.PageOptions{})
+type NATSController struct {
+	nc      *nats.Conn
+	timeout time.Duration
+}
+
+// NewNATSController creates a controller sending requests on nc; each
+// waits up to timeout for the answer (0 = DefaultNATSTimeout)
+func NewNATSController(nc *nats.Conn, timeout time.Duration) *NATSController {
+	if timeout <= 0 {
+		timeout = DefaultNATSTimeout
+	}
+	return &NATSController{nc: nc, timeout: timeout}
+}
+
+// GetProcesses requests the process states from the node
+func (c *NATSController) GetProcesses() ([]ProcessState, error) {
+	return requestProcesses(c.nc, c.timeout)
+}
+
+// Control sends a control command (start/stop/restart) to a process
+func (c *NATSController) Control(action, name string) error {
+	return requestControl(c.nc, ControlRequest{Action: action, Name: name}, c.timeout)
+}
+
+// Start starts a process
+func (c *NATSController) Start(name string) error {
+	return c.Control("start", name)
+}
+
+// Stop stops a process
+func (c *NATSController) Stop(name string) error {
+	return c.Control("stop", name)
+}
+
+// Restart restarts a process
+func (c *NATSController) Restart(name string) error {
+	return c.Control("restart", name)
+}
+
+// Scale sets the number of replicas of a process
+func (c *NATSController) Scale(name string, replicas int) error {
+	return requestControl(c.nc, ControlRequest{Action: "scale", Name: name, Replicas: replicas}, c.timeout)
+}
+
+// requestProcesses requests the process states on SubjectStatus
+func requestProcesses(nc *nats.Conn, timeout time.Duration) ([]ProcessState, error) {
+	resp, err := nc.Request(SubjectStatus, nil, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("request processes: %w", natsError(err))
+	}
+	return decodeProcesses(resp.Data)
+}
+
+// decodeProcesses decodes a status answer: the states, or an error
+func decodeProcesses(data []byte) ([]ProcessState, error) {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+		return nil, fmt.Errorf("request processes: %s", errResp.Error)
+	}
+
+	var states []ProcessState
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return states, nil
+}
+
+// requestControl sends req on SubjectControl
+func requestControl(nc *nats.Conn, req ControlRequest, timeout time.Duration) error {
+	body, _ := json.Marshal(req)
+
+	resp, err := nc.Request(SubjectControl, body, timeout)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", req.Action, req.Name, natsError(err))
+	}
+	return decodeControl(req, resp.Data)
+}
+
+// decodeControl decodes a control answer into the request's error
+func decodeControl(req ControlRequest, data []byte) error {
+	var out ControlResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if !out.OK {
+		if out.Error != "" {
+			return fmt.Errorf("%s %s: %s", req.Action, req.Name, out.Error)
+		}
+		return fmt.Errorf("%s %s: control failed", req.Action, req.Name)
+	}
+	return nil
+}
+
+// natsError maps request errors to ErrNoResponder and ErrNATSTimeout,
+// keeping the original error in the chain
+func natsError(err error) error {
+	switch {
+	case errors.Is(err, nats.ErrNoResponders):
+		return fmt.Errorf("%w (%w)", ErrNoResponder, err)
+	case errors.Is(err, nats.ErrTimeout):
+		return fmt.Errorf("%w (%w)", ErrNATSTimeout, err)
+	}
+	return err
+}
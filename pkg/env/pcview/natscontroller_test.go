@@ -0,0 +1,47 @@
+package pcview
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// NATSController can stand in for the HTTP client on remote dashboards
+var _ ProcessController = (*NATSController)(nil)
+
+func TestNATSError(t *testing.T) {
+	err := natsError(nats.ErrNoResponders)
+	assert.ErrorIs(t, err, ErrNoResponder)
+	assert.ErrorIs(t, err, nats.ErrNoResponders, "the original error stays in the chain")
+
+	assert.ErrorIs(t, natsError(nats.ErrTimeout), ErrNATSTimeout)
+
+	other := errors.New("connection closed")
+	assert.Equal(t, other, natsError(other))
+}
+
+func TestDecodeProcesses(t *testing.T) {
+	procs, err := decodeProcesses([]byte(`[{"name":"ticker","is_running":true}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []ProcessState{{Name: "ticker", IsRunning: true}}, procs)
+
+	_, err = decodeProcesses([]byte(`{"error":"connection refused"}`))
+	assert.EqualError(t, err, "request processes: connection refused")
+
+	_, err = decodeProcesses([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestDecodeControl(t *testing.T) {
+	req := ControlRequest{Action: "stop", Name: "ticker"}
+	assert.NoError(t, decodeControl(req, []byte(`{"ok":true}`)))
+	assert.EqualError(t, decodeControl(req, []byte(`{"ok":false,"error":"API returned status 404"}`)),
+		"stop ticker: API returned status 404")
+	assert.EqualError(t, decodeControl(req, []byte(`{"ok":false}`)), "stop ticker: control failed")
+}
+
+func TestNewNATSController_DefaultTimeout(t *testing.T) {
+	assert.Equal(t, DefaultNATSTimeout, NewNATSController(nil, 0).timeout)
+}
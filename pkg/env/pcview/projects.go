@@ -0,0 +1,88 @@
+package pcview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectsBucket holds process-compose definitions pushed to nodes, keyed
+// by node name. Values are process-compose YAML with a processes section,
+// layered over the node's own pc.yaml:
+//
+//	nats kv put pc_projects edge-7 "$(cat camera.yaml)"
+//	nats kv del pc_projects edge-7 # Back to pc.yaml only
+const ProjectsBucket = "pc_projects"
+
+// OpenProjectsBucket creates (or opens) the pc_projects bucket
+func OpenProjectsBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      ProjectsBucket,
+		Description: "Process-compose definitions pushed to nodes",
+		History:     5,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening projects bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// GetProject returns the definitions pushed to node (nil if none)
+func GetProject(ctx context.Context, kv jetstream.KeyValue, node string) ([]byte, error) {
+	entry, err := kv.Get(ctx, node)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting project of %s: %w", node, err)
+	}
+	return entry.Value(), nil
+}
+
+// WatchProject calls fn with the definitions pushed to node, now and on
+// every change; nil once they are deleted. Definitions that are not
+// process-compose YAML (see ProjectProcesses) are skipped.
+func WatchProject(ctx context.Context, kv jetstream.KeyValue, node string, fn func(data []byte)) (env.Watcher, error) {
+	projects := env.NewTypedKV(kv, env.WithDecoder(decodeProject))
+	w, err := projects.Watch(ctx, node, func(key string, data *[]byte, deleted bool) {
+		if deleted {
+			fn(nil)
+			return
+		}
+		fn(*data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("watching project of %s: %w", node, err)
+	}
+	return w, nil
+}
+
+// decodeProject keeps the raw YAML once it parses as a project
+func decodeProject(data []byte) ([]byte, error) {
+	if _, err := ProjectProcesses(data); err != nil {
+		return nil, err
+	}
+	return slices.Clone(data), nil
+}
+
+// ProjectProcesses returns the sorted process names of process-compose
+// YAML, or an error if it does not parse or defines no processes
+func ProjectProcesses(data []byte) ([]string, error) {
+	var project struct {
+		Processes map[string]any `yaml:"processes"`
+	}
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("parsing project: %w", err)
+	}
+	if len(project.Processes) == 0 {
+		return nil, fmt.Errorf("project defines no processes")
+	}
+
+	return slices.Sorted(maps.Keys(project.Processes)), nil
+}
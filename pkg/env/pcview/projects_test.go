@@ -0,0 +1,42 @@
+package pcview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectProcesses(t *testing.T) {
+	names, err := ProjectProcesses([]byte(`
+version: "0.5"
+processes:
+  camera:
+    command: ./camera --device /dev/video0
+  uploader:
+    command: ./uploader
+    depends_on:
+      camera:
+        condition: process_started
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"camera", "uploader"}, names)
+
+	_, err = ProjectProcesses([]byte(`version: "0.5"`))
+	assert.EqualError(t, err, "project defines no processes")
+
+	_, err = ProjectProcesses([]byte(`processes: [camera`))
+	assert.Error(t, err)
+}
+
+func TestDecodeProject(t *testing.T) {
+	data := []byte("processes:\n  camera:\n    command: ./camera\n")
+	got, err := decodeProject(data)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	data[0] = 'X'
+	assert.Equal(t, byte('p'), got[0], "decoded value outlives the KV entry buffer")
+
+	_, err = decodeProject([]byte("processes: {}"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package pcview
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	. "github.com/go-via/via/h"
+	"github.com/joeblew999/wellnown-env/pkg/env"
+)
+
+// replicaName matches the names process-compose gives the replicas of a
+// scaled process: name-0, name-1, ...
+var replicaName = regexp.MustCompile(`^(.+)-(\d+)$`)
+
+// processGroup is a process and its replicas
+type processGroup struct {
+	Name     string         // Process name (the base name of replicas)
+	Replicas []ProcessState // By replica index; one entry for unscaled processes
+}
+
+// Scaled reports whether the group has more than one replica
+func (g processGroup) Scaled() bool {
+	return len(g.Replicas) > 1
+}
+
+// groupReplicas groups process states into processes and their replicas,
+// keeping the order of first appearance. Names like worker-0 and worker-1
+// form a group only when at least two of them share the base name, so a
+// lone process called api-2 stays itself.
+func groupReplicas(procs []ProcessState) []processGroup {
+	byBase := make(map[string][]ProcessState)
+	for _, proc := range procs {
+		if m := replicaName.FindStringSubmatch(proc.Name); m != nil {
+			byBase[m[1]] = append(byBase[m[1]], proc)
+		}
+	}
+
+	var groups []processGroup
+	seen := make(map[string]bool)
+	for _, proc := range procs {
+		if m := replicaName.FindStringSubmatch(proc.Name); m != nil && len(byBase[m[1]]) > 1 {
+			if seen[m[1]] {
+				continue
+			}
+			seen[m[1]] = true
+			replicas := byBase[m[1]]
+			sort.SliceStable(replicas, func(i, j int) bool { return replicaIndex(replicas[i].Name) < replicaIndex(replicas[j].Name) })
+			groups = append(groups, processGroup{Name: m[1], Replicas: replicas})
+			continue
+		}
+		groups = append(groups, processGroup{Name: proc.Name, Replicas: []ProcessState{proc}})
+	}
+	return groups
+}
+
+// replicaIndex returns the index in a replica name (-1 if none)
+func replicaIndex(name string) int {
+	m := replicaName.FindStringSubmatch(name)
+	if m == nil {
+		return -1
+	}
+	i, err := strconv.Atoi(m[2])
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// groupRow returns the summary row of a scaled process: how many replicas
+// run, with the scale controls
+func groupRow(g processGroup, actionsEl H) env.TableRow {
+	running, restarts := 0, 0
+	for _, r := range g.Replicas {
+		if r.IsRunning {
+			running++
+		}
+		restarts += r.Restarts
+	}
+	status := fmt.Sprintf("%d/%d running", running, len(g.Replicas))
+	statusEl := Mark(Text(status))
+	switch running {
+	case len(g.Replicas):
+		statusEl = Ins(Text(status))
+	case 0:
+		statusEl = Del(Text(status))
+	}
+
+	return env.TableRow{
+		env.NodeCell(g.Name, Strong(Textf("%s ×%d", g.Name, len(g.Replicas)))),
+		env.NodeCell(status, statusEl),
+		env.NumCell(0, Small(Text("-"))),
+		env.TextCell("-"),
+		env.NumCell(float64(restarts), nil),
+		env.NodeCell("", actionsEl),
+	}
+}
+
+// scaleButtons renders the buttons scaling a process one replica down or
+// up; down is left out at one replica
+func scaleButtons(name string, replicas int, busy bool, down, up H) H {
+	buttons := []H{Role("group"), ID("scale-" + name)}
+	if replicas > 1 {
+		buttons = append(buttons, scaleButton("scale-down-"+name, "−", fmt.Sprintf("Scale %s to %d", name, replicas-1), busy, down))
+	}
+	buttons = append(buttons, scaleButton("scale-up-"+name, "+", fmt.Sprintf("Scale %s to %d", name, replicas+1), busy, up))
+	return Div(buttons...)
+}
+
+// scaleButton renders one scale button; disabled while busy
+func scaleButton(id, label, aria string, busy bool, trigger H) H {
+	attrs := []H{ID(id), Class("outline"), env.AriaLabel(aria)}
+	attrs = append(attrs, env.BusyAttrs(busy)...)
+	return Button(append(attrs, trigger, Text(label))...)
+}
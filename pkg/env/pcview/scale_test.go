@@ -0,0 +1,40 @@
+package pcview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupReplicas(t *testing.T) {
+	procs := []ProcessState{
+		{Name: "nats"},
+		{Name: "worker-1", IsRunning: true},
+		{Name: "api-2"},
+		{Name: "worker-0", IsRunning: true},
+		{Name: "worker-10"},
+	}
+
+	groups := groupReplicas(procs)
+	assert.Len(t, groups, 3)
+
+	assert.Equal(t, "nats", groups[0].Name)
+	assert.False(t, groups[0].Scaled())
+
+	assert.Equal(t, "worker", groups[1].Name, "replicas group at the first one seen")
+	assert.True(t, groups[1].Scaled())
+	var names []string
+	for _, r := range groups[1].Replicas {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"worker-0", "worker-1", "worker-10"}, names, "ordered by index, not name")
+
+	assert.Equal(t, "api-2", groups[2].Name, "a lone numbered process is not a group")
+	assert.False(t, groups[2].Scaled())
+}
+
+func TestReplicaIndex(t *testing.T) {
+	assert.Equal(t, 3, replicaIndex("worker-3"))
+	assert.Equal(t, 12, replicaIndex("my-worker-12"))
+	assert.Equal(t, -1, replicaIndex("worker"))
+}
@@ -65,6 +65,32 @@ func TestState_ConcurrentAccess(t *testing.T) {
 	assert.Len(t, procs, 1)
 }
 
+func TestState_Version(t *testing.T) {
+	state := NewState()
+	procs := []ProcessState{{Name: "ticker", Status: "Running", IsRunning: true, Pid: 1234}}
+
+	state.SetProcesses(procs, "")
+	v := state.Version()
+	assert.NotZero(t, v)
+
+	// Same content again: pages have nothing to render
+	state.SetProcesses([]ProcessState{{Name: "ticker", Status: "Running", IsRunning: true, Pid: 1234}}, "")
+	assert.Equal(t, v, state.Version())
+
+	state.SetProcesses([]ProcessState{{Name: "ticker", Status: "Completed", ExitCode: 1}}, "")
+	assert.Greater(t, state.Version(), v)
+	v = state.Version()
+
+	state.SetError("connection refused")
+	assert.Greater(t, state.Version(), v)
+	v = state.Version()
+	state.SetError("connection refused")
+	assert.Equal(t, v, state.Version())
+
+	state.ClearError()
+	assert.Greater(t, state.Version(), v)
+}
+
 func TestProcessState_Fields(t *testing.T) {
 	proc := ProcessState{
 		Name:      "ticker",
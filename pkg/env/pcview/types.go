@@ -2,7 +2,11 @@
 package pcview
 
 import (
+	"fmt"
+	"hash/fnv"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
 )
@@ -32,8 +36,9 @@ type ProcessStates struct {
 
 // ControlRequest is sent via NATS to control a process
 type ControlRequest struct {
-	Action string `json:"action"` // start, stop, restart
-	Name   string `json:"name"`
+	Action   string `json:"action"` // start, stop, restart, scale
+	Name     string `json:"name"`
+	Replicas int    `json:"replicas,omitempty"` // Scale only
 }
 
 // ControlResponse is the reply from a control request
@@ -42,12 +47,28 @@ type ControlResponse struct {
 	Error string `json:"error,omitempty"`
 }
 
+// ProcessEvent is a change in a process's runtime state seen by State:
+// its status, or its restart count
+type ProcessEvent struct {
+	Time      time.Time
+	Status    string
+	IsRunning bool
+	ExitCode  int
+	Restarts  int
+}
+
+// maxProcessEvents is how many events State keeps per process
+const maxProcessEvents = 50
+
 // State holds the shared state for process viewing
 type State struct {
 	mu         sync.RWMutex
 	processes  []ProcessState
+	history    map[string][]ProcessEvent // Oldest first, per process
 	lastError  string
 	updatesSub *nats.Subscription
+	version    uint64 // Bumped when processes or lastError change
+	hash       uint64 // Of processes and lastError at version
 }
 
 // NewState creates a new State
@@ -64,12 +85,67 @@ func (s *State) GetProcesses() ([]ProcessState, string) {
 	return procs, s.lastError
 }
 
-// SetProcesses updates the process states
+// SetProcesses updates the process states and records the changes in
+// each process's history
 func (s *State) SetProcesses(procs []ProcessState, err string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.recordHistory(procs, time.Now())
 	s.processes = procs
 	s.lastError = err
+	s.touch()
+}
+
+// touch bumps the version if processes or lastError differ from what the
+// current version saw (s.mu held). Updates repeating the same content, like
+// a poll of idle processes, keep the version so following pages skip them.
+func (s *State) touch() {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v\x00%s", s.processes, s.lastError)
+	if sum := h.Sum64(); sum != s.hash {
+		s.hash = sum
+		s.version++
+	}
+}
+
+// Version returns a counter that changes whenever the processes or the
+// error change
+func (s *State) Version() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// recordHistory appends an event for each process whose status or
+// restart count differs from its last event (s.mu held)
+func (s *State) recordHistory(procs []ProcessState, now time.Time) {
+	if s.history == nil {
+		s.history = make(map[string][]ProcessEvent)
+	}
+	for _, proc := range procs {
+		events := s.history[proc.Name]
+		if n := len(events); n > 0 && events[n-1].Status == proc.Status && events[n-1].Restarts == proc.Restarts {
+			continue
+		}
+		events = append(events, ProcessEvent{
+			Time:      now,
+			Status:    proc.Status,
+			IsRunning: proc.IsRunning,
+			ExitCode:  proc.ExitCode,
+			Restarts:  proc.Restarts,
+		})
+		if len(events) > maxProcessEvents {
+			events = events[len(events)-maxProcessEvents:]
+		}
+		s.history[proc.Name] = events
+	}
+}
+
+// History returns the recorded events of a process, oldest first
+func (s *State) History(name string) []ProcessEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.history[name])
 }
 
 // SetError sets an error message
@@ -77,6 +153,7 @@ func (s *State) SetError(err string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.lastError = err
+	s.touch()
 }
 
 // ClearError clears the error message
@@ -84,4 +161,5 @@ func (s *State) ClearError() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.lastError = ""
+	s.touch()
 }
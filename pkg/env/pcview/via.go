@@ -1,7 +1,9 @@
 package pcview
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-via/via"
@@ -17,6 +19,7 @@ type ProcessController interface {
 	Start(name string) error
 	Stop(name string) error
 	Restart(name string) error
+	Scale(name string, replicas int) error
 }
 
 // PageOptions configures the Via page
@@ -29,8 +32,15 @@ type PageOptions struct {
 	// If empty or nil, ALL processes are controllable (default).
 	// Use explicit list to restrict control to specific processes.
 	Controllable []string
+	// Scalable lists controllable processes that get scale controls while
+	// they run a single replica. Processes with replicas always get them.
+	Scalable []string
 	// PCPort is the process-compose API port for error messages (default: from env)
 	PCPort string
+	// Compact always renders processes as cards (default: cards on narrow viewports only)
+	Compact bool
+	// SyncInterval is how often an open page checks State for changes to render (default: DefaultSyncInterval)
+	SyncInterval time.Duration
 }
 
 // RegisterPage registers the /processes page with Via
@@ -41,6 +51,10 @@ func RegisterPage(v *via.V, client ProcessController, state *State, opts PageOpt
 	for _, name := range opts.Controllable {
 		controllable[name] = true
 	}
+	scalable := make(map[string]bool)
+	for _, name := range opts.Scalable {
+		scalable[name] = true
+	}
 
 	// Get PC port from options or environment
 	pcPort := opts.PCPort
@@ -48,6 +62,9 @@ func RegisterPage(v *via.V, client ProcessController, state *State, opts PageOpt
 		pcPort = env.GetEnv("PC_PORT", env.DefaultPCPort)
 	}
 
+	// One control call per process at a time, across all open pages
+	guard := env.NewActionGuard(env.DefaultActionCooldown)
+
 	v.Page("/processes", func(c *via.Context) {
 		var lastAction string
 		var lastError string
@@ -60,14 +77,38 @@ func RegisterPage(v *via.V, client ProcessController, state *State, opts PageOpt
 		// Helper to create control actions
 		makeControl := func(action, name, msg string) H {
 			return c.Action(func() {
-				if err := client.Control(action, name); err != nil {
-					lastError = err.Error()
-					lastAction = ""
-				} else {
-					lastAction = msg
-					lastError = ""
+				ran := guard.Do(name, func() {
+					c.Sync() // Render the busy state while the call runs
+					if err := client.Control(action, name); err != nil {
+						lastError = err.Error()
+						lastAction = ""
+					} else {
+						lastAction = msg
+						lastError = ""
+					}
+				})
+				if ran {
+					c.Sync()
+				}
+			}).OnClick()
+		}
+
+		// Helper to create scale actions
+		makeScale := func(name string, replicas int) H {
+			return c.Action(func() {
+				ran := guard.Do(name, func() {
+					c.Sync()
+					if err := client.Scale(name, replicas); err != nil {
+						lastError = err.Error()
+						lastAction = ""
+					} else {
+						lastAction = fmt.Sprintf("Scaled %s to %d", name, replicas)
+						lastError = ""
+					}
+				})
+				if ran {
+					c.Sync()
 				}
-				c.Sync()
 			}).OnClick()
 		}
 
@@ -75,80 +116,95 @@ func RegisterPage(v *via.V, client ProcessController, state *State, opts PageOpt
 		makeRestart := func(name string) H {
 			if name == "via" {
 				return c.Action(func() {
-					lastAction = "Restarting via... (page will reconnect)"
-					lastError = ""
-					c.Sync()
-					time.Sleep(100 * time.Millisecond)
-					if err := client.Restart(name); err != nil {
-						lastError = err.Error()
-						lastAction = ""
+					guard.Do(name, func() {
+						lastAction = "Restarting via... (page will reconnect)"
+						lastError = ""
 						c.Sync()
-					}
+						time.Sleep(100 * time.Millisecond)
+						if err := client.Restart(name); err != nil {
+							lastError = err.Error()
+							lastAction = ""
+							c.Sync()
+						}
+					})
 				}).OnClick()
 			}
 			return makeControl("restart", name, "Restarted "+name)
 		}
 
+		table := env.NewTable(c, processColumns()...).SetCompact(opts.Compact)
+
 		// Refresh action
 		refresh := c.Action(func() {
-			procs, err := client.GetProcesses()
-			if err != nil {
-				lastError = err.Error()
-			} else {
-				state.SetProcesses(procs, "")
-				lastError = ""
+			ran := guard.Do(refreshKey, func() {
+				procs, err := client.GetProcesses()
+				if err != nil {
+					lastError = err.Error()
+				} else {
+					state.SetProcesses(procs, "")
+					lastError = ""
+				}
+			})
+			if ran {
+				c.Sync()
 			}
-			c.Sync()
 		})
 
+		Follow(c, state, opts.SyncInterval)
+
 		c.View(func() H {
 			processes, stateErr := state.GetProcesses()
 			if stateErr != "" && lastError == "" {
 				lastError = stateErr
 			}
 
-			var rows []H
-			for _, proc := range processes {
-				statusEl := Del(Text(proc.Status))
+			// Helper to render the start/stop/restart buttons of a process
+			processActions := func(proc ProcessState, allowed bool) H {
+				if !allowed {
+					return Small(Text("-"))
+				}
+				busy := guard.Busy(proc.Name)
 				if proc.IsRunning {
-					statusEl = Ins(Text("Running"))
+					return Div(Role("group"),
+						controlButton("Stop", proc.Name, "secondary outline", busy, makeControl("stop", proc.Name, "Stopped "+proc.Name)),
+						controlButton("Restart", proc.Name, "contrast outline", busy, makeRestart(proc.Name)),
+					)
 				}
+				return controlButton("Start", proc.Name, "", busy, makeControl("start", proc.Name, "Started "+proc.Name))
+			}
 
-				health := proc.Health
-				if health == "" {
-					health = "N/A"
-				}
+			// Helper to render the scale buttons of a process
+			scaleActions := func(name string, replicas int) H {
+				return scaleButtons(name, replicas, guard.Busy(name),
+					makeScale(name, replicas-1), makeScale(name, replicas+1))
+			}
 
-				var actionsEl H = Small(Text("-"))
-				if isControllable(proc.Name) {
-					if proc.IsRunning {
-						actionsEl = Div(Role("group"),
-							Button(Text("Stop"), Class("secondary outline"), makeControl("stop", proc.Name, "Stopped "+proc.Name)),
-							Button(Text("Restart"), Class("contrast outline"), makeRestart(proc.Name)),
-						)
-					} else {
-						actionsEl = Button(Text("Start"), makeControl("start", proc.Name, "Started "+proc.Name))
+			var rows []env.TableRow
+			for _, g := range groupReplicas(processes) {
+				if !g.Scaled() {
+					proc := g.Replicas[0]
+					actionsEl := processActions(proc, isControllable(proc.Name))
+					if scalable[proc.Name] && isControllable(proc.Name) {
+						actionsEl = Div(actionsEl, scaleActions(proc.Name, 1))
 					}
+					rows = append(rows, processRow(proc, actionsEl))
+					continue
 				}
 
-				rows = append(rows, Tr(
-					Td(Strong(Text(proc.Name))),
-					Td(statusEl),
-					Td(Code(Textf("%d", proc.Pid))),
-					Td(Text(health)),
-					Td(Textf("%d", proc.Restarts)),
-					Td(actionsEl),
-				))
+				// A summary row with the scale controls, then one row per
+				// replica; listing the base name in Controllable covers them all
+				allowed := isControllable(g.Name)
+				var scaleEl H = Small(Text("-"))
+				if allowed {
+					scaleEl = scaleActions(g.Name, len(g.Replicas))
+				}
+				rows = append(rows, groupRow(g, scaleEl))
+				for _, replica := range g.Replicas {
+					rows = append(rows, processRow(replica, processActions(replica, allowed || isControllable(replica.Name))))
+				}
 			}
 
-			var messageEl H
-			if lastError != "" {
-				messageEl = Article(Attr("data-theme", "light"),
-					P(Class("pico-color-red"), Strong(Text("Error: ")), Text(lastError)))
-			} else if lastAction != "" {
-				messageEl = Article(Attr("data-theme", "light"),
-					P(Class("pico-color-green"), Strong(Text("Action: ")), Text(lastAction)))
-			}
+			messageEl := messageRegion(lastError, lastAction)
 
 			var tableEl H
 			if len(processes) == 0 && lastError != "" {
@@ -158,13 +214,7 @@ func RegisterPage(v *via.V, client ProcessController, state *State, opts PageOpt
 					P(Small(Text(fmt.Sprintf("Run: process-compose up --port %s", pcPort)))),
 				)
 			} else {
-				tableEl = Figure(Table(Role("grid"),
-					THead(Tr(
-						Th(Text("Process")), Th(Text("Status")), Th(Text("PID")),
-						Th(Text("Health")), Th(Text("Restarts")), Th(Text("Actions")),
-					)),
-					TBody(rows...),
-				))
+				tableEl = table.Render(rows)
 			}
 
 			var navEl H
@@ -177,11 +227,105 @@ func RegisterPage(v *via.V, client ProcessController, state *State, opts PageOpt
 				Section(
 					H1(Text("Process Manager")),
 					P(Text("View and control process-compose processes")),
-					Button(Text("Refresh"), refresh.OnClick()),
+					Button(append(env.BusyAttrs(guard.Busy(refreshKey)), ID("refresh"), Text("Refresh"), refresh.OnClick())...),
 				),
 				messageEl,
+				statusSummary(processes),
 				tableEl,
 			)
 		})
 	})
 }
+
+// processColumns returns the columns of the process tables
+func processColumns() []env.Column {
+	return []env.Column{
+		{Key: "name", Title: "Process"},
+		{Key: "status", Title: "Status"},
+		{Key: "pid", Title: "PID", Numeric: true},
+		{Key: "health", Title: "Health"},
+		{Key: "restarts", Title: "Restarts", Numeric: true},
+		{Key: "actions", Title: "Actions", NoSort: true},
+	}
+}
+
+// processRow returns the table row for a process
+func processRow(proc ProcessState, actionsEl H) env.TableRow {
+	status := proc.Status
+	statusEl := Del(Text(status))
+	if proc.IsRunning {
+		status = "Running"
+		statusEl = Ins(Text(status))
+	}
+
+	health := proc.Health
+	if health == "" {
+		health = "N/A"
+	}
+
+	return env.TableRow{
+		env.NodeCell(proc.Name, A(Href("/processes/"+proc.Name), Strong(Text(proc.Name)))),
+		env.NodeCell(status, statusEl),
+		env.NumCell(float64(proc.Pid), Code(Textf("%d", proc.Pid))),
+		env.TextCell(health),
+		env.NumCell(float64(proc.Restarts), nil),
+		env.NodeCell("", actionsEl),
+	}
+}
+
+// PalettePages returns command palette entries for the pcview pages
+func PalettePages() []env.PaletteItem {
+	return []env.PaletteItem{
+		{Kind: "page", Title: "Processes", Href: "/processes"},
+		{Kind: "page", Title: "Examples", Href: "/examples"},
+		{Kind: "page", Title: "Logs", Href: "/logs"},
+	}
+}
+
+// PaletteSource lists the processes in state for the command palette
+func PaletteSource(state *State) env.PaletteSource {
+	return func(ctx context.Context) []env.PaletteItem {
+		processes, _ := state.GetProcesses()
+		items := make([]env.PaletteItem, 0, len(processes))
+		for _, proc := range processes {
+			items = append(items, env.PaletteItem{Kind: "process", Title: proc.Name, Href: "/processes/" + proc.Name})
+		}
+		return items
+	}
+}
+
+// refreshKey guards the refresh buttons
+const refreshKey = "refresh:"
+
+// controlButton renders a process control button with a stable id and a
+// label naming the process for screen readers; disabled while busy
+func controlButton(action, name, class string, busy bool, trigger H) H {
+	attrs := []H{ID(strings.ToLower(action) + "-" + name), Class(class), env.AriaLabel(action + " " + name)}
+	attrs = append(attrs, env.BusyAttrs(busy)...)
+	return Button(append(attrs, trigger, Text(action))...)
+}
+
+// messageRegion renders the last action or error inside live regions, so
+// results of actions are announced when they arrive over SSE
+func messageRegion(lastError, lastAction string) H {
+	var errorEl, actionEl H
+	if lastError != "" {
+		errorEl = Article(Attr("data-theme", "light"),
+			P(Class("pico-color-red"), Strong(Text("Error: ")), Text(lastError)))
+	} else if lastAction != "" {
+		actionEl = Article(Attr("data-theme", "light"),
+			P(Class("pico-color-green"), Strong(Text("Action: ")), Text(lastAction)))
+	}
+	return Div(env.AlertRegion(errorEl), env.LiveRegion(true, actionEl))
+}
+
+// statusSummary announces how many processes are running
+func statusSummary(processes []ProcessState) H {
+	running := 0
+	for _, proc := range processes {
+		if proc.IsRunning {
+			running++
+		}
+	}
+	return env.LiveRegion(false, Textf("%d of %d processes running", running, len(processes)))
+}
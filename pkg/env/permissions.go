@@ -0,0 +1,263 @@
+// permissions.go: Least-privilege subject permissions from a registration
+//
+// A service only needs its own subjects, the subjects of the services it
+// depends on, replies, and its own keys in the registry.
+// ServicePermissions derives exactly that from a ServiceRegistration:
+//
+//	perms := env.ServicePermissions(reg)
+//	node.AllowServiceNKey(pub, perms)          // nkey mode
+//	acct.AddUser("orders", perms.UserOption()) // jwt mode
+//
+// In nkey mode, scoped service users can also be listed in
+// .auth/services.json ({"<public key>": {"publish": [...], "subscribe": [...]}});
+// the node's own user in .auth/user.pub keeps full access.
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// authServicesFile lists scoped service NKeys (nkey mode)
+const authServicesFile = ".auth/services.json"
+
+// SubjectPermissions are the subjects a user may publish and subscribe to.
+// The deny lists carve subjects out of the allowed ones.
+type SubjectPermissions struct {
+	Publish       []string `json:"publish"`
+	Subscribe     []string `json:"subscribe"`
+	PublishDeny   []string `json:"publish_deny,omitempty"`
+	SubscribeDeny []string `json:"subscribe_deny,omitempty"`
+}
+
+// UserInboxPrefix is the reply prefix of user: role and access users only
+// receive replies below it, so they connect with
+// nats.CustomInboxPrefix(env.UserInboxPrefix(user))
+func UserInboxPrefix(user string) string {
+	return "_INBOX_" + user
+}
+
+// forUser returns p plus the replies of user (UserInboxPrefix)
+func (p SubjectPermissions) forUser(user string) SubjectPermissions {
+	p.Subscribe = uniqueSorted(append(slices.Clone(p.Subscribe), UserInboxPrefix(user)+".>"))
+	return p
+}
+
+// equal reports whether p and other allow and deny the same subjects
+func (p SubjectPermissions) equal(other SubjectPermissions) bool {
+	return slices.Equal(p.Publish, other.Publish) && slices.Equal(p.Subscribe, other.Subscribe) &&
+		slices.Equal(p.PublishDeny, other.PublishDeny) && slices.Equal(p.SubscribeDeny, other.SubscribeDeny)
+}
+
+// ServiceSubject returns the subject namespace of service org/repo
+// (org.repo.>)
+func ServiceSubject(name string) string {
+	return strings.ReplaceAll(name, "/", ".") + ".>"
+}
+
+// validServiceName reports whether name is an org/repo whose namespace is
+// a plain subject prefix: two tokens without dots, wildcards or spaces,
+// outside the system ($...), reply (_INBOX) and admin namespaces
+func validServiceName(name string) bool {
+	org, repo, ok := strings.Cut(name, "/")
+	if !ok {
+		return false
+	}
+	for _, token := range []string{org, repo} {
+		if token == "" || strings.ContainsAny(token, ".*>/ \t\r\n") {
+			return false
+		}
+	}
+	return !strings.HasPrefix(org, "$") && !strings.HasPrefix(org, "_INBOX") &&
+		!(org == "wellknown" && repo == "admin")
+}
+
+// serviceSubjectAllowed reports whether service name may claim subject:
+// it must lie in the service's own org.repo namespace, which also keeps
+// out bare wildcards and the $..., _INBOX and wellknown.admin subjects
+func serviceSubjectAllowed(name, subject string) bool {
+	if !validServiceName(name) || strings.ContainsAny(subject, " \t\r\n") {
+		return false
+	}
+	switch {
+	case subject == ">", subject == "*",
+		strings.HasPrefix(subject, "$"),
+		strings.HasPrefix(subject, "_INBOX"),
+		strings.HasPrefix(subject, "wellknown.admin"):
+		return false
+	}
+	rest, ok := strings.CutPrefix(subject, strings.ReplaceAll(name, "/", ".")+".")
+	if !ok {
+		return false
+	}
+	tokens := strings.Split(rest, ".")
+	for i, token := range tokens {
+		if token == "" || (token == ">" && i != len(tokens)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// ServicePermissions returns the least-privilege permissions of the service
+// in reg: its own org.repo.> namespace and served subjects, requests to its
+// dependencies, replies, reading the registry and writing its own entries.
+// Served subjects outside the namespace and dependencies that are not
+// plain org/repo names are dropped, so a registration cannot widen them.
+func ServicePermissions(reg registry.ServiceRegistration) SubjectPermissions {
+	name := reg.GitHub.Name()
+	kv := "KV_" + RegistryBucket
+
+	pub := []string{
+		"$JS.API.INFO",
+		"$JS.API.STREAM.INFO." + kv,
+		"$JS.API.DIRECT.GET." + kv + ".>",
+		"$JS.API.CONSUMER.CREATE." + kv + ".>",
+		"$JS.API.CONSUMER.DELETE." + kv + ".>",
+	}
+	sub := []string{"_INBOX.>"}
+	if validServiceName(name) {
+		own := ServiceSubject(name)
+		pub = append(pub, own, fmt.Sprintf("$KV.%s.%s.%s.>", RegistryBucket, reg.GitHub.Org, reg.GitHub.Repo))
+		sub = append(sub, own)
+	}
+	for _, subject := range reg.Capabilities.Subjects {
+		if serviceSubjectAllowed(name, subject) {
+			pub = append(pub, subject)
+			sub = append(sub, subject)
+		}
+	}
+	for _, f := range reg.Fields {
+		if f.Dependency != "" && validServiceName(f.Dependency) {
+			pub = append(pub, ServiceSubject(f.Dependency))
+		}
+	}
+	return SubjectPermissions{Publish: uniqueSorted(pub), Subscribe: uniqueSorted(sub)}
+}
+
+// uniqueSorted sorts subjects and drops duplicates
+func uniqueSorted(subjects []string) []string {
+	sort.Strings(subjects)
+	out := subjects[:0]
+	for i, s := range subjects {
+		if i == 0 || s != subjects[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// UserOption applies p to a JWT user (see auth.Account.AddUser). Replies
+// to requests the user receives are allowed as well.
+func (p SubjectPermissions) UserOption() auth.UserOption {
+	allow := auth.WithPermissions(p.Publish, p.Subscribe)
+	return func(uc *jwt.UserClaims) {
+		allow(uc)
+		uc.Pub.Deny.Add(p.PublishDeny...)
+		uc.Sub.Deny.Add(p.SubscribeDeny...)
+		uc.Resp = &jwt.ResponsePermission{MaxMsgs: 1}
+	}
+}
+
+// permissions converts p to server permissions
+func (p SubjectPermissions) permissions() *server.Permissions {
+	return &server.Permissions{
+		Publish:   &server.SubjectPermission{Allow: p.Publish, Deny: p.PublishDeny},
+		Subscribe: &server.SubjectPermission{Allow: p.Subscribe, Deny: p.SubscribeDeny},
+		Response:  &server.ResponsePermission{MaxMsgs: 1},
+	}
+}
+
+// jwtPermissions converts p to user JWT permissions (auth callout grants)
+func (p SubjectPermissions) jwtPermissions() *jwt.Permissions {
+	perms := &jwt.Permissions{Resp: &jwt.ResponsePermission{MaxMsgs: 1}}
+	perms.Pub.Allow.Add(p.Publish...)
+	perms.Sub.Allow.Add(p.Subscribe...)
+	perms.Pub.Deny.Add(p.PublishDeny...)
+	perms.Sub.Deny.Add(p.SubscribeDeny...)
+	return perms
+}
+
+// loadServiceNKeys reads the scoped service users of nkey mode (a missing
+// file means none)
+func loadServiceNKeys(path string) (map[string]SubjectPermissions, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var users map[string]SubjectPermissions
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// AllowServiceNKey lets the NKey user pub connect with perms (nkey mode).
+// Calling it again for pub replaces its permissions; connected clients
+// get the new ones.
+func (n *NATSNode) AllowServiceNKey(pub string, perms SubjectPermissions) error {
+	cfg := n.Auth()
+	if cfg == nil || cfg.Mode != "nkey" {
+		return fmt.Errorf("scoped service nkeys need nkey auth mode")
+	}
+	next := *cfg
+	next.ServiceNKeys = make(map[string]SubjectPermissions, len(cfg.ServiceNKeys)+1)
+	for k, v := range cfg.ServiceNKeys {
+		next.ServiceNKeys[k] = v
+	}
+	next.ServiceNKeys[pub] = perms
+	return n.ReloadAuth(&next)
+}
+
+// RevokeServiceNKey stops accepting the NKey user pub (nkey mode) and
+// disconnects its clients. Unknown keys are ignored.
+func (n *NATSNode) RevokeServiceNKey(pub string) error {
+	cfg := n.Auth()
+	if cfg == nil || cfg.Mode != "nkey" {
+		return fmt.Errorf("scoped service nkeys need nkey auth mode")
+	}
+	if _, ok := cfg.ServiceNKeys[pub]; !ok {
+		return nil
+	}
+	next := *cfg
+	next.ServiceNKeys = make(map[string]SubjectPermissions, len(cfg.ServiceNKeys))
+	for k, v := range cfg.ServiceNKeys {
+		if k != pub {
+			next.ServiceNKeys[k] = v
+		}
+	}
+	return n.ReloadAuth(&next)
+}
+
+// UpdateServiceNKeys sets the permissions of the NKey users in set and
+// drops those in remove (nkey mode), with a single reload
+func (n *NATSNode) UpdateServiceNKeys(set map[string]SubjectPermissions, remove []string) error {
+	cfg := n.Auth()
+	if cfg == nil || cfg.Mode != "nkey" {
+		return fmt.Errorf("scoped service nkeys need nkey auth mode")
+	}
+	next := *cfg
+	next.ServiceNKeys = make(map[string]SubjectPermissions, len(cfg.ServiceNKeys)+len(set))
+	for k, v := range cfg.ServiceNKeys {
+		next.ServiceNKeys[k] = v
+	}
+	for _, k := range remove {
+		delete(next.ServiceNKeys, k)
+	}
+	for k, v := range set {
+		next.ServiceNKeys[k] = v
+	}
+	return n.ReloadAuth(&next)
+}
@@ -0,0 +1,169 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func TestServicePermissions(t *testing.T) {
+	reg := registry.ServiceRegistration{GitHub: registry.GitHubInfo{Org: "acme", Repo: "orders"}}
+	reg.Capabilities.Subjects = []string{"acme.orders.api.>"}
+	reg.Fields = []registry.FieldInfo{
+		{EnvKey: "BILLING", Dependency: "acme/billing"},
+		{EnvKey: "BILLING_ADMIN", Dependency: "acme/billing"},
+		{EnvKey: "ADMIN", Dependency: "wellknown/admin"},
+		{EnvKey: "PORT"},
+	}
+
+	p := ServicePermissions(reg)
+
+	tests := []struct {
+		name    string
+		subject string
+		list    []string
+		want    bool
+	}{
+		{name: "own namespace", subject: "acme.orders.>", list: p.Publish, want: true},
+		{name: "served subject", subject: "acme.orders.api.>", list: p.Subscribe, want: true},
+		{name: "dependency", subject: "acme.billing.>", list: p.Publish, want: true},
+		{name: "own registry entries", subject: "$KV.services_registry.acme.orders.>", list: p.Publish, want: true},
+		{name: "replies", subject: "_INBOX.>", list: p.Subscribe, want: true},
+		{name: "no wildcard publish", subject: ">", list: p.Publish, want: false},
+		{name: "no wildcard subscribe", subject: ">", list: p.Subscribe, want: false},
+		{name: "dependency not subscribed", subject: "acme.billing.>", list: p.Subscribe, want: false},
+		{name: "other registry entries", subject: "$KV.services_registry.>", list: p.Publish, want: false},
+		{name: "admin dependency", subject: "wellknown.admin.>", list: p.Publish, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slices.Contains(tt.list, tt.subject); got != tt.want {
+				t.Errorf("%s allowed = %v, want %v (in %v)", tt.subject, got, tt.want, tt.list)
+			}
+		})
+	}
+
+	if n := len(p.Publish); n != len(slices.Compact(slices.Clone(p.Publish))) {
+		t.Errorf("duplicate publish subjects: %v", p.Publish)
+	}
+}
+
+func TestServicePermissionsDeclaredSubjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		want    bool
+	}{
+		{name: "own subject", subject: "acme.orders.created", want: true},
+		{name: "own wildcard", subject: "acme.orders.api.>", want: true},
+		{name: "full wildcard", subject: ">", want: false},
+		{name: "token wildcard", subject: "*", want: false},
+		{name: "system account", subject: "$SYS.>", want: false},
+		{name: "kv api", subject: "$KV.>", want: false},
+		{name: "other service kv", subject: "$KV.services_registry.acme.billing.>", want: false},
+		{name: "jetstream api", subject: "$JS.API.>", want: false},
+		{name: "reply inboxes", subject: "_INBOX.>", want: false},
+		{name: "admin api", subject: "wellknown.admin.>", want: false},
+		{name: "other service", subject: "acme.billing.>", want: false},
+		{name: "other repo of the org", subject: "acme.>", want: false},
+		{name: "wildcard repo", subject: "acme.*.>", want: false},
+		{name: "prefix without dot", subject: "acme.ordersx.>", want: false},
+		{name: "namespace itself", subject: "acme.orders.", want: false},
+		{name: "empty token", subject: "acme.orders..x", want: false},
+		{name: "outside namespace", subject: "api.orders.>", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := registry.ServiceRegistration{GitHub: registry.GitHubInfo{Org: "acme", Repo: "orders"}}
+			reg.Capabilities.Subjects = []string{tt.subject}
+			p := ServicePermissions(reg)
+			if got := slices.Contains(p.Publish, tt.subject); got != tt.want {
+				t.Errorf("publish %s allowed = %v, want %v", tt.subject, got, tt.want)
+			}
+			if got := slices.Contains(p.Subscribe, tt.subject); got != tt.want && tt.subject != "_INBOX.>" {
+				t.Errorf("subscribe %s allowed = %v, want %v", tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServicePermissionsInvalidName(t *testing.T) {
+	for _, gh := range []registry.GitHubInfo{
+		{Org: "acme", Repo: ">"},
+		{Org: "$SYS", Repo: "x"},
+		{Org: "acme.evil", Repo: "orders"},
+		{Org: "wellknown", Repo: "admin"},
+		{},
+	} {
+		reg := registry.ServiceRegistration{GitHub: gh}
+		reg.Capabilities.Subjects = []string{">"}
+		p := ServicePermissions(reg)
+		for _, subject := range append(p.Publish, p.Subscribe...) {
+			if !strings.HasPrefix(subject, "$JS.API.") && subject != "_INBOX.>" {
+				t.Errorf("%+v may use %s, want only registry reads and replies", gh, subject)
+			}
+		}
+	}
+}
+
+func TestConfigureNKeyAuthServices(t *testing.T) {
+	own, _ := auth.GenerateNKeyPair()
+	svc, _ := auth.GenerateNKeyPair()
+	perms := SubjectPermissions{Publish: []string{"acme.orders.>"}, Subscribe: []string{"_INBOX.>"}}
+
+	opts := &server.Options{}
+	cfg := &AuthConfig{Mode: "nkey", NKeyPub: own.Public, ServiceNKeys: map[string]SubjectPermissions{svc.Public: perms}}
+	if err := ConfigureAuth(opts, cfg); err != nil {
+		t.Fatalf("ConfigureAuth() error = %v", err)
+	}
+	if len(opts.Nkeys) != 2 {
+		t.Fatalf("got %d nkey users, want 2", len(opts.Nkeys))
+	}
+	for _, u := range opts.Nkeys {
+		allow := u.Permissions.Publish.Allow
+		switch u.Nkey {
+		case own.Public:
+			if !slices.Equal(allow, []string{">"}) {
+				t.Errorf("own user may publish %v, want everything", allow)
+			}
+		case svc.Public:
+			if !slices.Equal(allow, perms.Publish) || u.Permissions.Response == nil {
+				t.Errorf("service user permissions = %+v, want scoped with responses", u.Permissions)
+			}
+		}
+	}
+
+	cfg.ServiceNKeys = map[string]SubjectPermissions{"not-a-key": perms}
+	if err := ConfigureAuth(&server.Options{}, cfg); err == nil {
+		t.Error("ConfigureAuth() accepted an invalid service nkey")
+	}
+}
+
+func TestLoadServiceNKeys(t *testing.T) {
+	dir := t.TempDir()
+	if users, err := loadServiceNKeys(filepath.Join(dir, "missing.json")); err != nil || users != nil {
+		t.Errorf("missing file = %v, %v; want none", users, err)
+	}
+
+	path := filepath.Join(dir, "services.json")
+	os.WriteFile(path, []byte(`{"UABC": {"publish": ["a.>"], "subscribe": ["_INBOX.>"]}}`), 0o600)
+	users, err := loadServiceNKeys(path)
+	if err != nil {
+		t.Fatalf("loadServiceNKeys() error = %v", err)
+	}
+	if got := users["UABC"].Publish; !slices.Equal(got, []string{"a.>"}) {
+		t.Errorf("publish = %v, want [a.>]", got)
+	}
+
+	os.WriteFile(path, []byte(`{`), 0o600)
+	if _, err := loadServiceNKeys(path); err == nil {
+		t.Error("loadServiceNKeys() accepted invalid JSON")
+	}
+}
@@ -0,0 +1,91 @@
+// plugin.go: Optional Manager extensions
+//
+// Features not every service needs (alerting, feature flags, custom
+// metrics) hook into the Manager lifecycle instead of growing it:
+//
+//	type auditPlugin struct{ mgr *env.Manager }
+//
+//	func (p *auditPlugin) Init(mgr *env.Manager) error { p.mgr = mgr; return nil }
+//	func (p *auditPlugin) OnParse(cfg any) error       { return publishAudit(p.mgr.NC(), cfg) }
+//	func (p *auditPlugin) OnShutdown() error           { return nil }
+//
+//	mgr, _ := env.New("APP", env.WithPlugins(&auditPlugin{}))
+//
+// Init runs at the end of New, in order; an error closes the manager and
+// fails New. OnParse runs after Parse has validated cfg, before the
+// service registers; an error fails Parse. OnShutdown runs first in Close,
+// in reverse order, while NATS is still connected. A plugin may implement
+// Name() string to label its log lines, and subscribe to mgr.Events() in
+// Init for the rest of the lifecycle (see events.go).
+package env
+
+import (
+	"fmt"
+)
+
+// Plugin extends a Manager
+type Plugin interface {
+	// Init attaches the plugin to a new manager
+	Init(mgr *Manager) error
+	// OnParse sees each successfully parsed and validated config
+	OnParse(cfg any) error
+	// OnShutdown releases the plugin's resources
+	OnShutdown() error
+}
+
+// WithPlugins adds plugins to the manager
+func WithPlugins(plugins ...Plugin) Option {
+	return func(o *Options) {
+		o.Plugins = append(o.Plugins, plugins...)
+	}
+}
+
+// pluginName returns p's Name() or its type
+func pluginName(p Plugin) string {
+	if n, ok := p.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+// initPlugins initializes the configured plugins in order. Plugins that
+// initialized are shut down by Close, even if a later one fails.
+func (m *Manager) initPlugins() error {
+	for _, p := range m.opts.Plugins {
+		if err := p.Init(m); err != nil {
+			return fmt.Errorf("initializing plugin %s: %w", pluginName(p), err)
+		}
+		m.plugins = append(m.plugins, p)
+	}
+	return nil
+}
+
+// parsePlugins passes cfg to every plugin's OnParse
+func (m *Manager) parsePlugins(cfg any) error {
+	for _, p := range m.plugins {
+		if err := p.OnParse(cfg); err != nil {
+			return fmt.Errorf("plugin %s: %w", pluginName(p), err)
+		}
+	}
+	return nil
+}
+
+// shutdownPlugins shuts the plugins down in reverse order, logging errors
+func (m *Manager) shutdownPlugins() {
+	for i := len(m.plugins) - 1; i >= 0; i-- {
+		p := m.plugins[i]
+		if err := p.OnShutdown(); err != nil {
+			m.logger.Warn("plugin shutdown failed", "plugin", pluginName(p), "error", err)
+		}
+	}
+	m.plugins = nil
+}
+
+// pluginNames returns the names of plugins, for support bundles
+func pluginNames(plugins []Plugin) []string {
+	names := make([]string, 0, len(plugins))
+	for _, p := range plugins {
+		names = append(names, pluginName(p))
+	}
+	return names
+}
@@ -0,0 +1,83 @@
+package env
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// recordingPlugin appends its lifecycle calls to log
+type recordingPlugin struct {
+	name    string
+	log     *[]string
+	initErr error
+	mgr     *Manager
+}
+
+func (p *recordingPlugin) Name() string { return p.name }
+
+func (p *recordingPlugin) Init(mgr *Manager) error {
+	*p.log = append(*p.log, p.name+".init")
+	p.mgr = mgr
+	return p.initErr
+}
+
+func (p *recordingPlugin) OnParse(cfg any) error {
+	*p.log = append(*p.log, p.name+".parse")
+	if cfg == nil {
+		return errors.New("no config")
+	}
+	return nil
+}
+
+func (p *recordingPlugin) OnShutdown() error {
+	// The manager is still usable during shutdown
+	_ = p.mgr.SecretReport()
+	*p.log = append(*p.log, p.name+".shutdown")
+	return nil
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	var log []string
+	a := &recordingPlugin{name: "a", log: &log}
+	b := &recordingPlugin{name: "b", log: &log}
+
+	m, err := New("APP", WithoutNATS(), WithPlugins(a), WithPlugins(b))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if a.mgr != m || b.mgr != m {
+		t.Error("Init() did not get the manager")
+	}
+	if err := m.parsePlugins(&struct{}{}); err != nil {
+		t.Errorf("parsePlugins() error = %v", err)
+	}
+	if err := m.parsePlugins(nil); err == nil || !strings.Contains(err.Error(), "plugin a") {
+		t.Errorf("parsePlugins(nil) error = %v, want plugin a's error", err)
+	}
+	m.Close()
+	m.Close() // Plugins shut down once
+
+	want := "a.init b.init a.parse b.parse a.parse b.shutdown a.shutdown"
+	if got := strings.Join(log, " "); got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestPluginInitFailure(t *testing.T) {
+	var log []string
+	a := &recordingPlugin{name: "a", log: &log}
+	b := &recordingPlugin{name: "b", log: &log, initErr: errors.New("no license")}
+	c := &recordingPlugin{name: "c", log: &log}
+
+	_, err := New("APP", WithoutNATS(), WithPlugins(a, b, c))
+	if err == nil || !strings.Contains(err.Error(), "initializing plugin b") {
+		t.Fatalf("New() error = %v, want plugin b's error", err)
+	}
+
+	// Only the plugin that initialized is shut down
+	want := "a.init b.init a.shutdown"
+	if got := strings.Join(log, " "); got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,354 @@
+// power.go: Low-power profile for battery devices
+//
+//	mgr, _ := env.New("APP", env.WithLowPower(env.LowPowerConfig{Batch: time.Minute}))
+//	POWER_PROFILE=low ./sensor
+//	wellknown-check node power edge-7 low
+//
+// In the low profile a Manager:
+//
+//   - heartbeats (and runs health checks) every LowPowerConfig.Heartbeat
+//   - serves only wellnown_power_profile on /metrics, so scrapes are cheap
+//   - batches Manager.Publish calls and sends them every LowPowerConfig.Batch
+//   - puts the profile and its heartbeat in the registration, so the fleet
+//     page judges heartbeat age by the node's own interval
+//
+// The heartbeat must stay inside RegistryTTL, so longer intervals are
+// capped. Devices that sleep longer should also use WithLeafLiveness,
+// which needs no heartbeats at all.
+//
+// An operator can switch a node's profile at runtime: entries in the
+// node_power KV bucket, keyed by node name, override the configured
+// profile until they are cleared.
+package env
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Power profiles
+const (
+	PowerNormal = "normal" // Default
+	PowerLow    = "low"    // Battery devices
+)
+
+// NodePowerBucket holds the power profile overrides, keyed by node name
+const NodePowerBucket = "node_power"
+
+// Low-power defaults
+const (
+	DefaultLowPowerHeartbeat = 25 * time.Second // Longest interval that stays inside RegistryTTL
+	DefaultLowPowerBatch     = 30 * time.Second
+	DefaultLowPowerMaxBatch  = 100
+)
+
+// LowPowerConfig tunes the low-power profile (zero values use the defaults)
+type LowPowerConfig struct {
+	Heartbeat time.Duration // Heartbeat interval (capped below RegistryTTL)
+	Batch     time.Duration // How often batched publishes are sent
+	MaxBatch  int           // Send at once when this many publishes are queued
+}
+
+// withDefaults fills in defaults and caps the heartbeat
+func (c LowPowerConfig) withDefaults() LowPowerConfig {
+	if c.Heartbeat <= 0 || c.Heartbeat > DefaultLowPowerHeartbeat {
+		c.Heartbeat = DefaultLowPowerHeartbeat
+	}
+	if c.Batch <= 0 {
+		c.Batch = DefaultLowPowerBatch
+	}
+	if c.MaxBatch <= 0 {
+		c.MaxBatch = DefaultLowPowerMaxBatch
+	}
+	return c
+}
+
+// WithLowPower starts in the low-power profile
+func WithLowPower(cfg LowPowerConfig) Option {
+	return func(o *Options) {
+		o.PowerProfile = PowerLow
+		o.LowPower = cfg
+	}
+}
+
+// NodePower is a node's power profile override
+type NodePower struct {
+	Node    string    `json:"node"`
+	Profile string    `json:"profile"`
+	By      string    `json:"by,omitempty"` // Who set it
+	Since   time.Time `json:"since"`
+}
+
+// validPower returns an error for unknown profiles
+func validPower(profile string) error {
+	if profile != PowerNormal && profile != PowerLow {
+		return fmt.Errorf("unknown power profile %q (want %s or %s)", profile, PowerNormal, PowerLow)
+	}
+	return nil
+}
+
+// OpenNodePowerBucket creates (or opens) the node_power bucket
+func OpenNodePowerBucket(ctx context.Context, js jetstream.JetStream) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      NodePowerBucket,
+		Description: "Node power profiles for wellnown-env",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening node power bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// SetNodePower overrides a node's power profile (Since defaults to now)
+func SetNodePower(ctx context.Context, kv jetstream.KeyValue, p NodePower) error {
+	if p.Node == "" {
+		return fmt.Errorf("power profile needs a node name")
+	}
+	if err := validPower(p.Profile); err != nil {
+		return err
+	}
+	if p.Since.IsZero() {
+		p.Since = time.Now().UTC()
+	}
+	if _, err := NewTypedKV[NodePower](kv).Put(ctx, p.Node, p); err != nil {
+		return fmt.Errorf("setting power profile of %s: %w", p.Node, err)
+	}
+	return nil
+}
+
+// ClearNodePower returns a node to its configured power profile
+func ClearNodePower(ctx context.Context, kv jetstream.KeyValue, node string) error {
+	if err := kv.Delete(ctx, node); err != nil {
+		return fmt.Errorf("clearing power profile of %s: %w", node, err)
+	}
+	return nil
+}
+
+// PowerProfile returns the current power profile
+func (m *Manager) PowerProfile() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.power == "" {
+		return PowerNormal
+	}
+	return m.power
+}
+
+// SetPowerProfile switches this Manager's power profile until the next
+// node_power change
+func (m *Manager) SetPowerProfile(profile string) error {
+	if err := validPower(profile); err != nil {
+		return err
+	}
+	m.setPower(profile)
+	return nil
+}
+
+// watchNodePower applies the node's override as it changes
+func (m *Manager) watchNodePower() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := OpenNodePowerBucket(ctx, m.natsNode.ControlJetStream())
+	if err != nil {
+		return err
+	}
+
+	entries := NewTypedKV[NodePower](kv)
+	entries.SetLogger(componentLogger(m.opts.Logger, "power"))
+	w, err := entries.Watch(context.Background(), m.natsNode.Name(), func(key string, entry *NodePower, deleted bool) {
+		profile := m.opts.PowerProfile
+		if entry != nil {
+			if err := validPower(entry.Profile); err != nil {
+				m.logger.Warn("ignoring power override", "error", err)
+				return
+			}
+			profile = entry.Profile
+		}
+		m.setPower(profile)
+	})
+	if err != nil {
+		return fmt.Errorf("watching power profile: %w", err)
+	}
+
+	m.mu.Lock()
+	m.powerWatch = w
+	m.mu.Unlock()
+	return nil
+}
+
+// setPower switches the heartbeat, publish batching and registration to
+// profile ("" = normal)
+func (m *Manager) setPower(profile string) {
+	if profile == "" {
+		profile = PowerNormal
+	}
+	cfg := m.opts.LowPower.withDefaults()
+
+	m.mu.Lock()
+	if m.closed || m.power == profile || m.power == "" && profile == PowerNormal {
+		m.mu.Unlock()
+		return
+	}
+	m.power = profile
+	registrar, old := m.registrar, m.batch
+	m.batch = nil
+	if profile == PowerLow {
+		m.batch = startPublishBatch(cfg.Batch, cfg.MaxBatch, m.publish, componentLogger(m.opts.Logger, "power"))
+	}
+	m.mu.Unlock()
+	if old != nil {
+		old.stop() // Sends what is queued
+	}
+
+	var power *registry.Power
+	interval := time.Duration(m.opts.HeartbeatInterval) * time.Second
+	if profile == PowerLow {
+		interval = cfg.Heartbeat
+		power = &registry.Power{Profile: PowerLow, Heartbeat: int(interval / time.Second)}
+	}
+	m.logger.Info("power profile changed", "profile", profile, "heartbeat", interval)
+	if registrar != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := registrar.SetPower(ctx, power, interval); err != nil {
+			m.logger.Warn("updating registration power profile failed", "error", err)
+		}
+	}
+}
+
+// stopBatch sends the queued publishes and stops batching
+func (m *Manager) stopBatch() {
+	m.mu.Lock()
+	batch := m.batch
+	m.batch = nil
+	m.mu.Unlock()
+	if batch != nil {
+		batch.stop()
+	}
+}
+
+// heartbeatLate reports whether reg's last health check is more than two
+// of its heartbeats old. normal is the interval of registrations without
+// a power profile; leafnode registrations never heartbeat.
+func heartbeatLate(reg registry.ServiceRegistration, normal time.Duration, now time.Time) bool {
+	if reg.Health == nil || reg.Instance.Liveness == LivenessLeafnode {
+		return false
+	}
+	interval := normal
+	if reg.Power != nil && reg.Power.Heartbeat > 0 {
+		interval = time.Duration(reg.Power.Heartbeat) * time.Second
+	}
+	return now.Sub(reg.Health.Checked) > 2*interval
+}
+
+// batchedMsg is a publish waiting in a batch
+type batchedMsg struct {
+	subject string
+	data    []byte
+}
+
+// publishBatch queues publishes and sends them together
+type publishBatch struct {
+	mu      sync.Mutex
+	msgs    []batchedMsg
+	max     int
+	publish func(ctx context.Context, subject string, data []byte) error
+	logger  *slog.Logger
+	kick    chan struct{} // Batch is full
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// startPublishBatch sends queued publishes every interval, or as soon as
+// max are queued
+func startPublishBatch(every time.Duration, max int, publish func(ctx context.Context, subject string, data []byte) error, logger *slog.Logger) *publishBatch {
+	b := &publishBatch{
+		max:     max,
+		publish: publish,
+		logger:  logger,
+		kick:    make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run(every)
+	return b
+}
+
+// add queues a publish
+func (b *publishBatch) add(subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.msgs = append(b.msgs, batchedMsg{subject: subject, data: bytes.Clone(data)})
+	if len(b.msgs) >= b.max {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// pending returns the number of queued publishes
+func (b *publishBatch) pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.msgs)
+}
+
+// run sends the batch on every tick and kick, and once more on stop
+func (b *publishBatch) run(every time.Duration) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stopCh:
+			b.flush()
+			return
+		case <-ticker.C:
+			b.flush()
+		case <-b.kick:
+			b.flush()
+		}
+	}
+}
+
+// flush sends the queued publishes in order
+func (b *publishBatch) flush() {
+	b.mu.Lock()
+	msgs := b.msgs
+	b.msgs = nil
+	b.mu.Unlock()
+	if len(msgs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	failed := 0
+	var lastErr error
+	for _, msg := range msgs {
+		if err := b.publish(ctx, msg.subject, msg.data); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		b.logger.Warn("batched publishes failed", "failed", failed, "sent", len(msgs)-failed, "error", lastErr)
+	}
+}
+
+// stop sends what is queued and stops the batch
+func (b *publishBatch) stop() {
+	close(b.stopCh)
+	<-b.done
+}
@@ -0,0 +1,153 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestLowPowerConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LowPowerConfig
+		want LowPowerConfig
+	}{
+		{
+			name: "zero",
+			want: LowPowerConfig{Heartbeat: DefaultLowPowerHeartbeat, Batch: DefaultLowPowerBatch, MaxBatch: DefaultLowPowerMaxBatch},
+		},
+		{
+			name: "heartbeat capped",
+			cfg:  LowPowerConfig{Heartbeat: 5 * time.Minute, Batch: time.Minute, MaxBatch: 10},
+			want: LowPowerConfig{Heartbeat: DefaultLowPowerHeartbeat, Batch: time.Minute, MaxBatch: 10},
+		},
+		{
+			name: "shorter heartbeat kept",
+			cfg:  LowPowerConfig{Heartbeat: 15 * time.Second},
+			want: LowPowerConfig{Heartbeat: 15 * time.Second, Batch: DefaultLowPowerBatch, MaxBatch: DefaultLowPowerMaxBatch},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.withDefaults(); got != tt.want {
+			t.Errorf("%s: withDefaults() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublishBatch(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	sentCh := make(chan struct{}, 10)
+	publish := func(ctx context.Context, subject string, data []byte) error {
+		mu.Lock()
+		sent = append(sent, subject+":"+string(data))
+		mu.Unlock()
+		sentCh <- struct{}{}
+		return nil
+	}
+
+	b := startPublishBatch(time.Hour, 3, publish, componentLogger(nil, "power"))
+	for i := 1; i <= 3; i++ { // The third fills the batch
+		b.add("readings", []byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-sentCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("full batch was not sent")
+		}
+	}
+
+	b.add("readings", []byte("4"))
+	if got := b.pending(); got != 1 {
+		t.Errorf("pending() = %d, want 1", got)
+	}
+	b.stop()
+
+	want := []string{"readings:1", "readings:2", "readings:3", "readings:4"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent = %q, want %q", sent, want)
+	}
+}
+
+func TestManagerSetPower(t *testing.T) {
+	type config struct{}
+	ctx := context.Background()
+	kv := newMemKV()
+
+	r := NewRegistrar(kv, 10*time.Second)
+	if err := r.Register(ctx, "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	m := &Manager{
+		registrar: r,
+		opts:      Options{HeartbeatInterval: 10, LowPower: LowPowerConfig{Heartbeat: 20 * time.Second}},
+		logger:    componentLogger(nil, "manager"),
+	}
+	defer m.stopBatch()
+
+	if err := m.SetPowerProfile("eco"); err == nil {
+		t.Error("SetPowerProfile(eco) succeeded, want error")
+	}
+
+	if err := m.SetPowerProfile(PowerLow); err != nil {
+		t.Fatalf("SetPowerProfile(low) error = %v", err)
+	}
+	if got := r.Registration().Power; got == nil || got.Profile != PowerLow || got.Heartbeat != 20 {
+		t.Errorf("registration power = %+v, want low every 20s", got)
+	}
+	if m.batch == nil {
+		t.Error("low profile does not batch publishes")
+	}
+
+	if err := m.SetPowerProfile(PowerNormal); err != nil {
+		t.Fatalf("SetPowerProfile(normal) error = %v", err)
+	}
+	if got := r.Registration().Power; got != nil {
+		t.Errorf("registration power after normal = %+v, want nil", got)
+	}
+	if got := m.PowerProfile(); got != PowerNormal {
+		t.Errorf("PowerProfile() = %q, want normal", got)
+	}
+	if m.batch != nil {
+		t.Error("normal profile still batches publishes")
+	}
+}
+
+func TestHeartbeatLate(t *testing.T) {
+	now := time.Now()
+	checked := func(ago time.Duration) *registry.HealthInfo {
+		return &registry.HealthInfo{Live: true, Ready: true, Checked: now.Add(-ago)}
+	}
+	tests := []struct {
+		name string
+		reg  registry.ServiceRegistration
+		want bool
+	}{
+		{name: "no health", reg: registry.ServiceRegistration{}, want: false},
+		{name: "recent", reg: registry.ServiceRegistration{Health: checked(5 * time.Second)}, want: false},
+		{name: "overdue", reg: registry.ServiceRegistration{Health: checked(25 * time.Second)}, want: true},
+		{
+			name: "low power on time",
+			reg:  registry.ServiceRegistration{Health: checked(25 * time.Second), Power: &registry.Power{Profile: PowerLow, Heartbeat: 25}},
+			want: false,
+		},
+		{
+			name: "leafnode liveness",
+			reg:  registry.ServiceRegistration{Health: checked(time.Hour), Instance: registry.InstanceInfo{Liveness: LivenessLeafnode}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		if got := heartbeatLate(tt.reg, 10*time.Second, now); got != tt.want {
+			t.Errorf("%s: heartbeatLate() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Stress tests for the concurrent paths of the registrar, watchers and
+// monitors. They pass without -race too, but are meant to be run with it:
+//
+//	task test:race
+
+// stressN is the number of concurrent workers per stress test
+const stressN = 200
+
+func TestRegistrarConcurrent(t *testing.T) {
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+
+	ctx := context.Background()
+	kv := newMemKV()
+
+	registrars := make([]*Registrar, stressN)
+	for i := range registrars {
+		registrars[i] = NewRegistrar(kv, 50*time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range registrars {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2; j++ { // Re-registering must not start a second heartbeat
+				if err := r.Register(ctx, "RACE", &config{Port: 8080}); err != nil {
+					t.Errorf("Register() error = %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = r.Registration()
+				_ = r.Key()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			r.SetHealth(NewHealthRegistry())
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(100 * time.Millisecond) // Let some heartbeats run
+
+	for _, r := range registrars {
+		wg.Add(2)
+		for j := 0; j < 2; j++ {
+			go func() {
+				defer wg.Done()
+				if err := r.Deregister(ctx); err != nil {
+					t.Errorf("Deregister() error = %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, r := range registrars {
+		if _, err := kv.Get(ctx, r.Key()); !errors.Is(err, jetstream.ErrKeyNotFound) {
+			t.Errorf("key %s still registered after Deregister (err = %v)", r.Key(), err)
+		}
+		if err := r.Register(ctx, "RACE", &config{}); err == nil {
+			t.Error("Register() after Deregister succeeded, want error")
+		}
+	}
+}
+
+func TestServiceWatcherConcurrent(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+
+	reg := func(id string) []byte {
+		return []byte(fmt.Sprintf(`{"version":%d,"github":{"org":"o","repo":"r"},"instance":{"id":%q}}`, registry.SchemaVersion, id))
+	}
+
+	stop := make(chan struct{})
+	var writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("o.r.w%d-%d", i, j%10)
+				if j%3 == 0 {
+					_ = kv.Delete(ctx, key)
+				} else {
+					_, _ = kv.Put(ctx, key, reg(key))
+				}
+			}
+		}()
+	}
+
+	var seen atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < stressN; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var w *ServiceWatcher
+			var err error
+			if i%2 == 0 {
+				w, err = WatchService(ctx, kv, "o/r", func(registry.ServiceRegistration) { seen.Add(1) })
+			} else {
+				w, err = WatchAll(ctx, kv, func(string, *registry.ServiceRegistration, bool) { seen.Add(1) })
+			}
+			if err != nil {
+				t.Errorf("watch error = %v", err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+
+			// Concurrent and repeated Stop must not panic
+			var stops sync.WaitGroup
+			for j := 0; j < 3; j++ {
+				stops.Add(1)
+				go func() {
+					defer stops.Done()
+					w.Stop()
+				}()
+			}
+			stops.Wait()
+		}()
+	}
+	wg.Wait()
+
+	close(stop)
+	writers.Wait()
+
+	if seen.Load() == 0 {
+		t.Error("watchers saw no updates")
+	}
+}
+
+func TestResolverConcurrent(t *testing.T) {
+	src := &fakeSource{regs: []registry.ServiceRegistration{instance("a", true), instance("b", true)}}
+	r, err := newResolver(context.Background(), src, "o/r", WithRefreshInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("newResolver() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressN; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			src.put(instance(fmt.Sprintf("i%d", i%20), true))
+		}()
+		go func() {
+			defer wg.Done()
+			if inst, err := r.Pick(); err == nil {
+				r.ReportFailure(inst.Instance.ID)
+			}
+			_ = r.Instances()
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Stop(); err != nil {
+				t.Errorf("Stop() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLeafLivenessStopConcurrent(t *testing.T) {
+	l := &LeafLiveness{
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+		interval: time.Hour, // Never sweeps
+	}
+	go l.run()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestManagerOpenCloseConcurrent(t *testing.T) {
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+
+	ctx := context.Background()
+	kv := newMemKV()
+
+	for i := 0; i < stressN/10; i++ {
+		m, err := New("RACE", WithoutNATS(), WithMetrics("127.0.0.1:0"), WithHealthEndpoints("127.0.0.1:0"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		m.registrar = NewRegistrar(kv, 50*time.Millisecond)
+		if err := m.registrar.Register(ctx, "RACE", &config{}); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if err := m.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				_ = m.Registration()
+				_ = m.ConfigSources()
+				m.Health().AddLiveness("loop", func(context.Context) error { return nil })
+			}()
+		}
+		wg.Wait()
+
+		if _, err := m.Parse(&config{}); err == nil {
+			t.Error("Parse() after Close succeeded, want error")
+		}
+	}
+
+	if keys, err := kv.Keys(ctx); !errors.Is(err, jetstream.ErrNoKeysFound) {
+		t.Errorf("registrations left after Close: %v", keys)
+	}
+}
@@ -5,21 +5,29 @@
 // 2. Builds a ServiceRegistration with GitHub identity + fields
 // 3. Stores it in NATS KV bucket "services_registry"
 // 4. Starts a heartbeat goroutine to keep registration alive
+// 5. Records schema changes in "services_history" (see history.go)
 //
 // Key format: {org}.{repo}.{instance_id}
 // TTL: 30 seconds (must heartbeat every 10s)
+//
+// Leaf registrars (NewLeafRegistrar) write once to "services_static" and
+// skip the heartbeat; the hub tracks liveness instead (see liveness.go).
 package env
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
 	"github.com/joeblew999/wellnown-env/pkg/env/registry"
 	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Registrar handles service registration and heartbeat
@@ -30,7 +38,27 @@ type Registrar struct {
 	reg      registry.ServiceRegistration
 	stopCh   chan struct{}
 	stopped  bool
-	interval time.Duration
+	beating  bool          // Heartbeat goroutine running
+	interval time.Duration // 0 = no heartbeat
+	node     string        // Embedded NATS server name
+	liveness string
+	tracer   trace.Tracer
+	history  jetstream.KeyValue // services_history (nil = not recorded)
+	logger   *slog.Logger
+	caps     registry.Capabilities
+	health   *HealthRegistry // nil = no health reported
+	write    WritePolicy     // Timeout and retries of KV writes
+	local    *LocalStore     // Heartbeat and alert record (nil = none)
+
+	maint *registry.Maintenance // Node maintenance (nil = in service)
+	tags  map[string]string     // Node tags (nil = none)
+	power *registry.Power       // Power profile (nil = normal)
+
+	advertise string // Advertised host:port (empty = detect from config)
+	instance  string // Instance ID (empty = a new one per Register)
+	secret    string // Callout token secret, only its hash is registered (see callout.go)
+
+	runtime func() *registry.RuntimeStats // Heartbeat runtime stats (nil = not reported)
 }
 
 // NewRegistrar creates a new service registrar
@@ -39,23 +67,224 @@ func NewRegistrar(kv jetstream.KeyValue, interval time.Duration) *Registrar {
 		kv:       kv,
 		stopCh:   make(chan struct{}),
 		interval: interval,
+		liveness: LivenessHeartbeat,
+		tracer:   newTracer(nil),
+		logger:   componentLogger(nil, "registrar"),
 	}
 }
 
+// NewLeafRegistrar creates a registrar for leafnode liveness: the
+// registration is written once and the hub tracks node connectivity
+func NewLeafRegistrar(kv jetstream.KeyValue, node string) *Registrar {
+	return &Registrar{
+		kv:       kv,
+		stopCh:   make(chan struct{}),
+		node:     node,
+		liveness: LivenessLeafnode,
+		tracer:   newTracer(nil),
+		logger:   componentLogger(nil, "registrar"),
+	}
+}
+
+// SetNode records the embedded NATS server name in the registration
+func (r *Registrar) SetNode(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.node = node
+}
+
+// SetTracer sets the tracer used for registry KV spans
+func (r *Registrar) SetTracer(tracer trace.Tracer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tracer = tracer
+}
+
+// SetLogger sets the logger for registration and heartbeat events
+func (r *Registrar) SetLogger(logger *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logger
+}
+
+// SetCapabilities sets the capabilities advertised in the registration
+func (r *Registrar) SetCapabilities(caps registry.Capabilities) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caps = caps
+}
+
+// SetHealth includes the aggregated result of health's checks in the
+// registration and every heartbeat
+func (r *Registrar) SetHealth(health *HealthRegistry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health = health
+}
+
+// SetRuntimeStats includes the stats fn returns in the registration and
+// every heartbeat
+func (r *Registrar) SetRuntimeStats(fn func() *registry.RuntimeStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runtime = fn
+}
+
+// runtimeStats returns the current runtime stats (nil if not reported).
+// Callers hold r.mu.
+func (r *Registrar) runtimeStats() *registry.RuntimeStats {
+	if r.runtime == nil {
+		return nil
+	}
+	return r.runtime()
+}
+
+// checkHealth runs the health checks (nil if none are registered).
+// It must be called without holding r.mu, as checks may be slow.
+func (r *Registrar) checkHealth(ctx context.Context) *registry.HealthInfo {
+	r.mu.Lock()
+	health := r.health
+	r.mu.Unlock()
+
+	if health == nil || health.Len() == 0 {
+		return nil
+	}
+	info := health.Check(ctx)
+	return &info
+}
+
+// SetMaintenance marks the registration as draining (nil clears it) and
+// stores it at once if registered
+func (r *Registrar) SetMaintenance(ctx context.Context, maint *registry.Maintenance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maint = maint
+	if r.key == "" || r.stopped {
+		return nil
+	}
+	r.reg.Maintenance = maint
+	return r.store(ctx)
+}
+
+// SetTags sets the node tags in the registration and stores it at once
+// if registered
+func (r *Registrar) SetTags(ctx context.Context, tags map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tags = tags
+	if r.key == "" || r.stopped {
+		return nil
+	}
+	r.reg.Instance.Tags = tags
+	return r.store(ctx)
+}
+
+// SetPower sets the power profile in the registration (nil = normal) and
+// changes the heartbeat interval; the new interval applies from the next
+// heartbeat. Leaf registrars keep not heartbeating.
+func (r *Registrar) SetPower(ctx context.Context, power *registry.Power, interval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.power = power
+	if r.interval > 0 && interval > 0 {
+		r.interval = interval
+	}
+	if r.key == "" || r.stopped {
+		return nil
+	}
+	r.reg.Power = power
+	return r.store(ctx)
+}
+
+// SetWritePolicy sets the timeout and retries of registry writes
+func (r *Registrar) SetWritePolicy(p WritePolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.write = p
+}
+
+// SetLocalStore records every heartbeat in s and raises an alert there
+// when a health check starts failing
+func (r *Registrar) SetLocalStore(s *LocalStore) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.local = s
+}
+
+// SetAdvertiseAddr sets the host:port registered for the instance instead
+// of detecting it from config (see advertise.go)
+func (r *Registrar) SetAdvertiseAddr(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.advertise = addr
+}
+
+// SetInstanceID sets the ID registered for the instance, e.g. to match
+// the names of its NATS connections
+func (r *Registrar) SetInstanceID(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.instance = id
+}
+
+// advertiseAddr returns the instance's address for cfg
+func (r *Registrar) advertiseAddr(cfg interface{}) string {
+	if r.advertise != "" {
+		return advertiseAddr(r.advertise, "", localAddr)
+	}
+	return DetectAdvertiseAddr(cfg)
+}
+
+// SetHistory enables recording schema changes to the services_history bucket
+func (r *Registrar) SetHistory(kv jetstream.KeyValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history = kv
+}
+
 // Register creates a service registration from config struct and starts heartbeat
 func (r *Registrar) Register(ctx context.Context, prefix string, cfg interface{}) error {
+	health := r.checkHealth(ctx)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.stopped {
+		return fmt.Errorf("registrar stopped")
+	}
+
 	// Build registration from config struct
+	fields := ExtractFields(prefix, cfg)
+	id := r.instance
+	if id == "" {
+		id = uuid.New().String()[:8]
+	}
+	if r.secret == "" {
+		secret, err := auth.GenerateToken()
+		if err != nil {
+			return err
+		}
+		r.secret = secret
+	}
 	r.reg = registry.ServiceRegistration{
-		GitHub: registry.GetGitHubInfo(),
+		Version: registry.SchemaVersion,
+		GitHub:  registry.GetGitHubInfo(),
 		Instance: registry.InstanceInfo{
-			ID:      uuid.New().String()[:8],
-			Host:    "", // TODO: detect host:port from config
-			Started: time.Now(),
+			ID:        id,
+			Host:      r.advertiseAddr(cfg),
+			Started:   time.Now(),
+			Node:      r.node,
+			Liveness:  r.liveness,
+			Tags:      r.tags,
+			TokenHash: CalloutTokenHash(r.secret),
 		},
-		Fields: ExtractFields(prefix, cfg),
+		Fields:       fields,
+		Capabilities: r.caps,
+		Health:       health,
+		ConfigHash:   ConfigHash(fields, cfg),
+		Maintenance:  r.maint,
+		Power:        r.power,
+		Runtime:      r.runtimeStats(),
 	}
 
 	// Build KV key
@@ -71,20 +300,44 @@ func (r *Registrar) Register(ctx context.Context, prefix string, cfg interface{}
 		return err
 	}
 
-	// Start heartbeat
-	go r.heartbeat()
+	// Record schema changes (best effort - history is informational)
+	if r.history != nil {
+		if recorded, err := RecordRegistration(ctx, r.history, r.reg); err != nil {
+			r.logger.Warn("recording registration history failed", "key", r.key, "error", err)
+		} else if recorded {
+			r.logger.Info("registration schema changed", "service", r.reg.GitHub.Name())
+		}
+	}
+
+	r.logger.Info("registered", "key", r.key, "liveness", r.liveness, "fields", len(r.reg.Fields))
+
+	// Start heartbeat (leaf registrars rely on the hub instead). Registering
+	// again just replaces the registration the running heartbeat refreshes.
+	if r.interval > 0 && !r.beating {
+		r.beating = true
+		go r.heartbeat()
+	}
 
 	return nil
 }
 
 // store writes the registration to KV
-func (r *Registrar) store(ctx context.Context) error {
+func (r *Registrar) store(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, r.tracer, "env.registry.Put", attribute.String("env.registry.key", r.key))
+	defer func() { endSpan(span, err) }()
+
 	data, err := json.Marshal(r.reg)
 	if err != nil {
 		return fmt.Errorf("marshaling registration: %w", err)
 	}
+	if len(data) > registry.MaxPayloadSize {
+		return fmt.Errorf("registration for %s: %w (%d bytes, max %d)", r.key, registry.ErrPayloadTooLarge, len(data), registry.MaxPayloadSize)
+	}
 
-	_, err = r.kv.Put(ctx, r.key, data)
+	err = r.write.do(ctx, "put", r.key, func(ctx context.Context) error {
+		_, err := r.kv.Put(ctx, r.key, data)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("storing registration: %w", err)
 	}
@@ -94,7 +347,10 @@ func (r *Registrar) store(ctx context.Context) error {
 
 // heartbeat periodically refreshes the registration
 func (r *Registrar) heartbeat() {
-	ticker := time.NewTicker(r.interval)
+	r.mu.Lock()
+	interval := r.interval
+	r.mu.Unlock()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -102,32 +358,76 @@ func (r *Registrar) heartbeat() {
 		case <-r.stopCh:
 			return
 		case <-ticker.C:
+			health := r.checkHealth(context.Background())
+
 			r.mu.Lock()
 			if r.stopped {
 				r.mu.Unlock()
 				return
 			}
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			if err := r.store(ctx); err != nil {
+			r.reg.Health = health
+			r.reg.Runtime = r.runtimeStats()
+			// The write policy retries transient failures, but a heartbeat
+			// never runs into the next one
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := r.store(ctx)
+			if err != nil {
 				// Log but don't fail - registration will expire
-				fmt.Printf("heartbeat failed: %v\n", err)
+				metrics.heartbeatFail.Add(1)
+				r.logger.Warn("heartbeat failed", "key", r.key, "error", err)
+			} else {
+				metrics.heartbeatOK.Add(1)
+				r.logger.Debug("heartbeat", "key", r.key)
 			}
 			cancel()
+			key, local := r.key, r.local
+			if r.interval != interval { // Power profile changed
+				interval = r.interval
+				ticker.Reset(interval)
+			}
 			r.mu.Unlock()
+
+			if local != nil {
+				r.recordLocal(local, key, health, err, interval)
+			}
+		}
+	}
+}
+
+// recordLocal writes a heartbeat and new health alerts to the local store
+func (r *Registrar) recordLocal(local *LocalStore, key string, health *registry.HealthInfo, err error, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := local.RecordHeartbeat(ctx, key, err); err != nil {
+		r.logger.Warn("recording heartbeat locally failed", "error", err)
+	}
+	if health != nil {
+		if err := local.ObserveHealth(ctx, *health); err != nil {
+			r.logger.Warn("recording health alert locally failed", "error", err)
 		}
 	}
 }
 
-// Deregister removes the service from the registry
+// Deregister removes the service from the registry. Calls after the first
+// are no-ops.
 func (r *Registrar) Deregister(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.stopped {
+		return nil
+	}
 	r.stopped = true
 	close(r.stopCh)
 
 	if r.key != "" {
-		return r.kv.Delete(ctx, r.key)
+		ctx, span := startSpan(ctx, r.tracer, "env.registry.Delete", attribute.String("env.registry.key", r.key))
+		err := r.write.do(ctx, "delete", r.key, func(ctx context.Context) error {
+			return r.kv.Delete(ctx, r.key)
+		})
+		endSpan(span, err)
+		return err
 	}
 	return nil
 }
@@ -139,6 +439,17 @@ func (r *Registrar) Key() string {
 	return r.key
 }
 
+// CalloutToken returns the token the instance's clients connect with in
+// callout mode, {key}:{secret} (empty before Register)
+func (r *Registrar) CalloutToken() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.key == "" {
+		return ""
+	}
+	return r.key + ":" + r.secret
+}
+
 // Registration returns a copy of the current registration
 func (r *Registrar) Registration() registry.ServiceRegistration {
 	r.mu.Lock()
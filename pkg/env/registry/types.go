@@ -4,22 +4,189 @@
 // - GitHub identity (org/repo/commit/tag/branch)
 // - Instance info (id, host, started time)
 // - Config fields (extracted from struct with conf tags)
+// - Capabilities (subjects, HTTP endpoints, micro services, health URL)
 //
 // This information enables:
 // - Service discovery across the mesh
 // - Config/env requirement visibility
 // - Dependency tracking via service: tags
 // - Change detection in CI/CD
+//
+// Schema versions:
+// - 1: github, instance, fields (payloads without a "version" field)
+// - 2: adds version and capabilities
+// - 3: adds config_hash
+// - 4: adds help on fields
+// - 5: adds maintenance
+// - 6: adds tags on instances
+// - 7: adds power
+// - 8: adds runtime
+// - 9: adds endpoints to runtime
+// - 10: adds token_hash on instances
+//
+// Always read payloads with Decode so old and new registrations coexist
+// during rolling upgrades. Decode is strict about payloads of known
+// versions (size limit, no unknown fields, exactly one JSON object) so
+// malformed or malicious entries are rejected rather than half-read.
 package registry
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the registration schema written by this package
+const SchemaVersion = 10
+
+// MaxPayloadSize is the largest registration payload Decode accepts.
+// Real registrations are a few KiB even with hundreds of fields.
+const MaxPayloadSize = 64 * 1024
+
+// ErrPayloadTooLarge is returned for payloads over MaxPayloadSize
+var ErrPayloadTooLarge = errors.New("registration payload too large")
 
 // ServiceRegistration is the complete registration payload sent to NATS KV.
 // Key format: {org}.{repo}.{instance_id}
 type ServiceRegistration struct {
-	GitHub   GitHubInfo   `json:"github"`
-	Instance InstanceInfo `json:"instance"`
-	Fields   []FieldInfo  `json:"fields"`
+	Version      int           `json:"version,omitempty"` // Schema version (missing = 1)
+	GitHub       GitHubInfo    `json:"github"`
+	Instance     InstanceInfo  `json:"instance"`
+	Fields       []FieldInfo   `json:"fields"`
+	Capabilities Capabilities  `json:"capabilities"`
+	Health       *HealthInfo   `json:"health,omitempty"`      // Latest aggregated health (nil = not reported)
+	ConfigHash   string        `json:"config_hash,omitempty"` // Hash of non-secret resolved values (empty before schema 3)
+	Maintenance  *Maintenance  `json:"maintenance,omitempty"` // Node in maintenance (schema 5; nil = in service)
+	Power        *Power        `json:"power,omitempty"`       // Power profile (schema 7; nil = normal)
+	Runtime      *RuntimeStats `json:"runtime,omitempty"`     // Process stats from the last heartbeat (schema 8)
+}
+
+// RuntimeStats are lightweight process stats sent with every heartbeat
+type RuntimeStats struct {
+	Goroutines  int       `json:"goroutines"`
+	RSS         uint64    `json:"rss,omitempty"` // Resident memory in bytes (0 = unknown)
+	Uptime      int64     `json:"uptime"`        // Seconds since the instance started
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+
+	Endpoints []EndpointStats `json:"endpoints,omitempty"` // NATS micro endpoints of the instance (schema 9)
+}
+
+// EndpointStats are the request counts and latency of a NATS micro
+// endpoint, as reported on $SRV.STATS
+type EndpointStats struct {
+	Service     string        `json:"service"` // Micro service name
+	Endpoint    string        `json:"endpoint"`
+	Subject     string        `json:"subject,omitempty"`
+	Instances   int           `json:"instances,omitempty"` // Service instances merged (mesh-wide stats only)
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors,omitempty"`
+	AverageTime time.Duration `json:"average_time"` // Average processing time (nanoseconds in JSON)
+	LastError   string        `json:"last_error,omitempty"`
+}
+
+// String summarizes the stats, e.g. "42 goroutines, 37.5 MiB, up 3h4m0s"
+func (s RuntimeStats) String() string {
+	out := fmt.Sprintf("%d goroutines", s.Goroutines)
+	if s.RSS > 0 {
+		out += fmt.Sprintf(", %.1f MiB", float64(s.RSS)/(1<<20))
+	}
+	return out + ", up " + (time.Duration(s.Uptime) * time.Second).String()
+}
+
+// Power is the power profile of an instance that saves energy, e.g. on
+// a battery device
+type Power struct {
+	Profile   string `json:"profile"`             // e.g. low
+	Heartbeat int    `json:"heartbeat,omitempty"` // Heartbeat interval in seconds
+}
+
+// Maintenance marks an instance whose node is being drained
+type Maintenance struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// HealthInfo is the aggregated result of an instance's health checks
+type HealthInfo struct {
+	Live    bool          `json:"live"`             // All liveness checks pass
+	Ready   bool          `json:"ready"`            // Live and all readiness checks pass
+	Checks  []CheckResult `json:"checks,omitempty"` // Individual results
+	Checked time.Time     `json:"checked"`          // When the checks ran
+}
+
+// CheckResult is the outcome of one named health check
+type CheckResult struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`            // liveness or readiness
+	Error string `json:"error,omitempty"` // Empty if the check passed
+}
+
+// Healthy returns true if the instance is ready to serve traffic.
+// Instances that don't report health are assumed healthy; instances in
+// maintenance never are.
+func (r ServiceRegistration) Healthy() bool {
+	return r.Maintenance == nil && (r.Health == nil || r.Health.Ready)
+}
+
+// Capabilities advertises what a service instance offers to the mesh
+type Capabilities struct {
+	Subjects  []string `json:"subjects,omitempty"`   // NATS subjects served (e.g. "acme.users.api.>", own org.repo namespace)
+	Endpoints []string `json:"endpoints,omitempty"`  // HTTP endpoints (e.g. "GET /api/users")
+	Micro     []string `json:"micro,omitempty"`      // NATS micro service names
+	HealthURL string   `json:"health_url,omitempty"` // Health check URL
+}
+
+// IsZero returns true if no capabilities are declared
+func (c Capabilities) IsZero() bool {
+	return len(c.Subjects) == 0 && len(c.Endpoints) == 0 && len(c.Micro) == 0 && c.HealthURL == ""
+}
+
+// Decode parses a registration payload of any known schema version.
+// Version reports the payload's original schema, so callers can tell
+// "no capabilities declared" (2) from "capabilities unknown" (1).
+// Payloads from newer schemas are decoded best-effort: unknown fields are
+// only allowed there.
+func Decode(data []byte) (ServiceRegistration, error) {
+	var reg ServiceRegistration
+	if len(data) > MaxPayloadSize {
+		return reg, fmt.Errorf("decoding registration: %w (%d bytes, max %d)", ErrPayloadTooLarge, len(data), MaxPayloadSize)
+	}
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return reg, fmt.Errorf("decoding registration: payload is null")
+	}
+
+	// Peek at the version to pick strict or best-effort decoding (this
+	// also rejects non-objects and trailing data)
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return reg, fmt.Errorf("decoding registration: %w", err)
+	}
+	if probe.Version < 0 {
+		return reg, fmt.Errorf("decoding registration: invalid version %d", probe.Version)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if probe.Version <= SchemaVersion {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&reg); err != nil {
+		return ServiceRegistration{}, fmt.Errorf("decoding registration: %w", err)
+	}
+
+	if reg.Version == 0 {
+		reg.Version = 1 // Written before schema versioning
+	}
+	return reg, nil
+}
+
+// HasCapabilities returns true if the payload's schema carries capabilities
+func (r ServiceRegistration) HasCapabilities() bool {
+	return r.Version >= 2
 }
 
 // GitHubInfo identifies the service by its GitHub coordinates.
@@ -34,19 +201,26 @@ type GitHubInfo struct {
 
 // InstanceInfo identifies a specific running instance of a service
 type InstanceInfo struct {
-	ID      string    `json:"id"`      // Unique instance ID (UUID)
-	Host    string    `json:"host"`    // Host:port the service is listening on
-	Started time.Time `json:"started"` // When the instance started
+	ID       string    `json:"id"`                 // Unique instance ID (UUID)
+	Host     string    `json:"host"`               // Host:port the service is listening on
+	Started  time.Time `json:"started"`            // When the instance started
+	Node     string    `json:"node,omitempty"`     // Embedded NATS server name
+	Liveness string    `json:"liveness,omitempty"` // heartbeat or leafnode
+
+	Tags map[string]string `json:"tags,omitempty"` // Node tags, e.g. site=warehouse-3 (schema 6)
+
+	TokenHash string `json:"token_hash,omitempty"` // SHA-256 (hex) of the instance's callout token secret (schema 10)
 }
 
 // FieldInfo describes a config field extracted from the struct via reflection
 type FieldInfo struct {
-	Path     string `json:"path"`               // Field path (e.g., "DB.Password")
-	Type     string `json:"type"`               // Go type (string, int, bool, etc.)
-	EnvKey   string `json:"env_key"`            // Environment variable name
-	Default  string `json:"default,omitempty"`  // Default value if any
-	Required bool   `json:"required,omitempty"` // Is field required?
+	Path     string `json:"path"`                // Field path (e.g., "DB.Password")
+	Type     string `json:"type"`                // Go type (string, int, bool, etc.)
+	EnvKey   string `json:"env_key"`             // Environment variable name
+	Default  string `json:"default,omitempty"`   // Default value if any
+	Required bool   `json:"required,omitempty"`  // Is field required?
 	IsSecret bool   `json:"is_secret,omitempty"` // Is field a secret (masked)?
+	Help     string `json:"help,omitempty"`      // Description from the help: tag (schema 4)
 
 	// For service dependencies
 	Dependency string `json:"dependency,omitempty"` // org/repo if this is a service: tag
@@ -0,0 +1,190 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantVersion int
+		wantCaps    bool
+		wantSubject string
+		wantErr     bool
+	}{
+		{
+			name:        "v1 payload without version",
+			payload:     `{"github":{"org":"o","repo":"r"},"instance":{"id":"a"},"fields":[]}`,
+			wantVersion: 1,
+		},
+		{
+			name:        "v2 payload with capabilities",
+			payload:     `{"version":2,"github":{"org":"o","repo":"r"},"instance":{"id":"a"},"fields":[],"capabilities":{"subjects":["api.>"]}}`,
+			wantVersion: 2,
+			wantCaps:    true,
+			wantSubject: "api.>",
+		},
+		{
+			name:        "newer payload decodes best-effort",
+			payload:     `{"version":99,"github":{"org":"o","repo":"r"},"future":true}`,
+			wantVersion: 99,
+			wantCaps:    true,
+		},
+		{
+			name:        "v3 payload with config hash",
+			payload:     `{"version":3,"github":{"org":"o","repo":"r"},"config_hash":"abc"}`,
+			wantVersion: 3,
+			wantCaps:    true,
+		},
+		{
+			name:        "v4 payload with field help",
+			payload:     `{"version":4,"github":{"org":"o","repo":"r"},"fields":[{"path":"Port","type":"int","env_key":"APP_PORT","help":"Listen port"}]}`,
+			wantVersion: 4,
+			wantCaps:    true,
+		},
+		{
+			name:        "v5 payload in maintenance",
+			payload:     `{"version":5,"github":{"org":"o","repo":"r"},"maintenance":{"reason":"disk swap","since":"2026-01-02T03:04:05Z"}}`,
+			wantVersion: 5,
+			wantCaps:    true,
+		},
+		{
+			name:        "v6 payload with node tags",
+			payload:     `{"version":6,"github":{"org":"o","repo":"r"},"instance":{"id":"a","host":"","started":"2026-01-02T03:04:05Z","tags":{"site":"warehouse-3"}}}`,
+			wantVersion: 6,
+			wantCaps:    true,
+		},
+		{
+			name:        "v7 payload with low power",
+			payload:     `{"version":7,"github":{"org":"o","repo":"r"},"power":{"profile":"low","heartbeat":25}}`,
+			wantVersion: 7,
+			wantCaps:    true,
+		},
+		{
+			name:        "v8 payload with runtime stats",
+			payload:     `{"version":8,"github":{"org":"o","repo":"r"},"runtime":{"goroutines":42,"rss":39321600,"uptime":11040,"last_error":"job 7: timeout","last_error_at":"2026-01-02T03:04:05Z"}}`,
+			wantVersion: 8,
+			wantCaps:    true,
+		},
+		{
+			name:        "v9 payload with micro endpoints",
+			payload:     `{"version":9,"github":{"org":"o","repo":"r"},"runtime":{"goroutines":42,"uptime":60,"endpoints":[{"service":"billing","endpoint":"charge","subject":"billing.charge","requests":120,"errors":2,"average_time":1500000}]}}`,
+			wantVersion: 9,
+			wantCaps:    true,
+		},
+		{
+			name:    "malformed",
+			payload: `{"github":`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field in known version",
+			payload: `{"version":2,"github":{"org":"o","repo":"r"},"future":true}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown nested field in v1",
+			payload: `{"github":{"org":"o","repo":"r","owner":"x"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "trailing data",
+			payload: `{"github":{"org":"o","repo":"r"}} {}`,
+			wantErr: true,
+		},
+		{
+			name:    "null",
+			payload: `null`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			payload: `["o","r"]`,
+			wantErr: true,
+		},
+		{
+			name:    "negative version",
+			payload: `{"version":-1}`,
+			wantErr: true,
+		},
+		{
+			name:    "too large",
+			payload: `{"github":{"org":"` + strings.Repeat("o", MaxPayloadSize) + `"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := Decode([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if reg.Version != tt.wantVersion {
+				t.Errorf("Version = %d, want %d", reg.Version, tt.wantVersion)
+			}
+			if reg.HasCapabilities() != tt.wantCaps {
+				t.Errorf("HasCapabilities() = %v, want %v", reg.HasCapabilities(), tt.wantCaps)
+			}
+			if tt.wantSubject != "" && (len(reg.Capabilities.Subjects) == 0 || reg.Capabilities.Subjects[0] != tt.wantSubject) {
+				t.Errorf("Subjects = %v, want [%s]", reg.Capabilities.Subjects, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestDecode_TooLarge(t *testing.T) {
+	_, err := Decode(make([]byte, MaxPayloadSize+1))
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Decode() error = %v, want ErrPayloadTooLarge", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte(`{"github":{"org":"o","repo":"r"},"instance":{"id":"a"},"fields":[]}`))
+	f.Add([]byte(`{"version":2,"github":{"org":"o","repo":"r"},"fields":[{"path":"DB.Host","env_key":"APP_DB_HOST"}],"capabilities":{"subjects":["api.>"]}}`))
+	f.Add([]byte(`{"version":99,"future":{"nested":[1,2,3]}}`))
+	f.Add([]byte(`{"health":{"live":true,"checks":[{"name":"db"}],"checked":"2025-01-02T03:04:05Z"}}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"version":1e400}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reg, err := Decode(data)
+		if err != nil {
+			return
+		}
+		if reg.Version < 1 {
+			t.Fatalf("decoded Version = %d, want >= 1", reg.Version)
+		}
+
+		// Whatever Decode accepts must survive a round trip
+		out, err := json.Marshal(reg)
+		if err != nil || len(out) > MaxPayloadSize {
+			return
+		}
+		again, err := Decode(out)
+		if err != nil {
+			t.Fatalf("re-decoding %s: %v", out, err)
+		}
+		if again.Version != reg.Version {
+			t.Errorf("round trip Version = %d, want %d", again.Version, reg.Version)
+		}
+	})
+}
+
+func TestRuntimeStatsString(t *testing.T) {
+	s := RuntimeStats{Goroutines: 42, RSS: 39321600, Uptime: 11040}
+	if got, want := s.String(), "42 goroutines, 37.5 MiB, up 3h4m0s"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := (RuntimeStats{Goroutines: 3, Uptime: 5}).String(), "3 goroutines, up 5s"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+// replica.go: Read-replica mode for dashboards
+//
+// A dashboard running in read-replica mode keeps local copies of the
+// registry buckets, fed by JetStream sources from the hub. All reads
+// (Manager.KV, StaticKV, discovery, GUI pages) are served from the local
+// copies, so dashboards stay responsive when the hub link is slow. Writes
+// (this instance's own registration) still go to the real buckets.
+//
+// Buckets:
+//
+//	services_registry -> services_registry_replica (same 30s TTL, since
+//	                     TTL expiry is not propagated by sources)
+//	services_static   -> services_static_replica
+//
+// Set NATS_HUB_DOMAIN when the hub runs JetStream in its own domain.
+package env
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// RegistryBucket is the KV bucket holding heartbeat registrations
+const RegistryBucket = "services_registry"
+
+// replicaSuffix is appended to a bucket name for its local replica
+const replicaSuffix = "_replica"
+
+// CreateReplica creates (or opens) a local KV bucket sourced from bucket.
+// ttl must match the source bucket's TTL (0 = no TTL); domain selects the
+// hub's JetStream domain (empty = same domain).
+func CreateReplica(ctx context.Context, js jetstream.JetStream, bucket string, ttl time.Duration, domain string) (jetstream.KeyValue, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket + replicaSuffix,
+		Description: "Local read replica of " + bucket,
+		TTL:         ttl,
+		Sources: []*jetstream.StreamSource{
+			{Name: bucket, Domain: domain},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating replica of %s: %w", bucket, err)
+	}
+	return kv, nil
+}
+
+// IsReadReplica returns true if reads are served from local replicas
+func (m *Manager) IsReadReplica() bool {
+	return m.replicaKV != nil
+}
+
+// startReplicas creates the local registry replicas
+func (m *Manager) startReplicas(ctx context.Context) error {
+	js := m.natsNode.LocalJetStream() // The copies live on this node
+
+	kv, err := CreateReplica(ctx, js, RegistryBucket, 30*time.Second, m.opts.HubDomain)
+	if err != nil {
+		return err
+	}
+	static, err := CreateReplica(ctx, js, StaticRegistryBucket, 0, m.opts.HubDomain)
+	if err != nil {
+		return err
+	}
+
+	m.replicaKV = kv
+	m.replicaStaticKV = static
+	return nil
+}
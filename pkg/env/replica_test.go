@@ -0,0 +1,65 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestCreateReplica(t *testing.T) {
+	n := startTestNode(t, NATSConfig{})
+	js := n.JetStream()
+	ctx := context.Background()
+
+	source, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Put(ctx, "acme.orders.a1", []byte("before")); err != nil {
+		t.Fatal(err)
+	}
+
+	replica, err := CreateReplica(ctx, js, "orders", 0, "")
+	if err != nil {
+		t.Fatalf("CreateReplica() error = %v", err)
+	}
+	if got := replica.Bucket(); got != "orders"+replicaSuffix {
+		t.Errorf("Bucket() = %q, want orders%s", got, replicaSuffix)
+	}
+
+	// Writes made after the replica exists arrive too
+	if _, err := source.Put(ctx, "acme.orders.b2", []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Put(ctx, "acme.orders.a1", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"acme.orders.a1": "updated", "acme.orders.b2": "after"}
+	for key, value := range want {
+		waitFor(t, 5*time.Second, key+" in the replica", func() bool {
+			entry, err := replica.Get(ctx, key)
+			return err == nil && string(entry.Value()) == value
+		})
+	}
+
+	if err := source.Delete(ctx, "acme.orders.b2"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "the delete in the replica", func() bool {
+		_, err := replica.Get(ctx, "acme.orders.b2")
+		return errors.Is(err, jetstream.ErrKeyNotFound) || errors.Is(err, jetstream.ErrKeyDeleted)
+	})
+
+	// Opening it again keeps the copied entries
+	again, err := CreateReplica(ctx, js, "orders", 0, "")
+	if err != nil {
+		t.Fatalf("CreateReplica() again error = %v", err)
+	}
+	if entry, err := again.Get(ctx, "acme.orders.a1"); err != nil || string(entry.Value()) != "updated" {
+		t.Errorf("Get() after reopening = %v, %v", entry, err)
+	}
+}
@@ -0,0 +1,309 @@
+// resolver.go: Client-side load balancing over discovered instances
+//
+// A Resolver keeps the instance list of one service fresh (a KV watch of
+// puts and deletes, plus a periodic re-list) and picks one per call:
+//
+//	res, _ := env.NewResolver(ctx, mgr, "joeblew999/auth-service",
+//	    env.WithStrategy(env.LeastRecentlyFailed),
+//	    env.WithHealthyInstances(),
+//	)
+//	defer res.Stop()
+//
+//	inst, err := res.Pick()
+//	if err := call(inst.Instance.Host); err != nil {
+//	    res.ReportFailure(inst.Instance.ID)
+//	}
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// ErrNoInstances is returned by Pick when no instance is available
+var ErrNoInstances = errors.New("no instances available")
+
+// Strategy selects an instance from the candidates
+type Strategy string
+
+// Load balancing strategies
+const (
+	RoundRobin          Strategy = "round-robin"
+	Random              Strategy = "random"
+	LeastRecentlyFailed Strategy = "least-recently-failed" // Never-failed first, then oldest failure
+)
+
+// DefaultResolverRefresh is how often the instance list is re-read
+const DefaultResolverRefresh = 15 * time.Second
+
+// serviceSource is the discovery API a Resolver needs (Manager implements it)
+type serviceSource interface {
+	GetService(ctx context.Context, name string) ([]registry.ServiceRegistration, error)
+	WatchServiceInstances(ctx context.Context, name string, fn InstanceFunc) (map[string]registry.ServiceRegistration, Watcher, error)
+}
+
+// ResolverOption configures a Resolver
+type ResolverOption func(*Resolver)
+
+// WithStrategy sets the selection strategy (default: RoundRobin)
+func WithStrategy(s Strategy) ResolverOption {
+	return func(r *Resolver) {
+		r.strategy = s
+	}
+}
+
+// WithHealthyInstances only picks instances that report ready
+func WithHealthyInstances() ResolverOption {
+	return func(r *Resolver) {
+		r.healthyOnly = true
+	}
+}
+
+// WithTagSelector only picks instances on nodes matching sel (see fleet.go)
+func WithTagSelector(sel TagSelector) ResolverOption {
+	return func(r *Resolver) {
+		r.tags = sel
+	}
+}
+
+// WithRefreshInterval sets how often the instance list is re-read
+func WithRefreshInterval(d time.Duration) ResolverOption {
+	return func(r *Resolver) {
+		r.refresh = d
+	}
+}
+
+// Resolver picks instances of one service
+type Resolver struct {
+	mu          sync.Mutex
+	src         serviceSource
+	name        string
+	strategy    Strategy
+	healthyOnly bool
+	tags        TagSelector
+	refresh     time.Duration
+	instances   []registry.ServiceRegistration // Sorted by instance ID
+	next        int
+	failures    map[string]time.Time // Instance ID -> last failure
+	watcher     Watcher
+	stopCh      chan struct{}
+	done        chan struct{}
+	stopOnce    sync.Once
+	stopErr     error
+}
+
+// NewResolver creates a resolver for a service (org/repo) and loads its instances
+func NewResolver(ctx context.Context, mgr *Manager, name string, opts ...ResolverOption) (*Resolver, error) {
+	return newResolver(ctx, mgr, name, opts...)
+}
+
+// newResolver creates a resolver over any service source
+func newResolver(ctx context.Context, src serviceSource, name string, opts ...ResolverOption) (*Resolver, error) {
+	r := &Resolver{
+		src:      src,
+		name:     name,
+		strategy: RoundRobin,
+		refresh:  DefaultResolverRefresh,
+		failures: make(map[string]time.Time),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	// ctx only bounds the initial load; Stop ends the watch. The watch's
+	// own snapshot replaces that list, so no change in between is lost;
+	// its callbacks wait for the lock until then.
+	r.mu.Lock()
+	snapshot, w, err := src.WatchServiceInstances(context.Background(), name, r.apply)
+	if err == nil {
+		r.setInstances(slices.Collect(maps.Values(snapshot)))
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: %w", name, err)
+	}
+	r.watcher = w
+
+	go r.run()
+
+	return r, nil
+}
+
+// run re-lists instances periodically
+func (r *Resolver) run() {
+	defer close(r.done)
+	if r.refresh <= 0 {
+		<-r.stopCh
+		return
+	}
+
+	ticker := time.NewTicker(r.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = r.Refresh(ctx) // Keep the last known list on errors
+			cancel()
+		}
+	}
+}
+
+// Refresh re-reads the instance list
+func (r *Resolver) Refresh(ctx context.Context) error {
+	regs, err := r.src.GetService(ctx, r.name)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", r.name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setInstances(regs)
+	return nil
+}
+
+// setInstances replaces the instance list; r.mu must be held
+func (r *Resolver) setInstances(regs []registry.ServiceRegistration) {
+	sort.Slice(regs, func(i, j int) bool {
+		return regs[i].Instance.ID < regs[j].Instance.ID
+	})
+	r.instances = regs
+
+	// Forget failures of instances that are gone
+	live := make(map[string]bool, len(regs))
+	for _, reg := range regs {
+		live[reg.Instance.ID] = true
+	}
+	for id := range r.failures {
+		if !live[id] {
+			delete(r.failures, id)
+		}
+	}
+}
+
+// apply applies a watched change of the instance with registry key key
+func (r *Resolver) apply(key string, reg *registry.ServiceRegistration, deleted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !deleted {
+		r.upsert(*reg)
+		return
+	}
+	r.instances = slices.DeleteFunc(r.instances, func(inst registry.ServiceRegistration) bool {
+		if inst.KVKey() != key {
+			return false
+		}
+		delete(r.failures, inst.Instance.ID)
+		return true
+	})
+}
+
+// upsert adds or updates an instance; r.mu must be held
+func (r *Resolver) upsert(reg registry.ServiceRegistration) {
+	i := sort.Search(len(r.instances), func(i int) bool {
+		return r.instances[i].Instance.ID >= reg.Instance.ID
+	})
+	if i < len(r.instances) && r.instances[i].Instance.ID == reg.Instance.ID {
+		r.instances[i] = reg
+		return
+	}
+	r.instances = append(r.instances, registry.ServiceRegistration{})
+	copy(r.instances[i+1:], r.instances[i:])
+	r.instances[i] = reg
+}
+
+// Pick returns an instance according to the strategy
+func (r *Resolver) Pick() (registry.ServiceRegistration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	candidates := r.instances
+	if r.healthyOnly {
+		candidates = FilterHealthy(candidates)
+	}
+	if len(r.tags) > 0 {
+		candidates = FilterTags(candidates, r.tags)
+	}
+	if len(candidates) == 0 {
+		return registry.ServiceRegistration{}, fmt.Errorf("%s: %w", r.name, ErrNoInstances)
+	}
+
+	switch r.strategy {
+	case Random:
+		return candidates[rand.IntN(len(candidates))], nil
+	case LeastRecentlyFailed:
+		return r.leastRecentlyFailed(candidates), nil
+	default:
+		inst := candidates[r.next%len(candidates)]
+		r.next++
+		return inst, nil
+	}
+}
+
+// leastRecentlyFailed prefers instances that never failed (round-robin among
+// them), then the one whose last failure is oldest
+func (r *Resolver) leastRecentlyFailed(candidates []registry.ServiceRegistration) registry.ServiceRegistration {
+	var clean []registry.ServiceRegistration
+	oldest := -1
+	for i, c := range candidates {
+		failed, ok := r.failures[c.Instance.ID]
+		if !ok {
+			clean = append(clean, c)
+			continue
+		}
+		if oldest < 0 || failed.Before(r.failures[candidates[oldest].Instance.ID]) {
+			oldest = i
+		}
+	}
+
+	if len(clean) > 0 {
+		inst := clean[r.next%len(clean)]
+		r.next++
+		return inst
+	}
+	return candidates[oldest]
+}
+
+// ReportFailure records a failed call to an instance
+func (r *Resolver) ReportFailure(instanceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures[instanceID] = time.Now()
+}
+
+// Instances returns the current instance list
+func (r *Resolver) Instances() []registry.ServiceRegistration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]registry.ServiceRegistration(nil), r.instances...)
+}
+
+// Stop stops watching and refreshing. It is safe to call more than once.
+func (r *Resolver) Stop() error {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+		<-r.done
+		if r.watcher != nil {
+			r.stopErr = r.watcher.Stop()
+		}
+	})
+	return r.stopErr
+}
@@ -0,0 +1,178 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// fakeSource serves a fixed instance list
+type fakeSource struct {
+	regs []registry.ServiceRegistration
+	fn   InstanceFunc
+}
+
+func (f *fakeSource) GetService(ctx context.Context, name string) ([]registry.ServiceRegistration, error) {
+	return append([]registry.ServiceRegistration(nil), f.regs...), nil
+}
+
+func (f *fakeSource) WatchServiceInstances(ctx context.Context, name string, fn InstanceFunc) (map[string]registry.ServiceRegistration, Watcher, error) {
+	f.fn = fn
+	snapshot := make(map[string]registry.ServiceRegistration)
+	for _, reg := range f.regs {
+		snapshot[reg.KVKey()] = reg
+	}
+	return snapshot, multiWatcher{}, nil
+}
+
+// put and remove deliver a watched change
+func (f *fakeSource) put(reg registry.ServiceRegistration)    { f.fn(reg.KVKey(), &reg, false) }
+func (f *fakeSource) remove(reg registry.ServiceRegistration) { f.fn(reg.KVKey(), nil, true) }
+
+func instance(id string, ready bool) registry.ServiceRegistration {
+	reg := registry.ServiceRegistration{Instance: registry.InstanceInfo{ID: id}}
+	if !ready {
+		reg.Health = &registry.HealthInfo{Live: true}
+	}
+	return reg
+}
+
+func pickIDs(t *testing.T, r *Resolver, n int) []string {
+	t.Helper()
+	var ids []string
+	for i := 0; i < n; i++ {
+		inst, err := r.Pick()
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		ids = append(ids, inst.Instance.ID)
+	}
+	return ids
+}
+
+func TestResolverPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		regs    []registry.ServiceRegistration
+		opts    []ResolverOption
+		failed  []string
+		picks   int
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "round-robin in instance order",
+			regs:  []registry.ServiceRegistration{instance("b", true), instance("a", true)},
+			picks: 3,
+			want:  []string{"a", "b", "a"},
+		},
+		{
+			name:  "healthy only",
+			regs:  []registry.ServiceRegistration{instance("a", false), instance("b", true)},
+			opts:  []ResolverOption{WithHealthyInstances()},
+			picks: 2,
+			want:  []string{"b", "b"},
+		},
+		{
+			name:   "least recently failed skips failed",
+			regs:   []registry.ServiceRegistration{instance("a", true), instance("b", true)},
+			opts:   []ResolverOption{WithStrategy(LeastRecentlyFailed)},
+			failed: []string{"a"},
+			picks:  2,
+			want:   []string{"b", "b"},
+		},
+		{
+			name:   "least recently failed picks oldest failure",
+			regs:   []registry.ServiceRegistration{instance("a", true), instance("b", true)},
+			opts:   []ResolverOption{WithStrategy(LeastRecentlyFailed)},
+			failed: []string{"b", "a"},
+			picks:  1,
+			want:   []string{"b"},
+		},
+		{
+			name:    "no instances",
+			opts:    []ResolverOption{WithHealthyInstances()},
+			regs:    []registry.ServiceRegistration{instance("a", false)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]ResolverOption{WithRefreshInterval(0)}, tt.opts...)
+			r, err := newResolver(context.Background(), &fakeSource{regs: tt.regs}, "o/r", opts...)
+			if err != nil {
+				t.Fatalf("newResolver() error = %v", err)
+			}
+			defer r.Stop()
+
+			for _, id := range tt.failed {
+				r.ReportFailure(id)
+			}
+
+			if tt.wantErr {
+				if _, err := r.Pick(); !errors.Is(err, ErrNoInstances) {
+					t.Errorf("Pick() error = %v, want ErrNoInstances", err)
+				}
+				return
+			}
+
+			got := pickIDs(t, r, tt.picks)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("picks = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestResolverWatchUpsert(t *testing.T) {
+	src := &fakeSource{regs: []registry.ServiceRegistration{instance("b", true)}}
+	r, err := newResolver(context.Background(), src, "o/r", WithRefreshInterval(0))
+	if err != nil {
+		t.Fatalf("newResolver() error = %v", err)
+	}
+	defer r.Stop()
+
+	src.put(instance("a", true))
+	src.put(instance("b", false))
+
+	insts := r.Instances()
+	if len(insts) != 2 || insts[0].Instance.ID != "a" || insts[1].Instance.ID != "b" {
+		t.Fatalf("Instances() = %+v, want a, b", insts)
+	}
+	if insts[1].Healthy() {
+		t.Errorf("instance b should have been updated to not ready")
+	}
+}
+
+func TestResolverWatchDelete(t *testing.T) {
+	a, b := instance("a", true), instance("b", true)
+	src := &fakeSource{regs: []registry.ServiceRegistration{a, b}}
+	r, err := newResolver(context.Background(), src, "o/r", WithRefreshInterval(0))
+	if err != nil {
+		t.Fatalf("newResolver() error = %v", err)
+	}
+	defer r.Stop()
+
+	r.ReportFailure("a")
+	src.remove(a)
+
+	for _, id := range pickIDs(t, r, 4) {
+		if id != "b" {
+			t.Fatalf("Pick() = %s after it was deleted", id)
+		}
+	}
+	if _, ok := r.failures["a"]; ok {
+		t.Error("failure of the deleted instance kept")
+	}
+
+	src.remove(b)
+	if _, err := r.Pick(); !errors.Is(err, ErrNoInstances) {
+		t.Errorf("Pick() error = %v, want ErrNoInstances", err)
+	}
+}
@@ -0,0 +1,548 @@
+// roles.go: Roles shared by the dashboard, the CLI and NATS permissions
+//
+// Access used to be all or nothing: whoever held the node's credentials or
+// reached the dashboard could do everything. Roles split it up:
+//
+//	viewer    read KV and streams, watch events; view dashboards
+//	operator  viewer, plus fleet KV writes, fleet and process commands; dashboard actions
+//	admin     everything, including enrollment, access grants and roles
+//
+// A role maps to subject permissions (the NATS ACL of its users) and to
+// dashboard capabilities. Users other than admins receive replies only
+// below their own inbox prefix (UserInboxPrefix), so nobody reads the
+// credentials the hub sends someone else. Roles and who holds them live
+// in the access_roles KV bucket: role.{name} redefines a built-in role or
+// adds one, user.{name} binds a user to a role.
+//
+//	wellknown-check role set alice operator
+//	wellknown-check role set grafana viewer --key UABC...   # NKey user
+//	wellknown-check role list
+//
+// The same roles are enforced everywhere:
+//
+//	NATS       mgr.ServeRoles (hub, nkey mode) lets bound NKeys connect with their role's permissions
+//	dashboard  env.RoleMiddleware(roles, env.HeaderIdentity("X-Forwarded-User"), v.Handler()),
+//	           as mgr.ServeDashboard does for nats-node and wellknown-check dashboard
+//	access     wellknown-check access grant --scope <role> mints credentials for a role
+//	           and refuses to grant more than the granter's own role
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// RolesBucket holds role definitions and bindings
+const RolesBucket = "access_roles"
+
+// Built-in roles
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Dashboard capabilities of a role
+const (
+	CapView       = "view"       // See pages
+	CapOperate    = "operate"    // Trigger actions (process control, fleet commands, maintenance)
+	CapAdminister = "administer" // Admin pages: enrollment, auth, access grants, roles
+)
+
+// Key prefixes in RolesBucket
+const (
+	roleKeyPrefix    = "role."
+	bindingKeyPrefix = "user."
+)
+
+// ErrNoRole is returned for users without a role binding
+var ErrNoRole = errors.New("no role")
+
+// roleNamePattern is what role and user names may contain (KV key tokens)
+var roleNamePattern = regexp.MustCompile(`^[-_=a-zA-Z0-9]+$`)
+
+// Role is a set of subject permissions and dashboard capabilities
+type Role struct {
+	Name         string             `json:"name"`
+	Description  string             `json:"description,omitempty"`
+	Permissions  SubjectPermissions `json:"permissions"`
+	Capabilities []string           `json:"capabilities"`
+}
+
+// Can reports whether the role has a dashboard capability
+func (r Role) Can(capability string) bool {
+	return slices.Contains(r.Capabilities, capability)
+}
+
+// Covers reports whether r has every capability of other, so a holder of
+// r may hand other out
+func (r Role) Covers(other Role) bool {
+	for _, c := range other.Capabilities {
+		if !r.Can(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// RoleBinding gives a user a role
+type RoleBinding struct {
+	User      string    `json:"user"`
+	Role      string    `json:"role"`
+	PublicKey string    `json:"public_key,omitempty"` // NKey the user connects (nkey mode) and signs requests with
+	By        string    `json:"by"`
+	Updated   time.Time `json:"updated"`
+}
+
+// viewerPermissions use the JetStream API to read KV buckets and streams,
+// ask the admin API read-only questions and watch the event subjects.
+// Replies (and KV watches) arrive below the user's own inbox prefix, added
+// by Role.UserPermissions.
+var viewerPermissions = SubjectPermissions{
+	Publish: []string{
+		"$JS.API.INFO",
+		"$JS.API.STREAM.NAMES",
+		"$JS.API.STREAM.LIST",
+		"$JS.API.STREAM.INFO.>",
+		"$JS.API.STREAM.MSG.GET.>",
+		"$JS.API.DIRECT.GET.>",
+		"$JS.API.CONSUMER.CREATE.>",
+		"$JS.API.CONSUMER.DELETE.>",
+		"$JS.API.CONSUMER.INFO.>",
+		"$JS.API.CONSUMER.MSG.NEXT.>",
+		"$JS.ACK.>",
+		"$JS.FC.>",
+		AdminServicesSubject,
+		AdminBucketsSubject,
+		AdminStreamsSubject,
+	},
+	Subscribe: []string{
+		FleetSubject,
+		"pc.processes.updates",
+		auditSubjectPrefix + ">",
+		rotationSubjectPrefix + ">",
+		tombstoneSubjectPrefix + ">",
+		usageSubjectPrefix + ">",
+	},
+}
+
+// operatorBuckets are the KV buckets operators write: config overrides,
+// conflict records, node flags and tags, deployments (deploy) and pushed
+// projects (pcview)
+var operatorBuckets = []string{
+	ConfigOverridesBucket,
+	ConflictBucket,
+	MaintenanceBucket,
+	NodePowerBucket,
+	NodeTagsBucket,
+	"deployments",
+	"pc_projects",
+}
+
+// DefaultRoles returns the built-in roles. Operators never write the
+// roles and grants buckets, or they could make themselves admin.
+func DefaultRoles() []Role {
+	operator := append([]string{FleetSubject, "pc.processes.>", AdminSubject + ".>"}, viewerPermissions.Publish...)
+	for _, bucket := range operatorBuckets {
+		operator = append(operator, "$KV."+bucket+".>")
+	}
+	return []Role{
+		{
+			Name:         RoleViewer,
+			Description:  "Read KV and streams, watch events, view dashboards",
+			Permissions:  viewerPermissions,
+			Capabilities: []string{CapView},
+		},
+		{
+			Name:        RoleOperator,
+			Description: "Viewer plus fleet KV writes, fleet, process and admin commands",
+			Permissions: SubjectPermissions{
+				Publish:     uniqueSorted(operator),
+				Subscribe:   viewerPermissions.Subscribe,
+				PublishDeny: []string{"$KV." + RolesBucket + ".>", "$KV." + AccessBucket + ".>"},
+			},
+			Capabilities: []string{CapView, CapOperate},
+		},
+		{
+			Name:         RoleAdmin,
+			Description:  "Everything, including enrollment, access grants and roles",
+			Permissions:  SubjectPermissions{Publish: []string{">"}, Subscribe: []string{">"}},
+			Capabilities: []string{CapView, CapOperate, CapAdminister},
+		},
+	}
+}
+
+// UserPermissions returns the subject permissions of user holding r: the
+// role's, plus replies below UserInboxPrefix(user)
+func (r Role) UserPermissions(user string) SubjectPermissions {
+	return r.Permissions.forUser(user)
+}
+
+// defaultRole returns the built-in role name
+func defaultRole(name string) (Role, bool) {
+	for _, r := range DefaultRoles() {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Role{}, false
+}
+
+// RoleStore reads and writes roles and bindings in the access_roles bucket
+type RoleStore struct {
+	kv       jetstream.KeyValue
+	roles    *TypedKV[Role]
+	bindings *TypedKV[RoleBinding]
+}
+
+// OpenRoleStore creates (or opens) the access_roles bucket
+func OpenRoleStore(ctx context.Context, js jetstream.JetStream) (*RoleStore, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      RolesBucket,
+		Description: "Roles and role bindings for wellnown-env",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening roles bucket: %w", err)
+	}
+	return NewRoleStore(kv), nil
+}
+
+// NewRoleStore wraps an open access_roles bucket
+func NewRoleStore(kv jetstream.KeyValue) *RoleStore {
+	return &RoleStore{kv: kv, roles: NewTypedKV[Role](kv), bindings: NewTypedKV[RoleBinding](kv)}
+}
+
+// Role returns role name: its definition in the bucket, else the built-in
+func (s *RoleStore) Role(ctx context.Context, name string) (Role, error) {
+	if !roleNamePattern.MatchString(name) {
+		return Role{}, fmt.Errorf("invalid role name %q", name)
+	}
+	r, _, err := s.roles.Get(ctx, roleKeyPrefix+name)
+	if err == nil {
+		return r, nil
+	}
+	if !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return Role{}, err
+	}
+	if r, ok := defaultRole(name); ok {
+		return r, nil
+	}
+	return Role{}, fmt.Errorf("unknown role %q", name)
+}
+
+// Roles returns the built-in roles, as redefined in the bucket, and the
+// roles added there, by name
+func (s *RoleStore) Roles(ctx context.Context) ([]Role, error) {
+	stored, err := s.roles.List(ctx, roleKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Role)
+	for _, r := range DefaultRoles() {
+		byName[r.Name] = r
+	}
+	for _, r := range stored {
+		byName[r.Name] = r
+	}
+	roles := slices.Collect(maps.Values(byName))
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// PutRole defines or redefines a role
+func (s *RoleStore) PutRole(ctx context.Context, r Role) error {
+	if !roleNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("invalid role name %q", r.Name)
+	}
+	for _, c := range r.Capabilities {
+		if c != CapView && c != CapOperate && c != CapAdminister {
+			return fmt.Errorf("unknown capability %q", c)
+		}
+	}
+	if _, err := s.roles.Put(ctx, roleKeyPrefix+r.Name, r); err != nil {
+		return fmt.Errorf("storing role %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// Bind gives b.User the role b.Role, replacing an earlier binding
+func (s *RoleStore) Bind(ctx context.Context, b RoleBinding) error {
+	if !roleNamePattern.MatchString(b.User) {
+		return fmt.Errorf("invalid user name %q", b.User)
+	}
+	if _, err := s.Role(ctx, b.Role); err != nil {
+		return err
+	}
+	b.Updated = time.Now().UTC()
+	if _, err := s.bindings.Put(ctx, bindingKeyPrefix+b.User, b); err != nil {
+		return fmt.Errorf("binding %s: %w", b.User, err)
+	}
+	return nil
+}
+
+// Unbind removes the role of user
+func (s *RoleStore) Unbind(ctx context.Context, user string) error {
+	if _, err := s.Binding(ctx, user); err != nil {
+		return err
+	}
+	if err := s.kv.Delete(ctx, bindingKeyPrefix+user); err != nil {
+		return fmt.Errorf("unbinding %s: %w", user, err)
+	}
+	return nil
+}
+
+// Binding returns the binding of user (ErrNoRole if there is none)
+func (s *RoleStore) Binding(ctx context.Context, user string) (RoleBinding, error) {
+	if !roleNamePattern.MatchString(user) {
+		return RoleBinding{}, fmt.Errorf("%s: %w", user, ErrNoRole)
+	}
+	b, _, err := s.bindings.Get(ctx, bindingKeyPrefix+user)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return RoleBinding{}, fmt.Errorf("%s: %w", user, ErrNoRole)
+	}
+	return b, err
+}
+
+// Bindings returns all bindings, by user
+func (s *RoleStore) Bindings(ctx context.Context) ([]RoleBinding, error) {
+	list, err := s.bindings.List(ctx, bindingKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].User < list[j].User })
+	return list, nil
+}
+
+// KeyBinding returns the binding of the user with NKey pub (ErrNoRole if
+// there is none)
+func (s *RoleStore) KeyBinding(ctx context.Context, pub string) (RoleBinding, error) {
+	bindings, err := s.Bindings(ctx)
+	if err != nil {
+		return RoleBinding{}, err
+	}
+	for _, b := range bindings {
+		if b.PublicKey == pub {
+			return b, nil
+		}
+	}
+	return RoleBinding{}, fmt.Errorf("%s: %w", pub, ErrNoRole)
+}
+
+// UserRole returns the role of user (ErrNoRole if unbound)
+func (s *RoleStore) UserRole(ctx context.Context, user string) (Role, error) {
+	b, err := s.Binding(ctx, user)
+	if err != nil {
+		return Role{}, err
+	}
+	return s.Role(ctx, b.Role)
+}
+
+// Can reports whether user holds a role with capability; unbound users
+// can't do anything
+func (s *RoleStore) Can(ctx context.Context, user, capability string) (bool, error) {
+	r, err := s.UserRole(ctx, user)
+	if errors.Is(err, ErrNoRole) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return r.Can(capability), nil
+}
+
+// ACLs returns the permissions of every bound NKey, generated from the
+// roles (the ServiceNKeys of nkey mode)
+func (s *RoleStore) ACLs(ctx context.Context) (map[string]SubjectPermissions, error) {
+	bindings, err := s.Bindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	acls := make(map[string]SubjectPermissions)
+	for _, b := range bindings {
+		if b.PublicKey == "" {
+			continue
+		}
+		r, err := s.Role(ctx, b.Role)
+		if err != nil {
+			return nil, fmt.Errorf("role of %s: %w", b.User, err)
+		}
+		acls[b.PublicKey] = r.UserPermissions(b.User)
+	}
+	return acls, nil
+}
+
+// ServeRoles lets the NKeys bound in the access_roles bucket connect with
+// their role's permissions (hub, nkey mode) and follows changes to roles
+// and bindings
+func (m *Manager) ServeRoles() (stop func(), err error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("roles need NATS")
+	}
+	if cfg := m.natsNode.Auth(); cfg == nil || cfg.Mode != "nkey" {
+		return nil, fmt.Errorf("role NKeys need NATS_AUTH=nkey")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	store, err := OpenRoleStore(ctx, m.natsNode.ControlJetStream())
+	if err != nil {
+		return nil, err
+	}
+	s := &roleService{
+		store:   store,
+		apply:   m.natsNode.UpdateServiceNKeys,
+		applied: make(map[string]SubjectPermissions),
+		logger:  componentLogger(m.opts.Logger, "roles"),
+	}
+	if err := s.reconcile(ctx); err != nil {
+		return nil, err
+	}
+	s.watch, err = NewTypedKV[json.RawMessage](store.kv).Watch(context.Background(), "", func(string, *json.RawMessage, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.reconcile(ctx); err != nil {
+			s.logger.Warn("applying roles failed", "error", err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("watching roles: %w", err)
+	}
+	return func() { s.watch.Stop() }, nil
+}
+
+// roleService keeps the server's NKey users in line with the role bindings
+type roleService struct {
+	store   *RoleStore
+	apply   func(set map[string]SubjectPermissions, remove []string) error
+	logger  *slog.Logger
+	watch   *ServiceWatcher
+	mu      sync.Mutex
+	applied map[string]SubjectPermissions // NKeys this service added
+}
+
+// reconcile applies the current bindings; nothing is reloaded when they
+// did not change
+func (s *roleService) reconcile(ctx context.Context) error {
+	acls, err := s.store.ACLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var remove []string
+	for pub := range s.applied {
+		if _, ok := acls[pub]; !ok {
+			remove = append(remove, pub)
+		}
+	}
+	changed := len(remove) > 0
+	for pub, perms := range acls {
+		if old, ok := s.applied[pub]; !ok || !old.equal(perms) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := s.apply(acls, remove); err != nil {
+		return err
+	}
+	s.applied = acls
+	s.logger.Info("role NKeys applied", "users", len(acls), "removed", len(remove))
+	return nil
+}
+
+// AdminPages are the dashboard pages RoleMiddleware keeps to roles with
+// CapAdminister
+var AdminPages = []string{"/enrollment", "/auth", "/roles"}
+
+// HeaderIdentity identifies dashboard users by a header an authenticating
+// proxy sets (e.g. X-Forwarded-User from oauth2-proxy). Only use it behind
+// such a proxy.
+func HeaderIdentity(header string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// RoleMiddleware enforces roles on a dashboard handler (v.Handler()).
+// Pages and their updates need CapView, Via actions CapOperate, and
+// AdminPages and their actions CapAdminister. identify returns the user
+// of a request (empty = anonymous, refused).
+func RoleMiddleware(store *RoleStore, identify func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := identify(r)
+		if user == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		ok, err := store.Can(ctx, user, requiredCapability(r))
+		cancel()
+		if err != nil {
+			http.Error(w, "checking role: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !ok {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredCapability returns the capability a dashboard request needs.
+// Via serves actions as GET /_action/{id}, so they are told apart by path,
+// not method.
+func requiredCapability(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/_action/"):
+		if isAdminPage(actionPage(r)) {
+			return CapAdminister
+		}
+		return CapOperate
+	case r.URL.Path == "/_session/close":
+		return CapOperate
+	case isAdminPage(r.URL.Path):
+		return CapAdminister
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return CapView
+	}
+	return CapOperate
+}
+
+// isAdminPage reports whether path is one of AdminPages or below one
+func isAdminPage(path string) bool {
+	for _, page := range AdminPages {
+		if path == page || strings.HasPrefix(path, page+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// actionPage returns the route of the page an action request comes from.
+// Via sends the page's context ID ({route}_/{random}) in the via-ctx
+// signal and finds the action in that context only, so a request cannot
+// borrow the route of another page.
+func actionPage(r *http.Request) string {
+	var signals struct {
+		Ctx string `json:"via-ctx"`
+	}
+	_ = json.Unmarshal([]byte(r.URL.Query().Get("datastar")), &signals)
+	route, _, _ := strings.Cut(signals.Ctx, "_/")
+	return route
+}
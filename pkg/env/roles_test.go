@@ -0,0 +1,504 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+func TestRoleStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewRoleStore(newMemKV())
+
+	if _, err := store.UserRole(ctx, "alice"); !errors.Is(err, ErrNoRole) {
+		t.Errorf("UserRole(unbound) error = %v, want ErrNoRole", err)
+	}
+	if err := store.Bind(ctx, RoleBinding{User: "alice", Role: "root"}); err == nil {
+		t.Error("Bind() to an unknown role succeeded")
+	}
+	if err := store.Bind(ctx, RoleBinding{User: "a.b", Role: RoleViewer}); err == nil {
+		t.Error("Bind() of a user with subject characters succeeded")
+	}
+
+	// A custom role, and a redefined built-in
+	if err := store.PutRole(ctx, Role{Name: "oncall", Permissions: SubjectPermissions{Publish: []string{FleetSubject}}, Capabilities: []string{CapView, CapOperate}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutRole(ctx, Role{Name: RoleViewer, Capabilities: []string{CapView}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutRole(ctx, Role{Name: "bad", Capabilities: []string{"root"}}); err == nil {
+		t.Error("PutRole() with an unknown capability succeeded")
+	}
+	roles, err := store.Roles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	if want := []string{RoleAdmin, "oncall", RoleOperator, RoleViewer}; !slices.Equal(names, want) {
+		t.Errorf("Roles() = %v, want %v", names, want)
+	}
+
+	for _, b := range []RoleBinding{
+		{User: "alice", Role: "oncall", PublicKey: "UALICE"},
+		{User: "bob", Role: RoleViewer},
+		{User: "carol", Role: RoleAdmin, PublicKey: "UCAROL"},
+	} {
+		if err := store.Bind(ctx, b); err != nil {
+			t.Fatalf("Bind(%s) error = %v", b.User, err)
+		}
+	}
+	if ok, _ := store.Can(ctx, "alice", CapOperate); !ok {
+		t.Error("alice (oncall) can't operate")
+	}
+	if ok, _ := store.Can(ctx, "bob", CapOperate); ok {
+		t.Error("bob (viewer) can operate")
+	}
+	if ok, _ := store.Can(ctx, "dave", CapView); ok {
+		t.Error("unbound dave can view")
+	}
+
+	acls, err := store.ACLs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acls) != 2 || !slices.Equal(acls["UALICE"].Publish, []string{FleetSubject}) || !slices.Equal(acls["UCAROL"].Publish, []string{">"}) {
+		t.Errorf("ACLs() = %v, want alice's and carol's keys", acls)
+	}
+
+	if err := store.Unbind(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Unbind(ctx, "alice"); !errors.Is(err, ErrNoRole) {
+		t.Errorf("Unbind() twice error = %v, want ErrNoRole", err)
+	}
+}
+
+func TestDefaultRoles(t *testing.T) {
+	viewer, _ := defaultRole(RoleViewer)
+	operator, _ := defaultRole(RoleOperator)
+	admin, _ := defaultRole(RoleAdmin)
+
+	if slices.ContainsFunc(viewer.Permissions.Publish, func(s string) bool { return strings.HasPrefix(s, "$KV.") }) || viewer.Can(CapOperate) {
+		t.Errorf("viewer may write: %+v", viewer)
+	}
+	for _, subject := range viewer.Permissions.Publish {
+		if !slices.Contains(operator.Permissions.Publish, subject) {
+			t.Errorf("operator lacks %s", subject)
+		}
+	}
+	if !admin.Covers(operator) || !operator.Covers(viewer) || operator.Covers(admin) {
+		t.Error("roles don't nest viewer < operator < admin")
+	}
+
+	// Operators write the fleet buckets, never roles or grants
+	if !slices.Contains(operator.Permissions.Publish, "$KV."+NodeTagsBucket+".>") {
+		t.Errorf("operator may not write %s: %v", NodeTagsBucket, operator.Permissions.Publish)
+	}
+	for _, bucket := range []string{RolesBucket, AccessBucket} {
+		subject := "$KV." + bucket + ".>"
+		if !slices.Contains(operator.Permissions.PublishDeny, subject) {
+			t.Errorf("operator PublishDeny lacks %s", subject)
+		}
+		for _, allowed := range operator.Permissions.Publish {
+			if allowed == ">" || allowed == "$KV.>" || allowed == subject {
+				t.Errorf("operator may publish %s, which covers %s", allowed, subject)
+			}
+		}
+	}
+
+	// Only admins see other users' replies
+	for _, r := range []Role{viewer, operator} {
+		for _, subject := range r.Permissions.Subscribe {
+			if subject == ">" || strings.HasPrefix(subject, "_INBOX") {
+				t.Errorf("%s may subscribe to %s", r.Name, subject)
+			}
+		}
+		perms := r.UserPermissions("alice")
+		if !slices.Contains(perms.Subscribe, "_INBOX_alice.>") {
+			t.Errorf("%s permissions of alice = %v, want her inbox", r.Name, perms.Subscribe)
+		}
+		if slices.Contains(r.Permissions.Subscribe, "_INBOX_alice.>") {
+			t.Errorf("UserPermissions changed the %s role", r.Name)
+		}
+	}
+}
+
+// startNKeyNode starts a node in nkey mode, in a temporary directory
+// holding its own key
+func startNKeyNode(t *testing.T) *NATSNode {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	own, _ := nkeys.CreateUser()
+	seed, _ := own.Seed()
+	pub, _ := own.PublicKey()
+	writeTestFile(t, authNKeySeed, string(seed))
+	writeTestFile(t, authNKeyPub, pub)
+
+	n, err := StartNATSNode(NATSConfig{Name: "hub", Port: -1}, &AuthConfig{Mode: "nkey", NKeyPub: pub})
+	if err != nil {
+		t.Fatalf("StartNATSNode() error = %v", err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+// connectRoleUser binds a new NKey to role for user on n and connects
+// with it and the user's inbox prefix. Permission violations go to errs.
+func connectRoleUser(t *testing.T, n *NATSNode, user string, role Role, errs chan<- error) *nats.Conn {
+	t.Helper()
+	kp, _ := nkeys.CreateUser()
+	seed, _ := kp.Seed()
+	pub, _ := kp.PublicKey()
+	if err := n.AllowServiceNKey(pub, role.UserPermissions(user)); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := nkeyClientOptions(string(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append(opts, nats.CustomInboxPrefix(UserInboxPrefix(user)), nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+		errs <- err
+	}))
+	nc, err := nats.Connect(n.ClientURL(), opts...)
+	if err != nil {
+		t.Fatalf("connecting as %s: %v", user, err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func TestRolePermissionsEnforced(t *testing.T) {
+	n := startNKeyNode(t)
+	ctx := context.Background()
+	if _, err := n.JetStream().CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: NodeTagsBucket}); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenRoleStore(ctx, n.JetStream())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewer, _ := defaultRole(RoleViewer)
+	operator, _ := defaultRole(RoleOperator)
+	errs := make(chan error, 10)
+	bob := connectRoleUser(t, n, "bob", operator, errs)
+	carol := connectRoleUser(t, n, "carol", viewer, errs)
+
+	// bob writes the fleet buckets, with replies on his inbox
+	bobJS, err := jetstream.New(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobTags, err := bobJS.KeyValue(ctx, NodeTagsBucket)
+	if err != nil {
+		t.Fatalf("operator opening %s: %v", NodeTagsBucket, err)
+	}
+	if _, err := bobTags.Put(ctx, "edge-1", []byte("gpu")); err != nil {
+		t.Errorf("operator Put(%s) error = %v", NodeTagsBucket, err)
+	}
+
+	// ... but can't make himself admin
+	if err := bob.Publish("$KV."+RolesBucket+".user.bob", []byte(`{"user":"bob","role":"admin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "Permissions Violation") {
+			t.Errorf("operator writing %s: %v, want a permissions violation", RolesBucket, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("operator wrote %s without a permissions violation", RolesBucket)
+	}
+	if _, err := store.Binding(ctx, "bob"); !errors.Is(err, ErrNoRole) {
+		t.Errorf("Binding(bob) error = %v, want ErrNoRole", err)
+	}
+
+	// carol reads with replies on her inbox, but not bob's replies
+	carolJS, err := jetstream.New(carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolTags, err := carolJS.KeyValue(ctx, NodeTagsBucket)
+	if err != nil {
+		t.Fatalf("viewer opening %s: %v", NodeTagsBucket, err)
+	}
+	if entry, err := carolTags.Get(ctx, "edge-1"); err != nil || string(entry.Value()) != "gpu" {
+		t.Errorf("viewer Get() = %v, %v; want gpu", entry, err)
+	}
+	if _, err := carol.Subscribe(UserInboxPrefix("bob")+".>", func(*nats.Msg) {}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "Permissions Violation") {
+			t.Errorf("viewer subscribing to bob's inbox: %v, want a permissions violation", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("viewer subscribed to bob's inbox without a permissions violation")
+	}
+}
+
+func TestRoleService(t *testing.T) {
+	ctx := context.Background()
+	store := NewRoleStore(newMemKV())
+	var reloads int
+	var keys map[string]SubjectPermissions
+	s := &roleService{
+		store:   store,
+		applied: make(map[string]SubjectPermissions),
+		logger:  componentLogger(nil, "roles"),
+		apply: func(set map[string]SubjectPermissions, remove []string) error {
+			reloads++
+			keys = make(map[string]SubjectPermissions)
+			for k, v := range set {
+				keys[k] = v
+			}
+			for _, k := range remove {
+				delete(keys, k)
+			}
+			return nil
+		},
+	}
+
+	_ = store.Bind(ctx, RoleBinding{User: "alice", Role: RoleViewer, PublicKey: "UALICE"})
+	if err := s.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 1 || len(keys) != 1 {
+		t.Errorf("reloads = %d, keys = %v; want one reload for alice", reloads, keys)
+	}
+
+	// Promoting alice changes her permissions, unbinding drops her key
+	_ = store.Bind(ctx, RoleBinding{User: "alice", Role: RoleAdmin, PublicKey: "UALICE"})
+	_ = s.reconcile(ctx)
+	if reloads != 2 || !slices.Equal(keys["UALICE"].Publish, []string{">"}) {
+		t.Errorf("reloads = %d, keys = %v; want alice promoted", reloads, keys)
+	}
+	_ = store.Unbind(ctx, "alice")
+	_ = s.reconcile(ctx)
+	if reloads != 3 || len(keys) != 0 {
+		t.Errorf("reloads = %d, keys = %v; want alice's key dropped", reloads, keys)
+	}
+}
+
+func TestRoleMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store := NewRoleStore(newMemKV())
+	_ = store.Bind(ctx, RoleBinding{User: "viewer", Role: RoleViewer})
+	_ = store.Bind(ctx, RoleBinding{User: "operator", Role: RoleOperator})
+	_ = store.Bind(ctx, RoleBinding{User: "admin", Role: RoleAdmin})
+
+	h := RoleMiddleware(store, HeaderIdentity("X-Forwarded-User"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// Actions as Via sends them: GET with the page context in the signals
+	processesAction := url.Values{"datastar": {`{"via-ctx":"/processes_/x9y8"}`}}.Encode()
+	enrollmentAction := url.Values{"datastar": {`{"via-ctx":"/enrollment_/x9y8"}`}}.Encode()
+	tests := []struct {
+		user, method, path string
+		want               int
+	}{
+		{"", http.MethodGet, "/", http.StatusUnauthorized},
+		{"stranger", http.MethodGet, "/", http.StatusForbidden},
+		{"viewer", http.MethodGet, "/", http.StatusOK},
+		{"viewer", http.MethodGet, "/_sse", http.StatusOK},
+		{"viewer", http.MethodGet, "/_action/a1b2?" + processesAction, http.StatusForbidden},
+		{"viewer", http.MethodPost, "/_session/close", http.StatusForbidden},
+		{"operator", http.MethodGet, "/_action/a1b2?" + processesAction, http.StatusOK},
+		{"operator", http.MethodGet, "/enrollment", http.StatusForbidden},
+		{"operator", http.MethodGet, "/_action/c3d4?" + enrollmentAction, http.StatusForbidden},
+		{"admin", http.MethodGet, "/enrollment/pending", http.StatusOK},
+		{"admin", http.MethodGet, "/_action/c3d4?" + enrollmentAction, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.user != "" {
+			req.Header.Set("X-Forwarded-User", tt.user)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s as %q = %d, want %d", tt.method, tt.path, tt.user, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAccessGrantRoles(t *testing.T) {
+	ctx := context.Background()
+	s, _, _, _ := newTestAccessService()
+	s.roles = NewRoleStore(newMemKV())
+
+	// Before any binding, grants work as without roles
+	if _, _, err := s.grant(ctx, AccessRequest{User: "alice", Scope: ScopeAdmin}, RoleBinding{PublicKey: "UBOB"}, time.Now()); err != nil {
+		t.Fatalf("grant() without bindings error = %v", err)
+	}
+
+	bob := RoleBinding{User: "bob", Role: RoleOperator, PublicKey: "UBOB"}
+	carol := RoleBinding{User: "carol", Role: RoleViewer, PublicKey: "UCAROL"}
+	_ = s.roles.Bind(ctx, bob)
+	_ = s.roles.Bind(ctx, carol)
+	_ = s.roles.PutRole(ctx, Role{Name: "oncall", Permissions: SubjectPermissions{Publish: []string{FleetSubject}}, Capabilities: []string{CapView}})
+
+	g, _, err := s.grant(ctx, AccessRequest{User: "alice", Scope: "oncall"}, bob, time.Now())
+	if err != nil {
+		t.Fatalf("grant(oncall) error = %v", err)
+	}
+	if !slices.Equal(g.Permissions.Publish, []string{FleetSubject}) || !slices.Equal(g.Permissions.Subscribe, []string{"_INBOX_alice.>"}) {
+		t.Errorf("Permissions = %+v, want the oncall role's with alice's inbox", g.Permissions)
+	}
+	for _, tt := range []struct {
+		scope  string
+		caller RoleBinding
+	}{
+		{ScopeAdmin, bob},  // More than bob holds
+		{ScopeRead, carol}, // Viewers don't grant
+		{ScopeRead, RoleBinding{PublicKey: "UDAVE"}}, // Unbound key
+	} {
+		if _, _, err := s.grant(ctx, AccessRequest{User: "alice", Scope: tt.scope}, tt.caller, time.Now()); err == nil {
+			t.Errorf("grant(%s) by %s succeeded, want error", tt.scope, tt.caller.name())
+		}
+	}
+}
+
+// A viewer naming someone else in the request is still the viewer: the
+// hub takes the caller from the signature
+func TestAccessGrantSignedCaller(t *testing.T) {
+	n := startTestNode(t, NATSConfig{})
+	ctx := context.Background()
+	s, _, _, actions := newTestAccessService()
+	s.roles = NewRoleStore(newMemKV())
+	if err := s.start(ctx, n.Conn()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.stop()
+
+	keys := make(map[string]nkeys.KeyPair)
+	for user, role := range map[string]string{"admin": RoleAdmin, "carol": RoleViewer} {
+		kp, _ := nkeys.CreateUser()
+		pub, _ := kp.PublicKey()
+		keys[user] = kp
+		if err := s.roles.Bind(ctx, RoleBinding{User: user, Role: role, PublicKey: pub}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An old client's "by" is ignored, carol remains a viewer
+	data := []byte(`{"user":"mallory","scope":"admin","by":"admin"}`)
+	msg, err := signedRequest(ctx, n.Conn(), AccessGrantSubject, data, keys["carol"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply AccessReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Grant != nil || !strings.Contains(reply.Error, "carol (viewer) may not grant") {
+		t.Errorf("reply to carol = %+v, want refused as carol", reply)
+	}
+
+	// Unsigned requests are refused
+	msg, err = n.Conn().RequestWithContext(ctx, AccessGrantSubject, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply = AccessReply{}
+	_ = json.Unmarshal(msg.Data, &reply)
+	if reply.Grant != nil || reply.Error != ErrUnsigned.Error() {
+		t.Errorf("reply to an unsigned request = %+v, want %v", reply, ErrUnsigned)
+	}
+
+	// A viewer may not revoke either; the admin grants and revokes as admin
+	g, _, err := RequestAccess(ctx, n.Conn(), AccessRequest{User: "mallory", Scope: ScopeRead}, keys["admin"])
+	if err != nil {
+		t.Fatalf("RequestAccess() by admin error = %v", err)
+	}
+	if g.GrantedBy != "admin" {
+		t.Errorf("GrantedBy = %q, want admin", g.GrantedBy)
+	}
+	if err := RevokeAccess(ctx, n.Conn(), g.ID, keys["carol"]); err == nil {
+		t.Error("RevokeAccess() by a viewer succeeded")
+	}
+	if err := RevokeAccess(ctx, n.Conn(), g.ID, keys["admin"]); err != nil {
+		t.Errorf("RevokeAccess() by admin error = %v", err)
+	}
+	want := []string{"access.granted mallory by admin", "access.revoked mallory by admin"}
+	if !slices.Equal(*actions, want) {
+		t.Errorf("audit = %v, want %v", *actions, want)
+	}
+}
+
+// Actions of real Via pages: operators may run them on /processes, only
+// admins on /enrollment
+func TestRoleMiddlewareViaActions(t *testing.T) {
+	ctx := context.Background()
+	store := NewRoleStore(newMemKV())
+	_ = store.Bind(ctx, RoleBinding{User: "viewer", Role: RoleViewer})
+	_ = store.Bind(ctx, RoleBinding{User: "operator", Role: RoleOperator})
+	_ = store.Bind(ctx, RoleBinding{User: "admin", Role: RoleAdmin})
+
+	ran := map[string]int{}
+	v := via.New()
+	for _, route := range []string{"/processes", "/enrollment"} {
+		v.Page(route, func(c *via.Context) {
+			act := c.Action(func() { ran[route]++ })
+			c.View(func() h.H { return h.Button(h.Text("Go"), act.OnClick()) })
+		})
+	}
+	handler := RoleMiddleware(store, HeaderIdentity("X-Forwarded-User"), v.Handler())
+	get := func(user, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-Forwarded-User", user)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	ctxPattern := regexp.MustCompile(`via-ctx(?:'|&#39;):(?:'|&#39;)([^'&]+)`)
+	actionPattern := regexp.MustCompile(`/_action/([^'&]+)`)
+	action := func(route string) string {
+		body := get("admin", route).Body.String()
+		c, a := ctxPattern.FindStringSubmatch(body), actionPattern.FindStringSubmatch(body)
+		if c == nil || a == nil {
+			t.Fatalf("no context or action in %s:\n%s", route, body)
+		}
+		return "/_action/" + a[1] + "?" + url.Values{"datastar": {`{"via-ctx":"` + c[1] + `"}`}}.Encode()
+	}
+
+	tests := []struct {
+		user, route string
+		want        int
+	}{
+		{"viewer", "/processes", http.StatusForbidden},
+		{"operator", "/processes", http.StatusOK},
+		{"operator", "/enrollment", http.StatusForbidden},
+		{"admin", "/enrollment", http.StatusOK},
+	}
+	for _, tt := range tests {
+		before := ran[tt.route]
+		if rec := get(tt.user, action(tt.route)); rec.Code != tt.want {
+			t.Errorf("%s action as %s = %d, want %d", tt.route, tt.user, rec.Code, tt.want)
+		}
+		if ranOK := ran[tt.route] > before; ranOK != (tt.want == http.StatusOK) {
+			t.Errorf("%s action as %s ran = %v", tt.route, tt.user, ranOK)
+		}
+	}
+}
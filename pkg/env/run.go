@@ -0,0 +1,100 @@
+// run.go: Signal handling and graceful shutdown
+//
+// Run replaces the signal/shutdown code every main() repeats:
+//
+//	mgr, _ := env.New("APP", env.WithShutdownGrace(15*time.Second))
+//	cfg := env.MustParse[Config](mgr)
+//
+//	err := mgr.Run(context.Background(), func(ctx context.Context) error {
+//	    return serve(ctx, cfg) // Return when ctx is done
+//	})
+//
+// On SIGINT or SIGTERM the context passed to fn is canceled and fn gets
+// the grace period to return. The manager is then closed: watchers from
+// WatchService stop, the service deregisters and the NATS connections
+// drain before the node shuts down. A second signal exits at once.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownGrace is how long Run waits for in-flight work
+const DefaultShutdownGrace = 10 * time.Second
+
+// WithShutdownGrace sets how long Run waits for fn to return and the NATS
+// connections to drain after a shutdown signal (default:
+// DefaultShutdownGrace)
+func WithShutdownGrace(d time.Duration) Option {
+	return func(o *Options) {
+		o.ShutdownGrace = d
+	}
+}
+
+// Run calls fn until it returns or the process gets SIGINT or SIGTERM (or
+// ctx is done), then closes the manager. It returns fn's error; a context
+// error after a shutdown signal counts as a clean exit.
+func (m *Manager) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	grace := m.opts.ShutdownGrace
+	if grace <= 0 {
+		grace = DefaultShutdownGrace
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		stop() // A second signal terminates the process
+		m.logger.Info("shutting down", "grace", grace)
+		select {
+		case err = <-done:
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+		case <-time.After(grace):
+			m.logger.Warn("in-flight work did not finish within the shutdown grace", "grace", grace)
+		}
+	}
+
+	m.mu.Lock()
+	m.drain = grace
+	m.mu.Unlock()
+	if closeErr := m.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("closing manager: %w", closeErr))
+	}
+	return err
+}
+
+// trackWatcher records a watcher for Close to stop
+func (m *Manager) trackWatcher(w Watcher) Watcher {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchers = append(m.watchers, w)
+	return w
+}
+
+// stopWatchers stops the watchers from WatchService (m.mu not held: their
+// callbacks may call the manager)
+func (m *Manager) stopWatchers() {
+	m.mu.Lock()
+	watchers := m.watchers
+	m.watchers = nil
+	m.mu.Unlock()
+
+	for _, w := range watchers {
+		if err := w.Stop(); err != nil {
+			m.logger.Warn("stopping watcher failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestManagerRun(t *testing.T) {
+	errWork := errors.New("work failed")
+
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context) error
+		signal  bool
+		wantErr error
+	}{
+		{
+			name:    "work returns error",
+			fn:      func(ctx context.Context) error { return errWork },
+			wantErr: errWork,
+		},
+		{
+			name:   "signal cancels work",
+			signal: true,
+			fn: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		{
+			name:   "work outlives grace",
+			signal: true,
+			fn: func(ctx context.Context) error {
+				time.Sleep(time.Minute)
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New("APP", WithoutNATS(), WithShutdownGrace(50*time.Millisecond))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			closed := make(chan struct{})
+			m.Events().Subscribe(func(e Event) {
+				if e.Type == EventShuttingDown {
+					close(closed)
+				}
+			})
+
+			started := make(chan struct{})
+			fn := func(ctx context.Context) error {
+				close(started)
+				return tt.fn(ctx)
+			}
+			if tt.signal {
+				go func() {
+					<-started
+					syscall.Kill(os.Getpid(), syscall.SIGINT)
+				}()
+			}
+
+			err = m.Run(context.Background(), fn)
+			if !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			select {
+			case <-closed:
+			default:
+				t.Error("Run() returned without closing the manager")
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// runtimestats.go: Process stats sent with every heartbeat
+//
+// Each heartbeat carries a few numbers about the process, so the hub and
+// the dashboards show per-instance health without a metrics scraper:
+//
+//	"runtime": {"goroutines": 42, "rss": 39321600, "uptime": 11040,
+//	            "last_error": "job 7: timeout", "last_error_at": "..."}
+//
+// The last error is the latest SDK error log, or the latest error the
+// service reported itself:
+//
+//	if err := process(job); err != nil {
+//	    mgr.ReportError(fmt.Errorf("job %s: %w", job.ID, err))
+//	}
+//
+// Micro services passed to TrackMicroService add their endpoint stats
+// (microstats.go).
+package env
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"runtime"
+	rtmetrics "runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// maxLastError bounds the last error in the registration payload
+const maxLastError = 256
+
+// runtimeStats collects the stats of this process
+type runtimeStats struct {
+	started time.Time
+
+	mu        sync.Mutex
+	lastErr   string
+	lastErrAt time.Time
+	micro     []micro.Service // Endpoint stats sent along (see microstats.go)
+}
+
+// newRuntimeStats returns stats for a process started at started
+func newRuntimeStats(started time.Time) *runtimeStats {
+	return &runtimeStats{started: started}
+}
+
+// reportError records msg as the last error
+func (s *runtimeStats) reportError(msg string, at time.Time) {
+	if len(msg) > maxLastError {
+		msg = msg[:maxLastError-3] + "..."
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr, s.lastErrAt = msg, at.UTC()
+}
+
+// trackMicro adds the endpoint stats of svc to the stats
+func (s *runtimeStats) trackMicro(svc micro.Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.micro = append(s.micro, svc)
+}
+
+// collect returns the current stats
+func (s *runtimeStats) collect() *registry.RuntimeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &registry.RuntimeStats{
+		Goroutines:  runtime.NumGoroutine(),
+		RSS:         residentMemory(),
+		Uptime:      int64(time.Since(s.started).Seconds()),
+		LastError:   s.lastErr,
+		LastErrorAt: s.lastErrAt,
+		Endpoints:   s.microEndpoints(),
+	}
+}
+
+// microEndpoints returns the endpoint stats of the tracked micro services
+// still running (s.mu held)
+func (s *runtimeStats) microEndpoints() []registry.EndpointStats {
+	var out []registry.EndpointStats
+	for _, svc := range s.micro {
+		if svc.Stopped() {
+			continue
+		}
+		out = append(out, microEndpoints(svc.Stats())...)
+	}
+	return out
+}
+
+// ReportError records err as the instance's last error, sent with the
+// next heartbeat
+func (m *Manager) ReportError(err error) {
+	if err == nil || m.runtime == nil {
+		return
+	}
+	m.runtime.reportError(err.Error(), time.Now())
+}
+
+// residentMemory returns the resident set size from /proc on Linux, and
+// the memory the Go runtime holds from the OS elsewhere
+func residentMemory() uint64 {
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if f := strings.Fields(string(data)); len(f) > 1 {
+			if pages, err := strconv.ParseUint(f[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+
+	samples := []rtmetrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	rtmetrics.Read(samples)
+	if samples[0].Value.Kind() != rtmetrics.KindUint64 || samples[1].Value.Kind() != rtmetrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// recordErrors returns a logger that also records error-level logs as
+// the last error
+func recordErrors(l *slog.Logger, stats *runtimeStats) *slog.Logger {
+	return slog.New(errorRecorder{next: l.Handler(), stats: stats})
+}
+
+// errorRecorder passes records on and keeps the last error-level one
+type errorRecorder struct {
+	next  slog.Handler
+	stats *runtimeStats
+}
+
+// Enabled implements slog.Handler
+func (e errorRecorder) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelError || e.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (e errorRecorder) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		msg := r.Message
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "error" {
+				msg += ": " + a.Value.String()
+				return false
+			}
+			return true
+		})
+		at := r.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		e.stats.reportError(msg, at)
+	}
+	if !e.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return e.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (e errorRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return errorRecorder{next: e.next.WithAttrs(attrs), stats: e.stats}
+}
+
+// WithGroup implements slog.Handler
+func (e errorRecorder) WithGroup(name string) slog.Handler {
+	return errorRecorder{next: e.next.WithGroup(name), stats: e.stats}
+}
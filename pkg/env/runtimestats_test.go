@@ -0,0 +1,74 @@
+package env
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestRuntimeStats(t *testing.T) {
+	s := newRuntimeStats(time.Now().Add(-time.Hour))
+	got := s.collect()
+	if got.Goroutines < 1 || got.Uptime < 3600 || got.LastError != "" {
+		t.Errorf("collect() = %+v, want goroutines, an hour of uptime and no error", got)
+	}
+
+	s.reportError(strings.Repeat("x", 1000), time.Now())
+	if got := s.collect(); len(got.LastError) != maxLastError || got.LastErrorAt.IsZero() {
+		t.Errorf("LastError of %d bytes at %v, want %d bytes and a time", len(got.LastError), got.LastErrorAt, maxLastError)
+	}
+
+	m := &Manager{runtime: s}
+	m.ReportError(errors.New("job 7: timeout"))
+	m.ReportError(nil)
+	if got := s.collect().LastError; got != "job 7: timeout" {
+		t.Errorf("LastError = %q, want the reported error", got)
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+	var buf bytes.Buffer
+	s := newRuntimeStats(time.Now())
+	logger := recordErrors(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})), s)
+	logger = componentLogger(logger, "registrar")
+
+	logger.Warn("heartbeat failed", "error", "timeout")
+	if got := s.collect().LastError; got != "" {
+		t.Errorf("LastError after a warning = %q, want none", got)
+	}
+	logger.Error("storing registration failed", "key", "acme.api.1", "error", "nats: timeout")
+	if got := s.collect().LastError; got != "storing registration failed: nats: timeout" {
+		t.Errorf("LastError = %q, want the error log", got)
+	}
+	if !strings.Contains(buf.String(), "storing registration failed") {
+		t.Errorf("error log not passed on: %q", buf.String())
+	}
+}
+
+func TestHeartbeatRuntimeStats(t *testing.T) {
+	kv := newMemKV()
+	r := NewRegistrar(kv, 20*time.Millisecond)
+	calls := 0
+	r.SetRuntimeStats(func() *registry.RuntimeStats {
+		calls++
+		return &registry.RuntimeStats{Goroutines: calls}
+	})
+	if err := r.Register(t.Context(), "APP", &struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Deregister(t.Context())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if reg := r.Registration(); reg.Runtime != nil && reg.Runtime.Goroutines > 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("heartbeat did not refresh the runtime stats: %+v", r.Registration().Runtime)
+}
@@ -0,0 +1,238 @@
+// schema.go: Config documentation generated from the struct tags
+//
+// The fields Parse extracts (env key, type, default, required, secret,
+// help) are enough to document a service's config without writing it by
+// hand:
+//
+//	data, _ := mgr.ExportSchema(env.SchemaDotenv) // .env.example
+//	data, _ = mgr.ExportSchema(env.SchemaJSON)    // JSON Schema (2020-12)
+//	data, _ = mgr.ExportSchema(env.SchemaMarkdown) // Markdown table
+//
+// or "wellknown-check --export dotenv" in CI. Secrets never get a value
+// in .env.example; defaults are written as-is. The JSON Schema describes
+// the environment: one property per env var, typed from the Go field.
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// SchemaFormat is an ExportSchema output format
+type SchemaFormat string
+
+// Export formats
+const (
+	SchemaDotenv   SchemaFormat = "dotenv"     // .env.example
+	SchemaJSON     SchemaFormat = "jsonschema" // JSON Schema of the env vars
+	SchemaMarkdown SchemaFormat = "markdown"   // Markdown table
+)
+
+// SchemaFormats lists the export formats
+var SchemaFormats = []SchemaFormat{SchemaDotenv, SchemaJSON, SchemaMarkdown}
+
+// ExportSchema documents the parsed config in format. Call Parse first.
+func (m *Manager) ExportSchema(format SchemaFormat) ([]byte, error) {
+	m.mu.RLock()
+	fields := m.fields
+	m.mu.RUnlock()
+	if fields == nil {
+		return nil, fmt.Errorf("no config fields (call Parse first)")
+	}
+
+	var b bytes.Buffer
+	if err := WriteSchema(&b, m.prefix, fields, format); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteSchema writes fields in format, titled title (the prefix or service
+// name)
+func WriteSchema(w io.Writer, title string, fields []registry.FieldInfo, format SchemaFormat) error {
+	switch format {
+	case SchemaDotenv:
+		return writeDotenvExample(w, title, fields)
+	case SchemaJSON:
+		return writeJSONSchema(w, title, fields)
+	case SchemaMarkdown:
+		return writeMarkdownTable(w, title, fields)
+	default:
+		return fmt.Errorf("unknown schema format %q (use: dotenv, jsonschema, markdown)", format)
+	}
+}
+
+// writeDotenvExample writes a .env.example with a comment per variable
+func writeDotenvExample(w io.Writer, title string, fields []registry.FieldInfo) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s configuration\n", title)
+	b.WriteString("# Generated from the config struct; copy to .env and fill in.\n")
+	for _, f := range fields {
+		b.WriteString("\n# ")
+		if f.Help != "" {
+			b.WriteString(f.Help + " ")
+		}
+		fmt.Fprintf(&b, "(%s)\n", strings.Join(fieldNotes(f), ", "))
+
+		value := f.Default
+		if f.IsSecret {
+			value = ""
+		}
+		fmt.Fprintf(&b, "%s=%s\n", f.EnvKey, dotenvQuote(value))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fieldNotes returns the type and flags of f
+func fieldNotes(f registry.FieldInfo) []string {
+	notes := []string{f.Type}
+	if f.Required {
+		notes = append(notes, "required")
+	}
+	if f.IsSecret {
+		notes = append(notes, "secret: use a ref+ reference")
+	}
+	if f.Dependency != "" {
+		notes = append(notes, "service: "+f.Dependency)
+	}
+	return notes
+}
+
+// dotenvQuote double-quotes values LoadDotenv would otherwise change
+func dotenvQuote(v string) string {
+	if v == "" || !strings.ContainsAny(v, " \t#\"'\\\n") {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(v) + `"`
+}
+
+// jsonSchema is the subset of JSON Schema written by writeJSONSchema
+type jsonSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Default     any                    `json:"default,omitempty"`
+	Items       *jsonSchema            `json:"items,omitempty"`
+	WriteOnly   bool                   `json:"writeOnly,omitempty"`
+	GoType      string                 `json:"x-go-type,omitempty"`
+	Path        string                 `json:"x-field-path,omitempty"`
+	Service     string                 `json:"x-service,omitempty"`
+	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+}
+
+// writeJSONSchema writes a JSON Schema with one property per env var
+func writeJSONSchema(w io.Writer, title string, fields []registry.FieldInfo) error {
+	s := &jsonSchema{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		Title:      title + " configuration",
+		Type:       "object",
+		Properties: make(map[string]*jsonSchema, len(fields)),
+	}
+	for _, f := range fields {
+		prop := jsonSchemaType(f.Type)
+		prop.Description = f.Help
+		prop.WriteOnly = f.IsSecret
+		prop.GoType = f.Type
+		prop.Path = f.Path
+		prop.Service = f.Dependency
+		if f.Default != "" {
+			prop.Default = jsonDefault(prop, f.Default)
+		}
+		s.Properties[f.EnvKey] = prop
+		if f.Required {
+			s.Required = append(s.Required, f.EnvKey)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// jsonSchemaType maps a Go type name to a JSON Schema type
+func jsonSchemaType(goType string) *jsonSchema {
+	goType = strings.TrimPrefix(goType, "*")
+	if elem, ok := strings.CutPrefix(goType, "[]"); ok && elem != "byte" {
+		return &jsonSchema{Type: "array", Items: jsonSchemaType(elem)}
+	}
+	switch goType {
+	case "bool":
+		return &jsonSchema{Type: "boolean"}
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return &jsonSchema{Type: "integer"}
+	case "float32", "float64":
+		return &jsonSchema{Type: "number"}
+	default:
+		return &jsonSchema{Type: "string"} // Durations, URLs and the rest are strings in the env
+	}
+}
+
+// jsonDefault converts a conf default to the property's JSON type, keeping
+// the string if it does not convert
+func jsonDefault(prop *jsonSchema, def string) any {
+	switch prop.Type {
+	case "boolean":
+		if v, err := strconv.ParseBool(def); err == nil {
+			return v
+		}
+	case "integer":
+		if v, err := strconv.ParseInt(def, 10, 64); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.ParseFloat(def, 64); err == nil {
+			return v
+		}
+	case "array":
+		var out []any
+		for _, item := range strings.Split(def, ";") { // conf separates slice items with ;
+			out = append(out, jsonDefault(prop.Items, item))
+		}
+		return out
+	}
+	return def
+}
+
+// writeMarkdownTable writes one table row per env var
+func writeMarkdownTable(w io.Writer, title string, fields []registry.FieldInfo) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s configuration\n\n", title)
+	b.WriteString("| Variable | Type | Default | Required | Description |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+	for _, f := range fields {
+		def := ""
+		if f.Default != "" && !f.IsSecret {
+			def = "`" + f.Default + "`"
+		}
+		required := ""
+		if f.Required {
+			required = "yes"
+		}
+		desc := f.Help
+		if f.IsSecret {
+			desc = strings.TrimSpace(desc + " (secret)")
+		}
+		if f.Dependency != "" {
+			desc = strings.TrimSpace(desc + " (service: " + f.Dependency + ")")
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n",
+			f.EnvKey, markdownCell(f.Type), markdownCell(def), required, markdownCell(desc))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownCell escapes pipes so a value stays in its cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,123 @@
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type schemaTestConfig struct {
+	Port  int      `conf:"default:8080,help:Listen port"`
+	Name  string   `conf:"default:my app #1"`
+	Hosts []string `conf:"default:a;b"`
+	Debug bool
+	DB    struct {
+		Password string `conf:"required,mask"`
+	}
+	Billing string `conf:"service:acme/billing"`
+}
+
+// schemaTestOutput returns schemaTestConfig as .env.example, JSON Schema
+// and Markdown
+func schemaTestOutput() (dotenvOut, jsonOut, markdownOut []byte) {
+	fields := ExtractFields("APP", &schemaTestConfig{})
+	var dotenv, js, md bytes.Buffer
+	WriteSchema(&dotenv, "APP", fields, SchemaDotenv)
+	WriteSchema(&js, "APP", fields, SchemaJSON)
+	WriteSchema(&md, "APP", fields, SchemaMarkdown)
+	return dotenv.Bytes(), js.Bytes(), md.Bytes()
+}
+
+func TestSchemaDotenv(t *testing.T) {
+	dotenv, _, _ := schemaTestOutput()
+
+	// The example reads back as the defaults, with secrets left empty
+	got := map[string]string{}
+	for _, line := range strings.Split(string(dotenv), "\n") {
+		key, value, ok, err := parseDotenvLine(line)
+		if err != nil {
+			t.Fatalf("generated line %q does not parse: %v", line, err)
+		}
+		if ok {
+			got[key] = value
+		}
+	}
+	want := map[string]string{
+		"APP_PORT":        "8080",
+		"APP_NAME":        "my app #1",
+		"APP_HOSTS":       "a;b",
+		"APP_DEBUG":       "",
+		"APP_DB_PASSWORD": "",
+		"APP_BILLING":     "",
+	}
+	for key, value := range want {
+		if v, ok := got[key]; !ok || v != value {
+			t.Errorf("%s = %q (present %v), want %q", key, v, ok, value)
+		}
+	}
+	for _, s := range []string{"# Listen port (int)", "(string, required, secret: use a ref+ reference)", "service: acme/billing"} {
+		if !strings.Contains(string(dotenv), s) {
+			t.Errorf(".env.example missing %q:\n%s", s, dotenv)
+		}
+	}
+}
+
+func TestSchemaJSON(t *testing.T) {
+	_, js, _ := schemaTestOutput()
+
+	var s struct {
+		Type       string `json:"type"`
+		Required   []string
+		Properties map[string]struct {
+			Type        string `json:"type"`
+			Default     any    `json:"default"`
+			Description string `json:"description"`
+			WriteOnly   bool   `json:"writeOnly"`
+			Items       *struct {
+				Type string `json:"type"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(js, &s); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, js)
+	}
+	if s.Type != "object" || len(s.Required) != 1 || s.Required[0] != "APP_DB_PASSWORD" {
+		t.Errorf("schema type %q, required %v", s.Type, s.Required)
+	}
+
+	port := s.Properties["APP_PORT"]
+	if port.Type != "integer" || port.Default != float64(8080) || port.Description != "Listen port" {
+		t.Errorf("APP_PORT = %+v", port)
+	}
+	if p := s.Properties["APP_DEBUG"]; p.Type != "boolean" || p.Default != nil {
+		t.Errorf("APP_DEBUG = %+v", p)
+	}
+	hosts := s.Properties["APP_HOSTS"]
+	if hosts.Type != "array" || hosts.Items == nil || hosts.Items.Type != "string" {
+		t.Errorf("APP_HOSTS = %+v", hosts)
+	}
+	if d, ok := hosts.Default.([]any); !ok || len(d) != 2 || d[0] != "a" {
+		t.Errorf("APP_HOSTS default = %v, want [a b]", hosts.Default)
+	}
+	if !s.Properties["APP_DB_PASSWORD"].WriteOnly {
+		t.Error("secret not marked writeOnly")
+	}
+}
+
+func TestSchemaMarkdown(t *testing.T) {
+	_, _, md := schemaTestOutput()
+	for _, row := range []string{
+		"| `APP_PORT` | int | `8080` |  | Listen port |",
+		"| `APP_DB_PASSWORD` | string |  | yes | (secret) |",
+		"| `APP_BILLING` | string |  |  | (service: acme/billing) |",
+	} {
+		if !strings.Contains(string(md), row) {
+			t.Errorf("markdown missing row %q:\n%s", row, md)
+		}
+	}
+
+	if err := WriteSchema(&bytes.Buffer{}, "APP", nil, "yaml"); err == nil {
+		t.Error("WriteSchema() accepted an unknown format")
+	}
+}
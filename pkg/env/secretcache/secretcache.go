@@ -0,0 +1,203 @@
+// Package secretcache keeps resolved vals secrets on disk, encrypted with
+// an age key, so offline leaf nodes can start without reaching Vault.
+//
+//	id, _ := secretcache.LoadOrCreateIdentity("/var/lib/app/secrets.key")
+//	cache := secretcache.New("/var/lib/app/secrets.age", id, 24*time.Hour)
+//	mgr, _ := env.New("APP", env.WithSecretCache(cache))
+//
+// Parse then serves ref+ values from the cache while they are younger than
+// the max age and resolves (and re-caches) the rest. Once an entry is older
+// the secret backend must be reachable again: stale values are only used
+// when resolution fails under the fallback-cached failure policy (see
+// Previous), until the next Store prunes them.
+//
+// The whole file, refs included, is one age-encrypted JSON document written
+// atomically with mode 0600. Keep the identity file off the cache's disk
+// (or on a TPM-backed mount) if the device can be stolen.
+package secretcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+)
+
+// DefaultMaxAge is how long cached secrets are used without re-resolution
+const DefaultMaxAge = 24 * time.Hour
+
+// Entry is a cached secret
+type Entry struct {
+	Value    string    `json:"value"`
+	Resolved time.Time `json:"resolved"`
+}
+
+// Cache is an encrypted file of secrets by vals ref. It is safe for
+// concurrent use within one process.
+type Cache struct {
+	path     string
+	identity *age.X25519Identity
+	maxAge   time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+// New returns a cache in path encrypted to identity. Entries older than
+// maxAge (0 = DefaultMaxAge) are not served.
+func New(path string, identity *age.X25519Identity, maxAge time.Duration) *Cache {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	return &Cache{path: path, identity: identity, maxAge: maxAge, now: time.Now}
+}
+
+// LoadOrCreateIdentity reads the age identity in path, generating and
+// saving one (mode 0600) if the file does not exist
+func LoadOrCreateIdentity(path string) (*age.X25519Identity, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		id, err := age.ParseX25519Identity(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("parsing age identity %s: %w", path, err)
+		}
+		return id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading age identity: %w", err)
+	}
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("generating age identity: %w", err)
+	}
+	if err := auth.WriteFile(path, id.String()+"\n"); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// Lookup returns the values of refs cached less than the max age ago.
+// Refs missing from the result must be resolved.
+func (c *Cache) Lookup(refs []string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	fresh := make(map[string]string)
+	cutoff := c.now().Add(-c.maxAge)
+	for _, ref := range refs {
+		if e, ok := entries[ref]; ok && e.Resolved.After(cutoff) {
+			fresh[ref] = e.Value
+		}
+	}
+	return fresh, nil
+}
+
+// Previous returns the cached values of refs whatever their age. Only the
+// fallback-cached failure policy uses them, once the backend has failed.
+func (c *Cache) Previous(refs []string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, ref := range refs {
+		if e, ok := entries[ref]; ok {
+			values[ref] = e.Value
+		}
+	}
+	return values, nil
+}
+
+// Store caches freshly resolved values by ref. Other entries are kept
+// unless they are past the max age.
+func (c *Cache) Store(values map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		entries = make(map[string]Entry) // Unreadable (e.g. new key): start over
+	}
+	now := c.now()
+	for ref, e := range entries {
+		if !e.Resolved.After(now.Add(-c.maxAge)) {
+			delete(entries, ref)
+		}
+	}
+	for ref, v := range values {
+		entries[ref] = Entry{Value: v, Resolved: now}
+	}
+	return c.save(entries)
+}
+
+// Clear removes the cache file
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing secret cache: %w", err)
+	}
+	return nil
+}
+
+// load decrypts the cache file; a missing file is an empty cache
+func (c *Cache) load() (map[string]Entry, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]Entry), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secret cache: %w", err)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), c.identity)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret cache %s: %w", c.path, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret cache %s: %w", c.path, err)
+	}
+	entries := make(map[string]Entry)
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, fmt.Errorf("parsing secret cache %s: %w", c.path, err)
+	}
+	return entries, nil
+}
+
+// save encrypts entries to the identity's recipient and replaces the file
+func (c *Cache) save(entries map[string]Entry) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("encoding secret cache: %w", err)
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, c.identity.Recipient())
+	if err != nil {
+		return fmt.Errorf("encrypting secret cache: %w", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		return fmt.Errorf("encrypting secret cache: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("encrypting secret cache: %w", err)
+	}
+	return auth.WriteFile(c.path, buf.String())
+}
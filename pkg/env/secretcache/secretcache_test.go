@@ -0,0 +1,167 @@
+package secretcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, maxAge time.Duration) *Cache {
+	t.Helper()
+	dir := t.TempDir()
+	id, err := LoadOrCreateIdentity(filepath.Join(dir, "secrets.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateIdentity() error = %v", err)
+	}
+	return New(filepath.Join(dir, "secrets.age"), id, maxAge)
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	c := newTestCache(t, time.Hour)
+
+	got, err := c.Lookup([]string{"ref+vault://db#password"})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("Lookup() on missing file = %v, %v; want empty", got, err)
+	}
+
+	if err := c.Store(map[string]string{"ref+vault://db#password": "s3cret"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	got, err = c.Lookup([]string{"ref+vault://db#password", "ref+vault://other"})
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if len(got) != 1 || got["ref+vault://db#password"] != "s3cret" {
+		t.Errorf("Lookup() = %v, want only the stored secret", got)
+	}
+
+	// Neither refs nor values are readable on disk
+	raw, err := os.ReadFile(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "s3cret") || strings.Contains(string(raw), "vault") {
+		t.Error("cache file contains plaintext")
+	}
+	if info, _ := os.Stat(c.path); info.Mode().Perm() != 0o600 {
+		t.Errorf("cache file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	c := newTestCache(t, time.Hour)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	if err := c.Store(map[string]string{"ref+echo://old": "old"}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	if err := c.Store(map[string]string{"ref+echo://new": "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  []string
+	}{
+		{name: "both fresh", after: 0, want: []string{"ref+echo://new", "ref+echo://old"}},
+		{name: "old expired", after: 45 * time.Minute, want: []string{"ref+echo://new"}},
+		{name: "all expired", after: 2 * time.Hour, want: nil},
+	}
+	base := now
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = base.Add(tt.after)
+			got, err := c.Lookup([]string{"ref+echo://old", "ref+echo://new"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Lookup() = %v, want %v", got, tt.want)
+			}
+			for _, ref := range tt.want {
+				if _, ok := got[ref]; !ok {
+					t.Errorf("Lookup() missing %s", ref)
+				}
+			}
+		})
+	}
+
+	// Previous serves expired entries too
+	now = base.Add(2 * time.Hour)
+	prev, err := c.Previous([]string{"ref+echo://old", "ref+echo://missing"})
+	if err != nil || len(prev) != 1 || prev["ref+echo://old"] != "old" {
+		t.Errorf("Previous() = %v, %v; want the expired entry", prev, err)
+	}
+
+	// Storing drops expired entries
+	now = base.Add(45 * time.Minute)
+	if err := c.Store(map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries["ref+echo://old"]; ok || len(entries) != 1 {
+		t.Errorf("entries after Store() = %v, want only the fresh one", entries)
+	}
+}
+
+func TestCacheWrongKey(t *testing.T) {
+	c := newTestCache(t, 0)
+	if c.maxAge != DefaultMaxAge {
+		t.Errorf("maxAge = %v, want DefaultMaxAge", c.maxAge)
+	}
+	if err := c.Store(map[string]string{"ref+echo://a": "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := LoadOrCreateIdentity(filepath.Join(t.TempDir(), "other.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := New(c.path, other, 0)
+	if _, err := wrong.Lookup([]string{"ref+echo://a"}); err == nil {
+		t.Error("Lookup() with another key succeeded")
+	}
+
+	// A new key starts the cache over instead of failing
+	if err := wrong.Store(map[string]string{"ref+echo://b": "b"}); err != nil {
+		t.Fatalf("Store() with another key error = %v", err)
+	}
+	if got, err := wrong.Lookup([]string{"ref+echo://b"}); err != nil || got["ref+echo://b"] != "b" {
+		t.Errorf("Lookup() = %v, %v; want the new entry", got, err)
+	}
+
+	if err := wrong.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if err := wrong.Clear(); err != nil {
+		t.Errorf("Clear() on missing file error = %v", err)
+	}
+}
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.key")
+	first, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadOrCreateIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Error("identity changed between loads")
+	}
+
+	os.WriteFile(path, []byte("not a key\n"), 0o600)
+	if _, err := LoadOrCreateIdentity(path); err == nil {
+		t.Error("LoadOrCreateIdentity() accepted an invalid key")
+	}
+}
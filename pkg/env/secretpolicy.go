@@ -0,0 +1,130 @@
+// secretpolicy.go: What to do when some ref+ secrets fail to resolve
+//
+//	report, err := env.ResolveEnvSecretsWithPolicy(ctx, env.SecretBestEffort)
+//	for _, f := range report.Failed {
+//	    log.Printf("%s unavailable (%s): %v", f.Key, f.Ref, f.Err)
+//	}
+//	for _, t := range report.Timings { // Slowest first
+//	    log.Printf("%s from %s took %s", t.Key, t.Backend, t.Duration)
+//	}
+//
+// Policies:
+//
+//	fail-fast        Any failure fails resolution; no env var is changed (default)
+//	best-effort      Resolved refs are set, failed ones unset so config
+//	                 defaults and required-field checks apply
+//	fallback-cached  Failed refs keep their last resolved value, from the
+//	                 resolver's memory or the secret cache however old;
+//	                 refs without one fail as in fail-fast
+//
+// Managers take the policy from WithSecretFailurePolicy or
+// SECRET_FAILURE_POLICY and keep the last report (Manager.SecretReport).
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SecretFailurePolicy decides what happens to refs that fail to resolve
+type SecretFailurePolicy string
+
+// Secret failure policies
+const (
+	SecretFailFast       SecretFailurePolicy = "fail-fast"
+	SecretBestEffort     SecretFailurePolicy = "best-effort"
+	SecretFallbackCached SecretFailurePolicy = "fallback-cached"
+)
+
+// ParseSecretFailurePolicy parses a policy name ("" = SecretFailFast)
+func ParseSecretFailurePolicy(s string) (SecretFailurePolicy, error) {
+	switch p := SecretFailurePolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return SecretFailFast, nil
+	case SecretFailFast, SecretBestEffort, SecretFallbackCached:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown secret failure policy %q (use: %s, %s, %s)", s, SecretFailFast, SecretBestEffort, SecretFallbackCached)
+}
+
+// SecretFailure is a ref that could not be resolved
+type SecretFailure struct {
+	Key string // Env var
+	Ref string // Its ref+ value
+	Err error
+}
+
+// SecretTiming is how long the backend lookup of one env var took
+type SecretTiming struct {
+	Key      string        // Env var
+	Backend  string        // Ref scheme (vault in ref+vault://...)
+	Duration time.Duration // Including retries
+}
+
+// ResolutionReport is the outcome of resolving ref+ env vars, by env var
+// name (sorted)
+type ResolutionReport struct {
+	Policy   SecretFailurePolicy
+	Resolved []string        // Resolved from the backend
+	Cached   []string        // Served fresh from the secret cache
+	Fallback []string        // Failed, set to their previous value
+	Failed   []SecretFailure // Failed, left unresolved
+	Timings  []SecretTiming  // Backend lookups, slowest first
+}
+
+// OK reports whether every ref got a value
+func (r *ResolutionReport) OK() bool {
+	return len(r.Failed) == 0
+}
+
+// Err joins the failures (nil if none)
+func (r *ResolutionReport) Err() error {
+	errs := make([]error, 0, len(r.Failed))
+	for _, f := range r.Failed {
+		errs = append(errs, fmt.Errorf("resolving %s (%s): %w", f.Key, f.Ref, f.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// ResolveEnvSecretsWithPolicy resolves ref+ env vars like ResolveEnvSecrets,
+// handling failures by policy. The report is returned even on error.
+func ResolveEnvSecretsWithPolicy(ctx context.Context, policy SecretFailurePolicy) (*ResolutionReport, error) {
+	res, err := DefaultSecretResolver()
+	if err != nil {
+		return nil, err
+	}
+	return resolveEnvSecrets(ctx, res, nil, nil, policy)
+}
+
+// WithSecretFailurePolicy sets how Parse handles refs that fail to resolve
+func WithSecretFailurePolicy(policy SecretFailurePolicy) Option {
+	return func(o *Options) {
+		o.SecretFailurePolicy = policy
+	}
+}
+
+// SecretReport returns the report of the last secret resolution in Parse
+// (nil before Parse)
+func (m *Manager) SecretReport() *ResolutionReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.secretReport
+}
+
+// sortReport orders the report by env var name, timings slowest first
+func sortReport(r *ResolutionReport) {
+	sort.Strings(r.Resolved)
+	sort.Strings(r.Cached)
+	sort.Strings(r.Fallback)
+	sort.Slice(r.Failed, func(i, j int) bool { return r.Failed[i].Key < r.Failed[j].Key })
+	sort.Slice(r.Timings, func(i, j int) bool {
+		if r.Timings[i].Duration != r.Timings[j].Duration {
+			return r.Timings[i].Duration > r.Timings[j].Duration
+		}
+		return r.Timings[i].Key < r.Timings[j].Key
+	})
+}
@@ -0,0 +1,112 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/secretcache"
+)
+
+func TestParseSecretFailurePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SecretFailurePolicy
+		wantErr bool
+	}{
+		{in: "", want: SecretFailFast},
+		{in: "fail-fast", want: SecretFailFast},
+		{in: " Best-Effort ", want: SecretBestEffort},
+		{in: "fallback-cached", want: SecretFallbackCached},
+		{in: "ignore", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSecretFailurePolicy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSecretFailurePolicy(%q) = %q, %v; want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveEnvSecretsPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       SecretFailurePolicy
+		previous     bool // The bad ref resolved before
+		wantErr      bool
+		wantBad      string // APP_POLICY_BAD afterwards ("" = unset)
+		wantOK       string
+		wantFailed   int
+		wantFallback int
+	}{
+		{name: "fail fast", policy: SecretFailFast, wantErr: true, wantBad: "ref+echo://bad!", wantOK: "ref+echo://ok", wantFailed: 1},
+		{name: "best effort", policy: SecretBestEffort, wantOK: "ok", wantFailed: 1},
+		{name: "fallback", policy: SecretFallbackCached, previous: true, wantBad: "previous", wantOK: "ok", wantFallback: 1},
+		{name: "fallback without previous", policy: SecretFallbackCached, wantErr: true, wantBad: "ref+echo://bad!", wantOK: "ref+echo://ok", wantFailed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_POLICY_OK", "ref+echo://ok")
+			t.Setenv("APP_POLICY_BAD", "ref+echo://bad!")
+			r := newTestResolver(t, &fakeVals{})
+			if tt.previous {
+				r.cache["ref+echo://bad!"] = cachedSecret{value: "previous", resolved: time.Now().Add(-time.Hour)}
+			}
+
+			report, err := resolveEnvSecrets(context.Background(), r, nil, nil, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveEnvSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "APP_POLICY_BAD") {
+				t.Errorf("error = %v, want the failed key", err)
+			}
+			if got := os.Getenv("APP_POLICY_OK"); got != tt.wantOK {
+				t.Errorf("APP_POLICY_OK = %q, want %q", got, tt.wantOK)
+			}
+			if got := os.Getenv("APP_POLICY_BAD"); got != tt.wantBad {
+				t.Errorf("APP_POLICY_BAD = %q, want %q", got, tt.wantBad)
+			}
+			if len(report.Failed) != tt.wantFailed || len(report.Fallback) != tt.wantFallback {
+				t.Errorf("report = %+v, want %d failed, %d fallback", report, tt.wantFailed, tt.wantFallback)
+			}
+			if tt.wantFailed > 0 && (report.Failed[0].Key != "APP_POLICY_BAD" || report.Failed[0].Err == nil) {
+				t.Errorf("Failed = %+v, want APP_POLICY_BAD with its error", report.Failed)
+			}
+			if report.OK() != (tt.wantFailed == 0) {
+				t.Errorf("OK() = %v", report.OK())
+			}
+			if len(report.Timings) != 2 || report.Timings[0].Backend != "echo" {
+				t.Errorf("Timings = %+v, want both lookups from echo", report.Timings)
+			}
+		})
+	}
+}
+
+func TestResolveEnvSecretsFallbackToStaleCache(t *testing.T) {
+	dir := t.TempDir()
+	id, err := secretcache.LoadOrCreateIdentity(filepath.Join(dir, "secrets.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every entry is stale at once, so only the fallback may serve it
+	cache := secretcache.New(filepath.Join(dir, "secrets.age"), id, time.Nanosecond)
+	if err := cache.Store(map[string]string{"ref+echo://down!": "from-disk"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	t.Setenv("APP_POLICY_DOWN", "ref+echo://down!")
+	report, err := resolveEnvSecrets(context.Background(), newTestResolver(t, &fakeVals{}), nil, cache, SecretFallbackCached)
+	if err != nil {
+		t.Fatalf("resolveEnvSecrets() error = %v", err)
+	}
+	if got := os.Getenv("APP_POLICY_DOWN"); got != "from-disk" {
+		t.Errorf("APP_POLICY_DOWN = %q, want the stale cached value", got)
+	}
+	if len(report.Fallback) != 1 || len(report.Cached) != 0 {
+		t.Errorf("report = %+v, want one fallback", report)
+	}
+}
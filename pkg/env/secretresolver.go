@@ -0,0 +1,463 @@
+// secretresolver.go: Shared, parallel vals resolution with caching
+//
+// A SecretResolver keeps one vals runtime (and its provider clients) for
+// the process, resolves refs in parallel, caches values per ref for a TTL,
+// and bounds every lookup with a timeout and retries. Services with dozens
+// of Vault refs boot in one round trip instead of one per ref:
+//
+//	res, _ := env.NewSecretResolver(vals.Options{},
+//	    env.WithSecretParallelism(16),
+//	    env.WithSecretTTL(10*time.Minute),
+//	    env.WithSecretRetry(3, 250*time.Millisecond),
+//	)
+//	mgr, _ := env.New("APP", env.WithSecretResolver(res))
+//
+// ResolveEnvSecrets and Parse use DefaultSecretResolver, configured from
+// SECRET_PARALLELISM, SECRET_BACKEND_PARALLELISM, SECRET_TTL,
+// SECRET_TIMEOUT and SECRET_RETRIES.
+//
+// Each backend can have its own limit, so a slow Vault with many paths
+// doesn't hold every worker while other backends wait:
+//
+//	SECRET_PARALLELISM=16 SECRET_BACKEND_PARALLELISM=vault=4,awssecrets=8
+//
+// The time of each lookup is in the ResolutionReport (Timings).
+//
+// vals caches values inside a runtime for its lifetime, so the runtime is
+// replaced once it is older than the TTL. A timed-out lookup returns an
+// error at once; the provider call itself finishes in the background.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helmfile/vals"
+)
+
+// Secret resolution defaults
+const (
+	DefaultSecretParallelism = 8
+	DefaultSecretTTL         = 5 * time.Minute
+	DefaultSecretTimeout     = 10 * time.Second
+	DefaultSecretRetries     = 2
+	defaultSecretBackoff     = 200 * time.Millisecond
+)
+
+// SecretResolver resolves ref+ values through a shared vals runtime. It is
+// safe for concurrent use.
+type SecretResolver struct {
+	parallel int
+	ttl      time.Duration // <= 0: no caching, fresh runtime per call
+	timeout  time.Duration // Per lookup attempt (0 = none)
+	retries  int
+	backoff  time.Duration // Before the first retry, doubled after each
+
+	backends map[string]int // Lookups at once per ref scheme (none = parallel)
+
+	newGetter func() (func(ref string) (string, error), error)
+	now       func() time.Time
+	providers map[string]SecretProvider // By ref scheme, instead of vals
+
+	mu        sync.Mutex
+	get       func(ref string) (string, error)
+	getterAge time.Time
+	cache     map[string]cachedSecret
+}
+
+// cachedSecret is a resolved ref
+type cachedSecret struct {
+	value    string
+	resolved time.Time
+}
+
+// SecretProvider resolves refs of a scheme vals does not know
+// (ref+natskv://bucket/key, see NATSKVProvider)
+type SecretProvider interface {
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// lookupFunc resolves one ref
+type lookupFunc func(ctx context.Context, ref string) (string, error)
+
+// SecretResolverOption configures a SecretResolver
+type SecretResolverOption func(*SecretResolver)
+
+// WithSecretParallelism sets how many refs are resolved at once
+func WithSecretParallelism(n int) SecretResolverOption {
+	return func(r *SecretResolver) {
+		if n > 0 {
+			r.parallel = n
+		}
+	}
+}
+
+// WithSecretBackendParallelism sets how many refs of one scheme (vault in
+// ref+vault://...) are resolved at once, within WithSecretParallelism
+func WithSecretBackendParallelism(scheme string, n int) SecretResolverOption {
+	return func(r *SecretResolver) {
+		if n <= 0 {
+			return
+		}
+		if r.backends == nil {
+			r.backends = make(map[string]int)
+		}
+		r.backends[scheme] = n
+	}
+}
+
+// WithSecretTTL sets how long resolved values are reused (0 = never)
+func WithSecretTTL(ttl time.Duration) SecretResolverOption {
+	return func(r *SecretResolver) {
+		r.ttl = ttl
+	}
+}
+
+// WithSecretTimeout bounds each lookup attempt (0 = no timeout)
+func WithSecretTimeout(d time.Duration) SecretResolverOption {
+	return func(r *SecretResolver) {
+		r.timeout = d
+	}
+}
+
+// WithSecretRetry retries failed lookups up to retries times, waiting
+// backoff before the first retry and doubling it after each
+func WithSecretRetry(retries int, backoff time.Duration) SecretResolverOption {
+	return func(r *SecretResolver) {
+		r.retries = max(retries, 0)
+		r.backoff = backoff
+	}
+}
+
+// WithSecretProvider resolves ref+<scheme>:// refs with p instead of vals
+func WithSecretProvider(scheme string, p SecretProvider) SecretResolverOption {
+	return func(r *SecretResolver) {
+		r.providers[scheme] = p
+	}
+}
+
+// NewSecretResolver returns a resolver using vals with opts
+func NewSecretResolver(opts vals.Options, options ...SecretResolverOption) (*SecretResolver, error) {
+	r := &SecretResolver{
+		parallel:  DefaultSecretParallelism,
+		ttl:       DefaultSecretTTL,
+		timeout:   DefaultSecretTimeout,
+		retries:   DefaultSecretRetries,
+		backoff:   defaultSecretBackoff,
+		now:       time.Now,
+		cache:     make(map[string]cachedSecret),
+		providers: make(map[string]SecretProvider),
+		newGetter: func() (func(string) (string, error), error) {
+			runtime, err := vals.New(opts)
+			if err != nil {
+				return nil, fmt.Errorf("creating vals runtime: %w", err)
+			}
+			return runtime.Get, nil
+		},
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+
+	// Fail fast on bad options rather than on first use
+	get, err := r.newGetter()
+	if err != nil {
+		return nil, err
+	}
+	r.get, r.getterAge = get, r.now()
+	return r, nil
+}
+
+var (
+	defaultResolverOnce sync.Once
+	defaultResolver     *SecretResolver
+	defaultResolverErr  error
+)
+
+// DefaultSecretResolver returns the process-wide resolver, configured from
+// SECRET_PARALLELISM, SECRET_BACKEND_PARALLELISM, SECRET_TTL,
+// SECRET_TIMEOUT and SECRET_RETRIES
+func DefaultSecretResolver() (*SecretResolver, error) {
+	defaultResolverOnce.Do(func() {
+		var opts []SecretResolverOption
+		opts, defaultResolverErr = secretResolverOptionsFromEnv()
+		if defaultResolverErr == nil {
+			defaultResolver, defaultResolverErr = NewSecretResolver(vals.Options{}, opts...)
+		}
+	})
+	return defaultResolver, defaultResolverErr
+}
+
+// secretResolverOptionsFromEnv reads the SECRET_* resolver settings
+func secretResolverOptionsFromEnv() ([]SecretResolverOption, error) {
+	var opts []SecretResolverOption
+	if v := os.Getenv("SECRET_PARALLELISM"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("parsing SECRET_PARALLELISM: %q is not a positive number", v)
+		}
+		opts = append(opts, WithSecretParallelism(n))
+	}
+	for _, pair := range GetEnvList("SECRET_BACKEND_PARALLELISM") {
+		scheme, v, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(v)
+		if !ok || scheme == "" || err != nil || n < 1 {
+			return nil, fmt.Errorf("parsing SECRET_BACKEND_PARALLELISM: %q is not scheme=n", pair)
+		}
+		opts = append(opts, WithSecretBackendParallelism(scheme, n))
+	}
+	for _, d := range []struct {
+		key string
+		opt func(time.Duration) SecretResolverOption
+	}{
+		{"SECRET_TTL", WithSecretTTL},
+		{"SECRET_TIMEOUT", WithSecretTimeout},
+	} {
+		if v := os.Getenv(d.key); v != "" {
+			dur, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", d.key, err)
+			}
+			opts = append(opts, d.opt(dur))
+		}
+	}
+	if v := os.Getenv("SECRET_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("parsing SECRET_RETRIES: %q is not a number", v)
+		}
+		opts = append(opts, WithSecretRetry(n, defaultSecretBackoff))
+	}
+	return opts, nil
+}
+
+// WithSecretResolver resolves ref+ env vars in Parse with r instead of
+// DefaultSecretResolver
+func WithSecretResolver(r *SecretResolver) Option {
+	return func(o *Options) {
+		o.SecretResolver = r
+	}
+}
+
+// Resolve returns the values of refs by ref. Refs resolved within the TTL
+// are served from memory; the rest are looked up in parallel. Failed refs
+// are missing from the result and joined in the error.
+func (r *SecretResolver) Resolve(ctx context.Context, refs []string) (map[string]string, error) {
+	out, failed, _, err := r.resolve(ctx, refs, nil)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, 0, len(failed))
+	for ref, err := range failed {
+		errs = append(errs, fmt.Errorf("resolving %s: %w", ref, err))
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return out, errors.Join(errs...)
+}
+
+// resolve is Resolve with the error of each failed ref and the time each
+// backend lookup took. Providers in extra take precedence over the
+// resolver's own. The error is set only if no lookup could be made.
+func (r *SecretResolver) resolve(ctx context.Context, refs []string, extra map[string]SecretProvider) (map[string]string, map[string]error, map[string]time.Duration, error) {
+	out := make(map[string]string, len(refs))
+	failed := make(map[string]error)
+	took := make(map[string]time.Duration)
+	seen := make(map[string]bool, len(refs))
+	var todo []string
+
+	r.mu.Lock()
+	now := r.now()
+	for _, ref := range refs {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		if e, ok := r.cache[ref]; ok && r.ttl > 0 && now.Sub(e.resolved) < r.ttl {
+			out[ref] = e.value
+			metrics.secretsCached.Add(1)
+			continue
+		}
+		todo = append(todo, ref)
+	}
+	if len(todo) == 0 {
+		r.mu.Unlock()
+		return out, failed, took, nil
+	}
+	get, err := r.getter(now)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lookupFor := func(ref string) lookupFunc {
+		scheme := refScheme(ref)
+		if p, ok := extra[scheme]; ok {
+			return p.Get
+		}
+		if p, ok := r.providers[scheme]; ok {
+			return p.Get
+		}
+		return func(_ context.Context, ref string) (string, error) { return get(ref) }
+	}
+
+	// A backend waits for its own slot before taking a shared one, so a
+	// slow backend at its limit leaves the other workers to the rest
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		sem     = make(chan struct{}, r.parallel)
+		backend = make(map[string]chan struct{})
+		slowest = make(map[string]time.Duration) // Per scheme, for the startup report
+	)
+	for scheme, n := range r.backends {
+		backend[scheme] = make(chan struct{}, n)
+	}
+	for _, ref := range todo {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheme := refScheme(ref)
+			if slots, ok := backend[scheme]; ok {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			value, err := r.lookup(ctx, lookupFor(ref), ref)
+			d := time.Since(start)
+			mu.Lock()
+			defer mu.Unlock()
+			took[ref] = d
+			if d > slowest[scheme] {
+				slowest[scheme] = d
+			}
+			if err != nil {
+				failed[ref] = err
+				return
+			}
+			out[ref] = value
+		}()
+	}
+	wg.Wait()
+
+	startup := startupTimerFrom(ctx)
+	for scheme, took := range slowest {
+		startup.record("parse.secrets."+scheme, took)
+	}
+	metrics.secretsResolved.Add(uint64(len(todo) - len(failed)))
+	metrics.secretsFailed.Add(uint64(len(failed)))
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		resolved := r.now()
+		for _, ref := range todo {
+			if value, ok := out[ref]; ok {
+				r.cache[ref] = cachedSecret{value: value, resolved: resolved}
+			}
+		}
+		r.mu.Unlock()
+	}
+	return out, failed, took, nil
+}
+
+// previous returns the last value resolved for ref however old, for the
+// fallback-cached failure policy (none when caching is off)
+func (r *SecretResolver) previous(ref string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.cache[ref]
+	return e.value, ok
+}
+
+// getter returns the vals lookup to use at now, replacing the runtime when
+// its internal cache may hold values past the TTL. Callers hold r.mu.
+func (r *SecretResolver) getter(now time.Time) (func(string) (string, error), error) {
+	if r.get != nil && r.ttl > 0 && now.Sub(r.getterAge) < r.ttl {
+		return r.get, nil
+	}
+	get, err := r.newGetter()
+	if err != nil {
+		return nil, err
+	}
+	r.get, r.getterAge = get, now
+	return get, nil
+}
+
+// lookup resolves ref with the timeout and retry policy
+func (r *SecretResolver) lookup(ctx context.Context, get lookupFunc, ref string) (string, error) {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		value, err := r.attempt(ctx, get, ref)
+		if err == nil {
+			return value, nil
+		}
+		if attempt >= r.retries || ctx.Err() != nil {
+			return "", err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return "", err
+		}
+		backoff *= 2
+	}
+}
+
+// attempt runs one lookup, giving up after the timeout
+func (r *SecretResolver) attempt(ctx context.Context, get lookupFunc, ref string) (string, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1) // Buffered: a late lookup must not block
+	go func() {
+		value, err := get(ctx, ref)
+		done <- result{value, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Flush drops cached values and the vals runtime, e.g. after secrets
+// were rotated
+func (r *SecretResolver) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]cachedSecret)
+	r.get = nil
+}
+
+// refScheme returns the scheme of a ref (vault in ref+vault://...)
+func refScheme(ref string) string {
+	rest, ok := strings.CutPrefix(ref, refPrefix)
+	if !ok {
+		return ""
+	}
+	scheme, _, ok := strings.Cut(rest, "://")
+	if !ok {
+		return ""
+	}
+	return scheme
+}
@@ -0,0 +1,284 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/helmfile/vals"
+)
+
+// fakeVals counts lookups and runtimes; refs ending in "!" fail
+type fakeVals struct {
+	calls    atomic.Int32
+	runtimes atomic.Int32
+	delay    time.Duration
+	failures atomic.Int32 // Lookups to fail before succeeding
+
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (f *fakeVals) newGetter() (func(string) (string, error), error) {
+	f.runtimes.Add(1)
+	return func(ref string) (string, error) {
+		f.calls.Add(1)
+		f.mu.Lock()
+		f.active++
+		f.maxSeen = max(f.maxSeen, f.active)
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			f.active--
+			f.mu.Unlock()
+		}()
+
+		time.Sleep(f.delay)
+		if strings.HasSuffix(ref, "!") {
+			return "", errors.New("backend says no")
+		}
+		if f.failures.Add(-1) >= 0 {
+			return "", errors.New("transient")
+		}
+		return strings.TrimPrefix(ref, "ref+echo://"), nil
+	}, nil
+}
+
+// newTestResolver returns a resolver backed by f
+func newTestResolver(t *testing.T, f *fakeVals, opts ...SecretResolverOption) *SecretResolver {
+	t.Helper()
+	opts = append([]SecretResolverOption{WithSecretRetry(0, 0)}, opts...)
+	r, err := NewSecretResolver(vals.Options{}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.newGetter = f.newGetter
+	r.get = nil
+	return r
+}
+
+func TestSecretResolverParallel(t *testing.T) {
+	f := &fakeVals{delay: 20 * time.Millisecond}
+	r := newTestResolver(t, f, WithSecretParallelism(4))
+
+	var refs []string
+	for i := range 20 {
+		refs = append(refs, fmt.Sprintf("ref+echo://s%d", i))
+	}
+	refs = append(refs, refs[0]) // Duplicates are resolved once
+
+	start := time.Now()
+	got, err := r.Resolve(context.Background(), refs)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(got) != 20 || got["ref+echo://s7"] != "s7" {
+		t.Errorf("Resolve() = %v, want 20 values", got)
+	}
+	if n := f.calls.Load(); n != 20 {
+		t.Errorf("lookups = %d, want 20", n)
+	}
+	if f.maxSeen > 4 || f.maxSeen < 2 {
+		t.Errorf("max concurrent lookups = %d, want 2..4", f.maxSeen)
+	}
+	if elapsed := time.Since(start); elapsed > 15*f.delay {
+		t.Errorf("Resolve() took %v, not parallel", elapsed)
+	}
+}
+
+func TestSecretResolverTTL(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		after        time.Duration
+		wantCalls    int32
+		wantRuntimes int32
+	}{
+		{name: "cached", ttl: time.Minute, after: 30 * time.Second, wantCalls: 1, wantRuntimes: 1},
+		{name: "expired", ttl: time.Minute, after: 2 * time.Minute, wantCalls: 2, wantRuntimes: 2},
+		{name: "no caching", ttl: 0, after: 0, wantCalls: 2, wantRuntimes: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeVals{}
+			r := newTestResolver(t, f, WithSecretTTL(tt.ttl))
+			now := time.Now()
+			r.now = func() time.Time { return now }
+
+			for range 2 {
+				got, err := r.Resolve(context.Background(), []string{"ref+echo://db"})
+				if err != nil || got["ref+echo://db"] != "db" {
+					t.Fatalf("Resolve() = %v, %v", got, err)
+				}
+				now = now.Add(tt.after)
+			}
+			if n := f.calls.Load(); n != tt.wantCalls {
+				t.Errorf("lookups = %d, want %d", n, tt.wantCalls)
+			}
+			// A replaced runtime drops vals' own cache too
+			if n := f.runtimes.Load(); n != tt.wantRuntimes {
+				t.Errorf("runtimes = %d, want %d", n, tt.wantRuntimes)
+			}
+		})
+	}
+}
+
+func TestSecretResolverFlush(t *testing.T) {
+	f := &fakeVals{}
+	r := newTestResolver(t, f)
+	r.Resolve(context.Background(), []string{"ref+echo://a"})
+	r.Flush()
+	r.Resolve(context.Background(), []string{"ref+echo://a"})
+	if n := f.calls.Load(); n != 2 {
+		t.Errorf("lookups after Flush = %d, want 2", n)
+	}
+}
+
+func TestSecretResolverRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  int
+		failures int32
+		wantErr  bool
+	}{
+		{name: "succeeds after retries", retries: 2, failures: 2},
+		{name: "out of retries", retries: 1, failures: 2, wantErr: true},
+		{name: "no retries", retries: 0, failures: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeVals{}
+			f.failures.Store(tt.failures)
+			r := newTestResolver(t, f, WithSecretRetry(tt.retries, time.Millisecond))
+
+			_, err := r.Resolve(context.Background(), []string{"ref+echo://x"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecretResolverTimeout(t *testing.T) {
+	f := &fakeVals{delay: time.Second}
+	r := newTestResolver(t, f, WithSecretTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := r.Resolve(context.Background(), []string{"ref+echo://slow"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Resolve() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Resolve() took %v, timeout not applied", elapsed)
+	}
+}
+
+func TestSecretResolverPartialFailure(t *testing.T) {
+	f := &fakeVals{}
+	r := newTestResolver(t, f)
+
+	got, err := r.Resolve(context.Background(), []string{"ref+echo://ok", "ref+echo://bad!"})
+	if err == nil || !strings.Contains(err.Error(), "ref+echo://bad!") {
+		t.Errorf("Resolve() error = %v, want the failed ref", err)
+	}
+	if got["ref+echo://ok"] != "ok" {
+		t.Errorf("Resolve() = %v, want the good ref resolved", got)
+	}
+	if _, ok := r.cache["ref+echo://bad!"]; ok {
+		t.Error("failed ref was cached")
+	}
+}
+
+func TestSecretResolverOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "all set", env: map[string]string{"SECRET_PARALLELISM": "16", "SECRET_BACKEND_PARALLELISM": "vault=4, awssecrets=2", "SECRET_TTL": "10m", "SECRET_TIMEOUT": "5s", "SECRET_RETRIES": "0"}},
+		{name: "bad parallelism", env: map[string]string{"SECRET_PARALLELISM": "0"}, wantErr: true},
+		{name: "bad ttl", env: map[string]string{"SECRET_TTL": "soon"}, wantErr: true},
+		{name: "bad retries", env: map[string]string{"SECRET_RETRIES": "-1"}, wantErr: true},
+		{name: "bad backend parallelism", env: map[string]string{"SECRET_BACKEND_PARALLELISM": "vault"}, wantErr: true},
+		{name: "zero backend parallelism", env: map[string]string{"SECRET_BACKEND_PARALLELISM": "vault=0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"SECRET_PARALLELISM", "SECRET_BACKEND_PARALLELISM", "SECRET_TTL", "SECRET_TIMEOUT", "SECRET_RETRIES"} {
+				t.Setenv(key, tt.env[key])
+			}
+			opts, err := secretResolverOptionsFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("secretResolverOptionsFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name != "all set" {
+				return
+			}
+			r := &SecretResolver{}
+			for _, opt := range opts {
+				opt(r)
+			}
+			if r.parallel != 16 || r.backends["vault"] != 4 || r.backends["awssecrets"] != 2 || r.ttl != 10*time.Minute || r.timeout != 5*time.Second || r.retries != 0 {
+				t.Errorf("options = %+v", r)
+			}
+		})
+	}
+}
+
+// countingProvider tracks how many lookups run at once
+type countingProvider struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (p *countingProvider) Get(ctx context.Context, ref string) (string, error) {
+	p.mu.Lock()
+	p.active++
+	p.maxSeen = max(p.maxSeen, p.active)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.active--
+		p.mu.Unlock()
+	}()
+	time.Sleep(p.delay)
+	return "v", nil
+}
+
+func TestSecretResolverBackendParallelism(t *testing.T) {
+	slow := &countingProvider{delay: 30 * time.Millisecond}
+	f := &fakeVals{delay: 5 * time.Millisecond}
+	r := newTestResolver(t, f,
+		WithSecretParallelism(4),
+		WithSecretBackendParallelism("slow", 1),
+		WithSecretProvider("slow", slow),
+	)
+
+	var refs []string
+	for i := range 4 {
+		refs = append(refs, fmt.Sprintf("ref+slow://s%d", i), fmt.Sprintf("ref+echo://e%d", i))
+	}
+	_, failed, took, err := r.resolve(context.Background(), refs, nil)
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("resolve() failed = %v, error = %v", failed, err)
+	}
+	if slow.maxSeen != 1 {
+		t.Errorf("concurrent slow lookups = %d, want 1", slow.maxSeen)
+	}
+	if f.maxSeen < 2 {
+		t.Errorf("concurrent echo lookups = %d, want the free workers", f.maxSeen)
+	}
+	if len(took) != len(refs) || took["ref+slow://s0"] < slow.delay {
+		t.Errorf("took = %v, want a time per ref", took)
+	}
+}
@@ -0,0 +1,112 @@
+// secretsync.go: Secret bundles pushed from the hub (see package secretsync)
+//
+// Leaves that cannot reach Vault receive their secrets from the hub,
+// sealed to their own curve key. Parse fetches the service's bundle and
+// materializes it before resolving ref+ secrets, then applies updates as
+// the hub publishes them:
+//
+//	SECRET_SYNC_SEED_FILE=/var/lib/billing/sync.seed  # Created if missing
+//	SECRET_SYNC_SENDER=XAB...                          # The hub's public curve key
+//	SECRET_SYNC_SERVICE=billing                        # Default: lowercase prefix
+//	SECRET_SYNC_DIR=/var/lib/billing/secrets           # Files and the offline copy
+//
+// or WithSecretSync(&secretsync.Receiver{...}). Each applied update emits
+// secret-rotated with Event.Path set to the bundle's subject.
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/secretsync"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// WithSecretSync applies secret bundles received by r in Parse
+func WithSecretSync(r *secretsync.Receiver) Option {
+	return func(o *Options) {
+		o.SecretSync = r
+	}
+}
+
+// secretSyncFromEnv builds the receiver from SECRET_SYNC_* (nil if
+// SECRET_SYNC_SEED_FILE is unset)
+func secretSyncFromEnv(prefix string) (*secretsync.Receiver, error) {
+	seedFile := os.Getenv("SECRET_SYNC_SEED_FILE")
+	if seedFile == "" {
+		return nil, nil
+	}
+	sender := os.Getenv("SECRET_SYNC_SENDER")
+	if sender == "" {
+		return nil, fmt.Errorf("SECRET_SYNC_SENDER is required with SECRET_SYNC_SEED_FILE")
+	}
+	key, err := secretsync.LoadOrCreateKey(seedFile)
+	if err != nil {
+		return nil, err
+	}
+	return &secretsync.Receiver{
+		Service: GetEnv("SECRET_SYNC_SERVICE", strings.ToLower(prefix)),
+		Key:     key,
+		Sender:  sender,
+		Dir:     os.Getenv("SECRET_SYNC_DIR"),
+	}, nil
+}
+
+// syncSecrets fetches and applies the service's secret bundle, then
+// subscribes to updates. Without a bundle, Parse fails under
+// SecretFailFast and carries on otherwise.
+func (m *Manager) syncSecrets(ctx context.Context) error {
+	r := m.opts.SecretSync
+	if r == nil {
+		return nil
+	}
+
+	err := m.fetchSecretBundle(ctx, r)
+	if err != nil {
+		if m.opts.SecretFailurePolicy == SecretFailFast {
+			return err
+		}
+		m.logger.Warn("secret sync failed, continuing without a bundle", "service", r.Service, "error", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.natsNode == nil || m.syncSub != nil {
+		return nil
+	}
+	sub, err := r.Watch(m.natsNode.ControlConn(), func(b *secretsync.Bundle, err error) {
+		if err == nil {
+			err = r.Apply(b)
+		}
+		if err != nil {
+			m.logger.Warn("secret bundle update rejected", "service", r.Service, "error", err)
+			return
+		}
+		m.logger.Info("secret bundle applied", "service", r.Service, "issued", b.Issued)
+		m.events.emit(Event{Type: EventSecretRotated, Path: secretsync.Subject(r.Service)})
+	})
+	if err != nil {
+		return fmt.Errorf("watching secret bundles: %w", err)
+	}
+	m.syncSub = sub
+	return nil
+}
+
+// fetchSecretBundle applies the latest bundle, from the hub or the
+// receiver's offline copy
+func (m *Manager) fetchSecretBundle(ctx context.Context, r *secretsync.Receiver) error {
+	var js jetstream.JetStream
+	if m.natsNode != nil {
+		js = m.natsNode.ControlJetStream()
+	}
+	b, err := r.Fetch(ctx, js)
+	if err != nil {
+		return fmt.Errorf("syncing secrets: %w", err)
+	}
+	if err := r.Apply(b); err != nil {
+		return fmt.Errorf("applying secret bundle: %w", err)
+	}
+	return nil
+}
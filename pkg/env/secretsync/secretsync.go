@@ -0,0 +1,263 @@
+// Package secretsync pushes secrets from the hub to leaf services over
+// NATS, for field devices that cannot reach Vault themselves.
+//
+// The hub seals a Bundle of env vars and files to a service's curve key
+// (nkeys xkey) and publishes it; the latest bundle per service is kept in
+// a JetStream stream. The service opens it with its own key, checking it
+// came from the hub, and materializes it before Parse:
+//
+//	// Hub
+//	pub := secretsync.Publisher{JS: js, Key: hubKey}
+//	pub.Publish(ctx, servicePublicXKey, secretsync.Bundle{
+//	    Service: "billing",
+//	    Env:     map[string]string{"BILLING_DB_PASSWORD": "s3cret"},
+//	    Files:   map[string]string{"tls/key.pem": pem},
+//	})
+//
+//	// Leaf (or SECRET_SYNC_SEED_FILE etc., see env.WithSecretSync)
+//	key, _ := secretsync.LoadOrCreateKey("/var/lib/billing/sync.seed")
+//	r := &secretsync.Receiver{Service: "billing", Key: key, Sender: hubPublicXKey, Dir: "/var/lib/billing/secrets"}
+//	b, _ := r.Fetch(ctx, js)
+//	r.Apply(b)
+//
+// The sealed bundle is also kept in Dir, so a leaf restarts with its last
+// secrets while the hub is unreachable. Stale bundles (older than the one
+// already held) are rejected.
+package secretsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// Stream and subjects
+const (
+	StreamName    = "SECRETS_SYNC"
+	SubjectPrefix = "secrets.sync."
+)
+
+// sealedFile is the offline copy of the last bundle in Receiver.Dir
+const sealedFile = ".bundle.sealed"
+
+// Bundle is the secrets of one service
+type Bundle struct {
+	Service string            `json:"service"`
+	Env     map[string]string `json:"env,omitempty"`   // Env vars to set
+	Files   map[string]string `json:"files,omitempty"` // Relative path -> content
+	Issued  time.Time         `json:"issued"`
+}
+
+// Subject returns the subject carrying service's bundles
+func Subject(service string) string {
+	return SubjectPrefix + service
+}
+
+// validService checks service is a single subject token
+func validService(service string) error {
+	if service == "" || strings.ContainsAny(service, ".*> \t\r\n") {
+		return fmt.Errorf("invalid service name %q (one subject token)", service)
+	}
+	return nil
+}
+
+// EnsureStream creates the stream keeping the latest bundle per service
+func EnsureStream(ctx context.Context, js jetstream.JetStream) error {
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:              StreamName,
+		Description:       "Sealed secret bundles per service for wellnown-env",
+		Subjects:          []string{SubjectPrefix + ">"},
+		MaxMsgsPerSubject: 1, // Latest bundle per service wins
+	})
+	if err != nil {
+		return fmt.Errorf("creating secret sync stream: %w", err)
+	}
+	return nil
+}
+
+// LoadOrCreateKey reads the curve seed in path, generating and saving one
+// (mode 0600) if the file does not exist. Give the public key
+// (kp.PublicKey()) to the hub.
+func LoadOrCreateKey(path string) (nkeys.KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		kp, err := nkeys.FromCurveSeed([]byte(strings.TrimSpace(string(data))))
+		if err != nil {
+			return nil, fmt.Errorf("parsing curve seed %s: %w", path, err)
+		}
+		return kp, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading curve seed: %w", err)
+	}
+
+	kp, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		return nil, fmt.Errorf("generating curve key: %w", err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.WriteFile(path, string(seed)+"\n"); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// Publisher seals and publishes bundles on the hub
+type Publisher struct {
+	JS  jetstream.JetStream
+	Key nkeys.KeyPair // The hub's curve key
+}
+
+// Publish seals b to recipient (the service's public curve key) and
+// publishes it, replacing the service's previous bundle
+func (p *Publisher) Publish(ctx context.Context, recipient string, b Bundle) error {
+	if err := validService(b.Service); err != nil {
+		return err
+	}
+	if b.Issued.IsZero() {
+		b.Issued = time.Now().UTC()
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("encoding bundle: %w", err)
+	}
+	sealed, err := p.Key.Seal(data, recipient)
+	if err != nil {
+		return fmt.Errorf("sealing bundle for %s: %w", b.Service, err)
+	}
+	if _, err := p.JS.Publish(ctx, Subject(b.Service), sealed); err != nil {
+		return fmt.Errorf("publishing bundle for %s: %w", b.Service, err)
+	}
+	return nil
+}
+
+// Receiver opens and applies a service's bundles on a leaf. It is safe
+// for concurrent use.
+type Receiver struct {
+	Service string
+	Key     nkeys.KeyPair // The service's curve key
+	Sender  string        // The hub's public curve key
+	Dir     string        // Files and the offline copy ("" = env only, no copy)
+
+	mu     sync.Mutex
+	issued time.Time // Of the newest bundle opened
+}
+
+// Fetch returns the latest bundle, from the stream or, if that fails, the
+// offline copy. js may be nil to use the copy only.
+func (r *Receiver) Fetch(ctx context.Context, js jetstream.JetStream) (*Bundle, error) {
+	if err := validService(r.Service); err != nil {
+		return nil, err
+	}
+	sealed, err := r.latest(ctx, js)
+	if err != nil {
+		kept, keptErr := r.offlineCopy()
+		if keptErr != nil {
+			return nil, err
+		}
+		sealed = kept
+	}
+	return r.open(sealed)
+}
+
+// latest reads the service's last bundle from the stream
+func (r *Receiver) latest(ctx context.Context, js jetstream.JetStream) ([]byte, error) {
+	if js == nil {
+		return nil, fmt.Errorf("no JetStream to fetch secrets from")
+	}
+	stream, err := js.Stream(ctx, StreamName)
+	if err != nil {
+		return nil, fmt.Errorf("getting secret sync stream: %w", err)
+	}
+	msg, err := stream.GetLastMsgForSubject(ctx, Subject(r.Service))
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil, fmt.Errorf("no secret bundle published for %s", r.Service)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching secret bundle for %s: %w", r.Service, err)
+	}
+	return msg.Data, nil
+}
+
+// offlineCopy reads the sealed bundle kept in Dir
+func (r *Receiver) offlineCopy() ([]byte, error) {
+	if r.Dir == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(r.Dir, sealedFile))
+}
+
+// Watch calls fn with each bundle published while subscribed (or the
+// error opening it). Bundles are not applied; call Apply.
+func (r *Receiver) Watch(nc *nats.Conn, fn func(*Bundle, error)) (*nats.Subscription, error) {
+	if err := validService(r.Service); err != nil {
+		return nil, err
+	}
+	return nc.Subscribe(Subject(r.Service), func(msg *nats.Msg) {
+		fn(r.open(msg.Data))
+	})
+}
+
+// open decrypts and checks a sealed bundle, keeping an offline copy
+func (r *Receiver) open(sealed []byte) (*Bundle, error) {
+	data, err := r.Key.Open(sealed, r.Sender)
+	if err != nil {
+		return nil, fmt.Errorf("opening secret bundle for %s (not sealed by the hub for this key?): %w", r.Service, err)
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("decoding secret bundle: %w", err)
+	}
+	if b.Service != r.Service {
+		return nil, fmt.Errorf("secret bundle is for %q, not %q", b.Service, r.Service)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b.Issued.Before(r.issued) {
+		return nil, fmt.Errorf("secret bundle issued %s is older than the one held (%s)", b.Issued.Format(time.RFC3339), r.issued.Format(time.RFC3339))
+	}
+	r.issued = b.Issued
+	if r.Dir != "" {
+		if err := auth.WriteFile(filepath.Join(r.Dir, sealedFile), string(sealed)); err != nil {
+			return nil, fmt.Errorf("keeping offline copy: %w", err)
+		}
+	}
+	return &b, nil
+}
+
+// Apply materializes b: env vars into the process environment, files
+// under Dir (mode 0600)
+func (r *Receiver) Apply(b *Bundle) error {
+	for key, value := range b.Env {
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+	if len(b.Files) > 0 && r.Dir == "" {
+		return fmt.Errorf("secret bundle has files but no directory is set")
+	}
+	for name, content := range b.Files {
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("secret file %q escapes %s", name, r.Dir)
+		}
+		if err := auth.WriteFile(filepath.Join(r.Dir, name), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package secretsync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+)
+
+// memStream keeps the last message per subject
+type memStream struct {
+	jetstream.JetStream
+	msgs map[string][]byte
+	down bool
+}
+
+// memStreamHandle is the stream of a memStream
+type memStreamHandle struct {
+	jetstream.Stream
+	s *memStream
+}
+
+func (s *memStream) Publish(ctx context.Context, subject string, data []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	s.msgs[subject] = data
+	return &jetstream.PubAck{Stream: StreamName}, nil
+}
+
+func (s *memStream) Stream(ctx context.Context, name string) (jetstream.Stream, error) {
+	if s.down || name != StreamName {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	return &memStreamHandle{s: s}, nil
+}
+
+func (h *memStreamHandle) GetLastMsgForSubject(ctx context.Context, subject string) (*jetstream.RawStreamMsg, error) {
+	data, ok := h.s.msgs[subject]
+	if !ok {
+		return nil, jetstream.ErrMsgNotFound
+	}
+	return &jetstream.RawStreamMsg{Subject: subject, Data: data}, nil
+}
+
+func newKey(t *testing.T) nkeys.KeyPair {
+	t.Helper()
+	kp, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func publicKey(t *testing.T, kp nkeys.KeyPair) string {
+	t.Helper()
+	pub, err := kp.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestPublishFetchApply(t *testing.T) {
+	hub, svc := newKey(t), newKey(t)
+	js := &memStream{msgs: map[string][]byte{}}
+	dir := t.TempDir()
+	t.Setenv("SYNCTEST_DB_PASSWORD", "")
+
+	pub := &Publisher{JS: js, Key: hub}
+	err := pub.Publish(context.Background(), publicKey(t, svc), Bundle{
+		Service: "billing",
+		Env:     map[string]string{"SYNCTEST_DB_PASSWORD": "s3cret"},
+		Files:   map[string]string{"tls/key.pem": "PEM"},
+	})
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if strings.Contains(string(js.msgs[Subject("billing")]), "s3cret") {
+		t.Error("published bundle contains plaintext")
+	}
+
+	r := &Receiver{Service: "billing", Key: svc, Sender: publicKey(t, hub), Dir: dir}
+	b, err := r.Fetch(context.Background(), js)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if err := r.Apply(b); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := os.Getenv("SYNCTEST_DB_PASSWORD"); got != "s3cret" {
+		t.Errorf("SYNCTEST_DB_PASSWORD = %q, want s3cret", got)
+	}
+	path := filepath.Join(dir, "tls", "key.pem")
+	if data, _ := os.ReadFile(path); string(data) != "PEM" {
+		t.Errorf("%s = %q, want PEM", path, data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("%s mode = %v, %v; want 0600", path, info, err)
+	}
+
+	// Offline: a restarted receiver uses the kept copy
+	js.down = true
+	r2 := &Receiver{Service: "billing", Key: svc, Sender: publicKey(t, hub), Dir: dir}
+	if b, err := r2.Fetch(context.Background(), js); err != nil || b.Env["SYNCTEST_DB_PASSWORD"] != "s3cret" {
+		t.Errorf("offline Fetch() = %v, %v; want the kept bundle", b, err)
+	}
+
+	// Offline without a copy fails
+	r3 := &Receiver{Service: "billing", Key: svc, Sender: publicKey(t, hub)}
+	if _, err := r3.Fetch(context.Background(), js); err == nil {
+		t.Error("offline Fetch() without a copy succeeded")
+	}
+}
+
+func TestReceiverRejects(t *testing.T) {
+	hub, svc, other := newKey(t), newKey(t), newKey(t)
+	seal := func(from nkeys.KeyPair, b Bundle) []byte {
+		js := &memStream{msgs: map[string][]byte{}}
+		if err := (&Publisher{JS: js, Key: from}).Publish(context.Background(), publicKey(t, svc), b); err != nil {
+			t.Fatal(err)
+		}
+		return js.msgs[Subject(b.Service)]
+	}
+	now := time.Now().UTC()
+
+	r := &Receiver{Service: "billing", Key: svc, Sender: publicKey(t, hub)}
+	if _, err := r.open(seal(hub, Bundle{Service: "billing", Issued: now})); err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		want   string
+	}{
+		{name: "wrong sender", sealed: seal(other, Bundle{Service: "billing"}), want: "opening secret bundle"},
+		{name: "wrong service", sealed: seal(hub, Bundle{Service: "orders"}), want: `is for "orders"`},
+		{name: "stale", sealed: seal(hub, Bundle{Service: "billing", Issued: now.Add(-time.Hour)}), want: "older than"},
+	}
+	for _, tt := range tests {
+		_, err := r.open(tt.sealed)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: open() error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApplyRejectsEscapingFiles(t *testing.T) {
+	r := &Receiver{Service: "billing", Dir: t.TempDir()}
+	for _, name := range []string{"../evil", "/etc/passwd", ""} {
+		if err := r.Apply(&Bundle{Files: map[string]string{name: "x"}}); err == nil {
+			t.Errorf("Apply(%q) succeeded", name)
+		}
+	}
+	if err := (&Receiver{}).Apply(&Bundle{Files: map[string]string{"a": "x"}}); err == nil {
+		t.Error("Apply() of files without Dir succeeded")
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.seed")
+	kp, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey() error = %v", err)
+	}
+	again, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey() reload error = %v", err)
+	}
+	if publicKey(t, kp) != publicKey(t, again) {
+		t.Error("reloaded key differs")
+	}
+
+	if err := os.WriteFile(path, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreateKey(path); err == nil {
+		t.Error("LoadOrCreateKey() accepted a bad seed")
+	}
+}
+
+func TestSubjectValidation(t *testing.T) {
+	for _, s := range []string{"", "a.b", "a*", ">", "a b"} {
+		if err := validService(s); err == nil {
+			t.Errorf("validService(%q) succeeded", s)
+		}
+	}
+	if err := validService("billing"); err != nil {
+		t.Errorf("validService(billing) error = %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// github.go: Releases from GitHub
+package selfupdate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ChecksumsAsset is the release asset listing SHA-256 digests
+// ("<hex>  <asset name>" per line, as sha256sum writes them)
+const ChecksumsAsset = "checksums.txt"
+
+// GitHub finds releases of a GitHub repository
+type GitHub struct {
+	Repo    string       // org/repo
+	Client  *http.Client // nil = http.DefaultClient
+	BaseURL string       // API base URL (empty = https://api.github.com)
+}
+
+// githubRelease is the part of the releases API response used here
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Latest returns the latest release's asset of binary for this platform
+func (g GitHub) Latest(ctx context.Context, binary string) (*Release, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	body, err := g.get(ctx, base+"/repos/"+g.Repo+"/releases/latest", "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var gr githubRelease
+	if err := json.NewDecoder(body).Decode(&gr); err != nil {
+		return nil, fmt.Errorf("decoding latest release of %s: %w", g.Repo, err)
+	}
+
+	rel := &Release{Version: gr.TagName, Name: AssetName(binary)}
+	var checksums string
+	for _, a := range gr.Assets {
+		switch a.Name {
+		case rel.Name:
+			rel.URL = a.URL
+		case ChecksumsAsset:
+			checksums = a.URL
+		}
+	}
+	if rel.URL == "" {
+		return nil, fmt.Errorf("release %s of %s has no %s", gr.TagName, g.Repo, rel.Name)
+	}
+	if checksums == "" {
+		return nil, fmt.Errorf("release %s of %s has no %s", gr.TagName, g.Repo, ChecksumsAsset)
+	}
+
+	sums, err := g.get(ctx, checksums, "")
+	if err != nil {
+		return nil, err
+	}
+	defer sums.Close()
+	if rel.SHA256, err = findChecksum(sums, rel.Name); err != nil {
+		return nil, fmt.Errorf("release %s of %s: %w", gr.TagName, g.Repo, err)
+	}
+	return rel, nil
+}
+
+// Open downloads the release asset
+func (g GitHub) Open(ctx context.Context, rel *Release) (io.ReadCloser, error) {
+	return g.get(ctx, rel.URL, "application/octet-stream")
+}
+
+// get fetches url, failing on non-200 responses
+func (g GitHub) get(ctx context.Context, url, accept string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// findChecksum returns the digest of name in a sha256sum listing
+func findChecksum(r io.Reader, name string) (string, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("reading %s: %w", ChecksumsAsset, err)
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
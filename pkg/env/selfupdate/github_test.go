@@ -0,0 +1,88 @@
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// releaseServer serves a latest release of tool with the given assets
+func releaseServer(t *testing.T, checksums string, withBinary bool) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/acme/tools/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		assets := fmt.Sprintf(`{"name": %q, "browser_download_url": %q}`, ChecksumsAsset, srv.URL+"/dl/checksums")
+		if withBinary {
+			assets += fmt.Sprintf(`, {"name": %q, "browser_download_url": %q}`, AssetName("tool"), srv.URL+"/dl/tool")
+		}
+		fmt.Fprintf(w, `{"tag_name": "v1.4.0", "assets": [%s]}`, assets)
+	})
+	mux.HandleFunc("/dl/checksums", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, checksums)
+	})
+	mux.HandleFunc("/dl/tool", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "binary")
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGitHubLatest(t *testing.T) {
+	sums := "abc123  other_linux_amd64\ndef456 *" + AssetName("tool") + "\n"
+
+	tests := []struct {
+		name       string
+		checksums  string
+		withBinary bool
+		wantErr    string
+	}{
+		{name: "found", checksums: sums, withBinary: true},
+		{name: "no binary for platform", checksums: sums, wantErr: "has no " + AssetName("tool")},
+		{name: "no checksum", checksums: "abc123  other_linux_amd64\n", withBinary: true, wantErr: "no checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := releaseServer(t, tt.checksums, tt.withBinary)
+			g := GitHub{Repo: "acme/tools", BaseURL: srv.URL}
+
+			rel, err := g.Latest(context.Background(), "tool")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Latest() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+			if rel.Version != "v1.4.0" || rel.SHA256 != "def456" {
+				t.Errorf("Latest() = %+v, want v1.4.0 with checksum def456", rel)
+			}
+
+			r, err := g.Open(context.Background(), rel)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer r.Close()
+			if data, _ := io.ReadAll(r); string(data) != "binary" {
+				t.Errorf("Open() = %q, want the binary", data)
+			}
+		})
+	}
+}
+
+func TestGitHubLatestNoRelease(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := GitHub{Repo: "acme/none", BaseURL: srv.URL}.Latest(context.Background(), "tool")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Latest() error = %v, want 404", err)
+	}
+}
@@ -0,0 +1,77 @@
+// objectstore.go: Releases from a NATS object store
+//
+// Offline sites mirror releases into the hub's object store; leaf nodes
+// and field laptops upgrade from there:
+//
+//	obs, _ := js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: selfupdate.DefaultBucket})
+//	selfupdate.Publish(ctx, obs, "wellknown-check", "v1.4.0", "linux", "arm64", f)
+//
+// The object store checks its own SHA-256 digest on every read.
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultBucket is the object store bucket holding releases
+const DefaultBucket = "releases"
+
+// versionKey is the object metadata key holding the release version
+const versionKey = "version"
+
+// ObjectStore finds releases in a NATS object store, one object per
+// binary and platform (see ObjectName)
+type ObjectStore struct {
+	Store jetstream.ObjectStore
+}
+
+// ObjectName returns the object name of binary for goos/goarch
+// (wellknown-check/linux_arm64)
+func ObjectName(binary, goos, goarch string) string {
+	return binary + "/" + goos + "_" + goarch
+}
+
+// Publish stores a release of binary for goos/goarch, replacing the
+// previous one
+func Publish(ctx context.Context, store jetstream.ObjectStore, binary, version, goos, goarch string, r io.Reader) error {
+	meta := jetstream.ObjectMeta{
+		Name:     ObjectName(binary, goos, goarch),
+		Metadata: map[string]string{versionKey: version},
+	}
+	if _, err := store.Put(ctx, meta, r); err != nil {
+		return fmt.Errorf("publishing %s %s: %w", meta.Name, version, err)
+	}
+	return nil
+}
+
+// Latest returns the stored release of binary for this platform
+func (o ObjectStore) Latest(ctx context.Context, binary string) (*Release, error) {
+	name := ObjectName(binary, runtime.GOOS, runtime.GOARCH)
+	info, err := o.Store.GetInfo(ctx, name)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, fmt.Errorf("no release of %s in the object store", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", name, err)
+	}
+	version := info.Metadata[versionKey]
+	if version == "" {
+		return nil, fmt.Errorf("%s has no %s metadata", name, versionKey)
+	}
+	return &Release{Version: version, Name: name}, nil
+}
+
+// Open downloads the release object
+func (o ObjectStore) Open(ctx context.Context, rel *Release) (io.ReadCloser, error) {
+	r, err := o.Store.Get(ctx, rel.Name)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", rel.Name, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,207 @@
+// Package selfupdate replaces a running CLI binary with a newer release,
+// so binaries in the field stay current without a package manager.
+//
+//	src := selfupdate.GitHub{Repo: "joeblew999/wellnown-env"}
+//	rel, err := selfupdate.Check(ctx, src, "wellknown-check", env.ReadBuildVersion().Version)
+//	if rel != nil {
+//	    err = selfupdate.Update(ctx, src, rel)
+//	}
+//
+// Releases come from GitHub (raw binaries named <binary>_<os>_<arch>, plus
+// checksums.txt, as .goreleaser.yaml publishes them) or from a NATS object
+// store (see ObjectStore) for sites without internet access. Downloads are
+// checked against their SHA-256 and swapped in atomically. Binaries
+// installed by Homebrew, apt or dnf are left to the package manager.
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ErrPackageManaged is returned by Update for binaries installed by a
+// package manager
+var ErrPackageManaged = errors.New("installed by a package manager")
+
+// Release is a downloadable build of a binary for this platform
+type Release struct {
+	Version string // v1.2.3
+	Name    string // Asset or object name
+	URL     string // Download URL, if the source uses one
+	SHA256  string // Hex digest (empty = verified by the source)
+}
+
+// Source finds and downloads releases
+type Source interface {
+	// Latest returns the newest release of binary for this platform
+	Latest(ctx context.Context, binary string) (*Release, error)
+	// Open downloads rel
+	Open(ctx context.Context, rel *Release) (io.ReadCloser, error)
+}
+
+// AssetName returns the release asset name of binary for this platform
+// (wellknown-check_linux_amd64, nats-node_windows_amd64.exe)
+func AssetName(binary string) string {
+	return PlatformAssetName(binary, runtime.GOOS, runtime.GOARCH)
+}
+
+// PlatformAssetName returns the release asset name of binary for goos/goarch
+func PlatformAssetName(binary, goos, goarch string) string {
+	name := binary + "_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Check returns the latest release of binary if it is newer than current,
+// or nil if current is up to date
+func Check(ctx context.Context, src Source, binary, current string) (*Release, error) {
+	rel, err := src.Latest(ctx, binary)
+	if err != nil {
+		return nil, err
+	}
+	if !Newer(rel.Version, current) {
+		return nil, nil
+	}
+	return rel, nil
+}
+
+// Update downloads rel and replaces the running executable with it
+func Update(ctx context.Context, src Source, rel *Release) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating executable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("locating executable: %w", err)
+	}
+	if pm := packageManager(exe); pm != "" {
+		return fmt.Errorf("%s: %w (upgrade with %s)", exe, ErrPackageManaged, pm)
+	}
+
+	r, err := src.Open(ctx, rel)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return Replace(exe, r, rel.SHA256)
+}
+
+// packageManager returns the package manager owning path, if any
+func packageManager(path string) string {
+	switch {
+	case strings.Contains(path, "/Cellar/") || strings.Contains(path, "/homebrew/"):
+		return "brew"
+	case strings.HasPrefix(path, "/usr/bin/") || strings.HasPrefix(path, "/usr/sbin/"):
+		return "apt or dnf"
+	}
+	return ""
+}
+
+// Replace writes r over the executable at path, verifying its SHA-256
+// (hex, empty = skip) first. The new file keeps path's mode.
+func Replace(path string, r io.Reader, sum string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	defer os.Remove(f.Name()) // No-op after the rename
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		return fmt.Errorf("downloading %s: %w", filepath.Base(path), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); sum != "" && !strings.EqualFold(got, sum) {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, sum)
+	}
+	if err := os.Chmod(f.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+
+	// Windows cannot replace a running executable, but can rename it
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("replacing %s: %w", path, err)
+		}
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Newer reports whether version latest is newer than current. Versions
+// are semver with an optional v prefix; a pre-release (v1.2.0-rc.1) is
+// older than its release. Unversioned builds (dev) are never outdated.
+func Newer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range l.core {
+		if l.core[i] != c.core[i] {
+			return l.core[i] > c.core[i]
+		}
+	}
+	switch {
+	case l.pre == c.pre:
+		return false
+	case l.pre == "":
+		return true
+	case c.pre == "":
+		return false
+	}
+	return l.pre > c.pre
+}
+
+// version is a parsed semantic version
+type version struct {
+	core [3]int
+	pre  string
+}
+
+// parseVersion parses [v]MAJOR[.MINOR[.PATCH]][-PRE][+BUILD]
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, v.pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.core[i] = n
+	}
+	return v, true
+}
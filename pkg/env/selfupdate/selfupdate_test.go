@@ -0,0 +1,107 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		latest  string
+		current string
+		want    bool
+	}{
+		{latest: "v1.2.0", current: "v1.1.9", want: true},
+		{latest: "v1.10.0", current: "v1.9.0", want: true},
+		{latest: "v2.0.0", current: "v1.99.99", want: true},
+		{latest: "1.2.0", current: "v1.2.0", want: false},
+		{latest: "v1.1.0", current: "v1.2.0", want: false},
+		{latest: "v1.2.0", current: "v1.2.0-rc.1", want: true},
+		{latest: "v1.2.0-rc.2", current: "v1.2.0-rc.1", want: true},
+		{latest: "v1.2.0-rc.1", current: "v1.2.0", want: false},
+		{latest: "v1.2.1+build.5", current: "v1.2.0", want: true},
+		{latest: "v1.2", current: "v1.1.5", want: true},
+		{latest: "v1.2.0", current: "dev", want: false},
+		{latest: "latest", current: "v1.0.0", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.latest+">"+tt.current, func(t *testing.T) {
+			if got := Newer(tt.latest, tt.current); got != tt.want {
+				t.Errorf("Newer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("new"))
+
+	if err := Replace(path, strings.NewReader("new"), strings.Repeat("0", 64)); err == nil {
+		t.Fatal("Replace() accepted a wrong checksum")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("failed Replace() changed the file to %q", data)
+	}
+
+	if err := Replace(path, strings.NewReader("new"), hex.EncodeToString(sum[:])); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != "new" || info.Mode().Perm() != 0o755 {
+		t.Errorf("replaced file = %q mode %v, want \"new\" mode 0755", data, info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestPackageManager(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/opt/homebrew/Cellar/wellknown-check/1.2.0/bin/wellknown-check", want: true},
+		{path: "/home/linuxbrew/.linuxbrew/Cellar/nats-node/1.0.0/bin/nats-node", want: true},
+		{path: "/usr/bin/wellknown-check", want: true},
+		{path: "/usr/local/bin/wellknown-check", want: false},
+		{path: "/home/tech/bin/wellknown-check", want: false},
+	}
+	for _, tt := range tests {
+		if got := packageManager(tt.path) != ""; got != tt.want {
+			t.Errorf("packageManager(%s) managed = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+// fakeSource serves one release
+type fakeSource struct{ rel Release }
+
+func (f fakeSource) Latest(context.Context, string) (*Release, error) { return &f.rel, nil }
+func (f fakeSource) Open(context.Context, *Release) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("binary")), nil
+}
+
+func TestCheck(t *testing.T) {
+	src := fakeSource{rel: Release{Version: "v1.3.0", Name: AssetName("tool")}}
+
+	rel, err := Check(context.Background(), src, "tool", "v1.2.0")
+	if err != nil || rel == nil || rel.Version != "v1.3.0" {
+		t.Errorf("Check() = %+v, %v; want v1.3.0", rel, err)
+	}
+	if rel, err := Check(context.Background(), src, "tool", "v1.3.0"); err != nil || rel != nil {
+		t.Errorf("Check() when up to date = %+v, %v; want nil", rel, err)
+	}
+}
@@ -0,0 +1,225 @@
+// serviceaccounts.go: One NATS account per registered service in jwt mode
+//
+// By default every client shares the APP account. ProvisionServiceAccounts
+// isolates services instead: each org/repo in the registry gets its own
+// account (SVC_ORG_REPO_<hash>, see ServiceAccountName) exporting the subjects it serves, importing the
+// subjects of the services it depends on, and a "service" user limited to
+// exactly those subjects:
+//
+//	regs, _ := mgr.GetAllServices(ctx)
+//	jwts, _ := env.ProvisionServiceAccounts(store, env.ServiceAccounts(regs))
+//	_ = node.StoreAccounts(jwts) // Or mgr.ProvisionServiceAccounts(ctx)
+//
+// The accounts live in the operator's store, so configureJWTAuth preloads
+// them on the next start as well. Creds are written to
+// <keys>/creds/wellnown/SVC_ORG_REPO_<hash>/service.creds. Registration and KV
+// access stay in the APP account; the service creds carry service traffic.
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/jwt/v2"
+)
+
+// ServiceUser is the user created in every service account
+const ServiceUser = "service"
+
+// ServiceAccount is the account of one registered service
+type ServiceAccount struct {
+	Service  string   `json:"service"`           // org/repo
+	Account  string   `json:"account"`           // NATS account name
+	Subjects []string `json:"subjects"`          // Served and exported, sorted
+	Imports  []string `json:"imports,omitempty"` // Services depended on (org/repo), sorted
+}
+
+// ServiceAccountName returns the account name of service org/repo: a
+// readable SVC_ORG_REPO, which a-b/c and a/b-c (or Foo and foo) share,
+// and a short hash of the exact org/repo that tells them apart
+func ServiceAccountName(org, repo string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, org+"_"+repo)
+	sum := sha256.Sum256([]byte(org + "/" + repo))
+	return "SVC_" + strings.ToUpper(name+"_"+hex.EncodeToString(sum[:4]))
+}
+
+// ServiceAccounts derives the accounts from registrations, merging all
+// instances of a service. Sorted by service.
+func ServiceAccounts(regs []registry.ServiceRegistration) []ServiceAccount {
+	type sets struct{ subjects, imports map[string]bool }
+	byService := make(map[string]*ServiceAccount)
+	seen := make(map[string]sets)
+
+	for _, reg := range regs {
+		name := reg.GitHub.Name()
+		if name == "" {
+			continue
+		}
+		acct, ok := byService[name]
+		if !ok {
+			acct = &ServiceAccount{Service: name, Account: ServiceAccountName(reg.GitHub.Org, reg.GitHub.Repo)}
+			byService[name] = acct
+			seen[name] = sets{subjects: make(map[string]bool), imports: make(map[string]bool)}
+		}
+		s := seen[name]
+		for _, subject := range reg.Capabilities.Subjects {
+			if !s.subjects[subject] {
+				s.subjects[subject] = true
+				acct.Subjects = append(acct.Subjects, subject)
+			}
+		}
+		for _, f := range reg.Fields {
+			if f.Dependency != "" && f.Dependency != name && !s.imports[f.Dependency] {
+				s.imports[f.Dependency] = true
+				acct.Imports = append(acct.Imports, f.Dependency)
+			}
+		}
+	}
+
+	accts := make([]ServiceAccount, 0, len(byService))
+	for _, acct := range byService {
+		sort.Strings(acct.Subjects)
+		sort.Strings(acct.Imports)
+		accts = append(accts, *acct)
+	}
+	sort.Slice(accts, func(i, j int) bool { return accts[i].Service < accts[j].Service })
+	return accts
+}
+
+// ProvisionServiceAccounts creates or updates accts under the wellnown
+// operator in store and returns their JWTs by account public key. It is
+// idempotent: existing accounts and users keep their keys, while exports,
+// imports and permissions follow accts. Imports of unregistered services
+// are skipped.
+func ProvisionServiceAccounts(store auth.Store, accts []ServiceAccount) (map[string]string, error) {
+	op, err := auth.LoadOperator(store, auth.DefaultOperator)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every account must exist before imports can name it
+	accounts := make(map[string]*auth.Account, len(accts))
+	byService := make(map[string]ServiceAccount, len(accts))
+	for _, sa := range accts {
+		acct, err := op.Account(sa.Account)
+		if errors.Is(err, fs.ErrNotExist) {
+			acct, err = op.AddAccount(sa.Account)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("service account %s: %w", sa.Account, err)
+		}
+		accounts[sa.Service] = acct
+		byService[sa.Service] = sa
+	}
+
+	jwts := make(map[string]string, len(accts))
+	for _, sa := range accts {
+		acct := accounts[sa.Service]
+
+		var imports jwt.Imports
+		pub := append([]string(nil), sa.Subjects...)
+		for _, dep := range sa.Imports {
+			target, ok := byService[dep]
+			if !ok {
+				continue
+			}
+			for _, subject := range target.Subjects {
+				imports.Add(&jwt.Import{Name: dep, Subject: jwt.Subject(subject), Account: accounts[dep].PublicKey, Type: jwt.Service})
+				pub = append(pub, subject)
+			}
+		}
+
+		token, err := acct.Update(func(ac *jwt.AccountClaims) {
+			ac.Exports = nil
+			for _, subject := range sa.Subjects {
+				ac.Exports.Add(&jwt.Export{Name: sa.Service, Subject: jwt.Subject(subject), Type: jwt.Service})
+			}
+			ac.Imports = imports
+		})
+		if err != nil {
+			return nil, fmt.Errorf("service account %s: %w", sa.Account, err)
+		}
+		jwts[acct.PublicKey] = token
+
+		perms := SubjectPermissions{Publish: pub, Subscribe: append([]string{"_INBOX.>"}, sa.Subjects...)}
+		_, err = acct.UpdateUser(ServiceUser, perms.UserOption())
+		if errors.Is(err, fs.ErrNotExist) {
+			_, err = acct.AddUser(ServiceUser, perms.UserOption())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("service account %s: %w", sa.Account, err)
+		}
+	}
+	return jwts, nil
+}
+
+// StoreAccounts hands account JWTs (by public key) to the running server.
+// Accounts already in use are updated in place, so changed exports and
+// imports apply without reconnecting.
+func (n *NATSNode) StoreAccounts(jwts map[string]string) error {
+	if n.Shared() {
+		return ErrSharedNode
+	}
+	resolver := n.server.AccountResolver()
+	if resolver == nil {
+		return fmt.Errorf("server has no account resolver (not in jwt mode)")
+	}
+	for pub, token := range jwts {
+		if err := resolver.Store(pub, token); err != nil {
+			return fmt.Errorf("storing account %s: %w", pub, err)
+		}
+		acc, err := n.server.LookupAccount(pub)
+		if err != nil {
+			return fmt.Errorf("loading account %s: %w", pub, err)
+		}
+		claims, err := jwt.DecodeAccountClaims(token)
+		if err != nil {
+			return fmt.Errorf("decoding account %s: %w", pub, err)
+		}
+		n.server.UpdateAccountClaims(acc, claims)
+	}
+	return nil
+}
+
+// ProvisionServiceAccounts gives every registered service its own account
+// (see ProvisionServiceAccounts) and loads the accounts into the embedded
+// server. Call it again when services register; it is idempotent.
+func (m *Manager) ProvisionServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	if cfg := m.natsNode.Auth(); cfg == nil || cfg.Mode != "jwt" {
+		return nil, fmt.Errorf("service accounts need jwt auth mode")
+	}
+
+	regs, err := m.GetAllServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store, err := auth.DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	accts := ServiceAccounts(regs)
+	jwts, err := ProvisionServiceAccounts(store, accts)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.natsNode.StoreAccounts(jwts); err != nil {
+		return nil, err
+	}
+	return accts, nil
+}
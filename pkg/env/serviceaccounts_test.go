@@ -0,0 +1,146 @@
+package env
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/auth"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/jwt/v2"
+)
+
+// serving returns a registration of org/repo serving subjects and
+// depending on deps
+func serving(name string, subjects []string, deps ...string) registry.ServiceRegistration {
+	org, repo, _ := strings.Cut(name, "/")
+	reg := registry.ServiceRegistration{GitHub: registry.GitHubInfo{Org: org, Repo: repo}}
+	reg.Capabilities.Subjects = subjects
+	for _, d := range deps {
+		reg.Fields = append(reg.Fields, registry.FieldInfo{EnvKey: "DEP", Dependency: d})
+	}
+	return reg
+}
+
+func TestServiceAccountName(t *testing.T) {
+	tests := []struct{ org, repo, want string }{
+		{"acme", "orders", "SVC_ACME_ORDERS_"},
+		{"joeblew999", "wellnown-env", "SVC_JOEBLEW999_WELLNOWN_ENV_"},
+		{"a.b", "c d", "SVC_A_B_C_D_"},
+	}
+	for _, tt := range tests {
+		got := ServiceAccountName(tt.org, tt.repo)
+		if !strings.HasPrefix(got, tt.want) || len(got) != len(tt.want)+8 {
+			t.Errorf("ServiceAccountName(%q, %q) = %s, want %s and an 8 digit hash", tt.org, tt.repo, got, tt.want)
+		}
+		if again := ServiceAccountName(tt.org, tt.repo); again != got {
+			t.Errorf("ServiceAccountName(%q, %q) changed from %s to %s", tt.org, tt.repo, got, again)
+		}
+	}
+}
+
+func TestServiceAccountNameCollisions(t *testing.T) {
+	// Services whose readable names are the same get different accounts
+	for _, pair := range [][2][2]string{
+		{{"a-b", "c"}, {"a", "b-c"}},
+		{{"Foo", "x"}, {"foo", "x"}},
+		{{"a.b", "c"}, {"a", "b.c"}},
+		{{"a_b", "c"}, {"a", "b_c"}},
+	} {
+		one, other := pair[0], pair[1]
+		a, b := ServiceAccountName(one[0], one[1]), ServiceAccountName(other[0], other[1])
+		if a == b {
+			t.Errorf("%s/%s and %s/%s share account %s", one[0], one[1], other[0], other[1], a)
+		}
+	}
+
+	regs := []registry.ServiceRegistration{serving("a-b/c", nil), serving("a/b-c", nil)}
+	if got := ServiceAccounts(regs); len(got) != 2 || got[0].Account == got[1].Account {
+		t.Errorf("ServiceAccounts() = %+v, want two accounts", got)
+	}
+}
+
+func TestServiceAccounts(t *testing.T) {
+	regs := []registry.ServiceRegistration{
+		serving("o/web", nil, "o/api", "o/api"),
+		serving("o/api", []string{"api.users.>"}, "o/db"),
+		serving("o/api", []string{"api.orders.>", "api.users.>"}, "o/api"),
+		serving("", []string{"ignored.>"}),
+	}
+
+	got := ServiceAccounts(regs)
+	if len(got) != 2 {
+		t.Fatalf("ServiceAccounts() = %+v, want 2 accounts", got)
+	}
+	api, web := got[0], got[1]
+	if api.Service != "o/api" || api.Account != ServiceAccountName("o", "api") {
+		t.Errorf("first account = %+v, want o/api as %s", api, ServiceAccountName("o", "api"))
+	}
+	if s := strings.Join(api.Subjects, ","); s != "api.orders.>,api.users.>" {
+		t.Errorf("api subjects = %s, want merged and sorted", s)
+	}
+	if s := strings.Join(api.Imports, ","); s != "o/db" {
+		t.Errorf("api imports = %s, want o/db (no self import)", s)
+	}
+	if s := strings.Join(web.Imports, ","); s != "o/api" || len(web.Subjects) != 0 {
+		t.Errorf("web = %+v, want one import of o/api and no subjects", web)
+	}
+}
+
+func TestProvisionServiceAccounts(t *testing.T) {
+	store := auth.Store{Dir: t.TempDir(), KeysDir: t.TempDir()}
+	op, err := auth.BootstrapOperator(store, auth.DefaultOperator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accts := ServiceAccounts([]registry.ServiceRegistration{
+		serving("o/web", nil, "o/api", "o/missing"),
+		serving("o/api", []string{"api.>"}),
+	})
+
+	jwts, err := ProvisionServiceAccounts(store, accts)
+	if err != nil {
+		t.Fatalf("ProvisionServiceAccounts() error = %v", err)
+	}
+	if len(jwts) != 2 {
+		t.Fatalf("got %d account JWTs, want 2", len(jwts))
+	}
+
+	api, err := op.Account(ServiceAccountName("o", "api"))
+	if err != nil {
+		t.Fatalf("Account(o/api) error = %v", err)
+	}
+	apiClaims, _ := jwt.DecodeAccountClaims(jwts[api.PublicKey])
+	if len(apiClaims.Exports) != 1 || apiClaims.Exports[0].Subject != "api.>" || !apiClaims.Exports[0].IsService() {
+		t.Errorf("api exports = %+v, want the api.> service", apiClaims.Exports)
+	}
+
+	web, _ := op.Account(ServiceAccountName("o", "web"))
+	webClaims, _ := jwt.DecodeAccountClaims(jwts[web.PublicKey])
+	if len(webClaims.Imports) != 1 || webClaims.Imports[0].Account != api.PublicKey {
+		t.Errorf("web imports = %+v, want api.> from %s only", webClaims.Imports, api.PublicKey)
+	}
+
+	creds, err := web.Creds(ServiceUser)
+	if err != nil {
+		t.Fatalf("Creds() error = %v", err)
+	}
+	token, _ := jwt.ParseDecoratedJWT(creds)
+	user, _ := jwt.DecodeUserClaims(token)
+	if !user.Pub.Allow.Contains("api.>") || user.Pub.Allow.Contains(">") {
+		t.Errorf("web user may publish %v, want the imported subjects only", user.Pub.Allow)
+	}
+
+	// Provisioning again keeps the keys
+	again, err := ProvisionServiceAccounts(store, accts)
+	if err != nil {
+		t.Fatalf("second ProvisionServiceAccounts() error = %v", err)
+	}
+	if _, ok := again[api.PublicKey]; !ok {
+		t.Error("account key changed on second provisioning")
+	}
+	recreds, _ := web.Creds(ServiceUser)
+	retoken, _ := jwt.ParseDecoratedJWT(recreds)
+	if reuser, _ := jwt.DecodeUserClaims(retoken); reuser.Subject != user.Subject {
+		t.Error("user key changed on second provisioning")
+	}
+}
@@ -0,0 +1,149 @@
+// sharednode.go: Share a nats-node already running on the host
+//
+//	NATS_LOCAL_NODE=auto ./myservice                  # nats://127.0.0.1:4222
+//	NATS_LOCAL_NODE=nats://127.0.0.1:4300 ./myservice
+//	NATS_LOCAL_NODE=unix:///run/wellnown/nats.sock ./myservice
+//
+// Boxes running many small services don't need an embedded server in
+// each. With a local node set, New first dials it; if it answers and holds
+// the services_registry bucket (the handshake), the Manager connects as a
+// plain client on the usual data and control lanes. Otherwise it embeds a
+// node as before.
+//
+// The server stays its owner's: auth reloads, account updates and server
+// stats return ErrSharedNode, and listeners (WebSocket, MQTT, monitoring,
+// cluster routes) are configured on the owner. Managers that ask for any
+// of those embed their own node.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultLocalNodeURL is the local node NATS_LOCAL_NODE=auto dials (a
+// nats-node started with NATS_PORT=4222)
+const DefaultLocalNodeURL = "nats://127.0.0.1:4222"
+
+// localNodeDialTimeout bounds the dial, so services start quickly when
+// no local node runs
+const localNodeDialTimeout = 500 * time.Millisecond
+
+// ErrSharedNode is returned for operations on the server itself when the
+// Manager shares another process's node
+var ErrSharedNode = errors.New("NATS server belongs to the shared local node")
+
+// localNodeURL returns the URL to probe for a local node ("" = don't)
+func localNodeURL(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "off", "no":
+		return ""
+	case "auto", "true", "on", "yes":
+		return DefaultLocalNodeURL
+	}
+	return strings.TrimSpace(s)
+}
+
+// ConnectLocalNode connects to the node at url instead of embedding one.
+// It fails fast if nothing answers there or the node has no registry
+// bucket; the caller then embeds its own. cfg.ClientName or cfg.Name names
+// the connections (default: a random client name); Name reports the shared
+// node's name.
+func ConnectLocalNode(url string, cfg NATSConfig, authCfg *AuthConfig) (*NATSNode, error) {
+	client := cfg.clientName()
+	if client == "" {
+		client = "client-" + uuid.New().String()[:8]
+	}
+
+	logger := componentLogger(cfg.Logger, "nats")
+	auth := &atomic.Pointer[AuthConfig]{}
+	connOpts, err := nodeConnOptions(cfg, authCfg, auth, logger)
+	if err != nil {
+		return nil, err
+	}
+	connOpts = append(connOpts, nats.Timeout(localNodeDialTimeout))
+	dialURL := url
+	if path := unixSocketPath(url); path != "" {
+		dialURL = unixPlaceholderURL
+		connOpts = append(connOpts, nats.SetCustomDialer(unixDialer{path: path, timeout: localNodeDialTimeout}))
+	}
+
+	nc, err := nats.Connect(dialURL, cfg.laneOptions(connOpts, client+"-data")...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to local node %s: %w", url, err)
+	}
+	ctrl, err := nats.Connect(dialURL, cfg.laneOptions(connOpts, client+"-control")...)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("connecting control lane to local node %s: %w", url, err)
+	}
+	closeAll := func() {
+		ctrl.Close()
+		nc.Close()
+	}
+
+	// JetStream contexts as on an embedded node
+	js, err := cfg.jetStream(nc)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("creating jetstream: %w", err)
+	}
+	localJS, err := cfg.jetStream(ctrl)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("creating control jetstream: %w", err)
+	}
+	ctrlJS := localJS
+	if cfg.splitDomain() {
+		if ctrlJS, err = jetstream.NewWithDomain(ctrl, cfg.HubDomain); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("creating hub jetstream: %w", err)
+		}
+	}
+
+	// Handshake: a wellnown node serves the registry bucket
+	ctx, cancel := context.WithTimeout(context.Background(), lazyBucketTimeout)
+	defer cancel()
+	kv, err := ctrlJS.KeyValue(ctx, RegistryBucket)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("local node %s has no %s bucket: %w", url, RegistryBucket, err)
+	}
+
+	cfg.Name = nc.ConnectedServerName()
+	logger.Info("sharing local node", "name", cfg.Name, "url", nc.ConnectedUrl(), "client", client)
+
+	return &NATSNode{
+		conn:    nc,
+		js:      js,
+		ctrl:    ctrl,
+		ctrlJS:  ctrlJS,
+		localJS: localJS,
+		kv:      kv,
+		config:  cfg,
+		shared:  true,
+		auth:    auth,
+	}, nil
+}
+
+// Shared reports whether the node is another process's (see
+// ConnectLocalNode)
+func (n *NATSNode) Shared() bool {
+	return n.shared
+}
+
+// ownsServer reports whether o needs a server of its own rather than a
+// shared local node
+func (o Options) ownsServer() bool {
+	return o.NATSPort != 0 || o.WSAddr != "" || o.MonitorAddr != "" || o.Socket != "" ||
+		o.MQTT.Enabled() || o.Cluster.Enabled() || o.LeafMonitor ||
+		o.CredentialRotation > 0
+}
@@ -0,0 +1,59 @@
+package env
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocalNodeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"off", ""},
+		{"false", ""},
+		{"auto", DefaultLocalNodeURL},
+		{"TRUE", DefaultLocalNodeURL},
+		{" nats://127.0.0.1:4300 ", "nats://127.0.0.1:4300"},
+	}
+	for _, tt := range tests {
+		if got := localNodeURL(tt.in); got != tt.want {
+			t.Errorf("localNodeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOptionsOwnsServer(t *testing.T) {
+	tests := []struct {
+		name string
+		o    Options
+		want bool
+	}{
+		{"plain service", Options{HubURL: "nats://hub:4222"}, false},
+		{"fixed port", Options{NATSPort: 4223}, true},
+		{"websocket", Options{WSAddr: ":8080"}, true},
+		{"mqtt", Options{MQTT: MQTTConfig{Port: 1883}}, true},
+		{"hub liveness monitor", Options{LeafMonitor: true}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.o.ownsServer(); got != tt.want {
+			t.Errorf("%s: ownsServer() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSharedNodeServerOperations(t *testing.T) {
+	n := &NATSNode{shared: true}
+	if err := n.ReloadAuth(&AuthConfig{Mode: "token", Token: "t"}); !errors.Is(err, ErrSharedNode) {
+		t.Errorf("ReloadAuth() error = %v, want ErrSharedNode", err)
+	}
+	if err := n.StoreAccounts(nil); !errors.Is(err, ErrSharedNode) {
+		t.Errorf("StoreAccounts() error = %v, want ErrSharedNode", err)
+	}
+	if _, err := n.Stats(); !errors.Is(err, ErrSharedNode) {
+		t.Errorf("Stats() error = %v, want ErrSharedNode", err)
+	}
+	if got := n.MonitorURL(); got != "" {
+		t.Errorf("MonitorURL() = %q, want none", got)
+	}
+}
@@ -0,0 +1,111 @@
+// Package skeleton generates a minimal leaf service on the SDK: main.go,
+// a config struct, a Via page, pc.yaml and go.mod, from templates
+// embedded in the binary.
+//
+//	wellknown-check new ./orders --repo acme/orders
+//
+//	files, err := skeleton.Write("orders", skeleton.Params{Repo: "acme/orders"})
+//
+// The templates are compiled against this SDK by the package tests, so a
+// generated service builds with the version it was generated from.
+package skeleton
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// Params describes the service to generate
+type Params struct {
+	Repo    string // org/repo the service registers as (required)
+	Module  string // Go module path (default: github.com/org/repo)
+	Prefix  string // Env var prefix (default: repo name in upper case)
+	SDKPath string // pkg/env directory to build against, relative to the service (default: the published module)
+}
+
+// data is what the templates see
+type data struct {
+	Params
+	Org  string
+	Name string
+}
+
+// repoPattern matches org/repo names that are valid in module paths,
+// registry keys and YAML keys alike
+var repoPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+/[A-Za-z0-9_-]+$`)
+
+// Render returns the files of the service by path
+func Render(p Params) (map[string][]byte, error) {
+	if !repoPattern.MatchString(p.Repo) {
+		return nil, fmt.Errorf("invalid repo %q, expected org/repo", p.Repo)
+	}
+	org, name, _ := strings.Cut(p.Repo, "/")
+	if p.Module == "" {
+		p.Module = "github.com/" + p.Repo
+	}
+	if p.Prefix == "" {
+		p.Prefix = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	}
+
+	tmpl, err := template.ParseFS(templates, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("parsing templates: %w", err)
+	}
+	files := make(map[string][]byte)
+	for _, t := range tmpl.Templates() {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data{Params: p, Org: org, Name: name}); err != nil {
+			return nil, fmt.Errorf("rendering %s: %w", t.Name(), err)
+		}
+		path := strings.TrimSuffix(t.Name(), ".tmpl")
+		out := buf.Bytes()
+		if strings.HasSuffix(path, ".go") {
+			if out, err = format.Source(out); err != nil {
+				return nil, fmt.Errorf("formatting %s: %w", path, err)
+			}
+		}
+		files[path] = out
+	}
+	return files, nil
+}
+
+// Write renders the service into dir and returns the paths written. It
+// refuses to overwrite existing files.
+func Write(dir string, p Params) ([]string, error) {
+	files, err := Render(p)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%s already exists", path)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", dir, err)
+	}
+	for _, path := range paths {
+		if err := os.WriteFile(path, files[filepath.Base(path)], 0o644); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", path, err)
+		}
+	}
+	return paths, nil
+}
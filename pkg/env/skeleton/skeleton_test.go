@@ -0,0 +1,143 @@
+package skeleton
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRender(t *testing.T) {
+	files, err := Render(Params{Repo: "acme/orders-api"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"config.go", "go.mod", "main.go", "page.go", "pc.yaml"}; !slices.Equal(names, want) {
+		t.Errorf("Render() files = %v, want %v", names, want)
+	}
+
+	for name, want := range map[string]string{
+		"go.mod":    "module github.com/acme/orders-api\n",
+		"main.go":   `env.New("ORDERS_API")`,
+		"config.go": "default:Hello from orders-api",
+		"pc.yaml":   "ORDERS_API_GREETING=",
+	} {
+		if !strings.Contains(string(files[name]), want) {
+			t.Errorf("%s lacks %q:\n%s", name, want, files[name])
+		}
+	}
+	if strings.Contains(string(files["go.mod"]), "pkg/env =>") {
+		t.Error("go.mod replaces the SDK without SDKPath")
+	}
+
+	var pc struct {
+		Processes map[string]struct {
+			Command string `yaml:"command"`
+		} `yaml:"processes"`
+	}
+	if err := yaml.Unmarshal(files["pc.yaml"], &pc); err != nil {
+		t.Fatalf("pc.yaml: %v", err)
+	}
+	if pc.Processes["orders-api"].Command != "go run ." {
+		t.Errorf("pc.yaml processes = %+v, want orders-api running go run .", pc.Processes)
+	}
+}
+
+func TestRenderParams(t *testing.T) {
+	files, err := Render(Params{Repo: "acme/orders", Module: "example.com/orders", Prefix: "ORD", SDKPath: "../sdk"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	mod := string(files["go.mod"])
+	if !strings.HasPrefix(mod, "module example.com/orders\n") || !strings.Contains(mod, "pkg/env => ../sdk\n") {
+		t.Errorf("go.mod =\n%s", mod)
+	}
+	if !strings.Contains(string(files["main.go"]), `env.New("ORD")`) {
+		t.Error("main.go ignores Prefix")
+	}
+
+	for _, repo := range []string{"", "orders", "acme/orders/api", "acme/or ders", "acme/o,rders"} {
+		if _, err := Render(Params{Repo: repo}); err == nil {
+			t.Errorf("Render(%q) succeeded, want error", repo)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "orders")
+	paths, err := Write(dir, Params{Repo: "acme/orders"})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(paths) != 5 {
+		t.Errorf("Write() = %v, want 5 files", paths)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Write(dir, Params{Repo: "acme/orders"}); err == nil {
+		t.Error("Write() over an existing service succeeded")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); string(data) != "package main\n" {
+		t.Error("Write() overwrote main.go")
+	}
+}
+
+// The generated go.mod must replace Via the way the SDK does, or the
+// service builds against a different Via
+func TestViaReplaceMatchesSDK(t *testing.T) {
+	sdk, err := os.ReadFile("../go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := Render(Params{Repo: "acme/orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(sdk), "\n") {
+		if strings.HasPrefix(line, "replace github.com/go-via/via ") {
+			if !strings.Contains(string(files["go.mod"]), line+"\n") {
+				t.Errorf("go.mod lacks the SDK's %q", line)
+			}
+			return
+		}
+	}
+	t.Error("SDK go.mod has no Via replace")
+}
+
+// TestSkeletonBuilds compiles a generated service against this SDK
+func TestSkeletonBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a generated service")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	sdk, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := Write(dir, Params{Repo: "acme/orders", SDKPath: sdk}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"mod", "tidy"}, {"vet", "./..."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
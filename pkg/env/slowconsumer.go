@@ -0,0 +1,181 @@
+// slowconsumer.go: Slow consumer detection and drop-oldest subscriptions
+//
+// When a subscription handler falls behind, nats.go drops new messages
+// once the pending limits are reached and reports a slow consumer once per
+// episode. The node's connections log it with the subscription, count it
+// (wellnown_nats_slow_consumers_total) and emit a slow-consumer event:
+//
+//	mgr.Events().Subscribe(func(e env.Event) {
+//	    log.Printf("%s is behind, %d dropped", e.SlowConsumer.Subject, e.SlowConsumer.Dropped)
+//	}, env.EventSlowConsumer)
+//
+// Monitor-style subscribers (dashboards, tails) care about the latest
+// messages, not the ones that arrived first. SubscribeLatest buffers them
+// and drops the oldest when the handler falls behind, so the view stays
+// current and the connection never reports a slow consumer:
+//
+//	sub, err := env.SubscribeLatest(mgr.NC(), "metrics.>", 256, func(msg *nats.Msg) { ... })
+//	defer sub.Unsubscribe()
+package env
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultLatestBuffer is the SubscribeLatest buffer size when none is given
+const DefaultLatestBuffer = 1024
+
+// SlowConsumer describes a subscription that fell behind
+type SlowConsumer struct {
+	Conn         string    // Connection name
+	Subject      string    // Subscribed subject
+	Queue        string    // Queue group (empty = none)
+	Pending      int       // Messages waiting for the handler
+	PendingBytes int       // Bytes waiting for the handler
+	Dropped      int       // Messages dropped so far
+	Time         time.Time // When it was reported
+}
+
+// slowConsumer reads the state of sub once nats.go reported it slow
+func slowConsumer(nc *nats.Conn, sub *nats.Subscription) SlowConsumer {
+	sc := SlowConsumer{Conn: nc.Opts.Name, Time: time.Now()}
+	if sub == nil {
+		return sc
+	}
+	sc.Subject, sc.Queue = sub.Subject, sub.Queue
+	sc.Pending, sc.PendingBytes, _ = sub.Pending()
+	sc.Dropped, _ = sub.Dropped()
+	return sc
+}
+
+// asyncErrorHandler logs the connection's async errors; slow consumers
+// are also counted and passed to onSlow (if set)
+func asyncErrorHandler(logger *slog.Logger, onSlow func(SlowConsumer)) nats.ErrHandler {
+	return func(nc *nats.Conn, sub *nats.Subscription, err error) {
+		if !errors.Is(err, nats.ErrSlowConsumer) {
+			subject := ""
+			if sub != nil {
+				subject = sub.Subject
+			}
+			logger.Error("async error", "conn", nc.Opts.Name, "subject", subject, "error", err)
+			return
+		}
+
+		sc := slowConsumer(nc, sub)
+		metrics.slowConsumers.Add(1)
+		logger.Warn("slow consumer, messages dropped", "conn", sc.Conn, "subject", sc.Subject, "queue", sc.Queue,
+			"pending", sc.Pending, "pending_bytes", sc.PendingBytes, "dropped", sc.Dropped)
+		if onSlow != nil {
+			onSlow(sc)
+		}
+	}
+}
+
+// LatestSubscription delivers a subject's messages through a bounded
+// buffer that drops the oldest message when the handler falls behind
+type LatestSubscription struct {
+	sub *nats.Subscription
+	buf *latestBuffer
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// SubscribeLatest subscribes fn to subject, keeping at most size messages
+// waiting (0 = DefaultLatestBuffer). fn runs on its own goroutine.
+func SubscribeLatest(nc *nats.Conn, subject string, size int, fn func(msg *nats.Msg)) (*LatestSubscription, error) {
+	s := &LatestSubscription{buf: newLatestBuffer(size), stop: make(chan struct{})}
+	sub, err := nc.Subscribe(subject, s.buf.push)
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to %s: %w", subject, err)
+	}
+	s.sub = sub
+	go s.buf.deliver(s.stop, fn)
+	return s, nil
+}
+
+// Dropped returns how many messages were dropped to keep the newest
+func (s *LatestSubscription) Dropped() uint64 {
+	return s.buf.dropped.Load()
+}
+
+// Unsubscribe stops delivery; buffered messages are discarded
+func (s *LatestSubscription) Unsubscribe() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	return s.sub.Unsubscribe()
+}
+
+// latestBuffer is a FIFO that drops its oldest message when full
+type latestBuffer struct {
+	mu   sync.Mutex
+	msgs []*nats.Msg
+	size int
+	wake chan struct{} // Signaled when a message is pushed
+
+	dropped atomic.Uint64
+}
+
+// newLatestBuffer creates a buffer of size messages (0 = DefaultLatestBuffer)
+func newLatestBuffer(size int) *latestBuffer {
+	if size <= 0 {
+		size = DefaultLatestBuffer
+	}
+	return &latestBuffer{size: size, wake: make(chan struct{}, 1)}
+}
+
+// push adds msg, dropping the oldest message if the buffer is full. It
+// never blocks, so the subscription never falls behind.
+func (b *latestBuffer) push(msg *nats.Msg) {
+	b.mu.Lock()
+	if len(b.msgs) == b.size {
+		b.msgs[0] = nil
+		b.msgs = b.msgs[1:]
+		b.dropped.Add(1)
+	}
+	b.msgs = append(b.msgs, msg)
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pop removes and returns the oldest message (nil if empty)
+func (b *latestBuffer) pop() *nats.Msg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.msgs) == 0 {
+		return nil
+	}
+	msg := b.msgs[0]
+	b.msgs[0] = nil
+	b.msgs = b.msgs[1:]
+	return msg
+}
+
+// deliver passes buffered messages to fn until stop is closed
+func (b *latestBuffer) deliver(stop <-chan struct{}, fn func(msg *nats.Msg)) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-b.wake:
+		}
+		for msg := b.pop(); msg != nil; msg = b.pop() {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			fn(msg)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package env
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestLatestBufferDropsOldest(t *testing.T) {
+	b := newLatestBuffer(2)
+	for _, subject := range []string{"a", "b", "c"} {
+		b.push(&nats.Msg{Subject: subject})
+	}
+	if got := b.dropped.Load(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+
+	var got []string
+	for msg := b.pop(); msg != nil; msg = b.pop() {
+		got = append(got, msg.Subject)
+	}
+	if len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("buffered = %v, want [b c]", got)
+	}
+}
+
+func TestLatestBufferDefaultSize(t *testing.T) {
+	if b := newLatestBuffer(0); b.size != DefaultLatestBuffer {
+		t.Errorf("size = %d, want %d", b.size, DefaultLatestBuffer)
+	}
+}
+
+func TestLatestBufferDeliver(t *testing.T) {
+	b := newLatestBuffer(8)
+	stop := make(chan struct{})
+	got := make(chan string, 8)
+	go b.deliver(stop, func(msg *nats.Msg) { got <- msg.Subject })
+	defer close(stop)
+
+	b.push(&nats.Msg{Subject: "a"})
+	b.push(&nats.Msg{Subject: "b"})
+	for _, want := range []string{"a", "b"} {
+		select {
+		case subject := <-got:
+			if subject != want {
+				t.Errorf("delivered %q, want %q", subject, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not delivered", want)
+		}
+	}
+}
+
+func TestAsyncErrorHandlerSlowConsumer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	nc := &nats.Conn{Opts: nats.Options{Name: "acme/api/ab12cd34"}}
+
+	var reported []SlowConsumer
+	handle := asyncErrorHandler(logger, func(sc SlowConsumer) { reported = append(reported, sc) })
+
+	before := metrics.slowConsumers.Load()
+	handle(nc, nil, nats.ErrSlowConsumer)
+	handle(nc, nil, errors.New("permissions violation"))
+
+	if got := metrics.slowConsumers.Load() - before; got != 1 {
+		t.Errorf("slow consumers counted = %d, want 1", got)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("reported %d slow consumers, want 1", len(reported))
+	}
+	if reported[0].Conn != "acme/api/ab12cd34" || reported[0].Time.IsZero() {
+		t.Errorf("reported %+v, want the connection name and a time", reported[0])
+	}
+
+	// No callback configured
+	asyncErrorHandler(logger, nil)(nc, nil, nats.ErrSlowConsumer)
+}
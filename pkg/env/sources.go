@@ -0,0 +1,421 @@
+// sources.go: Layered config sources with per-field provenance
+//
+// Precedence (lowest to highest):
+//
+//	defaults < config file (YAML/JSON/TOML) < NATS KV overrides < dotenv files < env vars < CLI flags
+//
+// File and KV values are injected as environment variables before
+// ardanlabs/conf runs, but only when the real environment does not already
+// set them. conf then keeps doing what it does best: defaults, env, flags,
+// required checks and type conversion. Because injection happens before
+// secret resolution, file and KV values may themselves be ref+ secrets.
+//
+// Config file layout mirrors the struct (keys match field names,
+// case-insensitive):
+//
+//	server:
+//	  port: 9090
+//	db:
+//	  host: db.internal
+//
+// Files ending in .toml are read as TOML, anything else as YAML (which
+// covers JSON).
+//
+// KV overrides live in the "config_overrides" bucket, keyed by
+// {org}.{repo}.{ENV_KEY} (or just {ENV_KEY} when GitHub identity is unset):
+//
+//	nats kv put config_overrides joeblew999.api.APP_SERVER_PORT 9091
+//
+// After Parse, Manager.ConfigSources() reports which source supplied each field.
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigOverridesBucket is the KV bucket holding per-service config overrides
+const ConfigOverridesBucket = "config_overrides"
+
+// ConfigSource identifies where a field's value came from
+type ConfigSource string
+
+// Config sources in precedence order (lowest first)
+const (
+	SourceUnset   ConfigSource = "unset"
+	SourceDefault ConfigSource = "default"
+	SourceFile    ConfigSource = "file"
+	SourceKV      ConfigSource = "kv"
+	SourceDotenv  ConfigSource = "dotenv"
+	SourceEnv     ConfigSource = "env"
+	SourceFlag    ConfigSource = "flag"
+)
+
+// FieldSource reports the winning source for a single config field
+type FieldSource struct {
+	Path   string       `json:"path"`    // Field path (e.g., "DB.Host")
+	EnvKey string       `json:"env_key"` // Env var conf reads (e.g., "APP_DB_HOST")
+	Flag   string       `json:"flag"`    // CLI flag conf reads (e.g., "--db-host")
+	Source ConfigSource `json:"source"`
+}
+
+// confField describes a field the way ardanlabs/conf sees it
+type confField struct {
+	path      string   // Dotted Go field path
+	envKey    string   // Full env var name including namespace
+	flagKey   string   // Long flag name without dashes
+	shortFlag string   // Short flag char (may be empty)
+	fileKeys  []string // Field names used to look up config file values
+	def       string   // Default value from tag
+}
+
+// applyConfigSources loads the config file and KV overrides and injects
+// their values into the environment. Returns the env keys injected per source.
+func applyConfigSources(ctx context.Context, prefix string, cfg interface{}, file string, kv jetstream.KeyValue) (map[string]ConfigSource, error) {
+	fields := confFields(prefix, cfg)
+	injected := make(map[string]ConfigSource)
+
+	// KV beats file, so apply it first; file only fills what is still unset
+	if kv != nil {
+		overrides, err := loadKVOverrides(ctx, kv)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			val, ok := overrides[f.envKey]
+			if !ok {
+				continue
+			}
+			if _, set := os.LookupEnv(f.envKey); set {
+				continue
+			}
+			if err := os.Setenv(f.envKey, val); err != nil {
+				return nil, fmt.Errorf("setting %s: %w", f.envKey, err)
+			}
+			injected[f.envKey] = SourceKV
+		}
+	}
+
+	if file != "" {
+		data, err := loadConfigFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			val, ok := lookupFileValue(data, f.fileKeys)
+			if !ok {
+				continue
+			}
+			if _, set := os.LookupEnv(f.envKey); set {
+				continue
+			}
+			if err := os.Setenv(f.envKey, val); err != nil {
+				return nil, fmt.Errorf("setting %s: %w", f.envKey, err)
+			}
+			injected[f.envKey] = SourceFile
+		}
+	}
+
+	return injected, nil
+}
+
+// resolveFieldSources determines the winning source for every field
+func resolveFieldSources(prefix string, cfg interface{}, injected map[string]ConfigSource, args []string) []FieldSource {
+	flags := parseFlagNames(args)
+
+	var out []FieldSource
+	for _, f := range confFields(prefix, cfg) {
+		fs := FieldSource{
+			Path:   f.path,
+			EnvKey: f.envKey,
+			Flag:   "--" + f.flagKey,
+			Source: SourceUnset,
+		}
+
+		switch {
+		case flags[f.flagKey] || (f.shortFlag != "" && flags[f.shortFlag]):
+			fs.Source = SourceFlag
+		case injected[f.envKey] != "":
+			fs.Source = injected[f.envKey]
+		case os.Getenv(f.envKey) != "":
+			fs.Source = SourceEnv
+		case f.def != "":
+			fs.Source = SourceDefault
+		}
+
+		out = append(out, fs)
+	}
+	return out
+}
+
+// loadKVOverrides reads the overrides for this service from the bucket,
+// returning values keyed by env var name
+func loadKVOverrides(ctx context.Context, kv jetstream.KeyValue) (map[string]string, error) {
+	keyPrefix := ""
+	if gh := registry.GetGitHubInfo(); gh.Org != "" && gh.Repo != "" {
+		keyPrefix = gh.Org + "." + gh.Repo + "."
+	}
+
+	keys, err := kv.Keys(ctx)
+	if err != nil {
+		if err == jetstream.ErrNoKeysFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing config overrides: %w", err)
+	}
+
+	overrides := make(map[string]string)
+	for _, key := range keys {
+		envKey, ok := strings.CutPrefix(key, keyPrefix)
+		if !ok || strings.Contains(envKey, ".") {
+			continue
+		}
+		entry, err := kv.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		overrides[envKey] = string(entry.Value())
+	}
+	return overrides, nil
+}
+
+// loadConfigFile reads a YAML, JSON or TOML (by .toml extension) config
+// file into a generic map
+func loadConfigFile(path string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var data map[string]interface{}
+	unmarshal := yaml.Unmarshal
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		unmarshal = toml.Unmarshal
+	}
+	if err := unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// lookupFileValue walks nested maps by field name (case-insensitive) and
+// returns the value formatted the way conf expects it in an env var
+func lookupFileValue(data map[string]interface{}, keys []string) (string, bool) {
+	var cur interface{} = data
+	for _, k := range keys {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		found := false
+		for mk, mv := range m {
+			if strings.EqualFold(mk, k) || strings.EqualFold(strings.ReplaceAll(mk, "_", ""), k) {
+				cur = mv
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+
+	switch v := cur.(type) {
+	case nil:
+		return "", false
+	case map[string]interface{}:
+		return "", false
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ";"), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// parseFlagNames returns the set of flag names present in args
+func parseFlagNames(args []string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		name, _, _ = strings.Cut(name, "=")
+		if name != "" {
+			flags[strings.ToLower(name)] = true
+		}
+	}
+	return flags
+}
+
+// confFields walks a config struct and computes keys exactly as
+// ardanlabs/conf does (camel-case split, namespace prefix, env:/flag: tags)
+func confFields(prefix string, cfg interface{}) []confField {
+	var fields []confField
+	confFieldsRecursive(prefix, nil, nil, "", reflect.TypeOf(cfg), &fields)
+	return fields
+}
+
+func confFieldsRecursive(prefix string, key, fileKeys []string, path string, t reflect.Type, fields *[]confField) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("conf")
+		if tag == "-" {
+			continue
+		}
+
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+		fieldKey := append(append([]string{}, key...), confCamelSplit(field.Name)...)
+		fieldFileKeys := append(append([]string{}, fileKeys...), field.Name)
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// conf drills into structs that cannot decode themselves
+		if ft.Kind() == reflect.Struct && !decodesItself(ft) {
+			if field.Anonymous {
+				confFieldsRecursive(prefix, key, fileKeys, path, ft, fields)
+			} else {
+				confFieldsRecursive(prefix, fieldKey, fieldFileKeys, fieldPath, ft, fields)
+			}
+			continue
+		}
+
+		f := confField{
+			path:     fieldPath,
+			fileKeys: fieldFileKeys,
+		}
+		envKey := fieldKey
+		flagKey := fieldKey
+		for _, part := range strings.Split(tag, ",") {
+			name, val, _ := strings.Cut(strings.TrimSpace(part), ":")
+			switch name {
+			case "env":
+				envKey = strings.Split(val, "_")
+			case "flag":
+				flagKey = strings.Split(val, "-")
+			case "short":
+				f.shortFlag = strings.ToLower(val)
+			case "default":
+				f.def = val
+			}
+		}
+
+		f.envKey = confEnvKey(prefix, envKey)
+		f.flagKey = strings.ToLower(strings.Join(flagKey, "-"))
+
+		*fields = append(*fields, f)
+	}
+}
+
+// decodesItself reports whether conf would treat a struct type as a leaf
+// value (it implements a setter or text/binary unmarshaler)
+func decodesItself(t reflect.Type) bool {
+	pt := reflect.PointerTo(t)
+	for _, m := range []string{"Set", "UnmarshalText", "UnmarshalBinary"} {
+		if _, ok := pt.MethodByName(m); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// confEnvKey joins a conf key into the env var name conf reads,
+// e.g. prefix="APP", key=["DB", "Max", "Conns"] -> "APP_DB_MAX_CONNS"
+func confEnvKey(prefix string, key []string) string {
+	envKey := strings.ToUpper(strings.Join(key, "_"))
+	if prefix != "" {
+		envKey = strings.ToUpper(prefix) + "_" + envKey
+	}
+	return envKey
+}
+
+// confPathKey splits a dotted field path into its conf key,
+// e.g. "DB.MaxConns" -> ["DB", "Max", "Conns"]
+func confPathKey(path string) []string {
+	var key []string
+	for _, name := range strings.Split(path, ".") {
+		key = append(key, confCamelSplit(name)...)
+	}
+	return key
+}
+
+// confCamelSplit splits a field name the same way ardanlabs/conf does,
+// e.g. "DBHost" -> ["DB", "Host"], "MaxConns" -> ["Max", "Conns"]
+func confCamelSplit(src string) []string {
+	if src == "" {
+		return []string{}
+	}
+	if len(src) < 2 {
+		return []string{src}
+	}
+
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLower(r):
+			return 0
+		case unicode.IsUpper(r):
+			return 1
+		case unicode.IsDigit(r):
+			return 2
+		}
+		return 3
+	}
+
+	runes := []rune(src)
+	lastClass := class(runes[0])
+	lastIdx := 0
+	var out []string
+
+	for i, r := range runes {
+		c := class(r)
+		if c != lastClass {
+			// Keep the last upper-case letter with the following word (FOOBar -> FOO Bar)
+			if lastClass == 1 && c != 2 {
+				if i-lastIdx > 1 {
+					out = append(out, string(runes[lastIdx:i-1]))
+					lastIdx = i - 1
+				}
+			} else {
+				out = append(out, string(runes[lastIdx:i]))
+				lastIdx = i
+			}
+		}
+		if i == len(runes)-1 {
+			out = append(out, string(runes[lastIdx:]))
+		}
+		lastClass = c
+	}
+
+	return out
+}
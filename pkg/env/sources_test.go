@@ -0,0 +1,171 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfCamelSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Port", []string{"Port"}},
+		{"MaxConns", []string{"Max", "Conns"}},
+		{"DBHost", []string{"DB", "Host"}},
+		{"URL", []string{"URL"}},
+		{"OAuth2Token", []string{"O", "Auth", "2", "Token"}},
+		{"X", []string{"X"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := confCamelSplit(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("confCamelSplit(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+type sourcesTestConfig struct {
+	Server struct {
+		Port    int           `conf:"default:8080"`
+		Timeout time.Duration `conf:"default:5s"`
+	}
+	DB struct {
+		MaxConns int      `conf:"flag:conns"`
+		Hosts    []string `conf:"env:DATABASE_HOSTS"`
+	}
+	Debug bool `conf:"short:d"`
+}
+
+func TestConfFields(t *testing.T) {
+	var cfg sourcesTestConfig
+	got := make(map[string]confField)
+	for _, f := range confFields("APP", &cfg) {
+		got[f.path] = f
+	}
+
+	tests := []struct {
+		path    string
+		envKey  string
+		flagKey string
+	}{
+		{"Server.Port", "APP_SERVER_PORT", "server-port"},
+		{"Server.Timeout", "APP_SERVER_TIMEOUT", "server-timeout"},
+		{"DB.MaxConns", "APP_DB_MAX_CONNS", "conns"},
+		{"DB.Hosts", "APP_DATABASE_HOSTS", "db-hosts"},
+		{"Debug", "APP_DEBUG", "debug"},
+	}
+
+	for _, tt := range tests {
+		f, ok := got[tt.path]
+		if !ok {
+			t.Errorf("confFields() missing %s", tt.path)
+			continue
+		}
+		if f.envKey != tt.envKey {
+			t.Errorf("%s envKey = %q, want %q", tt.path, f.envKey, tt.envKey)
+		}
+		if f.flagKey != tt.flagKey {
+			t.Errorf("%s flagKey = %q, want %q", tt.path, f.flagKey, tt.flagKey)
+		}
+	}
+}
+
+func TestApplyConfigSources_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "server:\n  port: 9090\n  timeout: 10s\ndb:\n  max_conns: 20\n  hosts: [a, b]\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Env beats file
+	t.Setenv("SRCTEST_SERVER_TIMEOUT", "30s")
+	for _, key := range []string{"SRCTEST_SERVER_PORT", "SRCTEST_DB_MAX_CONNS", "SRCTEST_DATABASE_HOSTS"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	var cfg sourcesTestConfig
+	injected, err := applyConfigSources(t.Context(), "SRCTEST", &cfg, path, nil)
+	if err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+
+	wantEnv := map[string]string{
+		"SRCTEST_SERVER_PORT":    "9090",
+		"SRCTEST_SERVER_TIMEOUT": "30s",
+		"SRCTEST_DB_MAX_CONNS":   "20",
+		"SRCTEST_DATABASE_HOSTS": "a;b",
+	}
+	for key, want := range wantEnv {
+		if got := os.Getenv(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	sources := make(map[string]ConfigSource)
+	for _, fs := range resolveFieldSources("SRCTEST", &cfg, injected, []string{"--conns=5", "-d"}) {
+		sources[fs.Path] = fs.Source
+	}
+
+	wantSources := map[string]ConfigSource{
+		"Server.Port":    SourceFile,
+		"Server.Timeout": SourceEnv,
+		"DB.MaxConns":    SourceFlag,
+		"DB.Hosts":       SourceFile,
+		"Debug":          SourceFlag,
+	}
+	for path, want := range wantSources {
+		if got := sources[path]; got != want {
+			t.Errorf("source of %s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestApplyConfigSources_TOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := "[server]\nport = 9090\n\n[db]\nmax_conns = 20\nhosts = [\"a\", \"b\"]\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"TOMLTEST_SERVER_PORT", "TOMLTEST_DB_MAX_CONNS", "TOMLTEST_DATABASE_HOSTS"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	var cfg sourcesTestConfig
+	if _, err := applyConfigSources(t.Context(), "TOMLTEST", &cfg, path, nil); err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+
+	wantEnv := map[string]string{
+		"TOMLTEST_SERVER_PORT":    "9090",
+		"TOMLTEST_DB_MAX_CONNS":   "20",
+		"TOMLTEST_DATABASE_HOSTS": "a;b",
+	}
+	for key, want := range wantEnv {
+		if got := os.Getenv(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// The registry must advertise the env vars conf actually reads
+func TestExtractFieldsMatchesConf(t *testing.T) {
+	var cfg sourcesTestConfig
+	want := make(map[string]string)
+	for _, f := range confFields("APP", &cfg) {
+		want[f.path] = f.envKey
+	}
+
+	for _, f := range ExtractFields("APP", &cfg) {
+		if f.EnvKey != want[f.Path] {
+			t.Errorf("%s EnvKey = %q, conf reads %q", f.Path, f.EnvKey, want[f.Path])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// startup.go: Where startup time goes
+//
+// Slow starts on edge hardware are hard to attribute: is it the vault,
+// JetStream on a slow SD card, or the hub link? New and the first Parse
+// time their phases:
+//
+//	new.dotenv, new.nats, new.usage, new.hub_plan, new.jetstream_spec,
+//	new.outbox, new.static_registry, new.janitor, new.history_bucket,
+//	new.replicas, new.exporter, new.plugins
+//	parse.config_sources, parse.sync_secrets, parse.secrets,
+//	parse.secrets.<backend>, parse.config, parse.validate, parse.register
+//
+// parse.secrets.<backend> is the slowest lookup of each backend (vault,
+// awssecrets, nats, ...), as lookups run in parallel. The breakdown is
+// logged once the first Parse is done and exposed in several places:
+//
+//	report := mgr.StartupReport()
+//	fmt.Print(report) // Phases, slowest first
+//
+//	wellnown_startup_phase_seconds{phase="new.nats"} 1.82   (/metrics)
+//
+// The dashboard shows it as a Startup section, and support bundles
+// include startup.json.
+package env
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartupPhase is how long one startup phase took
+type StartupPhase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// StartupReport is the timing breakdown of New and the first Parse
+type StartupReport struct {
+	Started time.Time      `json:"started"`
+	New     time.Duration  `json:"new"`    // Time spent in New
+	Total   time.Duration  `json:"total"`  // New to the end of the first Parse (0 before)
+	Phases  []StartupPhase `json:"phases"` // In the order they first ended
+}
+
+// Slowest returns the phases by duration, longest first
+func (r StartupReport) Slowest() []StartupPhase {
+	phases := append([]StartupPhase(nil), r.Phases...)
+	sort.SliceStable(phases, func(i, j int) bool { return phases[i].Duration > phases[j].Duration })
+	return phases
+}
+
+// String renders the phases slowest first, with their share of the total
+func (r StartupReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "startup %s (New %s)\n", r.Total.Round(time.Millisecond), r.New.Round(time.Millisecond))
+	for _, p := range r.Slowest() {
+		share := ""
+		if r.Total > 0 {
+			share = fmt.Sprintf(" %5.1f%%", 100*p.Duration.Seconds()/r.Total.Seconds())
+		}
+		fmt.Fprintf(&b, "  %-28s %10s%s\n", p.Name, p.Duration.Round(time.Microsecond), share)
+	}
+	return b.String()
+}
+
+// StartupReport returns the startup timing breakdown
+func (m *Manager) StartupReport() StartupReport {
+	return m.startup.report()
+}
+
+// startupTimer records startup phases until the first Parse is done.
+// A nil timer records nothing.
+type startupTimer struct {
+	started time.Time
+
+	mu     sync.Mutex
+	phases []StartupPhase
+	new    time.Duration
+	total  time.Duration
+	done   bool
+}
+
+// newStartupTimer returns a timer for a startup beginning at started
+func newStartupTimer(started time.Time) *startupTimer {
+	return &startupTimer{started: started}
+}
+
+// begin starts timing phase name; call the returned func when it ends
+func (t *startupTimer) begin(name string) func() {
+	start := time.Now()
+	return func() { t.record(name, time.Since(start)) }
+}
+
+// record adds a phase, or adds d to a phase recorded before
+func (t *startupTimer) record(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	for i := range t.phases {
+		if t.phases[i].Name == name {
+			t.phases[i].Duration += d
+			return
+		}
+	}
+	t.phases = append(t.phases, StartupPhase{Name: name, Duration: d})
+}
+
+// constructed records the end of New
+func (t *startupTimer) constructed() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.new = time.Since(t.started)
+}
+
+// finish ends startup (the first Parse is done) and reports whether this
+// call did
+func (t *startupTimer) finish() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	t.total = time.Since(t.started)
+	return true
+}
+
+// report returns the phases recorded so far
+func (t *startupTimer) report() StartupReport {
+	if t == nil {
+		return StartupReport{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return StartupReport{
+		Started: t.started,
+		New:     t.new,
+		Total:   t.total,
+		Phases:  append([]StartupPhase(nil), t.phases...),
+	}
+}
+
+// logStartup logs the startup time and its slowest phases
+func (m *Manager) logStartup() {
+	r := m.StartupReport()
+	args := []any{"total", r.Total, "new", r.New}
+	for i, p := range r.Slowest() {
+		if i == 3 {
+			break
+		}
+		args = append(args, fmt.Sprintf("slowest_%d", i+1), fmt.Sprintf("%s=%s", p.Name, p.Duration.Round(time.Millisecond)))
+	}
+	m.logger.Info("startup complete", args...)
+}
+
+// startupTimerKey carries the startup timer to secret lookups
+type startupTimerKey struct{}
+
+// withStartupTimer returns ctx carrying t
+func withStartupTimer(ctx context.Context, t *startupTimer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, startupTimerKey{}, t)
+}
+
+// startupTimerFrom returns the timer in ctx (nil if none)
+func startupTimerFrom(ctx context.Context) *startupTimer {
+	t, _ := ctx.Value(startupTimerKey{}).(*startupTimer)
+	return t
+}
@@ -0,0 +1,107 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupTimer(t *testing.T) {
+	st := newStartupTimer(time.Now())
+	st.record("new.nats", 300*time.Millisecond)
+	st.record("parse.secrets", 100*time.Millisecond)
+	st.record("new.nats", 200*time.Millisecond) // Adds up
+	st.begin("parse.register")()
+	st.constructed()
+
+	if !st.finish() {
+		t.Fatal("first finish() = false")
+	}
+	if st.finish() {
+		t.Error("second finish() = true, want startup to end once")
+	}
+	st.record("parse.config", time.Second) // After startup: ignored
+
+	r := st.report()
+	if len(r.Phases) != 3 || r.Total == 0 {
+		t.Fatalf("report() = %+v, want 3 phases and a total", r)
+	}
+	slowest := r.Slowest()
+	if slowest[0].Name != "new.nats" || slowest[0].Duration != 500*time.Millisecond {
+		t.Errorf("slowest phase = %+v, want new.nats 500ms", slowest[0])
+	}
+	if r.Phases[0].Name != "new.nats" || r.Phases[2].Name != "parse.register" {
+		t.Errorf("Slowest() reordered the report: %+v", r.Phases)
+	}
+	if s := r.String(); !strings.Contains(s, "new.nats") || !strings.Contains(s, "%") {
+		t.Errorf("String() = %q, want phases with their share", s)
+	}
+}
+
+func TestStartupTimerNil(t *testing.T) {
+	var st *startupTimer
+	st.begin("new.nats")()
+	st.constructed()
+	if st.finish() {
+		t.Error("nil finish() = true")
+	}
+	if r := (&Manager{}).StartupReport(); r.Total != 0 || len(r.Phases) != 0 {
+		t.Errorf("StartupReport() without a timer = %+v, want empty", r)
+	}
+	if got := startupTimerFrom(withStartupTimer(context.Background(), nil)); got != nil {
+		t.Errorf("startupTimerFrom() = %v, want nil", got)
+	}
+}
+
+// slowProvider resolves every ref after a delay
+type slowProvider time.Duration
+
+func (p slowProvider) Get(ctx context.Context, ref string) (string, error) {
+	time.Sleep(time.Duration(p))
+	return "v", nil
+}
+
+func TestStartupSecretBackends(t *testing.T) {
+	f := &fakeVals{delay: 10 * time.Millisecond}
+	r := newTestResolver(t, f, WithSecretProvider("slow", slowProvider(50*time.Millisecond)))
+
+	st := newStartupTimer(time.Now())
+	ctx := withStartupTimer(context.Background(), st)
+	if _, err := r.Resolve(ctx, []string{"ref+echo://a", "ref+echo://b", "ref+slow://c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]time.Duration)
+	for _, p := range st.report().Phases {
+		got[p.Name] = p.Duration
+	}
+	if got["parse.secrets.slow"] < 50*time.Millisecond {
+		t.Errorf("parse.secrets.slow = %v, want the slow lookup", got["parse.secrets.slow"])
+	}
+	if d := got["parse.secrets.echo"]; d < 10*time.Millisecond || d >= 50*time.Millisecond {
+		t.Errorf("parse.secrets.echo = %v, want the slowest echo lookup", d)
+	}
+}
+
+func TestWriteStartupMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	writeStartupMetrics(&buf, StartupReport{})
+	if buf.Len() != 0 {
+		t.Errorf("metrics before startup is done = %q, want none", buf.String())
+	}
+
+	writeStartupMetrics(&buf, StartupReport{
+		Total:  2 * time.Second,
+		Phases: []StartupPhase{{Name: "new.nats", Duration: 1500 * time.Millisecond}},
+	})
+	for _, want := range []string{
+		"wellnown_startup_seconds 2\n",
+		`wellnown_startup_phase_seconds{phase="new.nats"} 1.5` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+}
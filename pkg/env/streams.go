@@ -0,0 +1,228 @@
+// streams.go: Declarative JetStream stream and consumer provisioning
+//
+// Services declare the streams and durable consumers they need and provision
+// them idempotently at startup, like the registry KV bucket:
+//
+//	_, err := mgr.EnsureStream(ctx, env.StreamSpec{
+//	    Name:     "ORDERS",
+//	    Subjects: []string{"orders.>"},
+//	    MaxAge:   7 * 24 * time.Hour,
+//	})
+//	_, err = mgr.EnsureConsumer(ctx, env.ConsumerSpec{
+//	    Stream:  "ORDERS",
+//	    Durable: "billing",
+//	})
+//
+// The same specs can live in a YAML file (WithJetStreamSpec or
+// JETSTREAM_SPEC), provisioned by New:
+//
+//	streams:
+//	  - name: ORDERS
+//	    subjects: [orders.>]
+//	    max_age: 168h
+//	  - name: ORDERS_MIRROR
+//	    mirror: {name: ORDERS, domain: hub}
+//	consumers:
+//	  - stream: ORDERS
+//	    durable: billing
+//	    filter_subjects: [orders.created]
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/yaml.v3"
+)
+
+// JetStreamSpec is a set of streams and consumers to provision
+type JetStreamSpec struct {
+	Streams   []StreamSpec   `yaml:"streams" json:"streams,omitempty"`
+	Consumers []ConsumerSpec `yaml:"consumers" json:"consumers,omitempty"`
+}
+
+// StreamSpec declares a stream. Empty fields use the server defaults.
+type StreamSpec struct {
+	Name        string        `yaml:"name" json:"name"`
+	Description string        `yaml:"description" json:"description,omitempty"`
+	Subjects    []string      `yaml:"subjects" json:"subjects,omitempty"`   // Empty for pure mirrors
+	Storage     string        `yaml:"storage" json:"storage,omitempty"`     // file (default) or memory
+	Retention   string        `yaml:"retention" json:"retention,omitempty"` // limits (default), interest or workqueue
+	MaxAge      time.Duration `yaml:"max_age" json:"max_age,omitempty"`
+	MaxMsgs     int64         `yaml:"max_msgs" json:"max_msgs,omitempty"`
+	MaxBytes    int64         `yaml:"max_bytes" json:"max_bytes,omitempty"`
+	Replicas    int           `yaml:"replicas" json:"replicas,omitempty"`
+	Mirror      *SourceSpec   `yaml:"mirror" json:"mirror,omitempty"`
+	Sources     []SourceSpec  `yaml:"sources" json:"sources,omitempty"`
+}
+
+// SourceSpec names a stream to mirror or source from
+type SourceSpec struct {
+	Name          string `yaml:"name" json:"name"`
+	Domain        string `yaml:"domain" json:"domain,omitempty"` // JetStream domain of the origin (empty = same domain)
+	FilterSubject string `yaml:"filter_subject" json:"filter_subject,omitempty"`
+}
+
+// ConsumerSpec declares a durable pull consumer
+type ConsumerSpec struct {
+	Stream         string        `yaml:"stream" json:"stream"`
+	Durable        string        `yaml:"durable" json:"durable"`
+	Description    string        `yaml:"description" json:"description,omitempty"`
+	FilterSubjects []string      `yaml:"filter_subjects" json:"filter_subjects,omitempty"`
+	DeliverPolicy  string        `yaml:"deliver_policy" json:"deliver_policy,omitempty"` // all (default), new, last or last_per_subject
+	AckWait        time.Duration `yaml:"ack_wait" json:"ack_wait,omitempty"`
+	MaxDeliver     int           `yaml:"max_deliver" json:"max_deliver,omitempty"`
+	MaxAckPending  int           `yaml:"max_ack_pending" json:"max_ack_pending,omitempty"`
+}
+
+// LoadJetStreamSpec reads a YAML spec file
+func LoadJetStreamSpec(path string) (*JetStreamSpec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading jetstream spec: %w", err)
+	}
+	var spec JetStreamSpec
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("parsing jetstream spec %s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+// streamConfig converts the spec to a jetstream config
+func (s StreamSpec) streamConfig() (jetstream.StreamConfig, error) {
+	cfg := jetstream.StreamConfig{
+		Name:        s.Name,
+		Description: s.Description,
+		Subjects:    s.Subjects,
+		MaxAge:      s.MaxAge,
+		MaxMsgs:     s.MaxMsgs,
+		MaxBytes:    s.MaxBytes,
+		Replicas:    s.Replicas,
+	}
+	if s.Name == "" {
+		return cfg, fmt.Errorf("stream name is required")
+	}
+
+	switch s.Storage {
+	case "", "file":
+		cfg.Storage = jetstream.FileStorage
+	case "memory":
+		cfg.Storage = jetstream.MemoryStorage
+	default:
+		return cfg, fmt.Errorf("stream %s: unknown storage %q", s.Name, s.Storage)
+	}
+
+	switch s.Retention {
+	case "", "limits":
+		cfg.Retention = jetstream.LimitsPolicy
+	case "interest":
+		cfg.Retention = jetstream.InterestPolicy
+	case "workqueue":
+		cfg.Retention = jetstream.WorkQueuePolicy
+	default:
+		return cfg, fmt.Errorf("stream %s: unknown retention %q", s.Name, s.Retention)
+	}
+
+	if s.Mirror != nil {
+		if len(s.Subjects) > 0 || len(s.Sources) > 0 {
+			return cfg, fmt.Errorf("stream %s: a mirror can't have subjects or sources", s.Name)
+		}
+		cfg.Mirror = s.Mirror.streamSource()
+	}
+	for _, src := range s.Sources {
+		cfg.Sources = append(cfg.Sources, src.streamSource())
+	}
+	return cfg, nil
+}
+
+// streamSource converts the spec to a jetstream source
+func (s SourceSpec) streamSource() *jetstream.StreamSource {
+	return &jetstream.StreamSource{Name: s.Name, Domain: s.Domain, FilterSubject: s.FilterSubject}
+}
+
+// consumerConfig converts the spec to a jetstream config
+func (s ConsumerSpec) consumerConfig() (jetstream.ConsumerConfig, error) {
+	cfg := jetstream.ConsumerConfig{
+		Durable:       s.Durable,
+		Description:   s.Description,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       s.AckWait,
+		MaxDeliver:    s.MaxDeliver,
+		MaxAckPending: s.MaxAckPending,
+	}
+	if s.Stream == "" || s.Durable == "" {
+		return cfg, fmt.Errorf("consumer needs a stream and a durable name")
+	}
+
+	switch len(s.FilterSubjects) {
+	case 0:
+	case 1:
+		cfg.FilterSubject = s.FilterSubjects[0]
+	default:
+		cfg.FilterSubjects = s.FilterSubjects
+	}
+
+	switch s.DeliverPolicy {
+	case "", "all":
+		cfg.DeliverPolicy = jetstream.DeliverAllPolicy
+	case "new":
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	case "last":
+		cfg.DeliverPolicy = jetstream.DeliverLastPolicy
+	case "last_per_subject":
+		cfg.DeliverPolicy = jetstream.DeliverLastPerSubjectPolicy
+	default:
+		return cfg, fmt.Errorf("consumer %s: unknown deliver policy %q", s.Durable, s.DeliverPolicy)
+	}
+	return cfg, nil
+}
+
+// EnsureStream creates the stream or updates it to match the spec
+func (m *Manager) EnsureStream(ctx context.Context, spec StreamSpec) (jetstream.Stream, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	cfg, err := spec.streamConfig()
+	if err != nil {
+		return nil, err
+	}
+	stream, err := m.natsNode.JetStream().CreateOrUpdateStream(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("ensuring stream %s: %w", spec.Name, err)
+	}
+	return stream, nil
+}
+
+// EnsureConsumer creates the durable consumer or updates it to match the spec
+func (m *Manager) EnsureConsumer(ctx context.Context, spec ConsumerSpec) (jetstream.Consumer, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("NATS is disabled")
+	}
+	cfg, err := spec.consumerConfig()
+	if err != nil {
+		return nil, err
+	}
+	cons, err := m.natsNode.JetStream().CreateOrUpdateConsumer(ctx, spec.Stream, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("ensuring consumer %s on %s: %w", spec.Durable, spec.Stream, err)
+	}
+	return cons, nil
+}
+
+// EnsureJetStream provisions all streams, then all consumers of a spec
+func (m *Manager) EnsureJetStream(ctx context.Context, spec *JetStreamSpec) error {
+	for _, s := range spec.Streams {
+		if _, err := m.EnsureStream(ctx, s); err != nil {
+			return err
+		}
+	}
+	for _, c := range spec.Consumers {
+		if _, err := m.EnsureConsumer(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package env
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestStreamSpecConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    StreamSpec
+		wantErr bool
+		check   func(t *testing.T, cfg jetstream.StreamConfig)
+	}{
+		{
+			name: "defaults",
+			spec: StreamSpec{Name: "ORDERS", Subjects: []string{"orders.>"}, MaxAge: time.Hour},
+			check: func(t *testing.T, cfg jetstream.StreamConfig) {
+				if cfg.Storage != jetstream.FileStorage || cfg.Retention != jetstream.LimitsPolicy {
+					t.Errorf("storage/retention = %v/%v, want file/limits", cfg.Storage, cfg.Retention)
+				}
+				if cfg.MaxAge != time.Hour {
+					t.Errorf("MaxAge = %v, want 1h", cfg.MaxAge)
+				}
+			},
+		},
+		{
+			name: "memory workqueue",
+			spec: StreamSpec{Name: "JOBS", Storage: "memory", Retention: "workqueue"},
+			check: func(t *testing.T, cfg jetstream.StreamConfig) {
+				if cfg.Storage != jetstream.MemoryStorage || cfg.Retention != jetstream.WorkQueuePolicy {
+					t.Errorf("storage/retention = %v/%v, want memory/workqueue", cfg.Storage, cfg.Retention)
+				}
+			},
+		},
+		{
+			name: "mirror",
+			spec: StreamSpec{Name: "ORDERS_MIRROR", Mirror: &SourceSpec{Name: "ORDERS", Domain: "hub"}},
+			check: func(t *testing.T, cfg jetstream.StreamConfig) {
+				if cfg.Mirror == nil || cfg.Mirror.Name != "ORDERS" || cfg.Mirror.Domain != "hub" {
+					t.Errorf("Mirror = %+v, want ORDERS@hub", cfg.Mirror)
+				}
+			},
+		},
+		{
+			name: "sources",
+			spec: StreamSpec{Name: "ALL", Sources: []SourceSpec{{Name: "A"}, {Name: "B", FilterSubject: "b.x"}}},
+			check: func(t *testing.T, cfg jetstream.StreamConfig) {
+				if len(cfg.Sources) != 2 || cfg.Sources[1].FilterSubject != "b.x" {
+					t.Errorf("Sources = %+v, want A and B filtered on b.x", cfg.Sources)
+				}
+			},
+		},
+		{name: "missing name", spec: StreamSpec{Subjects: []string{"x"}}, wantErr: true},
+		{name: "bad storage", spec: StreamSpec{Name: "X", Storage: "disk"}, wantErr: true},
+		{name: "bad retention", spec: StreamSpec{Name: "X", Retention: "forever"}, wantErr: true},
+		{name: "mirror with subjects", spec: StreamSpec{Name: "X", Subjects: []string{"x"}, Mirror: &SourceSpec{Name: "Y"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.spec.streamConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("streamConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestConsumerSpecConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ConsumerSpec
+		wantErr bool
+		check   func(t *testing.T, cfg jetstream.ConsumerConfig)
+	}{
+		{
+			name: "defaults",
+			spec: ConsumerSpec{Stream: "ORDERS", Durable: "billing"},
+			check: func(t *testing.T, cfg jetstream.ConsumerConfig) {
+				if cfg.DeliverPolicy != jetstream.DeliverAllPolicy || cfg.AckPolicy != jetstream.AckExplicitPolicy {
+					t.Errorf("deliver/ack = %v/%v, want all/explicit", cfg.DeliverPolicy, cfg.AckPolicy)
+				}
+			},
+		},
+		{
+			name: "single filter",
+			spec: ConsumerSpec{Stream: "ORDERS", Durable: "billing", FilterSubjects: []string{"orders.created"}},
+			check: func(t *testing.T, cfg jetstream.ConsumerConfig) {
+				if cfg.FilterSubject != "orders.created" || len(cfg.FilterSubjects) != 0 {
+					t.Errorf("filters = %q/%q, want single orders.created", cfg.FilterSubject, cfg.FilterSubjects)
+				}
+			},
+		},
+		{
+			name: "multiple filters",
+			spec: ConsumerSpec{Stream: "ORDERS", Durable: "billing", FilterSubjects: []string{"a", "b"}, DeliverPolicy: "new"},
+			check: func(t *testing.T, cfg jetstream.ConsumerConfig) {
+				if len(cfg.FilterSubjects) != 2 || cfg.DeliverPolicy != jetstream.DeliverNewPolicy {
+					t.Errorf("filters/deliver = %q/%v, want [a b]/new", cfg.FilterSubjects, cfg.DeliverPolicy)
+				}
+			},
+		},
+		{name: "missing durable", spec: ConsumerSpec{Stream: "ORDERS"}, wantErr: true},
+		{name: "missing stream", spec: ConsumerSpec{Durable: "billing"}, wantErr: true},
+		{name: "bad deliver policy", spec: ConsumerSpec{Stream: "S", Durable: "d", DeliverPolicy: "sometimes"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.spec.consumerConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("consumerConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// subjectlint.go: Declared vs used subjects of a service
+//
+// A service declares its subjects in its registration: the subjects it
+// serves (Capabilities.Subjects) and, through its dependencies, the ones it
+// requests. ServicePermissions turns that contract into NATS permissions,
+// so a service using anything else breaks once its permissions are scoped.
+// LintSubjects compares the contract with subjects seen at runtime
+// (`wellknown-check --lint-subjects` samples them from the node monitor):
+//
+//	issues := env.LintSubjects(reg, env.ObservedSubjects{
+//	    Subscribed: []string{"acme.api.>", "orders.created"},
+//	    Published:  []string{"acme.billing.charge"},
+//	})
+//	for _, i := range issues { fmt.Println(i) }
+package env
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// InternalSubjects are the subjects the SDK itself uses on a node's
+// connections (replies, JetStream, KV, micro, fleet commands, ...). They
+// need no declaration.
+var InternalSubjects = []string{
+	"_INBOX.>",
+	"$JS.>",
+	"$KV.>",
+	"$O.>",
+	"$SRV.>",
+	"$SYS.>",
+	AccessGrantSubject,
+	AccessRevokeSubject,
+	EnrollSubject,
+	FleetSubject,
+	auditSubjectPrefix + ">",
+	outboxSubjectPrefix + ">",
+	rotationSubjectPrefix + ">",
+	tombstoneSubjectPrefix + ">",
+	usageSubjectPrefix + ">",
+}
+
+// Subject issue kinds
+const (
+	SubjectUndeclaredSubscribe = "undeclared-subscribe" // Subscribed outside the contract
+	SubjectUndeclaredPublish   = "undeclared-publish"   // Published outside the contract
+	SubjectUnused              = "unused-subject"       // Declared as served, never subscribed
+	SubjectUnusedDependency    = "unused-dependency"    // Dependency never requested
+)
+
+// ObservedSubjects are the subjects a service was seen using
+type ObservedSubjects struct {
+	Subscribed []string // Subscriptions (wildcards allowed)
+	Published  []string // Subjects published to
+}
+
+// SubjectIssue is a difference between declared and observed subjects
+type SubjectIssue struct {
+	Kind    string // One of the Subject* kinds
+	Subject string // Observed subject, or declared subject/dependency
+}
+
+func (i SubjectIssue) String() string {
+	switch i.Kind {
+	case SubjectUndeclaredSubscribe:
+		return fmt.Sprintf("subscribes to %s, which is not declared", i.Subject)
+	case SubjectUndeclaredPublish:
+		return fmt.Sprintf("publishes to %s, which is not declared", i.Subject)
+	case SubjectUnused:
+		return fmt.Sprintf("declares %s but does not subscribe to it", i.Subject)
+	case SubjectUnusedDependency:
+		return fmt.Sprintf("depends on %s but sent it nothing", i.Subject)
+	}
+	return i.Kind + " " + i.Subject
+}
+
+// LintSubjects compares the subjects reg declares with the ones observed:
+// observed subjects outside ServicePermissions(reg) and InternalSubjects
+// are undeclared; declared subjects and dependencies nothing observed
+// touches are unused. Issues are sorted by kind, then subject.
+func LintSubjects(reg registry.ServiceRegistration, seen ObservedSubjects) []SubjectIssue {
+	perms := ServicePermissions(reg)
+	pub := append(slices.Clone(perms.Publish), InternalSubjects...)
+	sub := append(slices.Clone(perms.Subscribe), InternalSubjects...)
+
+	var issues []SubjectIssue
+	for _, s := range uniqueSorted(slices.Clone(seen.Subscribed)) {
+		if !subjectCoveredBy(s, sub) {
+			issues = append(issues, SubjectIssue{Kind: SubjectUndeclaredSubscribe, Subject: s})
+		}
+	}
+	for _, s := range uniqueSorted(slices.Clone(seen.Published)) {
+		if !subjectCoveredBy(s, pub) {
+			issues = append(issues, SubjectIssue{Kind: SubjectUndeclaredPublish, Subject: s})
+		}
+	}
+	for _, s := range uniqueSorted(slices.Clone(reg.Capabilities.Subjects)) {
+		if !slices.ContainsFunc(seen.Subscribed, func(o string) bool { return subjectsOverlap(s, o) }) {
+			issues = append(issues, SubjectIssue{Kind: SubjectUnused, Subject: s})
+		}
+	}
+	for _, dep := range uniqueSorted(GetDependencies(reg.Fields)) {
+		ns := ServiceSubject(dep)
+		if !slices.ContainsFunc(seen.Published, func(o string) bool { return subjectsOverlap(ns, o) }) {
+			issues = append(issues, SubjectIssue{Kind: SubjectUnusedDependency, Subject: dep})
+		}
+	}
+
+	slices.SortStableFunc(issues, func(a, b SubjectIssue) int { return strings.Compare(a.Kind, b.Kind) })
+	return issues
+}
+
+// subjectCoveredBy reports whether every subject subject matches is
+// matched by one of patterns
+func subjectCoveredBy(subject string, patterns []string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool { return subjectCovers(p, subject) })
+}
+
+// subjectCovers reports whether pattern matches every subject subject
+// matches (subject may contain wildcards itself)
+func subjectCovers(pattern, subject string) bool {
+	pt, st := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, p := range pt {
+		if p == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) || st[i] == ">" {
+			return false
+		}
+		if p != "*" && p != st[i] {
+			return false
+		}
+	}
+	return len(pt) == len(st)
+}
+
+// subjectsOverlap reports whether some subject matches both a and b
+func subjectsOverlap(a, b string) bool {
+	at, bt := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(at) && i < len(bt); i++ {
+		if at[i] == ">" || bt[i] == ">" {
+			return true
+		}
+		if at[i] != "*" && bt[i] != "*" && at[i] != bt[i] {
+			return false
+		}
+	}
+	return len(at) == len(bt)
+}
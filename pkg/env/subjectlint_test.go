@@ -0,0 +1,84 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestLintSubjects(t *testing.T) {
+	reg := registry.ServiceRegistration{GitHub: registry.GitHubInfo{Org: "acme", Repo: "orders"}}
+	reg.Capabilities.Subjects = []string{"acme.orders.api.>", "orders.legacy"}
+	reg.Fields = []registry.FieldInfo{
+		{EnvKey: "BILLING", Dependency: "acme/billing"},
+		{EnvKey: "STOCK", Dependency: "acme/stock"},
+	}
+
+	issues := LintSubjects(reg, ObservedSubjects{
+		Subscribed: []string{"acme.orders.api.create", "acme.orders.>", "_INBOX.abc.*", FleetSubject, "debug.>"},
+		Published:  []string{"acme.billing.charge", "$JS.API.INFO", "metrics.orders", "metrics.orders"},
+	})
+	want := []SubjectIssue{
+		{Kind: SubjectUndeclaredPublish, Subject: "metrics.orders"},
+		{Kind: SubjectUndeclaredSubscribe, Subject: "debug.>"},
+		{Kind: SubjectUnusedDependency, Subject: "acme/stock"},
+		{Kind: SubjectUnused, Subject: "orders.legacy"},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("LintSubjects() = %v, want %v", issues, want)
+	}
+
+	// Nothing observed: everything declared is unused, nothing undeclared
+	issues = LintSubjects(reg, ObservedSubjects{})
+	if len(issues) != 4 {
+		t.Errorf("LintSubjects() of nothing = %v, want 4 unused", issues)
+	}
+}
+
+func TestSubjectCovers(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.*.eu", true},
+		{"orders.>", "orders", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.>", false},
+		{"orders.*", "orders.created.eu", false},
+		{"orders.created", "orders.*", false},
+		{"*.created", "orders.created", true},
+		{">", ">", true},
+	}
+	for _, tt := range tests {
+		if got := subjectCovers(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("subjectCovers(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestSubjectsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"api.orders.>", "api.orders.create", true},
+		{"api.orders.create", "api.*.create", true},
+		{"api.orders.>", "api.>", true},
+		{"api.orders.>", "api.stock.>", false},
+		{"api.orders", "api.orders.create", false},
+	}
+	for _, tt := range tests {
+		if got := subjectsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("subjectsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSubjectIssueString(t *testing.T) {
+	i := SubjectIssue{Kind: SubjectUnusedDependency, Subject: "acme/stock"}
+	if got := i.String(); got != "depends on acme/stock but sent it nothing" {
+		t.Errorf("String() = %q", got)
+	}
+}
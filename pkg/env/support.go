@@ -0,0 +1,350 @@
+// support.go: Support bundles for bug reports
+//
+// A support bundle is a zip with everything needed to diagnose a service
+// without shell access to its host:
+//
+//	versions.json      Go, module and dependency versions
+//	config.json        Config fields and their sources (secrets redacted)
+//	options.json       Manager options (credentials in URLs redacted)
+//	registration.json  Current service registration
+//	nats.json          Node and connection state
+//	startup.json       Startup timing breakdown (see startup.go)
+//	logs.txt           Recent SDK logs
+//	goroutines.txt     Goroutine dump
+//
+// Write one to a file, or mount the handler on an internal port:
+//
+//	f, _ := os.Create("support.zip")
+//	err := mgr.SupportBundle(f)
+//
+//	mux.Handle("/debug/support-bundle", mgr.SupportBundleHandler())
+package env
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// redacted replaces secret values in support bundles
+const redacted = "[redacted]"
+
+// SupportBundle writes a support bundle zip to w
+func (m *Manager) SupportBundle(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"versions.json", jsonFile(supportVersions())},
+		{"config.json", jsonFile(m.supportConfig())},
+		{"options.json", jsonFile(supportOptions(m.opts))},
+		{"registration.json", jsonFile(m.Registration())},
+		{"nats.json", jsonFile(m.supportNATS())},
+		{"startup.json", jsonFile(m.StartupReport())},
+		{"logs.txt", m.writeRecentLogs},
+		{"goroutines.txt", func(w io.Writer) error {
+			return pprof.Lookup("goroutine").WriteTo(w, 2)
+		}},
+	}
+
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", f.name, err)
+		}
+		if err := f.write(fw); err != nil {
+			return fmt.Errorf("writing %s: %w", f.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing support bundle: %w", err)
+	}
+	return nil
+}
+
+// SupportBundleHandler serves the support bundle as a zip download.
+// It exposes goroutine dumps and config layout, so only mount it on an
+// internal address.
+func (m *Manager) SupportBundleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := fmt.Sprintf("%s-support-%s.zip", strings.ToLower(m.prefix), time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if err := m.SupportBundle(w); err != nil {
+			componentLogger(m.opts.Logger, "support").Warn("support bundle failed", "error", err)
+		}
+	})
+}
+
+// jsonFile returns a writer for v as indented JSON
+func jsonFile(v any) func(io.Writer) error {
+	return func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+}
+
+// supportVersions reports the runtime, module and dependency versions
+func supportVersions() map[string]any {
+	v := map[string]any{
+		"generated":      time.Now().UTC(),
+		"go":             runtime.Version(),
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+		"schema_version": registry.SchemaVersion,
+		"build":          ReadBuildVersion(),
+		"github":         registry.GetGitHubInfo(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		v["main"] = info.Main.Path + "@" + info.Main.Version
+		deps := map[string]string{}
+		for _, dep := range info.Deps {
+			deps[dep.Path] = dep.Version
+		}
+		v["deps"] = deps
+	}
+	return v
+}
+
+// supportField is one config field in a support bundle
+type supportField struct {
+	Path   string       `json:"path"`
+	EnvKey string       `json:"env_key"`
+	Source ConfigSource `json:"source,omitempty"`
+	Value  string       `json:"value"`
+	Secret bool         `json:"secret,omitempty"`
+}
+
+// supportConfig reports the parsed config fields with secrets redacted
+func (m *Manager) supportConfig() []supportField {
+	m.mu.RLock()
+	fields, sources := m.fields, m.sources
+	m.mu.RUnlock()
+	return sanitizeConfig(fields, sources, os.Getenv)
+}
+
+// sanitizeConfig joins fields with their sources and reads their current
+// values, redacting secrets (unset secrets stay empty)
+func sanitizeConfig(fields []registry.FieldInfo, sources []FieldSource, getenv func(string) string) []supportField {
+	bySource := make(map[string]ConfigSource, len(sources))
+	for _, s := range sources {
+		bySource[s.Path] = s.Source
+	}
+
+	out := make([]supportField, 0, len(fields))
+	for _, f := range fields {
+		value := getenv(f.EnvKey)
+		if f.IsSecret && value != "" {
+			value = redacted
+		}
+		out = append(out, supportField{
+			Path:   f.Path,
+			EnvKey: f.EnvKey,
+			Source: bySource[f.Path],
+			Value:  value,
+			Secret: f.IsSecret,
+		})
+	}
+	return out
+}
+
+// supportOptions reports the options that shape the Manager, without
+// credentials embedded in URLs
+func supportOptions(o Options) map[string]any {
+	return map[string]any{
+		"hub_url":            redactURL(o.HubURL),
+		"data_dir":           o.DataDir,
+		"nats_port":          o.NATSPort,
+		"nats_name":          o.NATSName,
+		"ws_addr":            o.WSAddr,
+		"monitor_addr":       o.MonitorAddr,
+		"mqtt_port":          o.MQTT.Port,
+		"outbox":             o.Outbox,
+		"local_store":        o.LocalStore != nil,
+		"jetstream_spec":     o.JetStreamSpec,
+		"export_spec":        o.ExportSpec,
+		"hub_plan":           o.HubPlan,
+		"secret_cache":       o.SecretCache != nil,
+		"secret_policy":      o.SecretFailurePolicy,
+		"secret_sync":        o.SecretSync != nil,
+		"plugins":            pluginNames(o.Plugins),
+		"read_replica":       o.ReadReplica,
+		"lightweight_nats":   o.LightweightNATS,
+		"local_node":         redactURL(o.LocalNode),
+		"socket":             o.Socket,
+		"no_tcp":             o.NoTCP,
+		"client_options":     len(o.ClientOptions),
+		"hub_domain":         o.HubDomain,
+		"js_domain":          o.JetStreamDomain,
+		"cluster_name":       o.Cluster.Name,
+		"cluster_routes":     redactURL(strings.Join(o.Cluster.Routes, ",")),
+		"registration":       !o.DisableRegistration && (!o.DisableNATS || o.RegistryBackend != nil),
+		"registry_backend":   o.RegistryBackend != nil,
+		"heartbeat":          !o.DisableHeartbeat,
+		"heartbeat_interval": o.HeartbeatInterval,
+		"power_profile":      o.PowerProfile,
+		"enrollment":         o.EnrollToken != "",
+		"attestation":        o.Attester != nil,
+		"liveness":           o.Liveness,
+		"advertise_addr":     o.AdvertiseAddr,
+		"gui_addr":           o.GUIAddr,
+		"gui":                !o.DisableGUI,
+		"auth_mode":          o.AuthMode,
+		"config_file":        o.ConfigFile,
+		"kv_overrides":       o.KVOverrides,
+		"usage":              o.EnableUsage,
+		"janitor":            o.Janitor,
+		"metrics_addr":       o.MetricsAddr,
+		"health_addr":        o.HealthAddr,
+		"breakglass_addr":    o.BreakGlassAddr,
+		"breakglass_file":    o.BreakGlassFile,
+		"nats":               !o.DisableNATS,
+	}
+}
+
+// redactURL hides the password or token in a URL's userinfo (each URL of
+// a comma-separated list)
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	if strings.Contains(raw, ",") {
+		parts := strings.Split(raw, ",")
+		for i, part := range parts {
+			parts[i] = redactURL(strings.TrimSpace(part))
+		}
+		return strings.Join(parts, ",")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		if _, hasPassword := u.User.Password(); !hasPassword {
+			u.User = url.User("xxxxx") // Token auth (nats://token@host); same mask as Redacted
+		}
+	}
+	return u.Redacted()
+}
+
+// supportConn is the state of one NATS connection
+type supportConn struct {
+	Connected bool            `json:"connected"`
+	Status    string          `json:"status"`
+	URL       string          `json:"url,omitempty"`
+	Stats     nats.Statistics `json:"stats"`
+}
+
+// supportNATS reports the node and connection state
+func (m *Manager) supportNATS() map[string]any {
+	if m.natsNode == nil {
+		return map[string]any{"enabled": false}
+	}
+
+	n := m.natsNode
+	state := map[string]any{
+		"enabled":       true,
+		"name":          n.Name(),
+		"client_url":    n.ClientURL(),
+		"leaf":          n.IsLeaf(),
+		"hub_connected": n.HubConnected(),
+	}
+	conns := map[string]supportConn{}
+	for lane, nc := range map[string]*nats.Conn{"data": n.Conn(), "control": n.ControlConn()} {
+		if nc == nil {
+			continue
+		}
+		conns[lane] = supportConn{
+			Connected: nc.IsConnected(),
+			Status:    nc.Status().String(),
+			URL:       nc.ConnectedUrlRedacted(),
+			Stats:     nc.Stats(),
+		}
+	}
+	state["connections"] = conns
+	if m.outbox != nil {
+		state["outbox_pending"] = m.outbox.Pending()
+	}
+	return state
+}
+
+// writeRecentLogs writes the captured SDK log lines
+func (m *Manager) writeRecentLogs(w io.Writer) error {
+	if m.recentLogs == nil {
+		return nil
+	}
+	for _, line := range m.recentLogs.Lines() {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// captureLogs returns a logger that writes to l (or slog.Default) and also
+// keeps Info and above in pane for support bundles
+func captureLogs(l *slog.Logger, pane *LogPane) *slog.Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slog.New(teeHandler{
+		primary: l.Handler(),
+		capture: slog.NewTextHandler(pane, &slog.HandlerOptions{Level: slog.LevelInfo}),
+	})
+}
+
+// teeHandler sends each record to both handlers, each filtered by its own level
+type teeHandler struct {
+	primary slog.Handler
+	capture slog.Handler
+}
+
+// Enabled implements slog.Handler
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return t.primary.Enabled(ctx, level) || t.capture.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	if t.capture.Enabled(ctx, r.Level) {
+		_ = t.capture.Handle(ctx, r.Clone()) // Capturing must never fail the caller's log
+	}
+	if t.primary.Enabled(ctx, r.Level) {
+		return t.primary.Handle(ctx, r)
+	}
+	return nil
+}
+
+// WithAttrs implements slog.Handler
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return teeHandler{primary: t.primary.WithAttrs(attrs), capture: t.capture.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	return teeHandler{primary: t.primary.WithGroup(name), capture: t.capture.WithGroup(name)}
+}
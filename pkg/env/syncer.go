@@ -0,0 +1,403 @@
+// syncer.go: Upload of offline-collected files to the hub
+//
+// Edge nodes collect data (sensor readings, images) while the hub may be
+// out of reach. A Syncer watches a directory and uploads each finished file
+// to an object store on the hub whenever the hub is connected:
+//
+//	s, _ := mgr.StartSyncer(env.SyncConfig{Dir: "/var/lib/sensor/out", Prefix: "sensor-7"})
+//	s.Progress() // Pending and uploaded files and bytes, last error
+//
+// Files land as {Prefix}/{path relative to Dir} in the "collected" bucket
+// (the object store chunks them). A file is uploaded once it has not been
+// modified for Settle, then removed (or remembered, with Keep). Uploads
+// resume file by file: a file cut off by a disconnect is sent again on
+// the next pass, and a file already on the hub with the same digest (a
+// crash between upload and removal) is not sent twice.
+//
+// For message streams rather than files, use the Outbox.
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultSyncBucket is the hub object store receiving collected files
+const DefaultSyncBucket = "collected"
+
+// Syncer defaults
+const (
+	DefaultSyncPoll   = 5 * time.Second
+	DefaultSyncSettle = 2 * time.Second
+)
+
+// SyncConfig configures a Syncer
+type SyncConfig struct {
+	Dir    string        // Directory of collected files (required)
+	Bucket string        // Hub object store ("" = DefaultSyncBucket)
+	Prefix string        // Object name prefix, e.g. the node name ("" = none)
+	Poll   time.Duration // How often Dir is scanned (0 = DefaultSyncPoll)
+	Settle time.Duration // Quiet time before a file counts as finished (0 = DefaultSyncSettle)
+	Keep   bool          // Keep files after upload instead of removing them
+
+	// OnProgress is called after each upload and each pass (optional)
+	OnProgress func(SyncProgress)
+}
+
+// SyncProgress is a snapshot of a Syncer's work
+type SyncProgress struct {
+	PendingFiles  int       // Finished files not yet uploaded
+	PendingBytes  int64     // Their total size
+	UploadedFiles int       // Files uploaded since the syncer was created
+	UploadedBytes int64     // Their total size
+	Current       string    // Object being uploaded ("" = idle)
+	LastSync      time.Time // End of the last complete pass
+	LastErr       error     // Error of the last pass (nil = ok)
+}
+
+// SyncStore is the part of jetstream.ObjectStore a Syncer uses
+type SyncStore interface {
+	GetInfo(ctx context.Context, name string, opts ...jetstream.GetObjectInfoOpt) (*jetstream.ObjectInfo, error)
+	Put(ctx context.Context, obj jetstream.ObjectMeta, reader io.Reader) (*jetstream.ObjectInfo, error)
+}
+
+// Syncer uploads files from a local directory to a hub object store
+type Syncer struct {
+	cfg    SyncConfig
+	store  SyncStore
+	online func() bool
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	progress SyncProgress
+	sent     map[string]syncedFile // Uploaded and kept (Keep mode)
+
+	passMu sync.Mutex  // One pass at a time
+	paused atomic.Bool // Background passes skipped (maintenance)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// syncedFile identifies the version of a file that was uploaded
+type syncedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewSyncer returns a syncer uploading to store while online reports the
+// hub reachable (nil = always). Call Start to run it in the background or
+// Sync for a single pass. A nil logger uses slog.Default.
+func NewSyncer(store SyncStore, cfg SyncConfig, online func() bool, logger *slog.Logger) *Syncer {
+	if cfg.Poll == 0 {
+		cfg.Poll = DefaultSyncPoll
+	}
+	if cfg.Settle == 0 {
+		cfg.Settle = DefaultSyncSettle
+	}
+	if online == nil {
+		online = func() bool { return true }
+	}
+	return &Syncer{
+		cfg:    cfg,
+		store:  store,
+		online: online,
+		logger: componentLogger(logger, "syncer"),
+		sent:   make(map[string]syncedFile),
+	}
+}
+
+// Progress returns the current progress
+func (s *Syncer) Progress() SyncProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.progress
+}
+
+// Start scans and uploads every Poll until Stop
+func (s *Syncer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.cfg.Poll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !s.online() || s.paused.Load() {
+					continue
+				}
+				if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+					s.logger.Warn("sync pass failed", "dir", s.cfg.Dir, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// SetPaused pauses or resumes the background passes; Sync still runs
+func (s *Syncer) SetPaused(paused bool) {
+	s.paused.Store(paused)
+}
+
+// Stop stops the background loop, abandoning an upload in progress (it
+// is sent again on the next start)
+func (s *Syncer) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+}
+
+// Sync uploads every finished file once, stopping at the first error or
+// when the hub goes offline
+func (s *Syncer) Sync(ctx context.Context) error {
+	s.passMu.Lock()
+	defer s.passMu.Unlock()
+
+	files, err := s.scan(time.Now())
+	if err == nil {
+		for _, f := range files {
+			if !s.online() {
+				err = errHubDisconnected
+				break
+			}
+			if err = s.upload(ctx, f); err != nil {
+				break
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.progress.Current = ""
+	s.progress.LastErr = err
+	if err == nil {
+		s.progress.LastSync = time.Now()
+	}
+	s.mu.Unlock()
+	s.report()
+	return err
+}
+
+// syncFile is a finished file waiting for upload
+type syncFile struct {
+	path string // On disk
+	name string // Object name
+	syncedFile
+}
+
+// scan lists finished files not yet uploaded, oldest first, and updates
+// the pending counts
+func (s *Syncer) scan(now time.Time) ([]syncFile, error) {
+	var files []syncFile
+	err := filepath.WalkDir(s.cfg.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil // Hidden files are partial writes by convention
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if now.Sub(info.ModTime()) < s.cfg.Settle {
+			return nil
+		}
+		rel, err := filepath.Rel(s.cfg.Dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, syncFile{
+			path:       p,
+			name:       path.Join(s.cfg.Prefix, filepath.ToSlash(rel)),
+			syncedFile: syncedFile{size: info.Size(), modTime: info.ModTime()},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", s.cfg.Dir, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := files[:0]
+	var bytes int64
+	for _, f := range files {
+		if s.sent[f.path] == f.syncedFile {
+			continue
+		}
+		pending = append(pending, f)
+		bytes += f.size
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].modTime.Before(pending[j].modTime) })
+	s.progress.PendingFiles = len(pending)
+	s.progress.PendingBytes = bytes
+	return pending, nil
+}
+
+// upload sends one file unless the hub already has it, then removes or
+// remembers it
+func (s *Syncer) upload(ctx context.Context, f syncFile) error {
+	s.mu.Lock()
+	s.progress.Current = f.name
+	s.mu.Unlock()
+
+	digest, err := fileDigest(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := s.store.GetInfo(ctx, f.name)
+	if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+		return fmt.Errorf("checking %s: %w", f.name, err)
+	}
+	if err != nil || info.Digest != digest {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", f.path, err)
+		}
+		_, err = s.store.Put(ctx, jetstream.ObjectMeta{Name: f.name}, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("uploading %s: %w", f.name, err)
+		}
+	}
+
+	if s.cfg.Keep {
+		s.mu.Lock()
+		s.sent[f.path] = f.syncedFile
+		s.mu.Unlock()
+	} else if err := os.Remove(f.path); err != nil {
+		return fmt.Errorf("removing uploaded %s: %w", f.path, err)
+	}
+
+	s.mu.Lock()
+	s.progress.PendingFiles--
+	s.progress.PendingBytes -= f.size
+	s.progress.UploadedFiles++
+	s.progress.UploadedBytes += f.size
+	s.mu.Unlock()
+	s.report()
+	return nil
+}
+
+// report passes the progress to OnProgress
+func (s *Syncer) report() {
+	if s.cfg.OnProgress != nil {
+		s.cfg.OnProgress(s.Progress())
+	}
+}
+
+// fileDigest returns the SHA-256 of a file in the object store's format
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", p, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading %s: %w", p, err)
+	}
+	return "SHA-256=" + base64.URLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// StartSyncer starts a Syncer uploading to the sync bucket on the hub (in
+// NATS_HUB_DOMAIN, if set) while the hub is connected. The bucket is
+// opened on the first upload, so leaves may start offline. Close stops it.
+func (m *Manager) StartSyncer(cfg SyncConfig) (*Syncer, error) {
+	if m.natsNode == nil {
+		return nil, fmt.Errorf("syncer needs NATS")
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("syncer needs a directory")
+	}
+	if cfg.Bucket == "" {
+		cfg.Bucket = DefaultSyncBucket
+	}
+
+	// Uploads are bulk traffic: they use the data connection, so they
+	// never hold up heartbeats on the control one
+	js, err := m.HubJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	online := func() bool { return true }
+	if m.natsNode.IsLeaf() {
+		online = m.natsNode.HubConnected
+	}
+	s := NewSyncer(&hubObjectStore{js: js, bucket: cfg.Bucket}, cfg, online, m.opts.Logger)
+
+	m.mu.Lock()
+	s.SetPaused(m.maintenance != nil)
+	m.syncers = append(m.syncers, s)
+	m.mu.Unlock()
+	s.Start()
+	return s, nil
+}
+
+// hubObjectStore opens an object store on first use
+type hubObjectStore struct {
+	js     jetstream.JetStream
+	bucket string
+
+	mu    sync.Mutex
+	store jetstream.ObjectStore
+}
+
+// open returns the store, creating the bucket if needed
+func (h *hubObjectStore) open(ctx context.Context) (jetstream.ObjectStore, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.store != nil {
+		return h.store, nil
+	}
+	store, err := h.js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:      h.bucket,
+		Description: "Files collected on edge nodes",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening sync bucket %s: %w", h.bucket, err)
+	}
+	h.store = store
+	return store, nil
+}
+
+func (h *hubObjectStore) GetInfo(ctx context.Context, name string, opts ...jetstream.GetObjectInfoOpt) (*jetstream.ObjectInfo, error) {
+	store, err := h.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetInfo(ctx, name, opts...)
+}
+
+func (h *hubObjectStore) Put(ctx context.Context, obj jetstream.ObjectMeta, reader io.Reader) (*jetstream.ObjectInfo, error) {
+	store, err := h.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.Put(ctx, obj, reader)
+}
@@ -0,0 +1,171 @@
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// memObjects is an in-memory SyncStore
+type memObjects struct {
+	objects map[string][]byte
+	puts    int
+	failPut error
+}
+
+func (m *memObjects) GetInfo(ctx context.Context, name string, opts ...jetstream.GetObjectInfoOpt) (*jetstream.ObjectInfo, error) {
+	data, ok := m.objects[name]
+	if !ok {
+		return nil, jetstream.ErrObjectNotFound
+	}
+	sum := sha256.Sum256(data)
+	return &jetstream.ObjectInfo{
+		ObjectMeta: jetstream.ObjectMeta{Name: name},
+		Size:       uint64(len(data)),
+		Digest:     "SHA-256=" + base64.URLEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+func (m *memObjects) Put(ctx context.Context, obj jetstream.ObjectMeta, r io.Reader) (*jetstream.ObjectInfo, error) {
+	if m.failPut != nil {
+		return nil, m.failPut
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m.puts++
+	m.objects[obj.Name] = data
+	return m.GetInfo(ctx, obj.Name)
+}
+
+// writeCollected writes a finished (settled) file under dir
+func writeCollected(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSyncerUploadsWhenOnline(t *testing.T) {
+	dir := t.TempDir()
+	a := writeCollected(t, dir, "a.csv", "1,2,3")
+	b := writeCollected(t, dir, "day1/b.csv", "4,5")
+	if err := os.WriteFile(filepath.Join(dir, "fresh.csv"), []byte("still writing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeCollected(t, dir, ".partial", "hidden")
+
+	store := &memObjects{objects: map[string][]byte{}}
+	online := false
+	var reports int
+	s := NewSyncer(store, SyncConfig{Dir: dir, Prefix: "sensor-7", OnProgress: func(SyncProgress) { reports++ }},
+		func() bool { return online }, nil)
+
+	// Offline: nothing moves
+	if err := s.Sync(context.Background()); !errors.Is(err, errHubDisconnected) {
+		t.Fatalf("offline Sync() error = %v, want errHubDisconnected", err)
+	}
+	if p := s.Progress(); p.PendingFiles != 2 || p.PendingBytes != 8 || p.UploadedFiles != 0 {
+		t.Errorf("offline progress = %+v, want 2 files / 8 bytes pending", p)
+	}
+
+	online = true
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if string(store.objects["sensor-7/a.csv"]) != "1,2,3" || string(store.objects["sensor-7/day1/b.csv"]) != "4,5" {
+		t.Errorf("objects = %v", store.objects)
+	}
+	if len(store.objects) != 2 {
+		t.Errorf("uploaded %d objects, want 2 (fresh and hidden files wait)", len(store.objects))
+	}
+	for _, p := range []string{a, b} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s not removed after upload", p)
+		}
+	}
+	p := s.Progress()
+	if p.PendingFiles != 0 || p.UploadedFiles != 2 || p.UploadedBytes != 8 || p.LastErr != nil || p.LastSync.IsZero() {
+		t.Errorf("progress = %+v", p)
+	}
+	if reports == 0 {
+		t.Error("OnProgress never called")
+	}
+}
+
+func TestSyncerResumes(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCollected(t, dir, "a.csv", "1,2,3")
+	store := &memObjects{objects: map[string][]byte{}, failPut: errors.New("connection lost")}
+	s := NewSyncer(store, SyncConfig{Dir: dir}, nil, nil)
+
+	// A failed upload keeps the file for the next pass
+	if err := s.Sync(context.Background()); err == nil {
+		t.Fatal("Sync() with failing store succeeded")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file lost after failed upload: %v", err)
+	}
+	if s.Progress().LastErr == nil {
+		t.Error("LastErr not set")
+	}
+
+	// Already on the hub with the same digest: removed without a new upload
+	store.failPut = nil
+	store.objects["a.csv"] = []byte("1,2,3")
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if store.puts != 0 {
+		t.Errorf("puts = %d, want 0", store.puts)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file not removed")
+	}
+}
+
+func TestSyncerKeep(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCollected(t, dir, "a.csv", "1")
+	store := &memObjects{objects: map[string][]byte{}}
+	s := NewSyncer(store, SyncConfig{Dir: dir, Keep: true}, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		if err := s.Sync(context.Background()); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+	}
+	if store.puts != 1 {
+		t.Errorf("puts = %d, want 1", store.puts)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("kept file missing: %v", err)
+	}
+
+	// A changed file is sent again
+	writeCollected(t, dir, "a.csv", "12")
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if store.puts != 2 || string(store.objects["a.csv"]) != "12" {
+		t.Errorf("puts = %d, object = %q; want the new version", store.puts, store.objects["a.csv"])
+	}
+}
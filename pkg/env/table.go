@@ -0,0 +1,368 @@
+// table.go: Reusable sortable, filterable table for Via pages
+//
+// A Table keeps its view state (sort column and direction, filter text and
+// hidden columns) on the server, per page context, so the browser only
+// sends clicks and the filter text. Clicking a header sorts by that column
+// (again to reverse), the filter narrows rows by case-insensitive substring
+// over the visible cells, and the "Columns" menu toggles column visibility.
+//
+// On narrow viewports (phones) rows are shown as cards instead of a wide
+// table; SetCompact(true) forces the card layout everywhere.
+//
+// Create the table once per page context and render it from the view:
+//
+//	v.Page("/things", func(c *via.Context) {
+//	    table := env.NewTable(c,
+//	        env.Column{Key: "name", Title: "Name"},
+//	        env.Column{Key: "count", Title: "Count", Numeric: true},
+//	    )
+//	    c.View(func() h.H {
+//	        var rows []env.TableRow
+//	        for _, t := range things {
+//	            rows = append(rows, env.TableRow{
+//	                env.TextCell(t.Name),
+//	                env.NumCell(float64(t.Count), h.Textf("%d", t.Count)),
+//	            })
+//	        }
+//	        return table.Render(rows)
+//	    })
+//	})
+package env
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-via/via"
+	"github.com/go-via/via/h"
+)
+
+// Column describes a table column
+type Column struct {
+	Key     string // Stable identifier
+	Title   string // Header text
+	Numeric bool   // Sort by Cell.Num instead of Cell.Text
+	Hidden  bool   // Hidden until enabled in the Columns menu
+	NoSort  bool   // Header is not clickable (e.g. action buttons)
+}
+
+// Cell is one table cell. Text is used for filtering and sorting;
+// Node, if set, is rendered instead of Text.
+type Cell struct {
+	Text string
+	Num  float64
+	Node h.H
+}
+
+// TableRow is one row of cells, in column order
+type TableRow []Cell
+
+// TextCell returns a plain text cell
+func TextCell(text string) Cell {
+	return Cell{Text: text}
+}
+
+// NodeCell returns a cell rendered as node and filtered/sorted by text
+func NodeCell(text string, node h.H) Cell {
+	return Cell{Text: text, Node: node}
+}
+
+// NumCell returns a numeric cell rendered as node (nil = the number)
+func NumCell(n float64, node h.H) Cell {
+	return Cell{Text: strconv.FormatFloat(n, 'f', -1, 64), Num: n, Node: node}
+}
+
+// Table renders rows with server-side sorting, filtering and column selection
+type Table struct {
+	columns []Column
+	state   *tableState
+
+	id          string // Stable element id prefix (for focus retention)
+	filterInput h.H    // bound search input
+	sortClick   []h.H  // per column
+	sortKey     []h.H  // per column (Enter on a focused header)
+	toggleClick []h.H  // per column
+	compact     bool   // Always render cards
+}
+
+// compactBreakpoint is the viewport width below which cards replace the table
+const compactBreakpoint = "640px"
+
+// tableCSS switches between the table and card layouts by viewport width
+const tableCSS = `.wn-cards{display:none}
+@media (max-width:` + compactBreakpoint + `){.wn-wide{display:none}.wn-cards{display:block}}
+.wn-cards article{margin-bottom:var(--pico-spacing,1rem)}
+.wn-cards dl{margin:0}.wn-cards dt{font-size:.8em;opacity:.7}.wn-cards dd{margin:0 0 .5em}`
+
+// NewTable creates a table bound to a page context
+func NewTable(c *via.Context, columns ...Column) *Table {
+	keys := make([]string, len(columns))
+	for i, col := range columns {
+		keys[i] = col.Key
+	}
+	t := &Table{
+		columns: columns,
+		state:   newTableState(columns),
+		id:      "table-" + strings.Join(keys, "-"),
+	}
+
+	filter := c.Signal("")
+	t.filterInput = h.Input(h.ID(t.id+"-filter"), h.Type("search"), h.Placeholder("Filter"),
+		AriaLabel("Filter rows"),
+		filter.Bind(),
+		c.Action(func() {
+			t.state.setFilter(filter.String())
+			c.Sync()
+		}).OnChange(),
+	)
+
+	for i := range columns {
+		sortAction := c.Action(func() {
+			t.state.toggleSort(i)
+			c.Sync()
+		})
+		t.sortClick = append(t.sortClick, sortAction.OnClick())
+		t.sortKey = append(t.sortKey, sortAction.OnKeyDown("Enter"))
+		t.toggleClick = append(t.toggleClick, c.Action(func() {
+			t.state.toggleColumn(i)
+			c.Sync()
+		}).OnClick())
+	}
+
+	return t
+}
+
+// SetCompact forces the card layout regardless of viewport width
+func (t *Table) SetCompact(compact bool) *Table {
+	t.compact = compact
+	return t
+}
+
+// Render renders the toolbar and the filtered, sorted table
+func (t *Table) Render(rows []TableRow) h.H {
+	visible, shown := t.state.apply(t.columns, rows)
+	sortCol, desc := t.state.sorting()
+
+	var headers []h.H
+	for _, i := range visible {
+		col := t.columns[i]
+		if col.NoSort {
+			headers = append(headers, h.Th(h.Text(col.Title)))
+			continue
+		}
+		title, ariaSort := col.Title, "none"
+		if i == sortCol {
+			if desc {
+				title, ariaSort = title+" ▼", "descending"
+			} else {
+				title, ariaSort = title+" ▲", "ascending"
+			}
+		}
+		headers = append(headers, h.Th(h.ID(t.id+"-sort-"+col.Key), h.Style("cursor:pointer"),
+			h.Attr("tabindex", "0"), h.Attr("aria-sort", ariaSort), AriaLabel("Sort by "+col.Title),
+			t.sortClick[i], t.sortKey[i],
+			h.Text(title),
+		))
+	}
+
+	var body, cards []h.H
+	for _, row := range shown {
+		var cells []h.H
+		for _, i := range visible {
+			cells = append(cells, h.Td(row.cell(i).render()))
+		}
+		body = append(body, h.Tr(cells...))
+		cards = append(cards, t.renderCard(row, visible))
+	}
+
+	var toggles []h.H
+	for i, col := range t.columns {
+		var checked h.H
+		if !t.state.isHidden(i) {
+			checked = h.Attr("checked")
+		}
+		toggles = append(toggles, h.Li(h.Label(
+			h.Input(h.ID(t.id+"-col-"+col.Key), h.Type("checkbox"), checked, t.toggleClick[i]),
+			h.Text(col.Title),
+		)))
+	}
+
+	toolbar := h.Div(h.Class("grid"),
+		t.filterInput,
+		h.Details(h.Class("dropdown"),
+			h.Summary(h.Text("Columns")),
+			h.Ul(toggles...),
+		),
+	)
+	count := LiveRegion(true, h.Small(h.Textf("Showing %d of %d", len(shown), len(rows))))
+
+	if t.compact {
+		return h.Div(toolbar, h.Div(cards...), count)
+	}
+
+	return h.Div(
+		h.StyleEl(h.Raw(tableCSS)),
+		toolbar,
+		h.Figure(h.Class("wn-wide"), h.Table(h.Role("grid"),
+			h.THead(h.Tr(headers...)),
+			h.TBody(body...),
+		)),
+		h.Div(append([]h.H{h.Class("wn-cards")}, cards...)...),
+		count,
+	)
+}
+
+// renderCard renders a row as a card: the first visible cell as its
+// header, the remaining cells as labelled values
+func (t *Table) renderCard(row TableRow, visible []int) h.H {
+	if len(visible) == 0 {
+		return h.Article()
+	}
+
+	var items []h.H
+	for _, i := range visible[1:] {
+		items = append(items,
+			h.Dt(h.Text(t.columns[i].Title)),
+			h.Dd(row.cell(i).render()),
+		)
+	}
+	return h.Article(
+		h.Header(row.cell(visible[0]).render()),
+		h.Dl(items...),
+	)
+}
+
+// cell returns the cell at i, or an empty cell for short rows
+func (r TableRow) cell(i int) Cell {
+	if i < len(r) {
+		return r[i]
+	}
+	return Cell{}
+}
+
+// render returns the cell's node, falling back to its text
+func (c Cell) render() h.H {
+	if c.Node != nil {
+		return c.Node
+	}
+	return h.Text(c.Text)
+}
+
+// tableState is the server-side view state of a Table
+type tableState struct {
+	mu      sync.Mutex
+	sortCol int // -1 = input order
+	desc    bool
+	filter  string
+	hidden  map[int]bool
+}
+
+// newTableState returns an unsorted, unfiltered state honoring Column.Hidden
+func newTableState(columns []Column) *tableState {
+	s := &tableState{sortCol: -1, hidden: make(map[int]bool)}
+	for i, col := range columns {
+		if col.Hidden {
+			s.hidden[i] = true
+		}
+	}
+	return s
+}
+
+// toggleSort sorts by col ascending, or reverses if already sorted by col
+func (s *tableState) toggleSort(col int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sortCol == col {
+		s.desc = !s.desc
+		return
+	}
+	s.sortCol = col
+	s.desc = false
+}
+
+// toggleColumn shows or hides col
+func (s *tableState) toggleColumn(col int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hidden[col] {
+		delete(s.hidden, col)
+	} else {
+		s.hidden[col] = true
+	}
+}
+
+// setFilter sets the row filter text
+func (s *tableState) setFilter(filter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = strings.TrimSpace(filter)
+}
+
+// isHidden reports whether col is hidden
+func (s *tableState) isHidden(col int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hidden[col]
+}
+
+// sorting returns the sort column and direction
+func (s *tableState) sorting() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortCol, s.desc
+}
+
+// apply returns the visible column indexes and the filtered, sorted rows.
+// If every column is hidden, all columns are shown.
+func (s *tableState) apply(columns []Column, rows []TableRow) ([]int, []TableRow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var visible []int
+	for i := range columns {
+		if !s.hidden[i] {
+			visible = append(visible, i)
+		}
+	}
+	if len(visible) == 0 {
+		for i := range columns {
+			visible = append(visible, i)
+		}
+	}
+
+	needle := strings.ToLower(s.filter)
+	out := make([]TableRow, 0, len(rows))
+	for _, row := range rows {
+		if needle == "" || row.matches(visible, needle) {
+			out = append(out, row)
+		}
+	}
+
+	if s.sortCol >= 0 && s.sortCol < len(columns) {
+		col, numeric, desc := s.sortCol, columns[s.sortCol].Numeric, s.desc
+		sort.SliceStable(out, func(i, j int) bool {
+			a, b := out[i].cell(col), out[j].cell(col)
+			if desc {
+				a, b = b, a
+			}
+			if numeric {
+				return a.Num < b.Num
+			}
+			return strings.ToLower(a.Text) < strings.ToLower(b.Text)
+		})
+	}
+
+	return visible, out
+}
+
+// matches reports whether any visible cell contains needle (lowercase)
+func (r TableRow) matches(visible []int, needle string) bool {
+	for _, i := range visible {
+		if strings.Contains(strings.ToLower(r.cell(i).Text), needle) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableStateApply(t *testing.T) {
+	columns := []Column{
+		{Key: "name", Title: "Name"},
+		{Key: "count", Title: "Count", Numeric: true},
+		{Key: "owner", Title: "Owner", Hidden: true},
+	}
+	rows := []TableRow{
+		{TextCell("beta"), NumCell(10, nil), TextCell("ops")},
+		{TextCell("Alpha"), NumCell(2, nil), TextCell("dev")},
+		{TextCell("gamma"), NumCell(7, nil), TextCell("dev")},
+	}
+
+	tests := []struct {
+		name        string
+		setup       func(s *tableState)
+		wantVisible []int
+		wantNames   string
+	}{
+		{
+			name:        "input order, hidden column excluded",
+			setup:       func(s *tableState) {},
+			wantVisible: []int{0, 1},
+			wantNames:   "beta,Alpha,gamma",
+		},
+		{
+			name:        "sort text case-insensitive",
+			setup:       func(s *tableState) { s.toggleSort(0) },
+			wantVisible: []int{0, 1},
+			wantNames:   "Alpha,beta,gamma",
+		},
+		{
+			name:        "sort numeric descending",
+			setup:       func(s *tableState) { s.toggleSort(1); s.toggleSort(1) },
+			wantVisible: []int{0, 1},
+			wantNames:   "beta,gamma,Alpha",
+		},
+		{
+			name:        "filter visible cells",
+			setup:       func(s *tableState) { s.setFilter(" ALP ") },
+			wantVisible: []int{0, 1},
+			wantNames:   "Alpha",
+		},
+		{
+			name:        "filter ignores hidden cells",
+			setup:       func(s *tableState) { s.setFilter("dev") },
+			wantVisible: []int{0, 1},
+			wantNames:   "",
+		},
+		{
+			name:        "shown column is filterable",
+			setup:       func(s *tableState) { s.toggleColumn(2); s.setFilter("dev") },
+			wantVisible: []int{0, 1, 2},
+			wantNames:   "Alpha,gamma",
+		},
+		{
+			name: "all hidden shows all",
+			setup: func(s *tableState) {
+				s.toggleColumn(0)
+				s.toggleColumn(1)
+			},
+			wantVisible: []int{0, 1, 2},
+			wantNames:   "beta,Alpha,gamma",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTableState(columns)
+			tt.setup(s)
+
+			visible, out := s.apply(columns, rows)
+			if len(visible) != len(tt.wantVisible) {
+				t.Fatalf("visible = %v, want %v", visible, tt.wantVisible)
+			}
+			for i := range visible {
+				if visible[i] != tt.wantVisible[i] {
+					t.Errorf("visible = %v, want %v", visible, tt.wantVisible)
+					break
+				}
+			}
+
+			var names []string
+			for _, row := range out {
+				names = append(names, row[0].Text)
+			}
+			if got := strings.Join(names, ","); got != tt.wantNames {
+				t.Errorf("rows = %q, want %q", got, tt.wantNames)
+			}
+		})
+	}
+}
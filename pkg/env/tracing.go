@@ -0,0 +1,53 @@
+// tracing.go: OpenTelemetry spans for Manager lifecycle and NATS operations
+//
+// Spans are emitted for Parse and its steps (config sources, secret
+// resolution, conf parsing, validation, registration), registry KV writes
+// (including heartbeats) and discovery calls. Use WithTracerProvider to
+// send them somewhere; otherwise the global provider is used (a no-op
+// unless the application installed one with otel.SetTracerProvider).
+//
+// Span names:
+//
+//	env.Parse
+//	env.ConfigSources
+//	env.ResolveSecrets
+//	env.ParseConfig
+//	env.Validate
+//	env.Register
+//	env.registry.Put / env.registry.Delete
+//	env.GetService / env.GetAllServices
+package env
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope for SDK spans
+const tracerName = "github.com/joeblew999/wellnown-env/pkg/env"
+
+// newTracer returns a tracer from tp, falling back to the global provider
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// startSpan starts a span with optional attributes
+func startSpan(ctx context.Context, tracer trace.Tracer, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err (if any) on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,124 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingTracer returns a tracer whose finished spans land in the recorder
+func recordingTracer(t *testing.T) (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return rec, tp
+}
+
+// spanAttr returns the value of one span attribute
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestStartEndSpan(t *testing.T) {
+	rec, tp := recordingTracer(t)
+	tracer := newTracer(tp)
+
+	_, span := startSpan(context.Background(), tracer, "env.ok", attribute.String("env.service", "acme/orders"))
+	endSpan(span, nil)
+	_, span = startSpan(context.Background(), tracer, "env.fail")
+	endSpan(span, errors.New("kv unavailable"))
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+
+	ok, fail := spans[0], spans[1]
+	if ok.Name() != "env.ok" || fail.Name() != "env.fail" {
+		t.Errorf("span names = %q, %q", ok.Name(), fail.Name())
+	}
+	if ok.InstrumentationScope().Name != tracerName {
+		t.Errorf("scope = %q, want %q", ok.InstrumentationScope().Name, tracerName)
+	}
+	if v, found := spanAttr(ok, "env.service"); !found || v.AsString() != "acme/orders" {
+		t.Errorf("env.service = %v (found %v), want acme/orders", v.AsString(), found)
+	}
+	if ok.Status().Code != codes.Unset || len(ok.Events()) != 0 {
+		t.Errorf("successful span status = %v with %d events, want unset and none", ok.Status().Code, len(ok.Events()))
+	}
+
+	if fail.Status().Code != codes.Error || fail.Status().Description != "kv unavailable" {
+		t.Errorf("failed span status = %v %q, want error %q", fail.Status().Code, fail.Status().Description, "kv unavailable")
+	}
+	if events := fail.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("failed span events = %+v, want one exception", events)
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	oldArgs := os.Args
+	os.Args = []string{"app"}
+	t.Cleanup(func() { os.Args = oldArgs })
+
+	rec, tp := recordingTracer(t)
+	m, err := New("TRACE", WithoutNATS(), WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+
+	type config struct {
+		Token string `conf:"required"`
+	}
+	t.Setenv("TRACE_TOKEN", "")
+	os.Unsetenv("TRACE_TOKEN")
+	if _, err := m.Parse(&config{}); err == nil {
+		t.Fatal("Parse() without a required field succeeded")
+	}
+
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range rec.Ended() {
+		byName[span.Name()] = span
+	}
+	parse, ok := byName["env.Parse"]
+	if !ok {
+		t.Fatal("no env.Parse span")
+	}
+	if v, _ := spanAttr(parse, "env.prefix"); v.AsString() != "TRACE" {
+		t.Errorf("env.prefix = %q, want TRACE", v.AsString())
+	}
+	if parse.Status().Code != codes.Error {
+		t.Errorf("env.Parse status = %v, want error", parse.Status().Code)
+	}
+
+	for _, name := range []string{"env.ConfigSources", "env.ResolveSecrets", "env.ParseConfig"} {
+		step, ok := byName[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if step.Parent().SpanID() != parse.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of env.Parse", name)
+		}
+	}
+	if got := byName["env.ConfigSources"].Status().Code; got != codes.Unset {
+		t.Errorf("env.ConfigSources status = %v, want unset", got)
+	}
+	if got := byName["env.ParseConfig"].Status().Code; got != codes.Error {
+		t.Errorf("env.ParseConfig status = %v, want error", got)
+	}
+	if _, ok := byName["env.Validate"]; ok {
+		t.Error("env.Validate ran after a parse error")
+	}
+}
@@ -0,0 +1,256 @@
+// typedkv.go: Generic typed view over a KV bucket
+//
+// TypedKV[T] decodes entries into T so callers stop repeating the
+// Keys/Get/json.Unmarshal loop:
+//
+//	settings := env.NewTypedKV[Settings](kv)
+//	all, _ := settings.List(ctx, "ui.")
+//
+// The decoder is pluggable. KV entries can't carry NATS headers, so the
+// schema version travels in the payload; the registry uses registry.Decode,
+// which reads the "version" field and upgrades older schemas:
+//
+//	regs := env.NewTypedKV(kv, env.WithDecoder(registry.Decode))
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// TypedKV reads and writes values of type T in a KV bucket
+type TypedKV[T any] struct {
+	kv     jetstream.KeyValue
+	decode func([]byte) (T, error)
+	logger *slog.Logger
+	write  WritePolicy
+}
+
+// TypedKVOption configures a TypedKV
+type TypedKVOption[T any] func(*TypedKV[T])
+
+// WithDecoder replaces the default JSON decoder (e.g. registry.Decode)
+func WithDecoder[T any](decode func([]byte) (T, error)) TypedKVOption[T] {
+	return func(t *TypedKV[T]) {
+		t.decode = decode
+	}
+}
+
+// WithPutPolicy sets the timeout and retries of Put
+func WithPutPolicy[T any](p WritePolicy) TypedKVOption[T] {
+	return func(t *TypedKV[T]) {
+		t.write = p
+	}
+}
+
+// NewTypedKV wraps kv; values are JSON unless WithDecoder is given
+func NewTypedKV[T any](kv jetstream.KeyValue, opts ...TypedKVOption[T]) *TypedKV[T] {
+	t := &TypedKV[T]{
+		kv:     kv,
+		decode: decodeJSON[T],
+		logger: componentLogger(nil, "kv"),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// decodeJSON is the default decoder
+func decodeJSON[T any](data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// SetLogger sets the logger for skipped entries
+func (t *TypedKV[T]) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// Get returns the value of key and its revision
+func (t *TypedKV[T]) Get(ctx context.Context, key string) (T, uint64, error) {
+	var zero T
+	entry, err := t.kv.Get(ctx, key)
+	if err != nil {
+		return zero, 0, fmt.Errorf("getting %s: %w", key, err)
+	}
+	v, err := t.decode(entry.Value())
+	if err != nil {
+		return zero, 0, fmt.Errorf("decoding %s: %w", key, err)
+	}
+	return v, entry.Revision(), nil
+}
+
+// Put stores v as JSON under key and returns the new revision
+func (t *TypedKV[T]) Put(ctx context.Context, key string, v T) (uint64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s: %w", key, err)
+	}
+	var rev uint64
+	err = t.write.do(ctx, "put", key, func(ctx context.Context) error {
+		rev, err = t.kv.Put(ctx, key, data)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("putting %s: %w", key, err)
+	}
+	return rev, nil
+}
+
+// List returns the values of all keys starting with prefix (empty = all).
+// Keys deleted during listing and undecodable values are skipped.
+func (t *TypedKV[T]) List(ctx context.Context, prefix string) ([]T, error) {
+	keys, err := t.kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %w", err)
+	}
+
+	var values []T
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		entry, err := t.kv.Get(ctx, key)
+		if err != nil {
+			t.logger.Debug("entry vanished during listing", "key", key, "error", err)
+			continue
+		}
+
+		v, err := t.decode(entry.Value())
+		if err != nil {
+			t.logger.Warn("skipping malformed entry", "key", key, "error", err)
+			continue
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// Watch calls fn for the current value and every change of keys matching
+// pattern (empty = all keys) until ctx is canceled or the watcher is
+// stopped. Deletes and purges pass a nil value; undecodable values are
+// skipped.
+func (t *TypedKV[T]) Watch(ctx context.Context, pattern string, fn func(key string, v *T, deleted bool)) (*ServiceWatcher, error) {
+	watcher, err := t.watch(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return t.deliver(ctx, pattern, watcher, fn), nil
+}
+
+// WatchSnapshot returns the current values of keys matching pattern (by
+// key), then calls fn for every later change, as Watch does. Nothing is
+// missed or seen twice between the snapshot and the changes.
+func (t *TypedKV[T]) WatchSnapshot(ctx context.Context, pattern string, fn func(key string, v *T, deleted bool)) (map[string]T, *ServiceWatcher, error) {
+	watcher, err := t.watch(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapshot := make(map[string]T)
+	for {
+		var entry jetstream.KeyValueEntry
+		select {
+		case <-ctx.Done():
+			watcher.Stop()
+			return nil, nil, fmt.Errorf("watching %q: %w", pattern, ctx.Err())
+		case e, ok := <-watcher.Updates():
+			if !ok {
+				return nil, nil, fmt.Errorf("watching %q: %w", pattern, ErrWatcherClosed)
+			}
+			entry = e
+		}
+		if entry == nil {
+			break // End of initial values
+		}
+		t.apply(entry, func(key string, v *T, deleted bool) {
+			if deleted {
+				delete(snapshot, key)
+			} else {
+				snapshot[key] = *v
+			}
+		})
+	}
+	return snapshot, t.deliver(ctx, pattern, watcher, fn), nil
+}
+
+// watch opens a KV watcher on pattern (empty = all keys)
+func (t *TypedKV[T]) watch(ctx context.Context, pattern string) (jetstream.KeyWatcher, error) {
+	var watcher jetstream.KeyWatcher
+	var err error
+	if pattern == "" {
+		watcher, err = t.kv.WatchAll(ctx)
+	} else {
+		watcher, err = t.kv.Watch(ctx, pattern)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("watching %q: %w", pattern, err)
+	}
+	return watcher, nil
+}
+
+// deliver passes the watcher's entries to fn until stopped, ctx is
+// canceled or the update channel closes
+func (t *TypedKV[T]) deliver(ctx context.Context, pattern string, watcher jetstream.KeyWatcher, fn func(key string, v *T, deleted bool)) *ServiceWatcher {
+	sw := &ServiceWatcher{
+		kvWatcher: watcher,
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sw.done)
+		for {
+			select {
+			case <-sw.stopCh:
+				return
+			case <-ctx.Done():
+				sw.end(ctx.Err())
+				return
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					sw.end(ErrWatcherClosed)
+					if sw.Err() != nil {
+						t.logger.Warn("watch closed", "pattern", pattern)
+					}
+					return
+				}
+				if entry == nil {
+					continue // End of initial values
+				}
+				t.apply(entry, fn)
+			}
+		}
+	}()
+
+	return sw
+}
+
+// apply decodes one watched entry and passes it to fn
+func (t *TypedKV[T]) apply(entry jetstream.KeyValueEntry, fn func(key string, v *T, deleted bool)) {
+	op := entry.Operation()
+	if op == jetstream.KeyValueDelete || op == jetstream.KeyValuePurge {
+		fn(entry.Key(), nil, true)
+		return
+	}
+
+	v, err := t.decode(entry.Value())
+	if err != nil {
+		t.logger.Warn("skipping malformed entry", "key", entry.Key(), "error", err)
+		return
+	}
+	fn(entry.Key(), &v, false)
+}
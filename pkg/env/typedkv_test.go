@@ -0,0 +1,134 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTypedKVList(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+
+	kv := newMemKV()
+	kv.values["a.1"] = []byte(`{"name":"one"}`)
+	kv.values["a.2"] = []byte(`{"name":"two"}`)
+	kv.values["a.bad"] = []byte(`not json`)
+	kv.values["b.1"] = []byte(`{"name":"other"}`)
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{"prefix", "a.", []string{"one", "two"}},
+		{"all", "", []string{"one", "other", "two"}},
+		{"no match", "c.", nil},
+	}
+
+	typed := NewTypedKV[item](kv)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := typed.List(context.Background(), tt.prefix)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			var names []string
+			for _, it := range items {
+				names = append(names, it.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("List(%q) = %q, want %q", tt.prefix, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypedKVEmptyBucket(t *testing.T) {
+	items, err := NewTypedKV[string](newMemKV()).List(context.Background(), "")
+	if err != nil || len(items) != 0 {
+		t.Errorf("List() on empty bucket = %v, %v; want empty, nil", items, err)
+	}
+}
+
+func TestTypedKVDecoder(t *testing.T) {
+	errOld := errors.New("unsupported version")
+	decode := func(data []byte) (int, error) {
+		if string(data) == "v1" {
+			return 0, errOld
+		}
+		return len(data), nil
+	}
+
+	ctx := context.Background()
+	kv := newMemKV()
+	typed := NewTypedKV(kv, WithDecoder(decode))
+
+	if _, err := typed.Put(ctx, "k", 42); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	got, _, err := typed.Get(ctx, "k")
+	if err != nil || got != 2 { // Decoder sees the JSON "42"
+		t.Errorf("Get() = %d, %v; want 2, nil", got, err)
+	}
+
+	kv.values["old"] = []byte("v1")
+	if _, _, err := typed.Get(ctx, "old"); !errors.Is(err, errOld) {
+		t.Errorf("Get() error = %v, want %v", err, errOld)
+	}
+}
+
+func TestTypedKVWatchLifetime(t *testing.T) {
+	waitDone := func(t *testing.T, w *ServiceWatcher) {
+		t.Helper()
+		select {
+		case <-w.Done():
+		case <-time.After(time.Second):
+			t.Fatal("watcher goroutine did not end")
+		}
+	}
+	nop := func(string, *string, bool) {}
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		w, err := NewTypedKV[string](newMemKV()).Watch(ctx, "", nop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		waitDone(t, w)
+		if !errors.Is(w.Err(), context.Canceled) {
+			t.Errorf("Err() = %v, want context.Canceled", w.Err())
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		w, err := NewTypedKV[string](newMemKV()).Watch(context.Background(), "", nop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Stop()
+		waitDone(t, w)
+		if w.Err() != nil {
+			t.Errorf("Err() after Stop = %v, want nil", w.Err())
+		}
+	})
+
+	t.Run("closed by NATS", func(t *testing.T) {
+		kv := newMemKV()
+		w, err := NewTypedKV[string](kv).Watch(context.Background(), "", nop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kv.watchers[0].Stop()
+		waitDone(t, w)
+		if !errors.Is(w.Err(), ErrWatcherClosed) {
+			t.Errorf("Err() = %v, want ErrWatcherClosed", w.Err())
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// unixsocket.go: Unix domain socket listener for same-host clients
+//
+//	NATS_SOCKET=/run/wellnown/nats.sock NATS_NO_TCP=true ./myservice
+//
+//	nc, err := env.ConnectUnix("/run/wellnown/nats.sock", nats.Name("sidecar"))
+//
+// nats-server only listens on TCP, so the node accepts socket connections
+// itself and hands each to the server in-process (Server.InProcessConn).
+// With NoTCP the server opens no client port at all: the node's own
+// connections are in-process and other local services use the socket,
+// whose file mode (0660) limits it to the owner and group. Leaf, cluster,
+// WebSocket, MQTT and monitoring listeners are configured separately.
+//
+// Services sharing a node (sharednode.go) can reach it over its socket:
+// NATS_LOCAL_NODE=unix:///run/wellnown/nats.sock.
+package env
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// socketMode is the file mode of the socket: owner and group only
+const socketMode = 0o660
+
+// unixScheme prefixes socket paths given as URLs
+const unixScheme = "unix://"
+
+// unixPlaceholderURL is the server URL of socket connections; the
+// dialer ignores it
+const unixPlaceholderURL = "nats://localhost"
+
+// socketListener accepts connections on a unix socket and pipes them
+// into the embedded server
+type socketListener struct {
+	path string
+	ln   net.Listener
+	wg   sync.WaitGroup
+}
+
+// listenUnix serves ns on a unix socket at path. A stale socket file left
+// by a crashed process is replaced; one still in use is an error.
+func listenUnix(ns *server.Server, path string, logger *slog.Logger) (*socketListener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("unix socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale unix socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listening on unix socket: %w", err)
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("setting unix socket mode: %w", err)
+	}
+
+	l := &socketListener{path: path, ln: ln}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Warn("unix socket accept failed", "path", path, "error", err)
+				}
+				return
+			}
+			sc, err := ns.InProcessConn()
+			if err != nil {
+				logger.Warn("unix socket client refused", "path", path, "error", err)
+				c.Close()
+				continue
+			}
+			go pipeConns(c, sc)
+		}
+	}()
+	return l, nil
+}
+
+// Close stops accepting connections and removes the socket file.
+// Connected clients stay until the server shuts down.
+func (l *socketListener) Close() error {
+	err := l.ln.Close()
+	l.wg.Wait()
+	return err
+}
+
+// pipeConns copies between a and b until either side closes
+func pipeConns(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+		b.Close()
+	}()
+	io.Copy(b, a)
+	a.Close()
+	b.Close()
+}
+
+// unixDialer dials a unix socket whatever server URL nats.go asks for
+type unixDialer struct {
+	path    string
+	timeout time.Duration
+}
+
+// Dial implements nats.CustomDialer
+func (d unixDialer) Dial(network, address string) (net.Conn, error) {
+	return net.DialTimeout("unix", d.path, d.timeout)
+}
+
+// UnixSocket returns a nats.go option that connects over the unix socket
+// at path instead of TCP
+func UnixSocket(path string) nats.Option {
+	return nats.SetCustomDialer(unixDialer{path: path, timeout: nats.DefaultTimeout})
+}
+
+// ConnectUnix connects to a node over its unix socket
+func ConnectUnix(path string, opts ...nats.Option) (*nats.Conn, error) {
+	nc, err := nats.Connect(unixPlaceholderURL, append([]nats.Option{UnixSocket(path)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to unix socket %s: %w", path, err)
+	}
+	return nc, nil
+}
+
+// unixSocketPath returns the socket path of a unix:// URL ("" if url is
+// not one)
+func unixSocketPath(url string) string {
+	path, ok := strings.CutPrefix(url, unixScheme)
+	if !ok {
+		return ""
+	}
+	return path
+}
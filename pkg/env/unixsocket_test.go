@@ -0,0 +1,67 @@
+package env
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocketPath(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"unix:///run/wellnown/nats.sock", "/run/wellnown/nats.sock"},
+		{"nats://127.0.0.1:4222", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := unixSocketPath(tt.url); got != tt.want {
+			t.Errorf("unixSocketPath(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestUnixDialerIgnoresServerAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nats.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Write([]byte("INFO {}\r\n"))
+			c.Close()
+		}
+	}()
+
+	c, err := unixDialer{path: path, timeout: time.Second}.Dial("tcp", "localhost:4222")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer c.Close()
+	got, _ := io.ReadAll(c)
+	if string(got) != "INFO {}\r\n" {
+		t.Errorf("read %q over the socket, want the server's INFO", got)
+	}
+}
+
+func TestPipeConns(t *testing.T) {
+	client, socketSide := net.Pipe()
+	serverSide, server := net.Pipe()
+	go pipeConns(socketSide, serverSide)
+
+	go client.Write([]byte("PING\r\n"))
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "PING\r\n" {
+		t.Fatalf("server read %q, %v; want PING", buf, err)
+	}
+
+	server.Close()
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(buf); err == nil {
+		t.Error("client still open after the server closed")
+	}
+}
@@ -0,0 +1,286 @@
+// usage.go: Per-subject message accounting for chargeback/visibility
+//
+// A UsageTracker taps every subject on the local NATS node and counts
+// messages and bytes per subject prefix (the first N tokens - the default
+// of 2 matches the org.repo service convention). Counts are rolled up into
+// the "usage_daily" JetStream stream so hub operators can answer
+// "which service generates most traffic on the hub?".
+//
+// Subject pattern: usage.daily.{YYYY-MM-DD}.{node}
+//
+// Run it on the hub (nats-node) to see mesh-wide traffic, or on a leaf to
+// see only that node's traffic.
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	usageStreamName    = "usage_daily"
+	usageSubjectPrefix = "usage.daily."
+	usageDayFormat     = "2006-01-02"
+)
+
+// DefaultUsageDepth is the number of subject tokens used as the accounting key
+const DefaultUsageDepth = 2
+
+// usageFlushInterval is how often the running day's report is republished
+const usageFlushInterval = 15 * time.Minute
+
+// SubjectUsage holds the counters for one subject prefix
+type SubjectUsage struct {
+	Prefix   string `json:"prefix"`
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// UsageReport is the daily rollup stored in the usage_daily stream
+type UsageReport struct {
+	Day      string         `json:"day"`
+	Node     string         `json:"node"`
+	Subjects []SubjectUsage `json:"subjects"`
+}
+
+// TotalBytes returns the sum of bytes across all prefixes
+func (r UsageReport) TotalBytes() uint64 {
+	var total uint64
+	for _, s := range r.Subjects {
+		total += s.Bytes
+	}
+	return total
+}
+
+// UsageTracker counts traffic per subject prefix
+type UsageTracker struct {
+	mu     sync.Mutex
+	js     jetstream.JetStream
+	node   string
+	depth  int
+	day    string
+	counts map[string]*SubjectUsage
+	sub    *nats.Subscription
+	logger *slog.Logger
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// StartUsageTracker creates the usage_daily stream, taps all subjects on nc,
+// and starts the daily rollup goroutine. depth <= 0 uses DefaultUsageDepth;
+// a nil logger uses slog.Default.
+func StartUsageTracker(ctx context.Context, nc *nats.Conn, js jetstream.JetStream, node string, depth int, logger *slog.Logger) (*UsageTracker, error) {
+	if depth <= 0 {
+		depth = DefaultUsageDepth
+	}
+
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:              usageStreamName,
+		Description:       "Daily per-subject message accounting for wellnown-env",
+		Subjects:          []string{usageSubjectPrefix + ">"},
+		MaxMsgsPerSubject: 1, // Latest snapshot per day/node wins
+		MaxAge:            90 * 24 * time.Hour,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating usage stream: %w", err)
+	}
+
+	t := &UsageTracker{
+		js:     js,
+		node:   node,
+		depth:  depth,
+		day:    time.Now().UTC().Format(usageDayFormat),
+		counts: make(map[string]*SubjectUsage),
+		logger: componentLogger(logger, "usage"),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	sub, err := nc.Subscribe(">", t.record)
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to usage tap: %w", err)
+	}
+	t.sub = sub
+
+	go t.rollup()
+
+	return t, nil
+}
+
+// record counts a single tapped message
+func (t *UsageTracker) record(msg *nats.Msg) {
+	// Skip request/reply inboxes, our own rollups and buffered publishes
+	// (counted when replayed)
+	if strings.HasPrefix(msg.Subject, "_INBOX.") || strings.HasPrefix(msg.Subject, usageSubjectPrefix) ||
+		strings.HasPrefix(msg.Subject, outboxSubjectPrefix) {
+		return
+	}
+
+	prefix := subjectPrefix(msg.Subject, t.depth)
+	size := uint64(len(msg.Data))
+	for k, vals := range msg.Header {
+		for _, v := range vals {
+			size += uint64(len(k) + len(v))
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, ok := t.counts[prefix]
+	if !ok {
+		u = &SubjectUsage{Prefix: prefix}
+		t.counts[prefix] = u
+	}
+	u.Messages++
+	u.Bytes += size
+}
+
+// rollup publishes the current day's report periodically and resets
+// counters when the day changes
+func (t *UsageTracker) rollup() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	lastFlush := time.Now()
+	for {
+		select {
+		case <-t.stopCh:
+			t.flush("")
+			return
+		case now := <-ticker.C:
+			if t.tick(now, lastFlush) {
+				lastFlush = now
+			}
+		}
+	}
+}
+
+// tick publishes the report when the day changed (then starts the new
+// day) or the last flush is usageFlushInterval old. Reports whether it did.
+func (t *UsageTracker) tick(now, lastFlush time.Time) bool {
+	today := now.UTC().Format(usageDayFormat)
+	t.mu.Lock()
+	rolled := today != t.day
+	t.mu.Unlock()
+
+	if !rolled && now.Sub(lastFlush) < usageFlushInterval {
+		return false
+	}
+	if rolled {
+		t.flush(today)
+	} else {
+		t.flush("")
+	}
+	return true
+}
+
+// flush publishes the current report; a non-empty newDay then resets the
+// counters for that day
+func (t *UsageTracker) flush(newDay string) {
+	report := t.Snapshot()
+
+	if newDay != "" {
+		t.mu.Lock()
+		t.day = newDay
+		t.counts = make(map[string]*SubjectUsage)
+		t.mu.Unlock()
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := t.js.Publish(ctx, usageSubject(report.Day, report.Node), data); err != nil {
+		t.logger.Warn("usage rollup failed", "day", report.Day, "error", err)
+	}
+}
+
+// Snapshot returns the current day's counters, sorted by bytes (descending)
+func (t *UsageTracker) Snapshot() UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := UsageReport{
+		Day:      t.day,
+		Node:     t.node,
+		Subjects: make([]SubjectUsage, 0, len(t.counts)),
+	}
+	for _, u := range t.counts {
+		report.Subjects = append(report.Subjects, *u)
+	}
+	sort.Slice(report.Subjects, func(i, j int) bool {
+		if report.Subjects[i].Bytes != report.Subjects[j].Bytes {
+			return report.Subjects[i].Bytes > report.Subjects[j].Bytes
+		}
+		return report.Subjects[i].Prefix < report.Subjects[j].Prefix
+	})
+	return report
+}
+
+// Node returns the node name reports are recorded under
+func (t *UsageTracker) Node() string {
+	return t.node
+}
+
+// Stop unsubscribes the tap and publishes a final report
+func (t *UsageTracker) Stop() error {
+	err := t.sub.Unsubscribe()
+	close(t.stopCh)
+	<-t.done
+	return err
+}
+
+// GetUsageHistory returns the stored daily reports for a node over the
+// last n days (most recent first). Days without data are skipped.
+func GetUsageHistory(ctx context.Context, js jetstream.JetStream, node string, days int) ([]UsageReport, error) {
+	stream, err := js.Stream(ctx, usageStreamName)
+	if err != nil {
+		return nil, fmt.Errorf("getting usage stream: %w", err)
+	}
+
+	var reports []UsageReport
+	now := time.Now().UTC()
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i).Format(usageDayFormat)
+		msg, err := stream.GetLastMsgForSubject(ctx, usageSubject(day, node))
+		if err != nil {
+			continue
+		}
+
+		var report UsageReport
+		if err := json.Unmarshal(msg.Data, &report); err != nil {
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// subjectPrefix returns the first depth tokens of a subject
+func subjectPrefix(subject string, depth int) string {
+	tokens := strings.SplitN(subject, ".", depth+1)
+	if len(tokens) > depth {
+		tokens = tokens[:depth]
+	}
+	return strings.Join(tokens, ".")
+}
+
+// usageSubject builds the rollup subject for a day and node
+func usageSubject(day, node string) string {
+	return usageSubjectPrefix + day + "." + node
+}
@@ -0,0 +1,120 @@
+package env
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestSubjectPrefix(t *testing.T) {
+	tests := []struct {
+		subject string
+		depth   int
+		want    string
+	}{
+		{"acme.orders.created", 2, "acme.orders"},
+		{"acme.orders", 2, "acme.orders"},
+		{"acme", 2, "acme"},
+		{"acme.orders.created.eu", 3, "acme.orders.created"},
+		{"acme.orders.created", 1, "acme"},
+	}
+
+	for _, tt := range tests {
+		if got := subjectPrefix(tt.subject, tt.depth); got != tt.want {
+			t.Errorf("subjectPrefix(%q, %d) = %q, want %q", tt.subject, tt.depth, got, tt.want)
+		}
+	}
+}
+
+// usageOf returns the counters of one prefix in a report
+func usageOf(report UsageReport, prefix string) SubjectUsage {
+	for _, s := range report.Subjects {
+		if s.Prefix == prefix {
+			return s
+		}
+	}
+	return SubjectUsage{Prefix: prefix}
+}
+
+func TestUsageTracker(t *testing.T) {
+	n := startTestNode(t, NATSConfig{})
+	ctx := context.Background()
+
+	tracker, err := StartUsageTracker(ctx, n.Conn(), n.JetStream(), "hub", 0, nil)
+	if err != nil {
+		t.Fatalf("StartUsageTracker() error = %v", err)
+	}
+	defer tracker.Stop()
+
+	pub, err := nats.Connect(n.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	for _, m := range []struct{ subject, data string }{
+		{"acme.orders.created", "1234"},
+		{"acme.orders.created", "12"},
+		{"acme.orders.shipped.eu", "1"},
+		{"acme.billing.invoice", "123456"},
+		{"_INBOX.abc", "skipped"},
+		{"usage.daily.2024-01-01.hub", "skipped"},
+	} {
+		if err := pub.Publish(m.subject, []byte(m.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for usageOf(tracker.Snapshot(), "acme.billing").Messages == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	report := tracker.Snapshot()
+	if got := usageOf(report, "acme.orders"); got.Messages != 3 || got.Bytes != 7 {
+		t.Errorf("acme.orders = %d msgs %d bytes, want 3 msgs 7 bytes", got.Messages, got.Bytes)
+	}
+	if got := usageOf(report, "acme.billing"); got.Messages != 1 || got.Bytes != 6 {
+		t.Errorf("acme.billing = %d msgs %d bytes, want 1 msg 6 bytes", got.Messages, got.Bytes)
+	}
+	for _, skipped := range []string{"_INBOX.abc", "usage.daily"} {
+		if got := usageOf(report, skipped); got.Messages != 0 {
+			t.Errorf("%s counted %d msgs, want it skipped", skipped, got.Messages)
+		}
+	}
+
+	// Nothing is due within the same day
+	now := time.Now()
+	if tracker.tick(now, now) {
+		t.Error("tick() flushed before the flush interval")
+	}
+
+	// The next day publishes the finished day and starts from zero
+	today := report.Day
+	tomorrow := now.UTC().AddDate(0, 0, 1)
+	if !tracker.tick(tomorrow, now) {
+		t.Fatal("tick() did not flush on a new day")
+	}
+	next := tracker.Snapshot()
+	if next.Day != tomorrow.Format(usageDayFormat) {
+		t.Errorf("Day after rollover = %q, want %q", next.Day, tomorrow.Format(usageDayFormat))
+	}
+	if got := usageOf(next, "acme.orders"); got.Messages != 0 {
+		t.Errorf("acme.orders after rollover = %d msgs, want 0", got.Messages)
+	}
+
+	history, err := GetUsageHistory(ctx, n.JetStream(), "hub", 1)
+	if err != nil {
+		t.Fatalf("GetUsageHistory() error = %v", err)
+	}
+	if len(history) != 1 || history[0].Day != today {
+		t.Fatalf("GetUsageHistory() = %+v, want the report of %s", history, today)
+	}
+	if got := usageOf(history[0], "acme.orders"); got.Messages != 3 || got.Bytes != 7 {
+		t.Errorf("stored acme.orders = %d msgs %d bytes, want 3 msgs 7 bytes", got.Messages, got.Bytes)
+	}
+}
@@ -0,0 +1,303 @@
+// validate.go: Config struct validation after parsing
+//
+// Two layers of validation run in Manager.Parse, after secrets are resolved
+// and ardanlabs/conf has populated the struct:
+//
+//  1. Per-field rules declared in the conf tag (ignored by ardanlabs/conf):
+//
+//     validate:url      - value must be an absolute URL (scheme://host)
+//     validate:hostport - value must be host:port
+//     validate:email    - value must be an email address
+//     min:N / max:N     - numeric bounds (length for strings and slices,
+//     duration strings for time.Duration)
+//     regex:PATTERN     - string must match PATTERN (no commas allowed)
+//
+//  2. Any struct (top-level or nested) implementing Validator has its
+//     Validate() method called for cross-field checks.
+//
+// Example:
+//
+//	type Config struct {
+//	    Server struct {
+//	        Port int    `conf:"default:8080,min:1,max:65535"`
+//	        URL  string `conf:"default:http://localhost:8080,validate:url"`
+//	    }
+//	}
+//
+//	func (c Config) Validate() error {
+//	    if c.Server.Port == 80 && !strings.HasPrefix(c.Server.URL, "http://") {
+//	        return errors.New("port 80 requires http URL")
+//	    }
+//	    return nil
+//	}
+package env
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validator is implemented by config structs that need custom validation.
+// Validate is called after the tag-based field rules are checked.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes a single field that failed a validation rule
+type FieldError struct {
+	Path   string // Field path (e.g., "Server.Port")
+	EnvKey string // Environment variable name
+	Rule   string // Rule that failed (e.g., "min:1")
+	Err    error  // Underlying reason
+}
+
+// Error implements the error interface
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s: %v", e.Path, e.EnvKey, e.Rule, e.Err)
+}
+
+// Unwrap returns the underlying reason
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ValidateConfig checks a parsed config struct against its tag rules and
+// any Validator implementations. All field errors are returned together
+// (joined), so operators see every bad value at once.
+func ValidateConfig(prefix string, cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return fmt.Errorf("config is nil")
+	}
+
+	var errs []error
+	validateRecursive(prefix, "", v, &errs)
+	return errors.Join(errs...)
+}
+
+func validateRecursive(prefix, path string, v reflect.Value, errs *[]error) {
+	// Dereference pointers
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Skip unexported fields
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+
+		// Handle embedded and nested structs
+		if field.Anonymous {
+			validateRecursive(prefix, path, v.Field(i), errs)
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Tag.Get("conf") == "" {
+			validateRecursive(prefix, fieldPath, v.Field(i), errs)
+			continue
+		}
+
+		tag := field.Tag.Get("conf")
+		if tag == "" {
+			continue
+		}
+
+		fi := parseConfTag(prefix, fieldPath, field.Type.String(), tag)
+		for _, rule := range parseValidationRules(tag) {
+			if err := checkRule(rule, v.Field(i)); err != nil {
+				*errs = append(*errs, &FieldError{
+					Path:   fi.Path,
+					EnvKey: fi.EnvKey,
+					Rule:   rule.String(),
+					Err:    err,
+				})
+			}
+		}
+	}
+
+	// Custom validation runs on the struct itself
+	if val, ok := asValidator(v); ok {
+		if err := val.Validate(); err != nil {
+			if path != "" {
+				err = fmt.Errorf("%s: %w", path, err)
+			}
+			*errs = append(*errs, err)
+		}
+	}
+}
+
+// asValidator returns the Validator for a struct value, checking both
+// value and pointer receivers
+func asValidator(v reflect.Value) (Validator, bool) {
+	if v.CanInterface() {
+		if val, ok := v.Interface().(Validator); ok {
+			return val, true
+		}
+	}
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if val, ok := v.Addr().Interface().(Validator); ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// validationRule is a single rule parsed from a conf tag
+type validationRule struct {
+	name string // validate, min, max, regex
+	arg  string
+}
+
+func (r validationRule) String() string {
+	return r.name + ":" + r.arg
+}
+
+// parseValidationRules extracts validation rules from a conf tag
+func parseValidationRules(tag string) []validationRule {
+	var rules []validationRule
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		name, arg, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "validate", "min", "max", "regex":
+			rules = append(rules, validationRule{name: name, arg: arg})
+		}
+	}
+	return rules
+}
+
+// checkRule applies a single rule to a field value
+func checkRule(rule validationRule, v reflect.Value) error {
+	switch rule.name {
+	case "validate":
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("validate rules only apply to strings")
+		}
+		s := v.String()
+		if s == "" {
+			return nil // Use required to enforce presence
+		}
+		return checkFormat(rule.arg, s)
+
+	case "regex":
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("regex only applies to strings")
+		}
+		s := v.String()
+		if s == "" {
+			return nil
+		}
+		re, err := regexp.Compile(rule.arg)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("%q does not match", s)
+		}
+		return nil
+
+	case "min", "max":
+		return checkBound(rule, v)
+	}
+	return nil
+}
+
+// checkFormat validates a string against a named format
+func checkFormat(format, s string) error {
+	switch format {
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%q is not an absolute URL", s)
+		}
+		return nil
+
+	case "hostport":
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			return err
+		}
+		return nil
+
+	case "email":
+		if _, err := mail.ParseAddress(s); err != nil {
+			return err
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// checkBound applies a min or max rule. Strings and slices are bounded by
+// length, durations by duration strings, numbers by value.
+func checkBound(rule validationRule, v reflect.Value) error {
+	isMin := rule.name == "min"
+
+	if v.Type() == durationType {
+		limit, err := time.ParseDuration(rule.arg)
+		if err != nil {
+			return fmt.Errorf("invalid duration bound: %w", err)
+		}
+		return compareBound(isMin, float64(v.Int()), float64(limit), time.Duration(v.Int()).String())
+	}
+
+	limit, err := strconv.ParseFloat(rule.arg, 64)
+	if err != nil {
+		return fmt.Errorf("invalid bound: %w", err)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareBound(isMin, float64(v.Int()), limit, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareBound(isMin, float64(v.Uint()), limit, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		return compareBound(isMin, v.Float(), limit, strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case reflect.String, reflect.Slice, reflect.Map:
+		return compareBound(isMin, float64(v.Len()), limit, fmt.Sprintf("length %d", v.Len()))
+	default:
+		return fmt.Errorf("%s does not apply to %s", rule.name, v.Type())
+	}
+}
+
+func compareBound(isMin bool, got, limit float64, display string) error {
+	if isMin && got < limit {
+		return fmt.Errorf("%s is below minimum", display)
+	}
+	if !isMin && got > limit {
+		return fmt.Errorf("%s is above maximum", display)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package env
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validateTestConfig struct {
+	Server struct {
+		Port    int           `conf:"default:8080,min:1,max:65535"`
+		URL     string        `conf:"validate:url"`
+		Addr    string        `conf:"validate:hostport"`
+		Timeout time.Duration `conf:"default:5s,min:1s,max:1m"`
+	}
+	Admin struct {
+		Email string `conf:"validate:email"`
+		Name  string `conf:"regex:^[a-z]+$,min:3"`
+	}
+}
+
+type crossFieldConfig struct {
+	Min int `conf:"default:1"`
+	Max int `conf:"default:10"`
+}
+
+func (c *crossFieldConfig) Validate() error {
+	if c.Min > c.Max {
+		return errors.New("min must not exceed max")
+	}
+	return nil
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := func() validateTestConfig {
+		var cfg validateTestConfig
+		cfg.Server.Port = 8080
+		cfg.Server.URL = "http://localhost:8080"
+		cfg.Server.Addr = "localhost:4222"
+		cfg.Server.Timeout = 5 * time.Second
+		cfg.Admin.Email = "ops@example.com"
+		cfg.Admin.Name = "alice"
+		return cfg
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*validateTestConfig)
+		wantErr string
+	}{
+		{
+			name:   "valid config",
+			modify: func(c *validateTestConfig) {},
+		},
+		{
+			name:    "port below min",
+			modify:  func(c *validateTestConfig) { c.Server.Port = 0 },
+			wantErr: "APP_SERVER_PORT",
+		},
+		{
+			name:    "port above max",
+			modify:  func(c *validateTestConfig) { c.Server.Port = 70000 },
+			wantErr: "max:65535",
+		},
+		{
+			name:    "relative url",
+			modify:  func(c *validateTestConfig) { c.Server.URL = "/just/a/path" },
+			wantErr: "validate:url",
+		},
+		{
+			name:   "empty url skipped",
+			modify: func(c *validateTestConfig) { c.Server.URL = "" },
+		},
+		{
+			name:    "missing port",
+			modify:  func(c *validateTestConfig) { c.Server.Addr = "localhost" },
+			wantErr: "validate:hostport",
+		},
+		{
+			name:    "duration above max",
+			modify:  func(c *validateTestConfig) { c.Server.Timeout = time.Hour },
+			wantErr: "max:1m",
+		},
+		{
+			name:    "bad email",
+			modify:  func(c *validateTestConfig) { c.Admin.Email = "not-an-email" },
+			wantErr: "validate:email",
+		},
+		{
+			name:    "regex mismatch",
+			modify:  func(c *validateTestConfig) { c.Admin.Name = "Alice1" },
+			wantErr: "regex:",
+		},
+		{
+			name:    "string too short",
+			modify:  func(c *validateTestConfig) { c.Admin.Name = "al" },
+			wantErr: "min:3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(&cfg)
+
+			err := ValidateConfig("APP", &cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateConfig() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateConfig() error = nil, want %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateConfig() error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_ReportsAllErrors(t *testing.T) {
+	var cfg validateTestConfig
+	cfg.Server.URL = "nope"
+	cfg.Server.Timeout = time.Second
+
+	err := ValidateConfig("APP", &cfg)
+	if err == nil {
+		t.Fatal("ValidateConfig() error = nil, want errors")
+	}
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("ValidateConfig() error = %T, want *FieldError", err)
+	}
+
+	// Port (min) and URL (format) both fail
+	for _, want := range []string{"Server.Port", "Server.URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ValidateConfig() error = %q, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestValidateConfig_Validator(t *testing.T) {
+	cfg := crossFieldConfig{Min: 5, Max: 1}
+	err := ValidateConfig("APP", &cfg)
+	if err == nil || !strings.Contains(err.Error(), "min must not exceed max") {
+		t.Errorf("ValidateConfig() error = %v, want Validate() error", err)
+	}
+
+	cfg = crossFieldConfig{Min: 1, Max: 5}
+	if err := ValidateConfig("APP", &cfg); err != nil {
+		t.Errorf("ValidateConfig() error = %v, want nil", err)
+	}
+}
@@ -23,15 +23,26 @@
 //	DB_PASSWORD=ref+vault://secret/db#password
 //	API_KEY=ref+awssecrets://prod/api#key
 //	TOKEN=ref+op://Dev/API/token  (1Password)
+//	TOKEN=ref+natskv://secrets/api.token  (hub KV, see natskv.go)
+//
+// Refs are resolved in parallel through a shared runtime with an in-memory
+// TTL cache; see secretresolver.go. ResolveEnvSecrets fails if any ref
+// fails; see secretpolicy.go for best-effort and fallback policies.
+//
+// Offline nodes: SECRET_CACHE=/var/lib/app/secrets.age (or WithSecretCache)
+// keeps resolved values age-encrypted on disk; see pkg/env/secretcache.
 
 package env
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/helmfile/vals"
+	"github.com/joeblew999/wellnown-env/pkg/env/secretcache"
 )
 
 const refPrefix = "ref+"
@@ -52,14 +63,74 @@ const refPrefix = "ref+"
 //	    cfg := env.LoadConfig()
 //	}
 func ResolveEnvSecrets() error {
-	return ResolveEnvSecretsWithOptions(vals.Options{})
+	res, err := DefaultSecretResolver()
+	if err != nil {
+		return err
+	}
+	_, err = resolveEnvSecrets(context.Background(), res, nil, nil, SecretFailFast)
+	return err
 }
 
 // ResolveEnvSecretsWithOptions resolves env secrets with custom vals options.
 // Use this if you need to configure caching, logging, or AWS settings.
 func ResolveEnvSecretsWithOptions(opts vals.Options) error {
+	res, err := NewSecretResolver(opts)
+	if err != nil {
+		return err
+	}
+	_, err = resolveEnvSecrets(context.Background(), res, nil, nil, SecretFailFast)
+	return err
+}
+
+// ResolveEnvSecretsCached resolves env secrets like ResolveEnvSecrets, but
+// serves refs from cache while they are fresh and caches what it resolves,
+// so a node can start without reaching the secret backend
+func ResolveEnvSecretsCached(cache *secretcache.Cache) error {
+	res, err := DefaultSecretResolver()
+	if err != nil {
+		return err
+	}
+	_, err = resolveEnvSecrets(context.Background(), res, nil, cache, SecretFailFast)
+	return err
+}
+
+// WithSecretCache serves ref+ secrets from cache while fresh and caches
+// resolved ones (see ResolveEnvSecretsCached)
+func WithSecretCache(cache *secretcache.Cache) Option {
+	return func(o *Options) {
+		o.SecretCache = cache
+	}
+}
+
+// secretCacheFromEnv opens the cache in path with the age identity in
+// SECRET_CACHE_KEY (default: path + ".key", created if missing) and the
+// max age in SECRET_CACHE_MAX_AGE (default: secretcache.DefaultMaxAge)
+func secretCacheFromEnv(path string) (*secretcache.Cache, error) {
+	var maxAge time.Duration
+	if v := os.Getenv("SECRET_CACHE_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing SECRET_CACHE_MAX_AGE: %w", err)
+		}
+		maxAge = d
+	}
+	id, err := secretcache.LoadOrCreateIdentity(GetEnv("SECRET_CACHE_KEY", path+".key"))
+	if err != nil {
+		return nil, err
+	}
+	return secretcache.New(path, id, maxAge), nil
+}
+
+// resolveEnvSecrets resolves ref+ env vars with res and providers, through
+// cache if not nil, handling failed refs by policy
+func resolveEnvSecrets(ctx context.Context, res *SecretResolver, providers map[string]SecretProvider, cache *secretcache.Cache, policy SecretFailurePolicy) (*ResolutionReport, error) {
+	if policy == "" {
+		policy = SecretFailFast
+	}
+	report := &ResolutionReport{Policy: policy}
+
 	// Collect env vars that need resolution
-	toResolve := make(map[string]interface{})
+	toResolve := make(map[string]string)
 	for _, kv := range os.Environ() {
 		parts := strings.SplitN(kv, "=", 2)
 		if len(parts) != 2 {
@@ -73,34 +144,100 @@ func ResolveEnvSecretsWithOptions(opts vals.Options) error {
 
 	// Nothing to resolve
 	if len(toResolve) == 0 {
-		return nil
+		return report, nil
 	}
 
-	// Create vals runtime
-	runtime, err := vals.New(opts)
-	if err != nil {
-		return fmt.Errorf("creating vals runtime: %w", err)
+	refs := make([]string, 0, len(toResolve))
+	for _, ref := range toResolve {
+		refs = append(refs, ref)
 	}
 
-	// Resolve all refs
-	resolved, err := runtime.Eval(toResolve)
+	// Fresh cached values need no backend
+	cached := map[string]string{}
+	if cache != nil {
+		var err error
+		if cached, err = cache.Lookup(refs); err != nil {
+			return report, err
+		}
+		metrics.secretsCached.Add(uint64(len(cached)))
+		refs = refs[:0]
+		for _, ref := range toResolve {
+			if _, ok := cached[ref]; !ok {
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	// Resolve the rest in parallel
+	resolved, failed, took, err := res.resolve(ctx, refs, providers)
 	if err != nil {
-		return fmt.Errorf("resolving secrets: %w", err)
+		return report, err
 	}
 
-	// Update environment with resolved values
-	for key, value := range resolved {
-		strValue, ok := value.(string)
-		if !ok {
-			// Handle non-string values (shouldn't happen for env vars)
-			strValue = fmt.Sprintf("%v", value)
+	// Stale cache entries stand in for failed refs under fallback-cached
+	stale := map[string]string{}
+	if policy == SecretFallbackCached && cache != nil && len(failed) > 0 {
+		failedRefs := make([]string, 0, len(failed))
+		for ref := range failed {
+			failedRefs = append(failedRefs, ref)
+		}
+		if stale, err = cache.Previous(failedRefs); err != nil {
+			stale = map[string]string{} // Unreadable cache: no fallback
+		}
+	}
+
+	values := make(map[string]string, len(toResolve))
+	for key, ref := range toResolve {
+		if d, ok := took[ref]; ok {
+			report.Timings = append(report.Timings, SecretTiming{Key: key, Backend: refScheme(ref), Duration: d})
+		}
+		if value, ok := cached[ref]; ok {
+			values[key] = value
+			report.Cached = append(report.Cached, key)
+			continue
+		}
+		if value, ok := resolved[ref]; ok {
+			values[key] = value
+			report.Resolved = append(report.Resolved, key)
+			continue
 		}
-		if err := os.Setenv(key, strValue); err != nil {
-			return fmt.Errorf("setting %s: %w", key, err)
+		if policy == SecretFallbackCached {
+			value, ok := res.previous(ref)
+			if !ok {
+				value, ok = stale[ref]
+			}
+			if ok {
+				values[key] = value
+				report.Fallback = append(report.Fallback, key)
+				continue
+			}
 		}
+		report.Failed = append(report.Failed, SecretFailure{Key: key, Ref: ref, Err: failed[ref]})
 	}
+	sortReport(report)
+	metrics.secretsFallback.Add(uint64(len(report.Fallback)))
 
-	return nil
+	if !report.OK() && policy != SecretBestEffort {
+		return report, report.Err()
+	}
+
+	// Update environment with resolved values
+	for key, value := range values {
+		if err := os.Setenv(key, value); err != nil {
+			return report, fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+	// Best effort: failed refs must not reach config as ref+ strings
+	for _, f := range report.Failed {
+		os.Unsetenv(f.Key)
+	}
+
+	if cache != nil && len(resolved) > 0 {
+		if err := cache.Store(resolved); err != nil {
+			return report, fmt.Errorf("caching secrets: %w", err)
+		}
+	}
+	return report, nil
 }
 
 // HasSecretRefs returns true if any environment variable contains a ref+ prefix.
@@ -140,21 +277,13 @@ func ResolveString(value string) (string, error) {
 		return value, nil
 	}
 
-	runtime, err := vals.New(vals.Options{})
+	res, err := DefaultSecretResolver()
 	if err != nil {
-		return "", fmt.Errorf("creating vals runtime: %w", err)
+		return "", err
 	}
-
-	resolved, err := runtime.Eval(map[string]interface{}{
-		"value": value,
-	})
+	resolved, err := res.Resolve(context.Background(), []string{value})
 	if err != nil {
-		return "", fmt.Errorf("resolving %q: %w", value, err)
-	}
-
-	result, ok := resolved["value"].(string)
-	if !ok {
-		return fmt.Sprintf("%v", resolved["value"]), nil
+		return "", err
 	}
-	return result, nil
+	return resolved[value], nil
 }
@@ -0,0 +1,79 @@
+// version.go: Build version of the running binary
+//
+// Release builds stamp the version with ldflags (registry.GitTag and
+// registry.GitCommit); `go install ...@v1.2.3` builds carry it in the
+// module build info. Binaries print it for --version:
+//
+//	if len(os.Args) > 1 && env.IsVersionArg(os.Args[1]) {
+//	    fmt.Println("nats-node", env.ReadBuildVersion())
+//	    return
+//	}
+package env
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+// DevVersion is the version of builds without version information
+const DevVersion = "dev"
+
+// BuildVersion identifies a build of a binary
+type BuildVersion struct {
+	Version string `json:"version"`          // v1.2.3, or DevVersion
+	Commit  string `json:"commit,omitempty"` // Git revision
+	Go      string `json:"go"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+}
+
+// ReadBuildVersion returns the version of the running binary
+func ReadBuildVersion() BuildVersion {
+	v := BuildVersion{
+		Version: registry.GitTag,
+		Commit:  registry.GitCommit,
+		Go:      runtime.Version(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && v.Commit == "" {
+				v.Commit = s.Value
+			}
+		}
+	}
+	if v.Version == "" {
+		v.Version = DevVersion
+	}
+	return v
+}
+
+// String formats v as "v1.2.3 (abc1234) go1.25.4 linux/amd64"
+func (v BuildVersion) String() string {
+	s := v.Version
+	if v.Commit != "" {
+		s += " (" + shortCommit(v.Commit) + ")"
+	}
+	return fmt.Sprintf("%s %s %s/%s", s, v.Go, v.OS, v.Arch)
+}
+
+// shortCommit abbreviates a git revision to 7 characters
+func shortCommit(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
+
+// IsVersionArg reports whether a command-line argument asks for the version
+func IsVersionArg(arg string) bool {
+	return arg == "--version" || arg == "-version" || arg == "version"
+}
@@ -0,0 +1,34 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/joeblew999/wellnown-env/pkg/env/registry"
+)
+
+func TestReadBuildVersion(t *testing.T) {
+	defer func(tag, commit string) { registry.GitTag, registry.GitCommit = tag, commit }(registry.GitTag, registry.GitCommit)
+
+	registry.GitTag, registry.GitCommit = "v1.4.0", "0123456789abcdef"
+	v := ReadBuildVersion()
+	if v.Version != "v1.4.0" || v.Commit != "0123456789abcdef" {
+		t.Errorf("ReadBuildVersion() = %+v, want the ldflags version", v)
+	}
+	if want := "v1.4.0 (0123456) " + v.Go + " " + v.OS + "/" + v.Arch; v.String() != want {
+		t.Errorf("String() = %q, want %q", v.String(), want)
+	}
+
+	// Test binaries carry no module version
+	registry.GitTag = ""
+	if v := ReadBuildVersion(); v.Version != DevVersion {
+		t.Errorf("unstamped Version = %q, want %q", v.Version, DevVersion)
+	}
+}
+
+func TestIsVersionArg(t *testing.T) {
+	for arg, want := range map[string]bool{"--version": true, "-version": true, "version": true, "-v": false, "plan": false} {
+		if got := IsVersionArg(arg); got != want {
+			t.Errorf("IsVersionArg(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
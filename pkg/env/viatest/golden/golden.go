@@ -0,0 +1,151 @@
+// Package golden snapshots server-rendered Via pages and compares them
+// against golden files, so changes to the shared components (Table,
+// palette, dashboards) show up as reviewable diffs:
+//
+//	func TestDashboardGolden(t *testing.T) {
+//	    v := via.New()
+//	    env.RegisterDashboardPage(v, mgr, &cfg, env.DashboardOptions{})
+//	    golden.AssertPage(t, v, "/", "dashboard")
+//	}
+//
+// Via gives every page context, action, signal and component a random
+// 8-hex ID; Render replaces them with id1, id2, ... in order of first
+// appearance and puts each tag on its own line. Pages must be fed fixed
+// inputs (no clocks, hostnames or unset env vars) to stay deterministic.
+//
+// Golden files live in the calling package's testdata/<name>.golden and
+// are committed with the tests. A missing file fails the test; record new
+// ones, or re-record after an intended UI change, with:
+//
+//	UPDATE_GOLDEN=1 go test ./...
+//
+// Unlike viatest, this package needs no browser (and no cgo).
+package golden
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-via/via"
+)
+
+// UpdateEnv is the environment variable that rewrites golden files
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// Dir is where golden files are read and written, relative to the test's
+// package directory
+const Dir = "testdata"
+
+// viaID matches Via's generated IDs (boundaries are checked separately)
+var viaID = regexp.MustCompile(`[0-9a-f]{8}`)
+
+// Render serves path from v in-process and returns its normalized HTML
+func Render(t testing.TB, v *via.V, path string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	v.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, rec.Code)
+	}
+	return Normalize(rec.Body.String())
+}
+
+// Normalize makes rendered HTML stable: Via's random IDs become id1, id2,
+// ... in order of first appearance, and tags are split onto separate lines
+// so golden diffs are readable
+func Normalize(html string) string {
+	ids := make(map[string]string)
+	var b strings.Builder
+	last := 0
+	for _, loc := range viaID.FindAllStringIndex(html, -1) {
+		start, end := loc[0], loc[1]
+		if (start > 0 && isAlnum(html[start-1])) || (end < len(html) && isAlnum(html[end])) {
+			continue // Part of a longer word or hash
+		}
+		id := html[start:end]
+		if _, ok := ids[id]; !ok {
+			ids[id] = fmt.Sprintf("id%d", len(ids)+1)
+		}
+		b.WriteString(html[last:start])
+		b.WriteString(ids[id])
+		last = end
+	}
+	b.WriteString(html[last:])
+
+	out := strings.ReplaceAll(b.String(), "><", ">\n<")
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out
+}
+
+// isAlnum reports whether c is an ASCII letter or digit
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Assert compares got with testdata/<name>.golden. With UPDATE_GOLDEN set
+// it writes the file instead; otherwise a missing file fails the test.
+func Assert(t testing.TB, name, got string) {
+	t.Helper()
+
+	path := filepath.Join(Dir, name+".golden")
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(Dir, 0o755); err != nil {
+			t.Fatalf("creating %s: %v", Dir, err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+		t.Logf("recorded %s", path)
+		return
+	}
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("%s is missing (record it with %s=1)", path, UpdateEnv)
+	}
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+
+	if line, w, g, ok := firstDiff(string(want), got); ok {
+		t.Errorf("%s differs at line %d:\n  want: %s\n  got:  %s\n(re-record intended changes with %s=1)",
+			path, line, w, g, UpdateEnv)
+	}
+}
+
+// AssertPage renders path and compares it with testdata/<name>.golden
+func AssertPage(t testing.TB, v *via.V, path, name string) {
+	t.Helper()
+
+	Assert(t, name, Render(t, v, path))
+}
+
+// firstDiff returns the first line (1-based) where want and got differ
+func firstDiff(want, got string) (line int, w, g string, differ bool) {
+	if want == got {
+		return 0, "", "", false
+	}
+	wl := strings.Split(want, "\n")
+	gl := strings.Split(got, "\n")
+	for i := 0; i < max(len(wl), len(gl)); i++ {
+		w, g = "<end of file>", "<end of file>"
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return i + 1, w, g, true
+		}
+	}
+	return 0, "", "", false
+}
@@ -0,0 +1,99 @@
+package golden
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "context and action ids",
+			in:   `<meta data-signals="{'via-ctx':'/_/0a1b2c3d'}"><button data-on:click="@get('/_action/99ff00aa')">`,
+			want: "<meta data-signals=\"{'via-ctx':'/_/id1'}\">\n<button data-on:click=\"@get('/_action/id2')\">\n",
+		},
+		{
+			name: "repeated id keeps its placeholder",
+			in:   `<input data-bind="deadbeef"><span data-text="$deadbeef"></span>`,
+			want: "<input data-bind=\"id1\">\n<span data-text=\"$id1\">\n</span>\n",
+		},
+		{
+			name: "longer hex and words untouched",
+			in:   `<code>0123456789abcdef</code><p>feedface1 xdeadbeef</p>`,
+			want: "<code>0123456789abcdef</code>\n<p>feedface1 xdeadbeef</p>\n",
+		},
+		{
+			name: "underscore is a boundary",
+			in:   `<div id="filter_abcdef12">`,
+			want: "<div id=\"filter_id1\">\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstDiff(t *testing.T) {
+	if _, _, _, differ := firstDiff("a\nb\n", "a\nb\n"); differ {
+		t.Error("identical input reported as different")
+	}
+
+	line, w, g, differ := firstDiff("a\nb\n", "a\nc\n")
+	if !differ || line != 2 || w != "b" || g != "c" {
+		t.Errorf("firstDiff() = %d %q %q %v, want 2 \"b\" \"c\" true", line, w, g, differ)
+	}
+
+	line, _, g, _ = firstDiff("a\n", "a\n\nextra")
+	if line != 3 || g != "extra" {
+		t.Errorf("firstDiff() on longer got = line %d %q, want line 3 \"extra\"", line, g)
+	}
+}
+
+// fatalTB records Fatalf instead of failing the test
+type fatalTB struct {
+	testing.TB
+	fatal string
+}
+
+func (f *fatalTB) Fatalf(format string, args ...any) {
+	f.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func TestAssertMissingFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Without UPDATE_GOLDEN a missing file fails and is not recorded
+	tb := &fatalTB{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Assert(tb, "page", "<p>hi</p>\n")
+	}()
+	<-done
+	if !strings.Contains(tb.fatal, "missing") {
+		t.Errorf("Assert() on a missing file fatal = %q, want missing", tb.fatal)
+	}
+	if _, err := os.Stat(filepath.Join(Dir, "page.golden")); !os.IsNotExist(err) {
+		t.Errorf("Assert() recorded a missing file (stat error = %v)", err)
+	}
+
+	// UPDATE_GOLDEN records it, after which it compares
+	t.Setenv(UpdateEnv, "1")
+	Assert(t, "page", "<p>hi</p>\n")
+	t.Setenv(UpdateEnv, "")
+	Assert(t, "page", "<p>hi</p>\n")
+}
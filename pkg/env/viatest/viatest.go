@@ -0,0 +1,264 @@
+// Package viatest drives Via pages in a headless gost-dom browser, so
+// dashboards can be tested end to end without a TCP server:
+//
+//	func TestDashboard(t *testing.T) {
+//	    v := via.New()
+//	    env.RegisterUsagePage(v, mgr, env.DashboardOptions{})
+//
+//	    b := viatest.TestBrowser(t, v)
+//	    b.Open("/usage")
+//	    b.ClickButton("Refresh")
+//	    b.AssertTableRow("table", "orders.created", "orders/api")
+//	}
+//
+// The browser runs page scripts in V8 (cgo). Keep these tests behind the
+// integration build tag like pcview does:
+//
+//	//go:build integration
+//
+// Via renders server-side, so content is there as soon as Open returns;
+// updates pushed later over SSE are awaited with WaitFor / WaitForText.
+package viatest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-via/via"
+	"github.com/gost-dom/browser"
+	"github.com/gost-dom/browser/dom"
+	"github.com/gost-dom/browser/html"
+	"github.com/gost-dom/browser/scripting/v8engine"
+	"github.com/gost-dom/browser/testing/gosttest"
+)
+
+// DefaultTimeout bounds a whole test browser session
+const DefaultTimeout = 5 * time.Second
+
+// settle is how long the clock advances after loads and clicks so
+// immediate JS initialisation runs (the SSE stream stays open)
+const settle = 100 * time.Millisecond
+
+// Option configures a test browser
+type Option func(*config)
+
+type config struct {
+	timeout time.Duration
+	host    string
+}
+
+// WithTimeout bounds the browser session (default: DefaultTimeout)
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithHost sets the origin pages are opened on (default: http://localhost)
+func WithHost(host string) Option {
+	return func(c *config) {
+		c.host = host
+	}
+}
+
+// Browser is a headless browser bound to one Via instance
+type Browser struct {
+	t    testing.TB
+	ctx  context.Context
+	b    *browser.Browser
+	win  html.Window
+	host string
+}
+
+// TestBrowser creates a browser that serves v's pages in-process. It is
+// closed when the test ends.
+func TestBrowser(t testing.TB, v *via.V, opts ...Option) *Browser {
+	t.Helper()
+
+	cfg := config{timeout: DefaultTimeout, host: "http://localhost"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	b := browser.New(
+		browser.WithScriptEngine(v8engine.DefaultEngine()),
+		browser.WithContext(ctx),
+		browser.WithHandler(v.Handler()),
+		browser.WithLogger(gosttest.NewTestingLogger(t)),
+	)
+	t.Cleanup(func() {
+		b.Close()
+		cancel()
+	})
+
+	return &Browser{t: t, ctx: ctx, b: b, host: cfg.host}
+}
+
+// Open loads path (e.g. "/processes") and runs its initial scripts
+func (b *Browser) Open(path string) {
+	b.t.Helper()
+
+	win, err := b.b.Open(b.host + path)
+	if err != nil {
+		b.t.Fatalf("opening %s: %v", path, err)
+	}
+	b.win = win
+	_ = win.Clock().Advance(settle)
+}
+
+// Window returns the current window (after Open)
+func (b *Browser) Window() html.Window {
+	b.t.Helper()
+	if b.win == nil {
+		b.t.Fatal("viatest: Open a page first")
+	}
+	return b.win
+}
+
+// Document returns the current document
+func (b *Browser) Document() dom.Document {
+	b.t.Helper()
+	return b.Window().Document()
+}
+
+// Text returns the text content of the page body
+func (b *Browser) Text() string {
+	b.t.Helper()
+	return b.Document().Body().TextContent()
+}
+
+// Button returns the first button whose text is label (ignoring
+// surrounding whitespace), or nil
+func (b *Browser) Button(label string) html.HTMLElement {
+	b.t.Helper()
+
+	buttons := b.Document().GetElementsByTagName("button")
+	for i := 0; i < buttons.Length(); i++ {
+		if btn, ok := buttons.Item(i).(html.HTMLElement); ok && strings.TrimSpace(btn.TextContent()) == label {
+			return btn
+		}
+	}
+	return nil
+}
+
+// ClickButton clicks the button labelled label; the test fails if there is none
+func (b *Browser) ClickButton(label string) {
+	b.t.Helper()
+
+	btn := b.Button(label)
+	if btn == nil {
+		b.t.Fatalf("no button %q on the page", label)
+	}
+	btn.Click()
+	_ = b.Window().Clock().Advance(settle)
+}
+
+// WaitFor processes browser events (SSE patches, timers, action
+// responses) until cond returns true; the test fails on timeout
+func (b *Browser) WaitFor(cond func() bool) {
+	b.t.Helper()
+
+	_ = b.Window().Clock().ProcessEventsWhile(b.ctx, func() bool {
+		return !cond()
+	})
+	if !cond() {
+		b.t.Fatal("viatest: condition not met before timeout")
+	}
+}
+
+// WaitForText waits until the page body contains text, e.g. after a
+// server-side change was pushed over SSE
+func (b *Browser) WaitForText(text string) {
+	b.t.Helper()
+
+	b.waitText(text, true)
+}
+
+// WaitForNoText waits until the page body no longer contains text
+func (b *Browser) WaitForNoText(text string) {
+	b.t.Helper()
+
+	b.waitText(text, false)
+}
+
+// waitText waits for text to appear (present) or disappear
+func (b *Browser) waitText(text string, present bool) {
+	b.t.Helper()
+
+	has := func() bool { return strings.Contains(b.Text(), text) == present }
+	_ = b.Window().Clock().ProcessEventsWhile(b.ctx, func() bool { return !has() })
+	if !has() {
+		if present {
+			b.t.Fatalf("page never showed %q; body: %s", text, b.Text())
+		}
+		b.t.Fatalf("page still shows %q", text)
+	}
+}
+
+// TableRows returns the cell texts of the body rows of the tables matching
+// selector (e.g. "table", "#usage-table")
+func (b *Browser) TableRows(selector string) [][]string {
+	b.t.Helper()
+
+	rows, err := b.Document().QuerySelectorAll(selector + " tbody tr")
+	if err != nil {
+		b.t.Fatalf("querying %q: %v", selector, err)
+	}
+
+	var out [][]string
+	for i := 0; i < rows.Length(); i++ {
+		row, ok := rows.Item(i).(dom.Element)
+		if !ok {
+			continue
+		}
+		cells, err := row.QuerySelectorAll("td, th")
+		if err != nil {
+			b.t.Fatalf("querying cells: %v", err)
+		}
+		texts := make([]string, cells.Length())
+		for j := range texts {
+			texts[j] = strings.TrimSpace(cells.Item(j).TextContent())
+		}
+		out = append(out, texts)
+	}
+	return out
+}
+
+// AssertTableRow fails unless a row of the tables matching selector starts
+// with the given cell texts
+func (b *Browser) AssertTableRow(selector string, cells ...string) {
+	b.t.Helper()
+
+	rows := b.TableRows(selector)
+	for _, row := range rows {
+		if hasPrefix(row, cells) {
+			return
+		}
+	}
+	b.t.Errorf("no row in %q starts with %q; rows: %q", selector, cells, rows)
+}
+
+// AssertRowCount fails unless the tables matching selector have n body rows
+func (b *Browser) AssertRowCount(selector string, n int) {
+	b.t.Helper()
+
+	if rows := b.TableRows(selector); len(rows) != n {
+		b.t.Errorf("%q has %d rows, want %d; rows: %q", selector, len(rows), n, rows)
+	}
+}
+
+// hasPrefix reports whether row starts with cells
+func hasPrefix(row, cells []string) bool {
+	if len(cells) > len(row) {
+		return false
+	}
+	for i, c := range cells {
+		if row[i] != c {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+// plugin.go: Serving wasm jobs from a Manager
+package wasmjob
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/wellnown-env/pkg/env"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Plugin serves wasm jobs over the manager's NATS connection:
+//
+//	env.New("CAMERA", env.WithPlugins(&wasmjob.Plugin{
+//	    Allow: wasmjob.Capabilities{Clock: true},
+//	}))
+//
+// It stops taking jobs while the node is in maintenance.
+type Plugin struct {
+	Allow  Capabilities
+	Node   string // Node name jobs are sent to ("" = lowercase prefix)
+	Bucket string // Module object store ("" = DefaultBucket)
+
+	mu          sync.Mutex
+	nc          *nats.Conn
+	ex          *Executor
+	sub         *nats.Subscription // nil while in maintenance
+	unsubscribe func()
+}
+
+// Name labels the plugin in logs
+func (p *Plugin) Name() string {
+	return "wasmjob"
+}
+
+// Init opens the module store and starts serving jobs
+func (p *Plugin) Init(mgr *env.Manager) error {
+	nc, js := mgr.NC(), mgr.JetStream()
+	if nc == nil || js == nil {
+		return fmt.Errorf("wasm jobs need NATS")
+	}
+	if p.Node == "" {
+		p.Node = strings.ToLower(mgr.Prefix())
+	}
+	if p.Bucket == "" {
+		p.Bucket = DefaultBucket
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	store, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:      p.Bucket,
+		Description: "WASM job modules for wellnown-env",
+	})
+	if err != nil {
+		return fmt.Errorf("opening module store %s: %w", p.Bucket, err)
+	}
+
+	p.nc, p.ex = nc, &Executor{Store: store, Allow: p.Allow}
+	if mgr.Maintenance() == nil {
+		if err := p.serve(); err != nil {
+			return err
+		}
+	}
+	p.unsubscribe = mgr.Events().Subscribe(p.onMaintenance, env.EventMaintenanceStarted, env.EventMaintenanceEnded)
+	return nil
+}
+
+// serve starts taking jobs
+func (p *Plugin) serve() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sub != nil {
+		return nil
+	}
+	sub, err := p.ex.Serve(p.nc, p.Node)
+	if err != nil {
+		return err
+	}
+	p.sub = sub
+	return nil
+}
+
+// drain stops taking jobs, letting the running one finish
+func (p *Plugin) drain() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sub == nil {
+		return nil
+	}
+	err := p.sub.Drain()
+	p.sub = nil
+	return err
+}
+
+// onMaintenance pauses and resumes serving with the node's maintenance
+func (p *Plugin) onMaintenance(e env.Event) {
+	var err error
+	if e.Type == env.EventMaintenanceStarted {
+		err = p.drain()
+	} else {
+		err = p.serve()
+	}
+	if err != nil {
+		slog.Warn("wasm jobs: maintenance change failed", "event", e.Type, "error", err)
+	}
+}
+
+// OnParse does nothing; jobs do not depend on the config
+func (p *Plugin) OnParse(cfg any) error {
+	return nil
+}
+
+// OnShutdown stops taking jobs, letting the running one finish
+func (p *Plugin) OnShutdown() error {
+	if p.unsubscribe != nil {
+		p.unsubscribe()
+	}
+	return p.drain()
+}
@@ -0,0 +1,346 @@
+// Package wasmjob runs small WASM jobs pushed over the mesh in a wazero
+// sandbox, so computations move to the edge without shipping native
+// binaries.
+//
+// Modules (WASI preview 1, e.g. GOOS=wasip1 GOARCH=wasm) are published to
+// a NATS object store. A job names a module and the capabilities it needs;
+// nodes declare the most they allow and refuse anything beyond that:
+//
+//	// Hub or CI: publish the module
+//	obs, _ := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: wasmjob.DefaultBucket})
+//	wasmjob.Publish(ctx, obs, "resize", f)
+//
+//	// Edge node: accept jobs (also available as a Manager plugin, see Plugin)
+//	ex := &wasmjob.Executor{Store: obs, Allow: wasmjob.Capabilities{Clock: true}}
+//	ex.Serve(nc, "camera")
+//
+//	// Anywhere: run a job on the camera nodes
+//	res, _ := wasmjob.Submit(ctx, nc, "camera", wasmjob.Job{Module: "resize", Stdin: img})
+//
+// Sandbox: no filesystem, clock or randomness unless granted, no network
+// (WASI preview 1 has none), bounded memory and run time, and capped
+// output. Without Clock the module sees a fixed fake clock; without
+// Random a deterministic source.
+package wasmjob
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// DefaultBucket is the object store holding modules
+const DefaultBucket = "wasm_jobs"
+
+// SubjectPrefix is followed by the target node name (jobs.wasm.{node})
+const SubjectPrefix = "jobs.wasm."
+
+// Limits applied when a job does not set its own
+const (
+	DefaultMemoryPages = 256 // 64 KiB pages (16 MiB)
+	DefaultTimeout     = 30 * time.Second
+)
+
+// Size limits of modules and of each output stream
+const (
+	MaxModuleSize = 32 << 20
+	MaxOutputSize = 1 << 20
+)
+
+// Mount exposes a host directory to the module
+type Mount struct {
+	Host  string `json:"host"`
+	Guest string `json:"guest"`           // Path seen by the module
+	Write bool   `json:"write,omitempty"` // Read-only unless set
+}
+
+// Capabilities is what a job needs, or the most a node allows
+type Capabilities struct {
+	Clock       bool          `json:"clock,omitempty"`        // Real wall and monotonic clocks, sleep
+	Random      bool          `json:"random,omitempty"`       // Crypto random source
+	Dirs        []Mount       `json:"dirs,omitempty"`         // Host directories
+	MemoryPages uint32        `json:"memory_pages,omitempty"` // 0 = DefaultMemoryPages
+	Timeout     time.Duration `json:"timeout,omitempty"`      // 0 = DefaultTimeout
+}
+
+// memoryPages returns the memory limit with the default applied
+func (c Capabilities) memoryPages() uint32 {
+	if c.MemoryPages == 0 {
+		return DefaultMemoryPages
+	}
+	return c.MemoryPages
+}
+
+// timeout returns the run time limit with the default applied
+func (c Capabilities) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// Permit checks that want asks for nothing beyond allow
+func Permit(want, allow Capabilities) error {
+	if want.Clock && !allow.Clock {
+		return fmt.Errorf("clock not allowed")
+	}
+	if want.Random && !allow.Random {
+		return fmt.Errorf("random source not allowed")
+	}
+	if want.memoryPages() > allow.memoryPages() {
+		return fmt.Errorf("memory of %d pages exceeds the %d allowed", want.memoryPages(), allow.memoryPages())
+	}
+	if want.timeout() > allow.timeout() {
+		return fmt.Errorf("timeout %s exceeds the %s allowed", want.timeout(), allow.timeout())
+	}
+	for _, d := range want.Dirs {
+		if !dirAllowed(d, allow.Dirs) {
+			mode := "read-only"
+			if d.Write {
+				mode = "writable"
+			}
+			return fmt.Errorf("%s mount of %s at %s not allowed", mode, d.Host, d.Guest)
+		}
+	}
+	return nil
+}
+
+// dirAllowed reports whether an allowed mount covers d
+func dirAllowed(d Mount, allowed []Mount) bool {
+	for _, a := range allowed {
+		if a.Host == d.Host && a.Guest == d.Guest && (a.Write || !d.Write) {
+			return true
+		}
+	}
+	return false
+}
+
+// Job is a request to run a module
+type Job struct {
+	Module string            `json:"module"` // Object name in the store
+	Args   []string          `json:"args,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	Stdin  []byte            `json:"stdin,omitempty"`
+	Caps   Capabilities      `json:"caps"`
+}
+
+// Result is the outcome of a job. A module that ran and exited non-zero
+// is a Result with ExitCode set, not an Error.
+type Result struct {
+	ExitCode  uint32        `json:"exit_code"`
+	Stdout    []byte        `json:"stdout,omitempty"`
+	Stderr    []byte        `json:"stderr,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"` // Output beyond MaxOutputSize was dropped
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"` // Refused, not found, failed to compile or timed out
+}
+
+// Publish stores a module under name, replacing any previous version
+func Publish(ctx context.Context, store jetstream.ObjectStore, name string, r io.Reader) error {
+	if _, err := store.Put(ctx, jetstream.ObjectMeta{Name: name}, r); err != nil {
+		return fmt.Errorf("publishing module %s: %w", name, err)
+	}
+	return nil
+}
+
+// Executor runs jobs on this node
+type Executor struct {
+	Store jetstream.ObjectStore // Modules
+	Allow Capabilities          // The most a job may ask for
+}
+
+// Run runs job and returns its result. Errors mean the job did not run to
+// completion: refused, module missing or invalid, or out of time.
+func (e *Executor) Run(ctx context.Context, job Job) (*Result, error) {
+	if err := Permit(job.Caps, e.Allow); err != nil {
+		return nil, fmt.Errorf("job %s refused: %w", job.Module, err)
+	}
+	wasm, err := e.load(ctx, job.Module)
+	if err != nil {
+		return nil, err
+	}
+	return run(ctx, wasm, job)
+}
+
+// load reads a module from the store
+func (e *Executor) load(ctx context.Context, name string) ([]byte, error) {
+	obj, err := e.Store.Get(ctx, name)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, fmt.Errorf("no module %s in the store", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading module %s: %w", name, err)
+	}
+	defer obj.Close()
+
+	wasm, err := io.ReadAll(io.LimitReader(obj, MaxModuleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("loading module %s: %w", name, err)
+	}
+	if len(wasm) > MaxModuleSize {
+		return nil, fmt.Errorf("module %s is larger than %d bytes", name, MaxModuleSize)
+	}
+	return wasm, nil
+}
+
+// run executes wasm in a fresh runtime limited to job.Caps
+func run(ctx context.Context, wasm []byte, job Job) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, job.Caps.timeout())
+	defer cancel()
+
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(job.Caps.memoryPages()).
+		WithCloseOnContextDone(true))
+	defer rt.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, rt)
+
+	compiled, err := rt.CompileModule(ctx, wasm)
+	if err != nil {
+		return nil, fmt.Errorf("compiling module %s: %w", job.Module, err)
+	}
+
+	stdout := &capped{max: MaxOutputSize}
+	stderr := &capped{max: MaxOutputSize}
+	cfg := wazero.NewModuleConfig().
+		WithName(job.Module).
+		WithArgs(append([]string{job.Module}, job.Args...)...).
+		WithStdin(bytes.NewReader(job.Stdin)).
+		WithStdout(stdout).
+		WithStderr(stderr)
+	for key, value := range job.Env {
+		cfg = cfg.WithEnv(key, value)
+	}
+	if job.Caps.Clock {
+		cfg = cfg.WithSysWalltime().WithSysNanotime().WithSysNanosleep()
+	}
+	if job.Caps.Random {
+		cfg = cfg.WithRandSource(rand.Reader)
+	}
+	if len(job.Caps.Dirs) > 0 {
+		fs := wazero.NewFSConfig()
+		for _, d := range job.Caps.Dirs {
+			if d.Write {
+				fs = fs.WithDirMount(d.Host, d.Guest)
+			} else {
+				fs = fs.WithReadOnlyDirMount(d.Host, d.Guest)
+			}
+		}
+		cfg = cfg.WithFSConfig(fs)
+	}
+
+	start := time.Now()
+	mod, err := rt.InstantiateModule(ctx, compiled, cfg)
+	if mod != nil {
+		mod.Close(context.Background())
+	}
+	res := &Result{
+		Stdout:    stdout.buf.Bytes(),
+		Stderr:    stderr.buf.Bytes(),
+		Truncated: stdout.truncated || stderr.truncated,
+		Duration:  time.Since(start),
+	}
+
+	var exit *sys.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exit) && exit.ExitCode() == sys.ExitCodeDeadlineExceeded:
+		return res, fmt.Errorf("job %s timed out after %s", job.Module, job.Caps.timeout())
+	case errors.As(err, &exit) && exit.ExitCode() == sys.ExitCodeContextCanceled:
+		return res, fmt.Errorf("job %s canceled", job.Module)
+	case errors.As(err, &exit):
+		res.ExitCode = exit.ExitCode()
+	default:
+		return res, fmt.Errorf("running module %s: %w", job.Module, err)
+	}
+	return res, nil
+}
+
+// capped is a buffer that drops writes beyond max
+type capped struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := c.max - c.buf.Len(); len(p) > room {
+		p = p[:max(room, 0)]
+		c.truncated = true
+	}
+	c.buf.Write(p)
+	return n, nil // Never fail the module over output
+}
+
+// Subject returns the subject jobs for node are sent on
+func Subject(node string) string {
+	return SubjectPrefix + node
+}
+
+// Serve runs jobs sent to node, one at a time. Instances serving the same
+// node name share the work (queue group).
+func (e *Executor) Serve(nc *nats.Conn, node string) (*nats.Subscription, error) {
+	sub, err := nc.QueueSubscribe(Subject(node), node, func(msg *nats.Msg) {
+		msg.Respond(e.handle(msg.Data))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("serving wasm jobs for %s: %w", node, err)
+	}
+	return sub, nil
+}
+
+// handle runs one encoded job and encodes its result
+func (e *Executor) handle(data []byte) []byte {
+	var job Job
+	res := &Result{}
+	if err := json.Unmarshal(data, &job); err != nil {
+		res.Error = fmt.Sprintf("decoding job: %v", err)
+	} else if r, err := e.Run(context.Background(), job); err != nil {
+		if r != nil {
+			res = r
+		}
+		res.Error = err.Error()
+	} else {
+		res = r
+	}
+	out, _ := json.Marshal(res)
+	return out
+}
+
+// Submit sends job to a node serving name and waits for the result. A
+// job the node refused or could not run returns an error along with
+// whatever result it reported.
+func Submit(ctx context.Context, nc *nats.Conn, node string, job Job) (*Result, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("encoding job: %w", err)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Caps.timeout()+10*time.Second)
+		defer cancel()
+	}
+	msg, err := nc.RequestWithContext(ctx, Subject(node), data)
+	if err != nil {
+		return nil, fmt.Errorf("submitting job %s to %s: %w", job.Module, node, err)
+	}
+	var res Result
+	if err := json.Unmarshal(msg.Data, &res); err != nil {
+		return nil, fmt.Errorf("decoding result: %w", err)
+	}
+	if res.Error != "" {
+		return &res, fmt.Errorf("job %s on %s: %s", job.Module, node, res.Error)
+	}
+	return &res, nil
+}
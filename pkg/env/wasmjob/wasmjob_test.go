@@ -0,0 +1,93 @@
+package wasmjob
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestPermit(t *testing.T) {
+	allow := Capabilities{
+		Clock:   true,
+		Dirs:    []Mount{{Host: "/data/in", Guest: "/in"}, {Host: "/data/out", Guest: "/out", Write: true}},
+		Timeout: time.Minute,
+	}
+	tests := []struct {
+		name string
+		want Capabilities
+		err  string
+	}{
+		{name: "nothing", want: Capabilities{}},
+		{name: "clock", want: Capabilities{Clock: true}},
+		{name: "read-only mount", want: Capabilities{Dirs: []Mount{{Host: "/data/in", Guest: "/in"}}}},
+		{name: "read a writable mount", want: Capabilities{Dirs: []Mount{{Host: "/data/out", Guest: "/out"}}}},
+		{name: "write a writable mount", want: Capabilities{Dirs: []Mount{{Host: "/data/out", Guest: "/out", Write: true}}}},
+		{name: "random", want: Capabilities{Random: true}, err: "random source not allowed"},
+		{name: "write a read-only mount", want: Capabilities{Dirs: []Mount{{Host: "/data/in", Guest: "/in", Write: true}}}, err: "writable mount of /data/in"},
+		{name: "other dir", want: Capabilities{Dirs: []Mount{{Host: "/etc", Guest: "/in"}}}, err: "read-only mount of /etc"},
+		{name: "other guest path", want: Capabilities{Dirs: []Mount{{Host: "/data/in", Guest: "/x"}}}, err: "mount of /data/in at /x"},
+		{name: "memory", want: Capabilities{MemoryPages: DefaultMemoryPages + 1}, err: "memory of 257 pages"},
+		{name: "timeout", want: Capabilities{Timeout: time.Hour}, err: "timeout 1h0m0s exceeds"},
+	}
+	for _, tt := range tests {
+		err := Permit(tt.want, allow)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: Permit() error = %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: Permit() error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// Defaults on both sides compare equal
+	if err := Permit(Capabilities{}, Capabilities{}); err != nil {
+		t.Errorf("Permit() of defaults error = %v", err)
+	}
+}
+
+func TestCapped(t *testing.T) {
+	c := &capped{max: 5}
+	for _, s := range []string{"abc", "defg", "h"} {
+		if n, err := c.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if got := c.buf.String(); got != "abcde" || !c.truncated {
+		t.Errorf("capped = %q (truncated %v), want \"abcde\" truncated", got, c.truncated)
+	}
+}
+
+// emptyStore has no modules
+type emptyStore struct {
+	jetstream.ObjectStore
+}
+
+func (emptyStore) Get(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) (jetstream.ObjectResult, error) {
+	return nil, jetstream.ErrObjectNotFound
+}
+
+func TestHandleErrors(t *testing.T) {
+	ex := &Executor{Store: emptyStore{}}
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "bad json", data: "{", want: "decoding job"},
+		{name: "refused", data: `{"module":"resize","caps":{"clock":true}}`, want: "job resize refused: clock not allowed"},
+		{name: "missing", data: `{"module":"resize"}`, want: "no module resize in the store"},
+	}
+	for _, tt := range tests {
+		var res Result
+		if err := json.Unmarshal(ex.handle([]byte(tt.data)), &res); err != nil {
+			t.Fatalf("%s: decoding result: %v", tt.name, err)
+		}
+		if !strings.Contains(res.Error, tt.want) {
+			t.Errorf("%s: Result.Error = %q, want %q", tt.name, res.Error, tt.want)
+		}
+	}
+}
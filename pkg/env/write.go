@@ -0,0 +1,155 @@
+// write.go: Timeouts and retries for JetStream writes
+//
+// KV puts and JetStream publishes go through a WritePolicy: each attempt
+// gets its own timeout, and attempts that failed for transient reasons
+// (timeouts, no responders, JetStream briefly unavailable) are retried with
+// jittered exponential backoff. Failures come back as *WriteError, which
+// says what was written, how often it was tried and which class of
+// failure stopped it:
+//
+//	err := registrar.Register(ctx, "APP", &cfg)
+//	if errors.Is(err, env.ErrWriteTimeout) { ... } // Hub overloaded
+//
+// The Manager applies its policy (WithWritePolicy) to the registrar,
+// KVBucket and the outbox.
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Write failure classes; a *WriteError matches one of them with errors.Is
+var (
+	ErrWriteTimeout     = errors.New("jetstream write timed out")    // Retried
+	ErrWriteUnavailable = errors.New("jetstream unavailable")        // Retried
+	ErrWriteRejected    = errors.New("jetstream rejected the write") // Not retried
+)
+
+// DefaultWritePolicy is used when a policy field is zero
+var DefaultWritePolicy = WritePolicy{
+	Timeout:    2 * time.Second,
+	Attempts:   3,
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: time.Second,
+}
+
+// WritePolicy controls the timeout and retries of a JetStream write.
+// Zero fields use DefaultWritePolicy.
+type WritePolicy struct {
+	Timeout    time.Duration // Per attempt
+	Attempts   int           // Total attempts (1 = no retries)
+	Backoff    time.Duration // Delay before the first retry, doubled after each
+	MaxBackoff time.Duration // Backoff cap
+}
+
+// withDefaults fills zero fields from DefaultWritePolicy
+func (p WritePolicy) withDefaults() WritePolicy {
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultWritePolicy.Timeout
+	}
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultWritePolicy.Attempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultWritePolicy.Backoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultWritePolicy.MaxBackoff
+	}
+	return p
+}
+
+// backoff returns the delay before retry n (1-based): the doubled base
+// delay, capped, with up to half of it replaced by random jitter
+func (p WritePolicy) backoff(n int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// WriteError is a JetStream write that failed after all attempts
+type WriteError struct {
+	Op       string // put, delete, publish
+	Target   string // Bucket/key or subject
+	Class    error  // ErrWriteTimeout, ErrWriteUnavailable, ErrWriteRejected or context.Canceled
+	Attempts int
+	Err      error // Last underlying error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("%s %s: %v after %d attempt(s): %v", e.Op, e.Target, e.Class, e.Attempts, e.Err)
+}
+
+// Unwrap exposes both the class and the underlying error to errors.Is
+func (e *WriteError) Unwrap() []error {
+	return []error{e.Class, e.Err}
+}
+
+// classifyWriteError maps a write error to its failure class
+func classifyWriteError(err error) error {
+	var apiErr *jetstream.APIError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return context.Canceled // Caller gave up; not a JetStream failure
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+		return ErrWriteTimeout
+	case errors.Is(err, nats.ErrNoResponders):
+		return ErrWriteUnavailable
+	case errors.As(err, &apiErr) && apiErr.Code == http.StatusServiceUnavailable:
+		return ErrWriteUnavailable // No stream leader yet, JetStream catching up
+	default:
+		return ErrWriteRejected
+	}
+}
+
+// do runs write until it succeeds, fails permanently, runs out of attempts
+// or ctx ends. Each attempt gets its own timeout.
+func (p WritePolicy) do(ctx context.Context, op, target string, write func(ctx context.Context) error) error {
+	p = p.withDefaults()
+
+	var err, class error
+	attempt := 0
+	for {
+		attempt++
+		attemptCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+		err = write(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err() // The caller's deadline, not the attempt's
+		}
+
+		class = classifyWriteError(err)
+		retryable := class == ErrWriteTimeout || class == ErrWriteUnavailable
+		if !retryable || ctx.Err() != nil || attempt == p.Attempts {
+			break
+		}
+
+		metrics.writeRetries.Add(1)
+		select {
+		case <-time.After(p.backoff(attempt)):
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+			class = classifyWriteError(err)
+		}
+		break
+	}
+
+	metrics.observeWriteFailure(class)
+	return &WriteError{Op: op, Target: target, Class: class, Attempts: attempt, Err: err}
+}
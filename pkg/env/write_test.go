@@ -0,0 +1,175 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fastWrites retries quickly so tests don't wait on backoff
+var fastWrites = WritePolicy{Timeout: 50 * time.Millisecond, Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestClassifyWriteError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "deadline", err: context.DeadlineExceeded, want: ErrWriteTimeout},
+		{name: "nats timeout", err: fmt.Errorf("put: %w", nats.ErrTimeout), want: ErrWriteTimeout},
+		{name: "no responders", err: nats.ErrNoResponders, want: ErrWriteUnavailable},
+		{name: "jetstream 503", err: &jetstream.APIError{Code: 503}, want: ErrWriteUnavailable},
+		{name: "jetstream 400", err: &jetstream.APIError{Code: 400}, want: ErrWriteRejected},
+		{name: "canceled", err: context.Canceled, want: context.Canceled},
+		{name: "other", err: errors.New("wrong last sequence"), want: ErrWriteRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyWriteError(tt.err); got != tt.want {
+				t.Errorf("classifyWriteError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePolicyDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error // Returned by successive attempts; nil = success
+		wantAttempts int
+		wantClass    error // nil = success
+	}{
+		{name: "first attempt", errs: []error{nil}, wantAttempts: 1},
+		{name: "retried timeout", errs: []error{nats.ErrTimeout, nil}, wantAttempts: 2},
+		{name: "retried unavailable", errs: []error{nats.ErrNoResponders, nats.ErrNoResponders, nil}, wantAttempts: 3},
+		{name: "out of attempts", errs: []error{nats.ErrTimeout, nats.ErrTimeout, nats.ErrTimeout}, wantAttempts: 3, wantClass: ErrWriteTimeout},
+		{name: "rejected not retried", errs: []error{errors.New("bad key")}, wantAttempts: 1, wantClass: ErrWriteRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := fastWrites.do(context.Background(), "put", "k", func(context.Context) error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantClass == nil {
+				if err != nil {
+					t.Errorf("do() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var werr *WriteError
+			if !errors.As(err, &werr) {
+				t.Fatalf("do() error = %v, want *WriteError", err)
+			}
+			if !errors.Is(err, tt.wantClass) {
+				t.Errorf("do() error = %v, want class %v", err, tt.wantClass)
+			}
+			if !errors.Is(err, tt.errs[len(tt.errs)-1]) {
+				t.Errorf("do() error = %v does not wrap the last write error", err)
+			}
+			if werr.Attempts != tt.wantAttempts {
+				t.Errorf("WriteError.Attempts = %d, want %d", werr.Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWritePolicyAttemptTimeout(t *testing.T) {
+	attempts := 0
+	err := fastWrites.do(context.Background(), "put", "k", func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done() // Hub never answers
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrWriteTimeout) {
+		t.Errorf("do() error = %v, want ErrWriteTimeout", err)
+	}
+	if attempts != fastWrites.Attempts {
+		t.Errorf("attempts = %d, want %d", attempts, fastWrites.Attempts)
+	}
+}
+
+func TestWritePolicyCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := fastWrites.do(ctx, "put", "k", func(context.Context) error {
+		attempts++
+		cancel() // Caller gives up during the first attempt
+		return nats.ErrTimeout
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("do() error = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestWritePolicyBackoff(t *testing.T) {
+	p := WritePolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}.withDefaults()
+
+	tests := []struct {
+		retry int
+		base  time.Duration
+	}{
+		{retry: 1, base: 100 * time.Millisecond},
+		{retry: 2, base: 200 * time.Millisecond},
+		{retry: 4, base: 800 * time.Millisecond},
+		{retry: 5, base: time.Second}, // Capped
+		{retry: 50, base: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.retry), func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if d := p.backoff(tt.retry); d < tt.base/2 || d > tt.base {
+					t.Fatalf("backoff(%d) = %v, want within [%v, %v]", tt.retry, d, tt.base/2, tt.base)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistrarRetriesWrites(t *testing.T) {
+	type config struct {
+		Port int `conf:"default:8080"`
+	}
+
+	kv := &flakyKV{memKV: newMemKV(), failures: 2}
+	r := NewRegistrar(kv, 0)
+	r.SetWritePolicy(fastWrites)
+
+	if err := r.Register(context.Background(), "APP", &config{}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err := kv.Get(context.Background(), r.Key()); err != nil {
+		t.Errorf("registration not stored: %v", err)
+	}
+}
+
+// flakyKV times out the first failures puts
+type flakyKV struct {
+	*memKV
+	failures int
+}
+
+func (f *flakyKV) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	if f.failures > 0 {
+		f.failures--
+		return 0, nats.ErrTimeout
+	}
+	return f.memKV.Put(ctx, key, value)
+}